@@ -0,0 +1,62 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// GUIDReservationStateAllocated the GUID is reserved and member of the requested pkey
+	GUIDReservationStateAllocated = "Allocated"
+	// GUIDReservationStateFailed the GUID reservation failed, see the status message
+	GUIDReservationStateFailed = "Failed"
+)
+
+// IBGuidReservationResource is the resource of IBGuidReservation objects
+var IBGuidReservationResource = schema.GroupVersionResource{
+	Group: GroupVersion.Group, Version: GroupVersion.Version, Resource: "ibguidreservations"}
+
+// IBGuidReservationSpec defines the GUID requested by a non-pod consumer
+type IBGuidReservationSpec struct {
+	// GUID to reserve, the next free GUID in the pool is reserved if empty.
+	// The GUID can't be changed after it was reserved.
+	// +optional
+	GUID string `json:"guid,omitempty"`
+	// PKey the reserved GUID should be a member of, e.g "0x5"
+	// +optional
+	PKey string `json:"pkey,omitempty"`
+}
+
+// IBGuidReservationStatus defines the observed state of the reservation
+type IBGuidReservationStatus struct {
+	// GUID reserved from the pool
+	GUID string `json:"guid,omitempty"`
+	// PKey the reserved GUID is a member of
+	PKey string `json:"pkey,omitempty"`
+	// State of the reservation, "Allocated" or "Failed"
+	State string `json:"state,omitempty"`
+	// Message describing the reason of failure
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// IBGuidReservation reserves a GUID from the ib-kubernetes GUID pool for consumers which are not pods,
+// and optionally adds it to a pkey
+type IBGuidReservation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IBGuidReservationSpec   `json:"spec,omitempty"`
+	Status IBGuidReservationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IBGuidReservationList contains a list of IBGuidReservation
+type IBGuidReservationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IBGuidReservation `json:"items"`
+}
@@ -0,0 +1,43 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// IBPartitionPolicyResource is the resource of IBPartitionPolicy objects
+var IBPartitionPolicyResource = schema.GroupVersionResource{
+	Group: GroupVersion.Group, Version: GroupVersion.Version, Resource: "ibpartitionpolicies"}
+
+// IBPartitionPolicySpec defines the pkeys the pods of namespaces are allowed to be members of
+type IBPartitionPolicySpec struct {
+	// Namespaces the policy applies to
+	Namespaces []string `json:"namespaces"`
+	// ServiceAccounts restricts the policy to pods running with these service accounts of the namespaces,
+	// the policy applies to all the pods of the namespaces if empty
+	// +optional
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+	// PKeys allowed for the pods, either a pkey, e.g. "0x5", or an inclusive range of pkeys, e.g. "0x100-0x1FF"
+	PKeys []string `json:"pkeys"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// IBPartitionPolicy allows the pods of namespaces to be members of pkeys. Once partition policies are enabled,
+// pods and GUID reservations are added only to pkeys allowed by a policy of their namespace.
+type IBPartitionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IBPartitionPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IBPartitionPolicyList contains a list of IBPartitionPolicy
+type IBPartitionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IBPartitionPolicy `json:"items"`
+}
@@ -0,0 +1,19 @@
+//go:build builtin_plugins
+
+package main
+
+import (
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/noop"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/remote"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/rest"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/ufm"
+)
+
+// The in-tree plugins are compiled into binaries built with the builtin_plugins tag, e.g. static binaries built
+// with CGO_ENABLED=0 which can't load plugin shared objects
+func init() {
+	registerBuiltinPlugin("noop", noop.SpecVersion, noop.Initialize)
+	registerBuiltinPlugin("remote", remote.SpecVersion, remote.Initialize)
+	registerBuiltinPlugin("rest", rest.SpecVersion, rest.Initialize)
+	registerBuiltinPlugin("ufm", ufm.SpecVersion, ufm.Initialize)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+)
+
+const subcommandsUsage = `Subcommands, sent to the running daemon over its admin socket:
+  guids list             List allocated GUIDs
+  guids release <guid>   Force release GUID and remove it from its pkey
+  guids export           Print JSON snapshot of allocated GUIDs, their pkeys and owners
+  guids import <file>    Restore allocated GUIDs and their pkeys membership from JSON snapshot file
+  pods release <namespace>/<name>
+                         Force release the GUIDs of the pod networks and remove them from their pkeys, even if
+                         the pod still exists
+  sync                   Resync the GUID pool with the subnet manager
+  networks drain <network>
+                         Remove the GUIDs of the network <namespace>_<name> or <namespace>/<name> from its pkey,
+                         release them and mark the network as not managed
+  plugin reload [<plugin> [<path>]]
+                         Reload the subnet manager plugin, optionally replacing its name and directory
+`
+
+// adminClient is the subset of admin.Client used by the subcommands
+type adminClient interface {
+	ListGUIDs() ([]admin.GUIDAllocation, error)
+	ReleaseGUID(guid string) error
+	ReleasePod(namespace, name string) (*admin.PodRelease, error)
+	Sync() error
+	ExportGUIDs() (*guid.Snapshot, error)
+	ImportGUIDs(snapshot *guid.Snapshot) error
+	ReloadPlugin(reload admin.PluginReload) error
+	DrainNetwork(networkID string) (*admin.NetworkDrain, error)
+}
+
+// runSubcommand executes the subcommand given by args against the daemon admin API
+func runSubcommand(client adminClient, args []string, out io.Writer) error {
+	switch {
+	case len(args) == 2 && args[0] == "guids" && args[1] == "list":
+		allocations, err := client.ListGUIDs()
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "GUID\tPOD UID\tNETWORK\tINTERFACE")
+		for _, allocation := range allocations {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+				allocation.GUID, allocation.PodUID, allocation.NetworkID, allocation.Interface)
+		}
+		return writer.Flush()
+	case len(args) == 3 && args[0] == "guids" && args[1] == "release":
+		if err := client.ReleaseGUID(args[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "guid %s released\n", args[2])
+		return nil
+	case len(args) == 3 && args[0] == "pods" && args[1] == "release":
+		namespace, name, found := strings.Cut(args[2], "/")
+		if !found || namespace == "" || name == "" {
+			return fmt.Errorf("invalid pod %q, expected <namespace>/<name>", args[2])
+		}
+		release, err := client.ReleasePod(namespace, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "pod %s/%s released %d guids\n", release.Namespace, release.Name, len(release.GUIDs))
+		for _, podGUID := range release.GUIDs {
+			fmt.Fprintln(out, podGUID)
+		}
+		return nil
+	case len(args) == 2 && args[0] == "guids" && args[1] == "export":
+		snapshot, err := client.ExportGUIDs()
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshot)
+	case len(args) == 3 && args[0] == "guids" && args[1] == "import":
+		data, err := os.ReadFile(args[2]) //nolint:gosec
+		if err != nil {
+			return fmt.Errorf("failed to read snapshot file: %v", err)
+		}
+		snapshot, err := guid.ParseSnapshot(data)
+		if err != nil {
+			return err
+		}
+		if err = client.ImportGUIDs(snapshot); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "imported %d guids\n", len(snapshot.Allocations))
+		return nil
+	case len(args) == 1 && args[0] == "sync":
+		if err := client.Sync(); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "guid pool synced")
+		return nil
+	case len(args) >= 2 && len(args) <= 4 && args[0] == "plugin" && args[1] == "reload":
+		reload := admin.PluginReload{}
+		if len(args) > 2 {
+			reload.Plugin = args[2]
+		}
+		if len(args) > 3 {
+			reload.PluginPath = args[3]
+		}
+		if err := client.ReloadPlugin(reload); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "subnet manager plugin reloaded")
+		return nil
+	case len(args) == 3 && args[0] == "networks" && args[1] == "drain":
+		drain, err := client.DrainNetwork(args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "network %s drained, released %d guids\n", drain.NetworkID, len(drain.GUIDs))
+		return nil
+	default:
+		return fmt.Errorf("unknown subcommand %q\n%s", args, subcommandsUsage)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [subcommand]\n\n", flag.CommandLine.Name())
+	fmt.Fprint(out, subcommandsUsage)
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
 	"github.com/Mellanox/ib-kubernetes/pkg/daemon"
 )
 
@@ -32,10 +33,6 @@ func setupLogging(debug bool) {
 	})
 }
 
-func printVersionString() string {
-	return fmt.Sprintf("ib-kubernetes version:%s, commit:%s, date:%s", version, commit, date)
-}
-
 func main() {
 	// Init command line flags to clear vendor packages' flags, especially in init()
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
@@ -44,16 +41,46 @@ func main() {
 	var versionOpt bool
 	flag.BoolVar(&versionOpt, "version", false, "Show application version")
 	flag.BoolVar(&versionOpt, "v", false, "Show application version")
+	var output string
+	flag.StringVar(&output, "o", textOutput,
+		"Output format of the application version, text or json including the build info and plugins")
 	flag.BoolVar(&debug, "debug", false, "Debug level logging")
+	var checkConfig bool
+	flag.BoolVar(&checkConfig, "check-config", false,
+		"Validate the configuration and the subnet manager connectivity, then exit without running the daemon")
+	var adminSocket string
+	flag.StringVar(&adminSocket, "admin-socket", "/var/run/ib-kubernetes/admin.sock",
+		"Admin socket of the running daemon used by the subcommands")
+	flag.Usage = usage
 
 	flag.Parse()
 	if versionOpt {
-		fmt.Printf("%s\n", printVersionString())
+		setupLogging(debug)
+		if err := printVersion(os.Stdout, output); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 {
+		if err := runSubcommand(admin.NewClient(adminSocket), flag.Args(), os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(exitError)
+		}
 		return
 	}
 
 	setupLogging(debug)
 
+	if checkConfig {
+		if err := daemon.CheckConfig(); err != nil {
+			log.Error().Msgf("invalid configuration: %v", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
 	log.Info().Msg("Starting InfiniBand Daemon")
 	ibDaemon, err := daemon.NewDaemon()
 	if err != nil {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm"
+)
+
+const (
+	textOutput = "text"
+	jsonOutput = "json"
+)
+
+// builtinPluginSpecs maps the name of the plugins compiled into the binary to their spec version
+var builtinPluginSpecs = make(map[string]string)
+
+// registerBuiltinPlugin registers a plugin compiled into the binary and records its spec version for the version
+// output
+func registerBuiltinPlugin(name, spec string, initialize sm.PluginInitialize) {
+	sm.RegisterBuiltinPlugin(name, initialize)
+	builtinPluginSpecs[name] = spec
+}
+
+// pluginInfo is a subnet manager plugin the daemon can use
+type pluginInfo struct {
+	Name string `json:"name"`
+	// Builtin is true for plugins compiled into the binary, false for plugin shared objects
+	Builtin bool `json:"builtin"`
+	// Spec is the spec version of built-in plugins, shared objects aren't loaded to report theirs
+	Spec string `json:"spec,omitempty"`
+	// Path is the file of plugin shared objects
+	Path string `json:"path,omitempty"`
+}
+
+// versionInfo is the version and build information of the daemon binary
+type versionInfo struct {
+	Version   string       `json:"version"`
+	Commit    string       `json:"commit"`
+	Date      string       `json:"date"`
+	GoVersion string       `json:"goVersion"`
+	Platform  string       `json:"platform"`
+	Plugins   []pluginInfo `json:"plugins"`
+}
+
+func printVersionString() string {
+	return fmt.Sprintf("ib-kubernetes version:%s, commit:%s, date:%s", version, commit, date)
+}
+
+// printVersion writes the version of the daemon in the given output format, the json output includes the build
+// information and the built-in and shared object plugins of DAEMON_SM_PLUGIN_PATH
+func printVersion(out io.Writer, format string) error {
+	switch format {
+	case textOutput:
+		_, err := fmt.Fprintln(out, printVersionString())
+		return err
+	case jsonOutput:
+		info := versionInfo{Version: version, Commit: commit, Date: date, GoVersion: runtime.Version(),
+			Platform: runtime.GOOS + "/" + runtime.GOARCH, Plugins: availablePlugins()}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(&info)
+	default:
+		return fmt.Errorf("unknown version output format %q, supported formats [%q, %q]", format, textOutput,
+			jsonOutput)
+	}
+}
+
+// availablePlugins returns the built-in plugins and the plugin shared objects found in DAEMON_SM_PLUGIN_PATH,
+// sorted by name
+func availablePlugins() []pluginInfo {
+	plugins := []pluginInfo{}
+	for _, name := range sm.BuiltinPlugins() {
+		plugins = append(plugins, pluginInfo{Name: name, Builtin: true, Spec: builtinPluginSpecs[name]})
+	}
+
+	daemonConfig := config.DaemonConfig{}
+	if err := daemonConfig.ReadConfig(); err == nil {
+		// an unreadable plugin path only has no plugin shared objects
+		files, _ := filepath.Glob(filepath.Join(daemonConfig.PluginPath, "*.so"))
+		for _, file := range files {
+			plugins = append(plugins, pluginInfo{Name: strings.TrimSuffix(filepath.Base(file), ".so"), Path: file})
+		}
+	}
+	sort.SliceStable(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
@@ -0,0 +1,15 @@
+// Package main builds the noop subnet manager plugin, loaded by the daemon from noop.so
+package main
+
+import (
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/noop"
+)
+
+// InvalidPlugin is a symbol which isn't an Initialize function, used by the plugin loader tests
+var InvalidPlugin bool
+
+// Initialize applies configs to plugin and return a subnet manager client
+func Initialize() (plugins.SubnetManagerClient, error) {
+	return noop.Initialize()
+}
@@ -0,0 +1,12 @@
+// Package main builds the remote subnet manager plugin, loaded by the daemon from remote.so
+package main
+
+import (
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/remote"
+)
+
+// Initialize applies configs to plugin and return a subnet manager client
+func Initialize() (plugins.SubnetManagerClient, error) {
+	return remote.Initialize()
+}
@@ -0,0 +1,12 @@
+// Package main builds the rest subnet manager plugin, loaded by the daemon from rest.so
+package main
+
+import (
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/rest"
+)
+
+// Initialize applies configs to plugin and return a subnet manager client
+func Initialize() (plugins.SubnetManagerClient, error) {
+	return rest.Initialize()
+}
@@ -0,0 +1,78 @@
+// Package main builds the subnet manager agent, serving a subnet manager plugin over gRPC on hosts which can
+// reach the subnet manager, for daemons using the remote subnet manager plugin
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/agent"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/noop"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/rest"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/ufm"
+)
+
+const exitError = 1
+
+var (
+	version = "master@git"
+	commit  = "unknown commit"
+	date    = "unknown date"
+)
+
+// The agent serves the in-tree plugins compiled into it, it doesn't load plugin shared objects
+func init() {
+	sm.RegisterBuiltinPlugin("noop", noop.Initialize)
+	sm.RegisterBuiltinPlugin("rest", rest.Initialize)
+	sm.RegisterBuiltinPlugin("ufm", ufm.Initialize)
+}
+
+func setupLogging(debug bool) {
+	if debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	} else {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	}
+	log.Logger = log.Output(zerolog.ConsoleWriter{
+		Out:        os.Stderr,
+		TimeFormat: zerolog.TimeFieldFormat,
+		NoColor:    true,
+	})
+}
+
+func main() {
+	var debug bool
+	var versionOpt bool
+	flag.BoolVar(&versionOpt, "version", false, "Show application version")
+	flag.BoolVar(&versionOpt, "v", false, "Show application version")
+	flag.BoolVar(&debug, "debug", false, "Debug level logging")
+	flag.Parse()
+	if versionOpt {
+		fmt.Printf("sm-agent version:%s, commit:%s, date:%s\n", version, commit, date)
+		return
+	}
+
+	setupLogging(debug)
+
+	conf := &agent.Config{}
+	if err := conf.ReadConfig(); err != nil {
+		log.Error().Msgf("failed to read configuration: %v", err)
+		os.Exit(exitError)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := agent.Run(ctx, conf); err != nil {
+		log.Error().Msgf("subnet manager agent failed: %v", err)
+		stop()
+		os.Exit(exitError)
+	}
+}
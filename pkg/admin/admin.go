@@ -0,0 +1,265 @@
+// Package admin implements the local administration API of ib-kubernetes daemon, served as HTTP over a
+// unix socket and used by the ib-kubernetes CLI subcommands
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+)
+
+const (
+	guidsPath        = "/guids"
+	syncPath         = "/sync"
+	snapshotPath     = "/snapshot"
+	pluginReloadPath = "/plugin/reload"
+	networksPath     = "/networks"
+	podsPath         = "/pods"
+	drainSuffix      = "/drain"
+	// maxPluginReloadSize limits the size of plugin reload requests
+	maxPluginReloadSize = 4 << 10
+	// maxSnapshotSize limits the size of imported snapshots
+	maxSnapshotSize = 64 << 20
+	// readHeaderTimeout limits the time to read admin requests headers
+	readHeaderTimeout = 10 * time.Second
+	socketDirMode     = 0o750
+)
+
+// ErrGUIDNotFound is returned by Handler.ReleaseGUID when the guid isn't allocated
+var ErrGUIDNotFound = errors.New("guid is not allocated")
+
+// ErrPodNotFound is returned by Handler.ReleasePod when the pod doesn't exist
+var ErrPodNotFound = errors.New("pod not found")
+
+// GUIDAllocation describes a GUID allocated by the daemon and the pod network interface it is allocated for
+type GUIDAllocation struct {
+	GUID      string `json:"guid"`
+	PodUID    string `json:"podUID"`
+	NetworkID string `json:"networkID"`
+	Interface string `json:"interface,omitempty"`
+}
+
+// PluginReload is the request to reload the subnet manager plugin, empty fields keep the current plugin
+// name and path
+type PluginReload struct {
+	Plugin     string `json:"plugin,omitempty"`
+	PluginPath string `json:"pluginPath,omitempty"`
+}
+
+// NetworkDrain is the result of draining a network, the GUIDs removed from the network pkey and released
+type NetworkDrain struct {
+	NetworkID string   `json:"networkID"`
+	PKey      string   `json:"pkey,omitempty"`
+	GUIDs     []string `json:"guids"`
+}
+
+// PodRelease is the result of force releasing a pod, the GUIDs of its networks removed from their pkeys and
+// released
+type PodRelease struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	PodUID    string   `json:"podUID"`
+	GUIDs     []string `json:"guids"`
+}
+
+// Handler performs the admin operations on the daemon state
+type Handler interface {
+	// ListGUIDs returns all GUIDs allocated by the daemon
+	ListGUIDs() []GUIDAllocation
+	// ReleaseGUID removes the guid from its pkey in the subnet manager and releases it from the pool
+	ReleaseGUID(guid string) error
+	// ReleasePod removes the guids allocated for the pod networks from their pkeys in the subnet manager and
+	// releases them from the pool, even if the pod still exists
+	ReleasePod(namespace, name string) (*PodRelease, error)
+	// Sync resyncs the GUID pool with the subnet manager
+	Sync() error
+	// ExportGUIDs returns snapshot of the GUIDs allocated by the daemon
+	ExportGUIDs() (*guid.Snapshot, error)
+	// ImportGUIDs restores the allocations of the snapshot and their pkeys membership in the subnet manager
+	ImportGUIDs(snapshot *guid.Snapshot) error
+	// ReloadPlugin loads the subnet manager plugin, validates it and replaces the plugin used by the daemon
+	ReloadPlugin(reload PluginReload) error
+	// DrainNetwork removes the GUIDs allocated for the network from its pkey, releases them from the pool and
+	// marks the network as not managed
+	DrainNetwork(networkID string) (*NetworkDrain, error)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server serves the admin API over a unix socket
+type Server struct {
+	socketPath string
+	handler    Handler
+	server     *http.Server
+}
+
+// NewServer creates admin server listening on the given unix socket path
+func NewServer(socketPath string, handler Handler) *Server {
+	s := &Server{socketPath: socketPath, handler: handler}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+guidsPath, s.listGUIDs)
+	mux.HandleFunc("DELETE "+guidsPath+"/{guid}", s.releaseGUID)
+	mux.HandleFunc("DELETE "+podsPath+"/{namespace}/{name}", s.releasePod)
+	mux.HandleFunc("POST "+syncPath, s.sync)
+	mux.HandleFunc("GET "+snapshotPath, s.exportGUIDs)
+	mux.HandleFunc("POST "+snapshotPath, s.importGUIDs)
+	mux.HandleFunc("POST "+pluginReloadPath, s.reloadPlugin)
+	mux.HandleFunc("POST "+networksPath+"/{network}"+drainSuffix, s.drainNetwork)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
+	return s
+}
+
+// Serve listens on the unix socket and serves admin requests, it blocks until the server is stopped
+func (s *Server) Serve() error {
+	if err := os.MkdirAll(filepath.Dir(s.socketPath), socketDirMode); err != nil {
+		return fmt.Errorf("failed to create admin socket directory: %v", err)
+	}
+	// Remove socket left by previous run
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale admin socket %s: %v", s.socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin socket %s: %v", s.socketPath, err)
+	}
+
+	log.Info().Msgf("serving admin api on %s", s.socketPath)
+	if err = s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop closes the server and removes its socket
+func (s *Server) Stop() {
+	if err := s.server.Close(); err != nil {
+		log.Warn().Msgf("failed to close admin server: %v", err)
+	}
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		log.Warn().Msgf("failed to remove admin socket %s: %v", s.socketPath, err)
+	}
+}
+
+func (s *Server) listGUIDs(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.handler.ListGUIDs())
+}
+
+func (s *Server) releaseGUID(w http.ResponseWriter, r *http.Request) {
+	guid := r.PathValue("guid")
+	log.Info().Msgf("admin request to release guid %s", guid)
+	if err := s.handler.ReleaseGUID(guid); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrGUIDNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, errorResponse{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) releasePod(w http.ResponseWriter, r *http.Request) {
+	namespace, name := r.PathValue("namespace"), r.PathValue("name")
+	log.Info().Msgf("admin request to release pod namespace %s name %s", namespace, name)
+	release, err := s.handler.ReleasePod(namespace, name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrPodNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, release)
+}
+
+func (s *Server) sync(w http.ResponseWriter, _ *http.Request) {
+	log.Info().Msg("admin request to sync guid pool")
+	if err := s.handler.Sync(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) exportGUIDs(w http.ResponseWriter, _ *http.Request) {
+	log.Info().Msg("admin request to export guid pool snapshot")
+	snapshot, err := s.handler.ExportGUIDs()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (s *Server) importGUIDs(w http.ResponseWriter, r *http.Request) {
+	log.Info().Msg("admin request to import guid pool snapshot")
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSnapshotSize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("failed to read snapshot: %v", err)})
+		return
+	}
+	snapshot, err := guid.ParseSnapshot(data)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	if err = s.handler.ImportGUIDs(snapshot); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) reloadPlugin(w http.ResponseWriter, r *http.Request) {
+	reload := PluginReload{}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPluginReloadSize))
+	if err == nil && len(data) != 0 {
+		err = json.Unmarshal(data, &reload)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid plugin reload request: %v", err)})
+		return
+	}
+
+	log.Info().Msgf("admin request to reload subnet manager plugin %+v", reload)
+	if err = s.handler.ReloadPlugin(reload); err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) drainNetwork(w http.ResponseWriter, r *http.Request) {
+	networkID := r.PathValue("network")
+	log.Info().Msgf("admin request to drain network %s", networkID)
+	drain, err := s.handler.DrainNetwork(networkID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, drain)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Warn().Msgf("failed to write admin response: %v", err)
+	}
+}
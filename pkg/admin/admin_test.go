@@ -0,0 +1,211 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+)
+
+type fakeHandler struct {
+	allocations []GUIDAllocation
+	released    []string
+	podReleases []string
+	synced      int
+	syncErr     error
+	imported    *guid.Snapshot
+	reloaded    []PluginReload
+	reloadErr   error
+	drained     []string
+}
+
+func (f *fakeHandler) ListGUIDs() []GUIDAllocation {
+	return f.allocations
+}
+
+func (f *fakeHandler) ReleaseGUID(guid string) error {
+	for index := range f.allocations {
+		if f.allocations[index].GUID == guid {
+			f.released = append(f.released, guid)
+			return nil
+		}
+	}
+	return fmt.Errorf("guid %s: %w", guid, ErrGUIDNotFound)
+}
+
+func (f *fakeHandler) ReleasePod(namespace, name string) (*PodRelease, error) {
+	if name != "pod" {
+		return nil, fmt.Errorf("pod %s/%s: %w", namespace, name, ErrPodNotFound)
+	}
+	f.podReleases = append(f.podReleases, namespace+"/"+name)
+	release := &PodRelease{Namespace: namespace, Name: name, PodUID: "uid-1", GUIDs: []string{}}
+	for _, allocation := range f.allocations {
+		if allocation.PodUID == "uid-1" {
+			release.GUIDs = append(release.GUIDs, allocation.GUID)
+		}
+	}
+	return release, nil
+}
+
+func (f *fakeHandler) Sync() error {
+	f.synced++
+	return f.syncErr
+}
+
+func (f *fakeHandler) ExportGUIDs() (*guid.Snapshot, error) {
+	allocations := make([]guid.SnapshotAllocation, 0, len(f.allocations))
+	for _, allocation := range f.allocations {
+		allocations = append(allocations, guid.SnapshotAllocation{GUID: allocation.GUID, PKey: "0x5",
+			OwnerID: allocation.PodUID, NetworkID: allocation.NetworkID, Interface: allocation.Interface})
+	}
+	return guid.NewSnapshot(allocations), nil
+}
+
+func (f *fakeHandler) ImportGUIDs(snapshot *guid.Snapshot) error {
+	f.imported = snapshot
+	return nil
+}
+
+func (f *fakeHandler) ReloadPlugin(reload PluginReload) error {
+	f.reloaded = append(f.reloaded, reload)
+	return f.reloadErr
+}
+
+func (f *fakeHandler) DrainNetwork(networkID string) (*NetworkDrain, error) {
+	drain := &NetworkDrain{NetworkID: networkID, PKey: "0x5", GUIDs: []string{}}
+	for _, allocation := range f.allocations {
+		if allocation.NetworkID == networkID {
+			drain.GUIDs = append(drain.GUIDs, allocation.GUID)
+		}
+	}
+	if len(drain.GUIDs) == 0 {
+		return nil, fmt.Errorf("failed to drain network %s", networkID)
+	}
+	f.drained = append(f.drained, networkID)
+	return drain, nil
+}
+
+var _ = Describe("Admin API", func() {
+	var (
+		handler *fakeHandler
+		server  *Server
+		client  *Client
+	)
+
+	BeforeEach(func() {
+		handler = &fakeHandler{allocations: []GUIDAllocation{
+			{GUID: "02:00:00:00:00:00:00:01", PodUID: "uid-1", NetworkID: "default_ib-net", Interface: "net1"}}}
+
+		// unix socket paths are limited in length, so avoid the long ginkgo temp dirs
+		dir, err := os.MkdirTemp("", "ib-k8s-admin")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		socketPath := filepath.Join(dir, "admin.sock")
+
+		server = NewServer(socketPath, handler)
+		go func() {
+			defer GinkgoRecover()
+			Expect(server.Serve()).To(Succeed())
+		}()
+		Eventually(func() error {
+			_, err := os.Stat(socketPath)
+			return err
+		}).Should(Succeed())
+		DeferCleanup(server.Stop)
+
+		client = NewClient(socketPath)
+	})
+
+	It("List allocated guids", func() {
+		allocations, err := client.ListGUIDs()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(allocations).To(Equal(handler.allocations))
+	})
+
+	It("Release allocated guid", func() {
+		Expect(client.ReleaseGUID("02:00:00:00:00:00:00:01")).To(Succeed())
+		Expect(handler.released).To(Equal([]string{"02:00:00:00:00:00:00:01"}))
+	})
+
+	It("Fail to release not allocated guid", func() {
+		err := client.ReleaseGUID("02:00:00:00:00:00:00:02")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("status code 404"))
+		Expect(err.Error()).To(ContainSubstring("guid is not allocated"))
+	})
+
+	It("Release pod guids", func() {
+		release, err := client.ReleasePod("default", "pod")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(release).To(Equal(&PodRelease{Namespace: "default", Name: "pod", PodUID: "uid-1",
+			GUIDs: []string{"02:00:00:00:00:00:00:01"}}))
+		Expect(handler.podReleases).To(Equal([]string{"default/pod"}))
+	})
+
+	It("Fail to release not existing pod", func() {
+		_, err := client.ReleasePod("default", "other-pod")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("status code 404"))
+	})
+
+	It("Sync guid pool", func() {
+		Expect(client.Sync()).To(Succeed())
+		Expect(handler.synced).To(Equal(1))
+
+		handler.syncErr = errors.New("subnet manager unreachable")
+		err := client.Sync()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("subnet manager unreachable"))
+	})
+
+	It("Export and import guid pool snapshot", func() {
+		snapshot, err := client.ExportGUIDs()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(snapshot.Allocations).To(Equal([]guid.SnapshotAllocation{{GUID: "02:00:00:00:00:00:00:01",
+			PKey: "0x5", OwnerID: "uid-1", NetworkID: "default_ib-net", Interface: "net1"}}))
+
+		Expect(client.ImportGUIDs(snapshot)).To(Succeed())
+		Expect(handler.imported.Allocations).To(Equal(snapshot.Allocations))
+	})
+
+	It("Fail to import invalid snapshot", func() {
+		err := client.ImportGUIDs(&guid.Snapshot{Version: 0})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("status code 400"))
+		Expect(handler.imported).To(BeNil())
+	})
+
+	It("Reload subnet manager plugin", func() {
+		Expect(client.ReloadPlugin(PluginReload{})).To(Succeed())
+		Expect(client.ReloadPlugin(PluginReload{Plugin: "ufm", PluginPath: "/plugins/v2"})).To(Succeed())
+		Expect(handler.reloaded).To(Equal([]PluginReload{{}, {Plugin: "ufm", PluginPath: "/plugins/v2"}}))
+
+		handler.reloadErr = errors.New("failed to validate plugin")
+		err := client.ReloadPlugin(PluginReload{Plugin: "ufm"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to validate plugin"))
+	})
+
+	It("Drain network", func() {
+		drain, err := client.DrainNetwork("default_ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(drain).To(Equal(&NetworkDrain{NetworkID: "default_ib-net", PKey: "0x5",
+			GUIDs: []string{"02:00:00:00:00:00:00:01"}}))
+		Expect(handler.drained).To(Equal([]string{"default_ib-net"}))
+
+		_, err = client.DrainNetwork("default_other-net")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to drain network default_other-net"))
+	})
+
+	It("Fail when daemon is not running", func() {
+		_, err := NewClient("/nonexistent/admin.sock").ListGUIDs()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to connect to ib-kubernetes daemon"))
+	})
+})
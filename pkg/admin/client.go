@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+)
+
+// clientTimeout limits admin requests, releasing a guid may retry subnet manager requests in backoff
+const clientTimeout = 5 * time.Minute
+
+// Client sends requests to the admin API of a running daemon
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates admin client connecting to the daemon over the given unix socket path
+func NewClient(socketPath string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return &Client{httpClient: &http.Client{Transport: transport, Timeout: clientTimeout}}
+}
+
+// ListGUIDs returns all GUIDs allocated by the daemon
+func (c *Client) ListGUIDs() ([]GUIDAllocation, error) {
+	body, err := c.do(http.MethodGet, guidsPath, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	var allocations []GUIDAllocation
+	if err = json.Unmarshal(body, &allocations); err != nil {
+		return nil, fmt.Errorf("failed to parse guids list: %v", err)
+	}
+	return allocations, nil
+}
+
+// ReleaseGUID force releases the guid, removing it from its pkey
+func (c *Client) ReleaseGUID(guid string) error {
+	_, err := c.do(http.MethodDelete, guidsPath+"/"+url.PathEscape(guid), nil, http.StatusNoContent)
+	return err
+}
+
+// ReleasePod force releases the guids of the pod networks, removing them from their pkeys
+func (c *Client) ReleasePod(namespace, name string) (*PodRelease, error) {
+	body, err := c.do(http.MethodDelete, podsPath+"/"+url.PathEscape(namespace)+"/"+url.PathEscape(name), nil,
+		http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	release := &PodRelease{}
+	if err = json.Unmarshal(body, release); err != nil {
+		return nil, fmt.Errorf("failed to parse pod release result: %v", err)
+	}
+	return release, nil
+}
+
+// Sync triggers full resync of the daemon GUID pool with the subnet manager
+func (c *Client) Sync() error {
+	_, err := c.do(http.MethodPost, syncPath, nil, http.StatusNoContent)
+	return err
+}
+
+// ExportGUIDs returns snapshot of the GUIDs allocated by the daemon
+func (c *Client) ExportGUIDs() (*guid.Snapshot, error) {
+	body, err := c.do(http.MethodGet, snapshotPath, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return guid.ParseSnapshot(body)
+}
+
+// ImportGUIDs restores the allocations of the snapshot in the daemon
+func (c *Client) ImportGUIDs(snapshot *guid.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+	_, err = c.do(http.MethodPost, snapshotPath, data, http.StatusNoContent)
+	return err
+}
+
+// ReloadPlugin reloads the subnet manager plugin of the daemon, empty fields keep the current plugin name and path
+func (c *Client) ReloadPlugin(reload PluginReload) error {
+	data, err := json.Marshal(reload)
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin reload request: %v", err)
+	}
+	_, err = c.do(http.MethodPost, pluginReloadPath, data, http.StatusNoContent)
+	return err
+}
+
+// DrainNetwork removes the GUIDs of the network from its pkey, releases them and marks the network as not managed
+func (c *Client) DrainNetwork(networkID string) (*NetworkDrain, error) {
+	body, err := c.do(http.MethodPost, networksPath+"/"+url.PathEscape(networkID)+drainSuffix, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	drain := &NetworkDrain{}
+	if err = json.Unmarshal(body, drain); err != nil {
+		return nil, fmt.Errorf("failed to parse network drain result: %v", err)
+	}
+	return drain, nil
+}
+
+func (c *Client) do(method, path string, data []byte, expectedStatus int) ([]byte, error) {
+	var reqBody io.Reader = http.NoBody
+	if data != nil {
+		reqBody = bytes.NewReader(data)
+	}
+	// The host is ignored as the transport always dials the unix socket
+	req, err := http.NewRequestWithContext(context.Background(), method, "http://ib-kubernetes"+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ib-kubernetes daemon: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != expectedStatus {
+		errResp := errorResponse{}
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, errResp.Error)
+		}
+		return nil, fmt.Errorf("request failed with status code %d", resp.StatusCode)
+	}
+	return body, nil
+}
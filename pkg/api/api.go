@@ -0,0 +1,129 @@
+// Package api implements the read-only REST API of ib-kubernetes daemon, exposing the GUID allocations and
+// pool usage to dashboards and external tooling. Requests are authenticated with service account tokens
+// reviewed by the kubernetes API server, and only the allowed service accounts are authorized.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+)
+
+const (
+	allocationsPath  = "/allocations"
+	networkGUIDsPath = "/networks/{id}/guids"
+	poolStatsPath    = "/pool/stats"
+	// readHeaderTimeout limits the time to read api requests headers
+	readHeaderTimeout = 10 * time.Second
+)
+
+// Handler provides the daemon state exposed by the api
+type Handler interface {
+	// ListGUIDs returns all GUIDs allocated by the daemon
+	ListGUIDs() []admin.GUIDAllocation
+	// PoolStats returns the usage of the GUID pool
+	PoolStats() guid.PoolStats
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server serves the read-only api over HTTP, or HTTPS if a certificate is configured
+type Server struct {
+	handler       Handler
+	authenticator Authenticator
+	server        *http.Server
+	certFile      string
+	keyFile       string
+}
+
+// NewServer creates api server listening on the given address, certFile and keyFile are optional
+func NewServer(addr, certFile, keyFile string, handler Handler, authenticator Authenticator) *Server {
+	s := &Server{handler: handler, authenticator: authenticator, certFile: certFile, keyFile: keyFile}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+allocationsPath, s.listAllocations)
+	mux.HandleFunc("GET "+networkGUIDsPath, s.listNetworkGUIDs)
+	mux.HandleFunc("GET "+poolStatsPath, s.poolStats)
+	s.server = &http.Server{Addr: addr, Handler: s.authenticate(mux), ReadHeaderTimeout: readHeaderTimeout}
+	return s
+}
+
+// Serve listens on the server address and serves api requests, it blocks until the server is stopped
+func (s *Server) Serve() error {
+	var err error
+	if s.certFile != "" {
+		log.Info().Msgf("serving api on https://%s", s.server.Addr)
+		err = s.server.ListenAndServeTLS(s.certFile, s.keyFile)
+	} else {
+		log.Info().Msgf("serving api on http://%s", s.server.Addr)
+		err = s.server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop closes the server
+func (s *Server) Stop() {
+	if err := s.server.Close(); err != nil {
+		log.Warn().Msgf("failed to close api server: %v", err)
+	}
+}
+
+// authenticate rejects requests without a valid bearer token of an allowed service account
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := s.authenticator.Authenticate(r)
+		if err != nil {
+			log.Debug().Msgf("rejected api request %s %s: %v", r.Method, r.URL.Path, err)
+			status := http.StatusUnauthorized
+			switch {
+			case errors.Is(err, ErrForbidden):
+				status = http.StatusForbidden
+			case errors.Is(err, ErrTooManyReviews):
+				status = http.StatusTooManyRequests
+			}
+			writeJSON(w, status, errorResponse{Error: err.Error()})
+			return
+		}
+
+		log.Debug().Msgf("api request %s %s by %s", r.Method, r.URL.Path, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listAllocations(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.handler.ListGUIDs())
+}
+
+func (s *Server) listNetworkGUIDs(w http.ResponseWriter, r *http.Request) {
+	networkID := r.PathValue("id")
+	allocations := make([]admin.GUIDAllocation, 0)
+	for _, allocation := range s.handler.ListGUIDs() {
+		if allocation.NetworkID == networkID {
+			allocations = append(allocations, allocation)
+		}
+	}
+	writeJSON(w, http.StatusOK, allocations)
+}
+
+func (s *Server) poolStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.handler.PoolStats())
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Warn().Msgf("failed to write api response: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+)
+
+type fakeHandler struct {
+	allocations []admin.GUIDAllocation
+	stats       guid.PoolStats
+}
+
+func (f *fakeHandler) ListGUIDs() []admin.GUIDAllocation {
+	return f.allocations
+}
+
+func (f *fakeHandler) PoolStats() guid.PoolStats {
+	return f.stats
+}
+
+// fakeAuthenticator accepts requests with the "valid" bearer token and forbids the "forbidden" one
+type fakeAuthenticator struct{}
+
+func (fakeAuthenticator) Authenticate(r *http.Request) (string, error) {
+	switch r.Header.Get("Authorization") {
+	case "Bearer valid":
+		return "system:serviceaccount:monitoring:dashboard", nil
+	case "Bearer forbidden":
+		return "", ErrForbidden
+	}
+	return "", errors.New("invalid token")
+}
+
+var _ = Describe("Read-only API", func() {
+	var server *Server
+
+	BeforeEach(func() {
+		handler := &fakeHandler{
+			allocations: []admin.GUIDAllocation{
+				{GUID: "02:00:00:00:00:00:00:01", PodUID: "uid-1", NetworkID: "default_ib-net", Interface: "net1"},
+				{GUID: "02:00:00:00:00:00:00:02", PodUID: "uid-2", NetworkID: "foo_ib-net"}},
+			stats: guid.PoolStats{RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:ff",
+				Size: 256, Allocated: 2, Free: 254, FreeSegments: 2, LongestFreeRun: 253},
+		}
+		server = NewServer(":0", "", "", handler, fakeAuthenticator{})
+	})
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, http.NoBody)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	It("List allocations", func() {
+		response := get("/allocations", "valid")
+		Expect(response.Code).To(Equal(http.StatusOK))
+
+		var allocations []admin.GUIDAllocation
+		Expect(json.Unmarshal(response.Body.Bytes(), &allocations)).To(Succeed())
+		Expect(allocations).To(HaveLen(2))
+	})
+	It("List guids of network", func() {
+		response := get("/networks/foo_ib-net/guids", "valid")
+		Expect(response.Code).To(Equal(http.StatusOK))
+
+		var allocations []admin.GUIDAllocation
+		Expect(json.Unmarshal(response.Body.Bytes(), &allocations)).To(Succeed())
+		Expect(allocations).To(Equal([]admin.GUIDAllocation{
+			{GUID: "02:00:00:00:00:00:00:02", PodUID: "uid-2", NetworkID: "foo_ib-net"}}))
+
+		response = get("/networks/bar_ib-net/guids", "valid")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(MatchJSON(`[]`))
+	})
+	It("Get pool stats", func() {
+		response := get("/pool/stats", "valid")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(MatchJSON(`{"rangeStart": "02:00:00:00:00:00:00:00", ` +
+			`"rangeEnd": "02:00:00:00:00:00:00:ff", "size": 256, "allocated": 2, "free": 254, ` +
+			`"freeSegments": 2, "longestFreeRun": 253}`))
+	})
+	It("Reject unauthenticated requests", func() {
+		Expect(get("/allocations", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(get("/pool/stats", "invalid").Code).To(Equal(http.StatusUnauthorized))
+	})
+	It("Reject requests of service accounts which aren't allowed", func() {
+		Expect(get("/allocations", "forbidden").Code).To(Equal(http.StatusForbidden))
+	})
+	It("Reject write requests", func() {
+		request := httptest.NewRequest(http.MethodDelete, "/allocations", http.NoBody)
+		request.Header.Set("Authorization", "Bearer valid")
+		recorder := httptest.NewRecorder()
+		server.server.Handler.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	// serviceAccountUserPrefix is the prefix of the user names of service accounts
+	serviceAccountUserPrefix = "system:serviceaccount:"
+	// tokenCacheTTL is the time a reviewed token is trusted before it is reviewed again
+	tokenCacheTTL = time.Minute
+	// rejectedTokenCacheTTL is the time a rejected token is rejected without being reviewed again
+	rejectedTokenCacheTTL = 10 * time.Second
+	// maxCachedTokens bounds the number of cached reviews, reviews aren't cached once it's reached
+	maxCachedTokens = 1024
+	// reviewsQPS and reviewsBurst limit the rate of token reviews sent to the kubernetes api server
+	reviewsQPS   = 5
+	reviewsBurst = 10
+)
+
+var (
+	errMissingToken     = errors.New("missing bearer token")
+	errNotAuthenticated = errors.New("token is not authenticated")
+	// ErrForbidden is returned when the authenticated service account isn't allowed to use the api
+	ErrForbidden = errors.New("service account is not allowed to use the api")
+	// ErrTooManyReviews is returned when the token can't be reviewed as the token reviews rate limit is reached
+	ErrTooManyReviews = errors.New("too many token reviews")
+)
+
+// Authenticator authenticates and authorizes api requests
+type Authenticator interface {
+	// Authenticate returns the user of the request, or error if the request isn't authenticated. It returns
+	// ErrForbidden if the user isn't allowed to use the api.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// TokenReviewer reviews bearer tokens with the kubernetes API server
+type TokenReviewer interface {
+	CreateTokenReview(token string, audiences []string) (*authenticationv1.TokenReview, error)
+}
+
+type cachedReview struct {
+	user    string
+	err     error
+	expires time.Time
+}
+
+type tokenReviewAuthenticator struct {
+	reviewer  TokenReviewer
+	audiences []string
+	// allowed are the user names of the service accounts allowed to use the api
+	allowed map[string]bool
+	limiter flowcontrol.RateLimiter
+	// cache maps the sha256 of reviewed tokens to their service account user or rejection
+	cache      map[[sha256.Size]byte]cachedReview
+	cacheMutex sync.Mutex
+	now        func() time.Time
+}
+
+// NewTokenReviewAuthenticator returns authenticator accepting requests with a bearer token of one of the allowed
+// service accounts, given as "<namespace>/<name>", issued for one of the audiences. Reviewed tokens are cached for
+// a minute and rejected tokens for 10 seconds to avoid reviewing every request, and the reviews are rate limited.
+func NewTokenReviewAuthenticator(reviewer TokenReviewer, audiences, serviceAccounts []string) Authenticator {
+	allowed := make(map[string]bool, len(serviceAccounts))
+	for _, serviceAccount := range serviceAccounts {
+		allowed[serviceAccountUserPrefix+strings.Replace(serviceAccount, "/", ":", 1)] = true
+	}
+	return &tokenReviewAuthenticator{
+		reviewer:  reviewer,
+		audiences: audiences,
+		allowed:   allowed,
+		limiter:   flowcontrol.NewTokenBucketRateLimiter(reviewsQPS, reviewsBurst),
+		cache:     make(map[[sha256.Size]byte]cachedReview),
+		now:       time.Now,
+	}
+}
+
+func (a *tokenReviewAuthenticator) Authenticate(r *http.Request) (string, error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || strings.TrimSpace(token) == "" {
+		return "", errMissingToken
+	}
+
+	key := sha256.Sum256([]byte(token))
+	now := a.now()
+	a.cacheMutex.Lock()
+	cached, exist := a.cache[key]
+	a.cacheMutex.Unlock()
+	if exist && now.Before(cached.expires) {
+		return cached.user, cached.err
+	}
+
+	if !a.limiter.TryAccept() {
+		return "", ErrTooManyReviews
+	}
+	review, err := a.reviewer.CreateTokenReview(token, a.audiences)
+	if err != nil {
+		// failed reviews aren't cached, the token is reviewed again by the next request
+		return "", fmt.Errorf("failed to review token: %v", err)
+	}
+
+	user, err := a.reviewedUser(review)
+	ttl := tokenCacheTTL
+	if err != nil {
+		user, ttl = "", rejectedTokenCacheTTL
+	}
+	a.cacheReview(key, cachedReview{user: user, err: err, expires: now.Add(ttl)}, now)
+	return user, err
+}
+
+// reviewedUser returns the service account user of the token review, or error if the token isn't authenticated
+// for the audiences or its user isn't allowed
+func (a *tokenReviewAuthenticator) reviewedUser(review *authenticationv1.TokenReview) (string, error) {
+	if !review.Status.Authenticated {
+		return "", errNotAuthenticated
+	}
+	if !a.audienceMatch(review.Status.Audiences) {
+		return "", fmt.Errorf("%w: token isn't issued for audiences %v", errNotAuthenticated, a.audiences)
+	}
+	user := review.Status.User.Username
+	if !strings.HasPrefix(user, serviceAccountUserPrefix) {
+		return "", fmt.Errorf("user %s is not a service account", user)
+	}
+	if !a.allowed[user] {
+		return "", fmt.Errorf("%w: %s", ErrForbidden, user)
+	}
+	return user, nil
+}
+
+// audienceMatch returns true if the token is authenticated for one of the api audiences
+func (a *tokenReviewAuthenticator) audienceMatch(audiences []string) bool {
+	for _, audience := range audiences {
+		for _, expected := range a.audiences {
+			if audience == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cacheReview caches the review of the token, dropping the expired reviews. The review isn't cached if the cache
+// is full.
+func (a *tokenReviewAuthenticator) cacheReview(key [sha256.Size]byte, review cachedReview, now time.Time) {
+	a.cacheMutex.Lock()
+	defer a.cacheMutex.Unlock()
+	for cachedKey, entry := range a.cache {
+		if !now.Before(entry.expires) {
+			delete(a.cache, cachedKey)
+		}
+	}
+	if len(a.cache) < maxCachedTokens {
+		a.cache[key] = review
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// fakeTokenReviewer authenticates tokens mapped to users for the requested audiences, except the "other-audience"
+// token, and counts the reviews
+type fakeTokenReviewer struct {
+	users   map[string]string
+	reviews int
+	err     error
+}
+
+func (f *fakeTokenReviewer) CreateTokenReview(token string, audiences []string) (*authenticationv1.TokenReview,
+	error) {
+	f.reviews++
+	if f.err != nil {
+		return nil, f.err
+	}
+	user, exist := f.users[token]
+	if token == "other-audience" {
+		audiences = []string{"https://kubernetes.default.svc"}
+	}
+	return &authenticationv1.TokenReview{Status: authenticationv1.TokenReviewStatus{
+		Authenticated: exist, User: authenticationv1.UserInfo{Username: user}, Audiences: audiences}}, nil
+}
+
+var _ = Describe("Token Review Authenticator", func() {
+	var (
+		reviewer      *fakeTokenReviewer
+		authenticator *tokenReviewAuthenticator
+		now           time.Time
+	)
+
+	newRequest := func(token string) *http.Request {
+		request := httptest.NewRequest(http.MethodGet, "/allocations", http.NoBody)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		return request
+	}
+
+	BeforeEach(func() {
+		reviewer = &fakeTokenReviewer{users: map[string]string{
+			"sa-token":       "system:serviceaccount:monitoring:dashboard",
+			"user-token":     "admin",
+			"other-token":    "system:serviceaccount:default:builder",
+			"other-audience": "system:serviceaccount:monitoring:dashboard"}}
+		authenticator = NewTokenReviewAuthenticator(reviewer, []string{"ib-kubernetes"},
+			[]string{"monitoring/dashboard"}).(*tokenReviewAuthenticator)
+		now = time.Now()
+		authenticator.now = func() time.Time { return now }
+	})
+
+	It("Authenticate service account token and cache the review", func() {
+		user, err := authenticator.Authenticate(newRequest("sa-token"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(user).To(Equal("system:serviceaccount:monitoring:dashboard"))
+
+		_, err = authenticator.Authenticate(newRequest("sa-token"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reviewer.reviews).To(Equal(1))
+
+		now = now.Add(tokenCacheTTL)
+		_, err = authenticator.Authenticate(newRequest("sa-token"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reviewer.reviews).To(Equal(2))
+	})
+	It("Reject missing and unauthenticated tokens", func() {
+		_, err := authenticator.Authenticate(newRequest(""))
+		Expect(err).To(MatchError(errMissingToken))
+
+		_, err = authenticator.Authenticate(newRequest("unknown"))
+		Expect(err).To(MatchError(errNotAuthenticated))
+	})
+	It("Reject tokens of users which aren't service accounts", func() {
+		_, err := authenticator.Authenticate(newRequest("user-token"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("not a service account"))
+	})
+	It("Forbid service accounts which aren't allowed", func() {
+		_, err := authenticator.Authenticate(newRequest("other-token"))
+		Expect(err).To(MatchError(ErrForbidden))
+	})
+	It("Reject tokens which aren't issued for the api audiences", func() {
+		_, err := authenticator.Authenticate(newRequest("other-audience"))
+		Expect(err).To(MatchError(errNotAuthenticated))
+	})
+	It("Cache rejected tokens", func() {
+		_, err := authenticator.Authenticate(newRequest("unknown"))
+		Expect(err).To(MatchError(errNotAuthenticated))
+		_, err = authenticator.Authenticate(newRequest("unknown"))
+		Expect(err).To(MatchError(errNotAuthenticated))
+		Expect(reviewer.reviews).To(Equal(1))
+
+		now = now.Add(rejectedTokenCacheTTL)
+		_, err = authenticator.Authenticate(newRequest("unknown"))
+		Expect(err).To(MatchError(errNotAuthenticated))
+		Expect(reviewer.reviews).To(Equal(2))
+	})
+	It("Limit the rate of token reviews", func() {
+		for index := 0; index < reviewsBurst; index++ {
+			_, err := authenticator.Authenticate(newRequest(fmt.Sprintf("unknown-%d", index)))
+			Expect(err).To(MatchError(errNotAuthenticated))
+		}
+		_, err := authenticator.Authenticate(newRequest("sa-token"))
+		Expect(err).To(MatchError(ErrTooManyReviews))
+		Expect(reviewer.reviews).To(Equal(reviewsBurst))
+	})
+	It("Reject token when review fails", func() {
+		reviewer.err = errors.New("api server unavailable")
+		_, err := authenticator.Authenticate(newRequest("sa-token"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to review token"))
+	})
+})
@@ -2,19 +2,187 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/rs/zerolog/log"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
 )
 
 type DaemonConfig struct {
-	// Interval between every check for the added and deleted pods
+	// Source the configuration is read from over the environment variables, "env" or "nic-cluster-policy" to read
+	// the guid pool range, periodic update interval and UFM plugin from the NVIDIA network-operator NicClusterPolicy
+	ConfigSource string `env:"DAEMON_CONFIG_SOURCE" envDefault:"env"`
+	// Name of the NicClusterPolicy the configuration is read from
+	NicClusterPolicyName string `env:"DAEMON_NIC_CLUSTER_POLICY_NAME" envDefault:"nic-cluster-policy"`
+	// Interval of the periodic loops, and the least interval held pods are requeued after
 	PeriodicUpdate int `env:"DAEMON_PERIODIC_UPDATE" envDefault:"5"`
-	GUIDPool       GUIDPoolConfig
+	// Random fraction of the interval added to the wait between the runs of the periodic loops, so the loops of
+	// several daemons don't synchronize their subnet manager and kubernetes API bursts, 0 disables the jitter
+	PeriodicUpdateJitter float64 `env:"DAEMON_PERIODIC_UPDATE_JITTER" envDefault:"0"`
+	// Interval and jitter the pods which configuration is held are requeued after, e.g. flapping pods, pods
+	// replacing a deleted pod and pods held while the subnet manager is unavailable
+	AddLoop PeriodicLoopConfig `envPrefix:"DAEMON_PERIODIC_ADD_"`
+	// Interval and jitter the deleted pods which pkey removal is held are requeued after, which can be longer
+	DeleteLoop PeriodicLoopConfig `envPrefix:"DAEMON_PERIODIC_DELETE_"`
+	GUIDPool   GUIDPoolConfig
+	// Range of pkeys allocated to networks configured with "auto" pkey, unset disables pkey allocation
+	PKeyPool PKeyPoolConfig
 	// Subnet manager plugin name
 	Plugin string `env:"DAEMON_SM_PLUGIN"`
 	// Subnet manager plugins path
 	PluginPath string `env:"DAEMON_SM_PLUGIN_PATH" envDefault:"/plugins"`
+	// Start the daemon even if the subnet manager can't be validated on startup, deferring the subnet manager
+	// updates until it is validated again by the periodic updates
+	DegradedStart bool `env:"DAEMON_DEGRADED_START" envDefault:"false"`
+	// Time in seconds to wait before releasing GUIDs of pods bound to deleted nodes, and configuring again the pods
+	// of nodes NotReady for longer once they are Ready, 0 disables node failure detection
+	NodeFailureGracePeriod int `env:"DAEMON_NODE_FAILURE_GRACE_PERIOD" envDefault:"0"`
+	// PKey the pods' GUIDs are added to as limited members in addition to their network pkey, e.g. "0x7FFF",
+	// empty disables it
+	DefaultLimitedPartition string `env:"DEFAULT_LIMITED_PARTITION"`
+	// Add and remove the guids of networks using the default partition 0x7FFF via subnet manager, set to false
+	// if the fabric includes all ports in the default partition
+	ManageDefaultPKey bool `env:"DAEMON_MANAGE_DEFAULT_PKEY" envDefault:"true"`
+	// Minimum time in seconds to keep GUIDs of deleted pods in their pkey, removal is also held until the
+	// pod's deletion grace period ends
+	PKeyRemovalDelay int `env:"DAEMON_PKEY_REMOVAL_DELAY" envDefault:"0"`
+	// Maximum number of guids the daemon adds to a pkey, the pod networks which would exceed it are not configured,
+	// 0 disables the limit
+	PKeyMaxMembers int `env:"DAEMON_PKEY_MAX_MEMBERS" envDefault:"0"`
+	// Adopt on startup the pkey members added manually which guid of the pool range is requested by a pod network
+	// not configured yet, for fabrics migrated from manual management
+	AdoptPKeyMembers bool `env:"DAEMON_ADOPT_PKEY_MEMBERS" envDefault:"false"`
+	// Remove on startup the pkey members of the pool range not allocated to a running pod or reservation, e.g. the
+	// guids of pods deleted while the daemon was down
+	RemoveStalePKeyMembers bool `env:"DAEMON_REMOVE_STALE_PKEY_MEMBERS" envDefault:"false"`
+	// Time in seconds the subnet manager calls of a pod added again while its deletion was pending are held,
+	// until the pod stops flapping, 0 disables the hold
+	PodFlapCooldown int `env:"DAEMON_POD_FLAP_COOLDOWN" envDefault:"0"`
+	// Remove the guids allocated by the daemon from their pkeys on graceful shutdown, for ephemeral clusters
+	// which must leave the shared fabric clean
+	TeardownOnShutdown bool `env:"DAEMON_TEARDOWN_ON_SHUTDOWN" envDefault:"false"`
+	// Assign pods owned by a StatefulSet a stable guid per statefulset replica and network, kept across restarts
+	StatefulSetStableGUIDs bool `env:"DAEMON_STATEFULSET_STABLE_GUIDS" envDefault:"false"`
+	// ConfigMap the stable guids of StatefulSet replicas are tracked in, as "<namespace>/<name>"
+	//nolint:lll
+	StableGUIDsConfigMap string `env:"DAEMON_STABLE_GUIDS_CONFIGMAP" envDefault:"kube-system/ib-kubernetes-stable-guids"`
+	// Namespace network attachment definitions are looked up in when not found in the pod network namespace,
+	// for clusters relying on networks of other namespaces resolving to e.g. "default", empty disables it
+	NADNamespaceFallback string `env:"DAEMON_NAD_NAMESPACE_FALLBACK" envDefault:""`
+	// How GUIDs are delivered to the pods' networks, "cni-args" or "runtime-config". Networks override it with
+	// their "infinibandGUID" capability
+	GUIDInjectionMode string `env:"DAEMON_GUID_INJECTION_MODE" envDefault:"cni-args"`
+	// Method used to write pods' network annotation, "merge-patch" or "server-side-apply"
+	AnnotationWriter string `env:"DAEMON_ANNOTATION_WRITER" envDefault:"merge-patch"`
+	// Periodic updates retrying the failed annotation write of a configured pod, its guids are kept allocated and
+	// in their pkeys meanwhile, 0 releases them on the first failure
+	AnnotationRetries int `env:"DAEMON_ANNOTATION_RETRIES" envDefault:"3"`
+	// Reconcile IBGuidReservation objects, requires the IBGuidReservation CRD to be installed
+	EnableGUIDReservations bool `env:"DAEMON_ENABLE_GUID_RESERVATIONS" envDefault:"false"`
+	// Enforce IBPartitionPolicy objects, pods and guid reservations are added only to pkeys allowed by the
+	// policies of their namespace. Requires the IBPartitionPolicy CRD to be installed
+	EnablePartitionPolicies bool `env:"DAEMON_ENABLE_PARTITION_POLICIES" envDefault:"false"`
+	// Record the reconcile status conditions of each network in its network attachment definition annotation
+	EnableNetworkStatus bool `env:"DAEMON_ENABLE_NETWORK_STATUS" envDefault:"false"`
+	// Record the versioned InfiniBand metadata of the pods' interfaces, e.g. their pkey membership, in the
+	// "ib-kubernetes.nvidia.com/infiniband-metadata" pod annotation for the ib-sriov CNI
+	PodMetadata bool `env:"DAEMON_POD_METADATA" envDefault:"false"`
+	// Name of the InfiniBand fabric of the cluster recorded in the pods' InfiniBand metadata, e.g. "fabric-a"
+	FabricName string `env:"DAEMON_FABRIC_NAME" envDefault:""`
+	// Port to serve the validating webhook of ib-sriov network attachment definitions on, 0 disables the webhook
+	NADWebhookPort int `env:"DAEMON_NAD_WEBHOOK_PORT" envDefault:"0"`
+	// Directory of the "tls.crt" and "tls.key" files the validating webhook is served with
+	NADWebhookCertDir string `env:"DAEMON_NAD_WEBHOOK_CERT_DIR" envDefault:"/etc/ib-kubernetes/webhook"`
+	// Warn with an event on ib-sriov networks which device plugin resource isn't allocatable on any node
+	ValidateNetworkResources bool `env:"DAEMON_VALIDATE_NETWORK_RESOURCES" envDefault:"false"`
+	// Interval in seconds between audits of the fabric for guids configured for several pods or members of several
+	// pkeys, 0 disables the audit
+	FabricAuditInterval int `env:"DAEMON_FABRIC_AUDIT_INTERVAL" envDefault:"0"`
+	// Address to serve prometheus metrics on, e.g. ":9090", empty disables the metrics endpoint
+	MetricsAddr string `env:"DAEMON_METRICS_ADDR" envDefault:""`
+	// Address to serve the read-only REST API on, e.g. ":8443", empty disables the API
+	APIAddr string `env:"DAEMON_API_ADDR" envDefault:""`
+	// TLS certificate and key files of the read-only REST API, required as the API authenticates bearer tokens
+	APITLSCert string `env:"DAEMON_API_TLS_CERT"`
+	APITLSKey  string `env:"DAEMON_API_TLS_KEY"`
+	// Service accounts allowed to use the read-only REST API, "<namespace>/<name>"
+	APIServiceAccounts []string `env:"DAEMON_API_SERVICE_ACCOUNTS" envSeparator:","`
+	// Audiences the service account tokens of the read-only REST API requests must be issued for
+	APIAudiences []string `env:"DAEMON_API_AUDIENCES" envSeparator:"," envDefault:"ib-kubernetes"`
+	// Unix socket path of the admin API used by the CLI subcommands, empty disables the admin API
+	AdminSocket string `env:"DAEMON_ADMIN_SOCKET" envDefault:"/var/run/ib-kubernetes/admin.sock"`
+	// Run the reconcilers and periodic updates only in the replica holding the leader election lease, allowing
+	// to run several daemon replicas for high availability
+	LeaderElection bool `env:"DAEMON_LEADER_ELECTION" envDefault:"false"`
+	// Namespace of the leader election lease, defaults to the namespace the daemon runs in
+	LeaderElectionNamespace string `env:"DAEMON_LEADER_ELECTION_NAMESPACE" envDefault:""`
+	// Keep the guids of the running pods allocated from the pod informer cache while the replica isn't the
+	// leader, so a newly elected leader doesn't list the pods to init the guid pool
+	WarmStandby bool `env:"DAEMON_WARM_STANDBY" envDefault:"false"`
+	// Pre-allocate guids for the expected replicas of the ReplicaSets and StatefulSets which pod template requests
+	// InfiniBand networks and add them to the networks pkeys, so the pods are assigned a guid ahead of time
+	WarmPool bool `env:"DAEMON_WARM_POOL" envDefault:"false"`
+	// ConfigMap the warm guids are tracked in, as "<namespace>/<name>", so they are removed from their pkeys once
+	// not needed after a restart or a leader change
+	//nolint:lll
+	WarmPoolConfigMap string `env:"DAEMON_WARM_POOL_CONFIGMAP" envDefault:"kube-system/ib-kubernetes-warm-guids"`
+	// Advertise the free guids of the pool as the "ib-kubernetes.nvidia.com/guid" extended resource of the nodes,
+	// so the pods requesting it aren't scheduled once the pool is exhausted
+	GUIDExtendedResource bool `env:"DAEMON_GUID_EXTENDED_RESOURCE" envDefault:"false"`
+	// Remove the guids of the pods of deleted namespaces from their pkeys and release them, including the pods
+	// which deletion wasn't processed
+	NamespaceCleanup bool `env:"DAEMON_NAMESPACE_CLEANUP" envDefault:"false"`
+	// Record the summary of each periodic update as a kubernetes event on the daemon pod
+	SummaryEvents bool `env:"DAEMON_SUMMARY_EVENTS" envDefault:"false"`
+	// Record the pkey operations of each network, e.g. its members added or removed by the subnet manager, as
+	// kubernetes events on its network attachment definition
+	NetworkEvents bool `env:"DAEMON_NETWORK_EVENTS" envDefault:"false"`
+	// Name and namespace of the daemon pod, set from the downward API
+	PodName      string `env:"POD_NAME"`
+	PodNamespace string `env:"POD_NAMESPACE"`
+	// Manage only the pods bound to the node the daemon runs on, running the daemon as a DaemonSet shards the
+	// pods by node in very large clusters
+	NodeLocal bool `env:"DAEMON_NODE_LOCAL" envDefault:"false"`
+	// Name of the node the daemon runs on, set from the downward API
+	NodeName string `env:"NODE_NAME"`
+	// Comma separated URLs notified with JSON events on GUID allocation, release and pkey membership changes
+	WebhookURLs []string `env:"DAEMON_WEBHOOK_URLS" envSeparator:","`
+	// Deadline in seconds of each subnet manager call, 0 for no deadline
+	SMTimeout int `env:"DAEMON_SM_TIMEOUT" envDefault:"30"`
+	// Retries of the subnet manager calls
+	SMBackoff BackoffConfig `envPrefix:"BACKOFF_SM_"`
+	// Retries of the kubernetes API reads, e.g. getting network attachment definitions and listing pods
+	K8sGetBackoff BackoffConfig `envPrefix:"BACKOFF_K8S_GET_"`
+	// Retries of the kubernetes API writes of the pods' annotations
+	K8sPatchBackoff BackoffConfig `envPrefix:"BACKOFF_K8S_PATCH_"`
+	// Client side rate limit of the kubernetes API requests in queries per second, and the burst of queries
+	// allowed above it, 0 uses the client-go defaults
+	K8sClientQPS   float32 `env:"K8S_CLIENT_QPS" envDefault:"5"`
+	K8sClientBurst int     `env:"K8S_CLIENT_BURST" envDefault:"10"`
+}
+
+// BackoffConfig is the exponential backoff of the retries of an operation class, Steps 0 uses the default backoff
+type BackoffConfig struct {
+	// Delay before the first retry
+	Duration time.Duration `env:"DURATION" envDefault:"1s"`
+	// Multiplier of the delay on every retry
+	Factor float64 `env:"FACTOR" envDefault:"1.6"`
+	// Random fraction of the delay added to every retry
+	Jitter float64 `env:"JITTER" envDefault:"0.1"`
+	// Number of attempts
+	Steps int `env:"STEPS" envDefault:"6"`
+}
+
+// PeriodicLoopConfig is the interval and jitter of a periodic loop, overriding the periodic update ones
+type PeriodicLoopConfig struct {
+	// Interval in seconds between the runs of the loop, 0 uses the periodic update interval
+	Interval int `env:"INTERVAL" envDefault:"0"`
+	// Random fraction of the interval added to the wait between the runs, 0 uses the periodic update jitter
+	Jitter float64 `env:"JITTER" envDefault:"0"`
 }
 
 type GUIDPoolConfig struct {
@@ -22,6 +190,131 @@ type GUIDPoolConfig struct {
 	RangeStart string `env:"GUID_POOL_RANGE_START" envDefault:"02:00:00:00:00:00:00:00"`
 	// Last guid in the pool
 	RangeEnd string `env:"GUID_POOL_RANGE_END" envDefault:"02:FF:FF:FF:FF:FF:FF:FF"`
+	// Backend the guids allocated from a range shared by several clusters are recorded in, "etcd" or empty to
+	// disable the coordination
+	CoordinationBackend string `env:"GUID_POOL_COORDINATION_BACKEND"`
+	// Identity of the cluster recorded as the owner of its guids in the coordination backend
+	ClusterID string `env:"GUID_POOL_CLUSTER_ID"`
+	// Comma separated etcd endpoints, e.g. "https://etcd-0:2379,https://etcd-1:2379"
+	EtcdEndpoints []string `env:"GUID_POOL_ETCD_ENDPOINTS" envSeparator:","`
+	// Key prefix of the guids recorded in etcd
+	EtcdPrefix string `env:"GUID_POOL_ETCD_PREFIX" envDefault:"/ib-kubernetes/guids/"`
+	// TLS CA, client certificate and key files of the etcd endpoints
+	EtcdCAFile   string `env:"GUID_POOL_ETCD_CA_FILE"`
+	EtcdCertFile string `env:"GUID_POOL_ETCD_CERT_FILE"`
+	EtcdKeyFile  string `env:"GUID_POOL_ETCD_KEY_FILE"`
+	// What to do with guids of the range in use by the subnet manager but not allocated by ib-kubernetes,
+	// "fail", "warn" or "adopt"
+	ConflictPolicy string `env:"GUID_POOL_CONFLICT_POLICY" envDefault:"warn"`
+	// Node label selecting the sub-range the guids of the pods scheduled on the node are allocated from,
+	// e.g. "topology.kubernetes.io/zone"
+	NodeLabel string `env:"GUID_POOL_NODE_LABEL"`
+	// Sub-ranges of the pool by node label value, comma separated "<value>=<first guid>-<last guid>"
+	NodeRanges map[string]string `env:"GUID_POOL_NODE_RANGES" envSeparator:"," envKeyValSeparator:"="`
+}
+
+// GUID pool conflict policies, applied to the guids of the range in use by the subnet manager which aren't
+// allocated by ib-kubernetes
+const (
+	// ConflictPolicyFail fails the sync of the guid pool with the subnet manager
+	ConflictPolicyFail = "fail"
+	// ConflictPolicyWarn keeps the guids allocated in the pool, so they aren't assigned to pods, and logs them
+	ConflictPolicyWarn = "warn"
+	// ConflictPolicyAdopt considers the guids as leftovers of ib-kubernetes and keeps them free in the pool, so
+	// they are assigned to pods again
+	ConflictPolicyAdopt = "adopt"
+)
+
+// GUID pool coordination backends
+const (
+	// CoordinationBackendEtcd records the guids allocated by each cluster as keys of an etcd prefix
+	CoordinationBackendEtcd = "etcd"
+)
+
+// validateConfigMaps checks the config maps the stable and warm guids are tracked in, if enabled
+func (dc *DaemonConfig) validateConfigMaps() error {
+	configMaps := map[string]string{}
+	if dc.StatefulSetStableGUIDs {
+		configMaps["StableGUIDsConfigMap"] = dc.StableGUIDsConfigMap
+	}
+	if dc.WarmPool {
+		configMaps["WarmPoolConfigMap"] = dc.WarmPoolConfigMap
+	}
+	for field, configMap := range configMaps {
+		if namespace, name, found := strings.Cut(configMap, "/"); !found || namespace == "" || name == "" {
+			return fmt.Errorf("invalid \"%s\" value %s, expected <namespace>/<name>", field, configMap)
+		}
+	}
+	return nil
+}
+
+// validateNodeLocal checks the node-local mode keeps the guids of the daemon instances unique, and that it isn't
+// combined with features managing the pods of several nodes
+func (dc *DaemonConfig) validateNodeLocal() error {
+	if !dc.NodeLocal {
+		return nil
+	}
+	if dc.NodeName == "" {
+		return fmt.Errorf("\"NodeName\" must be set in node-local mode")
+	}
+	if dc.GUIDPool.NodeLabel == "" && dc.GUIDPool.CoordinationBackend == "" {
+		return fmt.Errorf("node-local mode requires the guid pool node sub-ranges or coordination backend to keep " +
+			"the guids of the nodes unique")
+	}
+	if dc.GUIDPool.ConflictPolicy == ConflictPolicyAdopt {
+		return fmt.Errorf("\"ConflictPolicy\" %s can't be used in node-local mode, the guids of the other nodes "+
+			"would be adopted", ConflictPolicyAdopt)
+	}
+	if dc.PKeyPool.RangeStart != "" || dc.PKeyPool.RangeEnd != "" {
+		return fmt.Errorf("\"PKeyPool\" can't be used in node-local mode, the instances would allocate pkeys " +
+			"from their own pools")
+	}
+	for name, enabled := range map[string]bool{"LeaderElection": dc.LeaderElection, "WarmPool": dc.WarmPool,
+		"NodeFailureGracePeriod": dc.NodeFailureGracePeriod > 0, "RemoveStalePKeyMembers": dc.RemoveStalePKeyMembers,
+		"PKeyMaxMembers": dc.PKeyMaxMembers > 0} {
+		if enabled {
+			return fmt.Errorf("\"%s\" can't be enabled in node-local mode", name)
+		}
+	}
+	return nil
+}
+
+// validateAPI validates the read-only REST API configuration. The API authenticates bearer tokens, so it's served
+// over TLS only, and the service accounts allowed to use it must be listed.
+func (dc *DaemonConfig) validateAPI() error {
+	if (dc.APITLSCert == "") != (dc.APITLSKey == "") {
+		return fmt.Errorf("both \"APITLSCert\" and \"APITLSKey\" must be set")
+	}
+	if dc.APIAddr == "" {
+		return nil
+	}
+	if dc.APITLSCert == "" {
+		return fmt.Errorf("\"APITLSCert\" and \"APITLSKey\" must be set to serve the api, bearer tokens aren't " +
+			"accepted over plain HTTP")
+	}
+	if len(dc.APIServiceAccounts) == 0 {
+		return fmt.Errorf("\"APIServiceAccounts\" must list the service accounts allowed to use the api")
+	}
+	for _, serviceAccount := range dc.APIServiceAccounts {
+		namespace, name, found := strings.Cut(serviceAccount, "/")
+		if !found || namespace == "" || name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid \"APIServiceAccounts\" value %q, expected <namespace>/<name>", serviceAccount)
+		}
+	}
+	if len(dc.APIAudiences) == 0 {
+		return fmt.Errorf("\"APIAudiences\" must be set to serve the api")
+	}
+	return nil
+}
+
+// maxPort is the highest TCP port the daemon servers listen on
+const maxPort = 65535
+
+type PKeyPoolConfig struct {
+	// First pkey in the pool, e.g. "0x0100"
+	RangeStart string `env:"PKEY_POOL_RANGE_START"`
+	// Last pkey in the pool, e.g. "0x01FF"
+	RangeEnd string `env:"PKEY_POOL_RANGE_END"`
 }
 
 func (dc *DaemonConfig) ReadConfig() error {
@@ -36,9 +329,190 @@ func (dc *DaemonConfig) ValidateConfig() error {
 	if dc.PeriodicUpdate <= 0 {
 		return fmt.Errorf("invalid \"PeriodicUpdate\" value %d", dc.PeriodicUpdate)
 	}
+	if err := dc.validateLoops(); err != nil {
+		return err
+	}
+
+	if dc.NodeFailureGracePeriod < 0 {
+		return fmt.Errorf("invalid \"NodeFailureGracePeriod\" value %d", dc.NodeFailureGracePeriod)
+	}
+
+	if dc.PKeyRemovalDelay < 0 {
+		return fmt.Errorf("invalid \"PKeyRemovalDelay\" value %d", dc.PKeyRemovalDelay)
+	}
+
+	if dc.PKeyMaxMembers < 0 {
+		return fmt.Errorf("invalid \"PKeyMaxMembers\" value %d", dc.PKeyMaxMembers)
+	}
+
+	if dc.DefaultLimitedPartition != "" {
+		pKey, err := ibUtils.ParsePKey(dc.DefaultLimitedPartition)
+		if err != nil {
+			return fmt.Errorf("invalid \"DefaultLimitedPartition\" value %s: %v", dc.DefaultLimitedPartition, err)
+		}
+		if !dc.ManageDefaultPKey && ibUtils.IsDefaultPKey(pKey) {
+			return fmt.Errorf("\"DefaultLimitedPartition\" %s is the default partition which is not managed",
+				dc.DefaultLimitedPartition)
+		}
+	}
+
+	if (dc.PKeyPool.RangeStart == "") != (dc.PKeyPool.RangeEnd == "") {
+		return fmt.Errorf("both \"PKeyPool\" range start and range end must be set")
+	}
+
+	if dc.FabricAuditInterval < 0 {
+		return fmt.Errorf("invalid \"FabricAuditInterval\" value %d", dc.FabricAuditInterval)
+	}
+
+	if dc.PodFlapCooldown < 0 {
+		return fmt.Errorf("invalid \"PodFlapCooldown\" value %d", dc.PodFlapCooldown)
+	}
+
+	if dc.SMTimeout < 0 {
+		return fmt.Errorf("invalid \"SMTimeout\" value %d", dc.SMTimeout)
+	}
+
+	if dc.NADWebhookPort < 0 || dc.NADWebhookPort > maxPort {
+		return fmt.Errorf("invalid \"NADWebhookPort\" value %d", dc.NADWebhookPort)
+	}
+
+	if dc.AnnotationRetries < 0 {
+		return fmt.Errorf("invalid \"AnnotationRetries\" value %d", dc.AnnotationRetries)
+	}
+
+	if dc.K8sClientQPS < 0 {
+		return fmt.Errorf("invalid \"K8sClientQPS\" value %v", dc.K8sClientQPS)
+	}
+
+	if dc.K8sClientBurst < 0 {
+		return fmt.Errorf("invalid \"K8sClientBurst\" value %d", dc.K8sClientBurst)
+	}
+
+	if err := dc.validateAPI(); err != nil {
+		return err
+	}
+
+	if dc.GUIDInjectionMode != "" && dc.GUIDInjectionMode != utils.GUIDInjectionCNIArgs &&
+		dc.GUIDInjectionMode != utils.GUIDInjectionRuntimeConfig {
+		return fmt.Errorf("invalid \"GUIDInjectionMode\" value %s, expected %s or %s", dc.GUIDInjectionMode,
+			utils.GUIDInjectionCNIArgs, utils.GUIDInjectionRuntimeConfig)
+	}
+
+	if err := dc.GUIDPool.validateCoordination(); err != nil {
+		return err
+	}
+
+	if (dc.GUIDPool.NodeLabel == "") != (len(dc.GUIDPool.NodeRanges) == 0) {
+		return fmt.Errorf("both \"NodeLabel\" and \"NodeRanges\" of the guid pool must be set")
+	}
+
+	switch dc.GUIDPool.ConflictPolicy {
+	case "", ConflictPolicyFail, ConflictPolicyWarn, ConflictPolicyAdopt:
+	default:
+		return fmt.Errorf("invalid \"ConflictPolicy\" value %s, expected %s, %s or %s", dc.GUIDPool.ConflictPolicy,
+			ConflictPolicyFail, ConflictPolicyWarn, ConflictPolicyAdopt)
+	}
+
+	if err := dc.validateConfigMaps(); err != nil {
+		return err
+	}
+
+	for name, backoff := range map[string]BackoffConfig{"SMBackoff": dc.SMBackoff, "K8sGetBackoff": dc.K8sGetBackoff,
+		"K8sPatchBackoff": dc.K8sPatchBackoff} {
+		if err := backoff.validate(); err != nil {
+			return fmt.Errorf("invalid \"%s\": %v", name, err)
+		}
+	}
+
+	if dc.WarmPool && len(dc.GUIDPool.NodeRanges) != 0 {
+		return fmt.Errorf("\"WarmPool\" can't be enabled with the guid pool node sub-ranges")
+	}
+
+	if err := dc.validateNodeLocal(); err != nil {
+		return err
+	}
+
+	if dc.SummaryEvents && (dc.PodName == "" || dc.PodNamespace == "") {
+		return fmt.Errorf("\"PodName\" and \"PodNamespace\" must be set to record summary events")
+	}
 
 	if dc.Plugin == "" {
 		return fmt.Errorf("no plugin selected")
 	}
 	return nil
 }
+
+// LoopPeriod returns the interval and jitter of the periodic loop, the periodic update ones if unset
+func (dc *DaemonConfig) LoopPeriod(loop PeriodicLoopConfig) (time.Duration, float64) {
+	interval, jitter := dc.PeriodicUpdate, dc.PeriodicUpdateJitter
+	if loop.Interval != 0 {
+		interval = loop.Interval
+	}
+	if loop.Jitter != 0 {
+		jitter = loop.Jitter
+	}
+	return time.Duration(interval) * time.Second, jitter
+}
+
+// validateLoops validates the jitter of the periodic loops and the intervals and jitters of the loops overriding
+// them
+func (dc *DaemonConfig) validateLoops() error {
+	if dc.PeriodicUpdateJitter < 0 {
+		return fmt.Errorf("invalid \"PeriodicUpdateJitter\" value %v", dc.PeriodicUpdateJitter)
+	}
+	for name, loop := range map[string]PeriodicLoopConfig{"AddLoop": dc.AddLoop, "DeleteLoop": dc.DeleteLoop} {
+		if err := loop.validate(); err != nil {
+			return fmt.Errorf("invalid \"%s\": %v", name, err)
+		}
+	}
+	return nil
+}
+
+// validate validates the periodic loop parameters
+func (lc *PeriodicLoopConfig) validate() error {
+	switch {
+	case lc.Interval < 0:
+		return fmt.Errorf("invalid interval %d", lc.Interval)
+	case lc.Jitter < 0:
+		return fmt.Errorf("invalid jitter %v", lc.Jitter)
+	}
+	return nil
+}
+
+// validate validates the backoff parameters
+func (bc *BackoffConfig) validate() error {
+	switch {
+	case bc.Steps < 0:
+		return fmt.Errorf("invalid steps %d", bc.Steps)
+	case bc.Duration < 0:
+		return fmt.Errorf("invalid duration %s", bc.Duration)
+	case bc.Factor < 0:
+		return fmt.Errorf("invalid factor %v", bc.Factor)
+	case bc.Jitter < 0:
+		return fmt.Errorf("invalid jitter %v", bc.Jitter)
+	}
+	return nil
+}
+
+// validateCoordination validates the guid pool coordination backend configuration
+func (gc *GUIDPoolConfig) validateCoordination() error {
+	switch gc.CoordinationBackend {
+	case "":
+		return nil
+	case CoordinationBackendEtcd:
+		if len(gc.EtcdEndpoints) == 0 {
+			return fmt.Errorf("\"EtcdEndpoints\" must be set with the %s coordination backend", gc.CoordinationBackend)
+		}
+		if (gc.EtcdCertFile == "") != (gc.EtcdKeyFile == "") {
+			return fmt.Errorf("both \"EtcdCertFile\" and \"EtcdKeyFile\" must be set")
+		}
+	default:
+		return fmt.Errorf("invalid \"CoordinationBackend\" value %s, expected %s", gc.CoordinationBackend,
+			CoordinationBackendEtcd)
+	}
+
+	if gc.ClusterID == "" {
+		return fmt.Errorf("\"ClusterID\" must be set with the %s coordination backend", gc.CoordinationBackend)
+	}
+	return nil
+}
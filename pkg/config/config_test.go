@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -20,6 +21,11 @@ var _ = Describe("Configuration", func() {
 			Expect(os.Setenv("GUID_POOL_RANGE_END", "02:00:00:00:00:00:00:FF")).ToNot(HaveOccurred())
 			Expect(os.Setenv("DAEMON_SM_PLUGIN", "ufm")).ToNot(HaveOccurred())
 			Expect(os.Setenv("DAEMON_SM_PLUGIN_PATH", "/custom/plugins/location")).ToNot(HaveOccurred())
+			Expect(os.Setenv("DAEMON_NODE_FAILURE_GRACE_PERIOD", "300")).ToNot(HaveOccurred())
+			Expect(os.Setenv("DAEMON_PKEY_REMOVAL_DELAY", "30")).ToNot(HaveOccurred())
+			Expect(os.Setenv("DAEMON_ANNOTATION_WRITER", "server-side-apply")).ToNot(HaveOccurred())
+			Expect(os.Setenv("DAEMON_ENABLE_GUID_RESERVATIONS", "true")).ToNot(HaveOccurred())
+			Expect(os.Setenv("DAEMON_WEBHOOK_URLS", "http://ipam/hook,https://cmdb/hook")).ToNot(HaveOccurred())
 
 			err := dc.ReadConfig()
 			Expect(err).ToNot(HaveOccurred())
@@ -28,6 +34,11 @@ var _ = Describe("Configuration", func() {
 			Expect(dc.GUIDPool.RangeEnd).To(Equal("02:00:00:00:00:00:00:FF"))
 			Expect(dc.Plugin).To(Equal("ufm"))
 			Expect(dc.PluginPath).To(Equal("/custom/plugins/location"))
+			Expect(dc.NodeFailureGracePeriod).To(Equal(300))
+			Expect(dc.PKeyRemovalDelay).To(Equal(30))
+			Expect(dc.AnnotationWriter).To(Equal("server-side-apply"))
+			Expect(dc.EnableGUIDReservations).To(BeTrue())
+			Expect(dc.WebhookURLs).To(Equal([]string{"http://ipam/hook", "https://cmdb/hook"}))
 		})
 		It("Read configuration with default values", func() {
 			dc := &DaemonConfig{}
@@ -40,6 +51,61 @@ var _ = Describe("Configuration", func() {
 			Expect(dc.GUIDPool.RangeEnd).To(Equal("02:FF:FF:FF:FF:FF:FF:FF"))
 			Expect(dc.Plugin).To(Equal("ufm"))
 			Expect(dc.PluginPath).To(Equal("/plugins"))
+			Expect(dc.NodeFailureGracePeriod).To(Equal(0))
+			Expect(dc.PKeyRemovalDelay).To(Equal(0))
+			Expect(dc.AnnotationWriter).To(Equal("merge-patch"))
+			Expect(dc.GUIDInjectionMode).To(Equal("cni-args"))
+			Expect(dc.EnableGUIDReservations).To(BeFalse())
+			Expect(dc.AdminSocket).To(Equal("/var/run/ib-kubernetes/admin.sock"))
+			Expect(dc.WebhookURLs).To(BeEmpty())
+			defaultBackoff := BackoffConfig{Duration: time.Second, Factor: 1.6, Jitter: 0.1, Steps: 6}
+			Expect(dc.SMBackoff).To(Equal(defaultBackoff))
+			Expect(dc.K8sGetBackoff).To(Equal(defaultBackoff))
+			Expect(dc.K8sPatchBackoff).To(Equal(defaultBackoff))
+			Expect(dc.K8sClientQPS).To(Equal(float32(5)))
+			Expect(dc.K8sClientBurst).To(Equal(10))
+		})
+		It("Read backoff configuration of each operation class", func() {
+			dc := &DaemonConfig{}
+			Expect(os.Setenv("BACKOFF_SM_DURATION", "5s")).ToNot(HaveOccurred())
+			Expect(os.Setenv("BACKOFF_SM_FACTOR", "2")).ToNot(HaveOccurred())
+			Expect(os.Setenv("BACKOFF_SM_STEPS", "10")).ToNot(HaveOccurred())
+			Expect(os.Setenv("BACKOFF_K8S_PATCH_DURATION", "100ms")).ToNot(HaveOccurred())
+			Expect(os.Setenv("BACKOFF_K8S_PATCH_JITTER", "0.5")).ToNot(HaveOccurred())
+
+			Expect(dc.ReadConfig()).To(Succeed())
+			Expect(dc.SMBackoff).To(Equal(BackoffConfig{Duration: 5 * time.Second, Factor: 2, Jitter: 0.1, Steps: 10}))
+			Expect(dc.K8sGetBackoff).To(Equal(BackoffConfig{Duration: time.Second, Factor: 1.6, Jitter: 0.1, Steps: 6}))
+			Expect(dc.K8sPatchBackoff).To(Equal(
+				BackoffConfig{Duration: 100 * time.Millisecond, Factor: 1.6, Jitter: 0.5, Steps: 6}))
+		})
+		It("Read periodic loops configuration", func() {
+			dc := &DaemonConfig{}
+			Expect(os.Setenv("DAEMON_PERIODIC_UPDATE_JITTER", "0.2")).ToNot(HaveOccurred())
+			Expect(os.Setenv("DAEMON_PERIODIC_DELETE_INTERVAL", "30")).ToNot(HaveOccurred())
+			Expect(os.Setenv("DAEMON_PERIODIC_DELETE_JITTER", "0.5")).ToNot(HaveOccurred())
+
+			Expect(dc.ReadConfig()).To(Succeed())
+			Expect(dc.PeriodicUpdateJitter).To(Equal(0.2))
+			Expect(dc.AddLoop).To(Equal(PeriodicLoopConfig{}))
+			Expect(dc.DeleteLoop).To(Equal(PeriodicLoopConfig{Interval: 30, Jitter: 0.5}))
+		})
+	})
+	Context("LoopPeriod", func() {
+		It("Use the periodic update interval and jitter of the loops without their own", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 5, PeriodicUpdateJitter: 0.1}
+
+			period, jitter := dc.LoopPeriod(PeriodicLoopConfig{})
+			Expect(period).To(Equal(5 * time.Second))
+			Expect(jitter).To(Equal(0.1))
+
+			period, jitter = dc.LoopPeriod(PeriodicLoopConfig{Interval: 60})
+			Expect(period).To(Equal(time.Minute))
+			Expect(jitter).To(Equal(0.1))
+
+			period, jitter = dc.LoopPeriod(PeriodicLoopConfig{Jitter: 0.5})
+			Expect(period).To(Equal(5 * time.Second))
+			Expect(jitter).To(Equal(0.5))
 		})
 	})
 	Context("ValidateConfig", func() {
@@ -59,11 +125,136 @@ var _ = Describe("Configuration", func() {
 			err := dc.ValidateConfig()
 			Expect(err).To(HaveOccurred())
 		})
+		It("Validate configuration with invalid node failure grace period", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, NodeFailureGracePeriod: -1, Plugin: "ufm"}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with invalid pkey removal delay", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, PKeyRemovalDelay: -1, Plugin: "ufm"}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with invalid pkey max members", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, PKeyMaxMembers: -1, Plugin: "ufm"}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with invalid fabric audit interval", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", FabricAuditInterval: -1}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with invalid pod flap cooldown", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, PodFlapCooldown: -1, Plugin: "ufm"}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with invalid subnet manager timeout", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, SMTimeout: -1, Plugin: "ufm"}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with invalid network attachment definition webhook port", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", NADWebhookPort: 65536}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.NADWebhookPort = 9443
+			Expect(dc.ValidateConfig()).To(Succeed())
+		})
+		It("Validate configuration with invalid kubernetes client rate limit", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", K8sClientQPS: -1}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc = &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", K8sClientQPS: 50, K8sClientBurst: -1}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.K8sClientBurst = 100
+			Expect(dc.ValidateConfig()).To(Succeed())
+		})
+		It("Validate configuration with invalid annotation retries", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", AnnotationRetries: -1}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with statefulset stable guids", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", StatefulSetStableGUIDs: true,
+				StableGUIDsConfigMap: "kube-system/ib-kubernetes-stable-guids"}
+			err := dc.ValidateConfig()
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Validate configuration with invalid stable guids config map", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", StatefulSetStableGUIDs: true,
+				StableGUIDsConfigMap: "ib-kubernetes-stable-guids"}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with runtime config guid injection mode", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", GUIDInjectionMode: "runtime-config"}
+			err := dc.ValidateConfig()
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Validate configuration with invalid guid injection mode", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", GUIDInjectionMode: "annotation"}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with api tls key not set", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", APITLSCert: "/etc/ib-kubernetes/tls.crt"}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with api", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", APIAddr: ":8443",
+				APITLSCert: "/etc/ib-kubernetes/tls.crt", APITLSKey: "/etc/ib-kubernetes/tls.key",
+				APIServiceAccounts: []string{"monitoring/dashboard"}, APIAudiences: []string{"ib-kubernetes"}}
+			err := dc.ValidateConfig()
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Validate configuration with api served without tls", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", APIAddr: ":8443",
+				APIServiceAccounts: []string{"monitoring/dashboard"}, APIAudiences: []string{"ib-kubernetes"}}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with api without allowed service accounts", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", APIAddr: ":8443",
+				APITLSCert: "/etc/ib-kubernetes/tls.crt", APITLSKey: "/etc/ib-kubernetes/tls.key",
+				APIAudiences: []string{"ib-kubernetes"}}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with invalid api service account", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", APIAddr: ":8443",
+				APITLSCert: "/etc/ib-kubernetes/tls.crt", APITLSKey: "/etc/ib-kubernetes/tls.key",
+				APIServiceAccounts: []string{"dashboard"}, APIAudiences: []string{"ib-kubernetes"}}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
 		It("Validate configuration with not selected plugin", func() {
 			dc := &DaemonConfig{PeriodicUpdate: 10}
 			err := dc.ValidateConfig()
 			Expect(err).To(HaveOccurred())
 		})
+		It("Validate configuration with default limited partition", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", DefaultLimitedPartition: "0x7FFF",
+				ManageDefaultPKey: true}
+			err := dc.ValidateConfig()
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Validate configuration with unmanaged default limited partition", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", DefaultLimitedPartition: "0x7FFF"}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.DefaultLimitedPartition = "0x0005"
+			Expect(dc.ValidateConfig()).To(Succeed())
+		})
+		It("Validate configuration with invalid default limited partition", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", DefaultLimitedPartition: "7FFF"}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Validate configuration with pkey pool end not set", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", PKeyPool: PKeyPoolConfig{RangeStart: "0x0100"}}
+			err := dc.ValidateConfig()
+			Expect(err).To(HaveOccurred())
+		})
 		It("Validate configuration with guid pool start not set", func() {
 			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm"}
 			err := dc.ValidateConfig()
@@ -77,5 +268,114 @@ var _ = Describe("Configuration", func() {
 			err := dc.ValidateConfig()
 			Expect(err).ToNot(HaveOccurred())
 		})
+		It("Validate configuration with guid pool etcd coordination", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", GUIDPool: GUIDPoolConfig{
+				CoordinationBackend: CoordinationBackendEtcd, ClusterID: "cluster-a",
+				EtcdEndpoints: []string{"https://etcd:2379"}}}
+			Expect(dc.ValidateConfig()).To(Succeed())
+
+			dc.GUIDPool.ClusterID = ""
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+			dc.GUIDPool.ClusterID = "cluster-a"
+			dc.GUIDPool.EtcdEndpoints = nil
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+			dc.GUIDPool.EtcdEndpoints = []string{"https://etcd:2379"}
+			dc.GUIDPool.EtcdCertFile = "/etc/etcd/client.crt"
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with invalid guid pool coordination backend", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", GUIDPool: GUIDPoolConfig{
+				CoordinationBackend: "consul", ClusterID: "cluster-a"}}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with invalid backoff", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", K8sGetBackoff: BackoffConfig{Steps: -1}}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.K8sGetBackoff = BackoffConfig{Duration: time.Second, Factor: -1, Steps: 3}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with invalid periodic loops", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", PeriodicUpdateJitter: -0.1}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc = &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", DeleteLoop: PeriodicLoopConfig{Interval: -1}}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.DeleteLoop = PeriodicLoopConfig{Interval: 60, Jitter: -1}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.DeleteLoop = PeriodicLoopConfig{Interval: 60, Jitter: 0.2}
+			Expect(dc.ValidateConfig()).To(Succeed())
+		})
+		It("Validate configuration with summary events", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", SummaryEvents: true}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.PodName, dc.PodNamespace = "ib-kubernetes-0", "kube-system"
+			Expect(dc.ValidateConfig()).To(Succeed())
+		})
+		It("Validate configuration with guid pool node ranges", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", GUIDPool: GUIDPoolConfig{
+				NodeLabel:  "topology.kubernetes.io/zone",
+				NodeRanges: map[string]string{"zone-a": "02:00:00:00:00:00:00:00-02:00:00:00:00:00:0F:FF"}}}
+			Expect(dc.ValidateConfig()).To(Succeed())
+
+			dc.GUIDPool.NodeLabel = ""
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with warm pool", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", WarmPool: true,
+				WarmPoolConfigMap: "kube-system/ib-kubernetes-warm-guids"}
+			Expect(dc.ValidateConfig()).To(Succeed())
+
+			dc.WarmPoolConfigMap = "ib-kubernetes-warm-guids"
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.WarmPoolConfigMap = "kube-system/ib-kubernetes-warm-guids"
+
+			dc.GUIDPool = GUIDPoolConfig{NodeLabel: "topology.kubernetes.io/zone",
+				NodeRanges: map[string]string{"zone-a": "02:00:00:00:00:00:00:00-02:00:00:00:00:00:0F:FF"}}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration in node-local mode", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", NodeLocal: true, GUIDPool: GUIDPoolConfig{
+				NodeLabel:  "kubernetes.io/hostname",
+				NodeRanges: map[string]string{"node1": "02:00:00:00:00:00:00:00-02:00:00:00:00:00:0F:FF"}}}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.NodeName = "node1"
+			Expect(dc.ValidateConfig()).To(Succeed())
+
+			dc.LeaderElection = true
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+			dc.LeaderElection = false
+
+			dc.RemoveStalePKeyMembers = true
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+			dc.RemoveStalePKeyMembers = false
+
+			dc.PKeyMaxMembers = 100
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+			dc.PKeyMaxMembers = 0
+
+			dc.PKeyPool = PKeyPoolConfig{RangeStart: "0x100", RangeEnd: "0x1ff"}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+			dc.PKeyPool = PKeyPoolConfig{}
+
+			dc.GUIDPool.ConflictPolicy = ConflictPolicyAdopt
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+
+			dc.GUIDPool = GUIDPoolConfig{}
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
+		It("Validate configuration with guid pool conflict policy", func() {
+			dc := &DaemonConfig{PeriodicUpdate: 10, Plugin: "ufm", GUIDPool: GUIDPoolConfig{
+				ConflictPolicy: ConflictPolicyAdopt}}
+			Expect(dc.ValidateConfig()).To(Succeed())
+
+			dc.GUIDPool.ConflictPolicy = "ignore"
+			Expect(dc.ValidateConfig()).ToNot(Succeed())
+		})
 	})
 })
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Sources of the daemon configuration
+const (
+	// ConfigSourceEnv reads the configuration from the environment variables only
+	ConfigSourceEnv = "env"
+	// ConfigSourceNicClusterPolicy reads the configuration from the NicClusterPolicy of the NVIDIA network-operator
+	// over the environment variables
+	ConfigSourceNicClusterPolicy = "nic-cluster-policy"
+)
+
+const (
+	// nicClusterPolicyPlugin is the subnet manager plugin configured by the NicClusterPolicy UFM secret
+	nicClusterPolicyPlugin = "ufm"
+	// ufmSecretKeyPrefix is the prefix of the keys of the NicClusterPolicy UFM secret set as plugin environment
+	// variables, e.g. "UFM_ADDRESS"
+	ufmSecretKeyPrefix = "UFM_"
+)
+
+// Provider loads the daemon configuration from a configuration source over the configuration read from the
+// environment variables, the values the source doesn't set are kept
+type Provider interface {
+	// Name returns the name of the configuration source
+	Name() string
+	// Load sets the daemon configuration from the configuration source
+	Load(dc *DaemonConfig) error
+}
+
+// NicClusterPolicyClient is the kubernetes client the NicClusterPolicy configuration is read with
+type NicClusterPolicyClient interface {
+	GetNicClusterPolicy(name string) (*unstructured.Unstructured, error)
+	GetSecret(namespace, name string) (*kapi.Secret, error)
+}
+
+// NewProvider returns the provider of the configuration source selected by the configuration read from the
+// environment variables
+func NewProvider(dc *DaemonConfig, client NicClusterPolicyClient) (Provider, error) {
+	switch dc.ConfigSource {
+	case "", ConfigSourceEnv:
+		return &envProvider{}, nil
+	case ConfigSourceNicClusterPolicy:
+		return &nicClusterPolicyProvider{client: client, name: dc.NicClusterPolicyName,
+			namespace: dc.PodNamespace}, nil
+	}
+	return nil, fmt.Errorf("invalid \"ConfigSource\" value %s, expected %s or %s", dc.ConfigSource,
+		ConfigSourceEnv, ConfigSourceNicClusterPolicy)
+}
+
+// envProvider reads the configuration from the environment variables
+type envProvider struct{}
+
+func (p *envProvider) Name() string {
+	return ConfigSourceEnv
+}
+
+func (p *envProvider) Load(dc *DaemonConfig) error {
+	return dc.ReadConfig()
+}
+
+// nicClusterPolicyIBKubernetes is the ib-kubernetes configuration of the NicClusterPolicy, its "spec.ibKubernetes"
+type nicClusterPolicyIBKubernetes struct {
+	PeriodicUpdateSeconds  int    `json:"periodicUpdateSeconds,omitempty"`
+	PKeyGUIDPoolRangeStart string `json:"pKeyGUIDPoolRangeStart,omitempty"`
+	PKeyGUIDPoolRangeEnd   string `json:"pKeyGUIDPoolRangeEnd,omitempty"`
+	// Name of the secret of the daemon namespace holding the UFM plugin configuration, e.g. "UFM_ADDRESS"
+	UFMSecret string `json:"ufmSecret,omitempty"`
+}
+
+// nicClusterPolicyProvider reads the configuration from the NicClusterPolicy managed by the NVIDIA network-operator,
+// so the settings of the operator deployments are kept in one place
+type nicClusterPolicyProvider struct {
+	client NicClusterPolicyClient
+	name   string
+	// namespace of the daemon the UFM secret is read from
+	namespace string
+}
+
+func (p *nicClusterPolicyProvider) Name() string {
+	return ConfigSourceNicClusterPolicy
+}
+
+// Load sets the periodic update interval and the guid pool range set in the NicClusterPolicy. With a UFM secret,
+// the UFM plugin is selected and the "UFM_" keys of the secret are set as environment variables the plugin reads
+// its configuration from.
+func (p *nicClusterPolicyProvider) Load(dc *DaemonConfig) error {
+	policy, err := p.client.GetNicClusterPolicy(p.name)
+	if err != nil {
+		return fmt.Errorf("failed to get NicClusterPolicy %s: %v", p.name, err)
+	}
+	spec, found, err := unstructured.NestedMap(policy.Object, "spec", "ibKubernetes")
+	if err != nil || !found {
+		return fmt.Errorf("NicClusterPolicy %s has no ibKubernetes configuration", p.name)
+	}
+	ibKubernetes := &nicClusterPolicyIBKubernetes{}
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(spec, ibKubernetes); err != nil {
+		return fmt.Errorf("failed to parse ibKubernetes configuration of NicClusterPolicy %s: %v", p.name, err)
+	}
+
+	if ibKubernetes.PeriodicUpdateSeconds != 0 {
+		dc.PeriodicUpdate = ibKubernetes.PeriodicUpdateSeconds
+	}
+	if ibKubernetes.PKeyGUIDPoolRangeStart != "" {
+		dc.GUIDPool.RangeStart = ibKubernetes.PKeyGUIDPoolRangeStart
+	}
+	if ibKubernetes.PKeyGUIDPoolRangeEnd != "" {
+		dc.GUIDPool.RangeEnd = ibKubernetes.PKeyGUIDPoolRangeEnd
+	}
+	if ibKubernetes.UFMSecret == "" {
+		return nil
+	}
+
+	if p.namespace == "" {
+		return fmt.Errorf("\"PodNamespace\" must be set to read the UFM secret %s of NicClusterPolicy %s",
+			ibKubernetes.UFMSecret, p.name)
+	}
+	secret, err := p.client.GetSecret(p.namespace, ibKubernetes.UFMSecret)
+	if err != nil {
+		return fmt.Errorf("failed to get UFM secret %s of NicClusterPolicy %s: %v", ibKubernetes.UFMSecret,
+			p.name, err)
+	}
+	for key, value := range secret.Data {
+		if !strings.HasPrefix(key, ufmSecretKeyPrefix) {
+			continue
+		}
+		if err = os.Setenv(key, string(value)); err != nil {
+			return fmt.Errorf("failed to set %s of UFM secret %s: %v", key, ibKubernetes.UFMSecret, err)
+		}
+	}
+	dc.Plugin = nicClusterPolicyPlugin
+	log.Info().Msgf("using UFM plugin configured by secret %s of NicClusterPolicy %s", ibKubernetes.UFMSecret,
+		p.name)
+	return nil
+}
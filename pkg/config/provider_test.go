@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+)
+
+var _ = Describe("Configuration Providers", func() {
+	newNicClusterPolicy := func(ibKubernetes map[string]interface{}) *unstructured.Unstructured {
+		policy := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "mellanox.com/v1alpha1",
+			"kind":       "NicClusterPolicy",
+			"metadata":   map[string]interface{}{"name": "nic-cluster-policy"},
+			"spec":       map[string]interface{}{},
+		}}
+		if ibKubernetes != nil {
+			policy.Object["spec"] = map[string]interface{}{"ibKubernetes": ibKubernetes}
+		}
+		return policy
+	}
+	newDaemonConfig := func() *DaemonConfig {
+		return &DaemonConfig{ConfigSource: ConfigSourceNicClusterPolicy, NicClusterPolicyName: "nic-cluster-policy",
+			PodNamespace: "network-operator", PeriodicUpdate: 5, Plugin: "noop",
+			GUIDPool: GUIDPoolConfig{RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:FF:FF:FF:FF:FF:FF:FF"}}
+	}
+
+	AfterEach(func() {
+		os.Clearenv()
+	})
+
+	It("Read the configuration from the environment variables by default", func() {
+		Expect(os.Setenv("DAEMON_SM_PLUGIN", "ufm")).To(Succeed())
+		dc := &DaemonConfig{}
+		provider, err := NewProvider(dc, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(provider.Name()).To(Equal(ConfigSourceEnv))
+		Expect(provider.Load(dc)).To(Succeed())
+		Expect(dc.Plugin).To(Equal("ufm"))
+	})
+	It("Read the configuration from the NicClusterPolicy", func() {
+		secret := &kapi.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ufm-secret", Namespace: "network-operator"},
+			Data: map[string][]byte{"UFM_ADDRESS": []byte("ufm.local"), "OTHER": []byte("value")}}
+		client := k8sClientFake.NewClient(secret, newNicClusterPolicy(map[string]interface{}{
+			"periodicUpdateSeconds":  int64(10),
+			"pKeyGUIDPoolRangeStart": "02:00:00:00:00:00:10:00",
+			"pKeyGUIDPoolRangeEnd":   "02:00:00:00:00:00:1F:FF",
+			"ufmSecret":              "ufm-secret",
+		}))
+		dc := newDaemonConfig()
+		provider, err := NewProvider(dc, client)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(provider.Name()).To(Equal(ConfigSourceNicClusterPolicy))
+
+		Expect(provider.Load(dc)).To(Succeed())
+		Expect(dc.PeriodicUpdate).To(Equal(10))
+		Expect(dc.GUIDPool.RangeStart).To(Equal("02:00:00:00:00:00:10:00"))
+		Expect(dc.GUIDPool.RangeEnd).To(Equal("02:00:00:00:00:00:1F:FF"))
+		Expect(dc.Plugin).To(Equal("ufm"))
+		Expect(os.Getenv("UFM_ADDRESS")).To(Equal("ufm.local"))
+		Expect(os.Getenv("OTHER")).To(BeEmpty())
+	})
+	It("Keep the values the NicClusterPolicy doesn't set", func() {
+		client := k8sClientFake.NewClient(newNicClusterPolicy(map[string]interface{}{"periodicUpdateSeconds": int64(7)}))
+		dc := newDaemonConfig()
+		provider, err := NewProvider(dc, client)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(provider.Load(dc)).To(Succeed())
+		Expect(dc.PeriodicUpdate).To(Equal(7))
+		Expect(dc.GUIDPool.RangeStart).To(Equal("02:00:00:00:00:00:00:00"))
+		Expect(dc.Plugin).To(Equal("noop"))
+	})
+	It("Fail without the NicClusterPolicy ib-kubernetes configuration", func() {
+		dc := newDaemonConfig()
+		provider, err := NewProvider(dc, k8sClientFake.NewClient(newNicClusterPolicy(nil)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(provider.Load(dc)).ToNot(Succeed())
+
+		provider, err = NewProvider(dc, k8sClientFake.NewClient())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(provider.Load(dc)).ToNot(Succeed())
+	})
+	It("Reject unknown configuration sources", func() {
+		_, err := NewProvider(&DaemonConfig{ConfigSource: "configmap"}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,339 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// ListGUIDs returns all GUIDs allocated by the daemon sorted by GUID
+func (d *daemon) ListGUIDs() []admin.GUIDAllocation {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	allocations := make([]admin.GUIDAllocation, 0, len(d.guidPodNetworkMap))
+	for allocatedGUID, key := range d.guidPodNetworkMap {
+		allocations = append(allocations, admin.GUIDAllocation{
+			GUID: allocatedGUID, PodUID: string(key.PodUID), NetworkID: key.NetworkID, Interface: key.Interface})
+	}
+	sort.Slice(allocations, func(i, j int) bool { return allocations[i].GUID < allocations[j].GUID })
+	return allocations
+}
+
+// PoolStats returns the usage of the GUID pool
+func (d *daemon) PoolStats() guid.PoolStats {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	return d.guidPool.Stats()
+}
+
+// ReleaseGUID force releases the guid allocated for a pod network, removing it from the network's pkey
+func (d *daemon) ReleaseGUID(guidStr string) error {
+	guidAddr, err := guid.ParseGUID(guidStr)
+	if err != nil {
+		return fmt.Errorf("invalid guid %s: %v", guidStr, err)
+	}
+	allocatedGUID := guidAddr.String()
+
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	key, exist := d.guidPodNetworkMap[allocatedGUID]
+	if !exist {
+		return fmt.Errorf("failed to release guid %s: %w", allocatedGUID, admin.ErrGUIDNotFound)
+	}
+
+	if key.NetworkID == guidReservationNetworkID {
+		return fmt.Errorf("guid %s is reserved by IBGuidReservation, delete the reservation to release it",
+			allocatedGUID)
+	}
+	return d.forceReleaseGUID(guidAddr, key)
+}
+
+// ReleasePod force releases the guids allocated for the pod networks, removing them from their pkeys. The pod
+// annotations are kept as they are, so the guids of a running pod may be allocated to other pods.
+func (d *daemon) ReleasePod(namespace, name string) (*admin.PodRelease, error) {
+	pod, err := d.kubeClient.GetPod(namespace, name)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to release pod namespace %s name %s: %w", namespace, name,
+				admin.ErrPodNotFound)
+		}
+		return nil, fmt.Errorf("failed to get pod namespace %s name %s: %v", namespace, name, err)
+	}
+
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	var podGUIDs []string
+	for allocatedGUID, key := range d.guidPodNetworkMap {
+		if key.PodUID == pod.UID {
+			podGUIDs = append(podGUIDs, allocatedGUID)
+		}
+	}
+	sort.Strings(podGUIDs)
+
+	release := &admin.PodRelease{Namespace: namespace, Name: name, PodUID: string(pod.UID),
+		GUIDs: make([]string, 0, len(podGUIDs))}
+	for _, podGUID := range podGUIDs {
+		guidAddr, err := guid.ParseGUID(podGUID)
+		if err != nil {
+			return release, fmt.Errorf("invalid guid %s of pod namespace %s name %s: %v", podGUID, namespace, name,
+				err)
+		}
+		if err = d.forceReleaseGUID(guidAddr, d.guidPodNetworkMap[podGUID]); err != nil {
+			return release, err
+		}
+		release.GUIDs = append(release.GUIDs, podGUID)
+	}
+	log.Info().Msgf("force released %d guids of pod namespace %s name %s", len(release.GUIDs), namespace, name)
+	return release, nil
+}
+
+// forceReleaseGUID removes the guid from the pkeys of its network and releases it, it's called with poolMutex held
+func (d *daemon) forceReleaseGUID(guidAddr guid.GUID, key utils.PodNetworkKey) error {
+	allocatedGUID := guidAddr.String()
+	// Stable guid of a stopped StatefulSet replica isn't a member of any pkey
+	if key.NetworkID != stableGUIDNetworkID {
+		if err := d.removeReleasedGUIDFromPKeys(key.NetworkID, guidAddr); err != nil {
+			return fmt.Errorf("failed to release guid %s: %v", allocatedGUID, err)
+		}
+	}
+
+	if err := d.releasePodNetworkGUID(allocatedGUID); err != nil {
+		return fmt.Errorf("failed to release guid %s: %v", allocatedGUID, err)
+	}
+
+	log.Info().Msgf("force released guid %s allocated for %s", allocatedGUID, key)
+	return nil
+}
+
+// removeReleasedGUIDFromPKeys removes the released guid from the pkey of its network and the default
+// limited partition, pkey cleanup is skipped if the network can't be resolved
+func (d *daemon) removeReleasedGUIDFromPKeys(networkID string, guidAddr guid.GUID) error {
+	guids := []net.HardwareAddr{guidAddr.HardWareAddress()}
+	_, ibCniSpec, err := d.getIbSriovNetwork(networkID)
+	if err != nil {
+		log.Warn().Msgf("skipping pkey cleanup of guid %s: %v", guidAddr, err)
+		return nil
+	}
+
+	if ibCniSpec.PKey != "" {
+		if err = d.removeGUIDsFromPKey(ibCniSpec.PKey, guids); err != nil {
+			return err
+		}
+	}
+	return d.removeGUIDsFromLimitedPartition(ibCniSpec.PKey, guids)
+}
+
+// Sync rebuilds the GUID pool from the GUIDs allocated by the daemon and the GUIDs in use by the subnet manager,
+// dropping allocations which aren't tracked by the daemon
+func (d *daemon) Sync() error {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	// the subnet manager is listed before the pool is reset, so the pool isn't left without its guids on failure
+	usedGUIDs, err := d.listSubnetManagerGUIDs()
+	if err != nil {
+		return err
+	}
+	if err = d.guidPool.Reset(d.allocatedGUIDs()); err != nil {
+		return fmt.Errorf("failed to reset guid pool: %v", err)
+	}
+	return d.mergeSubnetManagerGUIDs(usedGUIDs)
+}
+
+// syncAllocatedGUIDPool merges the GUIDs in use by the subnet manager into the GUID pool. The GUIDs allocated by
+// the daemon are kept, including GUIDs of pods without pkey and GUIDs not added to their pkey yet, which aren't
+// known to the subnet manager. It's called with poolMutex held.
+func (d *daemon) syncAllocatedGUIDPool() error {
+	usedGUIDs, err := d.listSubnetManagerGUIDs()
+	if err != nil {
+		return err
+	}
+	return d.mergeSubnetManagerGUIDs(usedGUIDs)
+}
+
+// listSubnetManagerGUIDs returns the GUIDs in use by the subnet manager kept allocated by the conflict policy
+func (d *daemon) listSubnetManagerGUIDs() ([]string, error) {
+	d.countSMCall()
+	var usedGUIDs []string
+	err := d.callSubnetManager(func(ctx context.Context) (err error) {
+		usedGUIDs, err = d.smClient.ListGuidsInUse(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list guids in use with subnet manager %s: %v", d.smClient.Name(), err)
+	}
+	return d.resolveSMGUIDConflicts(normalizeGUIDs(usedGUIDs))
+}
+
+// normalizeGUIDs returns the guids in their canonical form, as the guids reported by subnet managers may be in
+// another case or format, invalid guids are kept as is
+func normalizeGUIDs(guids []string) []string {
+	normalized := make([]string, 0, len(guids))
+	for _, guidStr := range guids {
+		if normalizedGUID, err := ibUtils.NormalizeGUID(guidStr); err == nil {
+			guidStr = normalizedGUID
+		}
+		normalized = append(normalized, guidStr)
+	}
+	return normalized
+}
+
+// mergeSubnetManagerGUIDs merges the GUIDs in use by the subnet manager into the GUID pool, invalid GUIDs are
+// skipped
+func (d *daemon) mergeSubnetManagerGUIDs(usedGUIDs []string) error {
+	guids := make([]string, 0, len(usedGUIDs))
+	for _, guidStr := range usedGUIDs {
+		if _, err := guid.ParseGUID(guidStr); err != nil {
+			log.Warn().Msgf("skipping invalid guid %s: %v", guidStr, err)
+			continue
+		}
+		guids = append(guids, guidStr)
+	}
+
+	if err := d.guidPool.Sync(guids); err != nil {
+		return fmt.Errorf("failed to sync guid pool: %v", err)
+	}
+
+	log.Info().Msgf("guid pool synced with subnet manager %s, %d guids in use", d.smClient.Name(), len(guids))
+	return nil
+}
+
+// ExportGUIDs returns snapshot of the GUIDs allocated by the daemon with the pkeys of their networks
+// or reservations, sorted by GUID
+func (d *daemon) ExportGUIDs() (*guid.Snapshot, error) {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	reservationPKeys := make(map[string]string)
+	if d.config.EnableGUIDReservations {
+		reservations, err := d.kubeClient.GetGUIDReservations(kapi.NamespaceAll)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get guid reservations: %v", err)
+		}
+		for index := range reservations.Items {
+			reservationPKeys[string(reservations.Items[index].UID)] = reservations.Items[index].Status.PKey
+		}
+	}
+
+	networkPKeys := make(map[string]string)
+	allocations := make([]guid.SnapshotAllocation, 0, len(d.guidPodNetworkMap))
+	for allocatedGUID, key := range d.guidPodNetworkMap {
+		var pKey string
+		switch key.NetworkID {
+		case guidReservationNetworkID:
+			pKey = reservationPKeys[string(key.PodUID)]
+		case stableGUIDNetworkID:
+			// Stable guids of stopped StatefulSet replicas aren't members of any pkey
+		default:
+			pKey = d.getNetworkPKey(key.NetworkID, networkPKeys)
+		}
+		allocations = append(allocations, guid.SnapshotAllocation{GUID: allocatedGUID, PKey: pKey,
+			OwnerID: string(key.PodUID), NetworkID: key.NetworkID, Interface: key.Interface})
+	}
+	sort.Slice(allocations, func(i, j int) bool { return allocations[i].GUID < allocations[j].GUID })
+
+	log.Info().Msgf("exported guid pool snapshot of %d guids", len(allocations))
+	return guid.NewSnapshot(allocations), nil
+}
+
+// getNetworkPKey returns the pkey of the network, looked up once per network in networkPKeys.
+// It returns empty pkey if the network has none or can't be resolved.
+func (d *daemon) getNetworkPKey(networkID string, networkPKeys map[string]string) string {
+	if pKey, exist := networkPKeys[networkID]; exist {
+		return pKey
+	}
+
+	var pKey string
+	if _, ibCniSpec, err := d.getIbSriovNetwork(networkID); err != nil {
+		log.Warn().Msgf("exporting guids of network %s without pkey: %v", networkID, err)
+	} else {
+		pKey = ibCniSpec.PKey
+	}
+	networkPKeys[networkID] = pKey
+	return pKey
+}
+
+// ImportGUIDs restores the allocations of the snapshot which aren't allocated by the daemon, and adds the
+// GUIDs of the snapshot to their pkeys in the subnet manager. Allocations conflicting with the current
+// allocations are skipped and reported in the returned error.
+func (d *daemon) ImportGUIDs(snapshot *guid.Snapshot) error {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	var errs []error
+	restored := 0
+	pKeyGUIDs := make(map[string][]net.HardwareAddr)
+	limitedPartitionGUIDs := make(map[string][]net.HardwareAddr)
+	for _, allocation := range snapshot.Allocations {
+		key := utils.PodNetworkKey{
+			PodUID: types.UID(allocation.OwnerID), NetworkID: allocation.NetworkID, Interface: allocation.Interface}
+		allocatedGUID, err := ibUtils.NormalizeGUID(allocation.GUID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		_, allocated := d.guidPodNetworkMap[allocatedGUID]
+		if err = d.allocatePodNetworkGUID(allocatedGUID, key); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !allocated {
+			restored++
+		}
+
+		guidAddr, err := guid.ParseGUID(allocation.GUID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if allocation.PKey != "" {
+			pKeyGUIDs[allocation.PKey] = append(pKeyGUIDs[allocation.PKey], guidAddr.HardWareAddress())
+		}
+		if allocation.NetworkID != guidReservationNetworkID {
+			limitedPartitionGUIDs[allocation.PKey] = append(limitedPartitionGUIDs[allocation.PKey],
+				guidAddr.HardWareAddress())
+		}
+	}
+
+	for pKey, guids := range pKeyGUIDs {
+		if err := d.addGUIDsToPKey(pKey, guids); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for pKey, guids := range limitedPartitionGUIDs {
+		if err := d.addGUIDsToLimitedPartition(pKey, guids); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	log.Info().Msgf("imported guid pool snapshot taken at %s, restored %d of %d guids",
+		snapshot.Timestamp, restored, len(snapshot.Allocations))
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to import guid pool snapshot: %v", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (d *daemon) allocatedGUIDs() []string {
+	guids := make([]string, 0, len(d.guidPodNetworkMap))
+	for allocatedGUID := range d.guidPodNetworkMap {
+		guids = append(guids, allocatedGUID)
+	}
+	return guids
+}
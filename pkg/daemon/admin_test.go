@@ -0,0 +1,207 @@
+package daemon
+
+import (
+	"errors"
+	"net"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/webhook"
+)
+
+// recordingNotifier records the webhook events sent by the daemon
+type recordingNotifier struct {
+	events []*webhook.Event
+}
+
+func (r *recordingNotifier) Notify(event *webhook.Event) {
+	r.events = append(r.events, event)
+}
+
+func (r *recordingNotifier) Run(_ <-chan struct{}) {}
+
+var _ = Describe("Admin API Handler", func() {
+	const (
+		podGUID         = "02:00:00:00:00:00:00:01"
+		reservationGUID = "02:00:00:00:00:00:00:02"
+	)
+
+	var (
+		smClient  *smMocks.SubnetManagerClient
+		guidPool  guid.Pool
+		netAttDef *netapi.NetworkAttachmentDefinition
+		d         *daemon
+	)
+
+	BeforeEach(func() {
+		var err error
+		guidPool, err = guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+
+		netAttDef = &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"type": "ib-sriov", "cniVersion": "0.3.1", "name": "ib-net", "pkey": "0x5"}`}}
+
+		d = &daemon{
+			kubeClient:        k8sClientFake.NewClient(netAttDef),
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+		Expect(d.allocatePodNetworkGUID(podGUID,
+			utils.PodNetworkKey{PodUID: "pod-uid", NetworkID: "default_ib-net", Interface: "net1"})).To(Succeed())
+		Expect(d.allocatePodNetworkGUID(reservationGUID,
+			utils.PodNetworkKey{PodUID: "reservation-uid", NetworkID: guidReservationNetworkID})).To(Succeed())
+	})
+
+	It("List allocated guids", func() {
+		Expect(d.ListGUIDs()).To(Equal([]admin.GUIDAllocation{
+			{GUID: podGUID, PodUID: "pod-uid", NetworkID: "default_ib-net", Interface: "net1"},
+			{GUID: reservationGUID, PodUID: "reservation-uid", NetworkID: guidReservationNetworkID},
+		}))
+	})
+
+	It("Get guid pool stats", func() {
+		stats := d.PoolStats()
+		Expect(stats.Size).To(Equal(uint64(256)))
+		Expect(stats.Allocated).To(Equal(uint64(2)))
+		Expect(stats.Free).To(Equal(uint64(254)))
+	})
+
+	It("Release pod guid and remove it from the network pkey", func() {
+		guidAddr, err := net.ParseMAC(podGUID)
+		Expect(err).ToNot(HaveOccurred())
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr{guidAddr}).Return(nil)
+
+		notifier := &recordingNotifier{}
+		d.notifier = notifier
+
+		Expect(d.ReleaseGUID(podGUID)).To(Succeed())
+		smClient.AssertExpectations(GinkgoT())
+		Expect(notifier.events).To(HaveLen(2))
+		Expect(notifier.events[0].Type).To(Equal(webhook.PKeyMembersRemoved))
+		Expect(notifier.events[0].PKey).To(Equal("0x5"))
+		Expect(notifier.events[0].GUIDs).To(Equal([]string{podGUID}))
+		Expect(notifier.events[1].Type).To(Equal(webhook.GUIDReleased))
+		Expect(notifier.events[1].GUID).To(Equal(podGUID))
+		Expect(notifier.events[1].PodUID).To(Equal("pod-uid"))
+		Expect(notifier.events[1].Interface).To(Equal("net1"))
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(podGUID))
+		Expect(guidPool.AllocateGUID(podGUID)).To(Succeed())
+	})
+
+	It("Fail to release not allocated guid", func() {
+		err := d.ReleaseGUID("02:00:00:00:00:00:00:03")
+		Expect(errors.Is(err, admin.ErrGUIDNotFound)).To(BeTrue())
+	})
+
+	It("Release guids of existing pod and remove them from the network pkey", func() {
+		const otherGUID = "02:00:00:00:00:00:00:03"
+		Expect(d.allocatePodNetworkGUID(otherGUID,
+			utils.PodNetworkKey{PodUID: "pod-uid", NetworkID: "default_ib-net", Interface: "net2"})).To(Succeed())
+		d.kubeClient = k8sClientFake.NewClient(netAttDef, &kapi.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "pod-uid"}})
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Twice()
+
+		release, err := d.ReleasePod("default", "pod")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(release).To(Equal(&admin.PodRelease{Namespace: "default", Name: "pod", PodUID: "pod-uid",
+			GUIDs: []string{podGUID, otherGUID}}))
+		smClient.AssertExpectations(GinkgoT())
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(podGUID))
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(otherGUID))
+		Expect(d.guidPodNetworkMap).To(HaveKey(reservationGUID))
+	})
+
+	It("Fail to release not existing pod", func() {
+		_, err := d.ReleasePod("default", "pod")
+		Expect(errors.Is(err, admin.ErrPodNotFound)).To(BeTrue())
+		Expect(d.guidPodNetworkMap).To(HaveKey(podGUID))
+	})
+
+	It("Fail to release guid of guid reservation", func() {
+		Expect(d.ReleaseGUID(reservationGUID)).ToNot(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveKey(reservationGUID))
+	})
+
+	It("Sync pool with subnet manager and keep allocated guids", func() {
+		smClient.On("ListGuidsInUse", mock.Anything).Return([]string{"02:00:00:00:00:00:00:10", podGUID}, nil)
+
+		Expect(d.Sync()).To(Succeed())
+		for _, allocated := range []string{"02:00:00:00:00:00:00:10", podGUID, reservationGUID} {
+			Expect(guidPool.AllocateGUID(allocated)).ToNot(Succeed())
+		}
+		Expect(guidPool.AllocateGUID("02:00:00:00:00:00:00:11")).To(Succeed())
+	})
+
+	It("Keep guids not added to their pkey yet when merging subnet manager guids", func() {
+		smClient.On("ListGuidsInUse", mock.Anything).Return([]string{"02:00:00:00:00:00:00:10"}, nil).Once()
+		Expect(d.syncAllocatedGUIDPool()).To(Succeed())
+		Expect(guidPool.Stats().Allocated).To(Equal(uint64(3)))
+
+		smClient.On("ListGuidsInUse", mock.Anything).Return([]string{}, nil).Once()
+		Expect(d.syncAllocatedGUIDPool()).To(Succeed())
+		for _, allocated := range []string{podGUID, reservationGUID} {
+			Expect(guidPool.AllocateGUID(allocated)).ToNot(Succeed())
+		}
+		Expect(guidPool.AllocateGUID("02:00:00:00:00:00:00:10")).To(Succeed())
+	})
+
+	It("Export allocated guids with their pkeys", func() {
+		snapshot, err := d.ExportGUIDs()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(snapshot.Version).To(Equal(guid.SnapshotVersion))
+		Expect(snapshot.Allocations).To(Equal([]guid.SnapshotAllocation{
+			{GUID: podGUID, PKey: "0x5", OwnerID: "pod-uid", NetworkID: "default_ib-net", Interface: "net1"},
+			{GUID: reservationGUID, OwnerID: "reservation-uid", NetworkID: guidReservationNetworkID},
+		}))
+	})
+
+	It("Import snapshot restores allocations and pkey membership", func() {
+		const restoredGUID = "02:00:00:00:00:00:00:03"
+		snapshot, err := d.ExportGUIDs()
+		Expect(err).ToNot(HaveOccurred())
+		snapshot.Allocations = append(snapshot.Allocations, guid.SnapshotAllocation{
+			GUID: restoredGUID, PKey: "0x5", OwnerID: "restored-uid", NetworkID: "default_ib-net"})
+
+		podGUIDAddr, err := net.ParseMAC(podGUID)
+		Expect(err).ToNot(HaveOccurred())
+		restoredGUIDAddr, err := net.ParseMAC(restoredGUID)
+		Expect(err).ToNot(HaveOccurred())
+		guids := []net.HardwareAddr{podGUIDAddr, restoredGUIDAddr}
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, guids).Return(nil)
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(guids, nil)
+
+		Expect(d.ImportGUIDs(snapshot)).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(restoredGUID,
+			utils.PodNetworkKey{PodUID: "restored-uid", NetworkID: "default_ib-net"}))
+		Expect(d.guidPool.AllocateGUID(restoredGUID)).ToNot(Succeed())
+		smClient.AssertExpectations(GinkgoT())
+	})
+
+	It("Import snapshot skips allocations conflicting with current allocations", func() {
+		snapshot := guid.NewSnapshot([]guid.SnapshotAllocation{
+			{GUID: podGUID, OwnerID: "other-uid", NetworkID: "default_ib-net"}})
+
+		err := d.ImportGUIDs(snapshot)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("already allocated"))
+		Expect(d.guidPodNetworkMap[podGUID].PodUID).To(BeEquivalentTo("pod-uid"))
+	})
+})
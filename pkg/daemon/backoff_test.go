@@ -0,0 +1,21 @@
+package daemon
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+)
+
+var _ = Describe("Backoff", func() {
+	It("Use the default backoff when the operation class isn't configured", func() {
+		Expect(newBackoff(config.BackoffConfig{})).To(Equal(backoffValues))
+	})
+	It("Use the backoff configured for the operation class", func() {
+		Expect(newBackoff(config.BackoffConfig{Duration: 100 * time.Millisecond, Factor: 2, Steps: 3})).To(Equal(
+			wait.Backoff{Duration: 100 * time.Millisecond, Factor: 2, Steps: 3}))
+	})
+})
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+	"github.com/Mellanox/ib-kubernetes/pkg/pkey"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm"
+)
+
+// CheckConfig validates the daemon configuration without running the daemon: the configuration is read and
+// validated, the guid and pkey ranges are parsed, and the subnet manager plugin is loaded and validated once. The
+// kubernetes api is only used to read the configuration from the NicClusterPolicy if it is the configuration source.
+// It's meant for init containers and CI pipelines validating a deployment before it is rolled out.
+func CheckConfig() error {
+	daemonConfig := config.DaemonConfig{}
+	if err := daemonConfig.ReadConfig(); err != nil {
+		return err
+	}
+
+	var client config.NicClusterPolicyClient
+	if daemonConfig.ConfigSource == config.ConfigSourceNicClusterPolicy {
+		k8sclient, err := k8sClient.NewK8sClient(daemonConfig.K8sClientQPS, daemonConfig.K8sClientBurst)
+		if err != nil {
+			return err
+		}
+		client = k8sclient
+	}
+	if err := loadConfig(&daemonConfig, client); err != nil {
+		return err
+	}
+	return checkConfig(&daemonConfig, sm.NewPluginLoader())
+}
+
+// loadConfig loads the daemon configuration from its configuration source over the configuration read from the
+// environment variables and validates it
+func loadConfig(daemonConfig *config.DaemonConfig, client config.NicClusterPolicyClient) error {
+	configProvider, err := config.NewProvider(daemonConfig, client)
+	if err != nil {
+		return err
+	}
+	if err = configProvider.Load(daemonConfig); err != nil {
+		return err
+	}
+	log.Info().Msgf("configuration loaded from %s", configProvider.Name())
+
+	return daemonConfig.ValidateConfig()
+}
+
+// checkConfig parses the guid and pkey ranges of the validated configuration, and loads and validates the subnet
+// manager plugin
+func checkConfig(daemonConfig *config.DaemonConfig, pluginLoader sm.PluginLoader) error {
+	if _, err := guid.NewPool(&daemonConfig.GUIDPool); err != nil {
+		return fmt.Errorf("invalid guid pool: %v", err)
+	}
+	if _, err := guid.ParseNodeRanges(&daemonConfig.GUIDPool); err != nil {
+		return fmt.Errorf("invalid guid pool node ranges: %v", err)
+	}
+	if daemonConfig.PKeyPool.RangeStart != "" {
+		if _, err := pkey.NewPool(&daemonConfig.PKeyPool); err != nil {
+			return fmt.Errorf("invalid pkey pool: %v", err)
+		}
+	}
+
+	smClient, err := loadSubnetManagerClient(pluginLoader, daemonConfig.PluginPath, daemonConfig.Plugin)
+	if err != nil {
+		return fmt.Errorf("failed to load subnet manager plugin %s: %v", daemonConfig.Plugin, err)
+	}
+	if err = callWithTimeout(context.Background(), daemonConfig.SMTimeout, smClient.Validate); err != nil {
+		return fmt.Errorf("failed to validate subnet manager %s: %v", smClient.Name(), err)
+	}
+	log.Info().Msgf("configuration is valid, subnet manager %s is reachable", smClient.Name())
+	return nil
+}
@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+)
+
+var _ = Describe("Check Config", func() {
+	var (
+		smClient     *smMocks.SubnetManagerClient
+		loader       *fakePluginLoader
+		daemonConfig *config.DaemonConfig
+	)
+
+	BeforeEach(func() {
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("ufm").Maybe()
+		smClient.On("Spec").Return("2.0").Maybe()
+		loader = &fakePluginLoader{clients: map[string]plugins.SubnetManagerClient{"/plugins/ufm.so": smClient}}
+		daemonConfig = &config.DaemonConfig{PeriodicUpdate: 5, Plugin: "ufm", PluginPath: "/plugins",
+			GUIDPool: config.GUIDPoolConfig{RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:FF:FF:FF:FF:FF:FF:FF"}}
+	})
+
+	It("Accept valid configuration with reachable subnet manager", func() {
+		smClient.On("Validate", mock.Anything).Return(nil)
+		Expect(checkConfig(daemonConfig, loader)).To(Succeed())
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Reject invalid guid and pkey ranges", func() {
+		daemonConfig.GUIDPool.RangeEnd = "01:00:00:00:00:00:00:00"
+		Expect(checkConfig(daemonConfig, loader)).To(MatchError(ContainSubstring("invalid guid pool")))
+
+		daemonConfig.GUIDPool.RangeEnd = "02:FF:FF:FF:FF:FF:FF:FF"
+		daemonConfig.PKeyPool = config.PKeyPoolConfig{RangeStart: "0x200", RangeEnd: "0x100"}
+		Expect(checkConfig(daemonConfig, loader)).To(MatchError(ContainSubstring("invalid pkey pool")))
+	})
+	It("Reject missing plugin and unreachable subnet manager", func() {
+		daemonConfig.Plugin = "rest"
+		Expect(checkConfig(daemonConfig, loader)).To(MatchError(ContainSubstring("failed to load")))
+
+		daemonConfig.Plugin = "ufm"
+		smClient.On("Validate", mock.Anything).Return(errors.New("connection refused"))
+		Expect(checkConfig(daemonConfig, loader)).To(MatchError(ContainSubstring("connection refused")))
+	})
+})
@@ -0,0 +1,313 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	ctrlWebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/validation"
+)
+
+// leaderElectionID is the name of the lease held by the active daemon replica
+const leaderElectionID = "ib-kubernetes-leader"
+
+// networkReconciler keeps the cached ib-sriov specs of the network attachment definitions up to date and drains
+// the networks annotated as not managed
+type networkReconciler struct {
+	reader client.Reader
+	d      *daemon
+}
+
+// Reconcile parses the spec of the updated network so it is cached before its pods are processed, drains the
+// network when it is annotated as not managed, and drops the cached spec and releases the pkey of a deleted network.
+// The pods which configuration of the network is pending are queued to the pod reconciler.
+func (r *networkReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	networkID := ibTypes.NewNetworkID(req.Namespace, req.Name).String()
+	netAttDef := &netapi.NetworkAttachmentDefinition{}
+	if err := r.reader.Get(ctx, req.NamespacedName, netAttDef); err != nil {
+		if kerrors.IsNotFound(err) {
+			log.Debug().Msgf("network %s deleted, dropping its cached spec", networkID)
+			r.d.invalidateNetworkAttachmentSpec(networkID)
+			r.d.releaseNetworkPKey(networkID)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if _, err := r.d.parseNetworkAttachmentSpec(netAttDef); err != nil {
+		// networks of other cni types aren't cached
+		log.Debug().Msgf("network %s is not cached: %v", networkID, err)
+		r.d.invalidateNetworkAttachmentSpec(networkID)
+		return reconcile.Result{}, nil
+	}
+
+	// a network annotated as not managed is drained of the guids of its pods, failed drains are requeued
+	if !utils.NetworkIsManaged(netAttDef) {
+		if r.d.hasNetworkGUIDs(networkID) {
+			log.Info().Msgf("network %s is annotated as not managed, draining it", networkID)
+			if _, err := r.d.DrainNetwork(networkID); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+		return reconcile.Result{}, nil
+	}
+
+	if r.d.config.ValidateNetworkResources {
+		r.validateNetworkResource(ctx, netAttDef)
+	}
+	r.d.enqueueNetworkPods(networkID)
+	return reconcile.Result{}, nil
+}
+
+// newScheme returns the scheme of the resources reconciled by the daemon
+func newScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := netapi.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return scheme, nil
+}
+
+// newManager creates the controller manager running the daemon reconcilers and periodic updates. Only the
+// leader elected replica runs them when leader election is enabled.
+func (d *daemon) newManager(restConfig *rest.Config) (manager.Manager, error) {
+	scheme, err := newScheme()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheme: %v", err)
+	}
+
+	options := ctrl.Options{
+		Scheme:                  scheme,
+		LeaderElection:          d.config.LeaderElection,
+		LeaderElectionID:        leaderElectionID,
+		LeaderElectionNamespace: d.config.LeaderElectionNamespace,
+		// controller metrics are served with the daemon metrics
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+		Cache:                  d.cacheOptions(),
+	}
+	if d.config.LeaderElection {
+		if options.LeaderElectionResourceLockInterface, err = newLeaderElectionLock(restConfig,
+			d.config.LeaderElectionNamespace, d.kubeClient); err != nil {
+			return nil, err
+		}
+	}
+	if d.config.NADWebhookPort != 0 {
+		options.WebhookServer = ctrlWebhook.NewServer(ctrlWebhook.Options{Port: d.config.NADWebhookPort,
+			CertDir: d.config.NADWebhookCertDir})
+	}
+	mgr, err := ctrl.NewManager(restConfig, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create controller manager: %v", err)
+	}
+
+	// the networks are read from the informer cache of the network controller
+	d.nadReader = mgr.GetCache()
+	if d.config.WarmPool {
+		d.workloadReader = mgr.GetCache()
+	}
+	if err = d.setupControllers(mgr); err != nil {
+		return nil, err
+	}
+	if err = d.setupWebhooks(mgr); err != nil {
+		return nil, err
+	}
+	if err = mgr.Add(manager.RunnableFunc(d.runPeriodicUpdates)); err != nil {
+		return nil, fmt.Errorf("failed to add periodic updates to controller manager: %v", err)
+	}
+	if d.config.LeaderElection && d.config.WarmStandby {
+		var informer cache.Informer
+		if informer, err = mgr.GetCache().GetInformer(context.Background(), &kapi.Pod{}); err != nil {
+			return nil, fmt.Errorf("failed to get pod informer: %v", err)
+		}
+		if err = mgr.Add(&warmStandby{informer: informer, d: d}); err != nil {
+			return nil, fmt.Errorf("failed to add warm standby to controller manager: %v", err)
+		}
+	}
+	return mgr, nil
+}
+
+// cacheOptions returns the options of the manager informer cache, in node-local mode only the pods bound to the
+// node are watched
+func (d *daemon) cacheOptions() cache.Options {
+	if !d.config.NodeLocal {
+		return cache.Options{}
+	}
+	return cache.Options{ByObject: map[client.Object]cache.ByObject{
+		&kapi.Pod{}: {Field: fields.OneTermEqualSelector(k8sClient.PodNodeNameField, d.config.NodeName)}}}
+}
+
+// setupControllers registers the pod, network attachment definition, namespace and node reconcilers with the
+// manager. The pods are queued by priority, and are also queued by the network reconciler and the node failure
+// periodic update through podEvents. The pods are reconciled concurrently, their pkey writes run with poolMutex
+// released, in parallel across pkeys.
+func (d *daemon) setupControllers(mgr manager.Manager) error {
+	d.podEvents = make(chan event.GenericEvent)
+	if err := ctrl.NewControllerManagedBy(mgr).Named("pod").For(&kapi.Pod{}).
+		WatchesRawSource(source.Channel(d.podEvents, &handler.EnqueueRequestForObject{})).
+		WithOptions(controller.Options{NewQueue: newPodWorkqueue(mgr.GetClient()),
+			MaxConcurrentReconciles: pKeyWriteWorkers}).
+		Complete(&podReconciler{reader: mgr.GetClient(), d: d}); err != nil {
+		return fmt.Errorf("failed to create pod controller: %v", err)
+	}
+
+	if err := ctrl.NewControllerManagedBy(mgr).Named("network-attachment-definition").
+		For(&netapi.NetworkAttachmentDefinition{}).
+		Complete(&networkReconciler{reader: mgr.GetClient(), d: d}); err != nil {
+		return fmt.Errorf("failed to create network attachment definition controller: %v", err)
+	}
+
+	if d.config.NamespaceCleanup {
+		if err := ctrl.NewControllerManagedBy(mgr).Named("namespace").For(&kapi.Namespace{}).
+			Complete(&namespaceReconciler{reader: mgr.GetClient(), d: d}); err != nil {
+			return fmt.Errorf("failed to create namespace controller: %v", err)
+		}
+	}
+
+	if d.nodeFailures != nil {
+		if err := ctrl.NewControllerManagedBy(mgr).Named("node").For(&kapi.Node{}).
+			Complete(&nodeReconciler{reader: mgr.GetClient(), failures: d.nodeFailures}); err != nil {
+			return fmt.Errorf("failed to create node controller: %v", err)
+		}
+	}
+	return nil
+}
+
+// setupWebhooks registers the validating webhook of the ib-sriov network attachment definitions if enabled.
+// The webhook server runs in all the replicas, not only in the leader.
+func (d *daemon) setupWebhooks(mgr manager.Manager) error {
+	if d.config.NADWebhookPort == 0 {
+		return nil
+	}
+
+	validator := &validation.NetworkAttachmentDefinitionValidator{AutoPKey: d.pKeyPool != nil}
+	if err := ctrl.NewWebhookManagedBy(mgr).For(&netapi.NetworkAttachmentDefinition{}).
+		WithValidator(validator).Complete(); err != nil {
+		return fmt.Errorf("failed to create network attachment definition webhook: %v", err)
+	}
+	return nil
+}
+
+// periodicUpdate is a periodic loop of the daemon with its interval and jitter
+type periodicUpdate struct {
+	run    func()
+	period time.Duration
+	jitter float64
+}
+
+// newPeriodicUpdate returns the periodic loop running the update, with the interval and jitter of the loop
+// configuration or the periodic update ones if unset
+func (d *daemon) newPeriodicUpdate(update func(), loop config.PeriodicLoopConfig) periodicUpdate {
+	period, jitter := d.config.LoopPeriod(loop)
+	return periodicUpdate{run: update, period: period, jitter: jitter}
+}
+
+// runPeriodicUpdates initializes the guid pool, stable guids and pkey pool, lets the pod reconciler process the
+// pods, then runs the periodic updates until the context is done. It runs once the replica is elected as leader,
+// so the pools are initialized from the pods configured by the previous leader.
+func (d *daemon) runPeriodicUpdates(ctx context.Context) error {
+	if err := d.initPool(); err != nil {
+		return fmt.Errorf("initPool(): Daemon could not init the guid pool: %v", err)
+	}
+	if err := d.initWarmGUIDs(); err != nil {
+		return fmt.Errorf("initWarmGUIDs(): Daemon could not load the warm guids: %v", err)
+	}
+	if err := d.initAdoptedPKeyMembers(); err != nil {
+		return fmt.Errorf("initAdoptedPKeyMembers(): Daemon could not adopt the pkey members: %v", err)
+	}
+	if err := d.initStalePKeyMembers(); err != nil {
+		return fmt.Errorf("initStalePKeyMembers(): Daemon could not remove the stale pkey members: %v", err)
+	}
+	if err := d.initSubnetManagerGUIDs(); err != nil {
+		return fmt.Errorf("initSubnetManagerGUIDs(): Daemon could not sync the guid pool: %v", err)
+	}
+	if err := d.initStableGUIDs(); err != nil {
+		return fmt.Errorf("initStableGUIDs(): Daemon could not load the stable guids: %v", err)
+	}
+	if err := d.initPKeyPool(); err != nil {
+		return fmt.Errorf("initPKeyPool(): Daemon could not init the pkey pool: %v", err)
+	}
+
+	if d.notifier != nil {
+		go d.notifier.Run(ctx.Done())
+	}
+
+	d.poolMutex.Lock()
+	d.startCycleSummary(reconcileCycle)
+	d.poolMutex.Unlock()
+	if d.ready != nil {
+		close(d.ready)
+	}
+
+	updates := []periodicUpdate{d.newPeriodicUpdate(d.ReconcilePeriodicUpdate, config.PeriodicLoopConfig{})}
+	if d.config.EnableGUIDReservations {
+		updates = append(updates, d.newPeriodicUpdate(d.GUIDReservationPeriodicUpdate, config.PeriodicLoopConfig{}))
+	}
+	if d.nodeFailures != nil {
+		updates = append(updates, d.newPeriodicUpdate(d.NodeFailurePeriodicUpdate, config.PeriodicLoopConfig{}))
+	}
+	if d.config.WarmPool {
+		updates = append(updates, d.newPeriodicUpdate(d.WarmPoolPeriodicUpdate, config.PeriodicLoopConfig{}))
+	}
+	if d.config.GUIDExtendedResource {
+		updates = append(updates, d.newPeriodicUpdate(d.GUIDResourcePeriodicUpdate, config.PeriodicLoopConfig{}))
+	}
+	if d.config.FabricAuditInterval > 0 {
+		updates = append(updates, d.newPeriodicUpdate(d.FabricAuditPeriodicUpdate,
+			config.PeriodicLoopConfig{Interval: d.config.FabricAuditInterval}))
+	}
+
+	var wg sync.WaitGroup
+	for _, update := range updates {
+		wg.Add(1)
+		go func(update periodicUpdate) {
+			defer wg.Done()
+			// the wait is sliding, so the jittered waits of the loops keep drifting apart
+			wait.JitterUntil(update.run, update.period, update.jitter, true, ctx.Done())
+		}(update)
+	}
+	wg.Wait()
+	return nil
+}
+
+// ReconcilePeriodicUpdate validates the subnet manager again after a degraded start, reports the pod backlog and
+// the summary of the reconciles since its previous run, and drops the cached networks of the pods which weren't
+// reconciled since
+func (d *daemon) ReconcilePeriodicUpdate() {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	d.subnetManagerAvailable()
+	d.reportPodBacklog(time.Now())
+	d.finishCycleSummary()
+	d.startCycleSummary(reconcileCycle)
+	d.podNetworks.Prune()
+}
@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Controllers", func() {
+	var (
+		ctx     context.Context
+		fakeCli client.Client
+		request reconcile.Request
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		fakeCli = ctrlFake.NewClientBuilder().WithScheme(scheme).Build()
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "test"}}
+	})
+
+	Context("Network reconciler", func() {
+		It("Cache spec of updated network and drop it on deletion", func() {
+			netAttDef := &netapi.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec: netapi.NetworkAttachmentDefinitionSpec{
+					Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x5"}`}}
+			Expect(fakeCli.Create(ctx, netAttDef)).To(Succeed())
+			d := &daemon{nadSpecs: utils.NewSynchronizedMap()}
+			reconciler := &networkReconciler{reader: fakeCli, d: d}
+
+			_, err := reconciler.Reconcile(ctx, request)
+			Expect(err).ToNot(HaveOccurred())
+			cached, exist := d.nadSpecs.Get("default_test")
+			Expect(exist).To(BeTrue())
+			Expect(cached.(*nadSpec).spec.PKey).To(Equal("0x5"))
+
+			Expect(fakeCli.Delete(ctx, netAttDef)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, request)
+			Expect(err).ToNot(HaveOccurred())
+			_, exist = d.nadSpecs.Get("default_test")
+			Expect(exist).To(BeFalse())
+		})
+		It("Don't cache network of other cni types", func() {
+			netAttDef := &netapi.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       netapi.NetworkAttachmentDefinitionSpec{Config: `{"cniVersion": "0.3.1", "type": "macvlan"}`}}
+			Expect(fakeCli.Create(ctx, netAttDef)).To(Succeed())
+			d := &daemon{nadSpecs: utils.NewSynchronizedMap()}
+			reconciler := &networkReconciler{reader: fakeCli, d: d}
+
+			_, err := reconciler.Reconcile(ctx, request)
+			Expect(err).ToNot(HaveOccurred())
+			_, exist := d.nadSpecs.Get("default_test")
+			Expect(exist).To(BeFalse())
+		})
+	})
+	Context("Cache options", func() {
+		It("Watch only the pods of the node in node-local mode", func() {
+			d := &daemon{}
+			Expect(d.cacheOptions().ByObject).To(BeEmpty())
+
+			d.config = config.DaemonConfig{NodeLocal: true, NodeName: "node1"}
+			byObject := d.cacheOptions().ByObject
+			Expect(byObject).To(HaveLen(1))
+			for object, options := range byObject {
+				Expect(object).To(BeAssignableToTypeOf(&kapi.Pod{}))
+				Expect(options.Field.String()).To(Equal("spec.nodeName=node1"))
+			}
+		})
+	})
+	Context("Metrics", func() {
+		It("Serve the daemon and controller metrics together", func() {
+			recorder := httptest.NewRecorder()
+			metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(ContainSubstring("go_goroutines"))
+			Expect(recorder.Body.String()).To(ContainSubstring("ib_kubernetes_"))
+		})
+	})
+})
@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// cycleSummaryEventReason is the reason of the events recording the summary of the reconciles
+	cycleSummaryEventReason = "ReconciliationSummary"
+	// reconcileCycle is the cycle of the summary of the pod reconciles, reported every periodic update interval
+	reconcileCycle = "reconcile"
+)
+
+// cycleSummary counts the work done by the reconciles of an interval, it's logged as a single entry when the
+// interval ends. Its methods are safe to call on a nil summary, so the counted paths needn't check if a summary is
+// started.
+type cycleSummary struct {
+	Cycle          string `json:"cycle"`
+	Networks       int    `json:"networks"`
+	PodsConfigured int    `json:"podsConfigured"`
+	GUIDsAllocated int    `json:"guidsAllocated"`
+	GUIDsReleased  int    `json:"guidsReleased"`
+	SMCalls        int    `json:"smCalls"`
+	Failures       int    `json:"failures"`
+	DurationMs     int64  `json:"durationMs"`
+	start          time.Time
+}
+
+func (s *cycleSummary) networkProcessed() {
+	if s != nil {
+		s.Networks++
+	}
+}
+
+func (s *cycleSummary) podConfigured() {
+	if s != nil {
+		s.PodsConfigured++
+	}
+}
+
+func (s *cycleSummary) guidAllocated() {
+	if s != nil {
+		s.GUIDsAllocated++
+	}
+}
+
+func (s *cycleSummary) guidReleased() {
+	if s != nil {
+		s.GUIDsReleased++
+	}
+}
+
+func (s *cycleSummary) smCall() {
+	if s != nil {
+		s.SMCalls++
+	}
+}
+
+func (s *cycleSummary) failure() {
+	if s != nil {
+		s.Failures++
+	}
+}
+
+// idle returns true if the reconciles of the interval had nothing to process
+func (s *cycleSummary) idle() bool {
+	return s.Networks == 0 && s.GUIDsReleased == 0 && s.SMCalls == 0 && s.Failures == 0
+}
+
+// countSMCall counts a subnet manager call in the summary, it may be called with poolMutex released
+func (d *daemon) countSMCall() {
+	d.summaryMutex.Lock()
+	d.summary.smCall()
+	d.summaryMutex.Unlock()
+}
+
+// startCycleSummary starts counting the work of the named cycle, it's called with poolMutex held
+func (d *daemon) startCycleSummary(cycle string) {
+	d.summaryMutex.Lock()
+	d.summary = &cycleSummary{Cycle: cycle, start: time.Now()}
+	d.summaryMutex.Unlock()
+}
+
+// finishCycleSummary logs the summary of the cycle as a single JSON entry and records it as an event on the daemon
+// pod if enabled. Idle cycles aren't recorded as events. It's called with poolMutex held.
+func (d *daemon) finishCycleSummary() {
+	d.summaryMutex.Lock()
+	summary := d.summary
+	d.summary = nil
+	d.summaryMutex.Unlock()
+	if summary == nil {
+		return
+	}
+	summary.DurationMs = time.Since(summary.start).Milliseconds()
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		log.Warn().Msgf("failed to marshal %s summary: %v", summary.Cycle, err)
+		return
+	}
+	log.Info().RawJSON("summary", data).Msgf("%s summary", summary.Cycle)
+
+	if !d.config.SummaryEvents || summary.idle() {
+		return
+	}
+	eventType := kapi.EventTypeNormal
+	if summary.Failures != 0 {
+		eventType = kapi.EventTypeWarning
+	}
+	daemonPod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: d.config.PodName, Namespace: d.config.PodNamespace}}
+	if err := d.kubeClient.CreatePodEvent(daemonPod, eventType, cycleSummaryEventReason, string(data)); err != nil {
+		log.Warn().Msgf("failed to record %s summary event: %v", summary.Cycle, err)
+	}
+}
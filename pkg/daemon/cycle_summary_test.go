@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	kapi "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sMocks "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/mocks"
+)
+
+var _ = Describe("Cycle Summary", func() {
+	var (
+		kubeClient *k8sMocks.Client
+		d          *daemon
+	)
+
+	BeforeEach(func() {
+		kubeClient = &k8sMocks.Client{}
+		d = &daemon{
+			config: config.DaemonConfig{SummaryEvents: true, PodName: "ib-kubernetes-0",
+				PodNamespace: "kube-system"},
+			kubeClient: kubeClient,
+		}
+	})
+
+	It("Count the work outside of periodic updates without a summary", func() {
+		var summary *cycleSummary
+		Expect(func() {
+			summary.networkProcessed()
+			summary.podConfigured()
+			summary.guidAllocated()
+			summary.guidReleased()
+			summary.smCall()
+			summary.failure()
+		}).ToNot(Panic())
+		d.finishCycleSummary()
+		kubeClient.AssertNotCalled(GinkgoT(), "CreatePodEvent", mock.Anything, mock.Anything, mock.Anything,
+			mock.Anything)
+	})
+	It("Record the summary as an event on the daemon pod", func() {
+		var message string
+		kubeClient.On("CreatePodEvent", mock.MatchedBy(func(pod *kapi.Pod) bool {
+			return pod.Name == "ib-kubernetes-0" && pod.Namespace == "kube-system"
+		}), kapi.EventTypeWarning, cycleSummaryEventReason, mock.Anything).Run(func(args mock.Arguments) {
+			message = args.String(3)
+		}).Return(nil)
+
+		d.startCycleSummary("add")
+		d.summary.networkProcessed()
+		d.summary.guidAllocated()
+		d.summary.guidAllocated()
+		d.summary.smCall()
+		d.summary.podConfigured()
+		d.summary.failure()
+		d.finishCycleSummary()
+		Expect(d.summary).To(BeNil())
+
+		summary := &cycleSummary{}
+		Expect(json.Unmarshal([]byte(message), summary)).To(Succeed())
+		Expect(summary.Cycle).To(Equal("add"))
+		Expect(summary.Networks).To(Equal(1))
+		Expect(summary.GUIDsAllocated).To(Equal(2))
+		Expect(summary.SMCalls).To(Equal(1))
+		Expect(summary.PodsConfigured).To(Equal(1))
+		Expect(summary.Failures).To(Equal(1))
+		kubeClient.AssertExpectations(GinkgoT())
+	})
+	It("Skip the event of idle periodic updates or when disabled", func() {
+		d.startCycleSummary("delete")
+		d.finishCycleSummary()
+
+		d.config.SummaryEvents = false
+		d.startCycleSummary("add")
+		d.summary.networkProcessed()
+		d.finishCycleSummary()
+		kubeClient.AssertNotCalled(GinkgoT(), "CreatePodEvent", mock.Anything, mock.Anything, mock.Anything,
+			mock.Anything)
+	})
+})
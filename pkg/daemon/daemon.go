@@ -1,31 +1,44 @@
 package daemon
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
-	"path"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
-	netAttUtils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 	kapi "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
-
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlConfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	"github.com/Mellanox/ib-kubernetes/pkg/api"
 	"github.com/Mellanox/ib-kubernetes/pkg/config"
 	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
 	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/pkey"
 	"github.com/Mellanox/ib-kubernetes/pkg/sm"
 	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/tracing"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
 	"github.com/Mellanox/ib-kubernetes/pkg/utils"
-	"github.com/Mellanox/ib-kubernetes/pkg/watcher"
-	resEvenHandler "github.com/Mellanox/ib-kubernetes/pkg/watcher/handler"
+	"github.com/Mellanox/ib-kubernetes/pkg/webhook"
 )
 
 type Daemon interface {
@@ -34,24 +47,116 @@ type Daemon interface {
 }
 
 type daemon struct {
-	config            config.DaemonConfig
-	watcher           watcher.Watcher
-	kubeClient        k8sClient.Client
-	guidPool          guid.Pool
+	config config.DaemonConfig
+	// podNetworks caches the parsed network annotations of the pods reconciled by the pod reconciler
+	podNetworks      *utils.PodNetworksCache
+	kubeClient       k8sClient.Client
+	annotationWriter k8sClient.AnnotationWriter
+	guidPool         guid.Pool
+	// nodeGUIDRanges maps node label value to the sub-range of the pool, nil if node sub-ranges are disabled
+	nodeGUIDRanges    map[string]guid.Range
 	smClient          plugins.SubnetManagerClient
-	guidPodNetworkMap map[string]string // allocated guid mapped to the pod and network
+	pluginLoader      sm.PluginLoader
+	guidPodNetworkMap map[string]utils.PodNetworkKey // allocated guid mapped to the pod network interface
+	// podInstances maps the pod names to the instances the daemon configured or allocated guids for, accessed with
+	// poolMutex held
+	podInstances map[types.NamespacedName][]*podInstance
+	// podEvents queues pods to the pod reconciler, nil until the pod controller is set up
+	podEvents chan event.GenericEvent
+	// ready is closed once the guid pool is initialized, the pods are reconciled only then
+	ready chan struct{}
+	// nodeFailures records the NotReady and deleted nodes, nil if node failure detection is disabled
+	nodeFailures *nodeFailures
+	failedNodes  map[string]bool // nodes NotReady for longer than the grace period
+	// deletedPodsSeen maps deleted pod network to the time its removal was first held by the pod reconciler
+	deletedPodsSeen map[ibTypes.PodNetworkID]time.Time
+	// podFlaps maps pod network to the last time the pod was added again while its deletion was pending
+	podFlaps map[ibTypes.PodNetworkID]time.Time
+	// backlogSince maps the pod networks pending addition or deletion to the time they were first held or failed,
+	// accessed with poolMutex held
+	backlogSince map[backlogItem]time.Time
+	// annotationRetries maps pods which annotation write failed to the number of failed writes, their guids are
+	// kept allocated while the write is retried by the pod reconciler
+	annotationRetries map[types.UID]int
+	notifier          webhook.Notifier // nil if no webhooks are configured
+	pKeyPool          pkey.Pool        // nil if automatic pkey allocation is disabled
+	// networkPKeys maps the resolved networks to their pkey the pkey members are counted with, accessed with
+	// poolMutex held
+	networkPKeys map[string]int
+	// adoptedGUIDs holds the pkey members adopted on startup which pod networks aren't configured yet, they aren't
+	// added to their pkey again, accessed with poolMutex held
+	adoptedGUIDs map[string]bool
+	// pKeyWorkers runs the subnet manager writes one at a time per pkey, nil runs them in the calling goroutine
+	pKeyWorkers *utils.KeyedWorkerPool
+	// pKeyMutex guards pKeyPool accessed when resolving networks
+	pKeyMutex sync.Mutex
+	// stableGUIDs maps StatefulSet replica identity to its stable guid, nil if stable guids are disabled
+	stableGUIDs map[string]string
+	// stableGUIDsChanged is set when stableGUIDs changed since they were last saved to the config map
+	stableGUIDsChanged bool
+	// nadSpecs caches the parsed ib-sriov spec of networks by resource version, nil if caching is disabled
+	nadSpecs *utils.SynchronizedMap
+	// smUnavailable is set while the subnet manager wasn't validated since degraded start
+	smUnavailable bool
+	// leading is set once the replica runs the reconcilers, standbyWarm is set once the warm standby
+	// allocated the guids of the running pods before the replica was elected
+	leading     bool
+	standbyWarm bool
+	// summary counts the work of the reconcilers since the summary was last reported, nil until the pool is
+	// initialized
+	summary *cycleSummary
+	// summaryMutex guards the summary subnet manager calls, counted by the pkey writes run with poolMutex released
+	summaryMutex sync.Mutex
+	// reportedDuplicates holds the duplicated guids already reported by the fabric audit, by kind and guid
+	reportedDuplicates map[string]bool
+	// manager runs the pod, network and node reconcilers and the periodic updates
+	manager manager.Manager
+	// nadReader reads network attachment definitions from the informer cache of the network controller, nil
+	// reads them from the api server
+	nadReader client.Reader
+	// workloadReader lists the workloads and pods of the warm pool from the informer cache, nil if the warm pool
+	// is disabled
+	workloadReader client.Reader
+	// warmGUIDs maps the workload network keys to the guids pre-allocated for their expected pods
+	warmGUIDs map[utils.PodNetworkKey][]string
+	// savedWarmGUIDs holds the warm guids as last saved to the config map, keyed by guid
+	savedWarmGUIDs map[string]string
+	// terminatingNamespaces holds the pods and network pkeys recorded of the terminating namespaces, which guids
+	// are cleaned up once the namespaces are deleted
+	terminatingNamespaces map[string]*terminatingNamespace
+	// smCtx is the parent context of the subnet manager calls, canceled by cancelSMCalls on shutdown
+	smCtx         context.Context
+	cancelSMCalls context.CancelFunc
+	// poolMutex guards guidPool, guidPodNetworkMap, stableGUIDs, warmGUIDs and terminatingNamespaces accessed by
+	// the reconcilers and the periodic updates
+	poolMutex sync.Mutex
 }
 
+// Number of pods requested per List call and number of workers processing the pages on GUID pool init
+const (
+	initPoolPageSize int64 = 500
+	initPoolWorkers        = 4
+)
+
+// Number of pkeys which members are written to the subnet manager concurrently
+const pKeyWriteWorkers = 4
+
 // Temporary struct used to proceed pods' networks
 type podNetworkInfo struct {
-	pod       *kapi.Pod
+	pod       *utils.PodRef
 	ibNetwork *v1.NetworkSelectionElement
 	networks  []*v1.NetworkSelectionElement
 	addr      net.HardwareAddr // GUID allocated for ibNetwork and saved as net.HardwareAddr
+	// extraAddrs are the additional GUIDs allocated for ibNetwork when it requests several guids per interface
+	extraAddrs []net.HardwareAddr
 }
 
 type networksMap struct {
 	theMap map[types.UID][]*v1.NetworkSelectionElement
+	// annotations maps the pod to its network annotation as last read from or written to kubernetes
+	annotations map[types.UID]string
+	// cache the networks of the pods missing from the map are parsed with, nil parses them every time
+	cache *utils.PodNetworksCache
 }
 
 // Exponential backoff ~26 sec + 6 * <api call time>
@@ -60,18 +165,90 @@ type networksMap struct {
 // NOTE: ufm client has default timeout on request operation for 30 seconds.
 var backoffValues = wait.Backoff{Duration: 1 * time.Second, Factor: 1.6, Jitter: 0.1, Steps: 6}
 
+// newBackoff returns the backoff of the operation class, backoffValues if the class backoff isn't configured
+func newBackoff(bc config.BackoffConfig) wait.Backoff {
+	if bc.Steps == 0 {
+		return backoffValues
+	}
+	return wait.Backoff{Duration: bc.Duration, Factor: bc.Factor, Jitter: bc.Jitter, Steps: bc.Steps}
+}
+
+// callWithTimeout runs the subnet manager call with a context derived from parent, which deadline is the timeout
+// in seconds, no deadline if the timeout is 0
+func callWithTimeout(parent context.Context, timeout int, call func(ctx context.Context) error) error {
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, time.Duration(timeout)*time.Second)
+	}
+	defer cancel()
+	return call(ctx)
+}
+
+// smContext returns the parent context of the subnet manager calls, canceled on shutdown to abort the
+// in-flight calls
+func (d *daemon) smContext() context.Context {
+	if d.smCtx == nil {
+		return context.Background()
+	}
+	return d.smCtx
+}
+
+// callSubnetManager runs the subnet manager call with the configured deadline of the subnet manager calls
+func (d *daemon) callSubnetManager(call func(ctx context.Context) error) error {
+	return callWithTimeout(d.smContext(), d.config.SMTimeout, call)
+}
+
+// pKeyWrite runs the subnet manager write of the pkey members, writePKey or writePKeyUnlocked
+type pKeyWrite func(pKey int, write func() error) error
+
+// writePKey runs the subnet manager write of the pkey members once the previous writes of the pkey are done, so
+// the writes of a pkey never interleave while the writes of different pkeys run in parallel
+func (d *daemon) writePKey(pKey int, write func() error) error {
+	if d.pKeyWorkers == nil {
+		return write()
+	}
+	var err error
+	d.pKeyWorkers.Do(ibUtils.FormatPKey(pKey), func() {
+		err = write()
+	})
+	return err
+}
+
+// writePKeyUnlocked runs the subnet manager write of the pkey members like writePKey, with poolMutex released until
+// the write is done, so the pod reconciles of other pkeys aren't blocked by the subnet manager. The write is queued
+// with poolMutex held, so the writes of a pkey run in the order the pool changed. It's called with poolMutex held,
+// the write mustn't access the state poolMutex guards.
+func (d *daemon) writePKeyUnlocked(pKey int, write func() error) error {
+	if d.pKeyWorkers == nil {
+		return write()
+	}
+	var err error
+	done := make(chan struct{})
+	d.pKeyWorkers.Submit(ibUtils.FormatPKey(pKey), func() {
+		defer close(done)
+		err = write()
+	})
+	d.poolMutex.Unlock()
+	defer d.poolMutex.Lock()
+	<-done
+	return err
+}
+
 // Return networks mapped to the pod. If mapping not exist it is created
-func (n *networksMap) getPodNetworks(pod *kapi.Pod) ([]*v1.NetworkSelectionElement, error) {
+func (n *networksMap) getPodNetworks(pod *utils.PodRef) ([]*v1.NetworkSelectionElement, error) {
 	var err error
 	networks, ok := n.theMap[pod.UID]
 	if !ok {
-		networks, err = netAttUtils.ParsePodNetworkAnnotation(pod)
+		networks, err = n.cache.ParsePodNetworks(pod)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read pod networkName annotations pod namespace %s name %s, with error: %v",
 				pod.Namespace, pod.Name, err)
 		}
 
 		n.theMap[pod.UID] = networks
+		if n.annotations != nil {
+			n.annotations[pod.UID] = pod.Annotations[v1.NetworkAttachmentAnnot]
+		}
 	}
 	return networks, nil
 }
@@ -84,163 +261,354 @@ func NewDaemon() (Daemon, error) {
 		return nil, err
 	}
 
-	if err := daemonConfig.ValidateConfig(); err != nil {
+	client, err := k8sClient.NewK8sClient(daemonConfig.K8sClientQPS, daemonConfig.K8sClientBurst)
+	if err != nil {
 		return nil, err
 	}
 
-	podEventHandler := resEvenHandler.NewPodEventHandler()
-	client, err := k8sClient.NewK8sClient()
-	if err != nil {
+	if err = loadConfig(&daemonConfig, client); err != nil {
 		return nil, err
 	}
+	if daemonConfig.NodeLocal {
+		log.Info().Msgf("node-local mode, managing the pods of node %s", daemonConfig.NodeName)
+		client.ScopePodsToNode(daemonConfig.NodeName)
+		// the instances of the nodes claim their guids as distinct owners of the coordination backend
+		if daemonConfig.GUIDPool.CoordinationBackend != "" {
+			daemonConfig.GUIDPool.ClusterID += "/" + daemonConfig.NodeName
+		}
+	}
 
-	pluginLoader := sm.NewPluginLoader()
-	getSmClientFunc, err := pluginLoader.LoadPlugin(path.Join(
-		daemonConfig.PluginPath, daemonConfig.Plugin+".so"), sm.InitializePluginFunc)
+	annotationWriter, err := k8sClient.NewAnnotationWriter(daemonConfig.AnnotationWriter, client)
 	if err != nil {
 		return nil, err
 	}
 
-	smClient, err := getSmClientFunc()
+	pluginLoader := sm.NewPluginLoader()
+	smClient, err := loadSubnetManagerClient(pluginLoader, daemonConfig.PluginPath, daemonConfig.Plugin)
 	if err != nil {
 		return nil, err
 	}
 
 	// Try to validate if subnet manager is reachable in backoff loop
+	smUnavailable := false
 	var validateErr error
-	if err := wait.ExponentialBackoff(backoffValues, func() (bool, error) {
-		if err := smClient.Validate(); err != nil {
+	if err := wait.ExponentialBackoff(newBackoff(daemonConfig.SMBackoff), func() (bool, error) {
+		if err := callWithTimeout(context.Background(), daemonConfig.SMTimeout, smClient.Validate); err != nil {
 			log.Warn().Msgf("%v", err)
 			validateErr = err
 			return false, nil
 		}
 		return true, nil
 	}); err != nil {
-		return nil, validateErr
+		if !daemonConfig.DegradedStart {
+			return nil, validateErr
+		}
+		log.Warn().Msgf("starting in degraded mode, subnet manager %s is unavailable: %v", smClient.Name(),
+			validateErr)
+		smUnavailable = true
 	}
 
 	guidPool, err := guid.NewPool(&daemonConfig.GUIDPool)
 	if err != nil {
 		return nil, err
 	}
-
-	// Reset guid pool with already allocated guids to avoid collisions
-	err = syncGUIDPool(smClient, guidPool)
+	nodeGUIDRanges, err := guid.ParseNodeRanges(&daemonConfig.GUIDPool)
 	if err != nil {
 		return nil, err
 	}
 
-	podWatcher := watcher.NewWatcher(podEventHandler, client)
-	return &daemon{
-		config:            daemonConfig,
-		watcher:           podWatcher,
-		kubeClient:        client,
-		guidPool:          guidPool,
-		smClient:          smClient,
-		guidPodNetworkMap: make(map[string]string),
-	}, nil
+	// The guid pool is synced with the subnet manager once the guids of the running pods are known, deferred in
+	// degraded mode until the subnet manager is validated
+	if !smUnavailable {
+		metrics.SMAvailable.Set(1)
+	}
+
+	var pKeyPool pkey.Pool
+	if daemonConfig.PKeyPool.RangeStart != "" {
+		pKeyPool, err = pkey.NewPool(&daemonConfig.PKeyPool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var failures *nodeFailures
+	if daemonConfig.NodeFailureGracePeriod > 0 {
+		failures = newNodeFailures()
+	}
+
+	d := &daemon{
+		config:             daemonConfig,
+		podNetworks:        utils.NewPodNetworksCache(),
+		kubeClient:         client,
+		annotationWriter:   annotationWriter,
+		guidPool:           guidPool,
+		nodeGUIDRanges:     nodeGUIDRanges,
+		smClient:           smClient,
+		pluginLoader:       pluginLoader,
+		smUnavailable:      smUnavailable,
+		guidPodNetworkMap:  make(map[string]utils.PodNetworkKey),
+		ready:              make(chan struct{}),
+		nodeFailures:       failures,
+		failedNodes:        make(map[string]bool),
+		deletedPodsSeen:    make(map[ibTypes.PodNetworkID]time.Time),
+		podFlaps:           make(map[ibTypes.PodNetworkID]time.Time),
+		annotationRetries:  make(map[types.UID]int),
+		notifier:           webhook.NewNotifier(daemonConfig.WebhookURLs),
+		pKeyPool:           pKeyPool,
+		nadSpecs:           utils.NewSynchronizedMap(),
+		reportedDuplicates: make(map[string]bool),
+		pKeyWorkers:        utils.NewKeyedWorkerPool(pKeyWriteWorkers),
+	}
+	d.smCtx, d.cancelSMCalls = context.WithCancel(context.Background())
+
+	restConfig, err := ctrlConfig.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up client config error %v", err)
+	}
+	restConfig.Wrap(tracing.WrapTransport)
+	k8sClient.ConfigureRateLimiter(restConfig, daemonConfig.K8sClientQPS, daemonConfig.K8sClientBurst)
+	if d.manager, err = d.newManager(restConfig); err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
 func (d *daemon) Run() {
 	// setup signal handling
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
 
-	// Init the guid pool
-	if err := d.initPool(); err != nil {
-		log.Error().Msgf("initPool(): Daemon could not init the guid pool: %v", err)
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Error().Msgf("failed to init tracing: %v", err)
 		os.Exit(1)
 	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Warn().Msgf("failed to shutdown tracing: %v", err)
+		}
+	}()
+
+	if d.config.MetricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(d.config.MetricsAddr); err != nil {
+				log.Error().Msgf("failed to serve metrics on %s: %v", d.config.MetricsAddr, err)
+			}
+		}()
+	}
+
+	if d.config.APIAddr != "" {
+		apiServer := api.NewServer(d.config.APIAddr, d.config.APITLSCert, d.config.APITLSKey, d,
+			api.NewTokenReviewAuthenticator(d.kubeClient, d.config.APIAudiences, d.config.APIServiceAccounts))
+		go func() {
+			if err := apiServer.Serve(); err != nil {
+				log.Error().Msgf("failed to serve api: %v", err)
+			}
+		}()
+		defer apiServer.Stop()
+	}
 
-	// Run periodic tasks
-	// closing the channel will stop the goroutines executed in the wait.Until() calls below
-	stopPeriodicsChan := make(chan struct{})
-	go wait.Until(d.AddPeriodicUpdate, time.Duration(d.config.PeriodicUpdate)*time.Second, stopPeriodicsChan)
-	go wait.Until(d.DeletePeriodicUpdate, time.Duration(d.config.PeriodicUpdate)*time.Second, stopPeriodicsChan)
-	defer close(stopPeriodicsChan)
+	if d.config.AdminSocket != "" {
+		adminServer := admin.NewServer(d.config.AdminSocket, d)
+		go func() {
+			if err := adminServer.Serve(); err != nil {
+				log.Error().Msgf("failed to serve admin api: %v", err)
+			}
+		}()
+		defer adminServer.Stop()
+	}
 
-	// Run Watcher in background, calling watcherStopFunc() will stop the watcher
-	watcherStopFunc := d.watcher.RunBackground()
-	defer watcherStopFunc()
+	// Run the manager in background, the guid pool is initialized and the periodic tasks are run once the
+	// daemon is elected as leader. Canceling the context stops the reconcilers and the periodic tasks.
+	ctx, cancel := context.WithCancel(context.Background())
+	managerDone := make(chan struct{})
+	go func() {
+		defer close(managerDone)
+		if err := d.manager.Start(ctx); err != nil {
+			log.Error().Msgf("controller manager failed: %v", err)
+			os.Exit(1)
+		}
+	}()
+	defer func() {
+		cancel()
+		<-managerDone
+	}()
+
+	// Run until interrupted by os signals, SIGUSR1 reloads the subnet manager plugin
+	for sig := range sigChan {
+		if sig != syscall.SIGUSR1 {
+			log.Info().Msgf("Received signal %s. Terminating...", sig)
+			if d.config.TeardownOnShutdown {
+				// the reconcilers are stopped first, so the removed guids aren't added back
+				cancel()
+				<-managerDone
+				d.teardown()
+			}
+			// abort the in-flight subnet manager calls, so the reconcilers stop without waiting for them
+			d.cancelSMCalls()
+			return
+		}
 
-	// Run until interrupted by os signals
-	sig := <-sigChan
-	log.Info().Msgf("Received signal %s. Terminating...", sig)
+		log.Info().Msgf("Received signal %s. Reloading subnet manager plugin...", sig)
+		go func() {
+			if err := d.ReloadPlugin(admin.PluginReload{}); err != nil {
+				log.Error().Msgf("%v", err)
+			}
+		}()
+	}
+}
+
+// If network identified by networkID is IbSriov return network name and spec, it returns errNetworkUnmanaged
+// if the network was drained
+func (d *daemon) getIbSriovNetwork(networkID string) (string, *utils.IbSriovCniSpec, error) {
+	netAttInfo, ibCniSpec, err := d.resolveIbSriovNetwork(networkID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !utils.NetworkIsManaged(netAttInfo) {
+		return "", nil, fmt.Errorf("network %s: %w", networkID, errNetworkUnmanaged)
+	}
+	return netAttInfo.Name, ibCniSpec, nil
 }
 
-// If network identified by networkID is IbSriov return network name and spec
+// resolveIbSriovNetwork returns the network attachment definition and the spec of the IbSriov network
+// identified by networkID
 //
 //nolint:nilerr
-func (d *daemon) getIbSriovNetwork(networkID string) (string, *utils.IbSriovCniSpec, error) {
-	networkNamespace, networkName, err := utils.ParseNetworkID(networkID)
+func (d *daemon) resolveIbSriovNetwork(networkID string) (*v1.NetworkAttachmentDefinition,
+	*utils.IbSriovCniSpec, error) {
+	parsedID, err := ibTypes.ParseNetworkID(networkID)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to parse network id %s with error: %v", networkID, err)
+		return nil, nil, fmt.Errorf("failed to parse network id %s with error: %v", networkID, err)
 	}
+	networkNamespace, networkName := parsedID.Namespace, parsedID.Name
 
-	// Try to get net-attach-def in backoff loop
+	// Try to get net-attach-def in backoff loop, the error of the last get is returned so a deleted network
+	// is told from a failed read
 	var netAttInfo *v1.NetworkAttachmentDefinition
-	if err = wait.ExponentialBackoff(backoffValues, func() (bool, error) {
-		netAttInfo, err = d.kubeClient.GetNetworkAttachmentDefinition(networkNamespace, networkName)
-		if err != nil {
+	var getErr error
+	if err = wait.ExponentialBackoff(newBackoff(d.config.K8sGetBackoff), func() (bool, error) {
+		netAttInfo, getErr = d.getNetworkAttachmentDefinition(networkNamespace, networkName)
+		if getErr != nil {
 			log.Warn().Msgf("failed to get networkName attachment %s with error %v",
-				networkName, err)
+				networkName, getErr)
 			return false, nil
 		}
 		return true, nil
 	}); err != nil {
-		return "", nil, fmt.Errorf("failed to get networkName attachment %s", networkName)
+		return nil, nil, fmt.Errorf("failed to get networkName attachment %s: %w", networkName, getErr)
 	}
 	log.Debug().Msgf("networkName attachment %v", netAttInfo)
 
-	networkSpec := make(map[string]interface{})
-	err = json.Unmarshal([]byte(netAttInfo.Spec.Config), &networkSpec)
+	ibCniSpec, err := d.parseNetworkAttachmentSpec(netAttInfo)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to parse networkName attachment %s with error: %v", networkName, err)
+		return nil, nil, err
 	}
-	log.Debug().Msgf("networkName attachment spec %+v", networkSpec)
 
-	ibCniSpec, err := utils.GetIbSriovCniFromNetwork(networkSpec)
-	if err != nil {
-		return "", nil, fmt.Errorf(
-			"failed to get InfiniBand SR-IOV CNI spec from network attachment %+v, with error %v",
-			networkSpec, err)
+	if ibCniSpec.PKey == utils.AutoPKey {
+		if err = d.resolveAutoPKey(networkID, netAttInfo, ibCniSpec); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	log.Debug().Msgf("ib-sriov CNI spec %+v", ibCniSpec)
-	return networkName, ibCniSpec, nil
+	return netAttInfo, ibCniSpec, nil
+}
+
+// getNetworkAttachmentDefinition returns the network attachment definition of the pod network namespace, or of
+// the fallback namespace if it isn't found and the namespace fallback is configured
+func (d *daemon) getNetworkAttachmentDefinition(networkNamespace, networkName string) (
+	*v1.NetworkAttachmentDefinition, error) {
+	netAttInfo, err := d.readNetworkAttachmentDefinition(networkNamespace, networkName)
+	if kerrors.IsNotFound(err) {
+		d.invalidateNetworkAttachmentSpec(ibTypes.NewNetworkID(networkNamespace, networkName).String())
+	}
+	fallback := d.config.NADNamespaceFallback
+	if err == nil || !kerrors.IsNotFound(err) || fallback == "" || fallback == networkNamespace {
+		return netAttInfo, err
+	}
+
+	log.Debug().Msgf("network attachment %s not found in namespace %s, falling back to namespace %s",
+		networkName, networkNamespace, fallback)
+	return d.readNetworkAttachmentDefinition(fallback, networkName)
+}
+
+// readNetworkAttachmentDefinition returns the network attachment definition from the informer cache of the
+// network controller, so the networks of the pods don't cost api server reads. It is read from the api server
+// if the cache isn't set up, or isn't running, e.g. on teardown after the manager stopped.
+func (d *daemon) readNetworkAttachmentDefinition(namespace, name string) (*v1.NetworkAttachmentDefinition, error) {
+	if d.nadReader != nil {
+		netAttDef := &v1.NetworkAttachmentDefinition{}
+		err := d.nadReader.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name},
+			netAttDef)
+		if err == nil {
+			return netAttDef, nil
+		}
+		var notStarted *cache.ErrCacheNotStarted
+		if !errors.As(err, &notStarted) {
+			return nil, err
+		}
+	}
+	return d.kubeClient.GetNetworkAttachmentDefinition(namespace, name)
 }
 
-// Return pod network info
-func getPodNetworkInfo(netName string, pod *kapi.Pod, netMap networksMap) (*podNetworkInfo, error) {
+// Return pod network info of each pod interface of the network. The interfaces of a network listed several times
+// in the pod networks are named, so their guids are mapped to the same interface across reconciles.
+func getPodNetworkInfos(networkID string, pod *utils.PodRef, netMap networksMap) ([]*podNetworkInfo, error) {
 	networks, err := netMap.getPodNetworks(pod)
 	if err != nil {
 		return nil, err
 	}
+	utils.AssignInterfaceNames(networks)
 
-	var network *v1.NetworkSelectionElement
-	network, err = utils.GetPodNetwork(networks, netName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get pod network spec for network %s with error: %v", netName, err)
+	var infos []*podNetworkInfo
+	for _, network := range networks {
+		if ibTypes.NetworkIDOf(network).String() != networkID {
+			continue
+		}
+		infos = append(infos, &podNetworkInfo{
+			pod:       pod,
+			networks:  networks,
+			ibNetwork: network,
+		})
 	}
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("failed to get pod network spec for network %s with error: network %s not found",
+			networkID, networkID)
+	}
+	return infos, nil
+}
 
-	return &podNetworkInfo{
-		pod:       pod,
-		networks:  networks,
-		ibNetwork: network,
-	}, nil
+// podNetworksAllocated returns true if the guids of the pod interfaces of the network are still allocated to them
+func (d *daemon) podNetworksAllocated(pis []*podNetworkInfo, networkID string) bool {
+	for _, pi := range pis {
+		for _, addr := range append([]net.HardwareAddr{pi.addr}, pi.extraAddrs...) {
+			key, ok := d.guidPodNetworkMap[addr.String()]
+			if !ok || key.PodUID != pi.pod.UID || key.NetworkID != networkID {
+				return false
+			}
+		}
+	}
+	return true
 }
 
-// Verify if GUID already exist for given network ID and allocates new one if not
-func (d *daemon) allocatePodNetworkGUID(allocatedGUID, podNetworkID string, podUID types.UID) error {
-	if mappedID, exist := d.guidPodNetworkMap[allocatedGUID]; exist {
-		if podNetworkID != mappedID {
-			return fmt.Errorf("failed to allocate requested guid %s, already allocated for %s",
-				allocatedGUID, mappedID)
+// Verify if GUID already exist for given pod network key and allocates new one if not
+func (d *daemon) allocatePodNetworkGUID(allocatedGUID string, key utils.PodNetworkKey) error {
+	allocatedGUID, err := ibUtils.NormalizeGUID(allocatedGUID)
+	if err != nil {
+		return fmt.Errorf("failed to allocate GUID for pod ID %s, with error: %v", key.PodUID, err)
+	}
+	if mappedKey, exist := d.guidPodNetworkMap[allocatedGUID]; exist {
+		if key != mappedKey {
+			return &guidConflictError{guid: allocatedGUID, owner: mappedKey}
 		}
 	} else if err := d.guidPool.AllocateGUID(allocatedGUID); err != nil {
-		return fmt.Errorf("failed to allocate GUID for pod ID %s, wit error: %v", podUID, err)
+		return fmt.Errorf("failed to allocate GUID for pod ID %s, wit error: %v", key.PodUID, err)
 	} else {
-		d.guidPodNetworkMap[allocatedGUID] = podNetworkID
+		d.guidPodNetworkMap[allocatedGUID] = key
+		d.summary.guidAllocated()
+		d.notify(&webhook.Event{Type: webhook.GUIDAllocated, GUID: allocatedGUID, PodUID: string(key.PodUID),
+			NetworkID: key.NetworkID, Interface: key.Interface})
 	}
 
 	return nil
@@ -250,7 +618,7 @@ func (d *daemon) allocatePodNetworkGUID(allocatedGUID, podNetworkID string, podU
 func (d *daemon) processNetworkGUID(networkID string, spec *utils.IbSriovCniSpec, pi *podNetworkInfo) error {
 	var guidAddr guid.GUID
 	allocatedGUID, err := utils.GetPodNetworkGUID(pi.ibNetwork)
-	podNetworkID := utils.GeneratePodNetworkID(pi.pod, networkID)
+	podNetworkKey := utils.GeneratePodNetworkKey(pi.pod, pi.ibNetwork)
 	if err == nil {
 		// User allocated guid manually or Pod's network was rescheduled
 		guidAddr, err = guid.ParseGUID(allocatedGUID)
@@ -258,43 +626,72 @@ func (d *daemon) processNetworkGUID(networkID string, spec *utils.IbSriovCniSpec
 			return fmt.Errorf("failed to parse user allocated guid %s with error: %v", allocatedGUID, err)
 		}
 
-		err = d.allocatePodNetworkGUID(allocatedGUID, podNetworkID, pi.pod.UID)
+		err = d.allocatePodNetworkGUID(allocatedGUID, podNetworkKey)
 		if err != nil {
 			return err
 		}
-	} else {
-		guidAddr, err = d.guidPool.GenerateGUID()
-		if err != nil {
-			switch err {
-			// If the guid pool is exhausted, need to sync with SM in case there are unsynced changes
-			case guid.ErrGUIDPoolExhausted:
-				err = syncGUIDPool(d.smClient, d.guidPool)
-				if err != nil {
-					return err
-				}
-			default:
-				return fmt.Errorf("failed to generate GUID for pod ID %s, with error: %v", pi.pod.UID, err)
+
+		// guids not in their canonical form, e.g. upper case guids, are migrated in the pod's networks annotation
+		if utils.NormalizePodNetworkGUIDs(pi.ibNetwork) {
+			if err = setPodNetworksAnnotation(pi); err != nil {
+				return err
 			}
 		}
+	} else if retriedGUID, retried := d.retriedPodNetworkGUID(podNetworkKey); retried {
+		// the annotation write or the pkey update of the pod failed, the guid kept allocated for it is set again
+		guidAddr, err = guid.ParseGUID(retriedGUID)
+		if err != nil {
+			return fmt.Errorf("failed to parse retried guid %s with error: %v", retriedGUID, err)
+		}
 
-		allocatedGUID = guidAddr.String()
-		err = d.allocatePodNetworkGUID(allocatedGUID, podNetworkID, pi.pod.UID)
+		if err = d.setPodNetworkGUID(pi, spec, retriedGUID); err != nil {
+			return err
+		}
+	} else if identity, stable := d.getStatefulSetIdentity(pi.pod, podNetworkKey); stable {
+		guidAddr, err = d.allocateStableGUID(identity, podNetworkKey)
 		if err != nil {
 			return err
 		}
 
-		err = utils.SetPodNetworkGUID(pi.ibNetwork, allocatedGUID, spec.Capabilities["infinibandGUID"])
+		if err = d.setPodNetworkGUID(pi, spec, guidAddr.String()); err != nil {
+			return err
+		}
+	} else if warmGUID, warm := d.takeWarmGUID(pi.pod, podNetworkKey); warm {
+		guidAddr, err = guid.ParseGUID(warmGUID)
+		if err != nil {
+			return fmt.Errorf("failed to parse warm guid %s with error: %v", warmGUID, err)
+		}
+
+		if err = d.setPodNetworkGUID(pi, spec, warmGUID); err != nil {
+			return err
+		}
+	} else {
+		guidAddr, err = d.generatePodGUID(pi.pod)
+		// If the guid pool is exhausted, need to sync with SM in case guids were released since the last sync,
+		// the sync keeps the guids allocated by the daemon so they aren't generated again
+		if err == guid.ErrGUIDPoolExhausted {
+			if err = d.syncAllocatedGUIDPool(); err != nil {
+				return err
+			}
+			guidAddr, err = d.generatePodGUID(pi.pod)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to set pod network guid with error: %v ", err)
+			return fmt.Errorf("failed to generate GUID for pod ID %s, with error: %v", pi.pod.UID, err)
 		}
 
-		// Update Pod's network annotation here, so if network will be rescheduled we wouldn't allocate it again
-		netAnnotations, err := json.Marshal(pi.networks)
+		allocatedGUID = guidAddr.String()
+		err = d.allocatePodNetworkGUID(allocatedGUID, podNetworkKey)
 		if err != nil {
-			return fmt.Errorf("failed to dump networks %+v of pod into json with error: %v", pi.networks, err)
+			return err
 		}
 
-		pi.pod.Annotations[v1.NetworkAttachmentAnnot] = string(netAnnotations)
+		if err = d.setPodNetworkGUID(pi, spec, allocatedGUID); err != nil {
+			return err
+		}
+	}
+
+	if err = d.processExtraNetworkGUIDs(spec, pi, podNetworkKey, guidAddr.String()); err != nil {
+		return err
 	}
 
 	// used GUID as net.HardwareAddress to use it in sm plugin which receive []net.HardwareAddress as parameter
@@ -302,329 +699,712 @@ func (d *daemon) processNetworkGUID(networkID string, spec *utils.IbSriovCniSpec
 	return nil
 }
 
-func syncGUIDPool(smClient plugins.SubnetManagerClient, guidPool guid.Pool) error {
-	usedGuids, err := smClient.ListGuidsInUse()
-	if err != nil {
-		return err
+// processExtraNetworkGUIDs allocates the additional guids of a network requesting several guids per interface.
+// The additional guids already set on the pod network, e.g. of a rescheduled network, or kept allocated for the
+// interface by a failed annotation write are allocated again, the missing ones are generated. All the guids of
+// the interface are set in the "guids" cni-arg of the pod network.
+func (d *daemon) processExtraNetworkGUIDs(spec *utils.IbSriovCniSpec, pi *podNetworkInfo, key utils.PodNetworkKey,
+	interfaceGUID string) error {
+	count := spec.InterfaceGUIDs()
+	if count <= 1 {
+		return nil
 	}
 
-	// Reset guid pool with already allocated guids to avoid collisions
-	err = guidPool.Reset(usedGuids)
-	if err != nil {
-		return err
+	var extraGUIDs []string
+	if requested, err := utils.GetPodNetworkGUIDs(pi.ibNetwork); err == nil {
+		extraGUIDs = requested[1:]
 	}
-	return nil
+	extraGUIDs = append(extraGUIDs, d.retriedExtraNetworkGUIDs(key, interfaceGUID, extraGUIDs)...)
+	if len(extraGUIDs) > count-1 {
+		extraGUIDs = extraGUIDs[:count-1]
+	}
+	for _, extraGUID := range extraGUIDs {
+		if _, err := guid.ParseGUID(extraGUID); err != nil {
+			return fmt.Errorf("failed to parse guid %s of %s with error: %v", extraGUID, key, err)
+		}
+		if err := d.allocatePodNetworkGUID(extraGUID, key); err != nil {
+			return err
+		}
+	}
+
+	// the generated guids are released if the interface can't get all its guids
+	var generated []string
+	for len(extraGUIDs) < count-1 {
+		guidAddr, err := d.generatePodGUID(pi.pod)
+		if err == nil {
+			err = d.allocatePodNetworkGUID(guidAddr.String(), key)
+		}
+		if err != nil {
+			for _, generatedGUID := range generated {
+				if releaseErr := d.releasePodNetworkGUID(generatedGUID); releaseErr != nil {
+					log.Warn().Msgf("failed to release guid %s of %s: %v", generatedGUID, key, releaseErr)
+				}
+			}
+			return fmt.Errorf("failed to generate GUID %d of %d for pod ID %s, with error: %v",
+				len(extraGUIDs)+2, count, pi.pod.UID, err)
+		}
+		generated = append(generated, guidAddr.String())
+		extraGUIDs = append(extraGUIDs, guidAddr.String())
+	}
+
+	pi.extraAddrs = make([]net.HardwareAddr, 0, len(extraGUIDs))
+	for _, extraGUID := range extraGUIDs {
+		extraAddr, err := net.ParseMAC(extraGUID)
+		if err != nil {
+			return fmt.Errorf("failed to parse guid %s of %s with error: %v", extraGUID, key, err)
+		}
+		pi.extraAddrs = append(pi.extraAddrs, extraAddr)
+	}
+
+	interfaceGUIDs := append([]string{interfaceGUID}, extraGUIDs...)
+	if err := utils.SetPodNetworkInterfaceGUIDs(pi.ibNetwork, interfaceGUIDs); err != nil {
+		return fmt.Errorf("failed to set pod network guids with error: %v ", err)
+	}
+	return setPodNetworksAnnotation(pi)
 }
 
-// Update and set Pod's network annotation.
-// If failed to update annotation, pod's GUID added into the list to be removed from Pkey.
-func (d *daemon) updatePodNetworkAnnotation(pi *podNetworkInfo, removedList *[]net.HardwareAddr) error {
-	if pi.ibNetwork.CNIArgs == nil {
-		pi.ibNetwork.CNIArgs = &map[string]interface{}{}
+// setPodNetworkGUID sets the allocated guid on the pod network and updates the pod's networks annotation
+func (d *daemon) setPodNetworkGUID(pi *podNetworkInfo, spec *utils.IbSriovCniSpec, allocatedGUID string) error {
+	err := utils.SetPodNetworkGUID(pi.ibNetwork, allocatedGUID, d.guidAsRuntimeConfig(spec))
+	if err != nil {
+		return fmt.Errorf("failed to set pod network guid with error: %v ", err)
 	}
 
-	(*pi.ibNetwork.CNIArgs)[utils.InfiniBandAnnotation] = utils.ConfiguredInfiniBandPod
+	// Update Pod's network annotation here, so if network will be rescheduled we wouldn't allocate it again
+	return setPodNetworksAnnotation(pi)
+}
 
-	netAnnotations, err := json.Marshal(pi.networks)
+// setPodNetworksAnnotation updates the pod's networks annotation with the pod networks
+func setPodNetworksAnnotation(pi *podNetworkInfo) error {
+	netAnnotations, err := utils.MarshalPodNetworks(pi.networks, pi.pod.Annotations[v1.NetworkAttachmentAnnot])
 	if err != nil {
 		return fmt.Errorf("failed to dump networks %+v of pod into json with error: %v", pi.networks, err)
 	}
 
 	pi.pod.Annotations[v1.NetworkAttachmentAnnot] = string(netAnnotations)
+	return nil
+}
 
-	// Try to set pod's annotations in backoff loop
-	if err = wait.ExponentialBackoff(backoffValues, func() (bool, error) {
-		if err = d.kubeClient.SetAnnotationsOnPod(pi.pod, pi.pod.Annotations); err != nil {
-			if kerrors.IsNotFound(err) {
-				return false, err
-			}
-			log.Warn().Msgf("failed to update pod annotations with err: %v", err)
-			return false, nil
-		}
+// updatePoolMetrics sets the GUID pool fragmentation metrics, it's called with poolMutex held
+func (d *daemon) updatePoolMetrics() {
+	stats := d.guidPool.Stats()
+	metrics.GUIDPoolFreeSegments.Set(float64(stats.FreeSegments))
+	metrics.GUIDPoolLongestFreeRun.Set(float64(stats.LongestFreeRun))
+}
 
-		return true, nil
-	}); err != nil {
-		log.Error().Msgf("failed to update pod annotations")
+// addGUIDsToPKey adds the guids to the pkey via subnet manager in backoff loop
+func (d *daemon) addGUIDsToPKey(pKeyStr string, guids []net.HardwareAddr) error {
+	return d.addOwnedGUIDsToPKey(pKeyStr, guids, nil)
+}
 
-		if err = d.guidPool.ReleaseGUID(pi.addr.String()); err != nil {
-			log.Warn().Msgf("failed to release guid \"%s\" from removed pod \"%s\" in namespace "+
-				"\"%s\" with error: %v", pi.addr.String(), pi.pod.Name, pi.pod.Namespace, err)
-		} else {
-			delete(d.guidPodNetworkMap, pi.addr.String())
-		}
+// addOwnedGUIDsToPKey adds the guids to the pkey like addGUIDsToPKey, passing the owners of the guids to the
+// subnet manager plugin which may record them
+func (d *daemon) addOwnedGUIDsToPKey(pKeyStr string, guids []net.HardwareAddr,
+	owners map[string]plugins.GUIDOwner) error {
+	return d.addPKeyMembers(pKeyStr, guids, owners, d.writePKey)
+}
 
-		*removedList = append(*removedList, pi.addr)
+// addPKeyMembers adds the owned guids to the pkey like addOwnedGUIDsToPKey, the subnet manager write is run by
+// write
+func (d *daemon) addPKeyMembers(pKeyStr string, guids []net.HardwareAddr, owners map[string]plugins.GUIDOwner,
+	write pKeyWrite) error {
+	pKey, err := ibUtils.ParsePKey(pKeyStr)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKey %s with error: %v", pKeyStr, err)
+	}
+	if d.unmanagedDefaultPKey(pKey) {
+		log.Debug().Msgf("skipping adding guids to the default partition %s, it is not managed", pKeyStr)
+		return nil
+	}
+
+	if err = write(pKey, func() error {
+		return wait.ExponentialBackoffWithContext(d.smContext(), newBackoff(d.config.SMBackoff),
+			func(context.Context) (bool, error) {
+				d.countSMCall()
+				if err := d.callSubnetManager(func(ctx context.Context) error {
+					return d.smClient.AddGuidsToPKey(plugins.WithGUIDOwners(ctx, owners), pKey, guids)
+				}); err != nil {
+					log.Warn().Msgf("failed to config pKey with subnet manager %s with error : %v",
+						d.smClient.Name(), err)
+					return false, nil
+				}
+				if err := d.verifyGUIDsInPKey(pKey, guids); err != nil {
+					log.Warn().Msgf("failed to verify pKey %s members with subnet manager %s with error: %v",
+						pKeyStr, d.smClient.Name(), err)
+					return false, nil
+				}
+				return true, nil
+			})
+	}); err != nil {
+		return fmt.Errorf("failed to config pKey %s with subnet manager %s", pKeyStr, d.smClient.Name())
 	}
 
+	d.notify(&webhook.Event{Type: webhook.PKeyMembersAdded, PKey: pKeyStr, GUIDs: guidsToStrings(guids)})
 	return nil
 }
 
-//nolint:nilerr
-func (d *daemon) AddPeriodicUpdate() {
-	log.Info().Msgf("running periodic add update")
-	addMap, _ := d.watcher.GetHandler().GetResults()
-	addMap.Lock()
-	defer addMap.Unlock()
-	// Contains ALL pods' networks
-	netMap := networksMap{theMap: make(map[types.UID][]*v1.NetworkSelectionElement)}
-	for networkID, podsInterface := range addMap.Items {
-		log.Info().Msgf("processing network networkID %s", networkID)
-		pods, ok := podsInterface.([]*kapi.Pod)
-		if !ok {
-			log.Error().Msgf(
-				"invalid value for add map networks expected pods array \"[]*kubernetes.Pod\", found %T",
-				podsInterface)
-			continue
-		}
+// removeGUIDsFromPKey removes the guids from the pkey via subnet manager in backoff loop
+func (d *daemon) removeGUIDsFromPKey(pKeyStr string, guids []net.HardwareAddr) error {
+	return d.removePKeyMembers(pKeyStr, guids, d.writePKey)
+}
 
-		if len(pods) == 0 {
-			continue
-		}
+// removePKeyMembers removes the guids from the pkey like removeGUIDsFromPKey, the subnet manager write is run by
+// write
+func (d *daemon) removePKeyMembers(pKeyStr string, guids []net.HardwareAddr, write pKeyWrite) error {
+	pKey, err := ibUtils.ParsePKey(pKeyStr)
+	if err != nil {
+		return fmt.Errorf("failed to parse PKey %s with error: %v", pKeyStr, err)
+	}
+	if d.unmanagedDefaultPKey(pKey) {
+		log.Debug().Msgf("skipping removing guids from the default partition %s, it is not managed", pKeyStr)
+		return nil
+	}
 
-		log.Info().Msgf("processing network networkID %s", networkID)
-		networkName, ibCniSpec, err := d.getIbSriovNetwork(networkID)
-		if err != nil {
-			addMap.UnSafeRemove(networkID)
-			log.Error().Msgf("droping network: %v", err)
-			continue
-		}
+	if err = write(pKey, func() error {
+		return wait.ExponentialBackoffWithContext(d.smContext(), newBackoff(d.config.SMBackoff),
+			func(context.Context) (bool, error) {
+				d.countSMCall()
+				if err := d.callSubnetManager(func(ctx context.Context) error {
+					return d.smClient.RemoveGuidsFromPKey(ctx, pKey, guids)
+				}); err != nil {
+					log.Warn().Msgf("failed to remove guids from pKey %s with subnet manager %s with error: %v",
+						pKeyStr, d.smClient.Name(), err)
+					return false, nil
+				}
+				return true, nil
+			})
+	}); err != nil {
+		return fmt.Errorf("failed to remove guids from pKey %s with subnet manager %s", pKeyStr, d.smClient.Name())
+	}
 
-		var guidList []net.HardwareAddr
-		var passedPods []*podNetworkInfo
-		for _, pod := range pods {
-			log.Debug().Msgf("pod namespace %s name %s", pod.Namespace, pod.Name)
-			var pi *podNetworkInfo
-			pi, err = getPodNetworkInfo(networkName, pod, netMap)
-			if err != nil {
-				log.Error().Msgf("%v", err)
-				continue
-			}
-			if err = d.processNetworkGUID(networkName, ibCniSpec, pi); err != nil {
-				log.Error().Msgf("%v", err)
-				continue
-			}
+	d.notify(&webhook.Event{Type: webhook.PKeyMembersRemoved, PKey: pKeyStr, GUIDs: guidsToStrings(guids)})
+	return nil
+}
 
-			guidList = append(guidList, pi.addr)
-			passedPods = append(passedPods, pi)
-		}
+// unmanagedDefaultPKey returns true if the pkey is the default partition and its members aren't managed, as the
+// fabric includes all ports in it
+func (d *daemon) unmanagedDefaultPKey(pKey int) bool {
+	return !d.config.ManageDefaultPKey && ibUtils.IsDefaultPKey(pKey)
+}
 
-		// Get configured PKEY for network and add the relevant POD GUIDs as members of the PKey via Subnet Manager
-		if ibCniSpec.PKey != "" && len(guidList) != 0 {
-			var pKey int
-			pKey, err = utils.ParsePKey(ibCniSpec.PKey)
-			if err != nil {
-				log.Error().Msgf("failed to parse PKey %s with error: %v", ibCniSpec.PKey, err)
-				continue
-			}
+// addGUIDsToLimitedPartition adds the guids as limited members of the configured default limited partition
+// via subnet manager in backoff loop. It is skipped if the network pkey is the default limited partition.
+func (d *daemon) addGUIDsToLimitedPartition(networkPKey string, guids []net.HardwareAddr) error {
+	return d.addLimitedPKeyMembers(networkPKey, guids, d.writePKey)
+}
 
-			// Try to add pKeys via subnet manager in backoff loop
-			if err = wait.ExponentialBackoff(backoffValues, func() (bool, error) {
-				if err = d.smClient.AddGuidsToPKey(pKey, guidList); err != nil {
-					log.Warn().Msgf("failed to config pKey with subnet manager %s with error : %v",
-						d.smClient.Name(), err)
+// addLimitedPKeyMembers adds the guids to the default limited partition like addGUIDsToLimitedPartition, the
+// subnet manager write is run by write
+func (d *daemon) addLimitedPKeyMembers(networkPKey string, guids []net.HardwareAddr, write pKeyWrite) error {
+	if !d.useLimitedPartition(networkPKey) || len(guids) == 0 {
+		return nil
+	}
+
+	pKeyStr := d.config.DefaultLimitedPartition
+	pKey, err := ibUtils.ParsePKey(pKeyStr)
+	if err != nil {
+		return fmt.Errorf("failed to parse default limited partition %s with error: %v", pKeyStr, err)
+	}
+	if d.unmanagedDefaultPKey(pKey) {
+		log.Debug().Msgf("skipping adding guids to the default partition %s, it is not managed", pKeyStr)
+		return nil
+	}
+
+	if err = write(pKey, func() error {
+		return wait.ExponentialBackoffWithContext(d.smContext(), newBackoff(d.config.SMBackoff),
+			func(context.Context) (bool, error) {
+				d.countSMCall()
+				if err := d.callSubnetManager(func(ctx context.Context) error {
+					return d.smClient.AddGuidsToLimitedPKey(ctx, pKey, guids)
+				}); err != nil {
+					log.Warn().Msgf("failed to add guids to default limited partition %s with subnet manager %s "+
+						"with error: %v", pKeyStr, d.smClient.Name(), err)
 					return false, nil
 				}
 				return true, nil
-			}); err != nil {
-				log.Error().Msgf("failed to config pKey with subnet manager %s", d.smClient.Name())
-				continue
-			}
-		}
+			})
+	}); err != nil {
+		return fmt.Errorf("failed to add guids to default limited partition %s with subnet manager %s",
+			pKeyStr, d.smClient.Name())
+	}
 
-		// Update annotations for PODs that finished the previous steps successfully
-		var removedGUIDList []net.HardwareAddr
-		for _, pi := range passedPods {
-			err = d.updatePodNetworkAnnotation(pi, &removedGUIDList)
-			if err != nil {
-				log.Error().Msgf("%v", err)
-			}
-		}
+	d.notify(&webhook.Event{Type: webhook.PKeyMembersAdded, PKey: pKeyStr, GUIDs: guidsToStrings(guids)})
+	return nil
+}
 
-		if ibCniSpec.PKey != "" && len(removedGUIDList) != 0 {
-			// Already check the parse above
-			pKey, _ := utils.ParsePKey(ibCniSpec.PKey)
+// removeGUIDsFromLimitedPartition removes the guids from the configured default limited partition.
+// It is skipped if the network pkey is the default limited partition.
+func (d *daemon) removeGUIDsFromLimitedPartition(networkPKey string, guids []net.HardwareAddr) error {
+	return d.removeLimitedPKeyMembers(networkPKey, guids, d.writePKey)
+}
 
-			// Try to remove pKeys via subnet manager in backoff loop
-			if err = wait.ExponentialBackoff(backoffValues, func() (bool, error) {
-				if err = d.smClient.RemoveGuidsFromPKey(pKey, removedGUIDList); err != nil {
-					log.Warn().Msgf("failed to remove guids of removed pods from pKey %s"+
-						" with subnet manager %s with error: %v", ibCniSpec.PKey,
-						d.smClient.Name(), err)
-					return false, nil
-				}
-				return true, nil
-			}); err != nil {
-				log.Warn().Msgf("failed to remove guids of removed pods from pKey %s"+
-					" with subnet manager %s", ibCniSpec.PKey, d.smClient.Name())
-				continue
-			}
-		}
+// removeLimitedPKeyMembers removes the guids from the default limited partition like
+// removeGUIDsFromLimitedPartition, the subnet manager write is run by write
+func (d *daemon) removeLimitedPKeyMembers(networkPKey string, guids []net.HardwareAddr, write pKeyWrite) error {
+	if !d.useLimitedPartition(networkPKey) || len(guids) == 0 {
+		return nil
+	}
+	return d.removePKeyMembers(d.config.DefaultLimitedPartition, guids, write)
+}
 
-		addMap.UnSafeRemove(networkID)
+// useLimitedPartition returns true if a default limited partition is configured and it isn't the network pkey,
+// in which case the guids are already full members of it
+func (d *daemon) useLimitedPartition(networkPKey string) bool {
+	if d.config.DefaultLimitedPartition == "" {
+		return false
 	}
-	log.Info().Msg("add periodic update finished")
+	if networkPKey == "" {
+		return true
+	}
+
+	limitedPKey, err := ibUtils.ParsePKey(d.config.DefaultLimitedPartition)
+	if err != nil {
+		return false
+	}
+	pKey, err := ibUtils.ParsePKey(networkPKey)
+	return err != nil || pKey != limitedPKey
 }
 
-// get GUID from Pod's network
-func getPodGUIDForNetwork(pod *kapi.Pod, networkName string) (net.HardwareAddr, error) {
-	networks, netErr := netAttUtils.ParsePodNetworkAnnotation(pod)
-	if netErr != nil {
-		return nil, fmt.Errorf("failed to read pod networkName annotations pod namespace %s name %s, with error: %v",
-			pod.Namespace, pod.Name, netErr)
+// verifyGUIDsInPKey checks the guids are members of the pkey in the subnet manager.
+// Verification is skipped if the subnet manager plugin can't report pkey members.
+func (d *daemon) verifyGUIDsInPKey(pKey int, guids []net.HardwareAddr) error {
+	d.countSMCall()
+	var members []net.HardwareAddr
+	err := d.callSubnetManager(func(ctx context.Context) (err error) {
+		members, err = d.smClient.GetPKeyMembers(ctx, pKey)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, plugins.ErrNotSupported) {
+			return nil
+		}
+		return err
 	}
 
-	network, netErr := utils.GetPodNetwork(networks, networkName)
-	if netErr != nil {
-		return nil, fmt.Errorf("failed to get pod networkName spec %s with error: %v", networkName, netErr)
+	memberSet := make(map[string]bool, len(members))
+	for _, member := range members {
+		memberSet[member.String()] = true
+	}
+
+	var missing []string
+	for _, guid := range guids {
+		if !memberSet[guid.String()] {
+			missing = append(missing, guid.String())
+		}
 	}
+	if len(missing) != 0 {
+		return fmt.Errorf("guids %v are not members of pKey 0x%04X", missing, pKey)
+	}
+	return nil
+}
 
-	if !utils.IsPodNetworkConfiguredWithInfiniBand(network) {
-		return nil, fmt.Errorf("network %+v is not InfiniBand configured", network)
+// releasePodNetworkGUID releases the allocated guid back to the pool and removes it from guidPodNetworkMap
+func (d *daemon) releasePodNetworkGUID(allocatedGUID string) error {
+	if normalized, err := ibUtils.NormalizeGUID(allocatedGUID); err == nil {
+		allocatedGUID = normalized
+	}
+	key := d.guidPodNetworkMap[allocatedGUID]
+	if d.parkStableGUID(allocatedGUID) {
+		d.summary.guidReleased()
+		d.notify(&webhook.Event{Type: webhook.GUIDReleased, GUID: allocatedGUID, PodUID: string(key.PodUID),
+			NetworkID: key.NetworkID, Interface: key.Interface})
+		return nil
 	}
 
-	allocatedGUID, netErr := utils.GetPodNetworkGUID(network)
-	if netErr != nil {
-		return nil, netErr
+	if err := d.guidPool.ReleaseGUID(allocatedGUID); err != nil {
+		return err
 	}
 
-	guidAddr, guidErr := net.ParseMAC(allocatedGUID)
-	if guidErr != nil {
-		return nil, fmt.Errorf("failed to parse allocated Pod GUID, error: %v", guidErr)
+	delete(d.guidPodNetworkMap, allocatedGUID)
+	delete(d.adoptedGUIDs, allocatedGUID)
+	d.summary.guidReleased()
+	d.notify(&webhook.Event{Type: webhook.GUIDReleased, GUID: allocatedGUID, PodUID: string(key.PodUID),
+		NetworkID: key.NetworkID, Interface: key.Interface})
+	return nil
+}
+
+// notify sends the event to the configured webhooks
+func (d *daemon) notify(event *webhook.Event) {
+	if d.notifier != nil {
+		d.notifier.Notify(event)
 	}
+}
 
-	return guidAddr, nil
+func guidsToStrings(guids []net.HardwareAddr) []string {
+	guidsStr := make([]string, 0, len(guids))
+	for _, guidAddr := range guids {
+		guidsStr = append(guidsStr, guidAddr.String())
+	}
+	return guidsStr
 }
 
-//nolint:nilerr
-func (d *daemon) DeletePeriodicUpdate() {
-	log.Info().Msg("running delete periodic update")
-	_, deleteMap := d.watcher.GetHandler().GetResults()
-	deleteMap.Lock()
-	defer deleteMap.Unlock()
-	for networkID, podsInterface := range deleteMap.Items {
-		log.Info().Msgf("processing network networkID %s", networkID)
-		pods, ok := podsInterface.([]*kapi.Pod)
-		if !ok {
-			log.Error().Msgf("invalid value for add map networks expected pods array \"[]*kubernetes.Pod\", found %T",
-				podsInterface)
-			continue
-		}
+// addPodNetwork allocates guids to the pod interfaces of the network, adds them to the network pkey and queues the
+// pod annotation update. It returns true if the pod is held, e.g. while its stable guid is in use. The pod networks
+// rejected by a policy, a limit or an invalid annotation aren't retried, the guids of a pod network which couldn't
+// be added to its pkey are kept allocated for it, so they are reused when it's retried.
+func (d *daemon) addPodNetwork(ctx context.Context, networkID string, pod *utils.PodRef, netMap networksMap,
+	policies *partitionPolicies, updates *podAnnotationUpdates) (bool, error) {
+	ctx, span := tracing.Start(ctx, "addPodNetwork", attribute.String("network.id", networkID))
+	var err error
+	defer func() { tracing.End(span, err) }()
 
-		if len(pods) == 0 {
-			continue
+	log.Info().Msgf("processing pod namespace %s name %s network networkID %s", pod.Namespace, pod.Name, networkID)
+	d.summary.networkProcessed()
+	_, netSpan := tracing.Start(ctx, "getIbSriovNetwork")
+	networkName, ibCniSpec, err := d.getIbSriovNetwork(networkID)
+	tracing.End(netSpan, err)
+	if err != nil {
+		if errors.Is(err, errNetworkUnmanaged) {
+			log.Info().Msgf("skipping pod of drained network: %v", err)
+			err = nil
+			return false, nil
 		}
+		d.setNetworkSyncFailed(networkID, "NetworkResolveFailed", err, true)
+		return false, err
+	}
+	d.recordNetworkPKey(networkID, ibCniSpec.PKey)
+	memberLimit := d.newPKeyMemberLimit(ibCniSpec.PKey)
+
+	pis, podErr := getPodNetworkInfos(networkID, pod, netMap)
+	if podErr != nil {
+		log.Error().Msgf("%v", podErr)
+		d.summary.failure()
+		return false, nil
+	}
+	if podErr = d.checkPodPartitionPolicy(policies, pod, networkID, ibCniSpec.PKey); podErr != nil {
+		log.Error().Msgf("%v", podErr)
+		d.summary.failure()
+		return false, nil
+	}
 
-		networkName, ibCniSpec, err := d.getIbSriovNetwork(networkID)
-		if err != nil {
-			deleteMap.UnSafeRemove(networkID)
-			log.Warn().Msgf("droping network: %v", err)
+	held := false
+	var conflicts []error
+	var guidList []net.HardwareAddr
+	var passedPods []*podNetworkInfo
+	// each pod interface of the network is configured on its own
+	for _, pi := range pis {
+		allocated := len(d.guidPodNetworkMap)
+		if podErr = d.processNetworkGUID(networkName, ibCniSpec, pi); podErr != nil {
+			var inUse *stableGUIDInUseError
+			if errors.As(podErr, &inUse) {
+				log.Info().Msgf("holding pod namespace %s name %s: %v", pod.Namespace, pod.Name, podErr)
+				held = true
+				break
+			}
+			log.Error().Msgf("%v", podErr)
+			d.summary.failure()
+			d.flagGUIDConflict(pod, networkID, podErr)
+			// the guid requested by the pod is retried once its owner releases it
+			var conflict *guidConflictError
+			if errors.As(podErr, &conflict) {
+				conflicts = append(conflicts, podErr)
+			}
 			continue
 		}
-
-		var guidList []net.HardwareAddr
-		var guidAddr net.HardwareAddr
-		for _, pod := range pods {
-			log.Debug().Msgf("pod namespace %s name %s", pod.Namespace, pod.Name)
-			guidAddr, err = getPodGUIDForNetwork(pod, networkName)
-			if err != nil {
-				log.Error().Msgf("%v", err)
+		if memberLimit != nil {
+			if podErr = memberLimit.admit(len(d.guidPodNetworkMap) - allocated); podErr != nil {
+				log.Error().Msgf("pod namespace %s name %s: %v", pod.Namespace, pod.Name, podErr)
+				d.summary.failure()
+				d.rejectPKeyMemberLimit(pi, networkID, podErr)
 				continue
 			}
-
-			guidList = append(guidList, guidAddr)
 		}
 
-		if ibCniSpec.PKey != "" && len(guidList) != 0 {
-			pKey, pkeyErr := utils.ParsePKey(ibCniSpec.PKey)
-			if pkeyErr != nil {
-				log.Error().Msgf("failed to parse PKey %s with error: %v", ibCniSpec.PKey, pkeyErr)
-				continue
+		guidList = append(guidList, pi.addr)
+		guidList = append(guidList, pi.extraAddrs...)
+		passedPods = append(passedPods, pi)
+	}
+	span.SetAttributes(attribute.Int("guids.count", len(guidList)))
+
+	// Get configured PKEY for network and add the relevant POD GUIDs as members of the PKey via Subnet Manager
+	if ibCniSpec.PKey != "" && len(guidList) != 0 {
+		// the adopted guids are already members of the pkey
+		if newMembers := d.newPKeyMembers(guidList); len(newMembers) != 0 {
+			_, pKeySpan := tracing.Start(ctx, "addGUIDsToPKey", attribute.String("pkey", ibCniSpec.PKey))
+			err = d.addPKeyMembers(ibCniSpec.PKey, newMembers, podGUIDOwners(passedPods), d.writePKeyUnlocked)
+			tracing.End(pKeySpan, err)
+			if err != nil {
+				d.setNetworkSyncFailed(networkID, "AddMembersFailed", err, true)
+				return false, err
 			}
+		}
+		d.forgetAdoptedGUIDs(guidList)
+		d.updatePKeyMembersMetric(ibCniSpec.PKey)
+	}
 
-			// Try to remove pKeys via subnet manager on backoff loop
-			if err = wait.ExponentialBackoff(backoffValues, func() (bool, error) {
-				if err = d.smClient.RemoveGuidsFromPKey(pKey, guidList); err != nil {
-					log.Warn().Msgf("failed to remove guids of removed pods from pKey %s"+
-						" with subnet manager %s with error: %v", ibCniSpec.PKey,
-						d.smClient.Name(), err)
-					return false, nil
-				}
-				return true, nil
-			}); err != nil {
-				log.Warn().Msgf("failed to remove guids of removed pods from pKey %s"+
-					" with subnet manager %s", ibCniSpec.PKey, d.smClient.Name())
-				continue
+	if err = d.addLimitedPKeyMembers(ibCniSpec.PKey, guidList, d.writePKeyUnlocked); err != nil {
+		d.setNetworkSyncFailed(networkID, "AddLimitedMembersFailed", err, false)
+		return false, err
+	}
+	// guids released while poolMutex was released for the pkey writes, e.g. by a network drain, were removed from
+	// the pkey by their release, which pkey write is queued after the add, so the pod network is retried
+	if !d.podNetworksAllocated(passedPods, networkID) {
+		err = fmt.Errorf("guids of pod namespace %s name %s network %s were released while added to the pkey",
+			pod.Namespace, pod.Name, networkID)
+		return false, err
+	}
+
+	// Queue annotation updates of the pod interfaces that finished the previous steps successfully, the annotation
+	// of the pod is written once all its networks are processed
+	for _, pi := range passedPods {
+		updates.add(pi, networkID, ibCniSpec, d.runtimeConfigOnly(ibCniSpec))
+	}
+
+	if len(guidList) != 0 {
+		d.setNetworkSynced(networkID, ibCniSpec.PKey, "MembersAdded", fmt.Sprintf("%d guids added", len(guidList)))
+	}
+	err = errors.Join(conflicts...)
+	return held, err
+}
+
+// deletePodNetwork removes the guids of the deleted pod network from the network pkey and the default limited
+// partition and releases them once their removal is due, it returns how long the removal is still held and whether
+// it is held. The guids of a network which can't be found are kept allocated, as they may still be members of its
+// pkey.
+func (d *daemon) deletePodNetwork(ctx context.Context, networkID string, pod *utils.PodRef, guids []string,
+	now time.Time) (time.Duration, bool, error) {
+	podNetworkID := ibTypes.PodNetworkID{PodUID: pod.UID, NetworkID: networkID}
+	if hold := d.removalHeldFor(podNetworkID, pod, now); hold > 0 {
+		log.Debug().Msgf("holding pkey removal of deleted pod namespace %s name %s of network %s for %v",
+			pod.Namespace, pod.Name, networkID, hold)
+		return hold, true, nil
+	}
+	if d.smUnavailable {
+		log.Debug().Msgf("holding pkey removal of deleted pod namespace %s name %s, subnet manager updates are "+
+			"deferred", pod.Namespace, pod.Name)
+		return 0, true, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "deletePodNetwork",
+		attribute.String("network.id", networkID), attribute.Int("guids.count", len(guids)))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	log.Info().Msgf("processing deleted pod namespace %s name %s network networkID %s", pod.Namespace, pod.Name,
+		networkID)
+	d.summary.networkProcessed()
+	_, netSpan := tracing.Start(ctx, "getIbSriovNetwork")
+	_, ibCniSpec, err := d.getIbSriovNetwork(networkID)
+	tracing.End(netSpan, err)
+	if err != nil {
+		if errors.Is(err, errNetworkUnmanaged) || kerrors.IsNotFound(err) {
+			// guids of the drained network were already removed from its pkey and released
+			log.Warn().Msgf("dropping deleted pod namespace %s name %s: %v", pod.Namespace, pod.Name, err)
+			if !errors.Is(err, errNetworkUnmanaged) {
+				d.setNetworkSyncFailed(networkID, "NetworkResolveFailed", err, true)
 			}
+			delete(d.deletedPodsSeen, podNetworkID)
+			err = nil
+			return 0, false, nil
 		}
+		d.setNetworkSyncFailed(networkID, "NetworkResolveFailed", err, true)
+		return 0, false, err
+	}
+	d.recordNetworkPKey(networkID, ibCniSpec.PKey)
 
-		for _, guidAddr := range guidList {
-			if err = d.guidPool.ReleaseGUID(guidAddr.String()); err != nil {
-				log.Error().Msgf("%v", err)
-				continue
-			}
+	guidList := make([]net.HardwareAddr, 0, len(guids))
+	for _, allocatedGUID := range guids {
+		guidAddr, parseErr := net.ParseMAC(allocatedGUID)
+		if parseErr != nil {
+			log.Error().Msgf("failed to parse allocated guid %s: %v", allocatedGUID, parseErr)
+			continue
+		}
+		guidList = append(guidList, guidAddr)
+	}
 
-			delete(d.guidPodNetworkMap, guidAddr.String())
+	if ibCniSpec.PKey != "" && len(guidList) != 0 {
+		_, pKeySpan := tracing.Start(ctx, "removeGUIDsFromPKey", attribute.String("pkey", ibCniSpec.PKey))
+		err = d.removePKeyMembers(ibCniSpec.PKey, guidList, d.writePKeyUnlocked)
+		tracing.End(pKeySpan, err)
+		if err != nil {
+			d.setNetworkSyncFailed(networkID, "RemoveMembersFailed", err, false)
+			return 0, false, fmt.Errorf("failed to remove guids of removed pods: %w", err)
 		}
-		deleteMap.UnSafeRemove(networkID)
 	}
 
-	log.Info().Msg("delete periodic update finished")
+	if err = d.removeLimitedPKeyMembers(ibCniSpec.PKey, guidList, d.writePKeyUnlocked); err != nil {
+		d.setNetworkSyncFailed(networkID, "RemoveLimitedMembersFailed", err, false)
+		return 0, false, fmt.Errorf("failed to remove guids of removed pods from default limited partition: %w", err)
+	}
+	if len(guidList) != 0 {
+		d.setNetworkSynced(networkID, ibCniSpec.PKey, "MembersRemoved",
+			fmt.Sprintf("%d guids removed", len(guidList)))
+	}
+
+	for _, guidAddr := range guidList {
+		// a guid released while poolMutex was released for the pkey writes may be allocated to another pod
+		if key, ok := d.guidPodNetworkMap[guidAddr.String()]; !ok || key.PodUID != pod.UID ||
+			key.NetworkID != networkID {
+			continue
+		}
+		if releaseErr := d.releasePodNetworkGUID(guidAddr.String()); releaseErr != nil {
+			log.Error().Msgf("%v", releaseErr)
+		}
+	}
+	if ibCniSpec.PKey != "" && len(guidList) != 0 {
+		d.updatePKeyMembersMetric(ibCniSpec.PKey)
+	}
+	delete(d.deletedPodsSeen, podNetworkID)
+	return 0, false, nil
 }
 
 // initPool check the guids that are already allocated by the running pods
 func (d *daemon) initPool() error {
+	// the pods aren't listed if the guid pool was warmed by the standby before the replica was elected
+	if d.startLeading() {
+		log.Info().Msg("GUID pool warmed by standby, skipping pods list")
+		if d.config.EnableGUIDReservations {
+			return d.initGUIDReservations()
+		}
+		return nil
+	}
+
 	log.Info().Msg("Initializing GUID pool.")
+	startTime := time.Now()
+
+	pages := make(chan *kapi.PodList, initPoolWorkers)
+	errChan := make(chan error, initPoolWorkers)
+	var podsCount int64
+	var wg sync.WaitGroup
+	for i := 0; i < initPoolWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			failed := false
+			// Keep consuming pages after failure so the producer is not blocked
+			for page := range pages {
+				if failed {
+					continue
+				}
+				atomic.AddInt64(&podsCount, int64(len(page.Items)))
+				if err := d.allocatePodsGUIDs(page.Items); err != nil {
+					errChan <- err
+					failed = true
+				}
+			}
+		}()
+	}
 
-	// Try to get pod list from k8s client in backoff loop
-	var pods *kapi.PodList
-	if err := wait.ExponentialBackoff(backoffValues, func() (bool, error) {
-		var err error
-		if pods, err = d.kubeClient.GetPods(kapi.NamespaceAll); err != nil {
-			log.Warn().Msgf("failed to get pods from kubernetes: %v", err)
-			return false, nil
-		}
-		return true, nil
-	}); err != nil {
-		err = fmt.Errorf("failed to get pods from kubernetes")
-		log.Error().Msgf("%v", err)
+	listErr := d.listPodsPages(pages)
+	close(pages)
+	wg.Wait()
+	close(errChan)
+
+	if listErr != nil {
+		log.Error().Msgf("%v", listErr)
+		return listErr
+	}
+	if err := <-errChan; err != nil {
 		return err
 	}
 
-	for index := range pods.Items {
-		log.Debug().Msgf("checking pod for network annotations %v", pods.Items[index])
-		pod := pods.Items[index]
-		networks, err := netAttUtils.ParsePodNetworkAnnotation(&pod)
+	duration := time.Since(startTime)
+	metrics.InitPoolDuration.Set(duration.Seconds())
+	metrics.InitPoolPods.Set(float64(podsCount))
+	log.Info().Msgf("GUID pool initialized from %d pods in %v", podsCount, duration)
+
+	if d.config.GUIDPool.CoordinationBackend != "" {
+		// the guids claimed by the other clusters are allocated, and the claims of this cluster on guids of pods
+		// deleted while the daemon was down are released
+		if err := d.guidPool.Reset(d.allocatedGUIDs()); err != nil {
+			return fmt.Errorf("failed to reset guid pool with the claimed guids: %v", err)
+		}
+	}
+
+	if d.config.EnableGUIDReservations {
+		return d.initGUIDReservations()
+	}
+
+	return nil
+}
+
+// listPodsPages lists all pods page by page and sends each page to the pages channel.
+// In case the continue token expired the listing restarts from the first page, as GUID allocation of
+// already processed pods is idempotent.
+func (d *daemon) listPodsPages(pages chan<- *kapi.PodList) error {
+	continueToken := ""
+	for {
+		var pods *kapi.PodList
+		if err := wait.ExponentialBackoff(newBackoff(d.config.K8sGetBackoff), func() (bool, error) {
+			var err error
+			if pods, err = d.kubeClient.GetPodsPage(kapi.NamespaceAll, initPoolPageSize, continueToken); err != nil {
+				if kerrors.IsResourceExpired(err) {
+					log.Warn().Msgf("pods list continue token expired, restarting listing: %v", err)
+					continueToken = ""
+				} else {
+					log.Warn().Msgf("failed to get pods from kubernetes: %v", err)
+				}
+				return false, nil
+			}
+			return true, nil
+		}); err != nil {
+			return fmt.Errorf("failed to get pods from kubernetes")
+		}
+
+		pages <- pods
+		continueToken = pods.Continue
+		if continueToken == "" {
+			return nil
+		}
+	}
+}
+
+// allocatePodsGUIDs allocates in the pool the GUIDs already assigned to the networks of given pods, and records
+// the instances of the configured pods, so their guids are released once they are deleted
+func (d *daemon) allocatePodsGUIDs(pods []kapi.Pod) error {
+	for index := range pods {
+		log.Debug().Msgf("checking pod for network annotations %v", &pods[index])
+		pod := utils.NewPodRef(&pods[index])
+		networks, err := utils.ParsePodNetworks(pod)
 		if err != nil {
 			continue
 		}
 
+		configured := false
 		for _, network := range networks {
-			if !utils.IsPodNetworkConfiguredWithInfiniBand(network) {
+			if !utils.IsPodNetworkConfiguredWithInfiniBand(pod, network) {
 				continue
 			}
 
-			podGUID, err := utils.GetPodNetworkGUID(network)
+			podGUIDs, err := utils.GetPodNetworkGUIDs(network)
 			if err != nil {
 				continue
 			}
-			podNetworkID := string(pod.UID) + network.Name
-			if _, exist := d.guidPodNetworkMap[podGUID]; exist {
-				if podNetworkID != d.guidPodNetworkMap[podGUID] {
-					return fmt.Errorf("failed to allocate requested guid %s, already allocated for %s",
-						podGUID, d.guidPodNetworkMap[podGUID])
+			configured = true
+			for _, podGUID := range podGUIDs {
+				if err = d.allocateRunningPodGUID(podGUID, utils.GeneratePodNetworkKey(pod, network)); err != nil {
+					return err
 				}
-				continue
 			}
+		}
+		if configured {
+			d.poolMutex.Lock()
+			d.recordPodInstance(&pods[index])
+			d.poolMutex.Unlock()
+		}
+	}
+	return nil
+}
 
-			if err = d.guidPool.AllocateGUID(podGUID); err != nil {
-				err = fmt.Errorf("failed to allocate guid for running pod: %v", err)
-				log.Error().Msgf("%v", err)
-				continue
-			}
+// allocateRunningPodGUID allocates guid of a running pod network, it fails if the guid is already
+// allocated for another pod network
+func (d *daemon) allocateRunningPodGUID(podGUID string, key utils.PodNetworkKey) error {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
 
-			d.guidPodNetworkMap[podGUID] = podNetworkID
+	if allocatedKey, exist := d.guidPodNetworkMap[podGUID]; exist {
+		if key != allocatedKey {
+			return fmt.Errorf("failed to allocate requested guid %s, already allocated for %s",
+				podGUID, allocatedKey)
 		}
+		return nil
+	}
+
+	if err := d.guidPool.AllocateGUID(podGUID); err != nil {
+		log.Error().Msgf("failed to allocate guid for running pod: %v", err)
+		return nil
 	}
 
+	d.guidPodNetworkMap[podGUID] = key
 	return nil
 }
@@ -0,0 +1,31 @@
+package daemon
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+)
+
+// subnetManagerAvailable returns whether the reconcilers can call the subnet manager. After a degraded
+// start the subnet manager is validated again, and once it is reachable the GUID pool is synced with it so
+// the deferred updates can proceed. It's called with poolMutex held.
+func (d *daemon) subnetManagerAvailable() bool {
+	if !d.smUnavailable {
+		return true
+	}
+
+	if err := d.callSubnetManager(d.smClient.Validate); err != nil {
+		log.Warn().Msgf("deferring subnet manager updates, subnet manager %s is unavailable: %v",
+			d.smClient.Name(), err)
+		return false
+	}
+	if err := d.syncAllocatedGUIDPool(); err != nil {
+		log.Warn().Msgf("deferring subnet manager updates: %v", err)
+		return false
+	}
+
+	d.smUnavailable = false
+	metrics.SMAvailable.Set(1)
+	log.Info().Msgf("subnet manager %s is available, resuming subnet manager updates", d.smClient.Name())
+	return true
+}
@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Degraded Start", func() {
+	const (
+		podGUID  = "02:00:00:00:00:00:00:01"
+		usedGUID = "02:00:00:00:00:00:00:10"
+	)
+
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+	)
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		d = &daemon{
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+			smUnavailable:     true,
+		}
+		// GUID of a running pod allocated by initPool while the subnet manager is unavailable
+		Expect(d.allocatePodNetworkGUID(podGUID, utils.PodNetworkKey{PodUID: "uid-1", NetworkID: "default_ib-net"})).
+			To(Succeed())
+	})
+
+	It("Defer subnet manager updates while the subnet manager is unavailable", func() {
+		smClient.On("Validate", mock.Anything).Return(errors.New("ufm is in maintenance")).Once()
+
+		Expect(d.subnetManagerAvailable()).To(BeFalse())
+		Expect(d.smUnavailable).To(BeTrue())
+		smClient.AssertNotCalled(GinkgoT(), "ListGuidsInUse")
+	})
+	It("Sync guid pool once the subnet manager is available", func() {
+		smClient.On("Validate", mock.Anything).Return(nil).Once()
+		smClient.On("ListGuidsInUse", mock.Anything).Return([]string{usedGUID}, nil).Once()
+
+		Expect(d.subnetManagerAvailable()).To(BeTrue())
+		Expect(d.smUnavailable).To(BeFalse())
+		Expect(d.guidPool.AllocateGUID(usedGUID)).ToNot(Succeed())
+		Expect(d.guidPool.AllocateGUID(podGUID)).ToNot(Succeed())
+
+		// The subnet manager isn't validated again
+		Expect(d.subnetManagerAvailable()).To(BeTrue())
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Keep deferring updates if the guid pool sync fails", func() {
+		smClient.On("Validate", mock.Anything).Return(nil).Once()
+		smClient.On("ListGuidsInUse", mock.Anything).Return(nil, errors.New("request timed out")).Once()
+
+		Expect(d.subnetManagerAvailable()).To(BeFalse())
+		Expect(d.smUnavailable).To(BeTrue())
+	})
+	It("Hold the pod networks while the updates are deferred", func() {
+		const networkID = "default_ib-net"
+		d.deletedPodsSeen = make(map[ibTypes.PodNetworkID]time.Time)
+		pod := &utils.PodRef{Name: "pod", Namespace: "default", UID: "uid"}
+		podNetworkID := ibTypes.PodNetworkID{PodUID: pod.UID, NetworkID: networkID}
+
+		_, held := d.addHeldFor(pod, podNetworkID, time.Now())
+		Expect(held).To(BeTrue())
+		_, held, err := d.deletePodNetwork(context.Background(), networkID, pod, []string{podGUID}, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(held).To(BeTrue())
+		// no subnet manager calls are made while the updates are deferred
+		smClient.AssertNotCalled(GinkgoT(), "RemoveGuidsFromPKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+})
@@ -0,0 +1,197 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+// duplicateGUIDEventReason is the reason of the events recorded on pods which guid is duplicated in the fabric
+const duplicateGUIDEventReason = "DuplicateGUID"
+
+// Kinds of duplicated guids found by the fabric audit
+const (
+	// duplicatePodGUID is a guid configured for several running pods
+	duplicatePodGUID = "pods"
+	// duplicatePKeyGUID is a guid of the pool range member of several network pkeys in the subnet manager
+	duplicatePKeyGUID = "pkeys"
+)
+
+// FabricAuditPeriodicUpdate looks for guids configured for several running pods and guids of the pool range which
+// are members of several network pkeys, as duplicated guids break the InfiniBand connectivity of the pods. The
+// duplicates are reported by metric, and newly found duplicates by a warning event on their pods.
+func (d *daemon) FabricAuditPeriodicUpdate() {
+	log.Info().Msg("running fabric audit")
+	pods, err := d.kubeClient.GetPods(kapi.NamespaceAll)
+	if err != nil {
+		log.Error().Msgf("fabric audit failed to get pods from kubernetes: %v", err)
+		return
+	}
+	podsByUID := make(map[types.UID]*kapi.Pod, len(pods.Items))
+	for index := range pods.Items {
+		podsByUID[pods.Items[index].UID] = &pods.Items[index]
+	}
+
+	podDuplicates := findPodGUIDDuplicates(pods.Items)
+	metrics.FabricDuplicateGUIDs.WithLabelValues(duplicatePodGUID).Set(float64(len(podDuplicates)))
+	duplicates := make(map[string]bool, len(podDuplicates))
+	for podGUID, owners := range podDuplicates {
+		duplicates[duplicatePodGUID+"/"+podGUID] = true
+		names := make([]string, 0, len(owners))
+		for _, owner := range owners {
+			names = append(names, owner.Namespace+"/"+owner.Name)
+		}
+		d.reportDuplicateGUID(duplicatePodGUID, podGUID, owners,
+			fmt.Sprintf("guid %s is configured for several running pods %s", podGUID, strings.Join(names, ", ")))
+	}
+
+	pKeyDuplicates, owners, err := d.findPKeyGUIDDuplicates()
+	if err != nil {
+		log.Error().Msgf("fabric audit failed to check the pkeys members: %v", err)
+	} else {
+		metrics.FabricDuplicateGUIDs.WithLabelValues(duplicatePKeyGUID).Set(float64(len(pKeyDuplicates)))
+		for memberGUID, pKeys := range pKeyDuplicates {
+			duplicates[duplicatePKeyGUID+"/"+memberGUID] = true
+			var owner []*kapi.Pod
+			if pod, exist := podsByUID[owners[memberGUID]]; exist {
+				owner = append(owner, pod)
+			}
+			d.reportDuplicateGUID(duplicatePKeyGUID, memberGUID, owner,
+				fmt.Sprintf("guid %s is a member of several pkeys %s", memberGUID, strings.Join(pKeys, ", ")))
+		}
+	}
+
+	// duplicates which were resolved are reported again if they reappear
+	for reported := range d.reportedDuplicates {
+		if !duplicates[reported] {
+			delete(d.reportedDuplicates, reported)
+		}
+	}
+	log.Info().Msgf("fabric audit finished, %d guids of several pods, %d guids of several pkeys",
+		len(podDuplicates), len(pKeyDuplicates))
+}
+
+// reportDuplicateGUID logs the duplicated guid and records a warning event on its pods the first time it's found
+func (d *daemon) reportDuplicateGUID(kind, duplicateGUID string, pods []*kapi.Pod, message string) {
+	log.Warn().Msgf("fabric audit: %s", message)
+	if d.reportedDuplicates[kind+"/"+duplicateGUID] {
+		return
+	}
+	d.reportedDuplicates[kind+"/"+duplicateGUID] = true
+	for _, pod := range pods {
+		if err := d.kubeClient.CreatePodEvent(pod, kapi.EventTypeWarning, duplicateGUIDEventReason,
+			message); err != nil {
+			log.Warn().Msgf("failed to record duplicate guid event on pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+}
+
+// findPodGUIDDuplicates returns the guids configured for several running pods, with the pods sorted by namespace
+// and name. Terminated and deleted pods are skipped, as their guids may be already allocated for other pods.
+func findPodGUIDDuplicates(pods []kapi.Pod) map[string][]*kapi.Pod {
+	owners := make(map[string][]*kapi.Pod)
+	for index := range pods {
+		pod := &pods[index]
+		if pod.DeletionTimestamp != nil || pod.Status.Phase == kapi.PodSucceeded || pod.Status.Phase == kapi.PodFailed {
+			continue
+		}
+		for podGUID := range configuredPodGUIDs(pod) {
+			owners[podGUID] = append(owners[podGUID], pod)
+		}
+	}
+
+	duplicates := make(map[string][]*kapi.Pod)
+	for podGUID, pods := range owners {
+		if len(pods) < 2 {
+			continue
+		}
+		sort.Slice(pods, func(i, j int) bool {
+			return pods[i].Namespace+"/"+pods[i].Name < pods[j].Namespace+"/"+pods[j].Name
+		})
+		duplicates[podGUID] = pods
+	}
+	return duplicates
+}
+
+// findPKeyGUIDDuplicates returns the guids of the pool range which are members of several pkeys of the networks
+// of the allocated guids, with the sorted pkeys, and the pod owning each allocated guid. The default limited
+// partition isn't checked, as the guids are its members in addition to their network pkey.
+func (d *daemon) findPKeyGUIDDuplicates() (map[string][]string, map[string]types.UID, error) {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	if d.smUnavailable {
+		return nil, nil, fmt.Errorf("subnet manager %s is unavailable", d.smClient.Name())
+	}
+
+	owners := make(map[string]types.UID, len(d.guidPodNetworkMap))
+	networkPKeys := make(map[string]string)
+	pKeys := make(map[int]string)
+	for allocatedGUID, key := range d.guidPodNetworkMap {
+		owners[allocatedGUID] = key.PodUID
+		if key.NetworkID == guidReservationNetworkID || key.NetworkID == stableGUIDNetworkID {
+			continue
+		}
+		if _, resolved := networkPKeys[key.NetworkID]; resolved {
+			continue
+		}
+		networkPKeys[key.NetworkID] = ""
+		_, ibCniSpec, err := d.getIbSriovNetwork(key.NetworkID)
+		if err != nil || ibCniSpec.PKey == "" {
+			continue
+		}
+		// all the guids are limited members of the network using the default limited partition as pkey
+		if d.config.DefaultLimitedPartition != "" && !d.useLimitedPartition(ibCniSpec.PKey) {
+			continue
+		}
+		// all the ports are members of the default partition if it isn't managed
+		if pKey, err := ibUtils.ParsePKey(ibCniSpec.PKey); err == nil && !d.unmanagedDefaultPKey(pKey) {
+			networkPKeys[key.NetworkID] = ibCniSpec.PKey
+			pKeys[pKey] = ibCniSpec.PKey
+		}
+	}
+
+	memberships := make(map[string][]string)
+	for pKey, pKeyStr := range pKeys {
+		var members []net.HardwareAddr
+		err := d.callSubnetManager(func(ctx context.Context) (err error) {
+			members, err = d.smClient.GetPKeyMembers(ctx, pKey)
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, plugins.ErrNotSupported) {
+				log.Debug().Msgf("skipping pkeys audit, subnet manager %s can't report pkey members", d.smClient.Name())
+				return map[string][]string{}, owners, nil
+			}
+			return nil, nil, fmt.Errorf("failed to get members of pkey %s: %v", pKeyStr, err)
+		}
+		for _, member := range members {
+			memberGUID, err := guid.ParseGUID(member.String())
+			if err != nil || !d.guidPool.Contains(memberGUID) {
+				continue
+			}
+			memberships[memberGUID.String()] = append(memberships[memberGUID.String()], pKeyStr)
+		}
+	}
+
+	duplicates := make(map[string][]string)
+	for memberGUID, memberPKeys := range memberships {
+		if len(memberPKeys) < 2 {
+			continue
+		}
+		sort.Strings(memberPKeys)
+		duplicates[memberGUID] = memberPKeys
+	}
+	return duplicates, owners, nil
+}
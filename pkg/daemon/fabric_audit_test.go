@@ -0,0 +1,126 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sTesting "k8s.io/client-go/testing"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Fabric Audit", func() {
+	const (
+		firstGUID  = "02:00:00:00:00:00:00:01"
+		secondGUID = "02:00:00:00:00:00:00:02"
+	)
+
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+	)
+
+	newPod := func(name, podGUID string) *kapi.Pod {
+		return &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name),
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": fmt.Sprintf(`[{"name":"ib-net-a",`+
+				`"namespace":"default","cni-args":{"mellanox.infiniband.app":"configured","guid":%q}}]`, podGUID)}}}
+	}
+	newNetwork := func(name, pKey string) *netapi.NetworkAttachmentDefinition {
+		return &netapi.NetworkAttachmentDefinition{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{Config: fmt.Sprintf(
+				`{"type": "ib-sriov", "cniVersion": "0.3.1", "name": %q, "pkey": %q}`, name, pKey)}}
+	}
+	podEvents := func(name string) []kapi.Event {
+		events, err := d.kubeClient.(*k8sClientFake.Client).Clientset.CoreV1().Events("default").List(
+			context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		var podEvents []kapi.Event
+		for _, event := range events.Items {
+			if event.InvolvedObject.Name == name && event.Reason == duplicateGUIDEventReason {
+				podEvents = append(podEvents, event)
+			}
+		}
+		return podEvents
+	}
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		d = &daemon{
+			guidPool:           guidPool,
+			smClient:           smClient,
+			guidPodNetworkMap:  make(map[string]utils.PodNetworkKey),
+			reportedDuplicates: make(map[string]bool),
+		}
+	})
+
+	It("Find guids configured for several running pods", func() {
+		deleted := newPod("deleted", secondGUID)
+		deleted.DeletionTimestamp = &metav1.Time{}
+		pods := []kapi.Pod{*newPod("pod-b", firstGUID), *newPod("pod-a", firstGUID), *newPod("pod-c", secondGUID),
+			*deleted}
+
+		duplicates := findPodGUIDDuplicates(pods)
+		Expect(duplicates).To(HaveLen(1))
+		Expect(duplicates[firstGUID]).To(HaveLen(2))
+		Expect(duplicates[firstGUID][0].Name).To(Equal("pod-a"))
+		Expect(duplicates[firstGUID][1].Name).To(Equal("pod-b"))
+	})
+
+	It("Report duplicated guids of pods and pkeys once", func() {
+		kubeClient := k8sClientFake.NewClient(newPod("pod-a", firstGUID), newPod("pod-b", firstGUID),
+			newPod("pod-c", secondGUID), newNetwork("ib-net-a", "0x5"), newNetwork("ib-net-b", "0x6"))
+		// the fake clientset doesn't generate names
+		generated := 0
+		kubeClient.Clientset.PrependReactor("create", "events", func(action k8sTesting.Action) (bool,
+			runtime.Object, error) {
+			event := action.(k8sTesting.CreateAction).GetObject().(*kapi.Event)
+			generated++
+			event.Name = fmt.Sprintf("%s%d", event.GenerateName, generated)
+			return false, nil, nil
+		})
+		d.kubeClient = kubeClient
+		d.guidPodNetworkMap[firstGUID] = utils.PodNetworkKey{PodUID: "pod-a", NetworkID: "default_ib-net-a"}
+		d.guidPodNetworkMap[secondGUID] = utils.PodNetworkKey{PodUID: "pod-c", NetworkID: "default_ib-net-b"}
+		first, err := net.ParseMAC(firstGUID)
+		Expect(err).ToNot(HaveOccurred())
+		second, err := net.ParseMAC(secondGUID)
+		Expect(err).ToNot(HaveOccurred())
+		// host port guids out of the pool range are members of several pkeys
+		host, err := net.ParseMAC("0c:42:a1:00:00:00:00:01")
+		Expect(err).ToNot(HaveOccurred())
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return([]net.HardwareAddr{first, host}, nil)
+		smClient.On("GetPKeyMembers", mock.Anything, 0x6).Return([]net.HardwareAddr{second, first, host}, nil)
+
+		d.FabricAuditPeriodicUpdate()
+		Expect(testutil.ToFloat64(metrics.FabricDuplicateGUIDs.WithLabelValues(duplicatePodGUID))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.FabricDuplicateGUIDs.WithLabelValues(duplicatePKeyGUID))).To(Equal(1.0))
+		// pod-a is reported as one of the pods of the guid and as the owner of the guid of several pkeys
+		Expect(podEvents("pod-a")).To(HaveLen(2))
+		Expect(podEvents("pod-b")).To(HaveLen(1))
+		Expect(podEvents("pod-c")).To(BeEmpty())
+
+		d.FabricAuditPeriodicUpdate()
+		Expect(podEvents("pod-a")).To(HaveLen(2))
+		Expect(d.reportedDuplicates).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// guidConflictEventReason is the reason of the event recorded on a pod requesting a guid of another pod network
+const guidConflictEventReason = "GUIDConflict"
+
+// guidConflictError is returned when a pod network requests a guid that is allocated for another pod network
+type guidConflictError struct {
+	guid  string
+	owner utils.PodNetworkKey
+}
+
+func (e *guidConflictError) Error() string {
+	return fmt.Sprintf("failed to allocate requested guid %s, already allocated for %s", e.guid, e.owner)
+}
+
+// flagGUIDConflict makes a guid conflict of the pod visible to its owner by recording a warning event on the pod,
+// the pod network is not configured until the requested guid is released by the other pod network
+func (d *daemon) flagGUIDConflict(pod *utils.PodRef, networkID string, err error) {
+	var conflict *guidConflictError
+	if !errors.As(err, &conflict) {
+		return
+	}
+
+	metrics.GUIDConflicts.Inc()
+	message := fmt.Sprintf("requested guid %s of network %s is already allocated for pod %s network %s",
+		conflict.guid, networkID, conflict.owner.PodUID, conflict.owner.NetworkID)
+	if eventErr := d.kubeClient.CreatePodEvent(pod.Pod(), kapi.EventTypeWarning, guidConflictEventReason,
+		message); eventErr != nil {
+		log.Warn().Msgf("failed to record guid conflict event on pod %s/%s: %v", pod.Namespace, pod.Name, eventErr)
+	}
+}
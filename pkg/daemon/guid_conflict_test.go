@@ -0,0 +1,72 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("GUID Conflict", func() {
+	const requestedGUID = "02:00:00:00:00:00:00:01"
+
+	var (
+		kubeClient *k8sClientFake.Client
+		d          *daemon
+		pod        *kapi.Pod
+	)
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		pod = &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "second", Namespace: "other", UID: "second-uid"}}
+		kubeClient = k8sClientFake.NewClient(pod)
+		d = &daemon{
+			kubeClient:        kubeClient,
+			guidPool:          guidPool,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+		Expect(d.allocatePodNetworkGUID(requestedGUID,
+			utils.PodNetworkKey{PodUID: "first-uid", NetworkID: "default_ib-net"})).To(Succeed())
+	})
+
+	It("Reject guid requested by another pod network", func() {
+		err := d.allocatePodNetworkGUID(requestedGUID,
+			utils.PodNetworkKey{PodUID: "second-uid", NetworkID: "other_ib-net"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("already allocated for first-uid/default_ib-net"))
+		var conflict *guidConflictError
+		Expect(errors.As(err, &conflict)).To(BeTrue())
+	})
+	It("Record warning event on the conflicting pod", func() {
+		err := d.allocatePodNetworkGUID(requestedGUID,
+			utils.PodNetworkKey{PodUID: "second-uid", NetworkID: "other_ib-net"})
+		d.flagGUIDConflict(utils.NewPodRef(pod), "other_ib-net", err)
+
+		events, err := kubeClient.Clientset.CoreV1().Events("other").List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].Type).To(Equal(kapi.EventTypeWarning))
+		Expect(events.Items[0].Reason).To(Equal(guidConflictEventReason))
+		Expect(events.Items[0].InvolvedObject.Name).To(Equal("second"))
+		Expect(events.Items[0].Message).To(ContainSubstring(requestedGUID))
+		Expect(events.Items[0].Message).To(ContainSubstring("first-uid"))
+	})
+	It("Do not flag other errors", func() {
+		d.flagGUIDConflict(utils.NewPodRef(pod), "other_ib-net", errors.New("failed to parse guid"))
+
+		events, err := kubeClient.Clientset.CoreV1().Events("other").List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events.Items).To(BeEmpty())
+	})
+})
@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// GUIDResourcePeriodicUpdate advertises the free guids of the pool as the guid extended resource of the nodes, so
+// the scheduler stops placing the pods requesting it once the pool is exhausted instead of the pods failing after
+// they are scheduled. The capacity of a node is the guids requested by its pods plus the free guids of its
+// sub-range, or of the pool range for the nodes without one, so the quantity left to schedule is the free guids.
+func (d *daemon) GUIDResourcePeriodicUpdate() {
+	nodes, err := d.guidResourceNodes()
+	if err != nil {
+		log.Error().Msgf("failed to get nodes to advertise the guid extended resource: %v", err)
+		return
+	}
+	pods, err := d.kubeClient.GetPods(kapi.NamespaceAll)
+	if err != nil {
+		log.Error().Msgf("failed to get pods to advertise the guid extended resource: %v", err)
+		return
+	}
+	requested := nodesRequestedGUIDs(pods.Items)
+
+	d.poolMutex.Lock()
+	capacities := make(map[string]int64, len(nodes))
+	for _, node := range nodes {
+		capacities[node.Name] = saturatingAdd(requested[node.Name], d.nodeFreeGUIDs(node))
+	}
+	d.poolMutex.Unlock()
+
+	for _, node := range nodes {
+		capacity := capacities[node.Name]
+		if current, exist := node.Status.Capacity[utils.GUIDResourceName]; exist && current.Value() == capacity {
+			continue
+		}
+		if err = d.kubeClient.SetNodeExtendedResource(node.Name, utils.GUIDResourceName, capacity); err != nil {
+			log.Warn().Msgf("failed to set extended resource %s of node %s to %d: %v", utils.GUIDResourceName,
+				node.Name, capacity, err)
+			continue
+		}
+		log.Debug().Msgf("set extended resource %s of node %s to %d", utils.GUIDResourceName, node.Name, capacity)
+	}
+}
+
+// guidResourceNodes returns the nodes advertising the guid extended resource, only the daemon node in node-local
+// mode
+func (d *daemon) guidResourceNodes() ([]*kapi.Node, error) {
+	if d.config.NodeLocal {
+		node, err := d.kubeClient.GetNode(d.config.NodeName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node %s: %v", d.config.NodeName, err)
+		}
+		return []*kapi.Node{node}, nil
+	}
+
+	nodeList, err := d.kubeClient.GetNodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	nodes := make([]*kapi.Node, 0, len(nodeList.Items))
+	for index := range nodeList.Items {
+		nodes = append(nodes, &nodeList.Items[index])
+	}
+	return nodes, nil
+}
+
+// nodeFreeGUIDs returns the free guids the pods of the node can be assigned, from the sub-range of the node or
+// the pool range. It's called with poolMutex held.
+func (d *daemon) nodeFreeGUIDs(node *kapi.Node) int64 {
+	free := d.guidPool.Stats().Free
+	if value, exist := node.Labels[d.config.GUIDPool.NodeLabel]; exist && len(d.nodeGUIDRanges) != 0 {
+		if guidRange, exist := d.nodeGUIDRanges[value]; exist {
+			free = d.guidPool.FreeInRange(guidRange)
+		}
+	}
+	if free > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(free)
+}
+
+// nodesRequestedGUIDs returns the guid extended resource requested by the pods bound to each node, the pods which
+// terminated don't hold their requests
+func nodesRequestedGUIDs(pods []kapi.Pod) map[string]int64 {
+	requested := make(map[string]int64)
+	for index := range pods {
+		pod := &pods[index]
+		if pod.Spec.NodeName == "" || pod.Status.Phase == kapi.PodSucceeded || pod.Status.Phase == kapi.PodFailed {
+			continue
+		}
+		if podRequest := podRequestedGUIDs(pod); podRequest != 0 {
+			requested[pod.Spec.NodeName] = saturatingAdd(requested[pod.Spec.NodeName], podRequest)
+		}
+	}
+	return requested
+}
+
+// podRequestedGUIDs returns the guid extended resource requested by the pod as the scheduler accounts it, the
+// requests of its containers or of its largest init container if larger
+func podRequestedGUIDs(pod *kapi.Pod) int64 {
+	var containers, initContainers int64
+	for index := range pod.Spec.Containers {
+		if quantity, exist := pod.Spec.Containers[index].Resources.Requests[utils.GUIDResourceName]; exist {
+			containers = saturatingAdd(containers, quantity.Value())
+		}
+	}
+	for index := range pod.Spec.InitContainers {
+		quantity, exist := pod.Spec.InitContainers[index].Resources.Requests[utils.GUIDResourceName]
+		if exist && quantity.Value() > initContainers {
+			initContainers = quantity.Value()
+		}
+	}
+	if initContainers > containers {
+		return initContainers
+	}
+	return containers
+}
+
+// saturatingAdd returns the sum of the non-negative quantities, capped to the largest quantity
+func saturatingAdd(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sTesting "k8s.io/client-go/testing"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("GUID Extended Resource", func() {
+	var (
+		kubeClient *k8sClientFake.Client
+		d          *daemon
+	)
+
+	newPod := func(name, nodeName string, guids int64, phase kapi.PodPhase) *kapi.Pod {
+		requests := kapi.ResourceList{utils.GUIDResourceName: *resource.NewQuantity(guids, resource.DecimalSI)}
+		return &kapi.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: kapi.PodSpec{NodeName: nodeName, Containers: []kapi.Container{{Name: "app",
+				Resources: kapi.ResourceRequirements{Requests: requests, Limits: requests}}}},
+			Status: kapi.PodStatus{Phase: phase}}
+	}
+	capacity := func(nodeName string) int64 {
+		node, err := kubeClient.Clientset.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		quantity, exist := node.Status.Capacity[utils.GUIDResourceName]
+		Expect(exist).To(BeTrue())
+		return quantity.Value()
+	}
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+		for _, allocated := range []string{"02:00:00:00:00:00:00:00", "02:00:00:00:00:00:00:01",
+			"02:00:00:00:00:00:00:F0"} {
+			Expect(guidPool.AllocateGUID(allocated)).To(Succeed())
+		}
+
+		kubeClient = k8sClientFake.NewClient(
+			&kapi.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+			&kapi.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2",
+				Labels: map[string]string{"topology.kubernetes.io/zone": "zone-a"}}},
+			newPod("running", "node1", 2, kapi.PodRunning),
+			newPod("completed", "node1", 1, kapi.PodSucceeded),
+			newPod("pending", "", 1, kapi.PodPending),
+			newPod("zone-a", "node2", 1, kapi.PodRunning))
+		d = &daemon{
+			config: config.DaemonConfig{GUIDExtendedResource: true,
+				GUIDPool: config.GUIDPoolConfig{NodeLabel: "topology.kubernetes.io/zone"}},
+			kubeClient: kubeClient,
+			guidPool:   guidPool,
+			nodeGUIDRanges: map[string]guid.Range{
+				"zone-a": {Start: 0x02000000000000F0, End: 0x02000000000000FF}},
+		}
+	})
+
+	It("Advertise the free guids plus the guids requested by the pods of the node", func() {
+		d.GUIDResourcePeriodicUpdate()
+
+		// 253 free guids of the pool range and the 2 guids requested by the running pod
+		Expect(capacity("node1")).To(Equal(int64(255)))
+		// 15 free guids of the node sub-range and the guid requested by its pod
+		Expect(capacity("node2")).To(Equal(int64(16)))
+	})
+	It("Update the nodes only when the free guids change", func() {
+		patches := 0
+		kubeClient.Clientset.PrependReactor("patch", "nodes",
+			func(k8sTesting.Action) (bool, runtime.Object, error) {
+				patches++
+				return false, nil, nil
+			})
+		d.GUIDResourcePeriodicUpdate()
+		Expect(patches).To(Equal(2))
+
+		d.GUIDResourcePeriodicUpdate()
+		Expect(patches).To(Equal(2))
+
+		Expect(d.guidPool.AllocateGUID("02:00:00:00:00:00:00:F1")).To(Succeed())
+		d.GUIDResourcePeriodicUpdate()
+		Expect(patches).To(Equal(4))
+		Expect(capacity("node1")).To(Equal(int64(254)))
+		Expect(capacity("node2")).To(Equal(int64(15)))
+	})
+	It("Advertise the guids of the daemon node only in node-local mode", func() {
+		d.config.NodeLocal, d.config.NodeName = true, "node2"
+
+		d.GUIDResourcePeriodicUpdate()
+
+		Expect(capacity("node2")).To(Equal(int64(16)))
+		node, err := kubeClient.Clientset.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(node.Status.Capacity).ToNot(HaveKey(kapi.ResourceName(utils.GUIDResourceName)))
+	})
+})
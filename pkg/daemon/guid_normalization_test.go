@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("GUID Normalization", func() {
+	const (
+		podGUID      = "02:00:0f:f0:00:00:00:01"
+		upperPodGUID = "02:00:0F:F0:00:00:00:01"
+	)
+
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+	)
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:0f:f0:00:00:00:00", RangeEnd: "02:00:0f:f0:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		d = &daemon{
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+			podNetworks:       utils.NewPodNetworksCache(),
+		}
+	})
+
+	It("Migrate the upper case guid of a pod network annotation", func() {
+		pod := &utils.PodRef{Name: "pod", Namespace: "default", UID: "uid",
+			Annotations: map[string]string{v1.NetworkAttachmentAnnot: `[{"name": "ib-net", "namespace": "default",
+				"cni-args": {"guid": "` + upperPodGUID + `"}}]`}}
+		netMap := networksMap{theMap: make(map[types.UID][]*v1.NetworkSelectionElement),
+			annotations: make(map[types.UID]string)}
+		pis, err := getPodNetworkInfos("default_ib-net", pod, netMap)
+		Expect(err).ToNot(HaveOccurred())
+		pi := pis[0]
+
+		spec := &utils.IbSriovCniSpec{Type: utils.InfiniBandSriovCni, PKey: "0x5"}
+		Expect(d.processNetworkGUID("default_ib-net", spec, pi)).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(podGUID, utils.GeneratePodNetworkKey(pod, pi.ibNetwork)))
+		Expect(pod.Annotations[v1.NetworkAttachmentAnnot]).To(ContainSubstring(podGUID))
+		Expect(pod.Annotations[v1.NetworkAttachmentAnnot]).ToNot(ContainSubstring(upperPodGUID))
+
+		// the guid is released whatever its case
+		Expect(d.releasePodNetworkGUID(upperPodGUID)).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+	})
+	It("Match the guids reported by the subnet manager in another case", func() {
+		Expect(d.allocatePodNetworkGUID(upperPodGUID, utils.PodNetworkKey{PodUID: "uid",
+			NetworkID: "default_ib-net"})).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveKey(podGUID))
+
+		d.config.GUIDPool.ConflictPolicy = config.ConflictPolicyWarn
+		smClient.On("ListGuidsInUse", mock.Anything).Return([]string{"02000FF000000001"}, nil)
+		Expect(d.initSubnetManagerGUIDs()).To(Succeed())
+		Expect(testutil.ToFloat64(metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("foreign"))).To(Equal(0.0))
+	})
+})
@@ -0,0 +1,33 @@
+package daemon
+
+import (
+	"net"
+	"time"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+// podGUIDOwners returns the pods owning the guids allocated to them, keyed by guid, passed to the subnet
+// manager plugin when the guids are added to the pkey
+func podGUIDOwners(pods []*podNetworkInfo) map[string]plugins.GUIDOwner {
+	now := time.Now()
+	owners := make(map[string]plugins.GUIDOwner, len(pods))
+	for _, pi := range pods {
+		owner := plugins.GUIDOwner{Kind: "Pod", Namespace: pi.pod.Namespace, Name: pi.pod.Name, Created: now}
+		owners[pi.addr.String()] = owner
+		for _, extraAddr := range pi.extraAddrs {
+			owners[extraAddr.String()] = owner
+		}
+	}
+	return owners
+}
+
+// guidOwners returns the single owner of all the guids, keyed by guid
+func guidOwners(guids []net.HardwareAddr, owner plugins.GUIDOwner) map[string]plugins.GUIDOwner {
+	owner.Created = time.Now()
+	owners := make(map[string]plugins.GUIDOwner, len(guids))
+	for _, guidAddr := range guids {
+		owners[guidAddr.String()] = owner
+	}
+	return owners
+}
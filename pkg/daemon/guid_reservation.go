@@ -0,0 +1,253 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// guidReservationFinalizer keeps IBGuidReservation objects until their GUID is released
+const guidReservationFinalizer = "ib-kubernetes.nvidia.com/guid-reservation"
+
+// guidReservationNetworkID is the network ID of reservation keys in guidPodNetworkMap
+const guidReservationNetworkID = "ibguidreservation"
+
+// generateGUIDReservationKey returns the key the reservation GUID is mapped to in guidPodNetworkMap
+func generateGUIDReservationKey(reservation *v1alpha1.IBGuidReservation) utils.PodNetworkKey {
+	return utils.PodNetworkKey{PodUID: reservation.UID, NetworkID: guidReservationNetworkID}
+}
+
+// GUIDReservationPeriodicUpdate reconciles IBGuidReservation objects, reserving GUIDs from the pool
+// and adding them to the requested pkey, or releasing them when the reservation is deleted
+func (d *daemon) GUIDReservationPeriodicUpdate() {
+	log.Info().Msg("running guid reservation periodic update")
+	reservations, err := d.kubeClient.GetGUIDReservations(kapi.NamespaceAll)
+	if err != nil {
+		log.Error().Msgf("failed to get guid reservations from kubernetes: %v", err)
+		return
+	}
+
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	if !d.subnetManagerAvailable() {
+		return
+	}
+	policies, err := d.getPartitionPolicies()
+	if err != nil {
+		log.Error().Msgf("deferring guid reservation periodic update: %v", err)
+		return
+	}
+	for index := range reservations.Items {
+		reservation := &reservations.Items[index]
+		if reservation.DeletionTimestamp != nil {
+			err = d.releaseGUIDReservation(reservation)
+		} else if policyErr := checkGUIDReservationPartitionPolicy(policies, reservation); policyErr != nil {
+			err = d.failGUIDReservation(reservation, policyErr)
+		} else {
+			err = d.reconcileGUIDReservation(reservation)
+		}
+
+		if err != nil {
+			log.Error().Msgf("%v", err)
+		}
+	}
+
+	log.Info().Msg("guid reservation periodic update finished")
+}
+
+// checkGUIDReservationPartitionPolicy returns error if the reservation is moved to a pkey which isn't allowed by
+// the partition policies of its namespace. Reservations don't run with a service account, so only policies of
+// the namespace which aren't restricted to service accounts apply.
+func checkGUIDReservationPartitionPolicy(policies *partitionPolicies, reservation *v1alpha1.IBGuidReservation) error {
+	if reservation.Status.PKey == reservation.Spec.PKey {
+		return nil
+	}
+	return policies.check(reservation.Namespace, "", reservation.Spec.PKey)
+}
+
+// reconcileGUIDReservation reserves the GUID of the reservation and adds it to the requested pkey
+func (d *daemon) reconcileGUIDReservation(reservation *v1alpha1.IBGuidReservation) error {
+	reservationKey := generateGUIDReservationKey(reservation)
+	reservedGUID := d.getGUIDByKey(reservationKey)
+	if reservation.Status.State == v1alpha1.GUIDReservationStateAllocated && reservedGUID != "" &&
+		reservation.Status.PKey == reservation.Spec.PKey {
+		return nil
+	}
+
+	if !utils.HasFinalizer(reservation.Finalizers, guidReservationFinalizer) {
+		reservation.Finalizers = append(reservation.Finalizers, guidReservationFinalizer)
+		updated, err := d.kubeClient.UpdateGUIDReservation(reservation)
+		if err != nil {
+			return fmt.Errorf("failed to add finalizer to guid reservation %s/%s: %v",
+				reservation.Namespace, reservation.Name, err)
+		}
+		reservation = updated
+	}
+
+	if reservedGUID == "" {
+		guidAddr, err := d.reserveGUID(reservation, reservationKey)
+		if err != nil {
+			return d.failGUIDReservation(reservation, err)
+		}
+		reservedGUID = guidAddr.String()
+	}
+
+	guidAddr, err := net.ParseMAC(reservedGUID)
+	if err != nil {
+		return d.failGUIDReservation(reservation, err)
+	}
+
+	// Move the GUID to the requested pkey
+	if reservation.Status.PKey != "" && reservation.Status.PKey != reservation.Spec.PKey {
+		if err = d.removeGUIDsFromPKey(reservation.Status.PKey, []net.HardwareAddr{guidAddr}); err != nil {
+			return d.failGUIDReservation(reservation, err)
+		}
+		reservation.Status.PKey = ""
+	}
+
+	if reservation.Spec.PKey != "" {
+		guids := []net.HardwareAddr{guidAddr}
+		owner := plugins.GUIDOwner{Kind: "IBGuidReservation", Namespace: reservation.Namespace, Name: reservation.Name}
+		if err = d.addOwnedGUIDsToPKey(reservation.Spec.PKey, guids, guidOwners(guids, owner)); err != nil {
+			return d.failGUIDReservation(reservation, err)
+		}
+	}
+
+	reservation.Status = v1alpha1.IBGuidReservationStatus{
+		GUID:  reservedGUID,
+		PKey:  reservation.Spec.PKey,
+		State: v1alpha1.GUIDReservationStateAllocated,
+	}
+	if _, err = d.kubeClient.UpdateGUIDReservationStatus(reservation); err != nil {
+		return fmt.Errorf("failed to update guid reservation %s/%s status: %v",
+			reservation.Namespace, reservation.Name, err)
+	}
+
+	log.Info().Msgf("reserved guid %s for guid reservation %s/%s", reservedGUID,
+		reservation.Namespace, reservation.Name)
+	return nil
+}
+
+// reserveGUID allocates the requested GUID of the reservation or the next free GUID in the pool
+func (d *daemon) reserveGUID(reservation *v1alpha1.IBGuidReservation,
+	reservationKey utils.PodNetworkKey) (guid.GUID, error) {
+	if reservation.Spec.GUID != "" {
+		guidAddr, err := guid.ParseGUID(reservation.Spec.GUID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse requested guid %s with error: %v", reservation.Spec.GUID, err)
+		}
+
+		if err = d.allocatePodNetworkGUID(guidAddr.String(), reservationKey); err != nil {
+			return 0, err
+		}
+		return guidAddr, nil
+	}
+
+	guidAddr, err := d.guidPool.GenerateGUID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate GUID for guid reservation %s/%s, with error: %v",
+			reservation.Namespace, reservation.Name, err)
+	}
+
+	if err = d.allocatePodNetworkGUID(guidAddr.String(), reservationKey); err != nil {
+		return 0, err
+	}
+	return guidAddr, nil
+}
+
+// failGUIDReservation sets the reservation state to failed with the given error
+func (d *daemon) failGUIDReservation(reservation *v1alpha1.IBGuidReservation, reservationErr error) error {
+	reservation.Status.State = v1alpha1.GUIDReservationStateFailed
+	reservation.Status.Message = reservationErr.Error()
+	if _, err := d.kubeClient.UpdateGUIDReservationStatus(reservation); err != nil {
+		log.Warn().Msgf("failed to update guid reservation %s/%s status: %v",
+			reservation.Namespace, reservation.Name, err)
+	}
+
+	return fmt.Errorf("failed to reconcile guid reservation %s/%s: %v",
+		reservation.Namespace, reservation.Name, reservationErr)
+}
+
+// releaseGUIDReservation removes the reserved GUID from its pkey, releases it and removes the finalizer
+func (d *daemon) releaseGUIDReservation(reservation *v1alpha1.IBGuidReservation) error {
+	if !utils.HasFinalizer(reservation.Finalizers, guidReservationFinalizer) {
+		return nil
+	}
+
+	reservationKey := generateGUIDReservationKey(reservation)
+	if reservedGUID := d.getGUIDByKey(reservationKey); reservedGUID != "" {
+		guidAddr, err := net.ParseMAC(reservedGUID)
+		if err != nil {
+			return fmt.Errorf("failed to parse reserved guid %s: %v", reservedGUID, err)
+		}
+
+		if reservation.Status.PKey != "" {
+			if err = d.removeGUIDsFromPKey(reservation.Status.PKey, []net.HardwareAddr{guidAddr}); err != nil {
+				return fmt.Errorf("failed to release guid reservation %s/%s: %v",
+					reservation.Namespace, reservation.Name, err)
+			}
+		}
+
+		if err = d.releasePodNetworkGUID(reservedGUID); err != nil {
+			log.Warn().Msgf("failed to release guid %s of guid reservation %s/%s: %v", reservedGUID,
+				reservation.Namespace, reservation.Name, err)
+			delete(d.guidPodNetworkMap, reservedGUID)
+		}
+	}
+
+	reservation.Finalizers = utils.RemoveFinalizer(reservation.Finalizers, guidReservationFinalizer)
+	if _, err := d.kubeClient.UpdateGUIDReservation(reservation); err != nil {
+		return fmt.Errorf("failed to remove finalizer from guid reservation %s/%s: %v",
+			reservation.Namespace, reservation.Name, err)
+	}
+
+	log.Info().Msgf("released guid reservation %s/%s", reservation.Namespace, reservation.Name)
+	return nil
+}
+
+// initGUIDReservations allocates the GUIDs of existing reservations in the pool
+func (d *daemon) initGUIDReservations() error {
+	reservations, err := d.kubeClient.GetGUIDReservations(kapi.NamespaceAll)
+	if err != nil {
+		return fmt.Errorf("failed to get guid reservations from kubernetes: %v", err)
+	}
+
+	for index := range reservations.Items {
+		reservation := &reservations.Items[index]
+		if reservation.Status.GUID == "" {
+			continue
+		}
+
+		guidAddr, err := guid.ParseGUID(reservation.Status.GUID)
+		if err != nil {
+			log.Error().Msgf("failed to parse guid %s of guid reservation %s/%s: %v", reservation.Status.GUID,
+				reservation.Namespace, reservation.Name, err)
+			continue
+		}
+
+		reservationKey := generateGUIDReservationKey(reservation)
+		if err = d.allocatePodNetworkGUID(guidAddr.String(), reservationKey); err != nil {
+			log.Error().Msgf("failed to allocate guid of guid reservation %s/%s: %v",
+				reservation.Namespace, reservation.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// getGUIDByKey returns the GUID mapped to the given key, or empty string if not found
+func (d *daemon) getGUIDByKey(key utils.PodNetworkKey) string {
+	for allocatedGUID, mappedKey := range d.guidPodNetworkMap {
+		if mappedKey == key {
+			return allocatedGUID
+		}
+	}
+	return ""
+}
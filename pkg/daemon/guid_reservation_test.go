@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("GUID Reservation", func() {
+	var (
+		smClient *smMocks.SubnetManagerClient
+		guidPool guid.Pool
+	)
+
+	newTestDaemon := func(reservations ...*v1alpha1.IBGuidReservation) *daemon {
+		objects := make([]runtime.Object, 0, len(reservations))
+		for _, reservation := range reservations {
+			objects = append(objects, reservation)
+		}
+
+		return &daemon{
+			config:            config.DaemonConfig{EnableGUIDReservations: true},
+			kubeClient:        k8sClientFake.NewClient(objects...),
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+	}
+
+	getReservation := func(d *daemon, name string) *v1alpha1.IBGuidReservation {
+		reservations, err := d.kubeClient.GetGUIDReservations(kapi.NamespaceAll)
+		Expect(err).ToNot(HaveOccurred())
+		for index := range reservations.Items {
+			if reservations.Items[index].Name == name {
+				return &reservations.Items[index]
+			}
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		var err error
+		guidPool, err = guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+	})
+
+	It("Reserve generated GUID and add it to pkey", func() {
+		reservation := &v1alpha1.IBGuidReservation{
+			ObjectMeta: metav1.ObjectMeta{Name: "vm", Namespace: "default", UID: "uid-1"},
+			Spec:       v1alpha1.IBGuidReservationSpec{PKey: "0x5"}}
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Return(nil)
+		reservedGUID, err := net.ParseMAC("02:00:00:00:00:00:00:00")
+		Expect(err).ToNot(HaveOccurred())
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return([]net.HardwareAddr{reservedGUID}, nil)
+
+		d := newTestDaemon(reservation)
+		d.GUIDReservationPeriodicUpdate()
+
+		updated := getReservation(d, "vm")
+		Expect(updated.Finalizers).To(ContainElement(guidReservationFinalizer))
+		Expect(updated.Status.State).To(Equal(v1alpha1.GUIDReservationStateAllocated))
+		Expect(updated.Status.PKey).To(Equal("0x5"))
+		Expect(updated.Status.GUID).To(Equal("02:00:00:00:00:00:00:00"))
+		Expect(d.guidPodNetworkMap).To(HaveKey("02:00:00:00:00:00:00:00"))
+		smClient.AssertNumberOfCalls(GinkgoT(), "AddGuidsToPKey", 1)
+
+		// Reconciled reservation is not processed again
+		d.GUIDReservationPeriodicUpdate()
+		smClient.AssertNumberOfCalls(GinkgoT(), "AddGuidsToPKey", 1)
+	})
+	It("Reserve requested GUID without pkey", func() {
+		reservation := &v1alpha1.IBGuidReservation{
+			ObjectMeta: metav1.ObjectMeta{Name: "host", Namespace: "default", UID: "uid-2"},
+			Spec:       v1alpha1.IBGuidReservationSpec{GUID: "02:00:00:00:00:00:00:10"}}
+
+		d := newTestDaemon(reservation)
+		d.GUIDReservationPeriodicUpdate()
+
+		updated := getReservation(d, "host")
+		Expect(updated.Status.State).To(Equal(v1alpha1.GUIDReservationStateAllocated))
+		Expect(updated.Status.GUID).To(Equal("02:00:00:00:00:00:00:10"))
+		Expect(guidPool.AllocateGUID("02:00:00:00:00:00:00:10")).ToNot(Succeed())
+		smClient.AssertNotCalled(GinkgoT(), "AddGuidsToPKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+	It("Fail reservation of GUID already allocated by a pod", func() {
+		reservation := &v1alpha1.IBGuidReservation{
+			ObjectMeta: metav1.ObjectMeta{Name: "host", Namespace: "default", UID: "uid-3"},
+			Spec:       v1alpha1.IBGuidReservationSpec{GUID: "02:00:00:00:00:00:00:10"}}
+
+		d := newTestDaemon(reservation)
+		podKey := utils.PodNetworkKey{PodUID: "pod-uid", NetworkID: "default_net"}
+		Expect(d.allocatePodNetworkGUID("02:00:00:00:00:00:00:10", podKey)).To(Succeed())
+		d.GUIDReservationPeriodicUpdate()
+
+		updated := getReservation(d, "host")
+		Expect(updated.Status.State).To(Equal(v1alpha1.GUIDReservationStateFailed))
+		Expect(updated.Status.Message).To(ContainSubstring("already allocated"))
+		Expect(d.guidPodNetworkMap["02:00:00:00:00:00:00:10"]).To(Equal(podKey))
+	})
+	It("Release GUID of deleted reservation", func() {
+		now := metav1.Now()
+		reservation := &v1alpha1.IBGuidReservation{
+			ObjectMeta: metav1.ObjectMeta{Name: "vm", Namespace: "default", UID: "uid-4",
+				DeletionTimestamp: &now, Finalizers: []string{guidReservationFinalizer}},
+			Spec: v1alpha1.IBGuidReservationSpec{PKey: "0x5"},
+			Status: v1alpha1.IBGuidReservationStatus{GUID: "02:00:00:00:00:00:00:20", PKey: "0x5",
+				State: v1alpha1.GUIDReservationStateAllocated}}
+		guidAddr, err := net.ParseMAC("02:00:00:00:00:00:00:20")
+		Expect(err).ToNot(HaveOccurred())
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr{guidAddr}).Return(nil)
+
+		d := newTestDaemon(reservation)
+		Expect(d.initGUIDReservations()).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveKey("02:00:00:00:00:00:00:20"))
+
+		d.GUIDReservationPeriodicUpdate()
+		smClient.AssertExpectations(GinkgoT())
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey("02:00:00:00:00:00:00:20"))
+		Expect(guidPool.AllocateGUID("02:00:00:00:00:00:00:20")).To(Succeed())
+		Expect(getReservation(d, "vm").Finalizers).To(BeEmpty())
+	})
+})
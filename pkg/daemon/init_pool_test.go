@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sMocks "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Init Pool", func() {
+	var (
+		kubeClient *k8sMocks.Client
+		guidPool   guid.Pool
+	)
+
+	newPod := func(uid, podGUID string) kapi.Pod {
+		networks := fmt.Sprintf(`[{"name":"ib-net","namespace":"default",`+
+			`"cni-args":{"mellanox.infiniband.app":"configured","guid":%q}}]`, podGUID)
+		return kapi.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "pod-" + uid, Namespace: "default", UID: types.UID(uid),
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": networks}}}
+	}
+
+	newPage := func(continueToken string, pods ...kapi.Pod) *kapi.PodList {
+		return &kapi.PodList{ListMeta: metav1.ListMeta{Continue: continueToken}, Items: pods}
+	}
+
+	newTestDaemon := func() *daemon {
+		return &daemon{
+			config:            config.DaemonConfig{},
+			kubeClient:        kubeClient,
+			guidPool:          guidPool,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		guidPool, err = guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		kubeClient = &k8sMocks.Client{}
+	})
+
+	It("Allocate GUIDs of pods from all pages", func() {
+		kubeClient.On("GetPodsPage", kapi.NamespaceAll, initPoolPageSize, "").Return(
+			newPage("page-2", newPod("uid-1", "02:00:00:00:00:00:00:01")), nil)
+		kubeClient.On("GetPodsPage", kapi.NamespaceAll, initPoolPageSize, "page-2").Return(
+			newPage("", newPod("uid-2", "02:00:00:00:00:00:00:02"), kapi.Pod{}), nil)
+
+		d := newTestDaemon()
+		Expect(d.initPool()).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(Equal(map[string]utils.PodNetworkKey{
+			"02:00:00:00:00:00:00:01": {PodUID: "uid-1", NetworkID: "default_ib-net"},
+			"02:00:00:00:00:00:00:02": {PodUID: "uid-2", NetworkID: "default_ib-net"},
+		}))
+		kubeClient.AssertNumberOfCalls(GinkgoT(), "GetPodsPage", 2)
+	})
+
+	It("Restart listing when continue token expired", func() {
+		kubeClient.On("GetPodsPage", kapi.NamespaceAll, initPoolPageSize, "").Return(
+			newPage("page-2", newPod("uid-1", "02:00:00:00:00:00:00:01")), nil).Once()
+		kubeClient.On("GetPodsPage", kapi.NamespaceAll, initPoolPageSize, "page-2").Return(
+			nil, kerrors.NewResourceExpired("continue token expired")).Once()
+		kubeClient.On("GetPodsPage", kapi.NamespaceAll, initPoolPageSize, "").Return(
+			newPage("", newPod("uid-1", "02:00:00:00:00:00:00:01"),
+				newPod("uid-2", "02:00:00:00:00:00:00:02")), nil).Once()
+
+		d := newTestDaemon()
+		Expect(d.initPool()).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveLen(2))
+		kubeClient.AssertNumberOfCalls(GinkgoT(), "GetPodsPage", 3)
+	})
+
+	It("Fail when the same GUID is used by different pods", func() {
+		kubeClient.On("GetPodsPage", kapi.NamespaceAll, initPoolPageSize, "").Return(
+			newPage("page-2", newPod("uid-1", "02:00:00:00:00:00:00:01")), nil)
+		kubeClient.On("GetPodsPage", kapi.NamespaceAll, initPoolPageSize, "page-2").Return(
+			newPage("", newPod("uid-2", "02:00:00:00:00:00:00:01")), nil)
+
+		d := newTestDaemon()
+		Expect(d.initPool()).ToNot(Succeed())
+	})
+	It("Allocate GUIDs of the same network attached to multiple pod interfaces", func() {
+		networks := `[{"name":"ib-net","namespace":"default","interface":"net1",` +
+			`"cni-args":{"mellanox.infiniband.app":"configured","guid":"02:00:00:00:00:00:00:01"}},` +
+			`{"name":"ib-net","namespace":"default","interface":"net2",` +
+			`"cni-args":{"mellanox.infiniband.app":"configured","guid":"02:00:00:00:00:00:00:02"}}]`
+		pod := kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid-1",
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": networks}}}
+		kubeClient.On("GetPodsPage", kapi.NamespaceAll, initPoolPageSize, "").Return(newPage("", pod), nil)
+
+		d := newTestDaemon()
+		Expect(d.initPool()).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(Equal(map[string]utils.PodNetworkKey{
+			"02:00:00:00:00:00:00:01": {PodUID: "uid-1", NetworkID: "default_ib-net", Interface: "net1"},
+			"02:00:00:00:00:00:00:02": {PodUID: "uid-1", NetworkID: "default_ib-net", Interface: "net2"},
+		}))
+
+		// Keys of running pods match the keys computed when the pods are processed again
+		for guidStr, key := range d.guidPodNetworkMap {
+			Expect(d.allocatePodNetworkGUID(guidStr, key)).To(Succeed())
+		}
+	})
+})
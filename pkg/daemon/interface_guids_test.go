@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"encoding/json"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Interface GUIDs", func() {
+	const networkID = "default_ib-net"
+
+	var (
+		d    *daemon
+		pod  *utils.PodRef
+		spec *utils.IbSriovCniSpec
+	)
+
+	processPod := func() *podNetworkInfo {
+		netMap := networksMap{theMap: make(map[types.UID][]*v1.NetworkSelectionElement),
+			annotations: make(map[types.UID]string)}
+		pis, err := getPodNetworkInfos(networkID, pod, netMap)
+		Expect(err).ToNot(HaveOccurred())
+		pi := pis[0]
+		Expect(d.processNetworkGUID(networkID, spec, pi)).To(Succeed())
+		return pi
+	}
+
+	BeforeEach(func() {
+		pod = &utils.PodRef{Name: "pod", Namespace: "default", UID: "uid",
+			Annotations: map[string]string{v1.NetworkAttachmentAnnot: `[{"name": "ib-net", "namespace": "default"}]`}}
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+		d = &daemon{
+			guidPool:          guidPool,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+			podNetworks:       utils.NewPodNetworksCache(),
+		}
+		spec = &utils.IbSriovCniSpec{Type: utils.InfiniBandSriovCni, PKey: "0x5", GUIDsPerInterface: 3}
+	})
+
+	It("Allocate the guids of an interface and set them on the pod network", func() {
+		pi := processPod()
+		Expect(pi.extraAddrs).To(HaveLen(2))
+
+		guids, err := utils.GetPodNetworkGUIDs(pi.ibNetwork)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(guids).To(HaveLen(3))
+		Expect(guids[0]).To(Equal(pi.addr.String()))
+		key := utils.GeneratePodNetworkKey(pod, pi.ibNetwork)
+		for _, allocatedGUID := range guids {
+			Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(allocatedGUID, key))
+		}
+
+		// all the guids of the interface are released with the pod
+		Expect(d.podGUIDs(pod.UID)).To(HaveLen(1))
+		Expect(d.podGUIDs(pod.UID)[key]).To(ConsistOf(guids))
+	})
+	It("Reuse the guids already set on a rescheduled pod network", func() {
+		pod.Annotations[v1.NetworkAttachmentAnnot] = `[{"name": "ib-net", "namespace": "default",
+			"cni-args": {"guid": "02:00:00:00:00:00:00:10",
+			"guids": ["02:00:00:00:00:00:00:10", "02:00:00:00:00:00:00:11"]}}]`
+		pi := processPod()
+		Expect(pi.addr.String()).To(Equal("02:00:00:00:00:00:00:10"))
+		Expect(pi.extraAddrs).To(HaveLen(2))
+		Expect(pi.extraAddrs[0].String()).To(Equal("02:00:00:00:00:00:00:11"))
+		Expect(d.guidPodNetworkMap).To(HaveLen(3))
+	})
+	It("Keep a single guid per interface by default", func() {
+		spec.GUIDsPerInterface = 0
+		pi := processPod()
+		Expect(pi.extraAddrs).To(BeEmpty())
+		guids, err := utils.GetPodNetworkGUIDs(pi.ibNetwork)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(guids).To(Equal([]string{pi.addr.String()}))
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+	})
+	It("Name and configure each interface of a network listed several times", func() {
+		spec.GUIDsPerInterface = 0
+		pod.Annotations[v1.NetworkAttachmentAnnot] = `[{"name": "ib-net", "namespace": "default"},
+			{"name": "ib-net", "namespace": "default"}]`
+		netMap := networksMap{theMap: make(map[types.UID][]*v1.NetworkSelectionElement),
+			annotations: make(map[types.UID]string)}
+		pis, err := getPodNetworkInfos(networkID, pod, netMap)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pis).To(HaveLen(2))
+		for _, pi := range pis {
+			Expect(d.processNetworkGUID(networkID, spec, pi)).To(Succeed())
+			(*pi.ibNetwork.CNIArgs)[utils.InfiniBandAnnotation] = utils.ConfiguredInfiniBandPod
+		}
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(pis[0].addr.String(),
+			utils.PodNetworkKey{PodUID: "uid", NetworkID: networkID, Interface: "net1"}))
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(pis[1].addr.String(),
+			utils.PodNetworkKey{PodUID: "uid", NetworkID: networkID, Interface: "net2"}))
+
+		// the interface names are written back, so the guids keep their interface if the networks are reordered
+		networks := []*v1.NetworkSelectionElement{pis[1].ibNetwork, pis[0].ibNetwork}
+		netAnnotations, err := json.Marshal(networks)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(netAnnotations)).To(ContainSubstring(`"interface":"net2"`))
+		pod.Annotations[v1.NetworkAttachmentAnnot] = string(netAnnotations)
+		pis, err = getPodNetworkInfos(networkID, pod, networksMap{
+			theMap: make(map[types.UID][]*v1.NetworkSelectionElement), annotations: make(map[types.UID]string)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pis[0].ibNetwork.InterfaceRequest).To(Equal("net2"))
+		Expect(d.processNetworkGUID(networkID, spec, pis[0])).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveLen(2))
+
+		Expect(d.podGUIDs(pod.UID)).To(HaveLen(2))
+	})
+	It("Release the generated guids if the interface can't get all its guids", func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:01"})
+		Expect(err).ToNot(HaveOccurred())
+		d.guidPool = guidPool
+		netMap := networksMap{theMap: make(map[types.UID][]*v1.NetworkSelectionElement),
+			annotations: make(map[types.UID]string)}
+		pis, err := getPodNetworkInfos(networkID, pod, netMap)
+		Expect(err).ToNot(HaveOccurred())
+		pi := pis[0]
+		Expect(d.processNetworkGUID(networkID, spec, pi)).ToNot(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/leaderelection"
+
+	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+)
+
+const (
+	leaderElectedReason = "LeaderElected"
+	leaderLostReason    = "LeaderLost"
+	// leader election events reported by the client-go leader elector through RecordEvent
+	becameLeaderEvent   = "became leader"
+	stoppedLeadingEvent = "stopped leading"
+)
+
+// noEventRecorderProvider makes the controller runtime resource lock skip its own events, the observed lock
+// records them through the daemon kubernetes client
+type noEventRecorderProvider struct{}
+
+func (noEventRecorderProvider) GetEventRecorderFor(string) record.EventRecorder {
+	return nil
+}
+
+// newLeaderElectionLock creates the leader election resource lock of the controller manager wrapped to export
+// the leader election metrics and events
+func newLeaderElectionLock(restConfig *rest.Config, namespace string,
+	kubeClient k8sClient.Client) (resourcelock.Interface, error) {
+	lock, err := leaderelection.NewResourceLock(rest.CopyConfig(restConfig), noEventRecorderProvider{},
+		leaderelection.Options{
+			LeaderElection:          true,
+			LeaderElectionID:        leaderElectionID,
+			LeaderElectionNamespace: namespace,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create leader election lock: %v", err)
+	}
+	return newObservedLock(lock, kubeClient), nil
+}
+
+// observedLock is a leader election resource lock exporting leadership transitions, the current leader, the
+// time the lease was acquired and the failed renewals as metrics, and the leadership changes of the replica as
+// events on the lease
+type observedLock struct {
+	resourcelock.Interface
+	kubeClient k8sClient.Client
+
+	mutex  sync.Mutex
+	holder string
+	// acquired is the acquire time of the lease held by the replica, zero if it isn't the leader
+	acquired time.Time
+}
+
+func newObservedLock(lock resourcelock.Interface, kubeClient k8sClient.Client) *observedLock {
+	return &observedLock{Interface: lock, kubeClient: kubeClient}
+}
+
+// Get reads the leader election record and observes its holder
+func (l *observedLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	record, raw, err := l.Interface.Get(ctx)
+	if err == nil {
+		l.observe(record)
+	}
+	return record, raw, err
+}
+
+// Create creates the leader election record and observes its holder
+func (l *observedLock) Create(ctx context.Context, record resourcelock.LeaderElectionRecord) error {
+	if err := l.Interface.Create(ctx, record); err != nil {
+		return err
+	}
+	l.observe(&record)
+	return nil
+}
+
+// Update updates the leader election record and observes its holder, a failed update of the lease held by the
+// replica is counted as a failed renewal
+func (l *observedLock) Update(ctx context.Context, record resourcelock.LeaderElectionRecord) error {
+	if err := l.Interface.Update(ctx, record); err != nil {
+		l.mutex.Lock()
+		holding := !l.acquired.IsZero()
+		l.mutex.Unlock()
+		if holding {
+			metrics.LeaderElectionRenewFailures.Inc()
+		}
+		return err
+	}
+	l.observe(&record)
+	return nil
+}
+
+// RecordEvent records the leadership changes of the replica as events on the lease
+func (l *observedLock) RecordEvent(event string) {
+	eventType, reason := kapi.EventTypeNormal, leaderElectedReason
+	switch event {
+	case becameLeaderEvent:
+	case stoppedLeadingEvent:
+		eventType, reason = kapi.EventTypeWarning, leaderLostReason
+		l.mutex.Lock()
+		l.acquired = time.Time{}
+		l.mutex.Unlock()
+		metrics.LeaderElectionLeaseAcquired.Set(0)
+	default:
+		return
+	}
+
+	namespace, name, _ := strings.Cut(l.Describe(), "/")
+	message := fmt.Sprintf("%s %s", l.Identity(), event)
+	// the event is recorded asynchronously to not delay the leader elector, which exits when leadership is lost
+	go func() {
+		if err := l.kubeClient.CreateLeaseEvent(namespace, name, eventType, reason, message); err != nil {
+			log.Warn().Msgf("failed to record leader election event %s on lease %s: %v", reason, l.Describe(), err)
+		}
+	}()
+}
+
+// observe updates the leader election metrics from the holder of the leader election record
+func (l *observedLock) observe(record *resourcelock.LeaderElectionRecord) {
+	if record == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if record.HolderIdentity != l.holder {
+		if l.holder != "" {
+			metrics.LeaderElectionTransitions.Inc()
+		}
+		log.Info().Msgf("leader election lease %s is held by %q", l.Describe(), record.HolderIdentity)
+		l.holder = record.HolderIdentity
+		metrics.LeaderElectionLeader.Reset()
+		if l.holder != "" {
+			metrics.LeaderElectionLeader.WithLabelValues(l.holder).Set(1)
+		}
+	}
+
+	switch {
+	case l.holder != l.Identity():
+		if !l.acquired.IsZero() {
+			l.acquired = time.Time{}
+			metrics.LeaderElectionLeaseAcquired.Set(0)
+		}
+	case l.acquired.IsZero():
+		l.acquired = record.AcquireTime.Time
+		if l.acquired.IsZero() {
+			l.acquired = time.Now()
+		}
+		metrics.LeaderElectionLeaseAcquired.Set(float64(l.acquired.Unix()))
+	}
+}
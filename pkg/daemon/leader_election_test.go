@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+)
+
+// fakeLock is an in memory leader election resource lock
+type fakeLock struct {
+	identity  string
+	record    *resourcelock.LeaderElectionRecord
+	updateErr error
+}
+
+func (f *fakeLock) Get(context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	if f.record == nil {
+		return nil, nil, errors.New("not found")
+	}
+	return f.record, nil, nil
+}
+
+func (f *fakeLock) Create(_ context.Context, record resourcelock.LeaderElectionRecord) error {
+	f.record = &record
+	return nil
+}
+
+func (f *fakeLock) Update(_ context.Context, record resourcelock.LeaderElectionRecord) error {
+	if f.updateErr != nil {
+		return f.updateErr
+	}
+	f.record = &record
+	return nil
+}
+
+func (f *fakeLock) RecordEvent(string) {}
+
+func (f *fakeLock) Identity() string {
+	return f.identity
+}
+
+func (f *fakeLock) Describe() string {
+	return "kube-system/" + leaderElectionID
+}
+
+var _ = Describe("Leader Election", func() {
+	var (
+		kubeClient *k8sClientFake.Client
+		inner      *fakeLock
+		lock       *observedLock
+	)
+
+	leaseEvents := func() []kapi.Event {
+		events, err := kubeClient.Clientset.CoreV1().Events("kube-system").List(context.Background(),
+			metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return events.Items
+	}
+
+	BeforeEach(func() {
+		metrics.LeaderElectionLeader.Reset()
+		metrics.LeaderElectionLeaseAcquired.Set(0)
+		kubeClient = k8sClientFake.NewClient()
+		inner = &fakeLock{identity: "replica-a"}
+		lock = newObservedLock(inner, kubeClient)
+	})
+
+	It("exports the leader and the lease acquire time", func() {
+		acquired := metav1.NewTime(time.Unix(1700000000, 0))
+		Expect(lock.Create(context.Background(), resourcelock.LeaderElectionRecord{
+			HolderIdentity: "replica-a", AcquireTime: acquired})).To(Succeed())
+
+		Expect(testutil.ToFloat64(metrics.LeaderElectionLeader.WithLabelValues("replica-a"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.LeaderElectionLeaseAcquired)).To(Equal(1700000000.0))
+	})
+	It("counts leader transitions", func() {
+		inner.record = &resourcelock.LeaderElectionRecord{HolderIdentity: "replica-b"}
+		transitions := testutil.ToFloat64(metrics.LeaderElectionTransitions)
+		_, _, err := lock.Get(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(testutil.ToFloat64(metrics.LeaderElectionTransitions)).To(Equal(transitions))
+
+		Expect(lock.Update(context.Background(), resourcelock.LeaderElectionRecord{
+			HolderIdentity: "replica-a"})).To(Succeed())
+
+		Expect(testutil.ToFloat64(metrics.LeaderElectionTransitions)).To(Equal(transitions + 1))
+		Expect(testutil.CollectAndCount(metrics.LeaderElectionLeader)).To(Equal(1))
+		Expect(testutil.ToFloat64(metrics.LeaderElectionLeader.WithLabelValues("replica-a"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.LeaderElectionLeaseAcquired)).ToNot(BeZero())
+	})
+	It("counts failed renewals of the held lease only", func() {
+		inner.updateErr = errors.New("conflict")
+		failures := testutil.ToFloat64(metrics.LeaderElectionRenewFailures)
+		Expect(lock.Update(context.Background(), resourcelock.LeaderElectionRecord{
+			HolderIdentity: "replica-a"})).ToNot(Succeed())
+		Expect(testutil.ToFloat64(metrics.LeaderElectionRenewFailures)).To(Equal(failures))
+
+		inner.updateErr = nil
+		Expect(lock.Update(context.Background(), resourcelock.LeaderElectionRecord{
+			HolderIdentity: "replica-a"})).To(Succeed())
+		inner.updateErr = errors.New("timeout")
+		Expect(lock.Update(context.Background(), resourcelock.LeaderElectionRecord{
+			HolderIdentity: "replica-a"})).ToNot(Succeed())
+		Expect(testutil.ToFloat64(metrics.LeaderElectionRenewFailures)).To(Equal(failures + 1))
+	})
+	It("records becoming the leader as an event on the lease", func() {
+		lock.RecordEvent(becameLeaderEvent)
+
+		Eventually(leaseEvents).Should(HaveLen(1))
+		event := leaseEvents()[0]
+		Expect(event.InvolvedObject.Kind).To(Equal("Lease"))
+		Expect(event.InvolvedObject.Name).To(Equal(leaderElectionID))
+		Expect(event.Type).To(Equal(kapi.EventTypeNormal))
+		Expect(event.Reason).To(Equal(leaderElectedReason))
+	})
+	It("records losing the leadership as an event on the lease", func() {
+		Expect(lock.Create(context.Background(), resourcelock.LeaderElectionRecord{
+			HolderIdentity: "replica-a"})).To(Succeed())
+		Expect(testutil.ToFloat64(metrics.LeaderElectionLeaseAcquired)).ToNot(BeZero())
+
+		lock.RecordEvent(stoppedLeadingEvent)
+
+		Eventually(leaseEvents).Should(HaveLen(1))
+		Expect(leaseEvents()[0].Type).To(Equal(kapi.EventTypeWarning))
+		Expect(leaseEvents()[0].Reason).To(Equal(leaderLostReason))
+		Expect(testutil.ToFloat64(metrics.LeaderElectionLeaseAcquired)).To(BeZero())
+	})
+})
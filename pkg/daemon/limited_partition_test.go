@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+)
+
+var _ = Describe("Default Limited Partition", func() {
+	var (
+		smClient *smMocks.SubnetManagerClient
+		guids    []net.HardwareAddr
+	)
+
+	newTestDaemon := func(defaultLimitedPartition string) *daemon {
+		return &daemon{
+			config:   config.DaemonConfig{DefaultLimitedPartition: defaultLimitedPartition, ManageDefaultPKey: true},
+			smClient: smClient,
+		}
+	}
+
+	BeforeEach(func() {
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		guid, err := net.ParseMAC("02:00:00:00:00:00:00:01")
+		Expect(err).ToNot(HaveOccurred())
+		guids = []net.HardwareAddr{guid}
+	})
+
+	It("Add and remove guids as limited members of the default partition", func() {
+		smClient.On("AddGuidsToLimitedPKey", mock.Anything, 0x7FFF, guids).Return(nil)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x7FFF, guids).Return(nil)
+
+		d := newTestDaemon("0x7FFF")
+		Expect(d.addGUIDsToLimitedPartition("0x5", guids)).To(Succeed())
+		Expect(d.removeGUIDsFromLimitedPartition("0x5", guids)).To(Succeed())
+		Expect(d.addGUIDsToLimitedPartition("", guids)).To(Succeed())
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Skip the default partition when it is the network pkey", func() {
+		d := newTestDaemon("0x7FFF")
+		Expect(d.addGUIDsToLimitedPartition("0x7fff", guids)).To(Succeed())
+		Expect(d.removeGUIDsFromLimitedPartition("0x7FFF", guids)).To(Succeed())
+		smClient.AssertNotCalled(GinkgoT(), "AddGuidsToLimitedPKey")
+		smClient.AssertNotCalled(GinkgoT(), "RemoveGuidsFromPKey")
+	})
+	It("Skip the default partition pkey when it is not managed", func() {
+		d := newTestDaemon("")
+		d.config.ManageDefaultPKey = false
+		Expect(d.addGUIDsToPKey("0x7FFF", guids)).To(Succeed())
+		Expect(d.removeGUIDsFromPKey("0xFFFF", guids)).To(Succeed())
+		smClient.AssertNotCalled(GinkgoT(), "AddGuidsToPKey")
+		smClient.AssertNotCalled(GinkgoT(), "RemoveGuidsFromPKey")
+	})
+	It("Skip the default partition when it is not configured", func() {
+		d := newTestDaemon("")
+		Expect(d.addGUIDsToLimitedPartition("0x5", guids)).To(Succeed())
+		Expect(d.removeGUIDsFromLimitedPartition("0x5", guids)).To(Succeed())
+		smClient.AssertNotCalled(GinkgoT(), "AddGuidsToLimitedPKey")
+	})
+})
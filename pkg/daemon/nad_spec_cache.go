@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// nadSpec is the parsed ib-sriov spec of a network attachment definition at a given resource version
+type nadSpec struct {
+	resourceVersion string
+	config          string
+	spec            *utils.IbSriovCniSpec
+}
+
+// parseNetworkAttachmentSpec returns the ib-sriov spec of the network attachment definition. Parsed specs are
+// cached by network and resource version, so the spec is parsed again only after the network is updated.
+// Updates of the network metadata only, e.g. its status annotation, keep the cached spec.
+// The returned spec is a copy which the caller may modify.
+func (d *daemon) parseNetworkAttachmentSpec(netAttDef *v1.NetworkAttachmentDefinition) (*utils.IbSriovCniSpec,
+	error) {
+	networkID := ibTypes.NewNetworkID(netAttDef.Namespace, netAttDef.Name).String()
+	cacheable := d.nadSpecs != nil && netAttDef.ResourceVersion != ""
+	if cacheable {
+		if cached, ok := d.nadSpecs.Get(networkID); ok {
+			entry := cached.(*nadSpec)
+			if entry.resourceVersion == netAttDef.ResourceVersion {
+				return copyIbSriovCniSpec(entry.spec), nil
+			}
+			if entry.config == netAttDef.Spec.Config {
+				d.nadSpecs.Set(networkID, &nadSpec{resourceVersion: netAttDef.ResourceVersion,
+					config: entry.config, spec: entry.spec})
+				return copyIbSriovCniSpec(entry.spec), nil
+			}
+		}
+	}
+
+	networkSpec := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(netAttDef.Spec.Config), &networkSpec); err != nil {
+		return nil, fmt.Errorf("failed to parse networkName attachment %s with error: %v", netAttDef.Name, err)
+	}
+
+	ibCniSpec, err := utils.GetIbSriovCniFromNetwork(networkSpec)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get InfiniBand SR-IOV CNI spec from network attachment %+v, with error %v",
+			networkSpec, err)
+	}
+
+	if cacheable {
+		// replacing the entry of the network drops the spec of its previous resource version
+		d.nadSpecs.Set(networkID, &nadSpec{resourceVersion: netAttDef.ResourceVersion,
+			config: netAttDef.Spec.Config, spec: ibCniSpec})
+	}
+	return copyIbSriovCniSpec(ibCniSpec), nil
+}
+
+// invalidateNetworkAttachmentSpec drops the cached spec of the network
+func (d *daemon) invalidateNetworkAttachmentSpec(networkID string) {
+	if d.nadSpecs != nil {
+		d.nadSpecs.Remove(networkID)
+	}
+}
+
+func copyIbSriovCniSpec(spec *utils.IbSriovCniSpec) *utils.IbSriovCniSpec {
+	specCopy := *spec
+	specCopy.Capabilities = utils.IbSriovCniCapabilities{
+		InfiniBandGUID: copyCapability(spec.Capabilities.InfiniBandGUID),
+		InfiniBandPKey: copyCapability(spec.Capabilities.InfiniBandPKey),
+		RDMAIsolation:  copyCapability(spec.Capabilities.RDMAIsolation),
+	}
+	return &specCopy
+}
+
+func copyCapability(capability *bool) *bool {
+	if capability == nil {
+		return nil
+	}
+	enabled := *capability
+	return &enabled
+}
@@ -0,0 +1,206 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// terminatingNamespace holds the pods and network pkeys of a namespace recorded while it's terminating, so the
+// guids of its pods can be cleaned up once it's deleted, even if the pods and networks are already gone
+type terminatingNamespace struct {
+	podUIDs map[types.UID]bool
+	// pKeys maps the networks of the guids of the namespace to their pkey
+	pKeys map[string]string
+}
+
+// namespaceReconciler cleans up the guids of the pods of deleted namespaces
+type namespaceReconciler struct {
+	reader client.Reader
+	d      *daemon
+}
+
+// Reconcile records the pods of a terminating namespace and cleans up the guids still allocated to them once
+// the namespace is deleted, failed cleanups are requeued
+func (r *namespaceReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	namespace := &kapi.Namespace{}
+	err := r.reader.Get(ctx, req.NamespacedName, namespace)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return reconcile.Result{}, err
+	}
+
+	pods := &kapi.PodList{}
+	if err == nil {
+		if namespace.DeletionTimestamp == nil {
+			return reconcile.Result{}, nil
+		}
+		if err = r.reader.List(ctx, pods, client.InNamespace(req.Name)); err != nil {
+			return reconcile.Result{}, err
+		}
+		r.d.recordTerminatingNamespace(req.Name, pods.Items)
+		return reconcile.Result{}, nil
+	}
+
+	// the pods still running are listed from all the namespaces, as the pods of the guids allocated for the
+	// networks of the deleted namespace may run in other namespaces
+	if err = r.reader.List(ctx, pods); err != nil {
+		return reconcile.Result{}, err
+	}
+	if _, err = r.d.CleanupNamespace(req.Name, pods.Items); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, nil
+}
+
+// recordTerminatingNamespace records the pods of the terminating namespace and the pkeys of the networks of
+// their guids, before the namespace pods and networks are deleted
+func (d *daemon) recordTerminatingNamespace(namespace string, pods []kapi.Pod) {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	if d.terminatingNamespaces == nil {
+		d.terminatingNamespaces = make(map[string]*terminatingNamespace)
+	}
+	terminating, exist := d.terminatingNamespaces[namespace]
+	if !exist {
+		log.Info().Msgf("namespace %s is terminating, recording its pods to clean up their guids", namespace)
+		terminating = &terminatingNamespace{podUIDs: make(map[types.UID]bool), pKeys: make(map[string]string)}
+		d.terminatingNamespaces[namespace] = terminating
+	}
+	for index := range pods {
+		terminating.podUIDs[pods[index].UID] = true
+	}
+
+	for _, key := range d.guidPodNetworkMap {
+		if _, resolved := terminating.pKeys[key.NetworkID]; resolved ||
+			!namespaceOwnsGUID(namespace, terminating.podUIDs, key) {
+			continue
+		}
+		if _, ibCniSpec, err := d.getIbSriovNetwork(key.NetworkID); err == nil {
+			terminating.pKeys[key.NetworkID] = ibCniSpec.PKey
+		}
+	}
+}
+
+// namespaceOwnsGUID returns true if the guid allocated for the pod network key belongs to a pod of the namespace
+// or to the network of the namespace
+func namespaceOwnsGUID(namespace string, podUIDs map[types.UID]bool, key utils.PodNetworkKey) bool {
+	if podUIDs[key.PodUID] {
+		return true
+	}
+	networkID, err := ibTypes.ParseNetworkID(key.NetworkID)
+	return err == nil && networkID.Namespace == namespace
+}
+
+// CleanupNamespace removes the guids of the pods of the deleted namespace, which weren't released by the pod
+// deletions, from their network pkeys and the default limited partition and releases them. The guids are those
+// allocated to the pods recorded while the namespace was terminating and for the networks of the namespace,
+// except the guids of the running pods. Pending additions and deletions of the namespace pods are dropped. The
+// guids of networks which pkey can't be resolved anymore are kept allocated. It returns the released guids.
+func (d *daemon) CleanupNamespace(namespace string, runningPods []kapi.Pod) ([]string, error) {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	terminating := d.terminatingNamespaces[namespace]
+	if terminating == nil {
+		terminating = &terminatingNamespace{}
+	}
+	running := make(map[types.UID]bool, len(runningPods))
+	for index := range runningPods {
+		running[runningPods[index].UID] = true
+	}
+
+	networkGUIDs := make(map[string][]string)
+	for allocatedGUID, key := range d.guidPodNetworkMap {
+		if !running[key.PodUID] && namespaceOwnsGUID(namespace, terminating.podUIDs, key) {
+			networkGUIDs[key.NetworkID] = append(networkGUIDs[key.NetworkID], allocatedGUID)
+		}
+	}
+	networkIDs := make([]string, 0, len(networkGUIDs))
+	for networkID := range networkGUIDs {
+		networkIDs = append(networkIDs, networkID)
+	}
+	sort.Strings(networkIDs)
+
+	var released []string
+	var errs []error
+	for _, networkID := range networkIDs {
+		guids := networkGUIDs[networkID]
+		sort.Strings(guids)
+		pKey, err := d.namespaceNetworkPKey(terminating, networkID)
+		if err != nil {
+			if errors.Is(err, errNetworkUnmanaged) {
+				continue
+			}
+			log.Warn().Msgf("keeping %d guids of deleted namespace %s allocated, failed to resolve network %s: %v",
+				len(guids), namespace, networkID, err)
+			continue
+		}
+		if err = d.removeNamespaceGUIDs(pKey, guids); err != nil {
+			errs = append(errs, fmt.Errorf("failed to clean up guids of network %s: %v", networkID, err))
+			continue
+		}
+		for _, allocatedGUID := range guids {
+			key := d.guidPodNetworkMap[allocatedGUID]
+			if err = d.releasePodNetworkGUID(allocatedGUID); err != nil {
+				log.Warn().Msgf("failed to release guid %s of deleted namespace %s: %v", allocatedGUID, namespace,
+					err)
+				continue
+			}
+			delete(d.deletedPodsSeen, ibTypes.PodNetworkID{PodUID: key.PodUID, NetworkID: key.NetworkID})
+			released = append(released, allocatedGUID)
+		}
+	}
+	if len(errs) != 0 {
+		return released, fmt.Errorf("failed to clean up namespace %s: %v", namespace, errors.Join(errs...))
+	}
+
+	delete(d.terminatingNamespaces, namespace)
+	d.updatePoolMetrics()
+	if len(released) != 0 {
+		log.Info().Msgf("cleaned up namespace %s, released %d guids", namespace, len(released))
+	}
+	return released, nil
+}
+
+// namespaceNetworkPKey returns the pkey of the network recorded while the namespace was terminating, or resolves
+// it if the network still exists
+func (d *daemon) namespaceNetworkPKey(terminating *terminatingNamespace, networkID string) (string, error) {
+	if pKey, recorded := terminating.pKeys[networkID]; recorded {
+		return pKey, nil
+	}
+	_, ibCniSpec, err := d.getIbSriovNetwork(networkID)
+	if err != nil {
+		return "", err
+	}
+	return ibCniSpec.PKey, nil
+}
+
+// removeNamespaceGUIDs removes the guids from the network pkey and the default limited partition
+func (d *daemon) removeNamespaceGUIDs(pKey string, guids []string) error {
+	guidAddrs := make([]net.HardwareAddr, 0, len(guids))
+	for _, allocatedGUID := range guids {
+		guidAddr, err := net.ParseMAC(allocatedGUID)
+		if err != nil {
+			return err
+		}
+		guidAddrs = append(guidAddrs, guidAddr)
+	}
+
+	if pKey != "" {
+		if err := d.removeGUIDsFromPKey(pKey, guidAddrs); err != nil {
+			return err
+		}
+	}
+	return d.removeGUIDsFromLimitedPartition(pKey, guidAddrs)
+}
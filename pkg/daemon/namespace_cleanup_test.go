@@ -0,0 +1,141 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Namespace Cleanup", func() {
+	const (
+		tenantGUID  = "02:00:00:00:00:00:00:01"
+		sharedGUID  = "02:00:00:00:00:00:00:02"
+		runningGUID = "02:00:00:00:00:00:00:03"
+		otherGUID   = "02:00:00:00:00:00:00:04"
+	)
+
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+		request  reconcile.Request
+	)
+
+	newNetAttDef := func(namespace, pKey string) *netapi.NetworkAttachmentDefinition {
+		return &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: namespace},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"type": "ib-sriov", "cniVersion": "0.3.1", "name": "ib-net", "pkey": "` + pKey + `"}`}}
+	}
+	newPod := func(namespace, name string) *kapi.Pod {
+		return &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(name)}}
+	}
+	reconcileNamespace := func(objects ...client.Object) error {
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		reader := ctrlFake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		_, err = (&namespaceReconciler{reader: reader, d: d}).Reconcile(context.Background(), request)
+		return err
+	}
+	terminatingNamespace := func() *kapi.Namespace {
+		deleted := metav1.Now()
+		return &kapi.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant", Finalizers: []string{"test"},
+			DeletionTimestamp: &deleted}}
+	}
+	parseGUID := func(guidStr string) net.HardwareAddr {
+		guidAddr, err := net.ParseMAC(guidStr)
+		Expect(err).ToNot(HaveOccurred())
+		return guidAddr
+	}
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		d = &daemon{
+			config: config.DaemonConfig{NamespaceCleanup: true,
+				SMBackoff:     config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1},
+				K8sGetBackoff: config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1}},
+			kubeClient: k8sClientFake.NewClient(newNetAttDef("tenant", "0x5"),
+				newNetAttDef("shared", "0x6")),
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+		for guidStr, key := range map[string]utils.PodNetworkKey{
+			tenantGUID:  {PodUID: "tenant-pod", NetworkID: "tenant_ib-net"},
+			sharedGUID:  {PodUID: "tenant-shared-pod", NetworkID: "shared_ib-net"},
+			runningGUID: {PodUID: "running-pod", NetworkID: "tenant_ib-net"},
+			otherGUID:   {PodUID: "other-pod", NetworkID: "shared_ib-net"},
+		} {
+			Expect(d.allocatePodNetworkGUID(guidStr, key)).To(Succeed())
+		}
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Name: "tenant"}}
+	})
+
+	It("Clean up the guids of the pods of a deleted namespace", func() {
+		Expect(reconcileNamespace(terminatingNamespace(), newPod("tenant", "tenant-shared-pod"))).To(Succeed())
+		Expect(d.terminatingNamespaces["tenant"].pKeys).To(Equal(map[string]string{
+			"tenant_ib-net": "0x5", "shared_ib-net": "0x6"}))
+
+		// the networks of the namespace are deleted with it, their recorded pkeys are used
+		d.kubeClient = k8sClientFake.NewClient(newNetAttDef("shared", "0x6"))
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr{parseGUID(tenantGUID)}).
+			Return(nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x6, []net.HardwareAddr{parseGUID(sharedGUID)}).
+			Return(nil).Once()
+		Expect(reconcileNamespace(newPod("other", "running-pod"))).To(Succeed())
+		smClient.AssertExpectations(GinkgoT())
+
+		Expect(d.guidPodNetworkMap).To(HaveLen(2))
+		Expect(d.guidPodNetworkMap).To(HaveKey(runningGUID))
+		Expect(d.guidPodNetworkMap).To(HaveKey(otherGUID))
+		Expect(d.terminatingNamespaces).To(BeEmpty())
+	})
+	It("Keep the guids of networks which pkey can't be resolved", func() {
+		d.kubeClient = k8sClientFake.NewClient(newNetAttDef("shared", "0x6"))
+		released, err := d.CleanupNamespace("tenant", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(released).To(BeEmpty())
+		Expect(d.guidPodNetworkMap).To(HaveLen(4))
+		smClient.AssertNotCalled(GinkgoT(), "RemoveGuidsFromPKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+	It("Retry the cleanup when the guids can't be removed from the pkey", func() {
+		Expect(reconcileNamespace(terminatingNamespace(), newPod("tenant", "tenant-shared-pod"))).To(Succeed())
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, mock.Anything).Return(nil)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x6, mock.Anything).Return(errors.New("sm failure")).Once()
+		Expect(reconcileNamespace()).ToNot(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveKey(sharedGUID))
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(tenantGUID))
+		Expect(d.terminatingNamespaces).To(HaveKey("tenant"))
+
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x6, mock.Anything).Return(nil).Once()
+		Expect(reconcileNamespace()).To(Succeed())
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(sharedGUID))
+		Expect(d.terminatingNamespaces).To(BeEmpty())
+	})
+	It("Ignore namespaces which aren't deleted", func() {
+		Expect(reconcileNamespace(&kapi.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}})).To(Succeed())
+		Expect(d.terminatingNamespaces).To(BeEmpty())
+		Expect(d.guidPodNetworkMap).To(HaveLen(4))
+	})
+})
@@ -0,0 +1,128 @@
+package daemon
+
+import (
+	"context"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Network Attachment Lookup", func() {
+	var netAttDef *netapi.NetworkAttachmentDefinition
+
+	BeforeEach(func() {
+		netAttDef = &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x5"}`}}
+	})
+
+	It("Get network of the pod namespace", func() {
+		d := &daemon{kubeClient: k8sClientFake.NewClient(netAttDef)}
+
+		_, spec, err := d.getIbSriovNetwork("default_ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x5"))
+
+		_, err = d.getNetworkAttachmentDefinition("foo", "ib-net")
+		Expect(err).To(HaveOccurred())
+	})
+	It("Fall back to the configured namespace", func() {
+		d := &daemon{config: config.DaemonConfig{NADNamespaceFallback: "default"},
+			kubeClient: k8sClientFake.NewClient(netAttDef)}
+
+		_, spec, err := d.getIbSriovNetwork("foo_ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x5"))
+	})
+	It("Cache parsed network spec by resource version", func() {
+		netAttDef.ResourceVersion = "1"
+		client := k8sClientFake.NewClient(netAttDef)
+		d := &daemon{kubeClient: client, nadSpecs: utils.NewSynchronizedMap()}
+
+		_, spec, err := d.getIbSriovNetwork("default_ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		spec.PKey = "0x6"
+		cached, ok := d.nadSpecs.Get("default_ib-net")
+		Expect(ok).To(BeTrue())
+		Expect(cached.(*nadSpec).resourceVersion).To(Equal("1"))
+		Expect(cached.(*nadSpec).spec.PKey).To(Equal("0x5"))
+
+		updated := netAttDef.DeepCopy()
+		updated.ResourceVersion = "2"
+		updated.Spec.Config = `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x7"}`
+		_, err = client.NetClientset.K8sCniCncfIoV1().NetworkAttachmentDefinitions("default").Update(
+			context.Background(), updated, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, spec, err = d.getIbSriovNetwork("default_ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x7"))
+		cached, _ = d.nadSpecs.Get("default_ib-net")
+		Expect(cached.(*nadSpec).resourceVersion).To(Equal("2"))
+	})
+	It("Invalidate cached spec of deleted network", func() {
+		d := &daemon{kubeClient: k8sClientFake.NewClient(), nadSpecs: utils.NewSynchronizedMap()}
+		d.nadSpecs.Set("default_ib-net", &nadSpec{resourceVersion: "1", spec: &utils.IbSriovCniSpec{}})
+
+		_, err := d.getNetworkAttachmentDefinition("default", "ib-net")
+		Expect(err).To(HaveOccurred())
+		_, ok := d.nadSpecs.Get("default_ib-net")
+		Expect(ok).To(BeFalse())
+	})
+	It("Read network from the informer cache", func() {
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		d := &daemon{kubeClient: k8sClientFake.NewClient(),
+			nadReader: ctrlFake.NewClientBuilder().WithScheme(scheme).WithObjects(netAttDef).Build()}
+
+		_, spec, err := d.getIbSriovNetwork("default_ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x5"))
+
+		_, err = d.getNetworkAttachmentDefinition("foo", "ib-net")
+		Expect(kerrors.IsNotFound(err)).To(BeTrue())
+	})
+	It("Read network from the api server if the informer cache isn't started", func() {
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		reader := ctrlFake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+				return &cache.ErrCacheNotStarted{}
+			}}).Build()
+		d := &daemon{kubeClient: k8sClientFake.NewClient(netAttDef), nadReader: reader}
+
+		_, spec, err := d.getIbSriovNetwork("default_ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x5"))
+	})
+	It("Key the pod networks by the network namespace", func() {
+		pod := &utils.PodRef{Namespace: "foo", Annotations: map[string]string{
+			netapi.NetworkAttachmentAnnot: `[` +
+				`{"name": "ib-net", "namespace": "default", "cni-args": {"guid": "02:00:00:00:00:00:00:01", ` +
+				`"mellanox.infiniband.app": "configured"}}, ` +
+				`{"name": "ib-net", "cni-args": {"guid": "02:00:00:00:00:00:00:02", ` +
+				`"mellanox.infiniband.app": "configured"}}]`}}
+
+		d := &daemon{podNetworks: utils.NewPodNetworksCache()}
+		networks, err := d.podNetworks.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(networks).To(HaveLen(2))
+		Expect(utils.GeneratePodNetworkKey(pod, networks[0]).NetworkID).To(Equal("default_ib-net"))
+		Expect(utils.GeneratePodNetworkKey(pod, networks[1]).NetworkID).To(Equal("foo_ib-net"))
+		guid, err := utils.GetPodNetworkGUID(networks[1])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(guid).To(Equal("02:00:00:00:00:00:00:02"))
+	})
+})
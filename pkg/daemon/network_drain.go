@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// errNetworkUnmanaged is returned when resolving a network which was drained, its pods aren't configured
+var errNetworkUnmanaged = errors.New("network is not managed by ib-kubernetes")
+
+// DrainNetwork removes the GUIDs allocated for the pods of the network from the network pkey and the default
+// limited partition, releases them from the pool and marks the network as not managed, so its pods aren't
+// configured again. GUIDs are released only once they are removed from the pkeys, so a failed drain is retried.
+// The network is given as <namespace>_<name> or <namespace>/<name>.
+func (d *daemon) DrainNetwork(networkID string) (*admin.NetworkDrain, error) {
+	parsedID, err := ibTypes.ParseNetworkID(networkID)
+	if err != nil {
+		return nil, err
+	}
+	networkID = parsedID.String()
+
+	// the pool is locked so the pod reconciler doesn't add the network pods while it is drained
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	netAttDef, ibCniSpec, err := d.resolveIbSriovNetwork(networkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to drain network %s: %v", networkID, err)
+	}
+
+	drain := &admin.NetworkDrain{NetworkID: networkID, PKey: ibCniSpec.PKey, GUIDs: d.networkGUIDs(networkID)}
+	guids := make([]net.HardwareAddr, 0, len(drain.GUIDs))
+	for _, allocatedGUID := range drain.GUIDs {
+		guidAddr, err := net.ParseMAC(allocatedGUID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to drain network %s: %v", networkID, err)
+		}
+		guids = append(guids, guidAddr)
+	}
+
+	if len(guids) != 0 {
+		if ibCniSpec.PKey != "" {
+			if err = d.removeGUIDsFromPKey(ibCniSpec.PKey, guids); err != nil {
+				return nil, fmt.Errorf("failed to drain network %s: %v", networkID, err)
+			}
+		}
+		if err = d.removeGUIDsFromLimitedPartition(ibCniSpec.PKey, guids); err != nil {
+			return nil, fmt.Errorf("failed to drain network %s: %v", networkID, err)
+		}
+	}
+
+	for _, allocatedGUID := range drain.GUIDs {
+		if err = d.releasePodNetworkGUID(allocatedGUID); err != nil {
+			log.Warn().Msgf("failed to release guid %s of drained network %s: %v", allocatedGUID, networkID, err)
+		}
+	}
+
+	if err = d.markNetworkUnmanaged(netAttDef); err != nil {
+		return nil, fmt.Errorf("failed to mark drained network %s as not managed: %v", networkID, err)
+	}
+	d.updateNetworkStatus(networkID, func(status *networkStatus) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: PKeyEnsuredCondition, Status: metav1.ConditionFalse, Reason: "NetworkDrained",
+			Message: "network drained, its guids were removed from the pkey"})
+		status.Error = ""
+	})
+	d.updatePoolMetrics()
+
+	log.Info().Msgf("drained network %s, released %d guids from pkey %s", networkID, len(drain.GUIDs),
+		ibCniSpec.PKey)
+	d.recordNetAttDefEvent(netAttDef, kapi.EventTypeNormal, networkDrainedEventReason,
+		fmt.Sprintf("network drained, %d guids removed from pkey %s", len(drain.GUIDs), ibCniSpec.PKey))
+	return drain, nil
+}
+
+// networkGUIDs returns the guids allocated for the pods of the network sorted by guid, it's called with
+// poolMutex held
+func (d *daemon) networkGUIDs(networkID string) []string {
+	guids := make([]string, 0)
+	for allocatedGUID, key := range d.guidPodNetworkMap {
+		if key.NetworkID == networkID {
+			guids = append(guids, allocatedGUID)
+		}
+	}
+	sort.Strings(guids)
+	return guids
+}
+
+// hasNetworkGUIDs returns true if guids are allocated for the pods of the network
+func (d *daemon) hasNetworkGUIDs(networkID string) bool {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	for _, key := range d.guidPodNetworkMap {
+		if key.NetworkID == networkID {
+			return true
+		}
+	}
+	return false
+}
+
+// markNetworkUnmanaged annotates the network attachment definition as not managed by ib-kubernetes
+func (d *daemon) markNetworkUnmanaged(netAttDef *v1.NetworkAttachmentDefinition) error {
+	if !utils.NetworkIsManaged(netAttDef) {
+		return nil
+	}
+	// the annotation is set regardless of concurrent changes of the network, which may be read from the cache
+	unconditioned := netAttDef.DeepCopy()
+	unconditioned.ResourceVersion = ""
+	return d.kubeClient.SetAnnotationsOnNetworkAttachmentDefinition(unconditioned,
+		map[string]string{utils.ManagedAnnotation: "false"})
+}
@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Network Drain", func() {
+	const (
+		firstGUID = "02:00:00:00:00:00:00:01"
+		otherGUID = "02:00:00:00:00:00:00:02"
+		lastGUID  = "02:00:00:00:00:00:00:03"
+	)
+
+	var (
+		smClient  *smMocks.SubnetManagerClient
+		client    *k8sClientFake.Client
+		netAttDef *netapi.NetworkAttachmentDefinition
+		d         *daemon
+	)
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+
+		netAttDef = &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"type": "ib-sriov", "cniVersion": "0.3.1", "name": "ib-net", "pkey": "0x5"}`}}
+		client = k8sClientFake.NewClient(netAttDef)
+
+		d = &daemon{
+			kubeClient:        client,
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+		for guidStr, key := range map[string]utils.PodNetworkKey{
+			firstGUID: {PodUID: "pod-1", NetworkID: "default_ib-net"},
+			otherGUID: {PodUID: "pod-2", NetworkID: "default_other-net"},
+			lastGUID:  {PodUID: "pod-3", NetworkID: "default_ib-net"},
+		} {
+			Expect(d.allocatePodNetworkGUID(guidStr, key)).To(Succeed())
+		}
+	})
+
+	getNetAttDef := func() *netapi.NetworkAttachmentDefinition {
+		updated, err := client.GetNetworkAttachmentDefinition("default", "ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		return updated
+	}
+
+	It("Remove network guids from its pkey, release them and mark the network as not managed", func() {
+		first, _ := net.ParseMAC(firstGUID)
+		last, _ := net.ParseMAC(lastGUID)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr{first, last}).Return(nil).Once()
+
+		drain, err := d.DrainNetwork("default_ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(drain.PKey).To(Equal("0x5"))
+		Expect(drain.GUIDs).To(Equal([]string{firstGUID, lastGUID}))
+		smClient.AssertExpectations(GinkgoT())
+
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		Expect(d.guidPodNetworkMap).To(HaveKey(otherGUID))
+		Expect(d.guidPool.Stats().Allocated).To(Equal(uint64(1)))
+		Expect(utils.NetworkIsManaged(getNetAttDef())).To(BeFalse())
+
+		// pods of the drained network aren't configured
+		_, _, err = d.getIbSriovNetwork("default_ib-net")
+		Expect(errors.Is(err, errNetworkUnmanaged)).To(BeTrue())
+
+		// draining again, given as namespaced name, succeeds without guids
+		drain, err = d.DrainNetwork("default/ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(drain.GUIDs).To(BeEmpty())
+	})
+	It("Fail to drain invalid network id", func() {
+		_, err := d.DrainNetwork("ib-net")
+		Expect(err).To(HaveOccurred())
+	})
+	It("Drain network annotated as not managed", func() {
+		first, _ := net.ParseMAC(firstGUID)
+		last, _ := net.ParseMAC(lastGUID)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr{first, last}).Return(nil).Once()
+
+		annotated := netAttDef.DeepCopy()
+		annotated.Annotations = map[string]string{utils.ManagedAnnotation: "false"}
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		reader := ctrlFake.NewClientBuilder().WithScheme(scheme).WithObjects(annotated).Build()
+		reconciler := &networkReconciler{reader: reader, d: d}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "ib-net"}}
+
+		_, err = reconciler.Reconcile(context.Background(), request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.hasNetworkGUIDs("default_ib-net")).To(BeFalse())
+
+		// the drained network isn't drained again
+		_, err = reconciler.Reconcile(context.Background(), request)
+		Expect(err).ToNot(HaveOccurred())
+		smClient.AssertExpectations(GinkgoT())
+	})
+})
@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+)
+
+// Reasons of the events recorded on the network attachment definitions for the pkey operations of their network,
+// failures are recorded with the reason of the failed operation, e.g. "AddMembersFailed"
+const (
+	pKeyAllocatedEventReason  = "PKeyAllocated"
+	networkDrainedEventReason = "NetworkDrained"
+)
+
+// recordNetworkEvent records an event of a pkey operation of the network on its network attachment definition, so
+// the network owners can audit the partition activity of the network. Failures are logged, as the events are
+// informational only.
+func (d *daemon) recordNetworkEvent(networkID, eventType, reason, message string) {
+	if !d.config.NetworkEvents {
+		return
+	}
+
+	parsedID, err := ibTypes.ParseNetworkID(networkID)
+	if err != nil {
+		log.Warn().Msgf("failed to record event on network %s: %v", networkID, err)
+		return
+	}
+	netAttDef, err := d.getNetworkAttachmentDefinition(parsedID.Namespace, parsedID.Name)
+	if err != nil {
+		log.Warn().Msgf("failed to record event on network %s: %v", networkID, err)
+		return
+	}
+	d.recordNetAttDefEvent(netAttDef, eventType, reason, message)
+}
+
+// recordNetAttDefEvent records an event of a pkey operation on the network attachment definition
+func (d *daemon) recordNetAttDefEvent(netAttDef *v1.NetworkAttachmentDefinition, eventType, reason,
+	message string) {
+	if !d.config.NetworkEvents {
+		return
+	}
+
+	if err := d.kubeClient.CreateNetworkAttachmentDefinitionEvent(netAttDef, eventType, reason,
+		message); err != nil {
+		log.Warn().Msgf("failed to record event on network %s/%s: %v", netAttDef.Namespace, netAttDef.Name, err)
+	}
+}
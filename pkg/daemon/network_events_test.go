@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+)
+
+var _ = Describe("Network Events", func() {
+	var (
+		kubeClient *k8sClientFake.Client
+		d          *daemon
+	)
+
+	listEvents := func() []kapi.Event {
+		events, err := kubeClient.Clientset.CoreV1().Events("default").List(context.Background(),
+			metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return events.Items
+	}
+
+	BeforeEach(func() {
+		netAttDef := &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x5"}`}}
+		kubeClient = k8sClientFake.NewClient(netAttDef)
+		d = &daemon{config: config.DaemonConfig{NetworkEvents: true}, kubeClient: kubeClient}
+	})
+
+	It("Record the pkey operations of the network on its network attachment definition", func() {
+		d.setNetworkSynced("default_ib-net", "0x5", "MembersAdded", "2 guids added")
+
+		events := listEvents()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].InvolvedObject.Kind).To(Equal("NetworkAttachmentDefinition"))
+		Expect(events[0].InvolvedObject.Name).To(Equal("ib-net"))
+		Expect(events[0].Type).To(Equal(kapi.EventTypeNormal))
+		Expect(events[0].Reason).To(Equal("MembersAdded"))
+		Expect(events[0].Message).To(Equal("pkey 0x5: 2 guids added"))
+	})
+	It("Record the failed pkey operations of the network as warnings", func() {
+		d.setNetworkSyncFailed("default_ib-net", "RemoveMembersFailed", errors.New("ufm unavailable"), false)
+
+		events := listEvents()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Type).To(Equal(kapi.EventTypeWarning))
+		Expect(events[0].Reason).To(Equal("RemoveMembersFailed"))
+		Expect(events[0].Message).To(Equal("ufm unavailable"))
+	})
+	It("Don't record events if disabled", func() {
+		d.config.NetworkEvents = false
+		d.setNetworkSynced("default_ib-net", "0x5", "MembersAdded", "2 guids added")
+		Expect(listEvents()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// networkResourceUnavailableEventReason is the reason of the events warning that no node can allocate the device
+// plugin resource of a network
+const networkResourceUnavailableEventReason = "ResourceUnavailable"
+
+// validateNetworkResource warns with an event on the network when its device plugin resource isn't allocatable on
+// any node, as the pods of the network would stay pending. Networks without resource name aren't validated and
+// failures are logged, as the validation is informational only.
+func (r *networkReconciler) validateNetworkResource(ctx context.Context,
+	netAttDef *netapi.NetworkAttachmentDefinition) {
+	resourceName := netAttDef.Annotations[utils.ResourceNameAnnotation]
+	if resourceName == "" {
+		return
+	}
+
+	nodes := &kapi.NodeList{}
+	if err := r.reader.List(ctx, nodes); err != nil {
+		log.Warn().Msgf("failed to list nodes to validate resource %s of network %s/%s: %v", resourceName,
+			netAttDef.Namespace, netAttDef.Name, err)
+		return
+	}
+	for index := range nodes.Items {
+		if quantity, exist := nodes.Items[index].Status.Allocatable[kapi.ResourceName(resourceName)]; exist &&
+			!quantity.IsZero() {
+			return
+		}
+	}
+
+	message := fmt.Sprintf("resource %s is not allocatable on any of the %d nodes, pods of the network will stay "+
+		"pending", resourceName, len(nodes.Items))
+	log.Warn().Msgf("network %s/%s: %s", netAttDef.Namespace, netAttDef.Name, message)
+	if err := r.d.kubeClient.CreateNetworkAttachmentDefinitionEvent(netAttDef, kapi.EventTypeWarning,
+		networkResourceUnavailableEventReason, message); err != nil {
+		log.Warn().Msgf("failed to record event on network %s/%s: %v", netAttDef.Namespace, netAttDef.Name, err)
+	}
+}
@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"context"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sMocks "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Network Resources Validation", func() {
+	const resourceName = "nvidia.com/ib_vfs"
+
+	var (
+		ctx        context.Context
+		fakeCli    client.Client
+		kubeClient *k8sMocks.Client
+		reconciler *networkReconciler
+		request    reconcile.Request
+	)
+
+	newNode := func(name string, vfs int64) *kapi.Node {
+		allocatable := kapi.ResourceList{kapi.ResourceName(resourceName): *resource.NewQuantity(vfs, resource.DecimalSI)}
+		return &kapi.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: kapi.NodeStatus{Allocatable: allocatable}}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		fakeCli = ctrlFake.NewClientBuilder().WithScheme(scheme).Build()
+		Expect(fakeCli.Create(ctx, &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default",
+				Annotations: map[string]string{utils.ResourceNameAnnotation: resourceName}},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x5"}`}})).To(Succeed())
+
+		kubeClient = &k8sMocks.Client{}
+		d := &daemon{config: config.DaemonConfig{ValidateNetworkResources: true}, kubeClient: kubeClient,
+			nadSpecs: utils.NewSynchronizedMap()}
+		reconciler = &networkReconciler{reader: fakeCli, d: d}
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "test"}}
+	})
+
+	It("Warn when no node can allocate the network resource", func() {
+		Expect(fakeCli.Create(ctx, newNode("node-1", 0))).To(Succeed())
+		kubeClient.On("CreateNetworkAttachmentDefinitionEvent", mock.MatchedBy(
+			func(netAttDef *netapi.NetworkAttachmentDefinition) bool { return netAttDef.Name == "test" }),
+			kapi.EventTypeWarning, networkResourceUnavailableEventReason, mock.Anything).Return(nil).Once()
+
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).ToNot(HaveOccurred())
+		kubeClient.AssertExpectations(GinkgoT())
+	})
+	It("Don't warn when a node can allocate the network resource", func() {
+		Expect(fakeCli.Create(ctx, newNode("node-1", 0))).To(Succeed())
+		Expect(fakeCli.Create(ctx, newNode("node-2", 8))).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).ToNot(HaveOccurred())
+		kubeClient.AssertNotCalled(GinkgoT(), "CreateNetworkAttachmentDefinitionEvent", mock.Anything,
+			mock.Anything, mock.Anything, mock.Anything)
+	})
+	It("Don't validate when disabled", func() {
+		reconciler.d.config.ValidateNetworkResources = false
+
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).ToNot(HaveOccurred())
+		kubeClient.AssertNotCalled(GinkgoT(), "CreateNetworkAttachmentDefinitionEvent", mock.Anything,
+			mock.Anything, mock.Anything, mock.Anything)
+	})
+})
@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"encoding/json"
+	"time"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// Conditions of the network status recorded on the network attachment definition
+const (
+	// PKeyEnsuredCondition is true when the pods' GUIDs were added to the network pkey by the subnet manager
+	PKeyEnsuredCondition = "PKeyEnsured"
+	// MembersSyncedCondition is true when the last pkey membership update of the network succeeded
+	MembersSyncedCondition = "MembersSynced"
+)
+
+// networkStatus is the reconcile status of a network, recorded in the network attachment definition
+// status annotation
+type networkStatus struct {
+	Conditions   []metav1.Condition `json:"conditions,omitempty"`
+	LastSyncTime metav1.Time        `json:"lastSyncTime"`
+	// Error of the last reconcile of the network, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// setNetworkSynced records on the network a successful pkey membership update
+func (d *daemon) setNetworkSynced(networkID, pKey, reason, message string) {
+	if pKey != "" {
+		d.recordNetworkEvent(networkID, kapi.EventTypeNormal, reason, "pkey "+pKey+": "+message)
+	} else {
+		d.recordNetworkEvent(networkID, kapi.EventTypeNormal, reason, message)
+	}
+	d.updateNetworkStatus(networkID, func(status *networkStatus) {
+		if pKey != "" {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type: PKeyEnsuredCondition, Status: metav1.ConditionTrue, Reason: "PKeyConfigured",
+				Message: "pkey " + pKey + " configured by the subnet manager"})
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: MembersSyncedCondition, Status: metav1.ConditionTrue, Reason: reason, Message: message})
+		status.Error = ""
+	})
+}
+
+// setNetworkSyncFailed records on the network a failed reconcile, pkeyFailed marks the network pkey as not
+// ensured, e.g. when it couldn't be resolved or configured
+func (d *daemon) setNetworkSyncFailed(networkID, reason string, err error, pKeyFailed bool) {
+	d.summary.failure()
+	d.recordNetworkEvent(networkID, kapi.EventTypeWarning, reason, err.Error())
+	d.updateNetworkStatus(networkID, func(status *networkStatus) {
+		if pKeyFailed {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type: PKeyEnsuredCondition, Status: metav1.ConditionFalse, Reason: reason, Message: err.Error()})
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type: MembersSyncedCondition, Status: metav1.ConditionFalse, Reason: reason, Message: err.Error()})
+		status.Error = err.Error()
+	})
+}
+
+// updateNetworkStatus applies the update to the status of the network and patches its annotation on the network
+// attachment definition. The network is read again from the api server if it was modified since it was read from
+// the cache. Failures are logged, as the status is informational only.
+func (d *daemon) updateNetworkStatus(networkID string, update func(status *networkStatus)) {
+	if !d.config.EnableNetworkStatus {
+		return
+	}
+
+	parsedID, err := ibTypes.ParseNetworkID(networkID)
+	if err != nil {
+		log.Warn().Msgf("failed to update status of network %s: %v", networkID, err)
+		return
+	}
+	netAttDef, err := d.getNetworkAttachmentDefinition(parsedID.Namespace, parsedID.Name)
+	if err != nil {
+		log.Warn().Msgf("failed to update status of network %s: %v", networkID, err)
+		return
+	}
+
+	err = d.writeNetworkStatus(networkID, netAttDef, update)
+	if kerrors.IsConflict(err) {
+		if netAttDef, err = d.kubeClient.GetNetworkAttachmentDefinition(netAttDef.Namespace,
+			netAttDef.Name); err == nil {
+			err = d.writeNetworkStatus(networkID, netAttDef, update)
+		}
+	}
+	if err != nil {
+		log.Warn().Msgf("failed to update status of network %s: %v", networkID, err)
+	}
+}
+
+// writeNetworkStatus applies the update to the status recorded on the network attachment definition and writes it
+func (d *daemon) writeNetworkStatus(networkID string, netAttDef *v1.NetworkAttachmentDefinition,
+	update func(status *networkStatus)) error {
+	status := &networkStatus{}
+	if statusStr, exist := netAttDef.Annotations[utils.NetworkStatusAnnotation]; exist {
+		if err := json.Unmarshal([]byte(statusStr), status); err != nil {
+			log.Warn().Msgf("overriding invalid status of network %s: %v", networkID, err)
+			status = &networkStatus{}
+		}
+	}
+
+	update(status)
+	status.LastSyncTime = metav1.NewTime(time.Now())
+	statusData, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return d.kubeClient.SetAnnotationsOnNetworkAttachmentDefinition(
+		netAttDef, map[string]string{utils.NetworkStatusAnnotation: string(statusData)})
+}
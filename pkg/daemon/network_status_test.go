@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Network Status", func() {
+	var d *daemon
+
+	getStatus := func() *networkStatus {
+		netAttDef, err := d.kubeClient.GetNetworkAttachmentDefinition("default", "ib-net")
+		Expect(err).ToNot(HaveOccurred())
+		statusStr, exist := netAttDef.Annotations[utils.NetworkStatusAnnotation]
+		if !exist {
+			return nil
+		}
+		status := &networkStatus{}
+		Expect(json.Unmarshal([]byte(statusStr), status)).To(Succeed())
+		return status
+	}
+
+	BeforeEach(func() {
+		netAttDef := &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x5"}`}}
+		d = &daemon{config: config.DaemonConfig{EnableNetworkStatus: true},
+			kubeClient: k8sClientFake.NewClient(netAttDef)}
+	})
+
+	It("Record synced network", func() {
+		d.setNetworkSynced("default_ib-net", "0x5", "MembersAdded", "1 guids added")
+
+		status := getStatus()
+		Expect(status).ToNot(BeNil())
+		Expect(status.Error).To(BeEmpty())
+		Expect(status.LastSyncTime.IsZero()).To(BeFalse())
+		Expect(meta.IsStatusConditionTrue(status.Conditions, PKeyEnsuredCondition)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(status.Conditions, MembersSyncedCondition)).To(BeTrue())
+	})
+	It("Record failed network sync and recover", func() {
+		d.setNetworkSynced("default_ib-net", "0x5", "MembersAdded", "1 guids added")
+		d.setNetworkSyncFailed("default_ib-net", "RemoveMembersFailed", errors.New("ufm unavailable"), false)
+
+		status := getStatus()
+		Expect(status.Error).To(Equal("ufm unavailable"))
+		Expect(meta.IsStatusConditionTrue(status.Conditions, PKeyEnsuredCondition)).To(BeTrue())
+		condition := meta.FindStatusCondition(status.Conditions, MembersSyncedCondition)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("RemoveMembersFailed"))
+
+		d.setNetworkSynced("default_ib-net", "0x5", "MembersRemoved", "1 guids removed")
+		status = getStatus()
+		Expect(status.Error).To(BeEmpty())
+		Expect(meta.IsStatusConditionTrue(status.Conditions, MembersSyncedCondition)).To(BeTrue())
+	})
+	It("Skip status when disabled", func() {
+		d.config.EnableNetworkStatus = false
+		d.setNetworkSynced("default_ib-net", "0x5", "MembersAdded", "1 guids added")
+		Expect(getStatus()).To(BeNil())
+	})
+})
@@ -0,0 +1,216 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// nodeFailures tracks the failed nodes, mapping the node name to the time the failure was first detected
+type nodeFailures struct {
+	mutex    sync.Mutex
+	notReady map[string]time.Time
+	deleted  map[string]time.Time
+}
+
+func newNodeFailures() *nodeFailures {
+	return &nodeFailures{notReady: make(map[string]time.Time), deleted: make(map[string]time.Time)}
+}
+
+// update records the readiness of the node, node is nil if it was deleted. A node with the same name may be
+// added again after its deletion.
+func (f *nodeFailures) update(name string, node *kapi.Node, now time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if node == nil {
+		delete(f.notReady, name)
+		if _, exist := f.deleted[name]; !exist {
+			log.Info().Msgf("node %s was deleted", name)
+			f.deleted[name] = now
+		}
+		return
+	}
+
+	delete(f.deleted, name)
+	if utils.NodeIsReady(node) {
+		if _, exist := f.notReady[name]; exist {
+			log.Info().Msgf("node %s is ready", name)
+			delete(f.notReady, name)
+		}
+		return
+	}
+	if _, exist := f.notReady[name]; !exist {
+		log.Warn().Msgf("node %s is not ready", name)
+		f.notReady[name] = now
+	}
+}
+
+// expired returns the NotReady and the deleted nodes which failed for longer than the grace period
+func (f *nodeFailures) expired(gracePeriod time.Duration, now time.Time) (notReady, deleted []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for name, since := range f.notReady {
+		if now.Sub(since) >= gracePeriod {
+			notReady = append(notReady, name)
+		}
+	}
+	for name, since := range f.deleted {
+		if now.Sub(since) >= gracePeriod {
+			deleted = append(deleted, name)
+		}
+	}
+	return notReady, deleted
+}
+
+// state returns whether the node is NotReady and whether it is deleted
+func (f *nodeFailures) state(name string) (notReady, deleted bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, notReady = f.notReady[name]
+	_, deleted = f.deleted[name]
+	return notReady, deleted
+}
+
+// forgetDeleted drops the deleted nodes which pods were released
+func (f *nodeFailures) forgetDeleted(names []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, name := range names {
+		delete(f.deleted, name)
+	}
+}
+
+// nodeReconciler records the nodes which are NotReady or deleted from the manager cache
+type nodeReconciler struct {
+	reader   client.Reader
+	failures *nodeFailures
+}
+
+// Reconcile records the readiness of the node, failures to read the node are requeued by the controller rate
+// limited workqueue
+func (r *nodeReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	node := &kapi.Node{}
+	if err := r.reader.Get(ctx, req.NamespacedName, node); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		node = nil
+	}
+	r.failures.update(req.Name, node, time.Now())
+	return reconcile.Result{}, nil
+}
+
+// NodeFailurePeriodicUpdate releases the GUIDs of pods bound to nodes deleted for longer than the configured grace
+// period. The pods of nodes NotReady for longer than the grace period may still be running, so their GUIDs are kept
+// reserved, the GUIDs are released once the node or the pods are deleted. When such node is Ready again, its pods
+// are configured again, as their pkeys memberships may have been lost while the node was down.
+func (d *daemon) NodeFailurePeriodicUpdate() {
+	log.Info().Msg("running node failure periodic update")
+	gracePeriod := time.Duration(d.config.NodeFailureGracePeriod) * time.Second
+
+	notReadyNodes, failedDeletedNodes := d.nodeFailures.expired(gracePeriod, time.Now())
+	recoveredNodes := d.updateFailedNodes(notReadyNodes, gracePeriod)
+	if len(recoveredNodes) == 0 && len(failedDeletedNodes) == 0 {
+		return
+	}
+
+	releasedNodes := make(map[string]bool, len(failedDeletedNodes))
+	for _, nodeName := range failedDeletedNodes {
+		releasedNodes[nodeName] = true
+	}
+	if err := d.handleFailedNodesPods(releasedNodes, recoveredNodes); err != nil {
+		log.Error().Msgf("%v", err)
+		return
+	}
+
+	for nodeName := range recoveredNodes {
+		delete(d.failedNodes, nodeName)
+	}
+	d.nodeFailures.forgetDeleted(failedDeletedNodes)
+
+	log.Info().Msg("node failure periodic update finished")
+}
+
+// updateFailedNodes records the nodes NotReady for longer than the grace period, and returns the recorded nodes
+// which are Ready again. Deleted nodes are forgotten, their pods are released as pods of deleted nodes.
+func (d *daemon) updateFailedNodes(notReadyNodes []string, gracePeriod time.Duration) map[string]bool {
+	recoveredNodes := make(map[string]bool)
+	for nodeName := range d.failedNodes {
+		notReady, deleted := d.nodeFailures.state(nodeName)
+		if deleted {
+			delete(d.failedNodes, nodeName)
+			continue
+		}
+		if !notReady {
+			log.Info().Msgf("node %s is ready again, configuring the networks of its pods again", nodeName)
+			recoveredNodes[nodeName] = true
+		}
+	}
+
+	for _, nodeName := range notReadyNodes {
+		if !d.failedNodes[nodeName] {
+			log.Warn().Msgf("node %s is not ready for longer than %v, the GUIDs of its pods are kept reserved "+
+				"until the node or the pods are deleted", nodeName, gracePeriod)
+			d.failedNodes[nodeName] = true
+		}
+	}
+	return recoveredNodes
+}
+
+// handleFailedNodesPods flags the instances of the pods bound to the released nodes to be released, so their GUIDs
+// are removed from the pkeys and released by the pod reconciler, and flags the instances of the pods bound to the
+// recovered nodes to be configured again with their GUIDs. The flagged pods are queued to the pod reconciler.
+func (d *daemon) handleFailedNodesPods(releasedNodes, recoveredNodes map[string]bool) error {
+	var pods *kapi.PodList
+	if err := wait.ExponentialBackoff(newBackoff(d.config.K8sGetBackoff), func() (bool, error) {
+		var err error
+		if pods, err = d.kubeClient.GetPods(kapi.NamespaceAll); err != nil {
+			log.Warn().Msgf("failed to get pods from kubernetes: %v", err)
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("failed to get pods of failed nodes from kubernetes")
+	}
+
+	var flagged []types.NamespacedName
+	d.poolMutex.Lock()
+	for index := range pods.Items {
+		pod := &pods.Items[index]
+		name := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+		instance := d.podInstanceOf(name, pod.UID)
+		if instance == nil {
+			continue
+		}
+		switch {
+		case releasedNodes[pod.Spec.NodeName]:
+			log.Info().Msgf("releasing GUIDs of pod namespace %s name %s bound to deleted node %s",
+				pod.Namespace, pod.Name, pod.Spec.NodeName)
+			instance.release = true
+		case recoveredNodes[pod.Spec.NodeName] && pod.DeletionTimestamp == nil && !instance.release:
+			log.Info().Msgf("pod namespace %s name %s queued to configure its networks again", pod.Namespace,
+				pod.Name)
+			instance.startReconfigure()
+		default:
+			continue
+		}
+		flagged = append(flagged, name)
+	}
+	d.poolMutex.Unlock()
+
+	for _, name := range flagged {
+		d.enqueuePod(name)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Node Failure", func() {
+	const networkAnnotation = `[{"name":"ib-net", "namespace":"default",
+		"cni-args":{"guid":"02:00:00:00:00:00:00:01", "mellanox.infiniband.app":"configured"}}]`
+
+	var (
+		d        *daemon
+		instance *podInstance
+	)
+	name := types.NamespacedName{Namespace: "default", Name: "pod"}
+
+	BeforeEach(func() {
+		pod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid-1",
+			Annotations: map[string]string{v1.NetworkAttachmentAnnot: networkAnnotation}},
+			Spec: kapi.PodSpec{NodeName: "node1"}, Status: kapi.PodStatus{Phase: kapi.PodRunning}}
+		d = &daemon{
+			config: config.DaemonConfig{NodeFailureGracePeriod: 30,
+				K8sGetBackoff: config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1}},
+			kubeClient:   k8sClientFake.NewClient(pod),
+			podNetworks:  utils.NewPodNetworksCache(),
+			podEvents:    make(chan event.GenericEvent, 1),
+			nodeFailures: newNodeFailures(),
+			failedNodes:  make(map[string]bool),
+		}
+		instance = d.recordPodInstance(pod)
+		instance.configured = map[utils.PodNetworkKey]bool{{PodUID: "uid-1", NetworkID: "default_ib-net"}: true}
+	})
+
+	It("Keep the GUIDs of pods on NotReady nodes and configure them again when the node is Ready", func() {
+		d.nodeFailures.update("node1", &kapi.Node{}, time.Now().Add(-time.Minute))
+
+		d.NodeFailurePeriodicUpdate()
+		Expect(d.failedNodes).To(HaveKey("node1"))
+		Expect(d.podEvents).To(BeEmpty())
+		Expect(instance.reconfigure).To(BeFalse())
+		Expect(instance.release).To(BeFalse())
+
+		d.nodeFailures.update("node1", &kapi.Node{Status: kapi.NodeStatus{Conditions: []kapi.NodeCondition{
+			{Type: kapi.NodeReady, Status: kapi.ConditionTrue}}}}, time.Now())
+		d.NodeFailurePeriodicUpdate()
+		Expect(d.failedNodes).To(BeEmpty())
+		Expect(instance.reconfigure).To(BeTrue())
+		Expect(instance.configured).To(BeEmpty())
+		Expect(instance.release).To(BeFalse())
+		Expect((<-d.podEvents).Object.GetName()).To(Equal(name.Name))
+	})
+
+	It("Release the GUIDs of pods on deleted nodes", func() {
+		d.nodeFailures.update("node1", &kapi.Node{}, time.Now().Add(-time.Minute))
+		d.NodeFailurePeriodicUpdate()
+
+		d.nodeFailures.update("node1", nil, time.Now().Add(-time.Minute))
+		d.NodeFailurePeriodicUpdate()
+		Expect(d.failedNodes).To(BeEmpty())
+		Expect(d.nodeFailures.deleted).To(BeEmpty())
+		Expect(instance.release).To(BeTrue())
+		Expect((<-d.podEvents).Object.GetName()).To(Equal(name.Name))
+	})
+
+	It("Don't release the GUIDs of pods on nodes deleted within the grace period", func() {
+		d.nodeFailures.update("node1", nil, time.Now())
+		d.NodeFailurePeriodicUpdate()
+		Expect(d.nodeFailures.deleted).To(HaveKey("node1"))
+		Expect(instance.release).To(BeFalse())
+		Expect(d.podEvents).To(BeEmpty())
+	})
+
+	It("Record the failed nodes from the manager cache", func() {
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		node := &kapi.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+		fakeCli := ctrlFake.NewClientBuilder().WithScheme(scheme).WithObjects(node).Build()
+		reconciler := &nodeReconciler{reader: fakeCli, failures: d.nodeFailures}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "node1"}}
+
+		_, err = reconciler.Reconcile(context.Background(), request)
+		Expect(err).ToNot(HaveOccurred())
+		notReady, deleted := d.nodeFailures.state("node1")
+		Expect(notReady).To(BeTrue())
+		Expect(deleted).To(BeFalse())
+
+		Expect(fakeCli.Delete(context.Background(), node)).To(Succeed())
+		_, err = reconciler.Reconcile(context.Background(), request)
+		Expect(err).ToNot(HaveOccurred())
+		notReady, deleted = d.nodeFailures.state("node1")
+		Expect(notReady).To(BeFalse())
+		Expect(deleted).To(BeTrue())
+	})
+})
@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// generatePodGUID generates a guid for the pod from the sub-range of its node, pods scheduled on nodes without
+// a sub-range get a guid from the whole pool range
+func (d *daemon) generatePodGUID(pod *utils.PodRef) (guid.GUID, error) {
+	guidRange, exist, err := d.podNodeGUIDRange(pod)
+	if err != nil {
+		return 0, err
+	}
+	if !exist {
+		return d.guidPool.GenerateGUID()
+	}
+	return d.guidPool.GenerateGUIDInRange(guidRange)
+}
+
+// podNodeGUIDRange returns the sub-range of the pool selected by the node label of the pod's node
+func (d *daemon) podNodeGUIDRange(pod *utils.PodRef) (guid.Range, bool, error) {
+	if len(d.nodeGUIDRanges) == 0 || pod.NodeName == "" {
+		return guid.Range{}, false, nil
+	}
+
+	node, err := d.kubeClient.GetNode(pod.NodeName)
+	if err != nil {
+		return guid.Range{}, false, fmt.Errorf("failed to get node %s of pod namespace %s name %s: %v",
+			pod.NodeName, pod.Namespace, pod.Name, err)
+	}
+	value, exist := node.Labels[d.config.GUIDPool.NodeLabel]
+	if !exist {
+		return guid.Range{}, false, nil
+	}
+	guidRange, exist := d.nodeGUIDRanges[value]
+	if !exist {
+		log.Debug().Msgf("no guid range for node %s label %s=%s", node.Name, d.config.GUIDPool.NodeLabel, value)
+	}
+	return guidRange, exist, nil
+}
@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sMocks "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Node GUID Ranges", func() {
+	const zoneLabel = "topology.kubernetes.io/zone"
+
+	var (
+		kubeClient *k8sMocks.Client
+		d          *daemon
+	)
+
+	newNode := func(name, zone string) *kapi.Node {
+		node := &kapi.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if zone != "" {
+			node.Labels = map[string]string{zoneLabel: zone}
+		}
+		return node
+	}
+	newPod := func(nodeName string) *utils.PodRef {
+		return &utils.PodRef{Name: "pod", Namespace: "default", NodeName: nodeName}
+	}
+
+	BeforeEach(func() {
+		poolConfig := &config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF", NodeLabel: zoneLabel,
+			NodeRanges: map[string]string{"zone-a": "02:00:00:00:00:00:00:80-02:00:00:00:00:00:00:8F"}}
+		guidPool, err := guid.NewPool(poolConfig)
+		Expect(err).ToNot(HaveOccurred())
+		nodeGUIDRanges, err := guid.ParseNodeRanges(poolConfig)
+		Expect(err).ToNot(HaveOccurred())
+
+		kubeClient = &k8sMocks.Client{}
+		d = &daemon{
+			config:         config.DaemonConfig{GUIDPool: *poolConfig},
+			kubeClient:     kubeClient,
+			guidPool:       guidPool,
+			nodeGUIDRanges: nodeGUIDRanges,
+		}
+	})
+
+	It("Generate guid from the sub-range of the pod's node", func() {
+		kubeClient.On("GetNode", "node-a").Return(newNode("node-a", "zone-a"), nil)
+		podGUID, err := d.generatePodGUID(newPod("node-a"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(podGUID.String()).To(Equal("02:00:00:00:00:00:00:80"))
+	})
+	It("Generate guid from the whole range for nodes without a sub-range", func() {
+		kubeClient.On("GetNode", "node-b").Return(newNode("node-b", "zone-b"), nil)
+		kubeClient.On("GetNode", "node-c").Return(newNode("node-c", ""), nil)
+
+		for _, nodeName := range []string{"node-b", "node-c", ""} {
+			podGUID, err := d.generatePodGUID(newPod(nodeName))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(podGUID.String()).ToNot(HavePrefix("02:00:00:00:00:00:00:8"))
+		}
+	})
+	It("Fail to generate guid when the pod's node can't be read", func() {
+		kubeClient.On("GetNode", "node-a").Return(nil, errors.New("not found"))
+		_, err := d.generatePodGUID(newPod("node-a"))
+		Expect(err).To(HaveOccurred())
+	})
+})
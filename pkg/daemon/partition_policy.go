@@ -0,0 +1,165 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// partitionPolicyViolationEventReason is the reason of the event recorded on a pod which network pkey isn't
+// allowed by the partition policies of its namespace
+const partitionPolicyViolationEventReason = "PartitionPolicyViolation"
+
+// defaultServiceAccount is the service account of pods which don't specify one
+const defaultServiceAccount = "default"
+
+// errPartitionPolicyViolation is returned when a pkey isn't allowed by the partition policies of a namespace
+var errPartitionPolicyViolation = errors.New("partition policy violation")
+
+// pKeyRange is an inclusive range of pkeys
+type pKeyRange struct {
+	start int
+	end   int
+}
+
+// partitionPolicy is the parsed IBPartitionPolicy
+type partitionPolicy struct {
+	namespaces map[string]bool
+	// serviceAccounts the policy is restricted to, the policy applies to all the service accounts if empty
+	serviceAccounts map[string]bool
+	pKeys           []pKeyRange
+}
+
+// partitionPolicies are the partition policies enforced by a periodic update
+type partitionPolicies struct {
+	policies []partitionPolicy
+}
+
+// getPartitionPolicies returns the partition policies of the cluster, or nil if partition policies are disabled
+func (d *daemon) getPartitionPolicies() (*partitionPolicies, error) {
+	if !d.config.EnablePartitionPolicies {
+		return nil, nil
+	}
+
+	list, err := d.kubeClient.GetPartitionPolicies()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partition policies from kubernetes: %v", err)
+	}
+
+	policies := &partitionPolicies{policies: make([]partitionPolicy, 0, len(list.Items))}
+	for index := range list.Items {
+		policies.policies = append(policies.policies, newPartitionPolicy(&list.Items[index]))
+	}
+	return policies, nil
+}
+
+// newPartitionPolicy parses the IBPartitionPolicy, invalid pkeys are skipped
+func newPartitionPolicy(policy *v1alpha1.IBPartitionPolicy) partitionPolicy {
+	parsed := partitionPolicy{
+		namespaces:      make(map[string]bool, len(policy.Spec.Namespaces)),
+		serviceAccounts: make(map[string]bool, len(policy.Spec.ServiceAccounts)),
+		pKeys:           make([]pKeyRange, 0, len(policy.Spec.PKeys)),
+	}
+	for _, namespace := range policy.Spec.Namespaces {
+		parsed.namespaces[namespace] = true
+	}
+	for _, serviceAccount := range policy.Spec.ServiceAccounts {
+		parsed.serviceAccounts[serviceAccount] = true
+	}
+	for _, pKeys := range policy.Spec.PKeys {
+		pKeyRange, err := parsePKeyRange(pKeys)
+		if err != nil {
+			log.Warn().Msgf("skipping invalid pkeys %s of partition policy %s: %v", pKeys, policy.Name, err)
+			continue
+		}
+		parsed.pKeys = append(parsed.pKeys, pKeyRange)
+	}
+	return parsed
+}
+
+// parsePKeyRange parses a pkey, e.g. "0x5", or an inclusive range of pkeys, e.g. "0x100-0x1FF"
+func parsePKeyRange(pKeys string) (pKeyRange, error) {
+	startStr, endStr, isRange := strings.Cut(pKeys, "-")
+	start, err := ibUtils.ParsePKey(strings.TrimSpace(startStr))
+	if err != nil {
+		return pKeyRange{}, err
+	}
+	if !isRange {
+		return pKeyRange{start: start, end: start}, nil
+	}
+
+	end, err := ibUtils.ParsePKey(strings.TrimSpace(endStr))
+	if err != nil {
+		return pKeyRange{}, err
+	}
+	if start > end {
+		return pKeyRange{}, fmt.Errorf("range start %s is greater than range end %s", startStr, endStr)
+	}
+	return pKeyRange{start: start, end: end}, nil
+}
+
+// allows returns whether the policy allows the pkey for the service account of the namespace
+func (p *partitionPolicy) allows(namespace, serviceAccount string, pKey int) bool {
+	if !p.namespaces[namespace] || (len(p.serviceAccounts) != 0 && !p.serviceAccounts[serviceAccount]) {
+		return false
+	}
+	for _, pKeyRange := range p.pKeys {
+		if pKey >= pKeyRange.start && pKey <= pKeyRange.end {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns error if the pkey isn't allowed by any policy for the service account of the namespace.
+// Any pkey is allowed if partition policies are disabled.
+func (p *partitionPolicies) check(namespace, serviceAccount, pKeyStr string) error {
+	if p == nil || pKeyStr == "" {
+		return nil
+	}
+
+	pKey, err := ibUtils.ParsePKey(pKeyStr)
+	if err != nil {
+		return err
+	}
+	for index := range p.policies {
+		if p.policies[index].allows(namespace, serviceAccount, pKey) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: pkey %s is not allowed for service account %s of namespace %s",
+		errPartitionPolicyViolation, pKeyStr, serviceAccount, namespace)
+}
+
+// checkPodPartitionPolicy returns error if the pod isn't allowed to be a member of the network pkey, and makes
+// the violation visible to the pod owner by recording a warning event on the pod
+func (d *daemon) checkPodPartitionPolicy(policies *partitionPolicies, pod *utils.PodRef, networkID,
+	pKey string) error {
+	serviceAccount := pod.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = defaultServiceAccount
+	}
+
+	err := policies.check(pod.Namespace, serviceAccount, pKey)
+	if err == nil || !errors.Is(err, errPartitionPolicyViolation) {
+		return err
+	}
+
+	metrics.PartitionPolicyViolations.Inc()
+	message := fmt.Sprintf("network %s is not configured: %v", networkID, err)
+	if eventErr := d.kubeClient.CreatePodEvent(pod.Pod(), kapi.EventTypeWarning, partitionPolicyViolationEventReason,
+		message); eventErr != nil {
+		log.Warn().Msgf("failed to record partition policy violation event on pod %s/%s: %v", pod.Namespace,
+			pod.Name, eventErr)
+	}
+	return fmt.Errorf("refusing to add pod namespace %s name %s to pkey of network %s: %v", pod.Namespace,
+		pod.Name, networkID, err)
+}
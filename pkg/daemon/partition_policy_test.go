@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Partition Policies", func() {
+	var (
+		kubeClient *k8sClientFake.Client
+		d          *daemon
+		pod        *kapi.Pod
+	)
+
+	BeforeEach(func() {
+		pod = &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "team-a"}}
+		teamA := &v1alpha1.IBPartitionPolicy{ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec: v1alpha1.IBPartitionPolicySpec{Namespaces: []string{"team-a"}, PKeys: []string{"0x100-0x1FF"}}}
+		trainers := &v1alpha1.IBPartitionPolicy{ObjectMeta: metav1.ObjectMeta{Name: "trainers"},
+			Spec: v1alpha1.IBPartitionPolicySpec{Namespaces: []string{"team-a", "team-b"},
+				ServiceAccounts: []string{"trainer"}, PKeys: []string{"0x5", "invalid"}}}
+		kubeClient = k8sClientFake.NewClient(pod, teamA, trainers)
+		d = &daemon{
+			config:     config.DaemonConfig{EnablePartitionPolicies: true},
+			kubeClient: kubeClient,
+		}
+	})
+
+	It("Allow any pkey if partition policies are disabled", func() {
+		d.config.EnablePartitionPolicies = false
+		policies, err := d.getPartitionPolicies()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policies).To(BeNil())
+		Expect(policies.check("team-c", defaultServiceAccount, "0x5")).To(Succeed())
+	})
+	It("Allow pkeys of the namespace and service account policies", func() {
+		policies, err := d.getPartitionPolicies()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(policies.check("team-a", defaultServiceAccount, "0x100")).To(Succeed())
+		Expect(policies.check("team-a", defaultServiceAccount, "0x1FF")).To(Succeed())
+		Expect(policies.check("team-a", defaultServiceAccount, "0x200")).ToNot(Succeed())
+		Expect(policies.check("team-a", defaultServiceAccount, "0x5")).ToNot(Succeed())
+		Expect(policies.check("team-a", "trainer", "0x5")).To(Succeed())
+		Expect(policies.check("team-b", "trainer", "0x100")).ToNot(Succeed())
+		Expect(policies.check("team-c", defaultServiceAccount, "0x100")).ToNot(Succeed())
+		// Networks without pkey are always allowed
+		Expect(policies.check("team-c", defaultServiceAccount, "")).To(Succeed())
+	})
+	It("Parse pkey ranges", func() {
+		Expect(parsePKeyRange("0x5")).To(Equal(pKeyRange{start: 0x5, end: 0x5}))
+		Expect(parsePKeyRange("0x100 - 0x1FF")).To(Equal(pKeyRange{start: 0x100, end: 0x1FF}))
+		_, err := parsePKeyRange("0x1FF-0x100")
+		Expect(err).To(HaveOccurred())
+		_, err = parsePKeyRange("5z")
+		Expect(err).To(HaveOccurred())
+	})
+	It("Record warning event on pod violating the partition policies", func() {
+		policies, err := d.getPartitionPolicies()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(d.checkPodPartitionPolicy(policies, utils.NewPodRef(pod), "team-a_ib-net", "0x150")).To(Succeed())
+		err = d.checkPodPartitionPolicy(policies, utils.NewPodRef(pod), "team-a_ib-net", "0x5")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("pkey 0x5 is not allowed for service account default"))
+
+		events, err := kubeClient.Clientset.CoreV1().Events("team-a").List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].Type).To(Equal(kapi.EventTypeWarning))
+		Expect(events.Items[0].Reason).To(Equal(partitionPolicyViolationEventReason))
+		Expect(events.Items[0].Message).To(ContainSubstring("team-a_ib-net"))
+	})
+	It("Refuse moving guid reservation to pkey not allowed", func() {
+		policies, err := d.getPartitionPolicies()
+		Expect(err).ToNot(HaveOccurred())
+
+		reservation := &v1alpha1.IBGuidReservation{ObjectMeta: metav1.ObjectMeta{Name: "vm", Namespace: "team-a"},
+			Spec: v1alpha1.IBGuidReservationSpec{PKey: "0x5"}}
+		Expect(checkGUIDReservationPartitionPolicy(policies, reservation)).ToNot(Succeed())
+		reservation.Spec.PKey = "0x100"
+		Expect(checkGUIDReservationPartitionPolicy(policies, reservation)).To(Succeed())
+	})
+})
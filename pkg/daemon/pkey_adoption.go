@@ -0,0 +1,216 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// adoptionCandidate is a guid requested by a pod network which isn't configured by the daemon yet
+type adoptionCandidate struct {
+	guid string
+	key  utils.PodNetworkKey
+}
+
+// initAdoptedPKeyMembers adopts the pkey members added manually, e.g. before the fabric was managed by the daemon,
+// which guid of the pool range is requested by a pod network not configured yet. The adopted guids are allocated
+// for their pod network, so they aren't reported as guids of the pool range the daemon doesn't own by the subnet
+// manager sync, and they aren't added to the pkey again when the pod is processed. It runs once the guids of the
+// running pods are allocated.
+func (d *daemon) initAdoptedPKeyMembers() error {
+	if !d.config.AdoptPKeyMembers || d.smUnavailable {
+		return nil
+	}
+
+	pods, err := d.kubeClient.GetPods(kapi.NamespaceAll)
+	if err != nil {
+		return fmt.Errorf("failed to get pods from kubernetes: %v", err)
+	}
+	candidates := pKeyAdoptionCandidates(pods.Items)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	adopted := 0
+	pKeyMembers := make(map[int]map[string]bool)
+	for networkID, networkCandidates := range candidates {
+		pKey, err := d.adoptionNetworkPKey(networkID)
+		if err != nil {
+			log.Warn().Msgf("skipping adoption of the pkey members of network %s: %v", networkID, err)
+			continue
+		}
+		members, exist := pKeyMembers[pKey]
+		if !exist {
+			if members, err = d.getPKeyMembersSet(pKey); err != nil {
+				if errors.Is(err, plugins.ErrNotSupported) {
+					log.Warn().Msgf("can't adopt pkey members, subnet manager %s doesn't report the pkey members",
+						d.smClient.Name())
+					return nil
+				}
+				return err
+			}
+			pKeyMembers[pKey] = members
+		}
+
+		for _, candidate := range networkCandidates {
+			if !members[candidate.guid] || !d.adoptPKeyMember(candidate) {
+				continue
+			}
+			log.Info().Msgf("adopted guid %s of pkey %s for %s", candidate.guid, ibUtils.FormatPKey(pKey),
+				candidate.key)
+			adopted++
+		}
+	}
+	metrics.AdoptedPKeyMembers.Add(float64(adopted))
+	if adopted != 0 {
+		log.Info().Msgf("adopted %d pkey members added before the pods were configured by ib-kubernetes", adopted)
+	}
+	return nil
+}
+
+// pKeyAdoptionCandidates returns the guids requested by the pod networks the daemon will configure, by network
+func pKeyAdoptionCandidates(pods []kapi.Pod) map[string][]adoptionCandidate {
+	candidates := make(map[string][]adoptionCandidate)
+	for index := range pods {
+		pod := &pods[index]
+		if !utils.PodWantsNetwork(pod) || !utils.PodScheduled(pod) || !utils.PodIsManaged(pod) ||
+			pod.DeletionTimestamp != nil || !utils.HasNetworkAttachmentAnnot(pod) {
+			continue
+		}
+		podRef := utils.NewPodRef(pod)
+		networks, err := utils.ParsePodNetworks(podRef)
+		if err != nil {
+			continue
+		}
+		utils.AssignInterfaceNames(networks)
+		for _, network := range networks {
+			if utils.IsPodNetworkConfiguredWithInfiniBand(podRef, network) {
+				continue
+			}
+			networkID := ibTypes.NetworkIDOf(network).String()
+			for _, podGUID := range requestedGUIDs(network) {
+				candidates[networkID] = append(candidates[networkID],
+					adoptionCandidate{guid: podGUID, key: utils.GeneratePodNetworkKey(podRef, network)})
+			}
+		}
+	}
+	return candidates
+}
+
+// requestedGUIDs returns the guids requested by the pod network in their canonical form, none if the guids are
+// invalid
+func requestedGUIDs(network *v1.NetworkSelectionElement) []string {
+	podGUIDs, err := utils.GetPodNetworkGUIDs(network)
+	if err != nil {
+		return nil
+	}
+	normalized := make([]string, 0, len(podGUIDs))
+	for _, podGUID := range podGUIDs {
+		normalizedGUID, err := ibUtils.NormalizeGUID(podGUID)
+		if err != nil {
+			return nil
+		}
+		normalized = append(normalized, normalizedGUID)
+	}
+	return normalized
+}
+
+// adoptionNetworkPKey returns the pkey of the network, the pkey members of the networks without pkey or of the
+// unmanaged default pkey aren't adopted
+func (d *daemon) adoptionNetworkPKey(networkID string) (int, error) {
+	_, spec, err := d.getIbSriovNetwork(networkID)
+	if err != nil {
+		return 0, err
+	}
+	if spec.PKey == "" {
+		return 0, fmt.Errorf("network has no pkey")
+	}
+	pKey, err := ibUtils.ParsePKey(spec.PKey)
+	if err != nil {
+		return 0, err
+	}
+	if d.unmanagedDefaultPKey(pKey) {
+		return 0, fmt.Errorf("default pkey isn't managed")
+	}
+	return pKey, nil
+}
+
+// getPKeyMembersSet returns the guids members of the pkey in the subnet manager as a set of canonical guids
+func (d *daemon) getPKeyMembersSet(pKey int) (map[string]bool, error) {
+	var members []net.HardwareAddr
+	err := d.callSubnetManager(func(ctx context.Context) (err error) {
+		members, err = d.smClient.GetPKeyMembers(ctx, pKey)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of pkey %s from subnet manager %s: %w",
+			ibUtils.FormatPKey(pKey), d.smClient.Name(), err)
+	}
+	membersSet := make(map[string]bool, len(members))
+	for _, member := range members {
+		membersSet[member.String()] = true
+	}
+	return membersSet, nil
+}
+
+// adoptPKeyMember allocates the guid of the pool range for its pod network, false if it isn't in the pool range
+// or is already allocated. It's called with poolMutex held.
+func (d *daemon) adoptPKeyMember(candidate adoptionCandidate) bool {
+	guidAddr, err := guid.ParseGUID(candidate.guid)
+	if err != nil || !d.guidPool.Contains(guidAddr) {
+		return false
+	}
+	if _, exist := d.guidPodNetworkMap[candidate.guid]; exist {
+		return false
+	}
+	if err = d.guidPool.AllocateGUID(candidate.guid); err != nil {
+		log.Warn().Msgf("failed to adopt guid %s for %s: %v", candidate.guid, candidate.key, err)
+		return false
+	}
+	d.guidPodNetworkMap[candidate.guid] = candidate.key
+	if d.adoptedGUIDs == nil {
+		d.adoptedGUIDs = make(map[string]bool)
+	}
+	d.adoptedGUIDs[candidate.guid] = true
+	return true
+}
+
+// newPKeyMembers returns the guids which must be added to the pkey, the adopted guids are already members. The
+// guids are no longer considered adopted, as they are configured by the daemon once added. It's called with
+// poolMutex held.
+func (d *daemon) newPKeyMembers(guids []net.HardwareAddr) []net.HardwareAddr {
+	if len(d.adoptedGUIDs) == 0 {
+		return guids
+	}
+	newMembers := make([]net.HardwareAddr, 0, len(guids))
+	for _, guidAddr := range guids {
+		if d.adoptedGUIDs[guidAddr.String()] {
+			continue
+		}
+		newMembers = append(newMembers, guidAddr)
+	}
+	return newMembers
+}
+
+// forgetAdoptedGUIDs drops the guids from the adopted guids once their pod network is configured or released.
+// It's called with poolMutex held.
+func (d *daemon) forgetAdoptedGUIDs(guids []net.HardwareAddr) {
+	for _, guidAddr := range guids {
+		delete(d.adoptedGUIDs, guidAddr.String())
+	}
+}
@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"net"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smFake "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("PKey Members Adoption", func() {
+	const (
+		memberGUID    = "02:00:00:00:00:00:00:20"
+		newGUID       = "02:00:00:00:00:00:00:21"
+		outRangeGUID  = "03:00:00:00:00:00:00:20"
+		configuredUID = types.UID("configured")
+	)
+
+	var (
+		smClient *smFake.SubnetManagerClient
+		d        *daemon
+	)
+
+	newPod := func(name, podGUID string) *kapi.Pod {
+		return &kapi.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name),
+				Annotations: map[string]string{netapi.NetworkAttachmentAnnot: `[{"name": "ib-net", ` +
+					`"namespace": "default", "cni-args": {"guid": "` + podGUID + `"}}]`}},
+			Spec: kapi.PodSpec{NodeName: "node1"}}
+	}
+
+	BeforeEach(func() {
+		netAttDef := &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x5"}`}}
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = smFake.NewSubnetManagerClient()
+		d = &daemon{
+			config: config.DaemonConfig{AdoptPKeyMembers: true, ManageDefaultPKey: true},
+			kubeClient: k8sClientFake.NewClient(netAttDef, newPod("member", memberGUID), newPod("new", newGUID),
+				newPod("out-of-range", outRangeGUID)),
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+	})
+
+	It("Adopt the pkey members of the pool range requested by pod networks", func() {
+		smClient.SetMembers(0x5, memberGUID, outRangeGUID)
+
+		Expect(d.initAdoptedPKeyMembers()).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(memberGUID,
+			utils.PodNetworkKey{PodUID: "member", NetworkID: "default_ib-net"}))
+		Expect(smClient.Calls(smFake.MethodGetPKeyMembers)).To(HaveLen(1))
+
+		// the adopted guid isn't added to the pkey again
+		guids := []net.HardwareAddr{{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20},
+			{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x21}}
+		Expect(d.newPKeyMembers(guids)).To(Equal(guids[1:]))
+		d.forgetAdoptedGUIDs(guids)
+		Expect(d.newPKeyMembers(guids)).To(Equal(guids))
+	})
+	It("Don't adopt the pkey members already allocated", func() {
+		Expect(d.allocatePodNetworkGUID(memberGUID, utils.PodNetworkKey{PodUID: configuredUID,
+			NetworkID: "default_ib-net"})).To(Succeed())
+		smClient.SetMembers(0x5, memberGUID)
+
+		Expect(d.initAdoptedPKeyMembers()).To(Succeed())
+		Expect(d.guidPodNetworkMap[memberGUID].PodUID).To(Equal(configuredUID))
+		Expect(d.adoptedGUIDs).To(BeEmpty())
+	})
+	It("Skip adoption if the subnet manager doesn't report the pkey members", func() {
+		smClient.SetMembers(0x5, memberGUID)
+		smClient.InjectError(smFake.MethodGetPKeyMembers, plugins.ErrNotSupported, 0)
+
+		Expect(d.initAdoptedPKeyMembers()).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+	})
+	It("Don't adopt the pkey members if disabled", func() {
+		d.config.AdoptPKeyMembers = false
+		Expect(d.initAdoptedPKeyMembers()).To(Succeed())
+		Expect(smClient.Calls(smFake.MethodGetPKeyMembers)).To(BeEmpty())
+	})
+})
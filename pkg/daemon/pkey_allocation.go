@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// initPKeyPool allocates in the pkey pool the pkeys already assigned to networks, either automatically
+// and recorded in the network annotation or configured explicitly in the network spec
+func (d *daemon) initPKeyPool() error {
+	if d.pKeyPool == nil {
+		return nil
+	}
+
+	netAttDefs, err := d.kubeClient.GetNetworkAttachmentDefinitions(kapi.NamespaceAll)
+	if err != nil {
+		return fmt.Errorf("failed to list network attachment definitions: %v", err)
+	}
+
+	d.pKeyMutex.Lock()
+	defer d.pKeyMutex.Unlock()
+	for index := range netAttDefs.Items {
+		netAttDef := &netAttDefs.Items[index]
+		networkID := ibTypes.NewNetworkID(netAttDef.Namespace, netAttDef.Name).String()
+		pKeyStr := netAttDef.Annotations[utils.PKeyAnnotation]
+		if pKeyStr == "" {
+			pKeyStr = getConfiguredPKey(netAttDef)
+		}
+		if pKeyStr == "" || pKeyStr == utils.AutoPKey {
+			continue
+		}
+
+		pKey, err := ibUtils.ParsePKey(pKeyStr)
+		if err != nil {
+			log.Warn().Msgf("skipping pkey of network %s: %v", networkID, err)
+			continue
+		}
+		if !d.pKeyPool.InRange(pKey) {
+			continue
+		}
+		if err = d.pKeyPool.AllocatePKey(pKey, networkID); err != nil {
+			log.Warn().Msgf("failed to allocate pkey %s of network %s: %v", pKeyStr, networkID, err)
+		}
+	}
+	return nil
+}
+
+// getConfiguredPKey returns the pkey configured in the ib-sriov spec of the network, empty if none
+func getConfiguredPKey(netAttDef *v1.NetworkAttachmentDefinition) string {
+	networkSpec := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(netAttDef.Spec.Config), &networkSpec); err != nil {
+		return ""
+	}
+	ibCniSpec, err := utils.GetIbSriovCniFromNetwork(networkSpec)
+	if err != nil {
+		return ""
+	}
+	return ibCniSpec.PKey
+}
+
+// maxPKeyRecordAttempts is the number of attempts to record an allocated pkey in a network modified concurrently
+const maxPKeyRecordAttempts = 3
+
+// resolveAutoPKey sets the pkey allocated for the network with "auto" pkey in its spec. If the network has
+// no allocated pkey yet, a free pkey is allocated from the pkey pool and recorded in the network annotation.
+// The annotation is written only if the network wasn't modified since it was read, otherwise the network is read
+// again, so the pkey recorded by another daemon is used. The pkey is released if it can't be recorded.
+func (d *daemon) resolveAutoPKey(networkID string, netAttDef *v1.NetworkAttachmentDefinition,
+	spec *utils.IbSriovCniSpec) error {
+	if d.pKeyPool == nil {
+		return fmt.Errorf("network %s requests automatic pkey allocation, but no pkey pool is configured", networkID)
+	}
+
+	d.pKeyMutex.Lock()
+	defer d.pKeyMutex.Unlock()
+	for attempt := 1; ; attempt++ {
+		if pKeyStr, exist := netAttDef.Annotations[utils.PKeyAnnotation]; exist {
+			return d.allocateRecordedPKey(networkID, pKeyStr, spec)
+		}
+
+		pKey, err := d.pKeyPool.GeneratePKey(networkID)
+		if err != nil {
+			return fmt.Errorf("failed to allocate pkey for network %s: %v", networkID, err)
+		}
+
+		pKeyStr := ibUtils.FormatPKey(pKey)
+		err = d.kubeClient.SetAnnotationsOnNetworkAttachmentDefinition(
+			netAttDef, map[string]string{utils.PKeyAnnotation: pKeyStr})
+		if err == nil {
+			log.Info().Msgf("allocated pkey %s for network %s", pKeyStr, networkID)
+			d.recordNetAttDefEvent(netAttDef, kapi.EventTypeNormal, pKeyAllocatedEventReason,
+				"allocated pkey "+pKeyStr+" from the pkey pool")
+			spec.PKey = pKeyStr
+			return nil
+		}
+
+		d.pKeyPool.ReleasePKey(networkID)
+		if !kerrors.IsConflict(err) || attempt == maxPKeyRecordAttempts {
+			return fmt.Errorf("failed to record pkey %s of network %s: %v", pKeyStr, networkID, err)
+		}
+		log.Debug().Msgf("network %s was modified while recording its pkey, reading it again", networkID)
+		if netAttDef, err = d.kubeClient.GetNetworkAttachmentDefinition(netAttDef.Namespace,
+			netAttDef.Name); err != nil {
+			return fmt.Errorf("failed to read network %s to record its pkey: %v", networkID, err)
+		}
+	}
+}
+
+// allocateRecordedPKey allocates in the pkey pool the pkey recorded in the network annotation, pkeys out of the
+// pool range are used as is. It's called with pKeyMutex held.
+func (d *daemon) allocateRecordedPKey(networkID, pKeyStr string, spec *utils.IbSriovCniSpec) error {
+	pKey, err := ibUtils.ParsePKey(pKeyStr)
+	if err != nil {
+		return fmt.Errorf("invalid pkey annotation of network %s: %v", networkID, err)
+	}
+	if d.pKeyPool.InRange(pKey) {
+		if err = d.pKeyPool.AllocatePKey(pKey, networkID); err != nil {
+			return err
+		}
+	}
+	spec.PKey = pKeyStr
+	return nil
+}
+
+// releaseNetworkPKey releases the pkey allocated for the deleted network, so it can be allocated for other
+// networks
+func (d *daemon) releaseNetworkPKey(networkID string) {
+	if d.pKeyPool == nil {
+		return
+	}
+
+	d.pKeyMutex.Lock()
+	defer d.pKeyMutex.Unlock()
+	if pKey, released := d.pKeyPool.ReleasePKey(networkID); released {
+		log.Info().Msgf("released pkey %s of deleted network %s", ibUtils.FormatPKey(pKey), networkID)
+	}
+}
@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"errors"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sTesting "k8s.io/client-go/testing"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/pkey"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("PKey Allocation", func() {
+	newNetAttDef := func(name, pKey string, annotations map[string]string) *netapi.NetworkAttachmentDefinition {
+		return &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "` + pKey + `"}`}}
+	}
+
+	newTestDaemon := func(netAttDefs ...*netapi.NetworkAttachmentDefinition) *daemon {
+		pKeyPool, err := pkey.NewPool(&config.PKeyPoolConfig{RangeStart: "0x0100", RangeEnd: "0x0102"})
+		Expect(err).ToNot(HaveOccurred())
+
+		objects := make([]runtime.Object, 0, len(netAttDefs))
+		for _, netAttDef := range netAttDefs {
+			objects = append(objects, netAttDef)
+		}
+		return &daemon{kubeClient: k8sClientFake.NewClient(objects...), pKeyPool: pKeyPool}
+	}
+
+	It("Allocate free pkey for auto network and record it in annotation", func() {
+		d := newTestDaemon(
+			newNetAttDef("explicit", "0x0100", nil),
+			newNetAttDef("allocated", utils.AutoPKey, map[string]string{utils.PKeyAnnotation: "0x0101"}),
+			newNetAttDef("auto", utils.AutoPKey, nil))
+		Expect(d.initPKeyPool()).To(Succeed())
+
+		_, spec, err := d.getIbSriovNetwork("default_auto")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x0102"))
+
+		netAttDef, err := d.kubeClient.GetNetworkAttachmentDefinition("default", "auto")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(netAttDef.Annotations).To(HaveKeyWithValue(utils.PKeyAnnotation, "0x0102"))
+
+		// The recorded pkey is used on next resolution
+		_, spec, err = d.getIbSriovNetwork("default_auto")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x0102"))
+
+		_, spec, err = d.getIbSriovNetwork("default_allocated")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x0101"))
+	})
+	It("Fail to resolve auto network when pkey pool is exhausted", func() {
+		d := newTestDaemon(
+			newNetAttDef("net1", "0x0100", nil),
+			newNetAttDef("net2", "0x0101", nil),
+			newNetAttDef("net3", "0x0102", nil),
+			newNetAttDef("auto", utils.AutoPKey, nil))
+		Expect(d.initPKeyPool()).To(Succeed())
+
+		_, _, err := d.getIbSriovNetwork("default_auto")
+		Expect(err).To(HaveOccurred())
+	})
+	It("Fail to resolve auto network when pkey pool is not configured", func() {
+		d := newTestDaemon(newNetAttDef("auto", utils.AutoPKey, nil))
+		d.pKeyPool = nil
+
+		_, _, err := d.getIbSriovNetwork("default_auto")
+		Expect(err).To(HaveOccurred())
+	})
+	It("Release the allocated pkey when it can't be recorded", func() {
+		d := newTestDaemon(newNetAttDef("auto", utils.AutoPKey, nil))
+		kubeClient := d.kubeClient.(*k8sClientFake.Client)
+		kubeClient.NetClientset.PrependReactor("patch", "network-attachment-definitions",
+			func(k8sTesting.Action) (bool, runtime.Object, error) {
+				return true, nil, kerrors.NewInternalError(errors.New("unavailable"))
+			})
+
+		_, _, err := d.getIbSriovNetwork("default_auto")
+		Expect(err).To(HaveOccurred())
+		pKey, err := d.pKeyPool.GeneratePKey("default_other")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pKey).To(Equal(0x100))
+	})
+	It("Use the pkey recorded concurrently by another daemon", func() {
+		d := newTestDaemon(newNetAttDef("auto", utils.AutoPKey, nil))
+		kubeClient := d.kubeClient.(*k8sClientFake.Client)
+		kubeClient.NetClientset.PrependReactor("patch", "network-attachment-definitions",
+			func(k8sTesting.Action) (bool, runtime.Object, error) {
+				// another daemon records its pkey before this daemon's patch
+				recorded := newNetAttDef("auto", utils.AutoPKey, map[string]string{utils.PKeyAnnotation: "0x0101"})
+				Expect(kubeClient.NetClientset.Tracker().Update(schema.GroupVersionResource{
+					Group: "k8s.cni.cncf.io", Version: "v1", Resource: "network-attachment-definitions"},
+					recorded, "default")).To(Succeed())
+				return true, nil, kerrors.NewConflict(schema.GroupResource{}, "auto", errors.New("modified"))
+			})
+
+		_, spec, err := d.getIbSriovNetwork("default_auto")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.PKey).To(Equal("0x0101"))
+		pKey, err := d.pKeyPool.GeneratePKey("default_other")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pKey).To(Equal(0x100))
+	})
+	It("Release the pkey of a deleted network", func() {
+		d := newTestDaemon(newNetAttDef("auto", utils.AutoPKey, map[string]string{utils.PKeyAnnotation: "0x0100"}))
+		Expect(d.initPKeyPool()).To(Succeed())
+
+		d.releaseNetworkPKey("default_auto")
+		pKey, err := d.pKeyPool.GeneratePKey("default_other")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pKey).To(Equal(0x100))
+	})
+})
@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+)
+
+// pKeyMemberLimitEventReason is the reason of the event recorded on a pod which network pkey reached the maximum
+// number of members
+const pKeyMemberLimitEventReason = "PKeyMemberLimitExceeded"
+
+// noPKey is recorded for the networks without pkey or which pkey can't be resolved
+const noPKey = -1
+
+// pKeyMemberLimit counts the members of the pkey of a network while its pods are added
+type pKeyMemberLimit struct {
+	pKey    string
+	max     int
+	members int
+}
+
+// admit counts the guids newly allocated for a pod network as members of the pkey, it fails if they would exceed
+// the maximum number of members
+func (l *pKeyMemberLimit) admit(added int) error {
+	if added > 0 && l.members+added > l.max {
+		return fmt.Errorf("adding %d guids to pkey %s with %d members exceeds the maximum of %d members", added,
+			l.pKey, l.members, l.max)
+	}
+	l.members += added
+	return nil
+}
+
+// newPKeyMemberLimit returns the member limit of the network pkey, nil if the limit is disabled or the network
+// isn't added to a pkey via the subnet manager. It's called with poolMutex held.
+func (d *daemon) newPKeyMemberLimit(pKeyStr string) *pKeyMemberLimit {
+	if d.config.PKeyMaxMembers == 0 {
+		return nil
+	}
+	pKey, err := ibUtils.ParsePKey(pKeyStr)
+	if err != nil || d.unmanagedDefaultPKey(pKey) {
+		return nil
+	}
+	return &pKeyMemberLimit{pKey: pKeyStr, max: d.config.PKeyMaxMembers, members: d.pKeyMembers(pKey)}
+}
+
+// rejectPKeyMemberLimit releases the guids allocated for the pod network exceeding the member limit of its pkey,
+// and records a warning event on the pod so its owner sees why the network isn't configured
+func (d *daemon) rejectPKeyMemberLimit(pi *podNetworkInfo, networkID string, limitErr error) {
+	metrics.PKeyMemberLimitExceeded.Inc()
+	for _, guidAddr := range append([]net.HardwareAddr{pi.addr}, pi.extraAddrs...) {
+		if err := d.releasePodNetworkGUID(guidAddr.String()); err != nil {
+			log.Error().Msgf("failed to release guid %s of pod namespace %s name %s: %v", guidAddr,
+				pi.pod.Namespace, pi.pod.Name, err)
+		}
+	}
+
+	message := fmt.Sprintf("network %s is not configured: %v", networkID, limitErr)
+	if err := d.kubeClient.CreatePodEvent(pi.pod.Pod(), kapi.EventTypeWarning, pKeyMemberLimitEventReason,
+		message); err != nil {
+		log.Warn().Msgf("failed to record pkey member limit event on pod %s/%s: %v", pi.pod.Namespace, pi.pod.Name,
+			err)
+	}
+}
+
+// recordNetworkPKey records the pkey of a resolved network the pkey members are counted with, it's called with
+// poolMutex held
+func (d *daemon) recordNetworkPKey(networkID, pKeyStr string) {
+	if d.networkPKeys == nil {
+		d.networkPKeys = make(map[string]int)
+	}
+	pKey, err := ibUtils.ParsePKey(pKeyStr)
+	if err != nil {
+		pKey = noPKey
+	}
+	d.networkPKeys[networkID] = pKey
+}
+
+// networkPKey returns the recorded pkey of the network. With the member limit enabled, the networks which pods
+// weren't processed since the daemon started are resolved once, so the guids of their running pods are counted.
+func (d *daemon) networkPKey(networkID string) int {
+	if pKey, exist := d.networkPKeys[networkID]; exist {
+		return pKey
+	}
+	if d.config.PKeyMaxMembers == 0 {
+		return noPKey
+	}
+
+	var pKeyStr string
+	if _, ibCniSpec, err := d.getIbSriovNetwork(networkID); err != nil {
+		log.Warn().Msgf("counting pkey members without the guids of network %s: %v", networkID, err)
+	} else {
+		pKeyStr = ibCniSpec.PKey
+	}
+	d.recordNetworkPKey(networkID, pKeyStr)
+	return d.networkPKeys[networkID]
+}
+
+// pKeyMembers returns the number of guids allocated for the pod networks of the pkey and updates its member
+// count metric, it's called with poolMutex held
+func (d *daemon) pKeyMembers(pKey int) int {
+	members := 0
+	for _, key := range d.guidPodNetworkMap {
+		if d.networkPKey(key.NetworkID) == pKey {
+			members++
+		}
+	}
+	metrics.PKeyMembers.WithLabelValues(ibUtils.FormatPKey(pKey)).Set(float64(members))
+	return members
+}
+
+// updatePKeyMembersMetric updates the member count metric of the network pkey after its members changed
+func (d *daemon) updatePKeyMembersMetric(pKeyStr string) {
+	if pKey, err := ibUtils.ParsePKey(pKeyStr); err == nil {
+		d.pKeyMembers(pKey)
+	}
+}
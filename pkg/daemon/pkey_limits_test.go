@@ -0,0 +1,95 @@
+package daemon
+
+import (
+	"context"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("PKey Member Limits", func() {
+	var (
+		kubeClient *k8sClientFake.Client
+		d          *daemon
+		pod        *kapi.Pod
+	)
+
+	BeforeEach(func() {
+		pod = &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid"}}
+		kubeClient = k8sClientFake.NewClient(pod)
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+		d = &daemon{
+			config:            config.DaemonConfig{PKeyMaxMembers: 3, ManageDefaultPKey: true},
+			kubeClient:        kubeClient,
+			guidPool:          guidPool,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+		for _, allocation := range []struct{ guid, networkID string }{
+			{"02:00:00:00:00:00:00:01", "default_net-a"},
+			{"02:00:00:00:00:00:00:02", "default_net-b"},
+			{"02:00:00:00:00:00:00:03", "default_net-c"},
+		} {
+			Expect(d.allocatePodNetworkGUID(allocation.guid, utils.PodNetworkKey{PodUID: "other",
+				NetworkID: allocation.networkID})).To(Succeed())
+		}
+		// net-a and net-b use the same partition
+		d.recordNetworkPKey("default_net-a", "0x5")
+		d.recordNetworkPKey("default_net-b", "0x8005")
+		d.recordNetworkPKey("default_net-c", "0x6")
+	})
+
+	It("Count the guids of the networks of the pkey", func() {
+		limit := d.newPKeyMemberLimit("0x5")
+		Expect(limit).ToNot(BeNil())
+		Expect(limit.members).To(Equal(2))
+		Expect(testutil.ToFloat64(metrics.PKeyMembers.WithLabelValues("0x0005"))).To(Equal(2.0))
+
+		Expect(limit.admit(1)).To(Succeed())
+		Expect(limit.admit(0)).To(Succeed())
+		err := limit.admit(1)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("exceeds the maximum of 3 members"))
+		Expect(limit.members).To(Equal(3))
+	})
+	It("Don't limit the members if the limit is disabled or doesn't apply", func() {
+		Expect(d.newPKeyMemberLimit("")).To(BeNil())
+		d.config.ManageDefaultPKey = false
+		Expect(d.newPKeyMemberLimit("0x7FFF")).To(BeNil())
+		d.config.PKeyMaxMembers = 0
+		Expect(d.newPKeyMemberLimit("0x5")).To(BeNil())
+	})
+	It("Release the guids of the rejected pod network and record a warning event", func() {
+		podGUID, err := net.ParseMAC("02:00:00:00:00:00:00:10")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.allocatePodNetworkGUID(podGUID.String(), utils.PodNetworkKey{PodUID: pod.UID,
+			NetworkID: "default_net-a"})).To(Succeed())
+		limit := d.newPKeyMemberLimit("0x5")
+		limitErr := limit.admit(2)
+		Expect(limitErr).To(HaveOccurred())
+
+		exceeded := testutil.ToFloat64(metrics.PKeyMemberLimitExceeded)
+		d.rejectPKeyMemberLimit(&podNetworkInfo{pod: utils.NewPodRef(pod), addr: podGUID}, "default_net-a", limitErr)
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(podGUID.String()))
+		Expect(d.guidPodNetworkMap).To(HaveLen(3))
+		Expect(testutil.ToFloat64(metrics.PKeyMemberLimitExceeded)).To(Equal(exceeded + 1))
+
+		events, err := kubeClient.Clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].Type).To(Equal(kapi.EventTypeWarning))
+		Expect(events.Items[0].Reason).To(Equal(pKeyMemberLimitEventReason))
+		Expect(events.Items[0].Message).To(ContainSubstring("default_net-a"))
+	})
+})
@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"errors"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+)
+
+var _ = Describe("PKey Members Verification", func() {
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+		guids    []net.HardwareAddr
+	)
+
+	BeforeEach(func() {
+		smClient = &smMocks.SubnetManagerClient{}
+		d = &daemon{smClient: smClient}
+
+		guids = nil
+		for _, guidStr := range []string{"02:00:00:00:00:00:00:01", "02:00:00:00:00:00:00:02"} {
+			guidAddr, err := net.ParseMAC(guidStr)
+			Expect(err).ToNot(HaveOccurred())
+			guids = append(guids, guidAddr)
+		}
+	})
+
+	It("Succeed when all guids are members of the pkey", func() {
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(guids, nil)
+		Expect(d.verifyGUIDsInPKey(0x5, guids)).To(Succeed())
+	})
+
+	It("Fail when a guid is not a member of the pkey", func() {
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(guids[:1], nil)
+		err := d.verifyGUIDsInPKey(0x5, guids)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("02:00:00:00:00:00:00:02"))
+	})
+
+	It("Fail when the subnet manager fails to list the members", func() {
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(nil, errors.New("failed"))
+		Expect(d.verifyGUIDsInPKey(0x5, guids)).ToNot(Succeed())
+	})
+
+	It("Skip verification when the plugin doesn't support it", func() {
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(nil, plugins.ErrNotSupported)
+		Expect(d.verifyGUIDsInPKey(0x5, guids)).To(Succeed())
+	})
+})
@@ -0,0 +1,165 @@
+package daemon
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("PKey Writes Serialization", func() {
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+		running  map[int]*int32
+		overlaps int32
+		mutex    sync.Mutex
+		writes   []string
+	)
+
+	// write records the subnet manager write of the pkey, and whether it overlapped another write of the pkey
+	write := func(kind string, pKey int) func(mock.Arguments) {
+		return func(mock.Arguments) {
+			if atomic.AddInt32(running[pKey], 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			time.Sleep(5 * time.Millisecond)
+			mutex.Lock()
+			writes = append(writes, kind)
+			mutex.Unlock()
+			atomic.AddInt32(running[pKey], -1)
+		}
+	}
+
+	BeforeEach(func() {
+		running = map[int]*int32{0x5: new(int32), 0x6: new(int32)}
+		overlaps = 0
+		writes = nil
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		d = &daemon{smClient: smClient, pKeyWorkers: utils.NewKeyedWorkerPool(pKeyWriteWorkers),
+			config: config.DaemonConfig{SMBackoff: config.BackoffConfig{Duration: time.Millisecond, Factor: 1,
+				Steps: 3}}}
+	})
+
+	It("Don't interleave the adds and removes of the members of a pkey", func() {
+		guids := []net.HardwareAddr{{0x02, 0, 0, 0, 0, 0, 0, 0x01}}
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(guids, nil)
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).
+			Run(write("add", 0x5)).Return(nil)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, mock.Anything).
+			Run(write("remove", 0x5)).Return(nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(2)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(d.addGUIDsToPKey("0x5", guids)).To(Succeed())
+			}()
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				// the full membership bit doesn't make a different pkey
+				Expect(d.removeGUIDsFromPKey("0x8005", guids)).To(Succeed())
+			}()
+		}
+		wg.Wait()
+
+		Expect(atomic.LoadInt32(&overlaps)).To(BeZero())
+		Expect(writes).To(HaveLen(10))
+	})
+	It("Write the members of different pkeys in parallel", func() {
+		var bothRunning int32
+		smClient.On("GetPKeyMembers", mock.Anything, mock.Anything).Return(nil, nil)
+		started := make(chan struct{})
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Run(func(mock.Arguments) {
+			// the write of pkey 0x5 waits for the write of pkey 0x6 to start
+			select {
+			case <-started:
+				atomic.StoreInt32(&bothRunning, 1)
+			case <-time.After(5 * time.Second):
+			}
+		}).Return(nil)
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x6, mock.Anything).Run(func(mock.Arguments) {
+			close(started)
+		}).Return(nil)
+
+		var wg sync.WaitGroup
+		for _, pKey := range []string{"0x5", "0x6"} {
+			wg.Add(1)
+			go func(pKey string) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(d.addGUIDsToPKey(pKey, nil)).To(Succeed())
+			}(pKey)
+		}
+		wg.Wait()
+
+		Expect(atomic.LoadInt32(&bothRunning)).To(BeEquivalentTo(1))
+	})
+	It("Release the pool lock while the write of a pod reconcile runs", func() {
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(nil, nil)
+		unlocked := false
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Run(func(mock.Arguments) {
+			if d.poolMutex.TryLock() {
+				unlocked = true
+				d.poolMutex.Unlock()
+			}
+		}).Return(nil).Once()
+
+		d.poolMutex.Lock()
+		Expect(d.addPKeyMembers("0x5", nil, nil, d.writePKeyUnlocked)).To(Succeed())
+		Expect(d.poolMutex.TryLock()).To(BeFalse())
+		d.poolMutex.Unlock()
+		Expect(unlocked).To(BeTrue())
+	})
+	It("Don't interleave the writes of the pod reconciles with the writes holding the pool lock", func() {
+		guids := []net.HardwareAddr{{0x02, 0, 0, 0, 0, 0, 0, 0x01}}
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(guids, nil)
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).
+			Run(write("add", 0x5)).Return(nil)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, mock.Anything).
+			Run(write("remove", 0x5)).Return(nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(2)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				d.poolMutex.Lock()
+				defer d.poolMutex.Unlock()
+				Expect(d.addPKeyMembers("0x5", guids, nil, d.writePKeyUnlocked)).To(Succeed())
+			}()
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				d.poolMutex.Lock()
+				defer d.poolMutex.Unlock()
+				Expect(d.removeGUIDsFromPKey("0x5", guids)).To(Succeed())
+			}()
+		}
+		wg.Wait()
+
+		Expect(atomic.LoadInt32(&overlaps)).To(BeZero())
+		Expect(writes).To(HaveLen(10))
+	})
+	It("Write in the calling goroutine without workers", func() {
+		d.pKeyWorkers = nil
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x6, mock.Anything).
+			Run(write("remove", 0x6)).Return(nil).Once()
+
+		Expect(d.removeGUIDsFromPKey("0x6", nil)).To(Succeed())
+		Expect(writes).To(Equal([]string{"remove"}))
+	})
+})
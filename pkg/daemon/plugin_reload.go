@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+// loadSubnetManagerClient initializes the subnet manager client of the plugin compiled into the daemon binary,
+// or else loads the plugin from the plugin path. Plugins of unsupported spec versions are refused, the methods
+// newer than the plugin spec aren't used.
+func loadSubnetManagerClient(pluginLoader sm.PluginLoader, pluginPath, plugin string) (
+	plugins.SubnetManagerClient, error) {
+	getSmClientFunc, builtin := sm.BuiltinPlugin(plugin)
+	if builtin {
+		log.Info().Msgf("using built-in subnet manager plugin %s", plugin)
+	} else {
+		var err error
+		getSmClientFunc, err = pluginLoader.LoadPlugin(path.Join(pluginPath, plugin+".so"), sm.InitializePluginFunc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	smClient, err := getSmClientFunc()
+	if err != nil {
+		return nil, err
+	}
+	return sm.NewSpecGatedClient(smClient)
+}
+
+// ReloadPlugin loads and initializes the subnet manager plugin again, e.g. to apply rotated credentials, or
+// loads another plugin. The new plugin is validated before it replaces the plugin used by the periodic
+// updates, the current plugin is kept if it fails to load or validate.
+func (d *daemon) ReloadPlugin(reload admin.PluginReload) error {
+	d.poolMutex.Lock()
+	plugin, pluginPath := d.config.Plugin, d.config.PluginPath
+	d.poolMutex.Unlock()
+	if reload.Plugin != "" {
+		plugin = reload.Plugin
+	}
+	if reload.PluginPath != "" {
+		pluginPath = reload.PluginPath
+	}
+
+	log.Info().Msgf("reloading subnet manager plugin %s from %s", plugin, pluginPath)
+	smClient, err := loadSubnetManagerClient(d.pluginLoader, pluginPath, plugin)
+	if err != nil {
+		return fmt.Errorf("failed to reload subnet manager plugin %s: %v", plugin, err)
+	}
+	if err = d.callSubnetManager(smClient.Validate); err != nil {
+		return fmt.Errorf("failed to validate subnet manager plugin %s: %v", plugin, err)
+	}
+
+	// The reconcilers use the subnet manager client while holding the pool mutex
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	previous := d.smClient.Name()
+	d.smClient = smClient
+	d.config.Plugin = plugin
+	d.config.PluginPath = pluginPath
+
+	log.Info().Msgf("subnet manager plugin %s replaced by %s", previous, smClient.Name())
+	return nil
+}
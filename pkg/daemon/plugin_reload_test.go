@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/admin"
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+)
+
+// fakePluginLoader returns the subnet manager client of the loaded plugin path
+type fakePluginLoader struct {
+	clients map[string]plugins.SubnetManagerClient
+}
+
+func (f *fakePluginLoader) LoadPlugin(path, _ string) (sm.PluginInitialize, error) {
+	smClient, exist := f.clients[path]
+	if !exist {
+		return nil, errors.New("failed to load plugin: no such file")
+	}
+	return func() (plugins.SubnetManagerClient, error) { return smClient, nil }, nil
+}
+
+var _ = Describe("Subnet Manager Plugin Reload", func() {
+	var (
+		current *smMocks.SubnetManagerClient
+		loader  *fakePluginLoader
+		d       *daemon
+	)
+
+	newSMClient := func(name string, validateErr error) *smMocks.SubnetManagerClient {
+		smClient := &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return(name).Maybe()
+		smClient.On("Validate", mock.Anything).Return(validateErr).Maybe()
+		smClient.On("Spec").Return("2.0").Maybe()
+		return smClient
+	}
+
+	BeforeEach(func() {
+		current = newSMClient("ufm", nil)
+		loader = &fakePluginLoader{clients: make(map[string]plugins.SubnetManagerClient)}
+		d = &daemon{
+			config:       config.DaemonConfig{Plugin: "ufm", PluginPath: "/plugins"},
+			smClient:     current,
+			pluginLoader: loader,
+		}
+	})
+
+	It("Reload current plugin", func() {
+		reloaded := newSMClient("ufm", nil)
+		loader.clients["/plugins/ufm.so"] = reloaded
+
+		Expect(d.ReloadPlugin(admin.PluginReload{})).To(Succeed())
+		Expect(d.smClient).To(BeIdenticalTo(reloaded))
+		reloaded.AssertCalled(GinkgoT(), "Validate", mock.Anything)
+	})
+	It("Swap plugin name and path", func() {
+		noop := newSMClient("noop", nil)
+		loader.clients["/plugins/v2/noop.so"] = noop
+
+		Expect(d.ReloadPlugin(admin.PluginReload{Plugin: "noop", PluginPath: "/plugins/v2"})).To(Succeed())
+		Expect(d.smClient).To(BeIdenticalTo(noop))
+		Expect(d.config.Plugin).To(Equal("noop"))
+		Expect(d.config.PluginPath).To(Equal("/plugins/v2"))
+	})
+	It("Keep current plugin if the plugin fails to load", func() {
+		err := d.ReloadPlugin(admin.PluginReload{Plugin: "missing"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to reload subnet manager plugin missing"))
+		Expect(d.smClient).To(BeIdenticalTo(current))
+		Expect(d.config.Plugin).To(Equal("ufm"))
+	})
+	It("Keep current plugin if the plugin fails to validate", func() {
+		loader.clients["/plugins/ufm.so"] = newSMClient("ufm", errors.New("invalid credentials"))
+
+		err := d.ReloadPlugin(admin.PluginReload{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid credentials"))
+		Expect(d.smClient).To(BeIdenticalTo(current))
+	})
+	It("Keep current plugin if its spec version isn't supported", func() {
+		reloaded := &smMocks.SubnetManagerClient{}
+		reloaded.On("Name").Return("ufm").Maybe()
+		reloaded.On("Spec").Return("1.1")
+		loader.clients["/plugins/ufm.so"] = reloaded
+
+		err := d.ReloadPlugin(admin.PluginReload{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("plugin spec version 1.1 is not supported"))
+		reloaded.AssertNotCalled(GinkgoT(), "Validate", mock.Anything)
+		Expect(d.smClient).To(BeIdenticalTo(current))
+	})
+	It("Use the built-in plugin instead of loading the plugin file", func() {
+		builtin := newSMClient("builtin-reload-test", nil)
+		sm.RegisterBuiltinPlugin("builtin-reload-test", func() (plugins.SubnetManagerClient, error) {
+			return builtin, nil
+		})
+
+		Expect(d.ReloadPlugin(admin.PluginReload{Plugin: "builtin-reload-test"})).To(Succeed())
+		Expect(d.smClient).To(BeIdenticalTo(builtin))
+		Expect(d.config.Plugin).To(Equal("builtin-reload-test"))
+	})
+})
@@ -0,0 +1,245 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// resourceVersionWriter fails the annotation writes of a pod read with a stale resource version, as a server-side
+// apply of the resource version does
+type resourceVersionWriter struct {
+	client k8sClient.Client
+	writer k8sClient.AnnotationWriter
+}
+
+func (w *resourceVersionWriter) WriteAnnotations(pod *kapi.Pod, annotations map[string]string) error {
+	current, err := w.client.GetPod(pod.Namespace, pod.Name)
+	if err != nil {
+		return err
+	}
+	if current.ResourceVersion != pod.ResourceVersion {
+		return fmt.Errorf("%w: resource version %s changed to %s", k8sClient.ErrAnnotationConflict,
+			pod.ResourceVersion, current.ResourceVersion)
+	}
+	return w.writer.WriteAnnotations(pod, annotations)
+}
+
+var _ = Describe("Pod Annotation Retries", func() {
+	const (
+		networkID = "default_ib-net"
+		podGUID   = "02:00:00:00:00:00:00:01"
+	)
+
+	var (
+		d      *daemon
+		client *k8sClientFake.Client
+		pod    *utils.PodRef
+		// writeErr is the error of the last annotation write, the pod is requeued if it is set
+		writeErr error
+	)
+
+	failPatches := func() {
+		client.Clientset.PrependReactor("patch", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("api server unavailable")
+		})
+	}
+
+	// writeAnnotation allocates the pod guid and writes the pod annotation as the pod reconciler does
+	writeAnnotation := func() utils.PodNetworkKey {
+		netMap := networksMap{theMap: make(map[types.UID][]*v1.NetworkSelectionElement),
+			annotations: make(map[types.UID]string)}
+		pis, err := getPodNetworkInfos(networkID, pod, netMap)
+		Expect(err).ToNot(HaveOccurred())
+		pi := pis[0]
+		key := utils.GeneratePodNetworkKey(pod, pi.ibNetwork)
+		if retriedGUID, retried := d.retriedPodNetworkGUID(key); retried {
+			Expect(retriedGUID).To(Equal(podGUID))
+		} else {
+			Expect(d.allocatePodNetworkGUID(podGUID, key)).To(Succeed())
+		}
+		guidAddr, err := guid.ParseGUID(podGUID)
+		Expect(err).ToNot(HaveOccurred())
+		pi.addr = guidAddr.HardWareAddress()
+
+		updates := newPodAnnotationUpdates()
+		updates.add(pi, networkID, &utils.IbSriovCniSpec{}, false)
+		writeErr = d.writePodAnnotations(context.Background(), updates, netMap)
+		return key
+	}
+
+	BeforeEach(func() {
+		pod = &utils.PodRef{Name: "pod", Namespace: "default", UID: "uid",
+			Annotations: map[string]string{v1.NetworkAttachmentAnnot: `[{"name": "ib-net", "namespace": "default"}]`}}
+		client = k8sClientFake.NewClient(pod.Pod().DeepCopy())
+		annotationWriter, err := k8sClient.NewAnnotationWriter(k8sClient.MergePatchAnnotationWriter, client)
+		Expect(err).ToNot(HaveOccurred())
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+		d = &daemon{
+			kubeClient:        client,
+			annotationWriter:  annotationWriter,
+			guidPool:          guidPool,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+			annotationRetries: make(map[types.UID]int),
+			config: config.DaemonConfig{AnnotationRetries: 1,
+				K8sPatchBackoff: config.BackoffConfig{Duration: 1, Steps: 1}},
+		}
+	})
+
+	It("Keep the guid of a pod which annotation write failed until its retries are exhausted", func() {
+		failPatches()
+		key := writeAnnotation()
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(podGUID, key))
+		Expect(d.annotationRetries).To(HaveKeyWithValue(pod.UID, 1))
+		Expect(writeErr).To(HaveOccurred())
+		Expect(pod.Annotations[v1.NetworkAttachmentAnnot]).ToNot(ContainSubstring(podGUID))
+
+		writeAnnotation()
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		Expect(d.annotationRetries).To(BeEmpty())
+		Expect(writeErr).ToNot(HaveOccurred())
+	})
+	It("Clear the retries of a pod once its annotation is written", func() {
+		failPatches()
+		writeAnnotation()
+		Expect(d.annotationRetries).To(HaveKey(pod.UID))
+
+		client.Clientset.ReactionChain = client.Clientset.ReactionChain[1:]
+		writeAnnotation()
+		Expect(d.annotationRetries).To(BeEmpty())
+		Expect(d.guidPodNetworkMap).To(HaveKey(podGUID))
+
+		updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated.Annotations[utils.InterfacesStatusAnnotation]).To(ContainSubstring(podGUID))
+	})
+	It("Release the guid of a deleted pod without retries", func() {
+		deleted := testutil.ToFloat64(metrics.PodsDeletedBeforeAnnotation)
+		Expect(client.Clientset.CoreV1().Pods("default").Delete(context.Background(), "pod",
+			metav1.DeleteOptions{})).To(Succeed())
+		d.summary = &cycleSummary{}
+		writeAnnotation()
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		Expect(d.annotationRetries).To(BeEmpty())
+		Expect(writeErr).ToNot(HaveOccurred())
+		Expect(testutil.ToFloat64(metrics.PodsDeletedBeforeAnnotation)).To(Equal(deleted + 1))
+		Expect(d.summary.Failures).To(BeZero())
+	})
+	It("Release the guid of a pod deleted while its annotation write was retried", func() {
+		failPatches()
+		writeAnnotation()
+		Expect(d.annotationRetries).To(HaveKey(pod.UID))
+
+		client.Clientset.ReactionChain = client.Clientset.ReactionChain[1:]
+		Expect(client.Clientset.CoreV1().Pods("default").Delete(context.Background(), "pod",
+			metav1.DeleteOptions{})).To(Succeed())
+		writeAnnotation()
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		Expect(d.annotationRetries).To(BeEmpty())
+		Expect(writeErr).ToNot(HaveOccurred())
+	})
+	It("Release the guid of a pod recreated with the same name without annotating the new pod", func() {
+		Expect(client.Clientset.CoreV1().Pods("default").Delete(context.Background(), "pod",
+			metav1.DeleteOptions{})).To(Succeed())
+		recreated := pod.Pod().DeepCopy()
+		recreated.UID = "new-uid"
+		_, err := client.Clientset.CoreV1().Pods("default").Create(context.Background(), recreated,
+			metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		// the fake clientset doesn't check the uid precondition of the patch as the api server does
+		client.Clientset.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			patch := struct {
+				Metadata metav1.ObjectMeta `json:"metadata"`
+			}{}
+			Expect(json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &patch)).To(Succeed())
+			if patch.Metadata.UID != recreated.UID {
+				return true, nil, kerrors.NewConflict(schema.GroupResource{Resource: "pods"}, "pod",
+					errors.New("uid precondition failed"))
+			}
+			return false, nil, nil
+		})
+		conflicts := testutil.ToFloat64(metrics.PodAnnotationConflicts)
+		d.summary = &cycleSummary{}
+
+		writeAnnotation()
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		Expect(d.annotationRetries).To(BeEmpty())
+		Expect(writeErr).ToNot(HaveOccurred())
+		Expect(d.summary.Failures).To(BeZero())
+		Expect(testutil.ToFloat64(metrics.PodAnnotationConflicts)).To(Equal(conflicts + 1))
+
+		current, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(current.Annotations).ToNot(HaveKey(utils.InterfacesStatusAnnotation))
+	})
+	Context("Pod modified since it was read", func() {
+		// updatePod updates the pod in kubernetes with a new resource version, as the kubelet status updates do
+		updatePod := func(annotations map[string]string) {
+			current := pod.Pod().DeepCopy()
+			current.ResourceVersion = "2"
+			for key, value := range annotations {
+				current.Annotations[key] = value
+			}
+			_, err := client.Clientset.CoreV1().Pods("default").Update(context.Background(), current,
+				metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			pod.ResourceVersion = "1"
+			d.annotationWriter = &resourceVersionWriter{client: client, writer: d.annotationWriter}
+		})
+
+		It("Write the annotation with the fresh resource version of the pod", func() {
+			updatePod(nil)
+			writeAnnotation()
+			Expect(d.annotationRetries).To(BeEmpty())
+			Expect(d.guidPodNetworkMap).To(HaveKey(podGUID))
+			Expect(pod.ResourceVersion).To(Equal("2"))
+
+			updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod",
+				metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(updated.Annotations[utils.InterfacesStatusAnnotation]).To(ContainSubstring(podGUID))
+		})
+		It("Retry the annotation write from the fresh pod if its annotations were modified", func() {
+			modified := `[{"name": "ib-net", "namespace": "default", "interface": "ib0"}]`
+			updatePod(map[string]string{v1.NetworkAttachmentAnnot: modified})
+			key := writeAnnotation()
+			Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(podGUID, key))
+			Expect(d.annotationRetries).To(HaveKeyWithValue(pod.UID, 1))
+			Expect(writeErr).To(HaveOccurred())
+			Expect(pod.ResourceVersion).To(Equal("2"))
+			Expect(pod.Annotations[v1.NetworkAttachmentAnnot]).To(Equal(modified))
+		})
+	})
+	It("Release the guid on the first failure if retries are disabled", func() {
+		d.config.AnnotationRetries = 0
+		failPatches()
+		writeAnnotation()
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		Expect(writeErr).ToNot(HaveOccurred())
+	})
+})
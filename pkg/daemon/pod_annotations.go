@@ -0,0 +1,415 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sort"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/tracing"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// configuredPodNetwork is a pod network configured with a guid in its network pkey
+type configuredPodNetwork struct {
+	networkID string
+	pKey      string
+	addr      net.HardwareAddr
+	// iface is the name of the pod interface of the network
+	iface string
+	// rdmaIsolation is set if the network advertises the "rdmaIsolation" capability
+	rdmaIsolation bool
+}
+
+// networkPKey identifies the pkey of a network
+type networkPKey struct {
+	networkID string
+	pKey      string
+}
+
+// podAnnotationUpdate is the pending network annotation update of a pod
+type podAnnotationUpdate struct {
+	pod      *utils.PodRef
+	networks []*v1.NetworkSelectionElement
+	// configured networks of the pod, their guids are released if the annotation can't be written
+	configured []configuredPodNetwork
+	// configuredNetworks is the pod configured networks annotation marking networks which guid is delivered as
+	// runtime config only, currentConfiguredNetworks is its value before the update
+	configuredNetworks        string
+	currentConfiguredNetworks string
+}
+
+// podAnnotationUpdates collects the annotation updates of the configured pods, so the annotation of a pod
+// configured on several networks is written once
+type podAnnotationUpdates struct {
+	updates map[types.UID]*podAnnotationUpdate
+	// order of the pods in which their annotations are written
+	order []types.UID
+}
+
+func newPodAnnotationUpdates() *podAnnotationUpdates {
+	return &podAnnotationUpdates{updates: make(map[types.UID]*podAnnotationUpdate)}
+}
+
+// add marks the pod network as configured with InfiniBand and queues the pod annotation update. Networks which
+// guid is delivered as runtime config only are marked in the pod configured networks annotation, so their
+// "cni-args" aren't modified. Networks with the "infinibandPKey" capability also receive their pkey in their
+// "cni-args".
+func (u *podAnnotationUpdates) add(pi *podNetworkInfo, networkID string, spec *utils.IbSriovCniSpec,
+	runtimeConfigOnly bool) {
+	update, exist := u.updates[pi.pod.UID]
+	if !exist {
+		configuredNetworks := pi.pod.Annotations[utils.ConfiguredNetworksAnnotation]
+		update = &podAnnotationUpdate{pod: pi.pod, networks: pi.networks, configuredNetworks: configuredNetworks,
+			currentConfiguredNetworks: configuredNetworks}
+		u.updates[pi.pod.UID] = update
+		u.order = append(u.order, pi.pod.UID)
+	}
+
+	if runtimeConfigOnly && pi.ibNetwork.InfinibandGUIDRequest != "" {
+		update.configuredNetworks = utils.AddConfiguredNetwork(update.configuredNetworks, pi.ibNetwork)
+	} else {
+		if pi.ibNetwork.CNIArgs == nil {
+			pi.ibNetwork.CNIArgs = &map[string]interface{}{}
+		}
+		(*pi.ibNetwork.CNIArgs)[utils.InfiniBandAnnotation] = utils.ConfiguredInfiniBandPod
+		if spec.Capabilities.PKeyInCNIArgs() && spec.PKey != "" {
+			(*pi.ibNetwork.CNIArgs)[utils.PKeyCNIArg] = spec.PKey
+		}
+	}
+	update.configured = append(update.configured, configuredPodNetwork{networkID: networkID, pKey: spec.PKey,
+		addr: pi.addr, iface: utils.PodNetworkInterfaceName(pi.networks, pi.ibNetwork),
+		rdmaIsolation: spec.Capabilities.IsRDMAIsolated()})
+}
+
+// writePodAnnotations writes the queued annotations updates of the pods. Pods which annotation couldn't be written
+// keep their GUIDs and the write errors are returned, so the pods are requeued and the write is retried. The GUIDs
+// of pods which retries are exhausted are released and removed from their pkeys, as the GUIDs of pods deleted
+// before their annotation was written, which aren't retried.
+func (d *daemon) writePodAnnotations(ctx context.Context, updates *podAnnotationUpdates, netMap networksMap) error {
+	if len(updates.order) == 0 {
+		return nil
+	}
+	_, span := tracing.Start(ctx, "updatePodNetworkAnnotations")
+	defer tracing.End(span, nil)
+
+	var retried []error
+	// guids of pods which annotation couldn't be written, by network and pkey
+	removed := make(map[networkPKey][]net.HardwareAddr)
+	var removedOrder []networkPKey
+	for _, uid := range updates.order {
+		update := updates.updates[uid]
+		err := d.writePodNetworkAnnotation(update, netMap)
+		switch {
+		case err == nil:
+			delete(d.annotationRetries, uid)
+			d.summary.podConfigured()
+			continue
+		case kerrors.IsNotFound(err) || errors.Is(err, k8sClient.ErrPodRecreated):
+			// the guids of the pod are released here rather than by the reconcile of its deletion, which would
+			// hold them for the removal delay. A pod recreated with the same name is a new pod, it is configured
+			// with its own guids.
+			log.Info().Msgf("pod namespace %s name %s was deleted before its network annotation was written, "+
+				"releasing its guids", update.pod.Namespace, update.pod.Name)
+			delete(d.annotationRetries, uid)
+			metrics.PodsDeletedBeforeAnnotation.Inc()
+		default:
+			log.Error().Msgf("%v", err)
+			d.summary.failure()
+			if d.retryPodAnnotation(update) {
+				retried = append(retried, err)
+				continue
+			}
+		}
+
+		for _, network := range update.configured {
+			if err := d.releasePodNetworkGUID(network.addr.String()); err != nil {
+				log.Warn().Msgf("failed to release guid \"%s\" from removed pod \"%s\" in namespace "+
+					"\"%s\" with error: %v", network.addr.String(), update.pod.Name, update.pod.Namespace, err)
+			}
+
+			key := networkPKey{networkID: network.networkID, pKey: network.pKey}
+			if _, exist := removed[key]; !exist {
+				removedOrder = append(removedOrder, key)
+			}
+			removed[key] = append(removed[key], network.addr)
+		}
+	}
+
+	for _, key := range removedOrder {
+		guids := removed[key]
+		if key.pKey != "" {
+			if err := d.removeGUIDsFromPKey(key.pKey, guids); err != nil {
+				log.Warn().Msgf("failed to remove guids of removed pods: %v", err)
+				d.setNetworkSyncFailed(key.networkID, "RemoveMembersFailed", err, false)
+				continue
+			}
+		}
+		if err := d.removeGUIDsFromLimitedPartition(key.pKey, guids); err != nil {
+			log.Warn().Msgf("failed to remove guids of removed pods from default limited partition: %v", err)
+			d.setNetworkSyncFailed(key.networkID, "RemoveLimitedMembersFailed", err, false)
+		}
+	}
+	return errors.Join(retried...)
+}
+
+// writePodNetworkAnnotation writes the network annotation of the pod, the write is skipped if the annotation
+// didn't change since it was read from or written to kubernetes
+func (d *daemon) writePodNetworkAnnotation(update *podAnnotationUpdate, netMap networksMap) error {
+	pod := update.pod
+	// the annotations the update is computed from, a write conflicting with another update of the pod, e.g. of its
+	// status, is retried with the fresh resource version of the pod if they didn't change
+	read := maps.Clone(pod.Annotations)
+	netAnnotations, err := utils.MarshalPodNetworks(update.networks, pod.Annotations[v1.NetworkAttachmentAnnot])
+	if err != nil {
+		log.Error().Msgf("failed to dump networks %+v of pod into json with error: %v", update.networks, err)
+		return err
+	}
+
+	annotations := map[string]string{v1.NetworkAttachmentAnnot: string(netAnnotations)}
+	if update.configuredNetworks != update.currentConfiguredNetworks {
+		annotations[utils.ConfiguredNetworksAnnotation] = update.configuredNetworks
+	}
+	currentStatus, currentStatusExist := pod.Annotations[utils.InterfacesStatusAnnotation]
+	if status := interfacesStatus(update); status != currentStatus {
+		annotations[utils.InterfacesStatusAnnotation] = status
+	}
+	currentMetadata, currentMetadataExist := pod.Annotations[utils.InfiniBandMetadataAnnotation]
+	if d.config.PodMetadata {
+		if metadata := d.infiniBandMetadata(update); metadata != currentMetadata {
+			annotations[utils.InfiniBandMetadataAnnotation] = metadata
+		}
+	}
+
+	current, exist := netMap.annotations[pod.UID]
+	if exist && current == string(netAnnotations) && len(annotations) == 1 {
+		log.Debug().Msgf("network annotation of pod namespace %s name %s is up to date, skipping update",
+			pod.Namespace, pod.Name)
+		return nil
+	}
+
+	for key, value := range annotations {
+		pod.Annotations[key] = value
+	}
+	// a server-side apply removes the annotations applied before and left out of the applied configuration, so
+	// the unchanged annotations owned by ib-kubernetes are written as well
+	for _, key := range d.ownedPodAnnotations() {
+		if value, exist := pod.Annotations[key]; exist {
+			annotations[key] = value
+		}
+	}
+
+	// Try to set pod's annotations in backoff loop
+	var fresh *utils.PodRef
+	if err = wait.ExponentialBackoff(newBackoff(d.config.K8sPatchBackoff), func() (bool, error) {
+		err = d.annotationWriter.WriteAnnotations(pod.Pod(), annotations)
+		if errors.Is(err, k8sClient.ErrAnnotationConflict) {
+			if fresh = d.readFreshPod(pod); fresh != nil && maps.Equal(fresh.Annotations, read) {
+				log.Info().Msgf("pod namespace %s name %s was modified since it was read, writing its annotations "+
+					"with resource version %s", pod.Namespace, pod.Name, fresh.ResourceVersion)
+				pod.ResourceVersion = fresh.ResourceVersion
+				fresh = nil
+				err = d.annotationWriter.WriteAnnotations(pod.Pod(), annotations)
+			}
+		}
+		if err != nil {
+			if kerrors.IsNotFound(err) {
+				return false, err
+			}
+			if errors.Is(err, k8sClient.ErrAnnotationConflict) || errors.Is(err, k8sClient.ErrPodRecreated) ||
+				errors.Is(err, k8sClient.ErrAnnotationOwned) {
+				log.Warn().Msgf("failed to update pod annotations with err: %v", err)
+				metrics.PodAnnotationConflicts.Inc()
+				return false, err
+			}
+			log.Warn().Msgf("failed to update pod annotations with err: %v", err)
+			return false, nil
+		}
+
+		return true, nil
+	}); err != nil {
+		// keep the pod as in kubernetes, so its annotation isn't considered as written by the next updates
+		if exist {
+			pod.Annotations[v1.NetworkAttachmentAnnot] = current
+		}
+		if update.currentConfiguredNetworks == "" {
+			delete(pod.Annotations, utils.ConfiguredNetworksAnnotation)
+		} else {
+			pod.Annotations[utils.ConfiguredNetworksAnnotation] = update.currentConfiguredNetworks
+		}
+		restoreAnnotation(pod, utils.InterfacesStatusAnnotation, currentStatus, currentStatusExist)
+		restoreAnnotation(pod, utils.InfiniBandMetadataAnnotation, currentMetadata, currentMetadataExist)
+		if fresh != nil {
+			// the annotations were modified concurrently, the retried write is computed from the fresh pod
+			pod.ResourceVersion = fresh.ResourceVersion
+			pod.Annotations = fresh.Annotations
+		}
+		return fmt.Errorf("failed to update annotations of pod namespace %s name %s: %w", pod.Namespace,
+			pod.Name, err)
+	}
+
+	netMap.annotations[pod.UID] = string(netAnnotations)
+	update.currentConfiguredNetworks = update.configuredNetworks
+	return nil
+}
+
+// readFreshPod reads the pod again after a conflicting annotation write, nil if the pod can't be read or was
+// recreated
+func (d *daemon) readFreshPod(pod *utils.PodRef) *utils.PodRef {
+	current, err := d.kubeClient.GetPod(pod.Namespace, pod.Name)
+	if err != nil || current.UID != pod.UID {
+		return nil
+	}
+	return utils.NewPodRef(current)
+}
+
+// retryPodAnnotation keeps the GUIDs of the pod which annotation write failed allocated and in their pkeys, so the
+// requeued pod is configured again with them and only the write is retried, instead of configuring the pod with
+// new GUIDs. It returns false if its retries are exhausted, then its GUIDs are released.
+func (d *daemon) retryPodAnnotation(update *podAnnotationUpdate) bool {
+	pod := update.pod
+	attempts := d.annotationRetries[pod.UID] + 1
+	if attempts > d.config.AnnotationRetries {
+		delete(d.annotationRetries, pod.UID)
+		return false
+	}
+
+	log.Info().Msgf("keeping guids of pod namespace %s name %s, retrying its annotation write, attempt %d of %d",
+		pod.Namespace, pod.Name, attempts, d.config.AnnotationRetries)
+	d.annotationRetries[pod.UID] = attempts
+	return true
+}
+
+// retriedPodNetworkGUID returns the guid kept allocated for the pod network interface which configuration is
+// retried, e.g. after its annotation write or pkey update failed, the first guid of interfaces allocated several
+// guids
+func (d *daemon) retriedPodNetworkGUID(key utils.PodNetworkKey) (string, bool) {
+	guids := d.retriedPodNetworkGUIDs(key)
+	if len(guids) == 0 {
+		return "", false
+	}
+	return guids[0], true
+}
+
+// retriedExtraNetworkGUIDs returns the additional guids kept allocated for the pod network interface which
+// configuration is retried, other than the interface guid and the known guids
+func (d *daemon) retriedExtraNetworkGUIDs(key utils.PodNetworkKey, interfaceGUID string, known []string) []string {
+	var extraGUIDs []string
+	for _, retriedGUID := range d.retriedPodNetworkGUIDs(key) {
+		if retriedGUID != interfaceGUID && !slices.Contains(known, retriedGUID) {
+			extraGUIDs = append(extraGUIDs, retriedGUID)
+		}
+	}
+	return extraGUIDs
+}
+
+// retriedPodNetworkGUIDs returns the sorted guids kept allocated for the pod network interface which configuration
+// is retried. The guids of the configured interfaces are set in the pod annotation, so the interfaces which
+// annotation has no guid but which have guids allocated are retried.
+func (d *daemon) retriedPodNetworkGUIDs(key utils.PodNetworkKey) []string {
+	var guids []string
+	for guidAddr, mappedKey := range d.guidPodNetworkMap {
+		if mappedKey == key {
+			guids = append(guids, guidAddr)
+		}
+	}
+	sort.Strings(guids)
+	return guids
+}
+
+// interfacesStatus returns the pod interfaces status annotation with the configured networks of the update, the
+// interfaces configured by previous updates are kept
+func interfacesStatus(update *podAnnotationUpdate) string {
+	interfaces, err := utils.ParseInterfacesStatus(update.pod)
+	if err != nil {
+		log.Warn().Msgf("overwriting invalid interfaces status: %v", err)
+		interfaces = make(map[string]utils.InterfaceStatus)
+	}
+	for _, network := range update.configured {
+		interfaces[network.iface] = utils.InterfaceStatus{Network: network.networkID, GUID: network.addr.String(),
+			PKey: network.pKey, State: utils.InterfaceStateConfigured}
+	}
+
+	status, err := json.Marshal(interfaces)
+	if err != nil {
+		log.Error().Msgf("failed to dump interfaces status %+v of pod into json with error: %v", interfaces, err)
+		return update.pod.Annotations[utils.InterfacesStatusAnnotation]
+	}
+	return string(status)
+}
+
+// infiniBandMetadata returns the pod InfiniBand metadata annotation with the configured networks of the update,
+// the interfaces configured by previous updates are kept
+func (d *daemon) infiniBandMetadata(update *podAnnotationUpdate) string {
+	metadata, err := utils.ParseInfiniBandMetadata(update.pod)
+	if err != nil {
+		log.Warn().Msgf("overwriting infiniband metadata: %v", err)
+		metadata = &utils.InfiniBandMetadata{Interfaces: make(map[string]utils.InterfaceMetadata)}
+	}
+	metadata.Version = utils.InfiniBandMetadataVersion
+	metadata.Fabric = d.config.FabricName
+	for _, network := range update.configured {
+		iface := utils.InterfaceMetadata{Network: network.networkID, GUID: network.addr.String(), PKey: network.pKey,
+			RDMAIsolation: network.rdmaIsolation}
+		if network.pKey != "" {
+			iface.Membership = utils.MembershipFull
+		}
+		if d.useLimitedPartition(network.pKey) {
+			iface.LimitedPKey = d.config.DefaultLimitedPartition
+		}
+		metadata.Interfaces[network.iface] = iface
+	}
+
+	annotation, err := json.Marshal(metadata)
+	if err != nil {
+		log.Error().Msgf("failed to dump infiniband metadata %+v of pod into json with error: %v", metadata, err)
+		return update.pod.Annotations[utils.InfiniBandMetadataAnnotation]
+	}
+	return string(annotation)
+}
+
+// ownedPodAnnotations returns the pod annotations written by ib-kubernetes besides the network annotation, the
+// InfiniBand metadata annotation is owned only if enabled
+func (d *daemon) ownedPodAnnotations() []string {
+	owned := []string{utils.ConfiguredNetworksAnnotation, utils.InterfacesStatusAnnotation}
+	if d.config.PodMetadata {
+		owned = append(owned, utils.InfiniBandMetadataAnnotation)
+	}
+	return owned
+}
+
+// restoreAnnotation sets the annotation of the pod back to its value before a failed write
+func restoreAnnotation(pod *utils.PodRef, key, value string, exist bool) {
+	if exist {
+		pod.Annotations[key] = value
+	} else {
+		delete(pod.Annotations, key)
+	}
+}
+
+// guidAsRuntimeConfig returns true if the guid is delivered to the network as runtime config, the network
+// "infinibandGUID" capability overrides the daemon guid injection mode
+func (d *daemon) guidAsRuntimeConfig(spec *utils.IbSriovCniSpec) bool {
+	if spec.Capabilities.InfiniBandGUID != nil {
+		return *spec.Capabilities.InfiniBandGUID
+	}
+	return d.config.GUIDInjectionMode == utils.GUIDInjectionRuntimeConfig
+}
+
+// runtimeConfigOnly returns true if the network "cni-args" must not be modified, i.e. the guid is delivered as
+// runtime config and the daemon guid injection mode is "runtime-config"
+func (d *daemon) runtimeConfigOnly(spec *utils.IbSriovCniSpec) bool {
+	return d.config.GUIDInjectionMode == utils.GUIDInjectionRuntimeConfig && d.guidAsRuntimeConfig(spec)
+}
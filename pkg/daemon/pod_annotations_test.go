@@ -0,0 +1,269 @@
+package daemon
+
+import (
+	"context"
+	"net"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// applyWriter writes the annotations as a server-side apply of a single field manager does, the annotations it
+// applied before and which are left out of an apply are removed
+type applyWriter struct {
+	annotations map[string]string
+	applied     map[string]bool
+}
+
+func (w *applyWriter) WriteAnnotations(_ *kapi.Pod, annotations map[string]string) error {
+	for key := range w.applied {
+		if _, exist := annotations[key]; !exist {
+			delete(w.annotations, key)
+		}
+	}
+	w.applied = make(map[string]bool, len(annotations))
+	for key, value := range annotations {
+		w.annotations[key] = value
+		w.applied[key] = true
+	}
+	return nil
+}
+
+var _ = Describe("Pod Annotation Updates", func() {
+	var (
+		d      *daemon
+		client *k8sClientFake.Client
+		pod    *utils.PodRef
+		netMap networksMap
+	)
+
+	patchCount := func() int {
+		count := 0
+		for _, action := range client.Clientset.Actions() {
+			if _, ok := action.(k8stesting.PatchAction); ok {
+				count++
+			}
+		}
+		return count
+	}
+
+	pKeySpec := func(pKey string) *utils.IbSriovCniSpec {
+		return &utils.IbSriovCniSpec{PKey: pKey}
+	}
+
+	newPodNetworkInfo := func(networkID string) *podNetworkInfo {
+		pis, err := getPodNetworkInfos(networkID, pod, netMap)
+		Expect(err).ToNot(HaveOccurred())
+		pi := pis[0]
+		pi.addr = net.HardwareAddr{0x02, 0, 0, 0, 0, 0, 0, 0x01}
+		return pi
+	}
+
+	BeforeEach(func() {
+		pod = &utils.PodRef{Name: "pod", Namespace: "default", UID: types.UID("uid"),
+			Annotations: map[string]string{v1.NetworkAttachmentAnnot: `[` +
+				`{"name": "ib-net-1", "namespace": "default"}, {"name": "ib-net-2", "namespace": "default"}]`}}
+		client = k8sClientFake.NewClient(pod.Pod().DeepCopy())
+		annotationWriter, err := k8sClient.NewAnnotationWriter(k8sClient.MergePatchAnnotationWriter, client)
+		Expect(err).ToNot(HaveOccurred())
+		d = &daemon{kubeClient: client, annotationWriter: annotationWriter}
+		netMap = networksMap{theMap: make(map[types.UID][]*v1.NetworkSelectionElement),
+			annotations: make(map[types.UID]string)}
+	})
+
+	It("Write the annotation of a pod configured on several networks once", func() {
+		updates := newPodAnnotationUpdates()
+		updates.add(newPodNetworkInfo("default_ib-net-1"), "default_ib-net-1", pKeySpec("0x5"), false)
+		updates.add(newPodNetworkInfo("default_ib-net-2"), "default_ib-net-2", pKeySpec("0x6"), false)
+
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+		Expect(patchCount()).To(Equal(1))
+
+		updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated.Annotations[v1.NetworkAttachmentAnnot]).To(Equal(netMap.annotations[pod.UID]))
+		Expect(updated.Annotations[v1.NetworkAttachmentAnnot]).To(ContainSubstring(`"mellanox.infiniband.app":` +
+			`"configured"`))
+
+		interfaces, err := utils.ParseInterfacesStatus(utils.NewPodRef(updated))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interfaces).To(Equal(map[string]utils.InterfaceStatus{
+			"net1": {Network: "default_ib-net-1", GUID: "02:00:00:00:00:00:00:01", PKey: "0x5", State: "configured"},
+			"net2": {Network: "default_ib-net-2", GUID: "02:00:00:00:00:00:00:01", PKey: "0x6", State: "configured"},
+		}))
+	})
+	It("Keep the status of interfaces configured by previous updates", func() {
+		updates := newPodAnnotationUpdates()
+		updates.add(newPodNetworkInfo("default_ib-net-1"), "default_ib-net-1", pKeySpec("0x5"), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+
+		updates = newPodAnnotationUpdates()
+		pi := newPodNetworkInfo("default_ib-net-2")
+		pi.addr = net.HardwareAddr{0x02, 0, 0, 0, 0, 0, 0, 0x02}
+		updates.add(pi, "default_ib-net-2", pKeySpec(""), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+		Expect(patchCount()).To(Equal(2))
+
+		updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		interfaces, err := utils.ParseInterfacesStatus(utils.NewPodRef(updated))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interfaces).To(HaveKeyWithValue("net1", utils.InterfaceStatus{Network: "default_ib-net-1",
+			GUID: "02:00:00:00:00:00:00:01", PKey: "0x5", State: "configured"}))
+		Expect(interfaces).To(HaveKeyWithValue("net2", utils.InterfaceStatus{Network: "default_ib-net-2",
+			GUID: "02:00:00:00:00:00:00:02", State: "configured"}))
+	})
+	It("Write the infiniband metadata of the configured interfaces", func() {
+		d.config = config.DaemonConfig{PodMetadata: true, FabricName: "fabric-a", DefaultLimitedPartition: "0x7FFF"}
+		updates := newPodAnnotationUpdates()
+		updates.add(newPodNetworkInfo("default_ib-net-1"), "default_ib-net-1", pKeySpec("0x5"), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+
+		updates = newPodAnnotationUpdates()
+		pi := newPodNetworkInfo("default_ib-net-2")
+		pi.addr = net.HardwareAddr{0x02, 0, 0, 0, 0, 0, 0, 0x02}
+		updates.add(pi, "default_ib-net-2", pKeySpec("0x7FFF"), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+
+		updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		metadata, err := utils.ParseInfiniBandMetadata(utils.NewPodRef(updated))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metadata).To(Equal(&utils.InfiniBandMetadata{Version: "v1", Fabric: "fabric-a",
+			Interfaces: map[string]utils.InterfaceMetadata{
+				"net1": {Network: "default_ib-net-1", GUID: "02:00:00:00:00:00:00:01", PKey: "0x5", Membership: "full",
+					LimitedPKey: "0x7FFF"},
+				"net2": {Network: "default_ib-net-2", GUID: "02:00:00:00:00:00:00:02", PKey: "0x7FFF",
+					Membership: "full"},
+			}}))
+	})
+	It("Don't write the infiniband metadata unless enabled", func() {
+		updates := newPodAnnotationUpdates()
+		updates.add(newPodNetworkInfo("default_ib-net-1"), "default_ib-net-1", pKeySpec("0x5"), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+
+		updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated.Annotations).ToNot(HaveKey(utils.InfiniBandMetadataAnnotation))
+	})
+	It("Apply all the ib-kubernetes annotations on each write", func() {
+		writer := &applyWriter{annotations: make(map[string]string)}
+		d.annotationWriter = writer
+		d.config = config.DaemonConfig{PodMetadata: true}
+		pi := newPodNetworkInfo("default_ib-net-1")
+		pi.ibNetwork.InfinibandGUIDRequest = "02:00:00:00:00:00:00:01"
+		updates := newPodAnnotationUpdates()
+		updates.add(pi, "default_ib-net-1", pKeySpec("0x5"), true)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+		Expect(writer.annotations).To(HaveKeyWithValue(utils.ConfiguredNetworksAnnotation, "default_ib-net-1"))
+
+		// the second write changes the network annotation, the interfaces status and the metadata only
+		pi = newPodNetworkInfo("default_ib-net-2")
+		pi.addr = net.HardwareAddr{0x02, 0, 0, 0, 0, 0, 0, 0x02}
+		updates = newPodAnnotationUpdates()
+		updates.add(pi, "default_ib-net-2", pKeySpec("0x6"), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+		Expect(writer.annotations).To(HaveKeyWithValue(utils.ConfiguredNetworksAnnotation, "default_ib-net-1"))
+		Expect(writer.annotations).To(HaveKey(v1.NetworkAttachmentAnnot))
+
+		interfaces, err := utils.ParseInterfacesStatus(&utils.PodRef{Annotations: writer.annotations})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interfaces).To(HaveKey("net1"))
+		Expect(interfaces).To(HaveKey("net2"))
+		metadata, err := utils.ParseInfiniBandMetadata(&utils.PodRef{Annotations: writer.annotations})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metadata.Interfaces).To(HaveKey("net1"))
+		Expect(metadata.Interfaces).To(HaveKey("net2"))
+	})
+	It("Skip writing an unchanged annotation", func() {
+		updates := newPodAnnotationUpdates()
+		updates.add(newPodNetworkInfo("default_ib-net-1"), "default_ib-net-1", pKeySpec("0x5"), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+		Expect(patchCount()).To(Equal(1))
+
+		updates = newPodAnnotationUpdates()
+		updates.add(newPodNetworkInfo("default_ib-net-1"), "default_ib-net-1", pKeySpec("0x5"), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+		Expect(patchCount()).To(Equal(1))
+	})
+	It("Mark networks which guid is delivered as runtime config only in the pod annotation", func() {
+		pi := newPodNetworkInfo("default_ib-net-1")
+		pi.ibNetwork.InfinibandGUIDRequest = "02:00:00:00:00:00:00:01"
+		updates := newPodAnnotationUpdates()
+		updates.add(pi, "default_ib-net-1", pKeySpec("0x5"), true)
+
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+		Expect(patchCount()).To(Equal(1))
+
+		updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod",
+			metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updated.Annotations[v1.NetworkAttachmentAnnot]).ToNot(ContainSubstring("cni-args"))
+		Expect(updated.Annotations[utils.ConfiguredNetworksAnnotation]).To(Equal("default_ib-net-1"))
+
+		networks, err := utils.ParsePodNetworks(utils.NewPodRef(updated))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(utils.IsPodNetworkConfiguredWithInfiniBand(utils.NewPodRef(updated), networks[0])).To(BeTrue())
+		Expect(utils.IsPodNetworkConfiguredWithInfiniBand(utils.NewPodRef(updated), networks[1])).To(BeFalse())
+	})
+	It("Deliver the pkey in the cni-args of networks with the infinibandPKey capability", func() {
+		enabled := true
+		spec := pKeySpec("0x5")
+		spec.Capabilities.InfiniBandPKey = &enabled
+		updates := newPodAnnotationUpdates()
+		updates.add(newPodNetworkInfo("default_ib-net-1"), "default_ib-net-1", spec, false)
+		updates.add(newPodNetworkInfo("default_ib-net-2"), "default_ib-net-2", pKeySpec("0x6"), false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+
+		updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		networks, err := utils.ParsePodNetworks(utils.NewPodRef(updated))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*networks[0].CNIArgs).To(HaveKeyWithValue(utils.PKeyCNIArg, "0x5"))
+		Expect(*networks[1].CNIArgs).ToNot(HaveKey(utils.PKeyCNIArg))
+	})
+	It("Record the rdma isolation of networks with the rdmaIsolation capability in the infiniband metadata", func() {
+		d.config = config.DaemonConfig{PodMetadata: true}
+		enabled := true
+		spec := pKeySpec("0x5")
+		spec.Capabilities.RDMAIsolation = &enabled
+		updates := newPodAnnotationUpdates()
+		updates.add(newPodNetworkInfo("default_ib-net-1"), "default_ib-net-1", spec, false)
+		Expect(d.writePodAnnotations(context.Background(), updates, netMap)).To(Succeed())
+
+		updated, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		metadata, err := utils.ParseInfiniBandMetadata(utils.NewPodRef(updated))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metadata.Interfaces["net1"].RDMAIsolation).To(BeTrue())
+	})
+	It("Resolve the guid injection mode of a network", func() {
+		enabled, disabled := true, false
+		spec := &utils.IbSriovCniSpec{}
+		Expect(d.guidAsRuntimeConfig(spec)).To(BeFalse())
+		Expect(d.runtimeConfigOnly(spec)).To(BeFalse())
+
+		d.config = config.DaemonConfig{GUIDInjectionMode: utils.GUIDInjectionRuntimeConfig}
+		Expect(d.guidAsRuntimeConfig(spec)).To(BeTrue())
+		Expect(d.runtimeConfigOnly(spec)).To(BeTrue())
+
+		spec.Capabilities.InfiniBandGUID = &disabled
+		Expect(d.guidAsRuntimeConfig(spec)).To(BeFalse())
+		Expect(d.runtimeConfigOnly(spec)).To(BeFalse())
+
+		d.config = config.DaemonConfig{GUIDInjectionMode: utils.GUIDInjectionCNIArgs}
+		spec.Capabilities.InfiniBandGUID = &enabled
+		Expect(d.guidAsRuntimeConfig(spec)).To(BeTrue())
+		Expect(d.runtimeConfigOnly(spec)).To(BeFalse())
+	})
+})
@@ -0,0 +1,95 @@
+package daemon
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+)
+
+const (
+	backlogAdd    = "add"
+	backlogDelete = "delete"
+)
+
+// backlogItem identifies a pod network pending addition or deletion
+type backlogItem struct {
+	kind         string
+	podNetworkID ibTypes.PodNetworkID
+}
+
+// networkBacklog is the number of pods of a network pending addition or deletion and the time the oldest was
+// first held
+type networkBacklog struct {
+	pods   int
+	oldest time.Time
+}
+
+// setBacklog records the pod network as pending addition or deletion since it was first held or failed, it's
+// called with poolMutex held
+func (d *daemon) setBacklog(kind string, podNetworkID ibTypes.PodNetworkID, now time.Time) {
+	if d.backlogSince == nil {
+		d.backlogSince = make(map[backlogItem]time.Time)
+	}
+	item := backlogItem{kind: kind, podNetworkID: podNetworkID}
+	if _, exist := d.backlogSince[item]; !exist {
+		d.backlogSince[item] = now
+	}
+}
+
+// clearBacklog drops the processed pod network from the backlog, it's called with poolMutex held
+func (d *daemon) clearBacklog(kind string, podNetworkID ibTypes.PodNetworkID) {
+	delete(d.backlogSince, backlogItem{kind: kind, podNetworkID: podNetworkID})
+}
+
+// reportPodBacklog reports the pods pending addition and deletion by network, and how long the oldest pending pod
+// of each network waits since it was first held or failed, so operators can alert when the reconciliation falls
+// behind. The pod networks held while the subnet manager is unavailable are pending as well, so the backlog is
+// reported while the subnet manager updates are deferred. It's called with poolMutex held.
+func (d *daemon) reportPodBacklog(now time.Time) {
+	backlogs := make(map[string]map[string]*networkBacklog)
+	for item, since := range d.backlogSince {
+		networkID := item.podNetworkID.NetworkID
+		if backlogs[networkID] == nil {
+			backlogs[networkID] = make(map[string]*networkBacklog)
+		}
+		backlog, exist := backlogs[networkID][item.kind]
+		if !exist {
+			backlog = &networkBacklog{oldest: since}
+			backlogs[networkID][item.kind] = backlog
+		}
+		backlog.pods++
+		if since.Before(backlog.oldest) {
+			backlog.oldest = since
+		}
+	}
+
+	metrics.PendingPods.Reset()
+	metrics.PendingPodsOldestAge.Reset()
+	networkIDs := make([]string, 0, len(backlogs))
+	for networkID := range backlogs {
+		networkIDs = append(networkIDs, networkID)
+	}
+	sort.Strings(networkIDs)
+	for _, networkID := range networkIDs {
+		var added, deleted networkBacklog
+		for kind, backlog := range backlogs[networkID] {
+			metrics.PendingPods.WithLabelValues(networkID, kind).Set(float64(backlog.pods))
+			metrics.PendingPodsOldestAge.WithLabelValues(networkID, kind).Set(now.Sub(backlog.oldest).Seconds())
+			if kind == backlogAdd {
+				added = *backlog
+			} else {
+				deleted = *backlog
+			}
+		}
+		oldest := added.oldest
+		if oldest.IsZero() || (!deleted.oldest.IsZero() && deleted.oldest.Before(oldest)) {
+			oldest = deleted.oldest
+		}
+		log.Info().Msgf("network %s backlog: %d pods pending addition, %d pods pending deletion, oldest pending "+
+			"for %s", networkID, added.pods, deleted.pods, now.Sub(oldest).Truncate(time.Second))
+	}
+}
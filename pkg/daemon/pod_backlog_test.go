@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+)
+
+var _ = Describe("Pod Backlog", func() {
+	const (
+		networkID      = "default_ib-net"
+		otherNetworkID = "default_other-net"
+	)
+
+	var (
+		d   *daemon
+		now time.Time
+	)
+
+	podNetwork := func(uid, networkID string) ibTypes.PodNetworkID {
+		return ibTypes.PodNetworkID{PodUID: types.UID(uid), NetworkID: networkID}
+	}
+
+	BeforeEach(func() {
+		d = &daemon{}
+		now = time.Now()
+	})
+
+	It("Report the pending pods and the age of the oldest pending pod by network", func() {
+		d.setBacklog(backlogAdd, podNetwork("pod-1", networkID), now)
+		d.setBacklog(backlogDelete, podNetwork("pod-2", otherNetworkID), now)
+		d.setBacklog(backlogDelete, podNetwork("pod-3", otherNetworkID), now)
+		d.setBacklog(backlogAdd, podNetwork("pod-4", networkID), now.Add(5*time.Second))
+		// the pod network is pending since it was first held
+		d.setBacklog(backlogAdd, podNetwork("pod-1", networkID), now.Add(5*time.Second))
+		d.reportPodBacklog(now.Add(10 * time.Second))
+
+		Expect(testutil.ToFloat64(metrics.PendingPods.WithLabelValues(networkID, backlogAdd))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(metrics.PendingPods.WithLabelValues(otherNetworkID, backlogDelete))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(metrics.PendingPodsOldestAge.WithLabelValues(networkID, backlogAdd))).
+			To(Equal(10.0))
+		Expect(testutil.ToFloat64(metrics.PendingPodsOldestAge.WithLabelValues(otherNetworkID, backlogDelete))).
+			To(Equal(10.0))
+	})
+	It("Clear the networks without pending pods", func() {
+		d.setBacklog(backlogAdd, podNetwork("pod-1", networkID), now)
+		d.reportPodBacklog(now)
+		Expect(testutil.CollectAndCount(metrics.PendingPods)).To(Equal(1))
+
+		d.clearBacklog(backlogAdd, podNetwork("pod-1", networkID))
+		d.reportPodBacklog(now.Add(10 * time.Second))
+		Expect(testutil.CollectAndCount(metrics.PendingPods)).To(BeZero())
+		Expect(d.backlogSince).To(BeEmpty())
+	})
+})
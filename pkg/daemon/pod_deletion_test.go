@@ -0,0 +1,96 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Deleted Pods PKey Removal Hold", func() {
+	const networkID = "default_ib-net"
+
+	newPod := func(uid string, deletionTimestamp *metav1.Time) *utils.PodRef {
+		return &utils.PodRef{
+			Name: "pod-" + uid, Namespace: "default", UID: types.UID(uid), DeletionTimestamp: deletionTimestamp}
+	}
+
+	newTestDaemon := func(delay int) *daemon {
+		return &daemon{
+			config:          config.DaemonConfig{PKeyRemovalDelay: delay},
+			deletedPodsSeen: make(map[ibTypes.PodNetworkID]time.Time),
+		}
+	}
+
+	It("Remove immediately without delay and with passed grace period", func() {
+		d := newTestDaemon(0)
+		past := metav1.NewTime(time.Now().Add(-time.Minute))
+		now := time.Now()
+
+		Expect(d.removalHeldFor(ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID}, newPod("uid-1", nil),
+			now)).To(BeNumerically("<=", 0))
+		Expect(d.removalHeldFor(ibTypes.PodNetworkID{PodUID: "uid-2", NetworkID: networkID},
+			newPod("uid-2", &past), now)).To(BeNumerically("<=", 0))
+	})
+
+	It("Hold pods until their deletion grace period ends", func() {
+		d := newTestDaemon(0)
+		now := time.Now()
+		future := metav1.NewTime(now.Add(time.Minute))
+
+		Expect(d.removalHeldFor(ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID},
+			newPod("uid-1", &future), now)).To(Equal(future.Sub(now)))
+	})
+
+	It("Hold pods for the configured delay since they were first seen", func() {
+		d := newTestDaemon(30)
+		podNetworkID := ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID}
+		pod := newPod("uid-1", nil)
+		now := time.Now()
+
+		Expect(d.removalHeldFor(podNetworkID, pod, now)).To(Equal(30 * time.Second))
+		Expect(d.deletedPodsSeen).To(HaveKeyWithValue(podNetworkID, now))
+		Expect(d.removalHeldFor(podNetworkID, pod, now.Add(10*time.Second))).To(Equal(20 * time.Second))
+
+		d.deletedPodsSeen[podNetworkID] = now.Add(-time.Minute)
+		Expect(d.removalHeldFor(podNetworkID, pod, now)).To(BeNumerically("<=", 0))
+	})
+
+	It("Hold flapping pods until they are stable", func() {
+		d := newTestDaemon(0)
+		d.config.PodFlapCooldown = 60
+		podNetworkID := ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID}
+		now := time.Now()
+		d.podFlaps = map[ibTypes.PodNetworkID]time.Time{podNetworkID: now.Add(-20 * time.Second)}
+
+		Expect(d.removalHeldFor(podNetworkID, newPod("uid-1", nil), now)).To(Equal(40 * time.Second))
+	})
+
+	It("Forget the deleted pods of networks which can't be resolved", func() {
+		d := newTestDaemon(30)
+		d.config.K8sGetBackoff = config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1}
+		d.kubeClient = k8sClientFake.NewClient()
+		d.nadSpecs = utils.NewSynchronizedMap()
+		pod := newPod("uid-1", nil)
+		now := time.Now()
+
+		_, held, err := d.deletePodNetwork(context.Background(), networkID, pod, []string{"02:00:00:00:00:00:00:01"},
+			now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(held).To(BeTrue())
+
+		_, held, err = d.deletePodNetwork(context.Background(), networkID, pod, []string{"02:00:00:00:00:00:00:01"},
+			now.Add(time.Minute))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(held).To(BeFalse())
+		Expect(d.deletedPodsSeen).To(BeEmpty())
+	})
+})
@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/types"
+
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+)
+
+// cancelPendingDeletes cancels the pending removals of the pod networks which guids are wanted again, removing
+// holds the networks of the pod which guids are still to be removed. A pod network wanted again while its removal
+// is pending keeps its GUIDs and pkey membership, so no subnet manager calls are made to remove and add it again,
+// and it is marked as flapping. It's called with poolMutex held.
+func (d *daemon) cancelPendingDeletes(name types.NamespacedName, uid types.UID, removing map[string]bool,
+	now time.Time) {
+	for podNetworkID := range d.deletedPodsSeen {
+		if podNetworkID.PodUID != uid || removing[podNetworkID.NetworkID] {
+			continue
+		}
+
+		log.Info().Msgf("pod namespace %s name %s was added again to network %s while its removal was pending, "+
+			"reusing its guid", name.Namespace, name.Name, podNetworkID.NetworkID)
+		delete(d.deletedPodsSeen, podNetworkID)
+		d.podFlaps[podNetworkID] = now
+	}
+}
+
+// flapHeldFor returns how long the subnet manager calls of the pod network are still held, as it flapped within
+// the configured cool-down. The calls of flapping pod networks are held until they are stable for the cool-down.
+func (d *daemon) flapHeldFor(podNetworkID ibTypes.PodNetworkID, now time.Time) time.Duration {
+	flapped, exist := d.podFlaps[podNetworkID]
+	if !exist {
+		return 0
+	}
+	if stableAt := flapped.Add(time.Duration(d.config.PodFlapCooldown) * time.Second); now.Before(stableAt) {
+		return stableAt.Sub(now)
+	}
+	delete(d.podFlaps, podNetworkID)
+	return 0
+}
@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Flapping Pods", func() {
+	const networkID = "default_ib-net"
+
+	newTestDaemon := func(cooldown int) *daemon {
+		return &daemon{
+			config:          config.DaemonConfig{PodFlapCooldown: cooldown},
+			deletedPodsSeen: make(map[ibTypes.PodNetworkID]time.Time),
+			podFlaps:        make(map[ibTypes.PodNetworkID]time.Time),
+		}
+	}
+
+	It("Cancel pending deletion of pod networks wanted again", func() {
+		d := newTestDaemon(30)
+		name := types.NamespacedName{Namespace: "default", Name: "pod-uid-1"}
+		flapping := ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID}
+		removed := ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: "default_other-net"}
+		otherPod := ibTypes.PodNetworkID{PodUID: "uid-2", NetworkID: networkID}
+		now := time.Now()
+		for _, podNetworkID := range []ibTypes.PodNetworkID{flapping, removed, otherPod} {
+			d.deletedPodsSeen[podNetworkID] = now.Add(-time.Second)
+		}
+
+		d.cancelPendingDeletes(name, "uid-1", map[string]bool{"default_other-net": true}, now)
+		Expect(d.deletedPodsSeen).ToNot(HaveKey(flapping))
+		Expect(d.deletedPodsSeen).To(HaveKey(removed))
+		Expect(d.deletedPodsSeen).To(HaveKey(otherPod))
+		Expect(d.podFlaps).To(Equal(map[ibTypes.PodNetworkID]time.Time{flapping: now}))
+	})
+
+	It("Hold flapping pods until the cool-down passes", func() {
+		d := newTestDaemon(30)
+		pod := &utils.PodRef{Name: "pod-uid-1", Namespace: "default", UID: "uid-1"}
+		flapping := ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID}
+		stable := ibTypes.PodNetworkID{PodUID: "uid-2", NetworkID: networkID}
+		now := time.Now()
+		d.podFlaps[flapping] = now
+
+		Expect(d.flapHeldFor(flapping, now)).To(Equal(30 * time.Second))
+		Expect(d.flapHeldFor(stable, now)).To(BeZero())
+		hold, held := d.addHeldFor(pod, flapping, now.Add(10*time.Second))
+		Expect(held).To(BeTrue())
+		Expect(hold).To(Equal(20 * time.Second))
+
+		d.podFlaps[flapping] = now.Add(-time.Minute)
+		Expect(d.flapHeldFor(flapping, now)).To(BeZero())
+		Expect(d.podFlaps).To(BeEmpty())
+	})
+
+	It("Don't hold flapping pods without cool-down", func() {
+		d := newTestDaemon(0)
+		flapping := ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID}
+		d.podFlaps[flapping] = time.Now()
+
+		Expect(d.flapHeldFor(flapping, time.Now())).To(BeZero())
+	})
+})
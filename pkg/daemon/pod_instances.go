@@ -0,0 +1,178 @@
+package daemon
+
+import (
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// podInstance is an instance of a pod name the daemon configured or allocated guids for. The pod reconciler reads
+// the pods from the manager cache, so the instances record what it needs once the pod is gone: the UID the guids
+// of the instance are allocated for, and the pod state its reschedules are detected from.
+type podInstance struct {
+	uid      types.UID
+	nodeName string
+	running  bool
+	// started is set if the pod had container statuses
+	started bool
+	// skipped holds the networks of a pod first seen running which weren't configured, they are left to the user
+	skipped map[utils.PodNetworkKey]bool
+	// configured holds the pod networks which annotation was written by the daemon, they aren't configured again
+	// while the cached pod doesn't have the written annotation yet
+	configured map[utils.PodNetworkKey]bool
+	// reconfigure is set when the networks of the pod are configured again with their guids, ignoring their
+	// InfiniBand markers, e.g. when the pod is rescheduled or its node is Ready again
+	reconfigure bool
+	// release is set when the guids of the pod are released while the pod exists, e.g. the pods of deleted nodes
+	release bool
+}
+
+// update records the state of the pod, and flags the pod to be configured again if it was moved from the node it
+// was bound to, or went back to "Pending" state with its containers statuses reset after it was running, e.g.
+// after a node failure
+func (i *podInstance) update(pod *kapi.Pod) {
+	started := len(pod.Status.ContainerStatuses) != 0
+	rescheduled := (i.nodeName != "" && i.nodeName != pod.Spec.NodeName) ||
+		(pod.Status.Phase == kapi.PodPending && (i.running || (i.started && !started)))
+	if rescheduled && !utils.PodIsRunning(pod) {
+		log.Info().Msgf("pod namespace %s name %s was rescheduled, configuring its networks again", pod.Namespace,
+			pod.Name)
+		i.startReconfigure()
+		i.skipped = nil
+	}
+	i.nodeName, i.running, i.started = pod.Spec.NodeName, utils.PodIsRunning(pod), started
+}
+
+// startReconfigure drops the networks configured by the daemon, so they are all configured again
+func (i *podInstance) startReconfigure() {
+	i.reconfigure = true
+	i.configured = nil
+}
+
+// podInstanceOf returns the recorded instance of the pod with the UID, nil if it isn't recorded. It's called with
+// poolMutex held.
+func (d *daemon) podInstanceOf(name types.NamespacedName, uid types.UID) *podInstance {
+	for _, instance := range d.podInstances[name] {
+		if instance.uid == uid {
+			return instance
+		}
+	}
+	return nil
+}
+
+// recordPodInstance records the instance of the pod if it isn't recorded yet, so the guids allocated for it are
+// released once it is deleted. The networks a pod first seen running has but which aren't configured are skipped,
+// as its containers already run without them. It's called with poolMutex held.
+func (d *daemon) recordPodInstance(pod *kapi.Pod) *podInstance {
+	name := types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+	if instance := d.podInstanceOf(name, pod.UID); instance != nil {
+		return instance
+	}
+
+	instance := &podInstance{uid: pod.UID, nodeName: pod.Spec.NodeName, running: utils.PodIsRunning(pod),
+		started: len(pod.Status.ContainerStatuses) != 0}
+	if instance.running {
+		podRef := utils.NewPodRef(pod)
+		if networks, err := d.podNetworks.ParsePodNetworks(podRef); err == nil {
+			utils.AssignInterfaceNames(networks)
+			for _, network := range networks {
+				if utils.IsPodNetworkConfiguredWithInfiniBand(podRef, network) {
+					continue
+				}
+				if instance.skipped == nil {
+					instance.skipped = make(map[utils.PodNetworkKey]bool)
+				}
+				instance.skipped[utils.GeneratePodNetworkKey(podRef, network)] = true
+			}
+		}
+	}
+	if d.podInstances == nil {
+		d.podInstances = make(map[types.NamespacedName][]*podInstance)
+	}
+	d.podInstances[name] = append(d.podInstances[name], instance)
+	return instance
+}
+
+// forgetPodInstance drops the instance of the deleted pod once its guids are released, with the pod networks
+// state kept for it. It's called with poolMutex held.
+func (d *daemon) forgetPodInstance(name types.NamespacedName, uid types.UID) {
+	instances := d.podInstances[name]
+	kept := instances[:0]
+	for _, instance := range instances {
+		if instance.uid != uid {
+			kept = append(kept, instance)
+		}
+	}
+	if len(kept) == 0 {
+		delete(d.podInstances, name)
+	} else {
+		d.podInstances[name] = kept
+	}
+
+	delete(d.annotationRetries, uid)
+	for podNetworkID := range d.deletedPodsSeen {
+		if podNetworkID.PodUID == uid {
+			delete(d.deletedPodsSeen, podNetworkID)
+		}
+	}
+	for podNetworkID := range d.podFlaps {
+		if podNetworkID.PodUID == uid {
+			delete(d.podFlaps, podNetworkID)
+		}
+	}
+	for item := range d.backlogSince {
+		if item.podNetworkID.PodUID == uid {
+			delete(d.backlogSince, item)
+		}
+	}
+}
+
+// podGUIDs returns the sorted guids allocated for the networks of the pod instance by pod network interface. It's
+// called with poolMutex held.
+func (d *daemon) podGUIDs(uid types.UID) map[utils.PodNetworkKey][]string {
+	guids := make(map[utils.PodNetworkKey][]string)
+	for allocatedGUID, key := range d.guidPodNetworkMap {
+		if key.PodUID == uid {
+			guids[key] = append(guids[key], allocatedGUID)
+		}
+	}
+	for _, keyGUIDs := range guids {
+		sort.Strings(keyGUIDs)
+	}
+	return guids
+}
+
+// replacedPodUID returns the UID of the deleted pod instance owning a guid requested by the pod on the network,
+// while the guid is pending removal from the network. A pod requesting such guid, e.g. a pod recreated with the
+// same name and network annotation, is held until the guid of the deleted instance is released, so the deletion
+// is always processed before the addition.
+func (d *daemon) replacedPodUID(pod *utils.PodRef, networkID string) (types.UID, bool) {
+	networks, err := d.podNetworks.ParsePodNetworks(pod)
+	if err != nil {
+		return "", false
+	}
+
+	for _, network := range networks {
+		if ibTypes.NetworkIDOf(network).String() != networkID || !utils.PodNetworkHasGUID(network) {
+			continue
+		}
+		requestedGUID, err := utils.GetPodNetworkGUID(network)
+		if err != nil {
+			continue
+		}
+		owner, allocated := d.guidPodNetworkMap[requestedGUID]
+		if !allocated || owner.PodUID == pod.UID {
+			continue
+		}
+		if _, pending := d.deletedPodsSeen[ibTypes.PodNetworkID{PodUID: owner.PodUID,
+			NetworkID: networkID}]; pending {
+			return owner.PodUID, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,105 @@
+package daemon
+
+import (
+	"time"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Recreated Pods", func() {
+	const (
+		networkID = "default_ib-net"
+		podGUID   = "02:00:00:00:00:00:00:01"
+	)
+
+	newPod := func(uid string) *utils.PodRef {
+		return &utils.PodRef{Name: "pod", Namespace: "default", UID: types.UID(uid),
+			Annotations: map[string]string{v1.NetworkAttachmentAnnot: `[{"name": "ib-net", "namespace": "default", ` +
+				`"cni-args": {"guid": "` + podGUID + `"}}]`}}
+	}
+
+	var d *daemon
+
+	BeforeEach(func() {
+		d = &daemon{podNetworks: utils.NewPodNetworksCache(),
+			guidPodNetworkMap: map[string]utils.PodNetworkKey{podGUID: {PodUID: "old-uid", NetworkID: networkID}},
+			deletedPodsSeen:   make(map[ibTypes.PodNetworkID]time.Time)}
+	})
+
+	It("Hold pod requesting the guid of a deleted pod instance pending removal", func() {
+		newPodInstance, otherPod := newPod("new-uid"), newPod("other-uid")
+		otherPod.Annotations[v1.NetworkAttachmentAnnot] = `[{"name": "ib-net", "namespace": "default"}]`
+		d.deletedPodsSeen[ibTypes.PodNetworkID{PodUID: "old-uid", NetworkID: networkID}] = time.Now()
+
+		ownerUID, replacing := d.replacedPodUID(newPodInstance, networkID)
+		Expect(replacing).To(BeTrue())
+		Expect(ownerUID).To(Equal(types.UID("old-uid")))
+		_, replacing = d.replacedPodUID(otherPod, networkID)
+		Expect(replacing).To(BeFalse())
+
+		delete(d.deletedPodsSeen, ibTypes.PodNetworkID{PodUID: "old-uid", NetworkID: networkID})
+		_, replacing = d.replacedPodUID(newPodInstance, networkID)
+		Expect(replacing).To(BeFalse())
+	})
+	It("Release only the guids allocated to the pod instance", func() {
+		Expect(d.podGUIDs("old-uid")).To(Equal(map[utils.PodNetworkKey][]string{
+			{PodUID: "old-uid", NetworkID: networkID}: {podGUID}}))
+		d.guidPodNetworkMap[podGUID] = utils.PodNetworkKey{PodUID: "new-uid", NetworkID: networkID}
+		Expect(d.podGUIDs("old-uid")).To(BeEmpty())
+	})
+	It("Configure the networks of a rescheduled pod again", func() {
+		pod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid"},
+			Spec: kapi.PodSpec{NodeName: "node1"}, Status: kapi.PodStatus{Phase: kapi.PodRunning,
+				ContainerStatuses: []kapi.ContainerStatus{{Name: "test"}}}}
+		key := utils.PodNetworkKey{PodUID: "uid", NetworkID: networkID}
+		instance := &podInstance{uid: "uid", nodeName: "node1", running: true, started: true,
+			configured: map[utils.PodNetworkKey]bool{key: true}}
+
+		instance.update(pod)
+		Expect(instance.reconfigure).To(BeFalse())
+		Expect(instance.configured).To(HaveKey(key))
+
+		pod.Status = kapi.PodStatus{Phase: kapi.PodPending}
+		instance.update(pod)
+		Expect(instance.reconfigure).To(BeTrue())
+		Expect(instance.configured).To(BeEmpty())
+		Expect(instance.running).To(BeFalse())
+
+		instance.reconfigure = false
+		pod.Spec.NodeName = "node2"
+		instance.update(pod)
+		Expect(instance.reconfigure).To(BeTrue())
+		Expect(instance.nodeName).To(Equal("node2"))
+	})
+	It("Don't configure again a pod scheduled or started on the same node", func() {
+		pod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid"},
+			Status: kapi.PodStatus{Phase: kapi.PodPending}}
+		instance := &podInstance{uid: "uid"}
+
+		pod.Spec.NodeName = "node1"
+		instance.update(pod)
+		pod.Status.Phase = kapi.PodRunning
+		instance.update(pod)
+		Expect(instance.reconfigure).To(BeFalse())
+	})
+	It("Skip the networks a pod first seen running has without InfiniBand", func() {
+		pod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid",
+			Annotations: map[string]string{v1.NetworkAttachmentAnnot: `[{"name": "ib-net", "namespace": "default"}]`}},
+			Status: kapi.PodStatus{Phase: kapi.PodRunning}}
+
+		instance := d.recordPodInstance(pod)
+		Expect(instance.skipped).To(HaveLen(1))
+		Expect(d.recordPodInstance(pod)).To(BeIdenticalTo(instance))
+
+		d.forgetPodInstance(types.NamespacedName{Namespace: "default", Name: "pod"}, "uid")
+		Expect(d.podInstances).To(BeEmpty())
+	})
+})
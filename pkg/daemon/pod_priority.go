@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"container/heap"
+	"context"
+
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// podPriority returns the priority of the pod resolved from its priority class, 0 if not set
+func podPriority(pod *utils.PodRef) int32 {
+	if pod.Priority == nil {
+		return 0
+	}
+	return *pod.Priority
+}
+
+// podBefore returns true if the pod is processed before the other pod, higher priority pods first and pods of
+// the same priority by creation time
+func podBefore(pod, other *utils.PodRef) bool {
+	if podPriority(pod) != podPriority(other) {
+		return podPriority(pod) > podPriority(other)
+	}
+	return pod.CreationTimestamp.Before(&other.CreationTimestamp)
+}
+
+// queuedPod is a pod request in the pod workqueue with the pod it was queued for, nil if the pod was deleted
+type queuedPod struct {
+	request reconcile.Request
+	pod     *utils.PodRef
+	// seq orders the pods queued with the same priority and creation time
+	seq uint64
+}
+
+// podQueue orders the pod requests of the pod controller workqueue, so when the subnet manager is rate limited or
+// the guid pool is nearly exhausted, high priority workloads get their guids before best-effort ones. The deleted
+// pods are processed first, so their guids are released before new pods take guids from the pool. The pods are
+// read from the manager cache when they are queued. The workqueue calls it with its lock held.
+type podQueue struct {
+	reader client.Reader
+	pods   []*queuedPod
+	seq    uint64
+}
+
+// newPodWorkqueue returns the constructor of the rate limited pod workqueue ordered by podQueue, pods are read
+// from the reader when they are queued
+func newPodWorkqueue(reader client.Reader) func(string,
+	workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+	return func(name string, rateLimiter workqueue.TypedRateLimiter[reconcile.Request],
+	) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+		queue := workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[reconcile.Request]{Name: name,
+			Queue: &podQueue{reader: reader}})
+		delayingQueue := workqueue.NewTypedDelayingQueueWithConfig(
+			workqueue.TypedDelayingQueueConfig[reconcile.Request]{Name: name, Queue: queue})
+		return workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter,
+			workqueue.TypedRateLimitingQueueConfig[reconcile.Request]{Name: name, DelayingQueue: delayingQueue})
+	}
+}
+
+// Touch keeps the order of a request queued again, it is ordered by the pod it was first queued for
+func (q *podQueue) Touch(reconcile.Request) {}
+
+// Push queues the request ordered by its pod
+func (q *podQueue) Push(request reconcile.Request) {
+	queued := &queuedPod{request: request, seq: q.seq}
+	q.seq++
+	pod := &kapi.Pod{}
+	if err := q.reader.Get(context.Background(), request.NamespacedName, pod); err == nil {
+		queued.pod = utils.NewPodRef(pod)
+	}
+	heap.Push((*podHeap)(q), queued)
+}
+
+// Len returns the number of queued requests
+func (q *podQueue) Len() int {
+	return len(q.pods)
+}
+
+// Pop returns the request of the next pod to process
+func (q *podQueue) Pop() reconcile.Request {
+	return heap.Pop((*podHeap)(q)).(*queuedPod).request
+}
+
+// podHeap implements heap.Interface on the queued pods
+type podHeap podQueue
+
+func (h *podHeap) Len() int {
+	return len(h.pods)
+}
+
+func (h *podHeap) Less(i, j int) bool {
+	pod, other := h.pods[i], h.pods[j]
+	switch {
+	case (pod.pod == nil) != (other.pod == nil):
+		return pod.pod == nil
+	case pod.pod != nil && podBefore(pod.pod, other.pod):
+		return true
+	case pod.pod != nil && podBefore(other.pod, pod.pod):
+		return false
+	}
+	return pod.seq < other.seq
+}
+
+func (h *podHeap) Swap(i, j int) {
+	h.pods[i], h.pods[j] = h.pods[j], h.pods[i]
+}
+
+func (h *podHeap) Push(x interface{}) {
+	h.pods = append(h.pods, x.(*queuedPod))
+}
+
+func (h *podHeap) Pop() interface{} {
+	last := h.pods[len(h.pods)-1]
+	h.pods[len(h.pods)-1] = nil
+	h.pods = h.pods[:len(h.pods)-1]
+	return last
+}
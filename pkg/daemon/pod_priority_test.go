@@ -0,0 +1,74 @@
+package daemon
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Pod Priority", func() {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newPod := func(name string, priority *int32, age time.Duration) *kapi.Pod {
+		return &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default",
+			CreationTimestamp: metav1.NewTime(created.Add(-age))}, Spec: kapi.PodSpec{Priority: priority}}
+	}
+	priority := func(value int32) *int32 {
+		return &value
+	}
+	request := func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+	}
+	newReader := func(pods ...client.Object) client.Reader {
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		return ctrlFake.NewClientBuilder().WithScheme(scheme).WithObjects(pods...).Build()
+	}
+
+	It("Queue deleted pods first then pods by priority then creation time", func() {
+		queue := &podQueue{reader: newReader(newPod("best-effort", nil, time.Hour),
+			newPod("new-critical", priority(1000), time.Minute), newPod("old-critical", priority(1000), time.Hour),
+			newPod("low", priority(-10), 2*time.Hour))}
+		for _, name := range []string{"best-effort", "new-critical", "deleted", "old-critical", "low"} {
+			queue.Push(request(name))
+		}
+
+		var names []string
+		for queue.Len() != 0 {
+			names = append(names, queue.Pop().Name)
+		}
+		Expect(names).To(Equal([]string{"deleted", "old-critical", "new-critical", "best-effort", "low"}))
+	})
+	It("Queue pods of the same priority and creation time in order", func() {
+		queue := &podQueue{reader: newReader(newPod("a", nil, time.Hour), newPod("b", nil, time.Hour))}
+		queue.Push(request("b"))
+		queue.Push(request("a"))
+		Expect(queue.Pop().Name).To(Equal("b"))
+		Expect(queue.Pop().Name).To(Equal("a"))
+	})
+	It("Get the pods of the controller workqueue by priority", func() {
+		newQueue := newPodWorkqueue(newReader(newPod("best-effort", nil, time.Hour),
+			newPod("critical", priority(1000), time.Minute)))
+		queue := newQueue("pod", workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+		defer queue.ShutDown()
+
+		queue.Add(request("best-effort"))
+		queue.Add(request("critical"))
+		queue.Add(request("best-effort"))
+		Expect(queue.Len()).To(Equal(2))
+		item, _ := queue.Get()
+		Expect(item.Name).To(Equal("critical"))
+		queue.Done(item)
+		item, _ = queue.Get()
+		Expect(item.Name).To(Equal("best-effort"))
+		queue.Done(item)
+	})
+})
@@ -0,0 +1,389 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/tracing"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// podReconciler configures the networks of the pods, and removes from their pkeys and releases the guids of the
+// deleted pods and of the networks removed from the pods. The pods are read from the manager cache, the state the
+// daemon keeps for them is recorded in their pod instances.
+type podReconciler struct {
+	reader client.Reader
+	d      *daemon
+}
+
+// Reconcile reconciles the networks of the pod once the guid pool is initialized. Failures are requeued by the
+// controller rate limited workqueue, pod networks which are held are requeued once their hold ends.
+func (r *podReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	if r.d.ready != nil {
+		select {
+		case <-r.d.ready:
+		case <-ctx.Done():
+			return reconcile.Result{}, ctx.Err()
+		}
+	}
+
+	pod := &kapi.Pod{}
+	if err := r.reader.Get(ctx, req.NamespacedName, pod); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		pod = nil
+	}
+	return r.d.reconcilePod(ctx, req.NamespacedName, pod)
+}
+
+// podResult collects the outcome of the reconciled pod networks, the pod is requeued after the shortest hold, or
+// rate limited if any pod network failed
+type podResult struct {
+	requeueAfter time.Duration
+	errs         []error
+}
+
+// hold requeues the pod after the duration, unless it's requeued sooner
+func (r *podResult) hold(after time.Duration) {
+	if r.requeueAfter == 0 || after < r.requeueAfter {
+		r.requeueAfter = after
+	}
+}
+
+// fail requeues the pod rate limited with the error
+func (r *podResult) fail(err error) {
+	r.errs = append(r.errs, err)
+}
+
+// get returns the result and error of the reconcile
+func (r *podResult) get() (reconcile.Result, error) {
+	if err := errors.Join(r.errs...); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: r.requeueAfter}, nil
+}
+
+// heldRequeue returns when a held pod network is reconciled again, once its hold ends but not sooner than the loop
+// interval, with the loop jitter
+func (d *daemon) heldRequeue(loop config.PeriodicLoopConfig, hold time.Duration) time.Duration {
+	period, jitter := d.config.LoopPeriod(loop)
+	if hold > period {
+		period = hold
+	}
+	if jitter > 0 {
+		return wait.Jitter(period, jitter)
+	}
+	return period
+}
+
+// reconcilePod reconciles the pod networks with the guids allocated to the pod instances, pod is nil if it was
+// deleted. The guids of the deleted instances of the pod, of the pods released while they exist and of the
+// networks removed from the pod are removed from their pkeys and released, then the networks of the pod which
+// aren't configured yet are configured.
+func (d *daemon) reconcilePod(ctx context.Context, name types.NamespacedName, pod *kapi.Pod) (reconcile.Result,
+	error) {
+	ctx, span := tracing.Start(ctx, "reconcilePod",
+		attribute.String("pod.namespace", name.Namespace), attribute.String("pod.name", name.Name))
+	defer span.End()
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	defer d.updatePoolMetrics()
+	defer d.saveStableGUIDs()
+
+	result := &podResult{}
+	var live *podInstance
+	for _, instance := range slices.Clone(d.podInstances[name]) {
+		deleted := pod == nil || pod.UID != instance.uid
+		if !deleted && !instance.release {
+			live = instance
+			continue
+		}
+		if d.releasePodNetworks(ctx, name, instance, pod, nil, result) && deleted {
+			d.forgetPodInstance(name, instance.uid)
+		}
+	}
+
+	if pod == nil || !utils.PodWantsNetwork(pod) || !utils.PodIsManaged(pod) {
+		return result.get()
+	}
+	// the instance of a pod which network annotation is removed is reconciled, so the guids of its networks are
+	// released
+	if live == nil && utils.HasNetworkAttachmentAnnot(pod) && d.podInstanceOf(name, pod.UID) == nil {
+		live = d.recordPodInstance(pod)
+	}
+	if live != nil {
+		live.update(pod)
+		d.reconcilePodNetworks(ctx, name, live, pod, result)
+	}
+	return result.get()
+}
+
+// reconcilePodNetworks releases the guids of the networks removed from the live pod, then configures its networks
+// once it is scheduled. The guids of a pod which annotation can't be parsed are kept.
+func (d *daemon) reconcilePodNetworks(ctx context.Context, name types.NamespacedName, instance *podInstance,
+	pod *kapi.Pod, result *podResult) {
+	podRef := utils.NewPodRef(pod)
+	var networks []*v1.NetworkSelectionElement
+	if utils.HasNetworkAttachmentAnnot(pod) {
+		var err error
+		if networks, err = d.podNetworks.ParsePodNetworks(podRef); err != nil {
+			log.Error().Msgf("failed to parse network annotations of pod namespace %s name %s: %v", pod.Namespace,
+				pod.Name, err)
+			d.summary.failure()
+			return
+		}
+		utils.AssignInterfaceNames(networks)
+	}
+
+	wanted := make(map[utils.PodNetworkKey]bool, len(networks))
+	for _, network := range networks {
+		wanted[utils.GeneratePodNetworkKey(podRef, network)] = true
+	}
+	d.releasePodNetworks(ctx, name, instance, pod, wanted, result)
+	for key := range instance.configured {
+		if !wanted[key] {
+			delete(instance.configured, key)
+		}
+	}
+
+	if len(networks) != 0 && utils.PodScheduled(pod) && pod.DeletionTimestamp == nil {
+		d.configurePodNetworks(ctx, instance, podRef, networks, result)
+	}
+}
+
+// releasePodNetworks removes from their pkeys and releases the guids of the pod instance networks which aren't
+// wanted, all its guids if wanted is nil. It returns true if no removal of the instance is pending.
+func (d *daemon) releasePodNetworks(ctx context.Context, name types.NamespacedName, instance *podInstance,
+	pod *kapi.Pod, wanted map[utils.PodNetworkKey]bool, result *podResult) bool {
+	networkGUIDs := make(map[string][]string)
+	for key, guids := range d.podGUIDs(instance.uid) {
+		if !wanted[key] {
+			networkGUIDs[key.NetworkID] = append(networkGUIDs[key.NetworkID], guids...)
+		}
+	}
+
+	now := time.Now()
+	networkIDs := make([]string, 0, len(networkGUIDs))
+	removing := make(map[string]bool, len(networkGUIDs))
+	for networkID := range networkGUIDs {
+		networkIDs = append(networkIDs, networkID)
+		removing[networkID] = true
+	}
+	sort.Strings(networkIDs)
+	if wanted != nil {
+		d.cancelPendingDeletes(name, instance.uid, removing, now)
+	}
+
+	podRef := &utils.PodRef{Namespace: name.Namespace, Name: name.Name, UID: instance.uid}
+	if pod != nil && pod.UID == instance.uid {
+		podRef.DeletionTimestamp = pod.DeletionTimestamp
+	}
+	done := true
+	for _, networkID := range networkIDs {
+		podNetworkID := ibTypes.PodNetworkID{PodUID: instance.uid, NetworkID: networkID}
+		guids := networkGUIDs[networkID]
+		sort.Strings(guids)
+		hold, held, err := d.deletePodNetwork(ctx, networkID, podRef, guids, now)
+		switch {
+		case err != nil:
+			log.Warn().Msgf("%v", err)
+			result.fail(err)
+		case held:
+			result.hold(d.heldRequeue(d.config.DeleteLoop, hold))
+		default:
+			d.clearBacklog(backlogDelete, podNetworkID)
+			continue
+		}
+		d.setBacklog(backlogDelete, podNetworkID, now)
+		done = false
+	}
+	return done
+}
+
+// configurePodNetworks configures the networks of the pod which aren't configured yet, all its networks with their
+// guids if the pod is configured again. The networks a pod first seen running didn't have configured are skipped.
+func (d *daemon) configurePodNetworks(ctx context.Context, instance *podInstance, pod *utils.PodRef,
+	networks []*v1.NetworkSelectionElement, result *podResult) {
+	if instance.reconfigure {
+		// the guids of the pod networks are kept, so they are allocated again and added to the pkeys
+		removeInfiniBandMarkers(networks)
+		// networks which guid is delivered as runtime config only are marked in the pod annotation
+		delete(pod.Annotations, utils.ConfiguredNetworksAnnotation)
+	}
+
+	var networkIDs []string
+	pending := make(map[string]bool)
+	for _, network := range networks {
+		key := utils.GeneratePodNetworkKey(pod, network)
+		if instance.skipped[key] || instance.configured[key] || pending[key.NetworkID] ||
+			utils.IsPodNetworkConfiguredWithInfiniBand(pod, network) {
+			continue
+		}
+		pending[key.NetworkID] = true
+		networkIDs = append(networkIDs, key.NetworkID)
+	}
+	if len(networkIDs) == 0 {
+		instance.reconfigure = false
+		return
+	}
+
+	policies, err := d.getPartitionPolicies()
+	if err != nil {
+		result.fail(fmt.Errorf("deferring pod namespace %s name %s: %v", pod.Namespace, pod.Name, err))
+		return
+	}
+	// the pod networks are configured from the parsed networks, the annotation is written once with all of them
+	netMap := networksMap{theMap: map[types.UID][]*v1.NetworkSelectionElement{pod.UID: networks},
+		annotations: map[types.UID]string{pod.UID: pod.Annotations[v1.NetworkAttachmentAnnot]}, cache: d.podNetworks}
+	updates := newPodAnnotationUpdates()
+	now := time.Now()
+	added := make(map[string]bool, len(networkIDs))
+	for _, networkID := range networkIDs {
+		podNetworkID := ibTypes.PodNetworkID{PodUID: pod.UID, NetworkID: networkID}
+		hold, held := d.addHeldFor(pod, podNetworkID, now)
+		if !held {
+			if held, err = d.addPodNetwork(ctx, networkID, pod, netMap, policies, updates); err != nil {
+				result.fail(err)
+				d.setBacklog(backlogAdd, podNetworkID, now)
+				continue
+			}
+		}
+		if held {
+			result.hold(d.heldRequeue(d.config.AddLoop, hold))
+			d.setBacklog(backlogAdd, podNetworkID, now)
+			continue
+		}
+		added[networkID] = true
+	}
+
+	if err = d.writePodAnnotations(ctx, updates, netMap); err != nil {
+		result.fail(err)
+		for networkID := range added {
+			d.setBacklog(backlogAdd, ibTypes.PodNetworkID{PodUID: pod.UID, NetworkID: networkID}, now)
+		}
+		return
+	}
+	for _, network := range networks {
+		key := utils.GeneratePodNetworkKey(pod, network)
+		if !added[key.NetworkID] {
+			continue
+		}
+		d.clearBacklog(backlogAdd, ibTypes.PodNetworkID{PodUID: pod.UID, NetworkID: key.NetworkID})
+		if instance.configured == nil {
+			instance.configured = make(map[utils.PodNetworkKey]bool)
+		}
+		instance.configured[key] = true
+	}
+	if len(added) == len(networkIDs) {
+		instance.reconfigure = false
+	}
+}
+
+// addHeldFor returns how long the configuration of the pod network is held and whether it is held: while the
+// subnet manager is unavailable, while the pod network flaps, and while a guid requested by the pod is allocated
+// to a deleted pod pending removal from the network
+func (d *daemon) addHeldFor(pod *utils.PodRef, podNetworkID ibTypes.PodNetworkID, now time.Time) (time.Duration,
+	bool) {
+	if d.smUnavailable {
+		log.Debug().Msgf("holding pod namespace %s name %s, subnet manager updates are deferred", pod.Namespace,
+			pod.Name)
+		return 0, true
+	}
+	if hold := d.flapHeldFor(podNetworkID, now); hold > 0 {
+		log.Debug().Msgf("holding flapping pod namespace %s name %s of network %s for %v", pod.Namespace, pod.Name,
+			podNetworkID.NetworkID, hold)
+		return hold, true
+	}
+	if ownerUID, replacing := d.replacedPodUID(pod, podNetworkID.NetworkID); replacing {
+		log.Info().Msgf("holding pod namespace %s name %s until the guid of deleted pod %s is released "+
+			"from network %s", pod.Namespace, pod.Name, ownerUID, podNetworkID.NetworkID)
+		return 0, true
+	}
+	return 0, false
+}
+
+// removalHeldFor returns how long the pkey removal of the deleted pod network is still held. A pod network is held
+// for the configured removal delay since it was first seen deleted. The pods which guids are released while their
+// object still exists, e.g. the pods of deleted nodes, are also held until their deletion grace period ends so
+// in-flight traffic of terminating pods isn't broken. Flapping pod networks are held until they are stable for
+// the configured cool-down.
+func (d *daemon) removalHeldFor(podNetworkID ibTypes.PodNetworkID, pod *utils.PodRef, now time.Time) time.Duration {
+	seen, exist := d.deletedPodsSeen[podNetworkID]
+	if !exist {
+		seen = now
+		d.deletedPodsSeen[podNetworkID] = seen
+	}
+
+	removeAt := seen.Add(time.Duration(d.config.PKeyRemovalDelay) * time.Second)
+	if pod.DeletionTimestamp != nil && pod.DeletionTimestamp.Time.After(removeAt) {
+		removeAt = pod.DeletionTimestamp.Time
+	}
+	hold := removeAt.Sub(now)
+	if flapHold := d.flapHeldFor(podNetworkID, now); flapHold > hold {
+		hold = flapHold
+	}
+	return hold
+}
+
+// enqueuePod queues the pod to be reconciled, e.g. when its node failure state changes. It's a no-op until the pod
+// controller is set up.
+func (d *daemon) enqueuePod(name types.NamespacedName) {
+	if d.podEvents != nil {
+		d.podEvents <- event.GenericEvent{Object: &kapi.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: name.Namespace, Name: name.Name}}}
+	}
+}
+
+// enqueueNetworkPods queues the pods which configuration of the network is pending, so they are reconciled once
+// the network is updated instead of waiting for their requeue
+func (d *daemon) enqueueNetworkPods(networkID string) {
+	d.poolMutex.Lock()
+	pending := make(map[types.UID]bool)
+	for item := range d.backlogSince {
+		if item.kind == backlogAdd && item.podNetworkID.NetworkID == networkID {
+			pending[item.podNetworkID.PodUID] = true
+		}
+	}
+	var names []types.NamespacedName
+	for name, instances := range d.podInstances {
+		for _, instance := range instances {
+			if pending[instance.uid] {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	d.poolMutex.Unlock()
+
+	for _, name := range names {
+		d.enqueuePod(name)
+	}
+}
+
+// removeInfiniBandMarkers removes the configured with InfiniBand marker of the networks
+func removeInfiniBandMarkers(networks []*v1.NetworkSelectionElement) {
+	for _, network := range networks {
+		if network.CNIArgs != nil {
+			delete(*network.CNIArgs, utils.InfiniBandAnnotation)
+		}
+	}
+}
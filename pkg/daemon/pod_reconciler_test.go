@@ -0,0 +1,296 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Pod Reconciler", func() {
+	const networkID = "default_ib-net"
+
+	var (
+		smClient   *smMocks.SubnetManagerClient
+		kubeClient *k8sClientFake.Client
+		reader     client.Client
+		d          *daemon
+		pod        *kapi.Pod
+		request    reconcile.Request
+	)
+
+	newNetAttDef := func(name, pKey string) *netapi.NetworkAttachmentDefinition {
+		return &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"type": "ib-sriov", "cniVersion": "0.3.1", "name": "` + name + `", "pkey": "` + pKey + `"}`}}
+	}
+	reconcilePod := func() (reconcile.Result, error) {
+		return (&podReconciler{reader: reader, d: d}).Reconcile(context.Background(), request)
+	}
+	// syncPod updates the cached pod with the annotations written by the daemon
+	syncPod := func() {
+		written, err := kubeClient.GetPod("default", "pod")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reader.Get(context.Background(), request.NamespacedName, pod)).To(Succeed())
+		pod.Annotations = written.Annotations
+		Expect(reader.Update(context.Background(), pod)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		pod = &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid-1",
+			Annotations: map[string]string{netapi.NetworkAttachmentAnnot: `[{"name": "ib-net", "namespace": "default"}]`}},
+			Spec: kapi.PodSpec{NodeName: "node1"}}
+		kubeClient = k8sClientFake.NewClient(newNetAttDef("ib-net", "0x5"), newNetAttDef("other-net", "0x6"),
+			pod.DeepCopy())
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		reader = ctrlFake.NewClientBuilder().WithScheme(scheme).WithObjects(pod.DeepCopy()).Build()
+		request = reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "pod"}}
+
+		annotationWriter, err := k8sClient.NewAnnotationWriter(k8sClient.MergePatchAnnotationWriter, kubeClient)
+		Expect(err).ToNot(HaveOccurred())
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		smClient.On("GetPKeyMembers", mock.Anything, mock.Anything).Return(nil, plugins.ErrNotSupported).Maybe()
+		d = &daemon{
+			config: config.DaemonConfig{PeriodicUpdate: 5,
+				SMBackoff:       config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1},
+				K8sGetBackoff:   config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1},
+				K8sPatchBackoff: config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1}},
+			podNetworks:       utils.NewPodNetworksCache(),
+			kubeClient:        kubeClient,
+			annotationWriter:  annotationWriter,
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+			deletedPodsSeen:   make(map[ibTypes.PodNetworkID]time.Time),
+			podFlaps:          make(map[ibTypes.PodNetworkID]time.Time),
+			annotationRetries: make(map[types.UID]int),
+			nadSpecs:          utils.NewSynchronizedMap(),
+			summary:           &cycleSummary{},
+		}
+	})
+
+	It("Configure the networks of a scheduled pod once", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Once()
+		result, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(reconcile.Result{}))
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+
+		written, err := kubeClient.GetPod("default", "pod")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(written.Annotations[netapi.NetworkAttachmentAnnot]).To(ContainSubstring(`"mellanox.infiniband.app":` +
+			`"configured"`))
+
+		// the cached pod without the written annotation isn't configured again
+		_, err = reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		syncPod()
+		_, err = reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Don't configure the networks of an unscheduled pod", func() {
+		pod.Spec.NodeName = ""
+		reader = ctrlFake.NewClientBuilder().WithScheme(reader.Scheme()).WithObjects(pod).Build()
+		_, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		smClient.AssertNotCalled(GinkgoT(), "AddGuidsToPKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+	It("Requeue the pod keeping its guids if the subnet manager fails", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Return(errors.New("sm failure")).Once()
+		_, err := reconcilePod()
+		Expect(err).To(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		Expect(d.backlogSince).To(HaveKey(backlogItem{kind: backlogAdd,
+			podNetworkID: ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID}}))
+		var allocatedGUID string
+		for allocatedGUID = range d.guidPodNetworkMap {
+		}
+
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Once()
+		_, err = reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		Expect(d.guidPodNetworkMap).To(HaveKey(allocatedGUID))
+		Expect(d.backlogSince).To(BeEmpty())
+	})
+	It("Release the guids of a deleted pod", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Once()
+		_, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(reader.Delete(context.Background(), pod)).To(Succeed())
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Once()
+		_, err = reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		Expect(d.guidPool.Stats().Allocated).To(BeZero())
+		Expect(d.podInstances).To(BeEmpty())
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Requeue the deleted pod held for the removal delay", func() {
+		d.config.PKeyRemovalDelay = 30
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Once()
+		_, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(reader.Delete(context.Background(), pod)).To(Succeed())
+		result, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", 30*time.Second, time.Second))
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		Expect(d.podInstances).To(HaveLen(1))
+		Expect(d.backlogSince).To(HaveKey(backlogItem{kind: backlogDelete,
+			podNetworkID: ibTypes.PodNetworkID{PodUID: "uid-1", NetworkID: networkID}}))
+		smClient.AssertNotCalled(GinkgoT(), "RemoveGuidsFromPKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+	It("Release the guids of a pod recreated with the same name before configuring it", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Twice()
+		_, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(reader.Delete(context.Background(), pod)).To(Succeed())
+		recreated := pod.DeepCopy()
+		recreated.UID, recreated.ResourceVersion = "uid-2", ""
+		Expect(reader.Create(context.Background(), recreated)).To(Succeed())
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Once()
+		_, err = reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		for _, key := range d.guidPodNetworkMap {
+			Expect(key.PodUID).To(Equal(types.UID("uid-2")))
+		}
+		Expect(d.podInstances[request.NamespacedName]).To(HaveLen(1))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Release the guids of a network removed from the pod", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, mock.Anything, mock.Anything).Return(nil).Twice()
+		Expect(reader.Get(context.Background(), request.NamespacedName, pod)).To(Succeed())
+		pod.Annotations[netapi.NetworkAttachmentAnnot] = `[{"name": "ib-net", "namespace": "default"}, ` +
+			`{"name": "other-net", "namespace": "default"}]`
+		Expect(reader.Update(context.Background(), pod)).To(Succeed())
+		_, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(HaveLen(2))
+
+		syncPod()
+		Expect(reader.Get(context.Background(), request.NamespacedName, pod)).To(Succeed())
+		networks, err := utils.ParsePodNetworks(utils.NewPodRef(pod))
+		Expect(err).ToNot(HaveOccurred())
+		kept, err := json.Marshal(networks[:1])
+		Expect(err).ToNot(HaveOccurred())
+		pod.Annotations[netapi.NetworkAttachmentAnnot] = string(kept)
+		Expect(reader.Update(context.Background(), pod)).To(Succeed())
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x6, mock.Anything).Return(nil).Once()
+		_, err = reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		for _, key := range d.guidPodNetworkMap {
+			Expect(key.NetworkID).To(Equal(networkID))
+		}
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Requeue the pod network which guids are released while they're added to the pkey", func() {
+		d.pKeyWorkers = utils.NewKeyedWorkerPool(pKeyWriteWorkers)
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Run(func(mock.Arguments) {
+			// e.g. a network drain releases the guids while poolMutex is released for the write
+			if d.poolMutex.TryLock() {
+				for allocatedGUID := range d.guidPodNetworkMap {
+					_ = d.releasePodNetworkGUID(allocatedGUID)
+				}
+				d.poolMutex.Unlock()
+			}
+		}).Return(nil).Once()
+		_, err := reconcilePod()
+		Expect(err).To(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+
+		written, err := kubeClient.GetPod("default", "pod")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(written.Annotations[netapi.NetworkAttachmentAnnot]).ToNot(ContainSubstring("configured"))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Keep the guids allocated again while they're removed from the pkey", func() {
+		d.pKeyWorkers = utils.NewKeyedWorkerPool(pKeyWriteWorkers)
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x5, mock.Anything).Return(nil).Once()
+		_, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(reader.Delete(context.Background(), pod)).To(Succeed())
+		other := utils.PodNetworkKey{PodUID: "uid-2", NetworkID: networkID}
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, mock.Anything).Run(func(mock.Arguments) {
+			// the guids are released and allocated to another pod while poolMutex is released for the write
+			if d.poolMutex.TryLock() {
+				for allocatedGUID := range d.guidPodNetworkMap {
+					d.guidPodNetworkMap[allocatedGUID] = other
+				}
+				d.poolMutex.Unlock()
+			}
+		}).Return(nil).Once()
+		_, err = reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		for _, key := range d.guidPodNetworkMap {
+			Expect(key).To(Equal(other))
+		}
+		Expect(d.guidPool.Stats().Allocated).To(BeEquivalentTo(1))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Hold the pod while the subnet manager is unavailable", func() {
+		d.smUnavailable = true
+		result, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(5 * time.Second))
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		Expect(d.backlogSince).To(HaveLen(1))
+	})
+	It("Wait for the guid pool to be initialized", func() {
+		d.ready = make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := (&podReconciler{reader: reader, d: d}).Reconcile(ctx, request)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+	})
+	It("Queue the pods pending configuration of an updated network", func() {
+		d.smUnavailable = true
+		_, err := reconcilePod()
+		Expect(err).ToNot(HaveOccurred())
+
+		d.podEvents = make(chan event.GenericEvent, 1)
+		d.enqueueNetworkPods("default_other-net")
+		Expect(d.podEvents).To(BeEmpty())
+		d.enqueueNetworkPods(networkID)
+		queued := <-d.podEvents
+		Expect(client.ObjectKeyFromObject(queued.Object)).To(Equal(request.NamespacedName))
+	})
+})
@@ -0,0 +1,151 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+)
+
+// maxLoggedSMGUIDConflicts limits the number of conflicting guids listed in logs and errors
+const maxLoggedSMGUIDConflicts = 10
+
+// errSMGUIDConflict is returned by the guid pool sync with the "fail" conflict policy
+var errSMGUIDConflict = errors.New("subnet manager uses guids of the pool range not allocated by ib-kubernetes")
+
+// initSubnetManagerGUIDs syncs the guid pool with the guids in use by the subnet manager once the guids of the
+// running pods are allocated, so the guids the daemon doesn't own are known. In degraded start the sync is
+// deferred until the subnet manager is validated.
+func (d *daemon) initSubnetManagerGUIDs() error {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	if d.smUnavailable {
+		return nil
+	}
+	return d.syncAllocatedGUIDPool()
+}
+
+// resolveSMGUIDConflicts applies the guid pool conflict policy to the guids in use by the subnet manager which are
+// in the pool range but aren't allocated by the daemon, and returns the guids in use to keep allocated in the pool.
+// It's called with poolMutex held.
+func (d *daemon) resolveSMGUIDConflicts(usedGUIDs []string) ([]string, error) {
+	owned := make(map[guid.GUID]bool, len(d.guidPodNetworkMap))
+	for allocatedGUID := range d.guidPodNetworkMap {
+		if guidAddr, err := guid.ParseGUID(allocatedGUID); err == nil {
+			owned[guidAddr] = true
+		}
+	}
+
+	policy := d.config.GUIDPool.ConflictPolicy
+	kept := make([]string, 0, len(usedGUIDs))
+	var unowned []string
+	for _, usedGUID := range usedGUIDs {
+		guidAddr, err := guid.ParseGUID(usedGUID)
+		if err != nil || owned[guidAddr] || !d.guidPool.Contains(guidAddr) {
+			kept = append(kept, usedGUID)
+			continue
+		}
+		unowned = append(unowned, guidAddr.String())
+		if policy != config.ConflictPolicyAdopt {
+			kept = append(kept, usedGUID)
+		}
+	}
+
+	foreign, adopted := len(unowned), 0
+	if policy == config.ConflictPolicyAdopt && len(unowned) != 0 {
+		held := d.removeAdoptedGUIDsFromPKeys(unowned)
+		kept = append(kept, held...)
+		foreign, adopted = len(held), len(unowned)-len(held)
+	}
+	metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("foreign").Set(float64(foreign))
+	metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("adopted").Set(float64(adopted))
+	if len(unowned) == 0 {
+		return kept, nil
+	}
+
+	listed := unowned
+	if len(listed) > maxLoggedSMGUIDConflicts {
+		listed = listed[:maxLoggedSMGUIDConflicts]
+	}
+	switch policy {
+	case config.ConflictPolicyFail:
+		return nil, fmt.Errorf("%w: %d guids, e.g %s", errSMGUIDConflict, len(unowned), strings.Join(listed, ", "))
+	case config.ConflictPolicyAdopt:
+		log.Info().Msgf("adopting %d guids in use by subnet manager %s not allocated by ib-kubernetes, e.g %s",
+			adopted, d.smClient.Name(), strings.Join(listed, ", "))
+	default:
+		log.Warn().Msgf("%d guids of the pool range in use by subnet manager %s aren't allocated by ib-kubernetes, "+
+			"keeping them out of the pool, e.g %s", len(unowned), d.smClient.Name(), strings.Join(listed, ", "))
+	}
+	return kept, nil
+}
+
+// removeAdoptedGUIDsFromPKeys removes the adopted guids from the pkeys of the networks and of the default limited
+// partition before they are released to the pool, so the pods allocated an adopted guid aren't given the pkey
+// memberships of its previous user. It returns the adopted guids which couldn't be removed from the pkeys, kept
+// out of the pool. All of them are kept if the subnet manager doesn't report the pkey members. It's called with
+// poolMutex held.
+func (d *daemon) removeAdoptedGUIDsFromPKeys(adopted []string) []string {
+	pKeys, err := d.managedNetworkPKeys()
+	if err != nil {
+		log.Warn().Msgf("keeping the guids to adopt out of the pool: %v", err)
+		return adopted
+	}
+
+	adoptedSet := make(map[string]bool, len(adopted))
+	for _, adoptedGUID := range adopted {
+		adoptedSet[adoptedGUID] = true
+	}
+	held := make(map[string]bool)
+	for _, pKey := range pKeys {
+		members, err := d.getPKeyMembersSet(pKey)
+		if err != nil {
+			log.Warn().Msgf("keeping the guids to adopt out of the pool: %v", err)
+			return adopted
+		}
+
+		var memberGUIDs []string
+		for member := range members {
+			if memberGUID, err := guid.ParseGUID(member); err == nil && adoptedSet[memberGUID.String()] {
+				memberGUIDs = append(memberGUIDs, memberGUID.String())
+			}
+		}
+		if len(memberGUIDs) == 0 {
+			continue
+		}
+		sort.Strings(memberGUIDs)
+		guidAddrs := make([]net.HardwareAddr, 0, len(memberGUIDs))
+		for _, memberGUID := range memberGUIDs {
+			// the members are parsed above
+			guidAddr, _ := net.ParseMAC(memberGUID)
+			guidAddrs = append(guidAddrs, guidAddr)
+		}
+
+		pKeyStr := ibUtils.FormatPKey(pKey)
+		if err = d.removeGUIDsFromPKey(pKeyStr, guidAddrs); err != nil {
+			log.Warn().Msgf("keeping %d guids to adopt out of the pool: %v", len(memberGUIDs), err)
+			for _, memberGUID := range memberGUIDs {
+				held[memberGUID] = true
+			}
+			continue
+		}
+		log.Info().Msgf("removed %d guids to adopt from pkey %s", len(memberGUIDs), pKeyStr)
+	}
+
+	kept := make([]string, 0, len(held))
+	for _, adoptedGUID := range adopted {
+		if held[adoptedGUID] {
+			kept = append(kept, adoptedGUID)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"errors"
+	"net"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Subnet Manager GUID Conflicts", func() {
+	const (
+		podGUID      = "02:00:00:00:00:00:00:01"
+		foreignGUID  = "02:00:00:00:00:00:00:10"
+		outRangeGUID = "03:00:00:00:00:00:00:10"
+	)
+
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+	)
+
+	parseGUIDs := func(guids ...string) []net.HardwareAddr {
+		guidAddrs := make([]net.HardwareAddr, 0, len(guids))
+		for _, guidStr := range guids {
+			guidAddr, err := net.ParseMAC(guidStr)
+			Expect(err).ToNot(HaveOccurred())
+			guidAddrs = append(guidAddrs, guidAddr)
+		}
+		return guidAddrs
+	}
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		smClient.On("ListGuidsInUse", mock.Anything).Return([]string{podGUID, foreignGUID, outRangeGUID}, nil)
+		netAttDef := &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x5"}`}}
+		d = &daemon{
+			config:            config.DaemonConfig{SMBackoff: config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1}},
+			kubeClient:        k8sClientFake.NewClient(netAttDef),
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+		Expect(d.allocatePodNetworkGUID(podGUID, utils.PodNetworkKey{PodUID: "uid-1", NetworkID: "default_ib-net"})).
+			To(Succeed())
+	})
+
+	It("Keep foreign guids out of the pool with the warn policy", func() {
+		d.config.GUIDPool.ConflictPolicy = config.ConflictPolicyWarn
+		Expect(d.initSubnetManagerGUIDs()).To(Succeed())
+
+		Expect(d.guidPool.AllocateGUID(foreignGUID)).ToNot(Succeed())
+		Expect(d.guidPool.AllocateGUID(podGUID)).ToNot(Succeed())
+		Expect(testutil.ToFloat64(metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("foreign"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("adopted"))).To(Equal(0.0))
+	})
+	It("Fail the guid pool sync with the fail policy", func() {
+		d.config.GUIDPool.ConflictPolicy = config.ConflictPolicyFail
+		err := d.initSubnetManagerGUIDs()
+		Expect(errors.Is(err, errSMGUIDConflict)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(foreignGUID))
+	})
+	It("Keep adopted guids free in the pool with the adopt policy", func() {
+		d.config.GUIDPool.ConflictPolicy = config.ConflictPolicyAdopt
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(parseGUIDs(podGUID, foreignGUID), nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, parseGUIDs(foreignGUID)).Return(nil).Once()
+		Expect(d.initSubnetManagerGUIDs()).To(Succeed())
+
+		Expect(d.guidPool.AllocateGUID(foreignGUID)).To(Succeed())
+		Expect(d.guidPool.AllocateGUID(podGUID)).ToNot(Succeed())
+		Expect(testutil.ToFloat64(metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("foreign"))).To(Equal(0.0))
+		Expect(testutil.ToFloat64(metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("adopted"))).To(Equal(1.0))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Keep the guids to adopt out of the pool if they can't be removed from their pkeys", func() {
+		d.config.GUIDPool.ConflictPolicy = config.ConflictPolicyAdopt
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(parseGUIDs(foreignGUID), nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, parseGUIDs(foreignGUID)).
+			Return(errors.New("sm failure")).Once()
+		Expect(d.initSubnetManagerGUIDs()).To(Succeed())
+
+		Expect(d.guidPool.AllocateGUID(foreignGUID)).ToNot(Succeed())
+		Expect(testutil.ToFloat64(metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("foreign"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("adopted"))).To(Equal(0.0))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Keep the guids to adopt out of the pool if the pkey members aren't reported", func() {
+		d.config.GUIDPool.ConflictPolicy = config.ConflictPolicyAdopt
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(nil, plugins.ErrNotSupported).Once()
+		Expect(d.initSubnetManagerGUIDs()).To(Succeed())
+
+		Expect(d.guidPool.AllocateGUID(foreignGUID)).ToNot(Succeed())
+		Expect(testutil.ToFloat64(metrics.GUIDPoolUnownedSMGUIDs.WithLabelValues("foreign"))).To(Equal(1.0))
+		smClient.AssertNotCalled(GinkgoT(), "RemoveGuidsFromPKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+	It("Defer the guid pool sync while the subnet manager is unavailable", func() {
+		d.smUnavailable = true
+		Expect(d.initSubnetManagerGUIDs()).To(Succeed())
+		smClient.AssertNotCalled(GinkgoT(), "ListGuidsInUse")
+	})
+})
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+)
+
+var _ = Describe("Subnet Manager Call Timeouts", func() {
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+	)
+
+	BeforeEach(func() {
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		d = &daemon{smClient: smClient, config: config.DaemonConfig{SMTimeout: 30,
+			SMBackoff: config.BackoffConfig{Duration: time.Millisecond, Factor: 1, Steps: 3}}}
+	})
+
+	It("Call the subnet manager with the configured deadline", func() {
+		smClient.On("AddGuidsToPKey", mock.MatchedBy(func(ctx context.Context) bool {
+			deadline, ok := ctx.Deadline()
+			return ok && time.Until(deadline) > 29*time.Second && time.Until(deadline) <= 30*time.Second
+		}), 0x5, []net.HardwareAddr(nil)).Return(nil).Once()
+		smClient.On("GetPKeyMembers", mock.Anything, 0x5).Return(nil, nil).Once()
+
+		Expect(d.addGUIDsToPKey("0x5", nil)).To(Succeed())
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Call the subnet manager without deadline if the timeout is 0", func() {
+		d.config.SMTimeout = 0
+		smClient.On("ListGuidsInUse", mock.MatchedBy(func(ctx context.Context) bool {
+			_, ok := ctx.Deadline()
+			return !ok
+		})).Return([]string{}, nil).Once()
+
+		_, err := d.listSubnetManagerGUIDs()
+		Expect(err).ToNot(HaveOccurred())
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Stop retrying once the subnet manager calls are canceled on shutdown", func() {
+		d.smCtx, d.cancelSMCalls = context.WithCancel(context.Background())
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr(nil)).
+			Run(func(mock.Arguments) { d.cancelSMCalls() }).Return(context.Canceled).Once()
+
+		Expect(d.removeGUIDsFromPKey("0x5", nil)).ToNot(Succeed())
+		smClient.AssertNumberOfCalls(GinkgoT(), "RemoveGuidsFromPKey", 1)
+	})
+})
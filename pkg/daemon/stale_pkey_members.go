@@ -0,0 +1,151 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// initStalePKeyMembers removes from the pkeys of the networks the members of the guid pool range which aren't
+// allocated to a running pod or a reservation. The delete events of the pods deleted while the daemon was down are
+// never seen, and the guid pool sync can't release their guids as the subnet manager still reports them, so they
+// would be kept in their pkeys and out of the pool. It runs once the guids of the running pods are allocated and
+// the pkey members adopted, before the guid pool is synced with the subnet manager. When the guid range is shared
+// with other clusters through a coordination backend, the members claimed by the other clusters are kept.
+func (d *daemon) initStalePKeyMembers() error {
+	if !d.config.RemoveStalePKeyMembers || d.smUnavailable {
+		return nil
+	}
+
+	pKeys, err := d.managedNetworkPKeys()
+	if err != nil {
+		return err
+	}
+	var otherClaims map[guid.GUID]string
+	if claimLister, ok := d.guidPool.(guid.ClaimLister); ok {
+		if otherClaims, err = claimLister.OtherClaims(); err != nil {
+			return err
+		}
+	}
+
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+
+	removed := 0
+	for _, pKey := range pKeys {
+		members, err := d.getPKeyMembersSet(pKey)
+		if err != nil {
+			if errors.Is(err, plugins.ErrNotSupported) {
+				log.Warn().Msgf("can't remove stale pkey members, subnet manager %s doesn't report the pkey members",
+					d.smClient.Name())
+				return nil
+			}
+			return err
+		}
+
+		stale := d.stalePKeyMembers(members, otherClaims)
+		if len(stale) == 0 {
+			continue
+		}
+		pKeyStr := ibUtils.FormatPKey(pKey)
+		if err = d.removeGUIDsFromPKey(pKeyStr, stale); err != nil {
+			return err
+		}
+		listed := guidsToStrings(stale)
+		if len(listed) > maxLoggedSMGUIDConflicts {
+			listed = listed[:maxLoggedSMGUIDConflicts]
+		}
+		log.Info().Msgf("removed %d stale members of pkey %s not allocated by ib-kubernetes, e.g %s", len(stale),
+			pKeyStr, strings.Join(listed, ", "))
+		removed += len(stale)
+	}
+	metrics.StalePKeyMembersRemoved.Add(float64(removed))
+	if removed != 0 {
+		log.Info().Msgf("removed %d pkey members of pods deleted while ib-kubernetes was down", removed)
+	}
+	return nil
+}
+
+// managedNetworkPKeys returns the pkeys of the ib-sriov networks and the default limited partition, sorted. The
+// unmanaged default pkey and the auto pkeys not allocated yet are skipped.
+func (d *daemon) managedNetworkPKeys() ([]int, error) {
+	netAttDefs, err := d.kubeClient.GetNetworkAttachmentDefinitions(kapi.NamespaceAll)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network attachment definitions: %v", err)
+	}
+
+	pKeyStrs := make([]string, 0, len(netAttDefs.Items)+1)
+	for index := range netAttDefs.Items {
+		netAttDef := &netAttDefs.Items[index]
+		pKeyStr := netAttDef.Annotations[utils.PKeyAnnotation]
+		if pKeyStr == "" {
+			pKeyStr = getConfiguredPKey(netAttDef)
+		}
+		if pKeyStr == "" || pKeyStr == utils.AutoPKey {
+			continue
+		}
+		if _, err := ibUtils.ParsePKey(pKeyStr); err != nil {
+			log.Warn().Msgf("skipping pkey of network %s: %v",
+				ibTypes.NewNetworkID(netAttDef.Namespace, netAttDef.Name), err)
+			continue
+		}
+		pKeyStrs = append(pKeyStrs, pKeyStr)
+	}
+	if d.config.DefaultLimitedPartition != "" {
+		pKeyStrs = append(pKeyStrs, d.config.DefaultLimitedPartition)
+	}
+
+	seen := make(map[int]bool, len(pKeyStrs))
+	pKeys := make([]int, 0, len(pKeyStrs))
+	for _, pKeyStr := range pKeyStrs {
+		pKey, err := ibUtils.ParsePKey(pKeyStr)
+		if err != nil || seen[pKey] || d.unmanagedDefaultPKey(pKey) {
+			continue
+		}
+		seen[pKey] = true
+		pKeys = append(pKeys, pKey)
+	}
+	sort.Ints(pKeys)
+	return pKeys, nil
+}
+
+// stalePKeyMembers returns the members of the guid pool range not allocated by the daemon nor claimed by another
+// cluster, sorted. It's called with poolMutex held.
+func (d *daemon) stalePKeyMembers(members map[string]bool, otherClaims map[guid.GUID]string) []net.HardwareAddr {
+	stale := make([]string, 0)
+	for member := range members {
+		memberGUID, err := guid.ParseGUID(member)
+		if err != nil || !d.guidPool.Contains(memberGUID) {
+			continue
+		}
+		if _, allocated := d.guidPodNetworkMap[memberGUID.String()]; allocated {
+			continue
+		}
+		if owner, claimed := otherClaims[memberGUID]; claimed {
+			log.Debug().Msgf("keeping member %s of the guid range claimed by cluster %s", memberGUID, owner)
+			continue
+		}
+		stale = append(stale, memberGUID.String())
+	}
+	sort.Strings(stale)
+
+	guids := make([]net.HardwareAddr, 0, len(stale))
+	for _, staleGUID := range stale {
+		// the members are parsed above
+		guidAddr, _ := net.ParseMAC(staleGUID)
+		guids = append(guids, guidAddr)
+	}
+	return guids
+}
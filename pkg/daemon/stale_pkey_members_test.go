@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"errors"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smFake "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// claimingPool is a guid pool sharing its range with other clusters which claimed the guids
+type claimingPool struct {
+	guid.Pool
+	otherClaims map[guid.GUID]string
+	err         error
+}
+
+func (p *claimingPool) OtherClaims() (map[guid.GUID]string, error) {
+	return p.otherClaims, p.err
+}
+
+var _ = Describe("Stale PKey Members", func() {
+	const (
+		runningGUID  = "02:00:00:00:00:00:00:10"
+		staleGUID    = "02:00:00:00:00:00:00:11"
+		outRangeGUID = "03:00:00:00:00:00:00:11"
+	)
+
+	var (
+		smClient *smFake.SubnetManagerClient
+		d        *daemon
+	)
+
+	newNetAttDef := func(name, pKey string) *netapi.NetworkAttachmentDefinition {
+		return &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "` + pKey + `"}`}}
+	}
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = smFake.NewSubnetManagerClient()
+		d = &daemon{
+			config: config.DaemonConfig{RemoveStalePKeyMembers: true},
+			kubeClient: k8sClientFake.NewClient(newNetAttDef("ib-net", "0x5"), newNetAttDef("auto-net", "auto"),
+				newNetAttDef("default-net", "0x7fff")),
+			guidPool: guidPool,
+			smClient: smClient,
+			guidPodNetworkMap: map[string]utils.PodNetworkKey{
+				runningGUID: {PodUID: "running", NetworkID: "default_ib-net"}},
+		}
+	})
+
+	It("Remove the pkey members of the pool range not allocated to a pod", func() {
+		smClient.SetMembers(0x5, runningGUID, staleGUID, outRangeGUID)
+		removed := testutil.ToFloat64(metrics.StalePKeyMembersRemoved)
+
+		Expect(d.initStalePKeyMembers()).To(Succeed())
+		Expect(smClient.Members(0x5)).To(Equal([]string{runningGUID, outRangeGUID}))
+		Expect(testutil.ToFloat64(metrics.StalePKeyMembersRemoved)).To(Equal(removed + 1))
+		// the unmanaged default pkey and the auto pkey not allocated yet aren't audited
+		Expect(smClient.Calls(smFake.MethodGetPKeyMembers)).To(HaveLen(1))
+	})
+	It("Remove the stale members of the default limited partition", func() {
+		d.config.DefaultLimitedPartition = "0x6"
+		smClient.SetMembers(0x6, runningGUID, staleGUID)
+
+		Expect(d.initStalePKeyMembers()).To(Succeed())
+		Expect(smClient.Members(0x6)).To(Equal([]string{runningGUID}))
+	})
+	It("Keep the pkey members claimed by other clusters sharing the guid range", func() {
+		claimedGUID := "02:00:00:00:00:00:00:12"
+		claimed, err := guid.ParseGUID(claimedGUID)
+		Expect(err).ToNot(HaveOccurred())
+		pool := &claimingPool{Pool: d.guidPool, otherClaims: map[guid.GUID]string{claimed: "cluster-b"}}
+		d.guidPool = pool
+		smClient.SetMembers(0x5, runningGUID, staleGUID, claimedGUID)
+
+		Expect(d.initStalePKeyMembers()).To(Succeed())
+		Expect(smClient.Members(0x5)).To(Equal([]string{runningGUID, claimedGUID}))
+
+		// the members aren't removed when the claims can't be listed
+		smClient.SetMembers(0x5, staleGUID)
+		pool.err = errors.New("etcd unavailable")
+		Expect(d.initStalePKeyMembers()).ToNot(Succeed())
+		Expect(smClient.Members(0x5)).To(Equal([]string{staleGUID}))
+	})
+	It("Keep the pkey members when disabled", func() {
+		d.config.RemoveStalePKeyMembers = false
+		smClient.SetMembers(0x5, staleGUID)
+
+		Expect(d.initStalePKeyMembers()).To(Succeed())
+		Expect(smClient.Members(0x5)).To(Equal([]string{staleGUID}))
+		Expect(smClient.Calls()).To(BeEmpty())
+	})
+	It("Skip the removal when the subnet manager doesn't report the pkey members", func() {
+		smClient.SetMembers(0x5, staleGUID)
+		smClient.InjectError(smFake.MethodGetPKeyMembers, plugins.ErrNotSupported, 0)
+
+		Expect(d.initStalePKeyMembers()).To(Succeed())
+		Expect(smClient.Members(0x5)).To(Equal([]string{staleGUID}))
+	})
+	It("Fail when the pkey members can't be fetched", func() {
+		smClient.InjectError(smFake.MethodGetPKeyMembers, errors.New("timeout"), 0)
+
+		Expect(d.initStalePKeyMembers()).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,222 @@
+package daemon
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/webhook"
+)
+
+// stableGUIDNetworkID is the network ID of the keys stable guids of stopped StatefulSet replicas are mapped to
+// in guidPodNetworkMap, keeping them from being allocated for other pods until the replica is started again
+const stableGUIDNetworkID = "statefulset"
+
+// generateStableGUIDKey returns the key a stable guid is mapped to in guidPodNetworkMap while its replica is stopped
+func generateStableGUIDKey(identity string) utils.PodNetworkKey {
+	return utils.PodNetworkKey{PodUID: types.UID(identity), NetworkID: stableGUIDNetworkID}
+}
+
+// stableGUIDInUseError is returned when the stable guid of a StatefulSet replica is still allocated for the pod
+// network of the previous replica, the new replica is held until the previous one is deleted
+type stableGUIDInUseError struct {
+	guid  string
+	owner utils.PodNetworkKey
+}
+
+func (e *stableGUIDInUseError) Error() string {
+	return fmt.Sprintf("stable guid %s is still allocated for %s", e.guid, e.owner)
+}
+
+// getStatefulSetIdentity returns the stable identity of the pod network derived from the StatefulSet name and
+// the pod ordinal, it returns false if stable guids are disabled or the pod is not owned by a StatefulSet
+func (d *daemon) getStatefulSetIdentity(pod *utils.PodRef, key utils.PodNetworkKey) (string, bool) {
+	if !d.config.StatefulSetStableGUIDs {
+		return "", false
+	}
+
+	owner := pod.Controller
+	if owner == nil || owner.Kind != "StatefulSet" {
+		return "", false
+	}
+
+	ordinal := strings.TrimPrefix(pod.Name, owner.Name+"-")
+	if _, err := strconv.Atoi(ordinal); err != nil || ordinal == pod.Name {
+		return "", false
+	}
+
+	// The identity is used as a config map key, namespaces and StatefulSet names can't contain "_"
+	identity := pod.Namespace + "_" + owner.Name + "_" + ordinal + "_" + key.NetworkID
+	if key.Interface != "" {
+		identity += "_" + key.Interface
+	}
+	return identity, true
+}
+
+// allocateStableGUID allocates the stable guid of the StatefulSet replica identity for the pod network.
+// A replica without a stable guid is allocated a guid derived from its identity, or the next free guid
+// if the derived one is taken, and the guid is recorded as the replica's stable guid.
+func (d *daemon) allocateStableGUID(identity string, key utils.PodNetworkKey) (guid.GUID, error) {
+	if stableGUID, exist := d.stableGUIDs[identity]; exist {
+		guidAddr, err := guid.ParseGUID(stableGUID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse stable guid %s of %s with error: %v", stableGUID, identity, err)
+		}
+
+		mappedKey, allocated := d.guidPodNetworkMap[stableGUID]
+		switch {
+		case mappedKey == key:
+			return guidAddr, nil
+		case mappedKey == generateStableGUIDKey(identity):
+			d.guidPodNetworkMap[stableGUID] = key
+			d.summary.guidAllocated()
+			d.notify(&webhook.Event{Type: webhook.GUIDAllocated, GUID: stableGUID, PodUID: string(key.PodUID),
+				NetworkID: key.NetworkID, Interface: key.Interface})
+			return guidAddr, nil
+		case allocated:
+			return 0, &stableGUIDInUseError{guid: stableGUID, owner: mappedKey}
+		}
+
+		if err = d.allocatePodNetworkGUID(stableGUID, key); err == nil {
+			return guidAddr, nil
+		}
+		log.Warn().Msgf("failed to allocate stable guid %s of %s, allocating a new one: %v", stableGUID, identity, err)
+	}
+
+	guidAddr := d.deriveStableGUID(identity)
+	if guidAddr == 0 || d.allocatePodNetworkGUID(guidAddr.String(), key) != nil {
+		var err error
+		if guidAddr, err = d.guidPool.GenerateGUID(); err != nil {
+			return 0, fmt.Errorf("failed to generate GUID for pod ID %s, with error: %v", key.PodUID, err)
+		}
+		if err = d.allocatePodNetworkGUID(guidAddr.String(), key); err != nil {
+			return 0, err
+		}
+	}
+
+	log.Info().Msgf("recording stable guid %s of %s", guidAddr, identity)
+	d.stableGUIDs[identity] = guidAddr.String()
+	d.stableGUIDsChanged = true
+	return guidAddr, nil
+}
+
+// deriveStableGUID returns the guid of the pool range derived from the hash of the identity, 0 if the range is invalid
+func (d *daemon) deriveStableGUID(identity string) guid.GUID {
+	rangeStart, err := guid.ParseGUID(d.config.GUIDPool.RangeStart)
+	if err != nil {
+		return 0
+	}
+	rangeEnd, err := guid.ParseGUID(d.config.GUIDPool.RangeEnd)
+	if err != nil || rangeEnd < rangeStart {
+		return 0
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(identity))
+	return rangeStart + guid.GUID(hash.Sum64()%(uint64(rangeEnd-rangeStart)+1))
+}
+
+// parkStableGUID keeps the released stable guid allocated for its StatefulSet replica identity,
+// it returns false if the guid is not a stable guid of a replica
+func (d *daemon) parkStableGUID(releasedGUID string) bool {
+	for identity, stableGUID := range d.stableGUIDs {
+		if stableGUID != releasedGUID {
+			continue
+		}
+
+		stableKey := generateStableGUIDKey(identity)
+		if d.guidPodNetworkMap[releasedGUID] == stableKey {
+			// Releasing a parked guid forgets the stable guid of the replica
+			delete(d.stableGUIDs, identity)
+			d.stableGUIDsChanged = true
+			return false
+		}
+
+		d.guidPodNetworkMap[releasedGUID] = stableKey
+		return true
+	}
+	return false
+}
+
+// getStableGUIDsConfigMapName returns the namespace and name of the config map the stable guids are tracked in
+func (d *daemon) getStableGUIDsConfigMapName() (namespace, name string) {
+	namespace, name, _ = strings.Cut(d.config.StableGUIDsConfigMap, "/")
+	return namespace, name
+}
+
+// initStableGUIDs loads the stable guids of StatefulSet replicas from the config map and keeps the guids
+// of stopped replicas allocated for them
+func (d *daemon) initStableGUIDs() error {
+	if !d.config.StatefulSetStableGUIDs {
+		return nil
+	}
+
+	d.stableGUIDs = make(map[string]string)
+	namespace, name := d.getStableGUIDsConfigMapName()
+	configMap, err := d.kubeClient.GetConfigMap(namespace, name)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			log.Info().Msgf("stable guids config map %s/%s not found, starting with no stable guids", namespace, name)
+			return nil
+		}
+		return fmt.Errorf("failed to get stable guids config map %s/%s: %v", namespace, name, err)
+	}
+
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	for identity, stableGUID := range configMap.Data {
+		d.stableGUIDs[identity] = stableGUID
+		if _, allocated := d.guidPodNetworkMap[stableGUID]; allocated {
+			continue
+		}
+		if err = d.guidPool.AllocateGUID(stableGUID); err != nil {
+			log.Warn().Msgf("failed to keep stable guid %s of %s: %v", stableGUID, identity, err)
+			continue
+		}
+		d.guidPodNetworkMap[stableGUID] = generateStableGUIDKey(identity)
+	}
+	log.Info().Msgf("loaded %d stable guids of statefulset replicas", len(d.stableGUIDs))
+	return nil
+}
+
+// saveStableGUIDs writes the stable guids to the config map if they changed since the last save
+func (d *daemon) saveStableGUIDs() {
+	if !d.stableGUIDsChanged {
+		return
+	}
+
+	namespace, name := d.getStableGUIDsConfigMapName()
+	data := make(map[string]string, len(d.stableGUIDs))
+	for identity, stableGUID := range d.stableGUIDs {
+		data[identity] = stableGUID
+	}
+
+	if err := d.writeConfigMapData(namespace, name, data); err != nil {
+		log.Warn().Msgf("failed to save stable guids to config map %s/%s, will retry: %v", namespace, name, err)
+		return
+	}
+	d.stableGUIDsChanged = false
+}
+
+// writeConfigMapData replaces the data of the config map, the config map is created if it doesn't exist
+func (d *daemon) writeConfigMapData(namespace, name string, data map[string]string) error {
+	configMap, err := d.kubeClient.GetConfigMap(namespace, name)
+	switch {
+	case kerrors.IsNotFound(err):
+		_, err = d.kubeClient.CreateConfigMap(&kapi.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Data: data})
+	case err == nil:
+		configMap.Data = data
+		_, err = d.kubeClient.UpdateConfigMap(configMap)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package daemon
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("StatefulSet Stable GUIDs", func() {
+	const (
+		networkID = "default_ib-net"
+		identity  = "default_db_0_default_ib-net_net1"
+	)
+
+	var (
+		kubeClient *k8sClientFake.Client
+		d          *daemon
+	)
+
+	newReplica := func(name string, uid types.UID) *utils.PodRef {
+		controller := true
+		return &utils.PodRef{Name: name, Namespace: "default", UID: uid,
+			Controller: &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db",
+				Controller: &controller}}
+	}
+	newKey := func(uid types.UID) utils.PodNetworkKey {
+		return utils.PodNetworkKey{PodUID: uid, NetworkID: networkID, Interface: "net1"}
+	}
+
+	BeforeEach(func() {
+		guidPoolConfig := config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"}
+		guidPool, err := guid.NewPool(&guidPoolConfig)
+		Expect(err).ToNot(HaveOccurred())
+
+		kubeClient = k8sClientFake.NewClient()
+		d = &daemon{
+			config: config.DaemonConfig{GUIDPool: guidPoolConfig, StatefulSetStableGUIDs: true,
+				StableGUIDsConfigMap: "kube-system/ib-kubernetes-stable-guids"},
+			kubeClient:        kubeClient,
+			guidPool:          guidPool,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+		Expect(d.initStableGUIDs()).To(Succeed())
+	})
+
+	It("Derive identity from statefulset name and pod ordinal", func() {
+		replicaIdentity, stable := d.getStatefulSetIdentity(newReplica("db-0", "uid-1"), newKey("uid-1"))
+		Expect(stable).To(BeTrue())
+		Expect(replicaIdentity).To(Equal(identity))
+
+		_, stable = d.getStatefulSetIdentity(&utils.PodRef{Name: "db-0"}, newKey("uid-1"))
+		Expect(stable).To(BeFalse())
+
+		d.config.StatefulSetStableGUIDs = false
+		_, stable = d.getStatefulSetIdentity(newReplica("db-0", "uid-1"), newKey("uid-1"))
+		Expect(stable).To(BeFalse())
+	})
+	It("Allocate the same guid to a restarted replica", func() {
+		first, err := d.allocateStableGUID(identity, newKey("uid-1"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(first).To(Equal(d.deriveStableGUID(identity)))
+
+		// The guid is kept for the replica after its pod is deleted
+		Expect(d.releasePodNetworkGUID(first.String())).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(first.String(), generateStableGUIDKey(identity)))
+		Expect(d.guidPool.AllocateGUID(first.String())).ToNot(Succeed())
+
+		second, err := d.allocateStableGUID(identity, newKey("uid-2"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second).To(Equal(first))
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(first.String(), newKey("uid-2")))
+	})
+	It("Hold restarted replica until the previous replica releases the guid", func() {
+		first, err := d.allocateStableGUID(identity, newKey("uid-1"))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = d.allocateStableGUID(identity, newKey("uid-2"))
+		var inUse *stableGUIDInUseError
+		Expect(errors.As(err, &inUse)).To(BeTrue())
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(first.String(), newKey("uid-1")))
+	})
+	It("Allocate next free guid when the derived guid is taken", func() {
+		derived := d.deriveStableGUID(identity)
+		Expect(d.allocatePodNetworkGUID(derived.String(), newKey("other-uid"))).To(Succeed())
+
+		allocated, err := d.allocateStableGUID(identity, newKey("uid-1"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(allocated).ToNot(Equal(derived))
+		Expect(d.stableGUIDs).To(HaveKeyWithValue(identity, allocated.String()))
+	})
+	It("Forget stable guid released while its replica is stopped", func() {
+		allocated, err := d.allocateStableGUID(identity, newKey("uid-1"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d.releasePodNetworkGUID(allocated.String())).To(Succeed())
+
+		Expect(d.releasePodNetworkGUID(allocated.String())).To(Succeed())
+		Expect(d.stableGUIDs).ToNot(HaveKey(identity))
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(allocated.String()))
+	})
+	It("Save and load stable guids with the config map", func() {
+		allocated, err := d.allocateStableGUID(identity, newKey("uid-1"))
+		Expect(err).ToNot(HaveOccurred())
+		d.saveStableGUIDs()
+		Expect(d.stableGUIDsChanged).To(BeFalse())
+
+		configMap, err := kubeClient.GetConfigMap("kube-system", "ib-kubernetes-stable-guids")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configMap.Data).To(HaveKeyWithValue(identity, allocated.String()))
+
+		// A restarted daemon keeps the guid of the stopped replica
+		guidPool, err := guid.NewPool(&d.config.GUIDPool)
+		Expect(err).ToNot(HaveOccurred())
+		d.guidPool = guidPool
+		d.guidPodNetworkMap = make(map[string]utils.PodNetworkKey)
+		Expect(d.initStableGUIDs()).To(Succeed())
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(allocated.String(), generateStableGUIDKey(identity)))
+	})
+})
@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"net"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+)
+
+// teardown removes the guids allocated by the daemon from the pkeys of their networks and the default limited
+// partition, and the guids of guid reservations from their pkeys. It runs on graceful shutdown once the
+// periodic updates are stopped, so an ephemeral cluster leaves the shared fabric clean. The guids stay in the
+// pods' network annotations, failures are logged and the remaining pkeys are still cleaned.
+func (d *daemon) teardown() {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	// guids allocated by a standby replica were never added to the pkeys, they are left to the leader
+	if !d.leading {
+		log.Info().Msg("skipping teardown, the daemon wasn't leading")
+		return
+	}
+
+	pKeyGUIDs := d.teardownNetworkGUIDs()
+	pKeys := make([]string, 0, len(pKeyGUIDs))
+	for pKey := range pKeyGUIDs {
+		pKeys = append(pKeys, pKey)
+	}
+	sort.Strings(pKeys)
+
+	removed := 0
+	for _, pKey := range pKeys {
+		guids := pKeyGUIDs[pKey]
+		if pKey != "" {
+			if err := d.removeGUIDsFromPKey(pKey, guids); err != nil {
+				log.Error().Msgf("teardown failed to remove %d guids: %v", len(guids), err)
+				continue
+			}
+		}
+		if err := d.removeGUIDsFromLimitedPartition(pKey, guids); err != nil {
+			log.Error().Msgf("teardown failed to remove %d guids of pkey %s: %v", len(guids), pKey, err)
+			continue
+		}
+		removed += len(guids)
+	}
+
+	removed += d.teardownGUIDReservations()
+	log.Info().Msgf("teardown removed %d guids from their pkeys", removed)
+}
+
+// teardownNetworkGUIDs returns the guids allocated for the pods sorted and grouped by the pkey of their network,
+// empty for networks without pkey. Stable guids of stopped StatefulSet replicas aren't pkeys members and are
+// skipped, as the guids of networks which can't be resolved. It's called with poolMutex held
+func (d *daemon) teardownNetworkGUIDs() map[string][]net.HardwareAddr {
+	networkPKeys := make(map[string]string)
+	unresolved := make(map[string]bool)
+	pKeyGUIDs := make(map[string][]net.HardwareAddr)
+	for allocatedGUID, key := range d.guidPodNetworkMap {
+		if key.NetworkID == guidReservationNetworkID || key.NetworkID == stableGUIDNetworkID ||
+			unresolved[key.NetworkID] {
+			continue
+		}
+
+		pKey, resolved := networkPKeys[key.NetworkID]
+		if !resolved {
+			_, ibCniSpec, err := d.getIbSriovNetwork(key.NetworkID)
+			if err != nil {
+				log.Warn().Msgf("teardown skipping guids of network %s: %v", key.NetworkID, err)
+				unresolved[key.NetworkID] = true
+				continue
+			}
+			pKey = ibCniSpec.PKey
+			networkPKeys[key.NetworkID] = pKey
+		}
+
+		guidAddr, err := net.ParseMAC(allocatedGUID)
+		if err != nil {
+			log.Warn().Msgf("teardown skipping guid %s of %s: %v", allocatedGUID, key, err)
+			continue
+		}
+		pKeyGUIDs[pKey] = append(pKeyGUIDs[pKey], guidAddr)
+	}
+
+	for _, guids := range pKeyGUIDs {
+		sort.Slice(guids, func(i, j int) bool { return guids[i].String() < guids[j].String() })
+	}
+	return pKeyGUIDs
+}
+
+// teardownGUIDReservations removes the guids of the guid reservations from their pkeys and returns the number
+// of removed guids
+func (d *daemon) teardownGUIDReservations() int {
+	if !d.config.EnableGUIDReservations {
+		return 0
+	}
+
+	reservations, err := d.kubeClient.GetGUIDReservations(kapi.NamespaceAll)
+	if err != nil {
+		log.Error().Msgf("teardown failed to get guid reservations from kubernetes: %v", err)
+		return 0
+	}
+
+	removed := 0
+	for index := range reservations.Items {
+		reservation := &reservations.Items[index]
+		if reservation.Status.GUID == "" || reservation.Status.PKey == "" {
+			continue
+		}
+
+		guidAddr, err := net.ParseMAC(reservation.Status.GUID)
+		if err != nil {
+			log.Warn().Msgf("teardown skipping guid %s of guid reservation %s/%s: %v", reservation.Status.GUID,
+				reservation.Namespace, reservation.Name, err)
+			continue
+		}
+		if err = d.removeGUIDsFromPKey(reservation.Status.PKey, []net.HardwareAddr{guidAddr}); err != nil {
+			log.Error().Msgf("teardown failed to remove guid of guid reservation %s/%s: %v",
+				reservation.Namespace, reservation.Name, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"errors"
+	"net"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Teardown", func() {
+	const (
+		firstGUID       = "02:00:00:00:00:00:00:01"
+		otherGUID       = "02:00:00:00:00:00:00:02"
+		lastGUID        = "02:00:00:00:00:00:00:03"
+		stableGUID      = "02:00:00:00:00:00:00:04"
+		reservationGUID = "02:00:00:00:00:00:00:05"
+	)
+
+	var (
+		smClient *smMocks.SubnetManagerClient
+		d        *daemon
+	)
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+
+		newNetAttDef := func(name, pKey string) *netapi.NetworkAttachmentDefinition {
+			return &netapi.NetworkAttachmentDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec: netapi.NetworkAttachmentDefinitionSpec{
+					Config: `{"type": "ib-sriov", "cniVersion": "0.3.1", "name": "` + name + `", "pkey": "` + pKey + `"}`}}
+		}
+		reservation := &v1alpha1.IBGuidReservation{
+			ObjectMeta: metav1.ObjectMeta{Name: "reserved", Namespace: "default", UID: "reservation-uid"},
+			Spec:       v1alpha1.IBGuidReservationSpec{PKey: "0x7"},
+			Status:     v1alpha1.IBGuidReservationStatus{GUID: reservationGUID, PKey: "0x7"}}
+
+		d = &daemon{
+			config: config.DaemonConfig{EnableGUIDReservations: true, DefaultLimitedPartition: "0x7FFF",
+				ManageDefaultPKey: true, SMBackoff: config.BackoffConfig{Duration: 1, Steps: 1}},
+			kubeClient: k8sClientFake.NewClient(newNetAttDef("ib-net", "0x5"), newNetAttDef("other-net", "0x6"),
+				reservation),
+			guidPool:          guidPool,
+			smClient:          smClient,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+			leading:           true,
+		}
+		for guidStr, key := range map[string]utils.PodNetworkKey{
+			firstGUID:       {PodUID: "pod-1", NetworkID: "default_ib-net"},
+			otherGUID:       {PodUID: "pod-2", NetworkID: "default_other-net"},
+			lastGUID:        {PodUID: "pod-3", NetworkID: "default_ib-net"},
+			stableGUID:      {PodUID: "default/db/0", NetworkID: stableGUIDNetworkID},
+			reservationGUID: generateGUIDReservationKey(reservation),
+		} {
+			Expect(d.allocatePodNetworkGUID(guidStr, key)).To(Succeed())
+		}
+	})
+
+	It("Remove the allocated guids from their pkeys and the default limited partition", func() {
+		first, _ := net.ParseMAC(firstGUID)
+		other, _ := net.ParseMAC(otherGUID)
+		last, _ := net.ParseMAC(lastGUID)
+		reserved, _ := net.ParseMAC(reservationGUID)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr{first, last}).Return(nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x7FFF, []net.HardwareAddr{first, last}).Return(nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x6, []net.HardwareAddr{other}).Return(nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x7FFF, []net.HardwareAddr{other}).Return(nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x7, []net.HardwareAddr{reserved}).Return(nil).Once()
+
+		d.teardown()
+		smClient.AssertExpectations(GinkgoT())
+		// the guids aren't released, they stay in the pods' annotations
+		Expect(d.guidPodNetworkMap).To(HaveLen(5))
+	})
+	It("Continue with the other pkeys when removal fails", func() {
+		first, _ := net.ParseMAC(firstGUID)
+		other, _ := net.ParseMAC(otherGUID)
+		last, _ := net.ParseMAC(lastGUID)
+		reserved, _ := net.ParseMAC(reservationGUID)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr{first, last}).
+			Return(errors.New("failed")).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x6, []net.HardwareAddr{other}).Return(nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x7FFF, []net.HardwareAddr{other}).Return(nil).Once()
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x7, []net.HardwareAddr{reserved}).Return(nil).Once()
+
+		d.teardown()
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Skip teardown of a standby replica", func() {
+		d.leading = false
+		d.teardown()
+		smClient.AssertNotCalled(GinkgoT(), "RemoveGuidsFromPKey")
+	})
+})
@@ -0,0 +1,476 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/webhook"
+)
+
+// warmPoolWorkload is a ReplicaSet or StatefulSet which pod template requests networks
+type warmPoolWorkload struct {
+	kind           string
+	namespace      string
+	name           string
+	uid            types.UID
+	replicas       int
+	serviceAccount string
+	networks       []*v1.NetworkSelectionElement
+}
+
+func (w *warmPoolWorkload) String() string {
+	return fmt.Sprintf("%s %s/%s", w.kind, w.namespace, w.name)
+}
+
+// newWarmPoolWorkload returns the workload of the pod template, it returns false if the pods of the template
+// aren't allocated guids by the daemon
+func newWarmPoolWorkload(kind string, meta *metav1.ObjectMeta, replicas *int32,
+	template *kapi.PodTemplateSpec) (*warmPoolWorkload, bool) {
+	// the pods are created in the namespace of the workload
+	pod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: meta.Namespace, Annotations: template.Annotations},
+		Spec: template.Spec}
+	if meta.DeletionTimestamp != nil || !utils.PodWantsNetwork(pod) || !utils.PodIsManaged(pod) ||
+		!utils.HasNetworkAttachmentAnnot(pod) {
+		return nil, false
+	}
+
+	networks, err := utils.ParsePodNetworks(utils.NewPodRef(pod))
+	if err != nil {
+		log.Debug().Msgf("skipping %s %s/%s: failed to parse pod template networks: %v", kind, meta.Namespace,
+			meta.Name, err)
+		return nil, false
+	}
+
+	workload := &warmPoolWorkload{kind: kind, namespace: meta.Namespace, name: meta.Name, uid: meta.UID,
+		replicas: 1, serviceAccount: template.Spec.ServiceAccountName}
+	if replicas != nil {
+		workload.replicas = int(*replicas)
+	}
+	if workload.serviceAccount == "" {
+		workload.serviceAccount = defaultServiceAccount
+	}
+	for _, network := range networks {
+		// guids requested by the user aren't allocated from the pool
+		if !utils.PodNetworkHasGUID(network) {
+			workload.networks = append(workload.networks, network)
+		}
+	}
+	return workload, len(workload.networks) != 0
+}
+
+// generateWarmGUIDKey returns the key the warm guids of the workload network are mapped to in guidPodNetworkMap.
+// The key holds the network of the guids, so they are handled as members of the network pkey.
+func generateWarmGUIDKey(workloadUID types.UID, network *v1.NetworkSelectionElement) utils.PodNetworkKey {
+	return utils.PodNetworkKey{PodUID: workloadUID, NetworkID: ibTypes.NetworkIDOf(network).String(),
+		Interface: network.InterfaceRequest}
+}
+
+// WarmPoolPeriodicUpdate pre-allocates guids for the pods of the ReplicaSets and StatefulSets which weren't
+// allocated guids yet and adds them to the networks pkeys, so the pods are assigned a warm guid without waiting
+// for the subnet manager. Warm guids exceeding the expected replicas are removed from the pkeys and released.
+func (d *daemon) WarmPoolPeriodicUpdate() {
+	log.Info().Msg("running warm pool periodic update")
+	workloads, pods, err := d.listWarmPoolWorkloads(context.Background())
+	if err != nil {
+		log.Error().Msgf("failed to list workloads of the warm pool: %v", err)
+		return
+	}
+
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	if !d.subnetManagerAvailable() {
+		return
+	}
+	policies, err := d.getPartitionPolicies()
+	if err != nil {
+		log.Error().Msgf("deferring warm pool periodic update: %v", err)
+		return
+	}
+	d.reconcileWarmPool(workloads, pods, policies)
+	d.saveWarmGUIDs()
+	d.updatePoolMetrics()
+	log.Info().Msg("warm pool periodic update finished")
+}
+
+// listWarmPoolWorkloads lists the workloads which pods are allocated guids and the pods, from the informer cache.
+// StatefulSets are skipped if stable guids are enabled, their replicas are allocated their stable guids.
+func (d *daemon) listWarmPoolWorkloads(ctx context.Context) ([]*warmPoolWorkload, []kapi.Pod, error) {
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := d.workloadReader.List(ctx, replicaSets); err != nil {
+		return nil, nil, fmt.Errorf("failed to list replicasets: %v", err)
+	}
+	var workloads []*warmPoolWorkload
+	for index := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[index]
+		if workload, ok := newWarmPoolWorkload("ReplicaSet", &replicaSet.ObjectMeta, replicaSet.Spec.Replicas,
+			&replicaSet.Spec.Template); ok {
+			workloads = append(workloads, workload)
+		}
+	}
+
+	if !d.config.StatefulSetStableGUIDs {
+		statefulSets := &appsv1.StatefulSetList{}
+		if err := d.workloadReader.List(ctx, statefulSets); err != nil {
+			return nil, nil, fmt.Errorf("failed to list statefulsets: %v", err)
+		}
+		for index := range statefulSets.Items {
+			statefulSet := &statefulSets.Items[index]
+			if workload, ok := newWarmPoolWorkload("StatefulSet", &statefulSet.ObjectMeta,
+				statefulSet.Spec.Replicas, &statefulSet.Spec.Template); ok {
+				workloads = append(workloads, workload)
+			}
+		}
+	}
+
+	pods := &kapi.PodList{}
+	if err := d.workloadReader.List(ctx, pods); err != nil {
+		return nil, nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+	return workloads, pods.Items, nil
+}
+
+// reconcileWarmPool keeps a warm guid for every expected replica of the workloads networks which pod wasn't
+// allocated a guid yet, it's called with poolMutex held
+func (d *daemon) reconcileWarmPool(workloads []*warmPoolWorkload, pods []kapi.Pod, policies *partitionPolicies) {
+	allocated := make(map[utils.PodNetworkKey]bool, len(d.guidPodNetworkMap))
+	for _, key := range d.guidPodNetworkMap {
+		allocated[key] = true
+	}
+	// terminating pods are being replaced, their replacements need a guid
+	workloadPods := make(map[types.UID][]types.UID)
+	for index := range pods {
+		pod := &pods[index]
+		if owner := metav1.GetControllerOf(pod); owner != nil && pod.DeletionTimestamp == nil {
+			workloadPods[owner.UID] = append(workloadPods[owner.UID], pod.UID)
+		}
+	}
+
+	// the warm guids released or taken since the previous update are dropped
+	warmGUIDs := make(map[utils.PodNetworkKey][]string, len(d.warmGUIDs))
+	for warmKey, guids := range d.warmGUIDs {
+		for _, warmGUID := range guids {
+			if d.guidPodNetworkMap[warmGUID] == warmKey {
+				warmGUIDs[warmKey] = append(warmGUIDs[warmKey], warmGUID)
+			}
+		}
+	}
+
+	wanted := make(map[utils.PodNetworkKey]int)
+	owners := make(map[utils.PodNetworkKey]plugins.GUIDOwner)
+	networkPKeys := make(map[string]string)
+	for _, workload := range workloads {
+		for _, network := range workload.networks {
+			warmKey := generateWarmGUIDKey(workload.uid, network)
+			pKey, ok := d.getWarmPoolNetworkPKey(warmKey.NetworkID, networkPKeys)
+			if !ok {
+				continue
+			}
+			if err := policies.check(workload.namespace, workload.serviceAccount, pKey); err != nil {
+				log.Debug().Msgf("skipping network %s of %s: %v", warmKey.NetworkID, workload, err)
+				continue
+			}
+
+			expected := workload.replicas
+			for _, podUID := range workloadPods[workload.uid] {
+				if allocated[utils.PodNetworkKey{PodUID: podUID, NetworkID: warmKey.NetworkID,
+					Interface: warmKey.Interface}] {
+					expected--
+				}
+			}
+			wanted[warmKey] = max(expected, 0)
+			owners[warmKey] = plugins.GUIDOwner{Kind: workload.kind, Namespace: workload.namespace,
+				Name: workload.name}
+		}
+	}
+
+	warmKeys := make([]utils.PodNetworkKey, 0, len(warmGUIDs)+len(wanted))
+	for warmKey := range warmGUIDs {
+		if _, exist := wanted[warmKey]; !exist {
+			warmKeys = append(warmKeys, warmKey)
+		}
+	}
+	for warmKey := range wanted {
+		warmKeys = append(warmKeys, warmKey)
+	}
+	sort.Slice(warmKeys, func(i, j int) bool { return warmKeys[i].String() < warmKeys[j].String() })
+
+	// the surplus guids are released first, so they can be allocated for the other networks
+	for _, warmKey := range warmKeys {
+		if surplus := len(warmGUIDs[warmKey]) - wanted[warmKey]; surplus > 0 {
+			guids := warmGUIDs[warmKey]
+			// the guids of a deleted network aren't removed from its unknown pkey
+			pKey, _ := d.getWarmPoolNetworkPKey(warmKey.NetworkID, networkPKeys)
+			kept, err := d.releaseWarmGUIDs(warmKey, pKey, guids[len(guids)-surplus:])
+			warmGUIDs[warmKey] = append(guids[:len(guids)-surplus], kept...)
+			if err != nil {
+				log.Error().Msgf("failed to release %d warm guids of %s: %v", surplus, warmKey, err)
+			}
+		}
+	}
+	for _, warmKey := range warmKeys {
+		if missing := wanted[warmKey] - len(warmGUIDs[warmKey]); missing > 0 {
+			added, err := d.reserveWarmGUIDs(warmKey, owners[warmKey], networkPKeys[warmKey.NetworkID],
+				missing)
+			warmGUIDs[warmKey] = append(warmGUIDs[warmKey], added...)
+			if err != nil {
+				log.Error().Msgf("failed to reserve %d warm guids of %s: %v", missing, warmKey, err)
+			}
+		}
+	}
+
+	total := 0
+	for warmKey, guids := range warmGUIDs {
+		if len(guids) == 0 {
+			delete(warmGUIDs, warmKey)
+		}
+		total += len(guids)
+	}
+	d.warmGUIDs = warmGUIDs
+	metrics.WarmPoolGUIDs.Set(float64(total))
+	log.Info().Msgf("warm pool holds %d guids of %d workload networks", total, len(warmGUIDs))
+}
+
+// getWarmPoolNetworkPKey returns the pkey of the network, looked up once per network in networkPKeys. It returns
+// false if the network isn't a managed ib-sriov network.
+func (d *daemon) getWarmPoolNetworkPKey(networkID string, networkPKeys map[string]string) (string, bool) {
+	if pKey, exist := networkPKeys[networkID]; exist {
+		return pKey, true
+	}
+
+	_, ibCniSpec, err := d.getIbSriovNetwork(networkID)
+	if err != nil {
+		log.Debug().Msgf("no warm guids for network %s: %v", networkID, err)
+		return "", false
+	}
+	networkPKeys[networkID] = ibCniSpec.PKey
+	return ibCniSpec.PKey, true
+}
+
+// reserveWarmGUIDs allocates count warm guids for the workload network and adds them to the network pkey.
+// It returns the reserved guids, the guids aren't kept if they can't be added to the pkey.
+func (d *daemon) reserveWarmGUIDs(warmKey utils.PodNetworkKey, owner plugins.GUIDOwner, pKey string,
+	count int) ([]string, error) {
+	reserved := make([]string, 0, count)
+	guidAddrs := make([]net.HardwareAddr, 0, count)
+	var err error
+	for range count {
+		var guidAddr guid.GUID
+		if guidAddr, err = d.guidPool.GenerateGUID(); err != nil {
+			break
+		}
+		if err = d.allocatePodNetworkGUID(guidAddr.String(), warmKey); err != nil {
+			break
+		}
+		reserved = append(reserved, guidAddr.String())
+		guidAddrs = append(guidAddrs, guidAddr.HardWareAddress())
+	}
+	if len(reserved) == 0 {
+		return nil, err
+	}
+
+	addErr := d.addWarmGUIDsToPKey(pKey, guidAddrs, owner)
+	if addErr == nil {
+		log.Info().Msgf("reserved %d warm guids of %s", len(reserved), warmKey)
+		return reserved, err
+	}
+	for _, reservedGUID := range reserved {
+		if releaseErr := d.releasePodNetworkGUID(reservedGUID); releaseErr != nil {
+			log.Warn().Msgf("failed to release warm guid %s: %v", reservedGUID, releaseErr)
+		}
+	}
+	return nil, addErr
+}
+
+// addWarmGUIDsToPKey adds the warm guids of the workload to the network pkey and to the default limited partition
+func (d *daemon) addWarmGUIDsToPKey(pKey string, guids []net.HardwareAddr, owner plugins.GUIDOwner) error {
+	if pKey != "" {
+		if err := d.addOwnedGUIDsToPKey(pKey, guids, guidOwners(guids, owner)); err != nil {
+			return err
+		}
+	}
+	return d.addGUIDsToLimitedPartition(pKey, guids)
+}
+
+// releaseWarmGUIDs removes the warm guids from the network pkey and releases them. It returns the guids kept
+// if they can't be removed from the pkey.
+func (d *daemon) releaseWarmGUIDs(warmKey utils.PodNetworkKey, pKey string, guids []string) ([]string, error) {
+	guidAddrs := make([]net.HardwareAddr, 0, len(guids))
+	for _, warmGUID := range guids {
+		guidAddr, err := net.ParseMAC(warmGUID)
+		if err != nil {
+			return guids, fmt.Errorf("failed to parse warm guid %s: %v", warmGUID, err)
+		}
+		guidAddrs = append(guidAddrs, guidAddr)
+	}
+
+	if pKey != "" {
+		if err := d.removeGUIDsFromPKey(pKey, guidAddrs); err != nil {
+			return guids, err
+		}
+	}
+	if err := d.removeGUIDsFromLimitedPartition(pKey, guidAddrs); err != nil {
+		return guids, err
+	}
+
+	var kept []string
+	for _, warmGUID := range guids {
+		if err := d.releasePodNetworkGUID(warmGUID); err != nil {
+			log.Warn().Msgf("failed to release warm guid %s: %v", warmGUID, err)
+			kept = append(kept, warmGUID)
+		}
+	}
+	log.Info().Msgf("released %d warm guids of %s", len(guids)-len(kept), warmKey)
+	return kept, nil
+}
+
+// parseWarmGUIDKey parses the workload network key of warm guids encoded by utils.PodNetworkKey.String
+func parseWarmGUIDKey(s string) (utils.PodNetworkKey, error) {
+	workloadUID, networkInterface, found := strings.Cut(s, "/")
+	if !found || workloadUID == "" {
+		return utils.PodNetworkKey{}, fmt.Errorf("invalid warm guid key %s", s)
+	}
+	networkID, iface, _ := strings.Cut(networkInterface, "/")
+	if _, err := ibTypes.ParseNetworkID(networkID); err != nil {
+		return utils.PodNetworkKey{}, fmt.Errorf("invalid warm guid key %s: %v", s, err)
+	}
+	return utils.PodNetworkKey{PodUID: types.UID(workloadUID), NetworkID: networkID, Interface: iface}, nil
+}
+
+// getWarmPoolConfigMapName returns the namespace and name of the config map the warm guids are tracked in
+func (d *daemon) getWarmPoolConfigMapName() (namespace, name string) {
+	namespace, name, _ = strings.Cut(d.config.WarmPoolConfigMap, "/")
+	return namespace, name
+}
+
+// initWarmGUIDs loads the warm guids from the config map and keeps them allocated for their workload networks,
+// so the warm guids of the workloads scaled down or deleted while the daemon was down, or before a leader change,
+// are removed from their pkeys by the next warm pool update. The config map is keyed by the guids as hex numbers,
+// as config map keys can't hold ":". It runs once the guids of the running pods are allocated, the warm guids
+// taken by pods are skipped, and before the stale pkey members are removed and the guid pool is synced with the
+// subnet manager, which would see the warm guids as stale members or guids in use.
+func (d *daemon) initWarmGUIDs() error {
+	if !d.config.WarmPool {
+		return nil
+	}
+
+	namespace, name := d.getWarmPoolConfigMapName()
+	configMap, err := d.kubeClient.GetConfigMap(namespace, name)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			log.Info().Msgf("warm guids config map %s/%s not found, starting with no warm guids", namespace, name)
+			return nil
+		}
+		return fmt.Errorf("failed to get warm guids config map %s/%s: %v", namespace, name, err)
+	}
+
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	d.savedWarmGUIDs = maps.Clone(configMap.Data)
+	d.warmGUIDs = make(map[utils.PodNetworkKey][]string)
+	hexGUIDs := make([]string, 0, len(configMap.Data))
+	for hexGUID := range configMap.Data {
+		hexGUIDs = append(hexGUIDs, hexGUID)
+	}
+	sort.Strings(hexGUIDs)
+	total := 0
+	for _, hexGUID := range hexGUIDs {
+		guidValue, err := strconv.ParseUint(hexGUID, 16, 64)
+		if err != nil {
+			log.Warn().Msgf("skipping invalid warm guid %s: %v", hexGUID, err)
+			continue
+		}
+		warmGUID := guid.GUID(guidValue).String()
+		warmKey, err := parseWarmGUIDKey(configMap.Data[hexGUID])
+		if err != nil {
+			log.Warn().Msgf("skipping warm guid %s: %v", warmGUID, err)
+			continue
+		}
+		if _, allocated := d.guidPodNetworkMap[warmGUID]; allocated {
+			continue
+		}
+		if err = d.guidPool.AllocateGUID(warmGUID); err != nil {
+			log.Warn().Msgf("failed to keep warm guid %s of %s: %v", warmGUID, warmKey, err)
+			continue
+		}
+		d.guidPodNetworkMap[warmGUID] = warmKey
+		d.warmGUIDs[warmKey] = append(d.warmGUIDs[warmKey], warmGUID)
+		total++
+	}
+	metrics.WarmPoolGUIDs.Set(float64(total))
+	log.Info().Msgf("loaded %d warm guids of %d workload networks", total, len(d.warmGUIDs))
+	return nil
+}
+
+// saveWarmGUIDs writes the warm guids to the config map if they changed since the last save, it's called with
+// poolMutex held
+func (d *daemon) saveWarmGUIDs() {
+	data := make(map[string]string)
+	for warmKey, guids := range d.warmGUIDs {
+		for _, warmGUID := range guids {
+			guidAddr, err := guid.ParseGUID(warmGUID)
+			if err != nil || d.guidPodNetworkMap[warmGUID] != warmKey {
+				continue
+			}
+			data[fmt.Sprintf("%016x", uint64(guidAddr))] = warmKey.String()
+		}
+	}
+	if maps.Equal(data, d.savedWarmGUIDs) {
+		return
+	}
+
+	namespace, name := d.getWarmPoolConfigMapName()
+	if err := d.writeConfigMapData(namespace, name, data); err != nil {
+		log.Warn().Msgf("failed to save warm guids to config map %s/%s, will retry: %v", namespace, name, err)
+		return
+	}
+	d.savedWarmGUIDs = data
+}
+
+// takeWarmGUID allocates a warm guid of the workload owning the pod for the pod network, it returns false if the
+// workload has no warm guid for the network. It's called with poolMutex held.
+func (d *daemon) takeWarmGUID(pod *utils.PodRef, key utils.PodNetworkKey) (string, bool) {
+	owner := pod.Controller
+	if owner == nil {
+		return "", false
+	}
+
+	warmKey := utils.PodNetworkKey{PodUID: owner.UID, NetworkID: key.NetworkID, Interface: key.Interface}
+	guids := d.warmGUIDs[warmKey]
+	for len(guids) != 0 {
+		warmGUID := guids[0]
+		guids = guids[1:]
+		// the guid may have been released since it was reserved, e.g. by draining the network
+		if d.guidPodNetworkMap[warmGUID] != warmKey {
+			continue
+		}
+
+		d.warmGUIDs[warmKey] = guids
+		d.guidPodNetworkMap[warmGUID] = key
+		metrics.WarmPoolGUIDs.Dec()
+		d.summary.guidAllocated()
+		d.notify(&webhook.Event{Type: webhook.GUIDAllocated, GUID: warmGUID, PodUID: string(key.PodUID),
+			NetworkID: key.NetworkID, Interface: key.Interface})
+		log.Debug().Msgf("allocated warm guid %s of %s for %s", warmGUID, warmKey, key)
+		return warmGUID, true
+	}
+	delete(d.warmGUIDs, warmKey)
+	return "", false
+}
@@ -0,0 +1,244 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+	appsv1 "k8s.io/api/apps/v1"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlFake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sClientFake "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/fake"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Warm Pool", func() {
+	const (
+		networkID      = "default_ib-net"
+		replicaSetUID  = types.UID("rs-uid")
+		networksAnnot  = `[{"name": "ib-net", "interface": "net1"}]`
+		guidPoolStart  = "02:00:00:00:00:00:00:00"
+		guidPoolEnd    = "02:00:00:00:00:00:00:FF"
+		networkPKey    = 0x5
+		networkPKeyStr = "0x5"
+	)
+
+	var (
+		smClient   *smMocks.SubnetManagerClient
+		d          *daemon
+		replicaSet *appsv1.ReplicaSet
+		warmKey    utils.PodNetworkKey
+	)
+
+	newReplicas := func(count int32) *int32 {
+		return &count
+	}
+	newPod := func(uid types.UID, ownerUID types.UID) *kapi.Pod {
+		controller := true
+		return &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: string(uid), Namespace: "default", UID: uid,
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "app",
+				UID: ownerUID, Controller: &controller}}}}
+	}
+	newPodKey := func(uid types.UID) utils.PodNetworkKey {
+		return utils.PodNetworkKey{PodUID: uid, NetworkID: networkID, Interface: "net1"}
+	}
+	reconcile := func(objects ...*kapi.Pod) {
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		builder := ctrlFake.NewClientBuilder().WithScheme(scheme)
+		if replicaSet != nil {
+			builder = builder.WithObjects(replicaSet)
+		}
+		for _, pod := range objects {
+			builder = builder.WithObjects(pod)
+		}
+		d.workloadReader = builder.Build()
+		d.WarmPoolPeriodicUpdate()
+	}
+
+	BeforeEach(func() {
+		guidPoolConfig := config.GUIDPoolConfig{RangeStart: guidPoolStart, RangeEnd: guidPoolEnd}
+		guidPool, err := guid.NewPool(&guidPoolConfig)
+		Expect(err).ToNot(HaveOccurred())
+
+		netAttDef := &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"cniVersion": "0.3.1", "type": "ib-sriov", "pkey": "0x5"}`}}
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("mock").Maybe()
+		smClient.On("GetPKeyMembers", mock.Anything, networkPKey).Return(nil, plugins.ErrNotSupported).Maybe()
+		d = &daemon{
+			config: config.DaemonConfig{GUIDPool: guidPoolConfig, WarmPool: true,
+				WarmPoolConfigMap: "kube-system/ib-kubernetes-warm-guids",
+				SMBackoff:         config.BackoffConfig{Duration: 1, Factor: 1, Steps: 1}},
+			kubeClient:        k8sClientFake.NewClient(netAttDef),
+			smClient:          smClient,
+			guidPool:          guidPool,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+		replicaSet = &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: replicaSetUID},
+			Spec: appsv1.ReplicaSetSpec{Replicas: newReplicas(3), Template: kapi.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+					"k8s.v1.cni.cncf.io/networks": networksAnnot}}}}}
+		warmKey = utils.PodNetworkKey{PodUID: replicaSetUID, NetworkID: networkID, Interface: "net1"}
+	})
+
+	It("Reserve guids for the expected replicas which pods weren't allocated guids", func() {
+		pod := newPod("pod-1", replicaSetUID)
+		Expect(d.allocatePodNetworkGUID("02:00:00:00:00:00:00:80", newPodKey(pod.UID))).To(Succeed())
+		smClient.On("AddGuidsToPKey", mock.Anything, networkPKey, mock.MatchedBy(func(guids []net.HardwareAddr) bool {
+			return len(guids) == 2
+		})).Return(nil).Once()
+
+		reconcile(pod)
+		Expect(d.warmGUIDs[warmKey]).To(HaveLen(2))
+		for _, warmGUID := range d.warmGUIDs[warmKey] {
+			Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(warmGUID, warmKey))
+		}
+		Expect(testutil.ToFloat64(metrics.WarmPoolGUIDs)).To(Equal(2.0))
+		smClient.AssertExpectations(GinkgoT())
+
+		// the pool is kept as is while the expected replicas don't change
+		reconcile(pod)
+		Expect(d.warmGUIDs[warmKey]).To(HaveLen(2))
+		smClient.AssertNumberOfCalls(GinkgoT(), "AddGuidsToPKey", 1)
+	})
+	It("Allocate a warm guid for a pod of the workload", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, networkPKey, mock.Anything).Return(nil).Once()
+		reconcile()
+		warmGUIDs := append([]string(nil), d.warmGUIDs[warmKey]...)
+		Expect(warmGUIDs).To(HaveLen(3))
+
+		pod := newPod("pod-1", replicaSetUID)
+		allocated, warm := d.takeWarmGUID(utils.NewPodRef(pod), newPodKey(pod.UID))
+		Expect(warm).To(BeTrue())
+		Expect(allocated).To(Equal(warmGUIDs[0]))
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(allocated, newPodKey(pod.UID)))
+		Expect(d.warmGUIDs[warmKey]).To(Equal(warmGUIDs[1:]))
+
+		other := newPod("pod-2", "other-uid")
+		_, warm = d.takeWarmGUID(utils.NewPodRef(other), newPodKey(other.UID))
+		Expect(warm).To(BeFalse())
+
+		// the pod allocated a warm guid is counted as an expected replica with a guid
+		reconcile(pod)
+		Expect(d.warmGUIDs[warmKey]).To(Equal(warmGUIDs[1:]))
+	})
+	It("Release the warm guids of a scaled down or deleted workload", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, networkPKey, mock.Anything).Return(nil).Once()
+		reconcile()
+		warmGUIDs := append([]string(nil), d.warmGUIDs[warmKey]...)
+
+		replicaSet.Spec.Replicas = newReplicas(1)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, networkPKey, mock.MatchedBy(
+			func(guids []net.HardwareAddr) bool { return len(guids) == 2 })).Return(nil).Once()
+		reconcile()
+		Expect(d.warmGUIDs[warmKey]).To(Equal(warmGUIDs[:1]))
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(warmGUIDs[2]))
+		Expect(d.guidPool.AllocateGUID(warmGUIDs[2])).To(Succeed())
+
+		replicaSet = nil
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, networkPKey, mock.MatchedBy(
+			func(guids []net.HardwareAddr) bool { return len(guids) == 1 })).Return(nil).Once()
+		reconcile()
+		Expect(d.warmGUIDs).To(BeEmpty())
+		Expect(d.guidPodNetworkMap).ToNot(HaveKey(warmGUIDs[0]))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Remove the warm guids of a workload deleted before a restart from their pkeys", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, networkPKey, mock.Anything).Return(nil).Once()
+		reconcile()
+		warmGUIDs := append([]string(nil), d.warmGUIDs[warmKey]...)
+		Expect(warmGUIDs).To(HaveLen(3))
+		configMap, err := d.kubeClient.GetConfigMap("kube-system", "ib-kubernetes-warm-guids")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configMap.Data).To(HaveLen(3))
+
+		// a warm guid taken by a running pod is kept allocated for the pod
+		pod := newPod("pod-1", replicaSetUID)
+		guidPool, err := guid.NewPool(&d.config.GUIDPool)
+		Expect(err).ToNot(HaveOccurred())
+		d.guidPool = guidPool
+		d.guidPodNetworkMap = make(map[string]utils.PodNetworkKey)
+		d.warmGUIDs = nil
+		d.savedWarmGUIDs = nil
+		Expect(d.allocatePodNetworkGUID(warmGUIDs[0], newPodKey(pod.UID))).To(Succeed())
+
+		Expect(d.initWarmGUIDs()).To(Succeed())
+		Expect(d.warmGUIDs).To(Equal(map[utils.PodNetworkKey][]string{warmKey: warmGUIDs[1:]}))
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(warmGUIDs[0], newPodKey(pod.UID)))
+		Expect(d.guidPodNetworkMap).To(HaveKeyWithValue(warmGUIDs[2], warmKey))
+
+		replicaSet = nil
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, networkPKey, mock.MatchedBy(
+			func(guids []net.HardwareAddr) bool { return len(guids) == 2 })).Return(nil).Once()
+		reconcile(pod)
+		Expect(d.warmGUIDs).To(BeEmpty())
+		configMap, err = d.kubeClient.GetConfigMap("kube-system", "ib-kubernetes-warm-guids")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configMap.Data).To(BeEmpty())
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Pass the workload as the owner of the warm guids to the subnet manager", func() {
+		smClient.On("AddGuidsToPKey", mock.MatchedBy(func(ctx context.Context) bool {
+			owners := plugins.GUIDOwnersFromContext(ctx)
+			for _, owner := range owners {
+				if owner.Kind != "ReplicaSet" || owner.Namespace != "default" || owner.Name != "app" ||
+					owner.Created.IsZero() {
+					return false
+				}
+			}
+			return len(owners) == 3
+		}), networkPKey, mock.Anything).Return(nil).Once()
+		reconcile()
+		Expect(d.warmGUIDs[warmKey]).To(HaveLen(3))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Release the reserved guids if they can't be added to the pkey", func() {
+		smClient.On("AddGuidsToPKey", mock.Anything, networkPKey, mock.Anything).
+			Return(errors.New("sm failure")).Once()
+		reconcile()
+		Expect(d.warmGUIDs).To(BeEmpty())
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+	})
+	It("Skip workloads of networks which aren't ib-sriov", func() {
+		replicaSet.Spec.Template.Annotations["k8s.v1.cni.cncf.io/networks"] = `[{"name": "other-net"}]`
+		reconcile()
+		Expect(d.warmGUIDs).To(BeEmpty())
+		smClient.AssertNotCalled(GinkgoT(), "AddGuidsToPKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+	It("Don't list statefulsets with stable guids", func() {
+		d.config.StatefulSetStableGUIDs = true
+		scheme, err := newScheme()
+		Expect(err).ToNot(HaveOccurred())
+		statefulSet := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", UID: "sts-uid"},
+			Spec:       appsv1.StatefulSetSpec{Template: replicaSet.Spec.Template}}
+		d.workloadReader = ctrlFake.NewClientBuilder().WithScheme(scheme).WithObjects(statefulSet).Build()
+
+		workloads, _, err := d.listWarmPoolWorkloads(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(workloads).To(BeEmpty())
+
+		d.config.StatefulSetStableGUIDs = false
+		workloads, _, err = d.listWarmPoolWorkloads(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(workloads).To(HaveLen(1))
+		Expect(workloads[0].replicas).To(Equal(1))
+	})
+})
@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// warmStandby keeps the guids of the running pods allocated while the replica isn't the leader, from the pod
+// informer cache which is synced by every replica, so a replica elected as leader skips listing the pods
+type warmStandby struct {
+	informer cache.Informer
+	d        *daemon
+}
+
+// NeedLeaderElection returns false, as the standby runs on the replicas waiting for leadership
+func (w *warmStandby) NeedLeaderElection() bool {
+	return false
+}
+
+// Start keeps the guid pool warm from the pod events until the replica is elected as leader or the context is done
+func (w *warmStandby) Start(ctx context.Context) error {
+	registration, err := w.informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*kapi.Pod); ok {
+				w.d.warmPodGUIDs(nil, pod)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, oldOk := oldObj.(*kapi.Pod)
+			newPod, newOk := newObj.(*kapi.Pod)
+			if oldOk && newOk {
+				w.d.warmPodGUIDs(oldPod, newPod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*kapi.Pod); ok {
+				w.d.warmPodGUIDs(pod, nil)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add warm standby pod event handler: %v", err)
+	}
+	//nolint:errcheck
+	defer w.informer.RemoveEventHandler(registration)
+
+	if !toolscache.WaitForCacheSync(ctx.Done(), registration.HasSynced) {
+		return nil
+	}
+	w.d.poolMutex.Lock()
+	if !w.d.leading {
+		w.d.standbyWarm = true
+		log.Info().Msgf("warm standby synced, %d guids of running pods allocated", len(w.d.guidPodNetworkMap))
+	}
+	w.d.poolMutex.Unlock()
+
+	<-ctx.Done()
+	return nil
+}
+
+// warmPodGUIDs allocates the guids of the pod networks configured with InfiniBand and releases the guids of the
+// networks the pod no longer has, oldPod is nil for an added pod and pod is nil for a deleted pod. The guids are
+// changed only in the pool, the subnet manager is updated by the leader. The instances of the configured pods are
+// recorded, so once the replica leads the pod reconciler tells their restarts from reschedules.
+func (d *daemon) warmPodGUIDs(oldPod, pod *kapi.Pod) {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	if d.leading {
+		return
+	}
+
+	current := configuredPodGUIDs(pod)
+	for podGUID, key := range configuredPodGUIDs(oldPod) {
+		if currentKey, exist := current[podGUID]; exist && currentKey == key {
+			continue
+		}
+		if allocatedKey, exist := d.guidPodNetworkMap[podGUID]; !exist || allocatedKey != key {
+			continue
+		}
+		if err := d.guidPool.ReleaseGUID(podGUID); err != nil {
+			log.Debug().Msgf("warm standby failed to release guid %s: %v", podGUID, err)
+			continue
+		}
+		delete(d.guidPodNetworkMap, podGUID)
+	}
+
+	for podGUID, key := range current {
+		if allocatedKey, exist := d.guidPodNetworkMap[podGUID]; exist {
+			if allocatedKey != key {
+				log.Debug().Msgf("warm standby skipping guid %s of %s, already allocated for %s", podGUID, key,
+					allocatedKey)
+			}
+			continue
+		}
+		if err := d.guidPool.AllocateGUID(podGUID); err != nil {
+			log.Debug().Msgf("warm standby failed to allocate guid %s: %v", podGUID, err)
+			continue
+		}
+		d.guidPodNetworkMap[podGUID] = key
+	}
+
+	switch {
+	case pod != nil && len(current) != 0:
+		d.recordPodInstance(pod)
+	case pod == nil && oldPod != nil:
+		d.forgetPodInstance(types.NamespacedName{Namespace: oldPod.Namespace, Name: oldPod.Name}, oldPod.UID)
+	}
+}
+
+// configuredPodGUIDs returns the guids of the pod networks configured with InfiniBand by the leader
+func configuredPodGUIDs(pod *kapi.Pod) map[string]utils.PodNetworkKey {
+	guids := make(map[string]utils.PodNetworkKey)
+	if pod == nil {
+		return guids
+	}
+	podRef := utils.NewPodRef(pod)
+	networks, err := utils.ParsePodNetworks(podRef)
+	if err != nil {
+		return guids
+	}
+	for _, network := range networks {
+		if !utils.IsPodNetworkConfiguredWithInfiniBand(podRef, network) {
+			continue
+		}
+		podGUIDs, err := utils.GetPodNetworkGUIDs(network)
+		if err != nil {
+			continue
+		}
+		for _, podGUID := range podGUIDs {
+			guids[podGUID] = utils.GeneratePodNetworkKey(podRef, network)
+		}
+	}
+	return guids
+}
+
+// startLeading marks the replica as leader, so the warm standby stops changing the pool. It returns true if the
+// pool was warmed by the standby, then the pods aren't listed again to init the pool.
+func (d *daemon) startLeading() bool {
+	d.poolMutex.Lock()
+	defer d.poolMutex.Unlock()
+	d.leading = true
+	return d.standbyWarm
+}
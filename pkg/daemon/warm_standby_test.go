@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/guid"
+	k8sMocks "github.com/Mellanox/ib-kubernetes/pkg/k8s-client/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+var _ = Describe("Warm Standby", func() {
+	const (
+		firstGUID  = "02:00:00:00:00:00:00:01"
+		secondGUID = "02:00:00:00:00:00:00:02"
+	)
+
+	var (
+		kubeClient *k8sMocks.Client
+		d          *daemon
+	)
+
+	newPod := func(guids ...string) *kapi.Pod {
+		networks := make([]string, 0, len(guids))
+		for i, podGUID := range guids {
+			networks = append(networks, fmt.Sprintf(`{"name":"ib-net-%d","namespace":"default",`+
+				`"cni-args":{"mellanox.infiniband.app":"configured","guid":%q}}`, i, podGUID))
+		}
+		return &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: types.UID("uid"),
+			Annotations: map[string]string{"k8s.v1.cni.cncf.io/networks": "[" + strings.Join(networks, ",") + "]"}}}
+	}
+
+	BeforeEach(func() {
+		guidPool, err := guid.NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+
+		kubeClient = &k8sMocks.Client{}
+		d = &daemon{
+			kubeClient:        kubeClient,
+			guidPool:          guidPool,
+			guidPodNetworkMap: make(map[string]utils.PodNetworkKey),
+		}
+	})
+
+	It("Keep the guids of the running pods allocated", func() {
+		pod := newPod(firstGUID, secondGUID)
+		d.warmPodGUIDs(nil, pod)
+		Expect(d.guidPodNetworkMap).To(HaveLen(2))
+		Expect(d.guidPool.Stats().Allocated).To(Equal(uint64(2)))
+
+		// network removed from the pod
+		updated := newPod(firstGUID)
+		d.warmPodGUIDs(pod, updated)
+		Expect(d.guidPodNetworkMap).To(HaveLen(1))
+		Expect(d.guidPodNetworkMap).To(HaveKey(firstGUID))
+
+		d.warmPodGUIDs(updated, nil)
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+		Expect(d.guidPool.Stats().Allocated).To(Equal(uint64(0)))
+	})
+	It("Stop changing the pool once leading", func() {
+		d.standbyWarm = true
+		Expect(d.startLeading()).To(BeTrue())
+
+		d.warmPodGUIDs(nil, newPod(firstGUID))
+		Expect(d.guidPodNetworkMap).To(BeEmpty())
+	})
+	It("Skip listing the pods to init the pool warmed by the standby", func() {
+		d.warmPodGUIDs(nil, newPod(firstGUID))
+		d.standbyWarm = true
+
+		Expect(d.initPool()).To(Succeed())
+		kubeClient.AssertNotCalled(GinkgoT(), "GetPodsPage")
+		Expect(d.guidPodNetworkMap).To(HaveKey(firstGUID))
+	})
+})
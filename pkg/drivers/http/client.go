@@ -5,16 +5,40 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/tracing"
 )
 
+// Client sends http requests, the requests are canceled when their context is done
 type Client interface {
-	Get(url string, expectedStatusCode int) ([]byte, error)
-	Post(url string, expectedStatusCode int, body []byte) ([]byte, error)
+	Get(ctx context.Context, url string, expectedStatusCode int) ([]byte, error)
+	Post(ctx context.Context, url string, expectedStatusCode int, body []byte) ([]byte, error)
+	Delete(ctx context.Context, url string, expectedStatusCode int) ([]byte, error)
+}
+
+// StatusError is returned when the server responds with a status code other than the expected one
+type StatusError struct {
+	Code         int
+	ExpectedCode int
+	Body         string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("failed request with status code %v, expected status code %v: %v", e.Code, e.ExpectedCode,
+		e.Body)
+}
+
+// IsStatusCode returns true if err is a StatusError with the given status code
+func IsStatusCode(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == code
 }
 
 type BasicAuth struct {
@@ -22,40 +46,72 @@ type BasicAuth struct {
 	Password string
 }
 
+// DialContextFunc dials the connections of the client, e.g through a local tunnel or a socket proxy
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// ClientOption customizes the transport of the client
+type ClientOption func(transport *http.Transport)
+
+// WithDialer dials the connections of the client with the given dialer instead of connecting the url host
+func WithDialer(dial DialContextFunc) ClientOption {
+	return func(transport *http.Transport) {
+		transport.DialContext = dial
+	}
+}
+
+// WithUnixSocket dials the unix domain socket at the given path for every request, the request url
+// is kept as is, its host is used only for the Host header and the TLS server name
+func WithUnixSocket(socketPath string) ClientOption {
+	return WithDialer(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", socketPath)
+	})
+}
+
 type client struct {
 	basicAuth  *BasicAuth
 	httpClient *http.Client
 }
 
-func NewClient(isSecure bool, basicAuth *BasicAuth, cert string) (Client, error) {
+func NewClient(isSecure bool, basicAuth *BasicAuth, cert string, opts ...ClientOption) (Client, error) {
 	log.Debug().Msgf("creating http client, isSecure %v, basicAuth %+v, cert %s", isSecure, basicAuth, cert)
 	if basicAuth == nil {
 		return nil, fmt.Errorf("invalid basicAuth value %v", basicAuth)
 	}
-	httpClient := &http.Client{Transport: http.DefaultTransport}
+	// the default transport is cloned, so options of one client don't affect the others
+	transport := http.DefaultTransport.(*http.Transport).Clone()
 	if isSecure {
 		if cert == "" {
 			//nolint:gosec
-			httpClient.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 		} else {
 			caCertPool := x509.NewCertPool()
 			caCertPool.AppendCertsFromPEM([]byte(cert))
 			//nolint:gosec
-			httpClient.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: caCertPool}
+			transport.TLSClientConfig = &tls.Config{RootCAs: caCertPool}
 		}
 	}
+	for _, opt := range opts {
+		opt(transport)
+	}
 
+	httpClient := &http.Client{Transport: tracing.WrapTransport(transport)}
 	return &client{basicAuth: basicAuth, httpClient: httpClient}, nil
 }
 
-func (c *client) Get(url string, expectedStatusCode int) ([]byte, error) {
+func (c *client) Get(ctx context.Context, url string, expectedStatusCode int) ([]byte, error) {
 	log.Debug().Msgf("Http client GET: url %s, expectedStatusCode %v", url, expectedStatusCode)
-	return c.executeRequest(http.MethodGet, url, expectedStatusCode, nil)
+	return c.executeRequest(ctx, http.MethodGet, url, expectedStatusCode, nil)
 }
 
-func (c *client) Post(url string, expectedStatusCode int, body []byte) ([]byte, error) {
+func (c *client) Post(ctx context.Context, url string, expectedStatusCode int, body []byte) ([]byte, error) {
 	log.Debug().Msgf("Http client POST: url %s, expectedStatusCode %v, body %s", url, expectedStatusCode, string(body))
-	return c.executeRequest(http.MethodPost, url, expectedStatusCode, body)
+	return c.executeRequest(ctx, http.MethodPost, url, expectedStatusCode, body)
+}
+
+func (c *client) Delete(ctx context.Context, url string, expectedStatusCode int) ([]byte, error) {
+	log.Debug().Msgf("Http client DELETE: url %s, expectedStatusCode %v", url, expectedStatusCode)
+	return c.executeRequest(ctx, http.MethodDelete, url, expectedStatusCode, nil)
 }
 
 func (c *client) createRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
@@ -70,8 +126,9 @@ func (c *client) createRequest(ctx context.Context, method, url string, body io.
 	return req, nil
 }
 
-func (c *client) executeRequest(method, url string, expectedStatusCode int, body []byte) ([]byte, error) {
-	req, err := c.createRequest(context.TODO(), method, url, bytes.NewBuffer(body))
+func (c *client) executeRequest(ctx context.Context, method, url string, expectedStatusCode int, body []byte) (
+	[]byte, error) {
+	req, err := c.createRequest(ctx, method, url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
@@ -83,8 +140,8 @@ func (c *client) executeRequest(method, url string, expectedStatusCode int, body
 	defer resp.Body.Close()
 	responseBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != expectedStatusCode {
-		return responseBody, fmt.Errorf("failed request with status code %v, expected status code %v: %v",
-			resp.StatusCode, expectedStatusCode, string(responseBody))
+		return responseBody, &StatusError{Code: resp.StatusCode, ExpectedCode: expectedStatusCode,
+			Body: string(responseBody)}
 	}
 
 	return responseBody, nil
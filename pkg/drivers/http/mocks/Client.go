@@ -2,20 +2,47 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // Client is an autogenerated mock type for the Client type
 type Client struct {
 	mock.Mock
 }
 
-// Get provides a mock function with given fields: url, expectedStatusCode
-func (_m *Client) Get(url string, expectedStatusCode int) ([]byte, error) {
-	ret := _m.Called(url, expectedStatusCode)
+// Delete provides a mock function with given fields: ctx, url, expectedStatusCode
+func (_m *Client) Delete(ctx context.Context, url string, expectedStatusCode int) ([]byte, error) {
+	ret := _m.Called(ctx, url, expectedStatusCode)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []byte); ok {
+		r0 = rf(ctx, url, expectedStatusCode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, url, expectedStatusCode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Get provides a mock function with given fields: ctx, url, expectedStatusCode
+func (_m *Client) Get(ctx context.Context, url string, expectedStatusCode int) ([]byte, error) {
+	ret := _m.Called(ctx, url, expectedStatusCode)
 
 	var r0 []byte
-	if rf, ok := ret.Get(0).(func(string, int) []byte); ok {
-		r0 = rf(url, expectedStatusCode)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) []byte); ok {
+		r0 = rf(ctx, url, expectedStatusCode)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]byte)
@@ -23,8 +50,8 @@ func (_m *Client) Get(url string, expectedStatusCode int) ([]byte, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, int) error); ok {
-		r1 = rf(url, expectedStatusCode)
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, url, expectedStatusCode)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -32,13 +59,13 @@ func (_m *Client) Get(url string, expectedStatusCode int) ([]byte, error) {
 	return r0, r1
 }
 
-// Post provides a mock function with given fields: url, expectedStatusCode, body
-func (_m *Client) Post(url string, expectedStatusCode int, body []byte) ([]byte, error) {
-	ret := _m.Called(url, expectedStatusCode, body)
+// Post provides a mock function with given fields: ctx, url, expectedStatusCode, body
+func (_m *Client) Post(ctx context.Context, url string, expectedStatusCode int, body []byte) ([]byte, error) {
+	ret := _m.Called(ctx, url, expectedStatusCode, body)
 
 	var r0 []byte
-	if rf, ok := ret.Get(0).(func(string, int, []byte) []byte); ok {
-		r0 = rf(url, expectedStatusCode, body)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int, []byte) []byte); ok {
+		r0 = rf(ctx, url, expectedStatusCode, body)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]byte)
@@ -46,8 +73,8 @@ func (_m *Client) Post(url string, expectedStatusCode int, body []byte) ([]byte,
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string, int, []byte) error); ok {
-		r1 = rf(url, expectedStatusCode, body)
+	if rf, ok := ret.Get(1).(func(context.Context, string, int, []byte) error); ok {
+		r1 = rf(ctx, url, expectedStatusCode, body)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,185 @@
+package guid
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrGUIDClaimed is returned when allocating a guid allocated by another cluster sharing the guid range
+var ErrGUIDClaimed = errors.New("guid is allocated by another cluster")
+
+// Coordinator records the guids allocated by the clusters sharing a guid range
+type Coordinator interface {
+	// Claim records the guid as allocated by this cluster, it returns ErrGUIDClaimed if the guid is allocated
+	// by another cluster. Claiming a guid already claimed by this cluster succeeds.
+	Claim(guid GUID) error
+
+	// Release removes the claim of this cluster on the guid
+	Release(guid GUID) error
+
+	// List returns the claimed guids mapped to the cluster which claimed them
+	List() (map[GUID]string, error)
+}
+
+// ClaimLister is implemented by the guid pools coordinating their allocations with other clusters
+type ClaimLister interface {
+	// OtherClaims returns the guids claimed by the other clusters sharing the guid range, mapped to the cluster
+	// which claimed them
+	OtherClaims() (map[GUID]string, error)
+}
+
+// coordinatedPool is a guid pool which allocations are claimed in a coordination backend before they are
+// finalized, so clusters sharing the guid range don't allocate the same guids
+type coordinatedPool struct {
+	Pool
+	coordinator Coordinator
+	clusterID   string
+	// claimed guids of this cluster
+	claimed map[GUID]bool
+}
+
+func newCoordinatedPool(pool Pool, coordinator Coordinator, clusterID string) Pool {
+	return &coordinatedPool{Pool: pool, coordinator: coordinator, clusterID: clusterID, claimed: make(map[GUID]bool)}
+}
+
+// AllocateGUID claims the guid in the coordination backend and allocates it. A guid claimed by another
+// cluster is marked as allocated, so it isn't generated again.
+func (p *coordinatedPool) AllocateGUID(guid string) error {
+	guidAddr, err := ParseGUID(guid)
+	if err != nil {
+		return err
+	}
+
+	if err = p.coordinator.Claim(guidAddr); err != nil {
+		if errors.Is(err, ErrGUIDClaimed) {
+			if allocateErr := p.Pool.AllocateGUID(guid); allocateErr != nil {
+				log.Debug().Msgf("guid %s claimed by another cluster: %v", guid, allocateErr)
+			}
+		}
+		return fmt.Errorf("failed to claim guid %s: %w", guid, err)
+	}
+
+	if err = p.Pool.AllocateGUID(guid); err != nil {
+		// keep the claims of guids which were already allocated by this cluster
+		if !p.claimed[guidAddr] {
+			p.releaseClaim(guidAddr)
+		}
+		return err
+	}
+	p.claimed[guidAddr] = true
+	return nil
+}
+
+// ReleaseGUID releases the guid and its claim, failures to release the claim are logged as the guid is free
+// in this cluster and is claimed again when allocated
+func (p *coordinatedPool) ReleaseGUID(guid string) error {
+	guidAddr, err := ParseGUID(guid)
+	if err != nil {
+		return err
+	}
+	if err = p.Pool.ReleaseGUID(guid); err != nil {
+		return err
+	}
+
+	if p.claimed[guidAddr] {
+		delete(p.claimed, guidAddr)
+		p.releaseClaim(guidAddr)
+	}
+	return nil
+}
+
+// GenerateGUID generates a free guid and claims it in the coordination backend. The guids claimed by another
+// cluster are marked as allocated and the next free guid is generated.
+func (p *coordinatedPool) GenerateGUID() (GUID, error) {
+	return p.generateClaimedGUID(p.Pool.GenerateGUID)
+}
+
+// GenerateGUIDInRange generates a free guid of the sub-range and claims it in the coordination backend, as
+// GenerateGUID
+func (p *coordinatedPool) GenerateGUIDInRange(guidRange Range) (GUID, error) {
+	return p.generateClaimedGUID(func() (GUID, error) {
+		return p.Pool.GenerateGUIDInRange(guidRange)
+	})
+}
+
+// generateClaimedGUID generates guids until one is claimed by this cluster. Claims of generated guids which are
+// never allocated are released by the next Reset.
+func (p *coordinatedPool) generateClaimedGUID(generate func() (GUID, error)) (GUID, error) {
+	for {
+		guidAddr, err := generate()
+		if err != nil {
+			return 0, err
+		}
+		err = p.coordinator.Claim(guidAddr)
+		if err == nil {
+			return guidAddr, nil
+		}
+		if !errors.Is(err, ErrGUIDClaimed) {
+			return 0, fmt.Errorf("failed to claim guid %s: %w", guidAddr, err)
+		}
+		// the guid claimed by another cluster isn't generated again
+		if err = p.Pool.AllocateGUID(guidAddr.String()); err != nil {
+			return 0, err
+		}
+		log.Debug().Msgf("generated guid %s is claimed by another cluster, generating another guid", guidAddr)
+	}
+}
+
+// Reset resets the pool with the given guids and the guids claimed by the other clusters. The claims of this
+// cluster on guids which aren't given are released, as they aren't allocated anymore.
+func (p *coordinatedPool) Reset(guids []string) error {
+	claims, err := p.coordinator.List()
+	if err != nil {
+		return fmt.Errorf("failed to list claimed guids: %v", err)
+	}
+	if err = p.Pool.Reset(guids); err != nil {
+		return err
+	}
+
+	allocated := make(map[GUID]bool, len(guids))
+	for _, guid := range guids {
+		// the guids were parsed by the pool reset
+		guidAddr, _ := ParseGUID(guid)
+		allocated[guidAddr] = true
+	}
+
+	p.claimed = make(map[GUID]bool)
+	for guidAddr, owner := range claims {
+		if owner == p.clusterID {
+			if !allocated[guidAddr] {
+				log.Info().Msgf("releasing stale claim of guid %s", guidAddr)
+				p.releaseClaim(guidAddr)
+				continue
+			}
+			p.claimed[guidAddr] = true
+			continue
+		}
+		// claims of guids out of the range or already in use are skipped
+		if err = p.Pool.AllocateGUID(guidAddr.String()); err != nil {
+			log.Debug().Msgf("skipping guid %s claimed by cluster %s: %v", guidAddr, owner, err)
+		}
+	}
+	return nil
+}
+
+// OtherClaims returns the guids claimed by the other clusters in the coordination backend
+func (p *coordinatedPool) OtherClaims() (map[GUID]string, error) {
+	claims, err := p.coordinator.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list claimed guids: %v", err)
+	}
+	for guidAddr, owner := range claims {
+		if owner == p.clusterID {
+			delete(claims, guidAddr)
+		}
+	}
+	return claims, nil
+}
+
+func (p *coordinatedPool) releaseClaim(guidAddr GUID) {
+	if err := p.coordinator.Release(guidAddr); err != nil {
+		log.Warn().Msgf("failed to release claim of guid %s: %v", guidAddr, err)
+	}
+}
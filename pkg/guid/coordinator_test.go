@@ -0,0 +1,143 @@
+package guid
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+)
+
+// fakeCoordinator records the claims in memory
+type fakeCoordinator struct {
+	clusterID string
+	claims    map[GUID]string
+	err       error
+}
+
+func (f *fakeCoordinator) Claim(guid GUID) error {
+	if f.err != nil {
+		return f.err
+	}
+	if owner, exist := f.claims[guid]; exist && owner != f.clusterID {
+		return ErrGUIDClaimed
+	}
+	f.claims[guid] = f.clusterID
+	return nil
+}
+
+func (f *fakeCoordinator) Release(guid GUID) error {
+	if f.claims[guid] == f.clusterID {
+		delete(f.claims, guid)
+	}
+	return nil
+}
+
+func (f *fakeCoordinator) List() (map[GUID]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	claims := make(map[GUID]string, len(f.claims))
+	for guid, owner := range f.claims {
+		claims[guid] = owner
+	}
+	return claims, nil
+}
+
+var _ = Describe("Coordinated GUID Pool", func() {
+	var (
+		coordinator *fakeCoordinator
+		pool        Pool
+	)
+
+	BeforeEach(func() {
+		conf := &config.GUIDPoolConfig{RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:03"}
+		basePool, err := NewPool(conf)
+		Expect(err).ToNot(HaveOccurred())
+		coordinator = &fakeCoordinator{clusterID: "cluster-a", claims: make(map[GUID]string)}
+		pool = newCoordinatedPool(basePool, coordinator, "cluster-a")
+	})
+
+	It("Claim allocated guids and release them", func() {
+		Expect(pool.AllocateGUID("02:00:00:00:00:00:00:00")).To(Succeed())
+		Expect(coordinator.claims).To(HaveKeyWithValue(GUID(0x0200000000000000), "cluster-a"))
+
+		Expect(pool.ReleaseGUID("02:00:00:00:00:00:00:00")).To(Succeed())
+		Expect(coordinator.claims).To(BeEmpty())
+	})
+	It("Reject guid allocated by another cluster and don't generate it again", func() {
+		coordinator.claims[0x0200000000000000] = "cluster-b"
+
+		err := pool.AllocateGUID("02:00:00:00:00:00:00:00")
+		Expect(errors.Is(err, ErrGUIDClaimed)).To(BeTrue())
+
+		guid, err := pool.GenerateGUID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(guid.String()).To(Equal("02:00:00:00:00:00:00:01"))
+	})
+	It("Keep the claim of a guid already allocated by this cluster", func() {
+		Expect(pool.AllocateGUID("02:00:00:00:00:00:00:00")).To(Succeed())
+		Expect(pool.AllocateGUID("02:00:00:00:00:00:00:00")).ToNot(Succeed())
+		Expect(coordinator.claims).To(HaveKey(GUID(0x0200000000000000)))
+	})
+	It("Release the claim of a guid which allocation failed", func() {
+		Expect(pool.Reset([]string{"02:00:00:00:00:00:00:01"})).To(Succeed())
+
+		Expect(pool.AllocateGUID("02:00:00:00:00:00:00:01")).ToNot(Succeed())
+		Expect(coordinator.claims).To(BeEmpty())
+	})
+	It("Fail allocation if the coordination backend is unavailable", func() {
+		coordinator.err = errors.New("unavailable")
+		Expect(pool.AllocateGUID("02:00:00:00:00:00:00:00")).ToNot(Succeed())
+		Expect(pool.Reset(nil)).ToNot(Succeed())
+	})
+	It("Reset allocates the guids claimed by other clusters", func() {
+		coordinator.claims[0x0200000000000000] = "cluster-b"
+		coordinator.claims[0x0200000000000001] = "cluster-a"
+		// out of range claims are ignored
+		coordinator.claims[0x0300000000000000] = "cluster-b"
+
+		coordinator.claims[0x0200000000000002] = "cluster-a"
+
+		Expect(pool.Reset([]string{"02:00:00:00:00:00:00:02"})).To(Succeed())
+		Expect(pool.Stats().Allocated).To(Equal(uint64(2)))
+		// the stale claim of this cluster is released, the claim of the allocated guid is kept
+		Expect(coordinator.claims).ToNot(HaveKey(GUID(0x0200000000000001)))
+		Expect(coordinator.claims).To(HaveKeyWithValue(GUID(0x0200000000000002), "cluster-a"))
+		Expect(pool.ReleaseGUID("02:00:00:00:00:00:00:02")).To(Succeed())
+		Expect(coordinator.claims).ToNot(HaveKey(GUID(0x0200000000000002)))
+	})
+	It("Generate the next free guid when the generated guid is claimed by another cluster", func() {
+		coordinator.claims[0x0200000000000000] = "cluster-b"
+		coordinator.claims[0x0200000000000001] = "cluster-b"
+
+		guid, err := pool.GenerateGUID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(guid.String()).To(Equal("02:00:00:00:00:00:00:02"))
+		Expect(coordinator.claims).To(HaveKeyWithValue(guid, "cluster-a"))
+		Expect(pool.AllocateGUID(guid.String())).To(Succeed())
+
+		coordinator.claims[0x0200000000000003] = "cluster-b"
+		_, err = pool.GenerateGUID()
+		Expect(err).To(MatchError(ErrGUIDPoolExhausted))
+
+		coordinator.err = errors.New("unavailable")
+		Expect(pool.ReleaseGUID(guid.String())).To(Succeed())
+		_, err = pool.GenerateGUID()
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrGUIDPoolExhausted)).To(BeFalse())
+	})
+	It("List the guids claimed by the other clusters", func() {
+		coordinator.claims[0x0200000000000001] = "cluster-b"
+		Expect(pool.AllocateGUID("02:00:00:00:00:00:00:02")).To(Succeed())
+
+		claims, err := pool.(ClaimLister).OtherClaims()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claims).To(Equal(map[GUID]string{0x0200000000000001: "cluster-b"}))
+
+		coordinator.err = errors.New("unavailable")
+		_, err = pool.(ClaimLister).OtherClaims()
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,232 @@
+package guid
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/tracing"
+)
+
+const (
+	// etcdRequestTimeout limits the time of a request to an etcd endpoint
+	etcdRequestTimeout = 10 * time.Second
+	// etcdListPageSize is the number of claims read per etcd range request
+	etcdListPageSize = 1000
+)
+
+// etcdCoordinator records the guids claimed by each cluster as keys of an etcd prefix, the value of a key is
+// the cluster which claimed the guid. It uses the etcd v3 JSON gateway, so no etcd client is required.
+type etcdCoordinator struct {
+	endpoints  []string
+	prefix     string
+	clusterID  string
+	httpClient *http.Client
+}
+
+type etcdKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type etcdRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+	Limit    int64  `json:"limit,omitempty"`
+}
+
+type etcdRangeResponse struct {
+	Kvs  []etcdKeyValue `json:"kvs"`
+	More bool           `json:"more"`
+}
+
+type etcdCompare struct {
+	Key    []byte `json:"key"`
+	Result string `json:"result"`
+	Target string `json:"target"`
+	// CreateRevision is a string, as the zero revision must not be omitted
+	CreateRevision string `json:"create_revision,omitempty"`
+	Value          []byte `json:"value,omitempty"`
+}
+
+type etcdRequestOp struct {
+	RequestPut         *etcdKeyValue     `json:"request_put,omitempty"`
+	RequestRange       *etcdRangeRequest `json:"request_range,omitempty"`
+	RequestDeleteRange *etcdRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+type etcdTxnRequest struct {
+	Compare []etcdCompare   `json:"compare"`
+	Success []etcdRequestOp `json:"success"`
+	Failure []etcdRequestOp `json:"failure,omitempty"`
+}
+
+type etcdResponseOp struct {
+	ResponseRange *etcdRangeResponse `json:"response_range,omitempty"`
+}
+
+type etcdTxnResponse struct {
+	Succeeded bool             `json:"succeeded"`
+	Responses []etcdResponseOp `json:"responses"`
+}
+
+func newEtcdCoordinator(conf *config.GUIDPoolConfig) (Coordinator, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if conf.EtcdCAFile != "" || conf.EtcdCertFile != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if conf.EtcdCAFile != "" {
+			caCert, err := os.ReadFile(conf.EtcdCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read etcd CA file %s: %v", conf.EtcdCAFile, err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+				return nil, fmt.Errorf("no certificate found in etcd CA file %s", conf.EtcdCAFile)
+			}
+		}
+		if conf.EtcdCertFile != "" {
+			cert, err := tls.LoadX509KeyPair(conf.EtcdCertFile, conf.EtcdKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load etcd client certificate: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	endpoints := make([]string, 0, len(conf.EtcdEndpoints))
+	for _, endpoint := range conf.EtcdEndpoints {
+		endpoints = append(endpoints, strings.TrimSuffix(strings.TrimSpace(endpoint), "/"))
+	}
+	return &etcdCoordinator{
+		endpoints: endpoints,
+		prefix:    conf.EtcdPrefix,
+		clusterID: conf.ClusterID,
+		httpClient: &http.Client{Transport: tracing.WrapTransport(transport),
+			Timeout: etcdRequestTimeout},
+	}, nil
+}
+
+// Claim creates the key of the guid if it doesn't exist, an existing key must be owned by this cluster
+func (c *etcdCoordinator) Claim(guid GUID) error {
+	key := c.key(guid)
+	request := &etcdTxnRequest{
+		Compare: []etcdCompare{{Key: key, Result: "EQUAL", Target: "CREATE", CreateRevision: "0"}},
+		Success: []etcdRequestOp{{RequestPut: &etcdKeyValue{Key: key, Value: []byte(c.clusterID)}}},
+		Failure: []etcdRequestOp{{RequestRange: &etcdRangeRequest{Key: key}}},
+	}
+	response := &etcdTxnResponse{}
+	if err := c.post("/v3/kv/txn", request, response); err != nil {
+		return err
+	}
+	if response.Succeeded {
+		return nil
+	}
+
+	owner := ""
+	if len(response.Responses) > 0 && response.Responses[0].ResponseRange != nil &&
+		len(response.Responses[0].ResponseRange.Kvs) > 0 {
+		owner = string(response.Responses[0].ResponseRange.Kvs[0].Value)
+	}
+	if owner == c.clusterID {
+		return nil
+	}
+	return fmt.Errorf("%w %s", ErrGUIDClaimed, owner)
+}
+
+// Release deletes the key of the guid if it is owned by this cluster
+func (c *etcdCoordinator) Release(guid GUID) error {
+	key := c.key(guid)
+	request := &etcdTxnRequest{
+		Compare: []etcdCompare{{Key: key, Result: "EQUAL", Target: "VALUE", Value: []byte(c.clusterID)}},
+		Success: []etcdRequestOp{{RequestDeleteRange: &etcdRangeRequest{Key: key}}},
+	}
+	return c.post("/v3/kv/txn", request, &etcdTxnResponse{})
+}
+
+// List reads the keys of the prefix page by page
+func (c *etcdCoordinator) List() (map[GUID]string, error) {
+	claims := make(map[GUID]string)
+	rangeEnd := prefixRangeEnd([]byte(c.prefix))
+	key := []byte(c.prefix)
+	for {
+		response := &etcdRangeResponse{}
+		if err := c.post("/v3/kv/range", &etcdRangeRequest{Key: key, RangeEnd: rangeEnd, Limit: etcdListPageSize},
+			response); err != nil {
+			return nil, err
+		}
+		for _, kv := range response.Kvs {
+			guidAddr, err := ParseGUID(strings.TrimPrefix(string(kv.Key), c.prefix))
+			if err != nil {
+				log.Warn().Msgf("skipping invalid guid key %s in etcd: %v", string(kv.Key), err)
+				continue
+			}
+			claims[guidAddr] = string(kv.Value)
+		}
+		if !response.More || len(response.Kvs) == 0 {
+			return claims, nil
+		}
+		// continue after the last key of the page
+		key = append(response.Kvs[len(response.Kvs)-1].Key, 0)
+	}
+}
+
+func (c *etcdCoordinator) key(guid GUID) []byte {
+	return []byte(c.prefix + guid.String())
+}
+
+// post sends the request to the etcd endpoints in order until one of them responds
+func (c *etcdCoordinator) post(path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, endpoint := range c.endpoints {
+		var resp *http.Response
+		resp, err = c.httpClient.Post(endpoint+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Debug().Msgf("etcd endpoint %s failed: %v", endpoint, err)
+			lastErr = err
+			continue
+		}
+		responseBody, readErr := io.ReadAll(resp.Body)
+		//nolint:errcheck
+		resp.Body.Close()
+		if readErr != nil {
+			lastErr = readErr
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("etcd request %s failed with status code %d: %s", path, resp.StatusCode,
+				string(responseBody))
+		}
+		return json.Unmarshal(responseBody, response)
+	}
+	return fmt.Errorf("no etcd endpoint available: %v", lastErr)
+}
+
+// prefixRangeEnd returns the end of the range of the keys with the given prefix
+func prefixRangeEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// the prefix is all 0xff, the range ends at the last key
+	return []byte{0}
+}
@@ -0,0 +1,158 @@
+package guid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+)
+
+// fakeEtcd implements the subset of the etcd v3 JSON gateway used by the etcd coordinator
+type fakeEtcd struct {
+	mutex sync.Mutex
+	kvs   map[string][]byte
+}
+
+func (f *fakeEtcd) rangeKeys(request *etcdRangeRequest) *etcdRangeResponse {
+	var keys []string
+	for key := range f.kvs {
+		if (request.RangeEnd == nil && key == string(request.Key)) || (request.RangeEnd != nil &&
+			key >= string(request.Key) && key < string(request.RangeEnd)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	response := &etcdRangeResponse{}
+	for _, key := range keys {
+		if request.Limit > 0 && int64(len(response.Kvs)) == request.Limit {
+			response.More = true
+			break
+		}
+		response.Kvs = append(response.Kvs, etcdKeyValue{Key: []byte(key), Value: f.kvs[key]})
+	}
+	return response
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var response interface{}
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		request := &etcdRangeRequest{}
+		Expect(json.NewDecoder(r.Body).Decode(request)).To(Succeed())
+		response = f.rangeKeys(request)
+	case "/v3/kv/txn":
+		request := &etcdTxnRequest{}
+		Expect(json.NewDecoder(r.Body).Decode(request)).To(Succeed())
+		compare := request.Compare[0]
+		value, exist := f.kvs[string(compare.Key)]
+		succeeded := (compare.Target == "CREATE" && !exist) ||
+			(compare.Target == "VALUE" && exist && bytes.Equal(value, compare.Value))
+		ops := request.Failure
+		if succeeded {
+			ops = request.Success
+		}
+		txnResponse := &etcdTxnResponse{Succeeded: succeeded}
+		for _, op := range ops {
+			switch {
+			case op.RequestPut != nil:
+				f.kvs[string(op.RequestPut.Key)] = op.RequestPut.Value
+				txnResponse.Responses = append(txnResponse.Responses, etcdResponseOp{})
+			case op.RequestDeleteRange != nil:
+				delete(f.kvs, string(op.RequestDeleteRange.Key))
+				txnResponse.Responses = append(txnResponse.Responses, etcdResponseOp{})
+			case op.RequestRange != nil:
+				txnResponse.Responses = append(txnResponse.Responses,
+					etcdResponseOp{ResponseRange: f.rangeKeys(op.RequestRange)})
+			}
+		}
+		response = txnResponse
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	Expect(json.NewEncoder(w).Encode(response)).To(Succeed())
+}
+
+var _ = Describe("Etcd Coordinator", func() {
+	var (
+		etcd   *fakeEtcd
+		server *httptest.Server
+	)
+
+	newCoordinator := func(clusterID string, endpoints ...string) Coordinator {
+		coordinator, err := newEtcdCoordinator(&config.GUIDPoolConfig{ClusterID: clusterID,
+			EtcdEndpoints: endpoints, EtcdPrefix: "/ib-kubernetes/guids/"})
+		Expect(err).ToNot(HaveOccurred())
+		return coordinator
+	}
+
+	BeforeEach(func() {
+		etcd = &fakeEtcd{kvs: make(map[string][]byte)}
+		server = httptest.NewServer(etcd)
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Claim guids once across clusters", func() {
+		clusterA := newCoordinator("cluster-a", server.URL)
+		clusterB := newCoordinator("cluster-b", server.URL)
+
+		Expect(clusterA.Claim(0x0200000000000001)).To(Succeed())
+		Expect(etcd.kvs).To(HaveKeyWithValue("/ib-kubernetes/guids/02:00:00:00:00:00:00:01", []byte("cluster-a")))
+		// claiming again by the owner succeeds
+		Expect(clusterA.Claim(0x0200000000000001)).To(Succeed())
+
+		err := clusterB.Claim(0x0200000000000001)
+		Expect(errors.Is(err, ErrGUIDClaimed)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("cluster-a"))
+
+		// only the owner releases the claim
+		Expect(clusterB.Release(0x0200000000000001)).To(Succeed())
+		Expect(etcd.kvs).To(HaveLen(1))
+		Expect(clusterA.Release(0x0200000000000001)).To(Succeed())
+		Expect(etcd.kvs).To(BeEmpty())
+		Expect(clusterB.Claim(0x0200000000000001)).To(Succeed())
+	})
+	It("List claims page by page", func() {
+		coordinator := newCoordinator("cluster-a", server.URL)
+		for guid := GUID(0x0200000000000000); guid < 0x0200000000000000+etcdListPageSize+5; guid++ {
+			etcd.kvs["/ib-kubernetes/guids/"+guid.String()] = []byte("cluster-b")
+		}
+		etcd.kvs["/ib-kubernetes/guids/invalid"] = []byte("cluster-b")
+		etcd.kvs["/other/02:00:00:00:00:00:00:00"] = []byte("cluster-b")
+
+		claims, err := coordinator.List()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(claims).To(HaveLen(etcdListPageSize + 5))
+		Expect(claims).To(HaveKeyWithValue(GUID(0x0200000000000000), "cluster-b"))
+	})
+	It("Fall back to the next endpoint", func() {
+		unavailable := httptest.NewServer(http.NotFoundHandler())
+		unavailableURL := unavailable.URL
+		unavailable.Close()
+
+		coordinator := newCoordinator("cluster-a", unavailableURL, server.URL+"/")
+		Expect(coordinator.Claim(0x0200000000000001)).To(Succeed())
+
+		coordinator = newCoordinator("cluster-a", unavailableURL)
+		Expect(coordinator.Claim(0x0200000000000002)).ToNot(Succeed())
+	})
+	It("Compute the range end of a prefix", func() {
+		Expect(prefixRangeEnd([]byte("/a/"))).To(Equal([]byte("/a0")))
+		Expect(prefixRangeEnd([]byte{'a', 0xff})).To(Equal([]byte("b")))
+		Expect(prefixRangeEnd([]byte{0xff})).To(Equal([]byte{0}))
+	})
+})
@@ -3,6 +3,8 @@ package guid
 import (
 	"fmt"
 	"net"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
 )
 
 // GUID address is an uint64 encapsulation for network hardware address
@@ -14,9 +16,13 @@ const (
 	byteMask   = 0xff
 )
 
-// ParseGUID parses string only as GUID 64 bit
+// ParseGUID parses string only as GUID 64 bit, in any of the forms accepted by ibUtils.NormalizeGUID
 func ParseGUID(s string) (GUID, error) {
-	ha, err := net.ParseMAC(s)
+	normalized, err := ibUtils.NormalizeGUID(s)
+	if err != nil {
+		return 0, err
+	}
+	ha, err := net.ParseMAC(normalized)
 	if err != nil {
 		return 0, err
 	}
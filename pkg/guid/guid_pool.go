@@ -3,10 +3,12 @@ package guid
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
 )
 
 type Pool interface {
@@ -17,21 +19,61 @@ type Pool interface {
 
 	GenerateGUID() (GUID, error)
 
+	// GenerateGUIDInRange generates a guid from the sub-range of the pool, it returns ErrGUIDPoolExhausted if
+	// the sub-range is full
+	GenerateGUIDInRange(guidRange Range) (GUID, error)
+
 	// ReleaseGUID release the reservation of the guid.
 	// It returns error if the guid is not in the range.
 	ReleaseGUID(string) error
 
 	// Reset clears the current pool and resets it with given values (may be empty)
 	Reset(guids []string) error
+
+	// Sync merges the guids in use by the subnet manager into the pool. The guids allocated by the pool users are
+	// kept, so allocations which didn't reach the subnet manager yet aren't issued again, and the guids in use
+	// on the previous sync which are no longer in use are released.
+	Sync(inUse []string) error
+
+	// Stats returns the range of the pool, the number of allocated guids and the fragmentation of the free guids
+	Stats() PoolStats
+
+	// FreeInRange returns the number of free guids of the sub-range of the pool
+	FreeInRange(guidRange Range) uint64
+
+	// Contains returns true if the guid is in the range of the pool
+	Contains(guid GUID) bool
+}
+
+// PoolStats describes the usage of the guid pool
+type PoolStats struct {
+	RangeStart string `json:"rangeStart"`
+	RangeEnd   string `json:"rangeEnd"`
+	// Size is the number of guids in the range
+	Size uint64 `json:"size"`
+	// Allocated is the number of allocated guids, including guids in use by the subnet manager
+	Allocated uint64 `json:"allocated"`
+	Free      uint64 `json:"free"`
+	// FreeSegments is the number of runs of consecutive free guids
+	FreeSegments uint64 `json:"freeSegments"`
+	// LongestFreeRun is the number of guids in the longest run of consecutive free guids
+	LongestFreeRun uint64 `json:"longestFreeRun"`
 }
 
 var ErrGUIDPoolExhausted = errors.New("GUID pool is exhausted")
 
 type guidPool struct {
-	rangeStart  GUID          // first guid in range
-	rangeEnd    GUID          // last guid in range
-	currentGUID GUID          // last given guid
-	guidPoolMap map[GUID]bool // allocated guid map and status
+	rangeStart  GUID // first guid in range
+	rangeEnd    GUID // last guid in range
+	currentGUID GUID // guid the search for the next free guid starts from
+	// allocated guids merged to ranges of consecutive guids, so the free guid following an allocated range is
+	// found without scanning it
+	allocated      *rangeSet
+	allocatedCount uint64
+	// synced guids are allocated by Sync as in use by the subnet manager, not by the pool users
+	synced map[GUID]bool
+	// rangeCursors maps the start of a sub-range to the guid the search for its next free guid starts from
+	rangeCursors map[GUID]GUID
 }
 
 func NewPool(conf *config.GUIDPoolConfig) (Pool, error) {
@@ -48,19 +90,34 @@ func NewPool(conf *config.GUIDPoolConfig) (Pool, error) {
 		return nil, fmt.Errorf("invalid guid range. rangeStart: %v rangeEnd: %v", rangeStart, rangeEnd)
 	}
 
-	return &guidPool{
-		rangeStart:  rangeStart,
-		rangeEnd:    rangeEnd,
-		currentGUID: rangeStart,
-		guidPoolMap: map[GUID]bool{},
-	}, nil
+	pool := &guidPool{
+		rangeStart:   rangeStart,
+		rangeEnd:     rangeEnd,
+		currentGUID:  rangeStart,
+		allocated:    &rangeSet{},
+		synced:       make(map[GUID]bool),
+		rangeCursors: make(map[GUID]GUID),
+	}
+
+	if conf.CoordinationBackend != config.CoordinationBackendEtcd {
+		return pool, nil
+	}
+	log.Info().Msgf("coordinating guid allocations of cluster %s with etcd endpoints %v", conf.ClusterID,
+		conf.EtcdEndpoints)
+	coordinator, err := newEtcdCoordinator(conf)
+	if err != nil {
+		return nil, err
+	}
+	return newCoordinatedPool(pool, coordinator, conf.ClusterID), nil
 }
 
 // Reset clears the current pool and resets it with given values (may be empty)
 func (p *guidPool) Reset(guids []string) error {
 	log.Debug().Msg("resetting guid pool")
 
-	p.guidPoolMap = map[GUID]bool{}
+	p.allocated = &rangeSet{}
+	p.allocatedCount = 0
+	p.synced = make(map[GUID]bool)
 	if guids == nil {
 		return nil
 	}
@@ -84,8 +141,48 @@ func (p *guidPool) Reset(guids []string) error {
 	return nil
 }
 
+// Sync merges the guids in use by the subnet manager into the pool
+func (p *guidPool) Sync(inUse []string) error {
+	log.Debug().Msg("syncing guid pool")
+
+	current := make(map[GUID]bool, len(inUse))
+	for _, guid := range inUse {
+		guidAddr, err := ParseGUID(guid)
+		if err != nil {
+			log.Debug().Msgf("error validating GUID: %s: %v", guid, err)
+			return err
+		}
+		// Out of range GUID may be expected and shouldn't be allocated in the pool
+		if p.isGUIDInRange(guidAddr) {
+			current[guidAddr] = true
+		}
+	}
+
+	for guidAddr := range p.synced {
+		if current[guidAddr] {
+			continue
+		}
+		if err := p.ReleaseGUID(guidAddr.String()); err != nil {
+			return err
+		}
+	}
+	for guidAddr := range current {
+		if p.isAllocated(guidAddr) {
+			continue
+		}
+		if err := p.AllocateGUID(guidAddr.String()); err != nil {
+			return err
+		}
+		p.synced[guidAddr] = true
+	}
+	return nil
+}
+
 // GenerateGUID generates a guid from the range
 func (p *guidPool) GenerateGUID() (GUID, error) {
+	start := time.Now()
+	defer func() { metrics.GenerateGUIDDuration.Observe(time.Since(start).Seconds()) }()
+
 	// this look will ensure that we check all the range
 	// first iteration from current guid to last guid in the range
 	// second iteration from first guid in the range to the latest one
@@ -107,13 +204,36 @@ func (p *guidPool) ReleaseGUID(guid string) error {
 		return err
 	}
 
-	if _, ok := p.guidPoolMap[guidAddr]; !ok {
+	allocated := p.allocated.floor(guidAddr)
+	if allocated == nil || guidAddr > allocated.end {
 		return fmt.Errorf("failed to release guid %s, not allocated ", guid)
 	}
-	delete(p.guidPoolMap, guidAddr)
+
+	// Split the allocated range around the released guid
+	start, end := allocated.start, allocated.end
+	switch {
+	case start == guidAddr && end == guidAddr:
+		p.allocated.remove(start)
+	case start == guidAddr:
+		p.allocated.remove(start)
+		p.allocated.insert(guidRange{start: guidAddr + 1, end: end})
+	case end == guidAddr:
+		allocated.end = guidAddr - 1
+	default:
+		allocated.end = guidAddr - 1
+		p.allocated.insert(guidRange{start: guidAddr + 1, end: end})
+	}
+	p.allocatedCount--
+	delete(p.synced, guidAddr)
 	return nil
 }
 
+// isAllocated returns true if the guid is allocated in the pool
+func (p *guidPool) isAllocated(guidAddr GUID) bool {
+	allocated := p.allocated.floor(guidAddr)
+	return allocated != nil && guidAddr <= allocated.end
+}
+
 func (p *guidPool) AllocateGUID(guid string) error {
 	log.Debug().Msgf("allocating guid %s", guid)
 
@@ -126,18 +246,101 @@ func (p *guidPool) AllocateGUID(guid string) error {
 		return fmt.Errorf("out of range guid %s, pool range %v - %v", guid, p.rangeStart, p.rangeEnd)
 	}
 
-	if _, exist := p.guidPoolMap[guidAddr]; exist {
+	previous := p.allocated.floor(guidAddr)
+	if previous != nil && guidAddr <= previous.end {
 		return fmt.Errorf("failed to allocate requested guid %s, already allocated", guid)
 	}
 
-	p.guidPoolMap[guidAddr] = true
+	// Merge the guid with the adjacent allocated ranges, the guid following the range end doesn't overflow
+	// as the range end is never the max guid
+	mergePrevious := previous != nil && previous.end+1 == guidAddr
+	next := p.allocated.floor(guidAddr + 1)
+	mergeNext := next != nil && next.start == guidAddr+1
+	switch {
+	case mergePrevious && mergeNext:
+		previous.end = next.end
+		p.allocated.remove(next.start)
+	case mergePrevious:
+		previous.end = guidAddr
+	case mergeNext:
+		end := next.end
+		p.allocated.remove(next.start)
+		p.allocated.insert(guidRange{start: guidAddr, end: end})
+	default:
+		p.allocated.insert(guidRange{start: guidAddr, end: guidAddr})
+	}
+	p.allocatedCount++
 	return nil
 }
 
+// Stats returns the range of the pool, the number of allocated guids and the fragmentation of the free guids
+func (p *guidPool) Stats() PoolStats {
+	size := uint64(p.rangeEnd-p.rangeStart) + 1
+	allocated := p.allocatedCount
+	freeSegments, longestFreeRun := p.fragmentation()
+	return PoolStats{
+		RangeStart:     p.rangeStart.String(),
+		RangeEnd:       p.rangeEnd.String(),
+		Size:           size,
+		Allocated:      allocated,
+		Free:           size - allocated,
+		FreeSegments:   freeSegments,
+		LongestFreeRun: longestFreeRun,
+	}
+}
+
+// FreeInRange returns the number of free guids of the sub-range of the pool, 0 if it's out of the pool range
+func (p *guidPool) FreeInRange(subRange Range) uint64 {
+	if !p.isGUIDInRange(subRange.Start) || !p.isGUIDInRange(subRange.End) || subRange.Start > subRange.End {
+		return 0
+	}
+	free := uint64(subRange.End-subRange.Start) + 1
+	p.allocated.forEach(func(r guidRange) {
+		start, end := r.start, r.end
+		if start < subRange.Start {
+			start = subRange.Start
+		}
+		if end > subRange.End {
+			end = subRange.End
+		}
+		if start <= end {
+			free -= uint64(end-start) + 1
+		}
+	})
+	return free
+}
+
+// fragmentation returns the number of runs of consecutive free guids in the range and the length of the longest run
+func (p *guidPool) fragmentation() (segments, longest uint64) {
+	addRun := func(run uint64) {
+		segments++
+		if run > longest {
+			longest = run
+		}
+	}
+	// The range end is never the max guid, so the guid following an allocated guid doesn't overflow
+	next := p.rangeStart
+	p.allocated.forEach(func(r guidRange) {
+		if r.start > next {
+			addRun(uint64(r.start - next))
+		}
+		next = r.end + 1
+	})
+	if next <= p.rangeEnd {
+		addRun(uint64(p.rangeEnd-next) + 1)
+	}
+	return segments, longest
+}
+
 func isValidRange(rangeStart, rangeEnd GUID) bool {
 	return rangeStart <= rangeEnd && rangeStart != 0 && rangeEnd != 0xFFFFFFFFFFFFFFFF
 }
 
+// Contains returns true if the guid is in the range of the pool
+func (p *guidPool) Contains(guid GUID) bool {
+	return p.isGUIDInRange(guid)
+}
+
 func (p *guidPool) isGUIDInRange(guid GUID) bool {
 	return guid >= p.rangeStart && guid <= p.rangeEnd
 }
@@ -150,14 +353,47 @@ func (p *guidPool) isGUIDStringInRange(guid string) (bool, error) {
 	return p.isGUIDInRange(guidAddr), nil
 }
 
-// getFreeGUID return free guid in given range
+// GenerateGUIDInRange generates a free guid from the sub-range of the pool, continuing after the last guid generated
+// from the sub-range, it returns ErrGUIDPoolExhausted if the sub-range is full
+func (p *guidPool) GenerateGUIDInRange(guidRange Range) (GUID, error) {
+	start := time.Now()
+	defer func() { metrics.GenerateGUIDDuration.Observe(time.Since(start).Seconds()) }()
+
+	if !p.isGUIDInRange(guidRange.Start) || !p.isGUIDInRange(guidRange.End) {
+		return 0, fmt.Errorf("guid range %s out of pool range %v - %v", guidRange, p.rangeStart, p.rangeEnd)
+	}
+
+	// as for the whole range, the search continues from the last generated guid of the sub-range
+	cursor, exist := p.rangeCursors[guidRange.Start]
+	if !exist || cursor > guidRange.End {
+		cursor = guidRange.Start
+	}
+	guid := p.getFreeGUID(cursor, guidRange.End)
+	if guid == 0 {
+		guid = p.getFreeGUID(guidRange.Start, guidRange.End)
+	}
+	if guid == 0 {
+		return 0, ErrGUIDPoolExhausted
+	}
+	p.rangeCursors[guidRange.Start] = guid + 1
+	return guid, nil
+}
+
+// getFreeGUID return free guid in given range, the search for the next free guid continues after it
 func (p *guidPool) getFreeGUID(start, end GUID) GUID {
-	for guid := start; guid <= end; guid++ {
-		if _, ok := p.guidPoolMap[guid]; !ok {
-			p.currentGUID++
-			return guid
-		}
+	if start > end {
+		return 0
+	}
+
+	guid := start
+	// The guid following an allocated range is free, as adjacent allocated ranges are merged
+	if allocated := p.allocated.floor(guid); allocated != nil && guid <= allocated.end {
+		guid = allocated.end + 1
+	}
+	if guid > end {
+		return 0
 	}
 
-	return 0
+	p.currentGUID = guid + 1
+	return guid
 }
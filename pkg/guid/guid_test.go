@@ -9,6 +9,29 @@ import (
 
 var _ = Describe("GUID Pool", func() {
 	conf := &config.GUIDPoolConfig{RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:FF:FF:FF:FF:FF:FF:FF"}
+	Context("SyncPool", func() {
+		It("Sync pool keeps guids allocated by the pool users", func() {
+			pool, err := NewPool(conf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pool.AllocateGUID("02:00:00:00:00:00:00:01")).To(Succeed())
+
+			Expect(pool.Sync([]string{"02:00:00:00:00:00:00:02", "03:00:00:00:00:00:00:02"})).To(Succeed())
+			Expect(pool.Stats().Allocated).To(Equal(uint64(2)))
+			Expect(pool.AllocateGUID("02:00:00:00:00:00:00:02")).ToNot(Succeed())
+
+			// guids no longer in use are released, the allocated guid is kept even if not in use
+			Expect(pool.Sync([]string{"02:00:00:00:00:00:00:01"})).To(Succeed())
+			Expect(pool.Stats().Allocated).To(Equal(uint64(1)))
+			Expect(pool.AllocateGUID("02:00:00:00:00:00:00:02")).To(Succeed())
+			Expect(pool.Sync(nil)).To(Succeed())
+			Expect(pool.Stats().Allocated).To(Equal(uint64(2)))
+		})
+		It("Sync pool with invalid guid fails", func() {
+			pool, err := NewPool(conf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pool.Sync([]string{"invalid"})).ToNot(Succeed())
+		})
+	})
 	Context("ResetPool", func() {
 		It("Reset pool clears previous values", func() {
 			pool, err := NewPool(conf)
@@ -165,6 +188,34 @@ var _ = Describe("GUID Pool", func() {
 			Expect(err).To(HaveOccurred())
 		})
 	})
+	Context("GenerateGUIDInRange", func() {
+		It("Generate guids from the sub-range until it is exhausted", func() {
+			pool, err := NewPool(conf)
+			Expect(err).ToNot(HaveOccurred())
+			guidRange := Range{Start: 0x0200000000000010, End: 0x0200000000000011}
+			Expect(pool.AllocateGUID("02:00:00:00:00:00:00:10")).To(Succeed())
+
+			guid, err := pool.GenerateGUIDInRange(guidRange)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guid.String()).To(Equal("02:00:00:00:00:00:00:11"))
+			Expect(pool.AllocateGUID(guid.String())).To(Succeed())
+
+			_, err = pool.GenerateGUIDInRange(guidRange)
+			Expect(err).To(Equal(ErrGUIDPoolExhausted))
+
+			// the search wraps to the start of the sub-range
+			Expect(pool.ReleaseGUID("02:00:00:00:00:00:00:10")).To(Succeed())
+			guid, err = pool.GenerateGUIDInRange(guidRange)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guid.String()).To(Equal("02:00:00:00:00:00:00:10"))
+		})
+		It("Fail to generate guid from sub-range out of the pool range", func() {
+			pool, err := NewPool(conf)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = pool.GenerateGUIDInRange(Range{Start: 0x0300000000000000, End: 0x0300000000000001})
+			Expect(err).To(HaveOccurred())
+		})
+	})
 	Context("AllocateGUID", func() {
 		It("Allocate guid from the pool", func() {
 			pool, err := NewPool(conf)
@@ -187,7 +238,7 @@ var _ = Describe("GUID Pool", func() {
 			Expect(err).To(HaveOccurred())
 		})
 		It("Allocate invalid guid from the pool", func() {
-			pool := &guidPool{guidPoolMap: map[GUID]bool{}}
+			pool := &guidPool{allocated: &rangeSet{}}
 			err := pool.AllocateGUID("invalid")
 			Expect(err).To(HaveOccurred())
 		})
@@ -198,17 +249,76 @@ var _ = Describe("GUID Pool", func() {
 			Expect(err).To(HaveOccurred())
 		})
 	})
+	Context("Stats", func() {
+		It("Count allocated and free guids of the range", func() {
+			pool, err := NewPool(&config.GUIDPoolConfig{
+				RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pool.AllocateGUID("02:00:00:00:00:00:00:10")).To(Succeed())
+			_, err = pool.GenerateGUID()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(pool.Stats()).To(Equal(PoolStats{
+				RangeStart:     "02:00:00:00:00:00:00:00",
+				RangeEnd:       "02:00:00:00:00:00:00:ff",
+				Size:           256,
+				Allocated:      1,
+				Free:           255,
+				FreeSegments:   2,
+				LongestFreeRun: 239,
+			}))
+		})
+		It("Measure fragmentation of the free guids", func() {
+			pool, err := NewPool(&config.GUIDPoolConfig{
+				RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:09"})
+			Expect(err).ToNot(HaveOccurred())
+			stats := pool.Stats()
+			Expect(stats.FreeSegments).To(Equal(uint64(1)))
+			Expect(stats.LongestFreeRun).To(Equal(uint64(10)))
+
+			for _, guid := range []string{"02:00:00:00:00:00:00:00", "02:00:00:00:00:00:00:03",
+				"02:00:00:00:00:00:00:04", "02:00:00:00:00:00:00:09"} {
+				Expect(pool.AllocateGUID(guid)).To(Succeed())
+			}
+			// Free runs are 01-02 and 05-08
+			stats = pool.Stats()
+			Expect(stats.FreeSegments).To(Equal(uint64(2)))
+			Expect(stats.LongestFreeRun).To(Equal(uint64(4)))
+
+			Expect(pool.Reset([]string{"02:00:00:00:00:00:00:00", "02:00:00:00:00:00:00:01",
+				"02:00:00:00:00:00:00:02", "02:00:00:00:00:00:00:03", "02:00:00:00:00:00:00:04",
+				"02:00:00:00:00:00:00:05", "02:00:00:00:00:00:00:06", "02:00:00:00:00:00:00:07",
+				"02:00:00:00:00:00:00:08", "02:00:00:00:00:00:00:09"})).To(Succeed())
+			stats = pool.Stats()
+			Expect(stats.FreeSegments).To(BeZero())
+			Expect(stats.LongestFreeRun).To(BeZero())
+		})
+		It("Count free guids of a sub-range", func() {
+			pool, err := NewPool(&config.GUIDPoolConfig{
+				RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+			Expect(err).ToNot(HaveOccurred())
+			for _, guid := range []string{"02:00:00:00:00:00:00:0F", "02:00:00:00:00:00:00:10",
+				"02:00:00:00:00:00:00:11", "02:00:00:00:00:00:00:20"} {
+				Expect(pool.AllocateGUID(guid)).To(Succeed())
+			}
+
+			Expect(pool.FreeInRange(Range{Start: 0x020000000000000F, End: 0x020000000000001F})).To(Equal(uint64(14)))
+			Expect(pool.FreeInRange(Range{Start: 0x0200000000000030, End: 0x020000000000003F})).To(Equal(uint64(16)))
+			Expect(pool.FreeInRange(Range{Start: 0x0200000000000000, End: 0x0300000000000000})).To(BeZero())
+		})
+	})
 	Context("ReleaseGUID", func() {
 		It("release existing allocated guid", func() {
 			guid := "00:00:00:00:00:00:00:01"
-			pool := &guidPool{guidPoolMap: map[GUID]bool{1: true}}
+			pool := &guidPool{rangeStart: 1, rangeEnd: 1, allocated: &rangeSet{}}
+			Expect(pool.AllocateGUID(guid)).To(Succeed())
 
 			err := pool.ReleaseGUID(guid)
 			Expect(err).ToNot(HaveOccurred())
 		})
 		It("release non existing allocated guid", func() {
 			guid := "02:00:00:00:00:00:00:00"
-			pool := &guidPool{guidPoolMap: map[GUID]bool{}}
+			pool := &guidPool{allocated: &rangeSet{}}
 
 			err := pool.ReleaseGUID(guid)
 			Expect(err).To(HaveOccurred())
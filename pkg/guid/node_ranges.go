@@ -0,0 +1,78 @@
+package guid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+)
+
+// Range is a sub-range of the guid pool
+type Range struct {
+	Start GUID
+	End   GUID
+}
+
+func (r Range) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// ParseRange parses a guid range formatted as "<first guid>-<last guid>"
+func ParseRange(guidRange string) (Range, error) {
+	start, end, found := strings.Cut(guidRange, "-")
+	if !found {
+		return Range{}, fmt.Errorf("invalid guid range %q, expected \"<first guid>-<last guid>\"", guidRange)
+	}
+	startGUID, err := ParseGUID(strings.TrimSpace(start))
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid guid range %q: %v", guidRange, err)
+	}
+	endGUID, err := ParseGUID(strings.TrimSpace(end))
+	if err != nil {
+		return Range{}, fmt.Errorf("invalid guid range %q: %v", guidRange, err)
+	}
+	if startGUID > endGUID {
+		return Range{}, fmt.Errorf("invalid guid range %q, first guid is after the last guid", guidRange)
+	}
+	return Range{Start: startGUID, End: endGUID}, nil
+}
+
+// ParseNodeRanges parses the sub-ranges of the pool by node label value, the sub-ranges must be in the pool range
+// and must not overlap
+func ParseNodeRanges(conf *config.GUIDPoolConfig) (map[string]Range, error) {
+	if len(conf.NodeRanges) == 0 {
+		return nil, nil
+	}
+	poolStart, err := ParseGUID(conf.RangeStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse guidRangeStart %v", err)
+	}
+	poolEnd, err := ParseGUID(conf.RangeEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse guidRangeEnd %v", err)
+	}
+
+	ranges := make(map[string]Range, len(conf.NodeRanges))
+	values := make([]string, 0, len(conf.NodeRanges))
+	for value, rangeStr := range conf.NodeRanges {
+		guidRange, err := ParseRange(rangeStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid guid range of node label value %s: %v", value, err)
+		}
+		if guidRange.Start < poolStart || guidRange.End > poolEnd {
+			return nil, fmt.Errorf("guid range %s of node label value %s is out of the pool range %s - %s",
+				guidRange, value, conf.RangeStart, conf.RangeEnd)
+		}
+		ranges[value] = guidRange
+		values = append(values, value)
+	}
+
+	sort.Slice(values, func(i, j int) bool { return ranges[values[i]].Start < ranges[values[j]].Start })
+	for i := 1; i < len(values); i++ {
+		if ranges[values[i]].Start <= ranges[values[i-1]].End {
+			return nil, fmt.Errorf("guid ranges of node label values %s and %s overlap", values[i-1], values[i])
+		}
+	}
+	return ranges, nil
+}
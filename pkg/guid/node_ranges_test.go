@@ -0,0 +1,41 @@
+package guid
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+)
+
+var _ = Describe("Node GUID Ranges", func() {
+	newConf := func(ranges map[string]string) *config.GUIDPoolConfig {
+		return &config.GUIDPoolConfig{RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:FF:FF",
+			NodeLabel: "topology.kubernetes.io/zone", NodeRanges: ranges}
+	}
+
+	It("Parse the sub-ranges of the node label values", func() {
+		ranges, err := ParseNodeRanges(newConf(map[string]string{
+			"zone-a": "02:00:00:00:00:00:00:00-02:00:00:00:00:00:0F:FF",
+			"zone-b": "02:00:00:00:00:00:10:00 - 02:00:00:00:00:00:1F:FF"}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ranges).To(Equal(map[string]Range{
+			"zone-a": {Start: 0x0200000000000000, End: 0x0200000000000FFF},
+			"zone-b": {Start: 0x0200000000001000, End: 0x0200000000001FFF}}))
+
+		ranges, err = ParseNodeRanges(newConf(nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ranges).To(BeNil())
+	})
+	It("Reject invalid sub-ranges", func() {
+		for _, ranges := range []map[string]string{
+			{"zone-a": "02:00:00:00:00:00:00:00"},
+			{"zone-a": "02:00:00:00:00:00:0F:FF-02:00:00:00:00:00:00:00"},
+			{"zone-a": "02:00:00:00:00:00:00:00-03:00:00:00:00:00:00:00"},
+			{"zone-a": "02:00:00:00:00:00:00:00-02:00:00:00:00:00:0F:FF",
+				"zone-b": "02:00:00:00:00:00:0F:FF-02:00:00:00:00:00:1F:FF"},
+		} {
+			_, err := ParseNodeRanges(newConf(ranges))
+			Expect(err).To(HaveOccurred())
+		}
+	})
+})
@@ -0,0 +1,98 @@
+package guid
+
+import (
+	"math/rand"
+)
+
+// guidRange is an inclusive range of consecutive guids
+type guidRange struct {
+	start GUID
+	end   GUID
+}
+
+type rangeNode struct {
+	guidRange
+	priority uint32
+	left     *rangeNode
+	right    *rangeNode
+}
+
+// rangeSet is a set of disjoint ranges of guids ordered by their start. The ranges are stored in a treap, a binary
+// search tree balanced by random node priorities, so looking up, adding and removing a range take O(log n)
+// expected time for n ranges.
+type rangeSet struct {
+	root *rangeNode
+}
+
+// floor returns the range with the greatest start less than or equal to guid, or nil if there is none.
+// The end of the returned range can be modified in place, as long as the ranges stay disjoint.
+func (s *rangeSet) floor(guid GUID) *rangeNode {
+	var floor *rangeNode
+	for node := s.root; node != nil; {
+		if node.start <= guid {
+			floor = node
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	return floor
+}
+
+// insert adds the range, which must not overlap the ranges of the set
+func (s *rangeSet) insert(r guidRange) {
+	less, greater := split(s.root, r.start)
+	//nolint:gosec
+	node := &rangeNode{guidRange: r, priority: rand.Uint32()}
+	s.root = merge(merge(less, node), greater)
+}
+
+// remove removes the range starting with start if exists
+func (s *rangeSet) remove(start GUID) {
+	less, greater := split(s.root, start)
+	_, greater = split(greater, start+1)
+	s.root = merge(less, greater)
+}
+
+// forEach calls fn with the ranges of the set in ascending order
+func (s *rangeSet) forEach(fn func(r guidRange)) {
+	var walk func(node *rangeNode)
+	walk = func(node *rangeNode) {
+		if node == nil {
+			return
+		}
+		walk(node.left)
+		fn(node.guidRange)
+		walk(node.right)
+	}
+	walk(s.root)
+}
+
+// split splits the treap into the ranges starting before key and the ranges starting at or after key
+func split(node *rangeNode, key GUID) (less, greater *rangeNode) {
+	if node == nil {
+		return nil, nil
+	}
+	if node.start < key {
+		node.right, greater = split(node.right, key)
+		return node, greater
+	}
+	less, node.left = split(node.left, key)
+	return less, node
+}
+
+// merge merges two treaps, all the ranges of less start before the ranges of greater
+func merge(less, greater *rangeNode) *rangeNode {
+	if less == nil {
+		return greater
+	}
+	if greater == nil {
+		return less
+	}
+	if less.priority > greater.priority {
+		less.right = merge(less.right, greater)
+		return less
+	}
+	greater.left = merge(less, greater.left)
+	return greater
+}
@@ -0,0 +1,115 @@
+package guid
+
+import (
+	"math/rand"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+)
+
+func ranges(s *rangeSet) []guidRange {
+	var result []guidRange
+	s.forEach(func(r guidRange) { result = append(result, r) })
+	return result
+}
+
+var _ = Describe("GUID Range Set", func() {
+	It("Insert, find and remove ranges in order", func() {
+		s := &rangeSet{}
+		s.insert(guidRange{start: 20, end: 29})
+		s.insert(guidRange{start: 0, end: 9})
+		s.insert(guidRange{start: 40, end: 40})
+		Expect(ranges(s)).To(Equal([]guidRange{{0, 9}, {20, 29}, {40, 40}}))
+
+		Expect(s.floor(25).guidRange).To(Equal(guidRange{20, 29}))
+		Expect(s.floor(39).guidRange).To(Equal(guidRange{20, 29}))
+		Expect(s.floor(100).guidRange).To(Equal(guidRange{40, 40}))
+		s.remove(0)
+		Expect(s.floor(5)).To(BeNil())
+
+		s.remove(20)
+		s.remove(30)
+		Expect(ranges(s)).To(Equal([]guidRange{{40, 40}}))
+	})
+	It("Merge allocated guids to ranges and split them on release", func() {
+		pool, err := NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:00:FF"})
+		Expect(err).ToNot(HaveOccurred())
+		p := pool.(*guidPool)
+		start := p.rangeStart
+
+		for _, guid := range []GUID{start + 1, start + 3, start + 2, start, start + 5} {
+			Expect(p.AllocateGUID(guid.String())).To(Succeed())
+		}
+		Expect(ranges(p.allocated)).To(Equal([]guidRange{{start, start + 3}, {start + 5, start + 5}}))
+
+		Expect(p.ReleaseGUID((start + 1).String())).To(Succeed())
+		Expect(p.ReleaseGUID((start + 5).String())).To(Succeed())
+		Expect(ranges(p.allocated)).To(Equal([]guidRange{{start, start}, {start + 2, start + 3}}))
+		Expect(p.ReleaseGUID((start + 5).String())).ToNot(Succeed())
+
+		guid, err := p.GenerateGUID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(guid).To(Equal(start + 1))
+		Expect(p.Stats().Allocated).To(Equal(uint64(3)))
+	})
+	It("Keep allocations consistent with random allocation and release", func() {
+		pool, err := NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:00:00:00:00:00:01:FF"})
+		Expect(err).ToNot(HaveOccurred())
+		p := pool.(*guidPool)
+
+		//nolint:gosec
+		random := rand.New(rand.NewSource(1))
+		allocated := make(map[GUID]bool)
+		for i := 0; i < 5000; i++ {
+			guid := p.rangeStart + GUID(random.Intn(0x200))
+			if allocated[guid] {
+				Expect(p.ReleaseGUID(guid.String())).To(Succeed())
+				delete(allocated, guid)
+			} else {
+				Expect(p.AllocateGUID(guid.String())).To(Succeed())
+				allocated[guid] = true
+			}
+		}
+
+		Expect(p.Stats().Allocated).To(Equal(uint64(len(allocated))))
+		previousEnd := GUID(0)
+		for _, r := range ranges(p.allocated) {
+			// Ranges are disjoint and adjacent ranges are merged
+			Expect(r.start).To(BeNumerically(">", previousEnd+1))
+			for guid := r.start; guid <= r.end; guid++ {
+				Expect(allocated[guid]).To(BeTrue())
+			}
+			previousEnd = r.end
+		}
+
+		// Generate the free guids until the pool is exhausted
+		for free := 0x200 - len(allocated); free > 0; free-- {
+			guid, err := p.GenerateGUID()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(allocated[guid]).To(BeFalse())
+			Expect(p.AllocateGUID(guid.String())).To(Succeed())
+			allocated[guid] = true
+		}
+		_, err = p.GenerateGUID()
+		Expect(err).To(Equal(ErrGUIDPoolExhausted))
+	})
+	It("Generate free guid of nearly full large pool", func() {
+		pool, err := NewPool(&config.GUIDPoolConfig{
+			RangeStart: "02:00:00:00:00:00:00:00", RangeEnd: "02:FF:FF:FF:FF:FF:FF:FF"})
+		Expect(err).ToNot(HaveOccurred())
+		p := pool.(*guidPool)
+
+		// A single range of allocated guids up to the last guid
+		p.allocated.insert(guidRange{start: p.rangeStart + 1, end: p.rangeEnd})
+		p.allocatedCount = uint64(p.rangeEnd - p.rangeStart)
+		p.currentGUID = p.rangeStart + 1
+
+		guid, err := p.GenerateGUID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(guid).To(Equal(p.rangeStart))
+	})
+})
@@ -0,0 +1,71 @@
+package guid
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SnapshotVersion is the version of the GUID pool snapshot format
+const SnapshotVersion = 1
+
+// Snapshot is the exported GUID pool state, used to back up the allocations and restore them after
+// the loss of the kubernetes or subnet manager state
+type Snapshot struct {
+	Version     int                  `json:"version"`
+	Timestamp   time.Time            `json:"timestamp"`
+	Allocations []SnapshotAllocation `json:"allocations"`
+}
+
+// SnapshotAllocation is an allocated GUID with the pkey it is member of and the ID of its owner
+type SnapshotAllocation struct {
+	GUID string `json:"guid"`
+	// PKey the GUID is a member of, empty if none
+	PKey string `json:"pkey,omitempty"`
+	// OwnerID is the UID of the pod or the GUID reservation the GUID is allocated for
+	OwnerID   string `json:"ownerID"`
+	NetworkID string `json:"networkID"`
+	Interface string `json:"interface,omitempty"`
+}
+
+// NewSnapshot returns snapshot of the given allocations taken now
+func NewSnapshot(allocations []SnapshotAllocation) *Snapshot {
+	return &Snapshot{Version: SnapshotVersion, Timestamp: time.Now().UTC(), Allocations: allocations}
+}
+
+// ParseSnapshot parses and validates JSON snapshot, the GUIDs of the allocations are normalized
+func ParseSnapshot(data []byte) (*Snapshot, error) {
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse guid pool snapshot: %v", err)
+	}
+	if err := snapshot.Validate(); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Validate checks the snapshot version and allocations, and normalizes the GUIDs of the allocations
+func (s *Snapshot) Validate() error {
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported guid pool snapshot version %d, expected %d", s.Version, SnapshotVersion)
+	}
+
+	seen := make(map[GUID]bool, len(s.Allocations))
+	for index := range s.Allocations {
+		allocation := &s.Allocations[index]
+		guidAddr, err := ParseGUID(allocation.GUID)
+		if err != nil {
+			return fmt.Errorf("invalid guid %s in snapshot: %v", allocation.GUID, err)
+		}
+		if seen[guidAddr] {
+			return fmt.Errorf("guid %s is allocated more than once in snapshot", allocation.GUID)
+		}
+		if allocation.OwnerID == "" || allocation.NetworkID == "" {
+			return fmt.Errorf("guid %s has no owner in snapshot", allocation.GUID)
+		}
+		seen[guidAddr] = true
+		allocation.GUID = guidAddr.String()
+	}
+	return nil
+}
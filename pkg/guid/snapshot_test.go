@@ -0,0 +1,41 @@
+package guid
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GUID Pool Snapshot", func() {
+	It("Export and parse snapshot", func() {
+		snapshot := NewSnapshot([]SnapshotAllocation{
+			{GUID: "02:00:00:00:00:00:00:01", PKey: "0x5", OwnerID: "uid-1", NetworkID: "default_ib", Interface: "net1"}})
+		data, err := json.Marshal(snapshot)
+		Expect(err).ToNot(HaveOccurred())
+
+		parsed, err := ParseSnapshot(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.Version).To(Equal(SnapshotVersion))
+		Expect(parsed.Allocations).To(Equal(snapshot.Allocations))
+	})
+	It("Parse snapshot normalizes guids", func() {
+		parsed, err := ParseSnapshot([]byte(`{"version": 1, "allocations": [
+			{"guid": "02-00-00-00-00-00-00-AB", "ownerID": "uid-1", "networkID": "default_ib"}]}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.Allocations[0].GUID).To(Equal("02:00:00:00:00:00:00:ab"))
+	})
+	It("Parse invalid snapshots", func() {
+		_, err := ParseSnapshot([]byte(`{"version": 2, "allocations": []}`))
+		Expect(err).To(HaveOccurred())
+		_, err = ParseSnapshot([]byte(`{"version": 1, "allocations": [
+			{"guid": "invalid", "ownerID": "uid-1", "networkID": "default_ib"}]}`))
+		Expect(err).To(HaveOccurred())
+		_, err = ParseSnapshot([]byte(`{"version": 1, "allocations": [{"guid": "02:00:00:00:00:00:00:01"}]}`))
+		Expect(err).To(HaveOccurred())
+		_, err = ParseSnapshot([]byte(`{"version": 1, "allocations": [
+			{"guid": "02:00:00:00:00:00:00:01", "ownerID": "uid-1", "networkID": "default_ib"},
+			{"guid": "02-00-00-00-00-00-00-01", "ownerID": "uid-2", "networkID": "default_ib"}]}`))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -1,16 +1,142 @@
 package ibutils
 
 import (
+	"fmt"
 	"net"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
-// IsPKeyValid check if the pkey is in the valid (15bits long)
+const (
+	// MinPKey and MaxPKey are the bounds of the 15 bits pkey range
+	MinPKey = 0x0000
+	MaxPKey = 0x7FFF
+	// DefaultPKey is the pkey of the default partition
+	DefaultPKey = 0x7FFF
+	// FullMembershipBit is the most significant bit of a 16 bits pkey table entry, set for full members
+	FullMembershipBit = 0x8000
+
+	pKeyMask = 0x7FFF
+
+	// guidHexLength is the number of hex digits of a 64 bits guid
+	guidHexLength = 16
+)
+
+// Accepted pkey forms: hex leading by 0x, e.g "0x7fff", bare hex with hex letters, e.g "7fff", or decimal, e.g
+// "32767"
+var (
+	pKeyHexRegex     = regexp.MustCompile(`^0[xX][0-9a-fA-F]{1,4}$`)
+	pKeyBareHexRegex = regexp.MustCompile(`^[0-9a-fA-F]*[a-fA-F][0-9a-fA-F]*$`)
+	pKeyDecimalRegex = regexp.MustCompile(`^[0-9]{1,5}$`)
+)
+
+// pKeyFormats describes the accepted pkey forms in the parse errors
+const pKeyFormats = `hex leading by 0x e.g "0x7fff", bare hex e.g "7fff" or decimal e.g "32767", ` +
+	`in range 0x0000 - 0xFFFF`
+
+// IsPKeyValid check if the pkey is in the valid (15bits long) range 0x0000 - 0x7FFF
 func IsPKeyValid(pkey int) bool {
-	return pkey == (pkey & 0x7fff)
+	return pkey >= MinPKey && pkey <= MaxPKey
+}
+
+// ValidatePKey returns an error if the pkey is out of the valid 15 bits range
+func ValidatePKey(pKey int) error {
+	if !IsPKeyValid(pKey) {
+		return fmt.Errorf("invalid pkey 0x%04X, out of range 0x%04X - 0x%04X", pKey, MinPKey, MaxPKey)
+	}
+	return nil
+}
+
+// IsDefaultPKey check if the pkey is the default partition pkey, with or without the full membership bit
+func IsDefaultPKey(pKey int) bool {
+	return pKey >= 0 && pKey&pKeyMask == DefaultPKey
+}
+
+// PKeyMembership splits a 16 bits pkey table entry to the 15 bits pkey and its full membership bit
+func PKeyMembership(entry int) (pKey int, fullMember bool) {
+	return entry & pKeyMask, entry&FullMembershipBit != 0
+}
+
+// ParsePKey returns the 15 bits pkey of a pkey string, hex leading by 0x, e.g "0x7fff", bare hex, e.g "7fff", or
+// decimal, e.g "32767". Digits only strings are decimal, so bare hex without hex letters, e.g "8001", must be leading
+// by 0x. The full membership bit is ignored, "0x8001" is parsed as the pkey 0x0001 as both refer to the same
+// partition.
+func ParsePKey(pKey string) (int, error) {
+	entry, err := parsePKeyEntry(pKey)
+	if err != nil {
+		return 0, err
+	}
+	value, _ := PKeyMembership(entry)
+	return value, nil
+}
+
+// NormalizePKey returns the pkey string as hex leading by 0x, e.g "0x7FFF" for "7fff" or "32767". The full
+// membership bit is kept, pkeys already leading by 0x are returned as is.
+func NormalizePKey(pKey string) (string, error) {
+	entry, err := parsePKeyEntry(pKey)
+	if err != nil {
+		return "", err
+	}
+	if pKeyHexRegex.MatchString(pKey) {
+		return pKey, nil
+	}
+	return FormatPKey(entry), nil
+}
+
+// parsePKeyEntry returns the 16 bits pkey table entry of a pkey string in any of the accepted forms
+func parsePKeyEntry(pKey string) (int, error) {
+	var digits string
+	base := 16
+	switch {
+	case pKeyHexRegex.MatchString(pKey):
+		digits = pKey[2:]
+	case pKeyBareHexRegex.MatchString(pKey):
+		digits = pKey
+	case pKeyDecimalRegex.MatchString(pKey):
+		digits, base = pKey, 10
+	default:
+		return 0, fmt.Errorf("invalid pkey %s, should be %s", pKey, pKeyFormats)
+	}
+
+	entry, err := strconv.ParseUint(digits, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pkey %s, should be %s", pKey, pKeyFormats)
+	}
+	return int(entry), nil
+}
+
+// FormatPKey returns the pkey as hex string, e.g "0x000A"
+func FormatPKey(pKey int) string {
+	return fmt.Sprintf("0x%04X", pKey)
 }
 
 // GUIDToString return string guid from HardwareAddr
 func GUIDToString(guidAddr net.HardwareAddr) string {
 	return strings.ReplaceAll(guidAddr.String(), ":", "")
 }
+
+// guidDelimiters removes the delimiters of the guid string formats, e.g. "02:00:00:00:00:00:00:01",
+// "02-00-00-00-00-00-00-01" or "0200.0000.0000.0001"
+var guidDelimiters = strings.NewReplacer(":", "", "-", "", ".", "")
+
+// NormalizeGUID returns the canonical form of a guid, lower case hex octets delimited by colons, e.g.
+// "02:00:00:00:00:00:00:0f". Any case is accepted, with colons, dashes or dots delimiters, without delimiters as
+// returned by UFM, e.g. "020000000000000F", and with a "0x" prefix. Guids are compared and used as map keys in their
+// canonical form only.
+func NormalizeGUID(guid string) (string, error) {
+	hexGUID := strings.ToLower(strings.TrimSpace(guid))
+	hexGUID = guidDelimiters.Replace(strings.TrimPrefix(hexGUID, "0x"))
+	if len(hexGUID) != guidHexLength {
+		return "", fmt.Errorf("invalid guid %q", guid)
+	}
+
+	octets := make([]string, 0, guidHexLength/2)
+	for i := 0; i < guidHexLength; i += 2 {
+		if _, err := strconv.ParseUint(hexGUID[i:i+2], 16, 8); err != nil {
+			return "", fmt.Errorf("invalid guid %q", guid)
+		}
+		octets = append(octets, hexGUID[i:i+2])
+	}
+	return strings.Join(octets, ":"), nil
+}
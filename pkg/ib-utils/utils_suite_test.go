@@ -0,0 +1,13 @@
+package ibutils
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestIBUtils(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "IB Utils Suite")
+}
@@ -0,0 +1,110 @@
+package ibutils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IB Utils", func() {
+	Context("ParsePKey", func() {
+		It("Parse hex pkeys", func() {
+			for pKeyStr, expected := range map[string]int{
+				"0x0": 0x0, "0x5": 0x5, "0X7fff": 0x7FFF, "0x7FFF": 0x7FFF, "0x1a2B": 0x1A2B} {
+				pKey, err := ParsePKey(pKeyStr)
+				Expect(err).ToNot(HaveOccurred(), pKeyStr)
+				Expect(pKey).To(Equal(expected), pKeyStr)
+			}
+		})
+		It("Parse pkeys with the full membership bit", func() {
+			pKey, err := ParsePKey("0x8001")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pKey).To(Equal(0x0001))
+
+			pKey, err = ParsePKey("0xFFFF")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pKey).To(Equal(DefaultPKey))
+		})
+		It("Reject invalid pkeys", func() {
+			for _, pKeyStr := range []string{"", "0x", "x5", "0x5g", "0x12z", "0x10000", "0x 5", "-0x5",
+				"0x5 ", "1ffff", "65536", "123456", "-5", "5 ", "+5", "0x-5"} {
+				_, err := ParsePKey(pKeyStr)
+				Expect(err).To(HaveOccurred(), pKeyStr)
+			}
+		})
+		It("Parse bare hex and decimal pkeys", func() {
+			for pKeyStr, expected := range map[string]int{
+				"7fff": 0x7FFF, "7FFF": 0x7FFF, "a": 0xA, "1A2b": 0x1A2B, "ffff": 0x7FFF,
+				"0": 0x0, "5": 0x5, "32767": 0x7FFF, "00010": 0xA, "32769": 0x0001, "65535": 0x7FFF} {
+				pKey, err := ParsePKey(pKeyStr)
+				Expect(err).ToNot(HaveOccurred(), pKeyStr)
+				Expect(pKey).To(Equal(expected), pKeyStr)
+			}
+		})
+		It("Report the accepted formats when failing", func() {
+			_, err := ParsePKey("0x5g")
+			Expect(err).To(MatchError(ContainSubstring(`hex leading by 0x e.g "0x7fff", bare hex e.g "7fff" ` +
+				`or decimal e.g "32767"`)))
+		})
+	})
+	Context("NormalizePKey", func() {
+		It("Normalize pkeys to hex leading by 0x", func() {
+			for pKeyStr, expected := range map[string]string{
+				"7fff": "0x7FFF", "32767": "0x7FFF", "ffff": "0xFFFF", "32773": "0x8005", "10": "0x000A",
+				"0x5": "0x5", "0Xffff": "0Xffff"} {
+				normalized, err := NormalizePKey(pKeyStr)
+				Expect(err).ToNot(HaveOccurred(), pKeyStr)
+				Expect(normalized).To(Equal(expected), pKeyStr)
+			}
+		})
+		It("Reject invalid pkeys", func() {
+			_, err := NormalizePKey("0x10000")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("ValidatePKey", func() {
+		It("Validate pkeys range", func() {
+			Expect(ValidatePKey(0x0)).To(Succeed())
+			Expect(ValidatePKey(0x7FFF)).To(Succeed())
+			Expect(ValidatePKey(-1)).ToNot(Succeed())
+			Expect(ValidatePKey(0x8000)).To(MatchError("invalid pkey 0x8000, out of range 0x0000 - 0x7FFF"))
+			Expect(IsPKeyValid(0xFFFF)).To(BeFalse())
+		})
+	})
+	Context("Membership", func() {
+		It("Split pkey table entry membership", func() {
+			pKey, full := PKeyMembership(0x8005)
+			Expect(pKey).To(Equal(0x5))
+			Expect(full).To(BeTrue())
+
+			pKey, full = PKeyMembership(0x0005)
+			Expect(pKey).To(Equal(0x5))
+			Expect(full).To(BeFalse())
+		})
+		It("Check default pkey", func() {
+			Expect(IsDefaultPKey(0x7FFF)).To(BeTrue())
+			Expect(IsDefaultPKey(0xFFFF)).To(BeTrue())
+			Expect(IsDefaultPKey(0x7FFE)).To(BeFalse())
+			Expect(IsDefaultPKey(-1)).To(BeFalse())
+		})
+		It("Format pkey", func() {
+			Expect(FormatPKey(0xA)).To(Equal("0x000A"))
+		})
+	})
+	Context("NormalizeGUID", func() {
+		It("Normalize guids to lower case colon delimited octets", func() {
+			for _, guidStr := range []string{"02:00:0f:f0:00:00:00:01", "02:00:0F:F0:00:00:00:01", "02000FF000000001",
+				"0x02000ff000000001", "02-00-0F-F0-00-00-00-01", "0200.0ff0.0000.0001", " 02:00:0F:F0:00:00:00:01 "} {
+				normalized, err := NormalizeGUID(guidStr)
+				Expect(err).ToNot(HaveOccurred(), guidStr)
+				Expect(normalized).To(Equal("02:00:0f:f0:00:00:00:01"), guidStr)
+			}
+		})
+		It("Reject invalid guids", func() {
+			for _, guidStr := range []string{"", "02:00:00:00:00:00:01", "02:00:00:00:00:00:00:00:01",
+				"02:00:00:00:00:00:00:0g", "+2:00:00:00:00:00:00:01"} {
+				_, err := NormalizeGUID(guidStr)
+				Expect(err).To(HaveOccurred(), guidStr)
+			}
+		})
+	})
+})
@@ -0,0 +1,204 @@
+package k8sclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// MergePatchAnnotationWriter writes pod annotations with json merge patch
+	MergePatchAnnotationWriter = "merge-patch"
+	// ServerSideApplyAnnotationWriter writes pod annotations with server-side apply
+	ServerSideApplyAnnotationWriter = "server-side-apply"
+	// FieldManager is the server-side apply field manager of ib-kubernetes
+	FieldManager = "ib-kubernetes"
+)
+
+// ErrAnnotationConflict is returned when the pod was modified since it was read,
+// writing its annotations again requires a fresh copy of the pod
+var ErrAnnotationConflict = errors.New("pod was modified concurrently")
+
+// ErrAnnotationOwned is returned when the annotations were applied by another server-side apply field manager,
+// which annotations aren't taken over
+var ErrAnnotationOwned = errors.New("annotations are applied by another field manager")
+
+// ErrPodRecreated is returned when the pod was deleted, or deleted and recreated with the same name, since it was
+// read, its annotations must not be written on the new pod
+var ErrPodRecreated = errors.New("pod was deleted or recreated")
+
+// AnnotationWriter writes annotations on pods
+type AnnotationWriter interface {
+	// WriteAnnotations sets the given annotations on the pod, other pod annotations are kept. The write fails
+	// with ErrPodRecreated if the pod UID changed since the pod was read. The annotations must be all the
+	// annotations owned by the caller, as the server-side apply writer removes the annotations it applied before
+	// and which are left out.
+	WriteAnnotations(pod *kapi.Pod, annotations map[string]string) error
+}
+
+// NewAnnotationWriter returns the annotation writer of the given type
+func NewAnnotationWriter(writerType string, client Client) (AnnotationWriter, error) {
+	switch writerType {
+	case MergePatchAnnotationWriter:
+		return &mergePatchWriter{client: client}, nil
+	case ServerSideApplyAnnotationWriter:
+		return &serverSideApplyWriter{client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown annotation writer %q, supported writers [%q, %q]", writerType,
+			MergePatchAnnotationWriter, ServerSideApplyAnnotationWriter)
+	}
+}
+
+type mergePatchWriter struct {
+	client Client
+}
+
+func (w *mergePatchWriter) WriteAnnotations(pod *kapi.Pod, annotations map[string]string) error {
+	err := w.client.SetAnnotationsOnPod(pod, annotations)
+	if err != nil && kerrors.IsConflict(err) {
+		return conflictError(w.client, pod, err)
+	}
+	return err
+}
+
+type serverSideApplyWriter struct {
+	client Client
+}
+
+type applyPodMetadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	UID             types.UID         `json:"uid,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Annotations     map[string]string `json:"annotations"`
+}
+
+type applyPod struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   applyPodMetadata `json:"metadata"`
+}
+
+// WriteAnnotations applies the annotations owned by ib-kubernetes field manager.
+// The pod UID and resource version are part of the applied configuration, so the write fails with
+// ErrAnnotationConflict if another writer modified the pod after it was read, instead of overriding its changes.
+// The annotations are applied without forcing conflicts, annotations set by the pod creator or other updates are
+// taken over, while annotations applied by another field manager fail the write with ErrAnnotationOwned.
+func (w *serverSideApplyWriter) WriteAnnotations(pod *kapi.Pod, annotations map[string]string) error {
+	applyData, err := json.Marshal(&applyPod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: applyPodMetadata{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+			Annotations:     annotations,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply annotations on pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+
+	err = w.client.ApplyPod(pod, applyData, FieldManager, false)
+	if kerrors.HasStatusCause(err, metav1.CauseTypeFieldManagerConflict) {
+		err = w.takeOverAnnotations(pod, applyData, annotations, err)
+	}
+	return applyError(w.client, pod, err)
+}
+
+// takeOverAnnotations applies the annotations forcefully if no other field manager applied them, e.g. the network
+// annotation set by the creator of the pod, it fails with ErrAnnotationOwned otherwise
+func (w *serverSideApplyWriter) takeOverAnnotations(pod *kapi.Pod, applyData []byte, annotations map[string]string,
+	err error) error {
+	current, getErr := w.client.GetPod(pod.Namespace, pod.Name)
+	if goneErr := podGoneError(getErr, pod, current, err); goneErr != nil {
+		return goneErr
+	}
+	if getErr != nil {
+		return err
+	}
+
+	if managers := annotationAppliers(current, annotations); len(managers) != 0 {
+		return fmt.Errorf("%w %s on pod %s/%s: %v", ErrAnnotationOwned, strings.Join(managers, ", "),
+			pod.Namespace, pod.Name, err)
+	}
+	return w.client.ApplyPod(pod, applyData, FieldManager, true)
+}
+
+// annotationAppliers returns the server-side apply field managers other than ib-kubernetes which applied any of
+// the annotations on the pod, sorted
+func annotationAppliers(pod *kapi.Pod, annotations map[string]string) []string {
+	var managers []string
+	for _, entry := range pod.ManagedFields {
+		if entry.Manager == FieldManager || entry.Operation != metav1.ManagedFieldsOperationApply ||
+			entry.FieldsV1 == nil {
+			continue
+		}
+		fields := struct {
+			Metadata struct {
+				Annotations map[string]json.RawMessage `json:"f:annotations"`
+			} `json:"f:metadata"`
+		}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		for key := range annotations {
+			if _, owned := fields.Metadata.Annotations["f:"+key]; owned {
+				managers = append(managers, entry.Manager)
+				break
+			}
+		}
+	}
+	sort.Strings(managers)
+	return managers
+}
+
+// applyError maps the error of an apply to the annotation writer errors. Applying to a deleted pod is handled as
+// the creation of the pod, which the api server rejects as invalid since the applied pod has no containers, so the
+// pod is read again to tell whether it was deleted.
+func applyError(client Client, pod *kapi.Pod, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case kerrors.IsConflict(err) && !kerrors.HasStatusCause(err, metav1.CauseTypeFieldManagerConflict):
+		return conflictError(client, pod, err)
+	case kerrors.IsInvalid(err) || kerrors.IsNotFound(err):
+		current, getErr := client.GetPod(pod.Namespace, pod.Name)
+		if goneErr := podGoneError(getErr, pod, current, err); goneErr != nil {
+			return goneErr
+		}
+	}
+	return err
+}
+
+// conflictError reads the pod again after a conflicting write to tell whether the pod was deleted or recreated,
+// returning ErrPodRecreated, or only modified, returning ErrAnnotationConflict
+func conflictError(client Client, pod *kapi.Pod, err error) error {
+	current, getErr := client.GetPod(pod.Namespace, pod.Name)
+	if goneErr := podGoneError(getErr, pod, current, err); goneErr != nil {
+		return goneErr
+	}
+	return fmt.Errorf("%w: %v", ErrAnnotationConflict, err)
+}
+
+// podGoneError returns ErrPodRecreated if the pod read again after the failed write, with getErr, was deleted or
+// has another UID, nil otherwise
+func podGoneError(getErr error, pod, current *kapi.Pod, err error) error {
+	switch {
+	case kerrors.IsNotFound(getErr):
+		return fmt.Errorf("%w: %v", ErrPodRecreated, err)
+	case getErr == nil && current != nil && pod.UID != "" && current.UID != pod.UID:
+		return fmt.Errorf("%w: uid %s changed to %s: %v", ErrPodRecreated, pod.UID, current.UID, err)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,161 @@
+package k8sclient
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/k8s-client/mocks"
+)
+
+var _ = Describe("Annotation Writer", func() {
+	var pod *kapi.Pod
+
+	conflict := kerrors.NewConflict(schema.GroupResource{Resource: "pods"}, "pod", errors.New("modified"))
+	applyConflict := kerrors.NewApplyConflict([]metav1.StatusCause{{Type: metav1.CauseTypeFieldManagerConflict,
+		Field: ".metadata.annotations.key"}}, "conflict with other manager")
+
+	BeforeEach(func() {
+		pod = &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid",
+			ResourceVersion: "10"}}
+	})
+
+	Context("NewAnnotationWriter", func() {
+		It("Create annotation writers", func() {
+			writer, err := NewAnnotationWriter(MergePatchAnnotationWriter, &mocks.Client{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer).To(BeAssignableToTypeOf(&mergePatchWriter{}))
+
+			writer, err = NewAnnotationWriter(ServerSideApplyAnnotationWriter, &mocks.Client{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer).To(BeAssignableToTypeOf(&serverSideApplyWriter{}))
+		})
+		It("Create unknown annotation writer", func() {
+			writer, err := NewAnnotationWriter("unknown", &mocks.Client{})
+			Expect(err).To(HaveOccurred())
+			Expect(writer).To(BeNil())
+		})
+	})
+	Context("Merge patch writer", func() {
+		It("Write annotations", func() {
+			annotations := map[string]string{"key": "value"}
+			client := &mocks.Client{}
+			client.On("SetAnnotationsOnPod", pod, annotations).Return(nil)
+
+			writer, err := NewAnnotationWriter(MergePatchAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.WriteAnnotations(pod, annotations)).To(Succeed())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Write annotations of recreated pod", func() {
+			annotations := map[string]string{"key": "value"}
+			client := &mocks.Client{}
+			client.On("SetAnnotationsOnPod", pod, annotations).Return(conflict)
+			recreated := pod.DeepCopy()
+			recreated.UID = "new-uid"
+			client.On("GetPod", "default", "pod").Return(recreated, nil)
+
+			writer, err := NewAnnotationWriter(MergePatchAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			err = writer.WriteAnnotations(pod, annotations)
+			Expect(errors.Is(err, ErrPodRecreated)).To(BeTrue())
+		})
+		It("Write annotations of deleted pod", func() {
+			annotations := map[string]string{"key": "value"}
+			client := &mocks.Client{}
+			client.On("SetAnnotationsOnPod", pod, annotations).Return(conflict)
+			client.On("GetPod", "default", "pod").Return(nil,
+				kerrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "pod"))
+
+			writer, err := NewAnnotationWriter(MergePatchAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			err = writer.WriteAnnotations(pod, annotations)
+			Expect(errors.Is(err, ErrPodRecreated)).To(BeTrue())
+		})
+	})
+	Context("Server-side apply writer", func() {
+		It("Write annotations", func() {
+			client := &mocks.Client{}
+			client.On("ApplyPod", pod, mock.Anything, FieldManager, false).Return(nil)
+
+			writer, err := NewAnnotationWriter(ServerSideApplyAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.WriteAnnotations(pod, map[string]string{"key": "value"})).To(Succeed())
+
+			applyData := client.Calls[0].Arguments.Get(1).([]byte)
+			Expect(applyData).To(MatchJSON(`{"apiVersion": "v1", "kind": "Pod", "metadata": {
+				"name": "pod", "namespace": "default", "uid": "uid", "resourceVersion": "10",
+				"annotations": {"key": "value"}}}`))
+		})
+		It("Write annotations of concurrently modified pod", func() {
+			client := &mocks.Client{}
+			client.On("ApplyPod", pod, mock.Anything, FieldManager, false).Return(conflict)
+			client.On("GetPod", "default", "pod").Return(pod.DeepCopy(), nil)
+
+			writer, err := NewAnnotationWriter(ServerSideApplyAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			err = writer.WriteAnnotations(pod, map[string]string{"key": "value"})
+			Expect(errors.Is(err, ErrAnnotationConflict)).To(BeTrue())
+			Expect(errors.Is(err, ErrPodRecreated)).To(BeFalse())
+		})
+		It("Take over annotations set by the pod creator", func() {
+			client := &mocks.Client{}
+			client.On("ApplyPod", pod, mock.Anything, FieldManager, false).Return(applyConflict)
+			current := pod.DeepCopy()
+			current.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl-create",
+				Operation: metav1.ManagedFieldsOperationUpdate, FieldsV1: &metav1.FieldsV1{Raw: []byte(
+					`{"f:metadata": {"f:annotations": {"f:key": {}}}}`)}}}
+			client.On("GetPod", "default", "pod").Return(current, nil)
+			client.On("ApplyPod", pod, mock.Anything, FieldManager, true).Return(nil)
+
+			writer, err := NewAnnotationWriter(ServerSideApplyAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.WriteAnnotations(pod, map[string]string{"key": "value"})).To(Succeed())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Don't take over annotations applied by another field manager", func() {
+			client := &mocks.Client{}
+			client.On("ApplyPod", pod, mock.Anything, FieldManager, false).Return(applyConflict)
+			current := pod.DeepCopy()
+			current.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "other-controller",
+				Operation: metav1.ManagedFieldsOperationApply, FieldsV1: &metav1.FieldsV1{Raw: []byte(
+					`{"f:metadata": {"f:annotations": {"f:key": {}}}}`)}}}
+			client.On("GetPod", "default", "pod").Return(current, nil)
+
+			writer, err := NewAnnotationWriter(ServerSideApplyAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			err = writer.WriteAnnotations(pod, map[string]string{"key": "value"})
+			Expect(errors.Is(err, ErrAnnotationOwned)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("other-controller"))
+			client.AssertNotCalled(GinkgoT(), "ApplyPod", pod, mock.Anything, FieldManager, true)
+		})
+		It("Write annotations of deleted pod", func() {
+			client := &mocks.Client{}
+			client.On("ApplyPod", pod, mock.Anything, FieldManager, false).Return(kerrors.NewInvalid(
+				schema.GroupKind{Kind: "Pod"}, "pod", nil))
+			client.On("GetPod", "default", "pod").Return(nil,
+				kerrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "pod"))
+
+			writer, err := NewAnnotationWriter(ServerSideApplyAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			err = writer.WriteAnnotations(pod, map[string]string{"key": "value"})
+			Expect(errors.Is(err, ErrPodRecreated)).To(BeTrue())
+		})
+		It("Write annotations failure", func() {
+			client := &mocks.Client{}
+			client.On("ApplyPod", pod, mock.Anything, FieldManager, false).Return(errors.New("failed"))
+
+			writer, err := NewAnnotationWriter(ServerSideApplyAnnotationWriter, client)
+			Expect(err).ToNot(HaveOccurred())
+			err = writer.WriteAnnotations(pod, map[string]string{"key": "value"})
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, ErrAnnotationConflict)).To(BeFalse())
+		})
+	})
+})
@@ -4,39 +4,91 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	netclient "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/typed/k8s.cni.cncf.io/v1"
 	"github.com/rs/zerolog/log"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	kapi "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+	"github.com/Mellanox/ib-kubernetes/pkg/tracing"
 )
 
 type Client interface {
+	GetPod(namespace, name string) (*kapi.Pod, error)
 	GetPods(namespace string) (*kapi.PodList, error)
+	GetPodsPage(namespace string, limit int64, continueToken string) (*kapi.PodList, error)
+	ScopePodsToNode(nodeName string)
 	SetAnnotationsOnPod(pod *kapi.Pod, annotations map[string]string) error
 	PatchPod(pod *kapi.Pod, patchType types.PatchType, patchData []byte) error
+	ApplyPod(pod *kapi.Pod, applyData []byte, fieldManager string, force bool) error
+	CreatePodEvent(pod *kapi.Pod, eventType, reason, message string) error
+	CreateNetworkAttachmentDefinitionEvent(netAttDef *netapi.NetworkAttachmentDefinition, eventType, reason,
+		message string) error
+	CreateLeaseEvent(namespace, name, eventType, reason, message string) error
+	GetNode(name string) (*kapi.Node, error)
+	GetNodes() (*kapi.NodeList, error)
+	SetNodeExtendedResource(name string, resource kapi.ResourceName, quantity int64) error
+	GetConfigMap(namespace, name string) (*kapi.ConfigMap, error)
+	CreateConfigMap(configMap *kapi.ConfigMap) (*kapi.ConfigMap, error)
+	UpdateConfigMap(configMap *kapi.ConfigMap) (*kapi.ConfigMap, error)
+	CreateTokenReview(token string, audiences []string) (*authenticationv1.TokenReview, error)
 	GetNetworkAttachmentDefinition(namespace, name string) (*netapi.NetworkAttachmentDefinition, error)
+	GetNetworkAttachmentDefinitions(namespace string) (*netapi.NetworkAttachmentDefinitionList, error)
+	SetAnnotationsOnNetworkAttachmentDefinition(netAttDef *netapi.NetworkAttachmentDefinition,
+		annotations map[string]string) error
 	GetRestClient() rest.Interface
+	GetCoordinationV1() coordinationv1.CoordinationV1Interface
+	GetNetClient() netclient.K8sCniCncfIoV1Interface
+	GetGUIDReservations(namespace string) (*v1alpha1.IBGuidReservationList, error)
+	UpdateGUIDReservation(reservation *v1alpha1.IBGuidReservation) (*v1alpha1.IBGuidReservation, error)
+	UpdateGUIDReservationStatus(reservation *v1alpha1.IBGuidReservation) (*v1alpha1.IBGuidReservation, error)
+	GetPartitionPolicies() (*v1alpha1.IBPartitionPolicyList, error)
+	GetSecret(namespace, name string) (*kapi.Secret, error)
+	GetNicClusterPolicy(name string) (*unstructured.Unstructured, error)
 }
 
+// NicClusterPolicyResource is the resource of the cluster scoped NicClusterPolicy of the NVIDIA network-operator
+var NicClusterPolicyResource = schema.GroupVersionResource{
+	Group: "mellanox.com", Version: "v1alpha1", Resource: "nicclusterpolicies"}
+
+// PodNodeNameField is the pod field of the name of the node the pod is bound to
+const PodNodeNameField = "spec.nodeName"
+
+// eventSourceComponent is the source component of the events created by ib-kubernetes
+const eventSourceComponent = "ib-kubernetes"
+
 type client struct {
-	clientset kubernetes.Interface
-	netClient netclient.K8sCniCncfIoV1Interface
+	clientset     kubernetes.Interface
+	netClient     netclient.K8sCniCncfIoV1Interface
+	dynamicClient dynamic.Interface
+	// podFieldSelector selects the pods listed by GetPods and GetPodsPage, all the pods if empty
+	podFieldSelector string
 }
 
-// NewK8sClient returns a kubernetes client
-func NewK8sClient() (Client, error) {
+// NewK8sClient returns a kubernetes client limited to qps queries per second with bursts of burst queries
+func NewK8sClient(qps float32, burst int) (Client, error) {
 	// Get a config to talk to the api server
 	log.Debug().Msg("Setting up kubernetes client")
 	conf, err := config.GetConfig()
 	if err != nil {
 		return nil, fmt.Errorf("unable to set up client config error %v", err)
 	}
+	conf.Wrap(tracing.WrapTransport)
+	ConfigureRateLimiter(conf, qps, burst)
 
 	clientset, err := kubernetes.NewForConfig(conf)
 	if err != nil {
@@ -48,16 +100,54 @@ func NewK8sClient() (Client, error) {
 		return nil, fmt.Errorf("unable to create a network attachment client: %v", err)
 	}
 
-	return &client{clientset: clientset, netClient: netClient}, nil
+	dynamicClient, err := dynamic.NewForConfig(conf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a dynamic client: %v", err)
+	}
+
+	return NewK8sClientFromInterfaces(clientset, netClient, dynamicClient), nil
+}
+
+// NewK8sClientFromInterfaces returns a kubernetes client using the given clientsets,
+// it allows to create a client backed by fake clientsets in unit tests
+func NewK8sClientFromInterfaces(clientset kubernetes.Interface, netClient netclient.K8sCniCncfIoV1Interface,
+	dynamicClient dynamic.Interface) Client {
+	return &client{clientset: clientset, netClient: netClient, dynamicClient: dynamicClient}
+}
+
+// GetPod obtains the Pod resource from kubernetes api server for given namespace and name
+func (c *client) GetPod(namespace, name string) (*kapi.Pod, error) {
+	log.Debug().Msgf("getting pod namespace %s, name %s", namespace, name)
+	return c.clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 }
 
 // GetPods obtains the Pods resources from kubernetes api server for given namespace
 func (c *client) GetPods(namespace string) (*kapi.PodList, error) {
 	log.Debug().Msgf("getting pods in namespace %s", namespace)
-	return c.clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+	return c.clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: c.podFieldSelector})
 }
 
-// SetAnnotationsOnPod takes the pod object and map of key/value string pairs to set as annotations
+// GetPodsPage obtains a single page of at most limit Pods resources for given namespace,
+// continueToken is the continue value of the previous page or empty for the first page
+func (c *client) GetPodsPage(namespace string, limit int64, continueToken string) (*kapi.PodList, error) {
+	log.Debug().Msgf("getting pods page in namespace %s, limit %d, continue %q", namespace, limit, continueToken)
+	return c.clientset.CoreV1().Pods(namespace).List(context.TODO(),
+		metav1.ListOptions{Limit: limit, Continue: continueToken, FieldSelector: c.podFieldSelector})
+}
+
+// ScopePodsToNode limits the pods listed by GetPods and GetPodsPage to the pods bound to the given node,
+// empty node name lists all the pods
+func (c *client) ScopePodsToNode(nodeName string) {
+	c.podFieldSelector = ""
+	if nodeName != "" {
+		c.podFieldSelector = fields.OneTermEqualSelector(PodNodeNameField, nodeName).String()
+	}
+}
+
+// SetAnnotationsOnPod takes the pod object and map of key/value string pairs to set as annotations.
+// The patch is preconditioned on the pod UID, so it fails with a conflict if the pod was recreated with the same
+// name since it was read.
 func (c *client) SetAnnotationsOnPod(pod *kapi.Pod, annotations map[string]string) error {
 	log.Debug().Msgf("Setting annotation on pod, namespace: %s, podName: %s, annotations: %v",
 		pod.Namespace, pod.Name, annotations)
@@ -70,6 +160,9 @@ func (c *client) SetAnnotationsOnPod(pod *kapi.Pod, annotations map[string]strin
 			"annotations": annotations,
 		},
 	}
+	if pod.UID != "" {
+		patch.Metadata["uid"] = pod.UID
+	}
 
 	podDesc := pod.Namespace + "/" + pod.Name
 	patchData, err = json.Marshal(&patch)
@@ -87,13 +180,268 @@ func (c *client) PatchPod(pod *kapi.Pod, patchType types.PatchType, patchData []
 	return err
 }
 
+// ApplyPod applies the given pod configuration with server-side apply as the given field manager. Fields owned
+// by other managers are taken over if force is set, otherwise the apply fails with a field manager conflict.
+func (c *client) ApplyPod(pod *kapi.Pod, applyData []byte, fieldManager string, force bool) error {
+	log.Debug().Msgf("apply pod, namespace: %s, podName: %s, fieldManager: %s, force: %v", pod.Namespace, pod.Name,
+		fieldManager, force)
+	_, err := c.clientset.CoreV1().Pods(pod.Namespace).Patch(context.TODO(), pod.Name, types.ApplyPatchType, applyData,
+		metav1.PatchOptions{FieldManager: fieldManager, Force: &force})
+	return err
+}
+
+// CreatePodEvent records kubernetes event of the given type, reason and message on the pod
+func (c *client) CreatePodEvent(pod *kapi.Pod, eventType, reason, message string) error {
+	log.Debug().Msgf("creating %s event %s on pod, namespace: %s, podName: %s", eventType, reason,
+		pod.Namespace, pod.Name)
+	return c.createEvent(kapi.ObjectReference{
+		Kind: "Pod", APIVersion: "v1", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID,
+		ResourceVersion: pod.ResourceVersion}, eventType, reason, message)
+}
+
+// CreateNetworkAttachmentDefinitionEvent records kubernetes event of the given type, reason and message on the
+// network attachment definition
+func (c *client) CreateNetworkAttachmentDefinitionEvent(netAttDef *netapi.NetworkAttachmentDefinition, eventType,
+	reason, message string) error {
+	log.Debug().Msgf("creating %s event %s on network attachment definition, namespace: %s, name: %s", eventType,
+		reason, netAttDef.Namespace, netAttDef.Name)
+	return c.createEvent(kapi.ObjectReference{
+		Kind: "NetworkAttachmentDefinition", APIVersion: netapi.SchemeGroupVersion.String(),
+		Namespace: netAttDef.Namespace, Name: netAttDef.Name, UID: netAttDef.UID,
+		ResourceVersion: netAttDef.ResourceVersion}, eventType, reason, message)
+}
+
+// CreateLeaseEvent records kubernetes event of the given type, reason and message on the lease of the given
+// namespace and name, e.g. the leader election lease
+func (c *client) CreateLeaseEvent(namespace, name, eventType, reason, message string) error {
+	log.Debug().Msgf("creating %s event %s on lease, namespace: %s, name: %s", eventType, reason, namespace, name)
+	return c.createEvent(kapi.ObjectReference{
+		Kind: "Lease", APIVersion: "coordination.k8s.io/v1", Namespace: namespace, Name: name}, eventType, reason,
+		message)
+}
+
+// createEvent records kubernetes event of the given type, reason and message on the involved object
+func (c *client) createEvent(involved kapi.ObjectReference, eventType, reason, message string) error {
+	now := metav1.Now()
+	event := &kapi.Event{
+		ObjectMeta:     metav1.ObjectMeta{GenerateName: involved.Name + ".", Namespace: involved.Namespace},
+		InvolvedObject: involved,
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Source:         kapi.EventSource{Component: eventSourceComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := c.clientset.CoreV1().Events(involved.Namespace).Create(context.TODO(), event, metav1.CreateOptions{})
+	return err
+}
+
+// GetNode returns the node from kubernetes api server for given name
+func (c *client) GetNode(name string) (*kapi.Node, error) {
+	log.Debug().Msgf("getting Node name %s", name)
+	return c.clientset.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// GetNodes returns the nodes from kubernetes api server
+func (c *client) GetNodes() (*kapi.NodeList, error) {
+	log.Debug().Msg("getting Nodes")
+	return c.clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+}
+
+// SetNodeExtendedResource sets the capacity of the extended resource in the node status, the kubelet sets the
+// allocatable quantity of the node from it
+func (c *client) SetNodeExtendedResource(name string, resource kapi.ResourceName, quantity int64) error {
+	log.Debug().Msgf("setting extended resource %s of Node name %s to %d", resource, name, quantity)
+	data, err := json.Marshal(map[string]interface{}{"status": map[string]interface{}{
+		"capacity": map[kapi.ResourceName]string{resource: strconv.FormatInt(quantity, 10)}}})
+	if err != nil {
+		return err
+	}
+	_, err = c.clientset.CoreV1().Nodes().Patch(context.TODO(), name, types.MergePatchType, data,
+		metav1.PatchOptions{}, "status")
+	return err
+}
+
+// GetConfigMap returns the config map from kubernetes api server for given namespace and name
+func (c *client) GetConfigMap(namespace, name string) (*kapi.ConfigMap, error) {
+	log.Debug().Msgf("getting ConfigMap namespace %s, name %s", namespace, name)
+	return c.clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// GetSecret returns the secret from kubernetes api server for given namespace and name
+func (c *client) GetSecret(namespace, name string) (*kapi.Secret, error) {
+	log.Debug().Msgf("getting Secret namespace %s, name %s", namespace, name)
+	return c.clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// CreateConfigMap creates the config map in kubernetes api server
+func (c *client) CreateConfigMap(configMap *kapi.ConfigMap) (*kapi.ConfigMap, error) {
+	log.Debug().Msgf("creating ConfigMap namespace %s, name %s", configMap.Namespace, configMap.Name)
+	return c.clientset.CoreV1().ConfigMaps(configMap.Namespace).Create(context.TODO(), configMap,
+		metav1.CreateOptions{})
+}
+
+// UpdateConfigMap updates the config map in kubernetes api server
+func (c *client) UpdateConfigMap(configMap *kapi.ConfigMap) (*kapi.ConfigMap, error) {
+	log.Debug().Msgf("updating ConfigMap namespace %s, name %s", configMap.Namespace, configMap.Name)
+	return c.clientset.CoreV1().ConfigMaps(configMap.Namespace).Update(context.TODO(), configMap,
+		metav1.UpdateOptions{})
+}
+
+// CreateTokenReview reviews the bearer token with kubernetes api server, the token must be issued for one of the
+// audiences if any
+func (c *client) CreateTokenReview(token string, audiences []string) (*authenticationv1.TokenReview, error) {
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: audiences}}
+	return c.clientset.AuthenticationV1().TokenReviews().Create(context.TODO(), review, metav1.CreateOptions{})
+}
+
 // GetNetworkAttachmentDefinition returns the network crd from kubernetes api server for given namespace and name
 func (c *client) GetNetworkAttachmentDefinition(namespace, name string) (*netapi.NetworkAttachmentDefinition, error) {
 	log.Debug().Msgf("getting NetworkAttachmentDefinition namespace %s, name: %s", namespace, name)
 	return c.netClient.NetworkAttachmentDefinitions(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 }
 
+// GetNetworkAttachmentDefinitions returns the network crds from kubernetes api server for given namespace
+func (c *client) GetNetworkAttachmentDefinitions(namespace string) (*netapi.NetworkAttachmentDefinitionList, error) {
+	log.Debug().Msgf("getting NetworkAttachmentDefinitions namespace %s", namespace)
+	return c.netClient.NetworkAttachmentDefinitions(namespace).List(context.TODO(), metav1.ListOptions{})
+}
+
+// SetAnnotationsOnNetworkAttachmentDefinition sets the annotations on the network crd with merge patch. The patch
+// is conditioned on the resource version of the given network if set, so it fails with a conflict if the network
+// was modified since it was read.
+func (c *client) SetAnnotationsOnNetworkAttachmentDefinition(netAttDef *netapi.NetworkAttachmentDefinition,
+	annotations map[string]string) error {
+	log.Debug().Msgf("Setting annotation on NetworkAttachmentDefinition, namespace: %s, name: %s, annotations: %v",
+		netAttDef.Namespace, netAttDef.Name, annotations)
+	patch := struct {
+		Metadata map[string]interface{} `json:"metadata"`
+	}{
+		Metadata: map[string]interface{}{
+			"annotations": annotations,
+		},
+	}
+	if netAttDef.ResourceVersion != "" {
+		patch.Metadata["resourceVersion"] = netAttDef.ResourceVersion
+	}
+
+	patchData, err := json.Marshal(&patch)
+	if err != nil {
+		return fmt.Errorf("failed to set annotations on NetworkAttachmentDefinition %s/%s: %v",
+			netAttDef.Namespace, netAttDef.Name, err)
+	}
+	_, err = c.netClient.NetworkAttachmentDefinitions(netAttDef.Namespace).Patch(
+		context.TODO(), netAttDef.Name, types.MergePatchType, patchData, metav1.PatchOptions{})
+	return err
+}
+
 // GetRestClient returns the client rest api for k8s
 func (c *client) GetRestClient() rest.Interface {
 	return c.clientset.CoreV1().RESTClient()
 }
+
+// GetCoordinationV1 returns the client for the coordination.k8s.io api group
+func (c *client) GetCoordinationV1() coordinationv1.CoordinationV1Interface {
+	return c.clientset.CoordinationV1()
+}
+
+// GetNetClient returns the client for the k8s.cni.cncf.io api group
+func (c *client) GetNetClient() netclient.K8sCniCncfIoV1Interface {
+	return c.netClient
+}
+
+// GetGUIDReservations obtains the IBGuidReservation resources from kubernetes api server for given namespace
+func (c *client) GetGUIDReservations(namespace string) (*v1alpha1.IBGuidReservationList, error) {
+	log.Debug().Msgf("getting IBGuidReservations in namespace %s", namespace)
+	list, err := c.dynamicClient.Resource(v1alpha1.IBGuidReservationResource).Namespace(namespace).List(
+		context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	reservations := &v1alpha1.IBGuidReservationList{}
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(list.UnstructuredContent(), reservations); err != nil {
+		return nil, fmt.Errorf("failed to convert IBGuidReservation list: %v", err)
+	}
+	return reservations, nil
+}
+
+// UpdateGUIDReservation updates the IBGuidReservation object, excluding its status
+func (c *client) UpdateGUIDReservation(
+	reservation *v1alpha1.IBGuidReservation) (*v1alpha1.IBGuidReservation, error) {
+	log.Debug().Msgf("updating IBGuidReservation namespace %s, name %s", reservation.Namespace, reservation.Name)
+	obj, err := toUnstructuredGUIDReservation(reservation)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := c.dynamicClient.Resource(v1alpha1.IBGuidReservationResource).Namespace(
+		reservation.Namespace).Update(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructuredGUIDReservation(updated)
+}
+
+// UpdateGUIDReservationStatus updates the status of IBGuidReservation object
+func (c *client) UpdateGUIDReservationStatus(
+	reservation *v1alpha1.IBGuidReservation) (*v1alpha1.IBGuidReservation, error) {
+	log.Debug().Msgf("updating IBGuidReservation status namespace %s, name %s, status %+v",
+		reservation.Namespace, reservation.Name, reservation.Status)
+	obj, err := toUnstructuredGUIDReservation(reservation)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := c.dynamicClient.Resource(v1alpha1.IBGuidReservationResource).Namespace(
+		reservation.Namespace).UpdateStatus(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromUnstructuredGUIDReservation(updated)
+}
+
+// GetPartitionPolicies obtains the cluster scoped IBPartitionPolicy resources from kubernetes api server
+func (c *client) GetPartitionPolicies() (*v1alpha1.IBPartitionPolicyList, error) {
+	log.Debug().Msg("getting IBPartitionPolicies")
+	list, err := c.dynamicClient.Resource(v1alpha1.IBPartitionPolicyResource).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	policies := &v1alpha1.IBPartitionPolicyList{}
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(list.UnstructuredContent(), policies); err != nil {
+		return nil, fmt.Errorf("failed to convert IBPartitionPolicy list: %v", err)
+	}
+	return policies, nil
+}
+
+func toUnstructuredGUIDReservation(reservation *v1alpha1.IBGuidReservation) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(reservation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert IBGuidReservation %s/%s: %v",
+			reservation.Namespace, reservation.Name, err)
+	}
+
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetGroupVersionKind(v1alpha1.GroupVersion.WithKind("IBGuidReservation"))
+	return obj, nil
+}
+
+func fromUnstructuredGUIDReservation(obj *unstructured.Unstructured) (*v1alpha1.IBGuidReservation, error) {
+	reservation := &v1alpha1.IBGuidReservation{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), reservation); err != nil {
+		return nil, fmt.Errorf("failed to convert IBGuidReservation %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return reservation, nil
+}
+
+// GetNicClusterPolicy obtains the NicClusterPolicy of the NVIDIA network-operator for given name, it's returned as
+// unstructured object as only a few of its fields are used
+func (c *client) GetNicClusterPolicy(name string) (*unstructured.Unstructured, error) {
+	log.Debug().Msgf("getting NicClusterPolicy name %s", name)
+	return c.dynamicClient.Resource(NicClusterPolicyResource).Get(context.TODO(), name, metav1.GetOptions{})
+}
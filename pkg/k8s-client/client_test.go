@@ -0,0 +1,74 @@
+package k8sclient
+
+import (
+	"context"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	netfake "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Client", func() {
+	It("Scope the listed pods to the node", func() {
+		clientset := k8sfake.NewSimpleClientset()
+		var selectors []string
+		clientset.PrependReactor("list", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+			selectors = append(selectors, action.(k8sTesting.ListAction).GetListRestrictions().Fields.String())
+			return false, nil, nil
+		})
+		client := NewK8sClientFromInterfaces(clientset, nil, nil)
+
+		client.ScopePodsToNode("node1")
+		_, err := client.GetPods("")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.GetPodsPage("", 10, "")
+		Expect(err).ToNot(HaveOccurred())
+		client.ScopePodsToNode("")
+		_, err = client.GetPods("")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(selectors).To(Equal([]string{"spec.nodeName=node1", "spec.nodeName=node1", ""}))
+	})
+	It("Set the extended resource capacity of the node", func() {
+		clientset := k8sfake.NewSimpleClientset(&kapi.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status: kapi.NodeStatus{Capacity: kapi.ResourceList{kapi.ResourceCPU: resource.MustParse("4")}}})
+		client := NewK8sClientFromInterfaces(clientset, nil, nil)
+
+		Expect(client.SetNodeExtendedResource("node1", "example.com/guid", 12)).To(Succeed())
+
+		node, err := clientset.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(node.Status.Capacity).To(HaveLen(2))
+		quantity := node.Status.Capacity["example.com/guid"]
+		Expect(quantity.Value()).To(Equal(int64(12)))
+	})
+	It("Annotate the network attachment definition of the read resource version", func() {
+		netClientset := netfake.NewSimpleClientset()
+		var patches []string
+		netClientset.PrependReactor("patch", "network-attachment-definitions",
+			func(action k8sTesting.Action) (bool, runtime.Object, error) {
+				patches = append(patches, string(action.(k8sTesting.PatchAction).GetPatch()))
+				return true, &netapi.NetworkAttachmentDefinition{}, nil
+			})
+		client := NewK8sClientFromInterfaces(nil, netClientset.K8sCniCncfIoV1(), nil)
+
+		netAttDef := &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "nad", Namespace: "default", ResourceVersion: "7"}}
+		Expect(client.SetAnnotationsOnNetworkAttachmentDefinition(netAttDef, map[string]string{"key": "value"})).To(
+			Succeed())
+		netAttDef.ResourceVersion = ""
+		Expect(client.SetAnnotationsOnNetworkAttachmentDefinition(netAttDef, map[string]string{"key": "value"})).To(
+			Succeed())
+
+		Expect(patches).To(Equal([]string{
+			`{"metadata":{"annotations":{"key":"value"},"resourceVersion":"7"}}`,
+			`{"metadata":{"annotations":{"key":"value"}}}`}))
+	})
+})
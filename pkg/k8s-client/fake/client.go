@@ -0,0 +1,70 @@
+// Package fake provides a kubernetes client backed by in-memory fake clientsets,
+// to be used in unit tests instead of a real kubernetes api server.
+package fake
+
+import (
+	"fmt"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	netfake "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/fake"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+	k8sClient "github.com/Mellanox/ib-kubernetes/pkg/k8s-client"
+)
+
+var netAttDefResource = schema.GroupVersionResource{
+	Group: "k8s.cni.cncf.io", Version: "v1", Resource: "network-attachment-definitions"}
+
+// Client is a kubernetes client with access to the underlying fake clientsets
+type Client struct {
+	k8sClient.Client
+	Clientset     *k8sfake.Clientset
+	NetClientset  *netfake.Clientset
+	DynamicClient *dynamicfake.FakeDynamicClient
+}
+
+// NewClient returns a fake kubernetes client tracking the given objects,
+// NetworkAttachmentDefinition objects are tracked by the network attachment clientset
+// and IBGuidReservation, IBPartitionPolicy and unstructured objects, e.g. NicClusterPolicy, by the dynamic client
+func NewClient(objects ...runtime.Object) *Client {
+	var coreObjects, netObjects, dynamicObjects []runtime.Object
+	for _, obj := range objects {
+		switch obj.(type) {
+		case *netapi.NetworkAttachmentDefinition:
+			netObjects = append(netObjects, obj)
+		case *v1alpha1.IBGuidReservation, *v1alpha1.IBPartitionPolicy, *unstructured.Unstructured:
+			dynamicObjects = append(dynamicObjects, obj)
+		default:
+			coreObjects = append(coreObjects, obj)
+		}
+	}
+
+	clientset := k8sfake.NewSimpleClientset(coreObjects...)
+	// object tracker can't guess the plural resource name of NetworkAttachmentDefinition, add objects explicitly
+	netClientset := netfake.NewSimpleClientset()
+	for _, obj := range netObjects {
+		netAttDef := obj.(*netapi.NetworkAttachmentDefinition)
+		if err := netClientset.Tracker().Create(netAttDefResource, netAttDef, netAttDef.Namespace); err != nil {
+			panic(fmt.Sprintf("failed to add network attachment definition %s/%s to fake clientset: %v",
+				netAttDef.Namespace, netAttDef.Name, err))
+		}
+	}
+
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		panic(fmt.Sprintf("failed to create fake dynamic client scheme: %v", err))
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme, dynamicObjects...)
+
+	return &Client{
+		Client:        k8sClient.NewK8sClientFromInterfaces(clientset, netClientset.K8sCniCncfIoV1(), dynamicClient),
+		Clientset:     clientset,
+		NetClientset:  netClientset,
+		DynamicClient: dynamicClient,
+	}
+}
@@ -0,0 +1,13 @@
+package fake
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFakeClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake Kubernetes Client Suite")
+}
@@ -0,0 +1,116 @@
+package fake
+
+import (
+	"context"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+)
+
+var _ = Describe("Fake Kubernetes Client", func() {
+	var (
+		pod *kapi.Pod
+		nad *netapi.NetworkAttachmentDefinition
+	)
+
+	BeforeEach(func() {
+		pod = &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"}}
+		nad = &netapi.NetworkAttachmentDefinition{ObjectMeta: metav1.ObjectMeta{Name: "nad", Namespace: "default"},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{Config: `{"type": "ib-sriov"}`}}
+	})
+
+	It("Get tracked pods and network attachment definitions", func() {
+		client := NewClient(pod, nad)
+
+		pods, err := client.GetPods(kapi.NamespaceAll)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pods.Items).To(HaveLen(1))
+		Expect(pods.Items[0].Name).To(Equal("pod"))
+
+		netAttDef, err := client.GetNetworkAttachmentDefinition("default", "nad")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(netAttDef.Spec.Config).To(Equal(`{"type": "ib-sriov"}`))
+
+		netAttDef, err = client.GetNetClient().NetworkAttachmentDefinitions("default").Get(
+			context.Background(), "nad", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(netAttDef.Name).To(Equal("nad"))
+	})
+	It("Set annotations on pod", func() {
+		client := NewClient(pod)
+
+		err := client.SetAnnotationsOnPod(pod, map[string]string{"key": "value"})
+		Expect(err).ToNot(HaveOccurred())
+
+		updatedPod, err := client.Clientset.CoreV1().Pods("default").Get(context.Background(), "pod", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updatedPod.Annotations).To(HaveKeyWithValue("key", "value"))
+	})
+	It("Create, get and update config map", func() {
+		client := NewClient()
+
+		_, err := client.CreateConfigMap(&kapi.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"}, Data: map[string]string{"key": "value"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		configMap, err := client.GetConfigMap("default", "cm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configMap.Data).To(HaveKeyWithValue("key", "value"))
+
+		configMap.Data["key"] = "updated"
+		_, err = client.UpdateConfigMap(configMap)
+		Expect(err).ToNot(HaveOccurred())
+
+		configMap, err = client.GetConfigMap("default", "cm")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configMap.Data).To(HaveKeyWithValue("key", "updated"))
+	})
+	It("Create pod event", func() {
+		client := NewClient(pod)
+
+		err := client.CreatePodEvent(pod, kapi.EventTypeWarning, "Reason", "message")
+		Expect(err).ToNot(HaveOccurred())
+
+		events, err := client.Clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events.Items).To(HaveLen(1))
+		Expect(events.Items[0].InvolvedObject.Name).To(Equal("pod"))
+		Expect(events.Items[0].Reason).To(Equal("Reason"))
+		Expect(events.Items[0].Source.Component).To(Equal("ib-kubernetes"))
+	})
+	It("List and annotate network attachment definitions", func() {
+		client := NewClient(nad)
+
+		netAttDefs, err := client.GetNetworkAttachmentDefinitions(kapi.NamespaceAll)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(netAttDefs.Items).To(HaveLen(1))
+
+		err = client.SetAnnotationsOnNetworkAttachmentDefinition(nad, map[string]string{"key": "value"})
+		Expect(err).ToNot(HaveOccurred())
+
+		netAttDef, err := client.GetNetworkAttachmentDefinition("default", "nad")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(netAttDef.Annotations).To(HaveKeyWithValue("key", "value"))
+	})
+	It("List partition policies", func() {
+		policy := &v1alpha1.IBPartitionPolicy{ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec: v1alpha1.IBPartitionPolicySpec{Namespaces: []string{"team-a"}, PKeys: []string{"0x100-0x1FF"}}}
+		client := NewClient(policy)
+
+		policies, err := client.GetPartitionPolicies()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policies.Items).To(HaveLen(1))
+		Expect(policies.Items[0].Spec).To(Equal(policy.Spec))
+	})
+	It("Get coordination client", func() {
+		client := NewClient()
+		Expect(client.GetCoordinationV1()).ToNot(BeNil())
+		_, err := client.GetCoordinationV1().Leases("default").List(context.Background(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
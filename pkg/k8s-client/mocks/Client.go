@@ -2,18 +2,251 @@
 
 package mocks
 
+import authenticationv1 "k8s.io/api/authentication/v1"
 import corev1 "k8s.io/api/core/v1"
 
 import mock "github.com/stretchr/testify/mock"
 import rest "k8s.io/client-go/rest"
 import types "k8s.io/apimachinery/pkg/types"
+import unstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 import v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+import coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+import v1alpha1 "github.com/Mellanox/ib-kubernetes/api/v1alpha1"
+import k8scnicncfiov1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/typed/k8s.cni.cncf.io/v1"
 
 // Client is an autogenerated mock type for the Client type
 type Client struct {
 	mock.Mock
 }
 
+// ApplyPod provides a mock function with given fields: pod, applyData, fieldManager, force
+func (_m *Client) ApplyPod(pod *corev1.Pod, applyData []byte, fieldManager string, force bool) error {
+	ret := _m.Called(pod, applyData, fieldManager, force)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*corev1.Pod, []byte, string, bool) error); ok {
+		r0 = rf(pod, applyData, fieldManager, force)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateConfigMap provides a mock function with given fields: configMap
+func (_m *Client) CreateConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	ret := _m.Called(configMap)
+
+	var r0 *corev1.ConfigMap
+	if rf, ok := ret.Get(0).(func(*corev1.ConfigMap) *corev1.ConfigMap); ok {
+		r0 = rf(configMap)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*corev1.ConfigMap)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*corev1.ConfigMap) error); ok {
+		r1 = rf(configMap)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateLeaseEvent provides a mock function with given fields: namespace, name, eventType, reason, message
+func (_m *Client) CreateLeaseEvent(namespace string, name string, eventType string, reason string,
+	message string) error {
+	ret := _m.Called(namespace, name, eventType, reason, message)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string, string, string) error); ok {
+		r0 = rf(namespace, name, eventType, reason, message)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateNetworkAttachmentDefinitionEvent provides a mock function with given fields: netAttDef, eventType, reason, message
+func (_m *Client) CreateNetworkAttachmentDefinitionEvent(netAttDef *v1.NetworkAttachmentDefinition, eventType string,
+	reason string, message string) error {
+	ret := _m.Called(netAttDef, eventType, reason, message)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*v1.NetworkAttachmentDefinition, string, string, string) error); ok {
+		r0 = rf(netAttDef, eventType, reason, message)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreatePodEvent provides a mock function with given fields: pod, eventType, reason, message
+func (_m *Client) CreatePodEvent(pod *corev1.Pod, eventType string, reason string, message string) error {
+	ret := _m.Called(pod, eventType, reason, message)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*corev1.Pod, string, string, string) error); ok {
+		r0 = rf(pod, eventType, reason, message)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateTokenReview provides a mock function with given fields: token, audiences
+func (_m *Client) CreateTokenReview(token string, audiences []string) (*authenticationv1.TokenReview, error) {
+	ret := _m.Called(token, audiences)
+
+	var r0 *authenticationv1.TokenReview
+	if rf, ok := ret.Get(0).(func(string, []string) *authenticationv1.TokenReview); ok {
+		r0 = rf(token, audiences)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*authenticationv1.TokenReview)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, []string) error); ok {
+		r1 = rf(token, audiences)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetConfigMap provides a mock function with given fields: namespace, name
+func (_m *Client) GetConfigMap(namespace string, name string) (*corev1.ConfigMap, error) {
+	ret := _m.Called(namespace, name)
+
+	var r0 *corev1.ConfigMap
+	if rf, ok := ret.Get(0).(func(string, string) *corev1.ConfigMap); ok {
+		r0 = rf(namespace, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*corev1.ConfigMap)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(namespace, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetNode provides a mock function with given fields: name
+func (_m *Client) GetNode(name string) (*corev1.Node, error) {
+	ret := _m.Called(name)
+
+	var r0 *corev1.Node
+	if rf, ok := ret.Get(0).(func(string) *corev1.Node); ok {
+		r0 = rf(name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*corev1.Node)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetNodes provides a mock function with given fields:
+func (_m *Client) GetNodes() (*corev1.NodeList, error) {
+	ret := _m.Called()
+
+	var r0 *corev1.NodeList
+	if rf, ok := ret.Get(0).(func() *corev1.NodeList); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*corev1.NodeList)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCoordinationV1 provides a mock function with given fields:
+func (_m *Client) GetCoordinationV1() coordinationv1.CoordinationV1Interface {
+	ret := _m.Called()
+
+	var r0 coordinationv1.CoordinationV1Interface
+	if rf, ok := ret.Get(0).(func() coordinationv1.CoordinationV1Interface); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(coordinationv1.CoordinationV1Interface)
+		}
+	}
+
+	return r0
+}
+
+// GetGUIDReservations provides a mock function with given fields: namespace
+func (_m *Client) GetGUIDReservations(namespace string) (*v1alpha1.IBGuidReservationList, error) {
+	ret := _m.Called(namespace)
+
+	var r0 *v1alpha1.IBGuidReservationList
+	if rf, ok := ret.Get(0).(func(string) *v1alpha1.IBGuidReservationList); ok {
+		r0 = rf(namespace)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v1alpha1.IBGuidReservationList)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(namespace)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetNetClient provides a mock function with given fields:
+func (_m *Client) GetNetClient() k8scnicncfiov1.K8sCniCncfIoV1Interface {
+	ret := _m.Called()
+
+	var r0 k8scnicncfiov1.K8sCniCncfIoV1Interface
+	if rf, ok := ret.Get(0).(func() k8scnicncfiov1.K8sCniCncfIoV1Interface); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(k8scnicncfiov1.K8sCniCncfIoV1Interface)
+		}
+	}
+
+	return r0
+}
+
 // GetNetworkAttachmentDefinition provides a mock function with given fields: namespace, name
 func (_m *Client) GetNetworkAttachmentDefinition(namespace string, name string) (*v1.NetworkAttachmentDefinition, error) {
 	ret := _m.Called(namespace, name)
@@ -37,6 +270,98 @@ func (_m *Client) GetNetworkAttachmentDefinition(namespace string, name string)
 	return r0, r1
 }
 
+// GetNetworkAttachmentDefinitions provides a mock function with given fields: namespace
+func (_m *Client) GetNetworkAttachmentDefinitions(namespace string) (*v1.NetworkAttachmentDefinitionList, error) {
+	ret := _m.Called(namespace)
+
+	var r0 *v1.NetworkAttachmentDefinitionList
+	if rf, ok := ret.Get(0).(func(string) *v1.NetworkAttachmentDefinitionList); ok {
+		r0 = rf(namespace)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v1.NetworkAttachmentDefinitionList)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(namespace)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPartitionPolicies provides a mock function with given fields:
+func (_m *Client) GetPartitionPolicies() (*v1alpha1.IBPartitionPolicyList, error) {
+	ret := _m.Called()
+
+	var r0 *v1alpha1.IBPartitionPolicyList
+	if rf, ok := ret.Get(0).(func() *v1alpha1.IBPartitionPolicyList); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v1alpha1.IBPartitionPolicyList)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetNicClusterPolicy provides a mock function with given fields: name
+func (_m *Client) GetNicClusterPolicy(name string) (*unstructured.Unstructured, error) {
+	ret := _m.Called(name)
+
+	var r0 *unstructured.Unstructured
+	if rf, ok := ret.Get(0).(func(string) *unstructured.Unstructured); ok {
+		r0 = rf(name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*unstructured.Unstructured)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPod provides a mock function with given fields: namespace, name
+func (_m *Client) GetPod(namespace string, name string) (*corev1.Pod, error) {
+	ret := _m.Called(namespace, name)
+
+	var r0 *corev1.Pod
+	if rf, ok := ret.Get(0).(func(string, string) *corev1.Pod); ok {
+		r0 = rf(namespace, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*corev1.Pod)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(namespace, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetPods provides a mock function with given fields: namespace
 func (_m *Client) GetPods(namespace string) (*corev1.PodList, error) {
 	ret := _m.Called(namespace)
@@ -60,6 +385,29 @@ func (_m *Client) GetPods(namespace string) (*corev1.PodList, error) {
 	return r0, r1
 }
 
+// GetPodsPage provides a mock function with given fields: namespace, limit, continueToken
+func (_m *Client) GetPodsPage(namespace string, limit int64, continueToken string) (*corev1.PodList, error) {
+	ret := _m.Called(namespace, limit, continueToken)
+
+	var r0 *corev1.PodList
+	if rf, ok := ret.Get(0).(func(string, int64, string) *corev1.PodList); ok {
+		r0 = rf(namespace, limit, continueToken)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*corev1.PodList)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, int64, string) error); ok {
+		r1 = rf(namespace, limit, continueToken)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetRestClient provides a mock function with given fields:
 func (_m *Client) GetRestClient() rest.Interface {
 	ret := _m.Called()
@@ -90,6 +438,63 @@ func (_m *Client) PatchPod(pod *corev1.Pod, patchType types.PatchType, patchData
 	return r0
 }
 
+// GetSecret provides a mock function with given fields: namespace, name
+func (_m *Client) GetSecret(namespace string, name string) (*corev1.Secret, error) {
+	ret := _m.Called(namespace, name)
+
+	var r0 *corev1.Secret
+	if rf, ok := ret.Get(0).(func(string, string) *corev1.Secret); ok {
+		r0 = rf(namespace, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*corev1.Secret)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(namespace, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetAnnotationsOnNetworkAttachmentDefinition provides a mock function with given fields: netAttDef, annotations
+func (_m *Client) SetAnnotationsOnNetworkAttachmentDefinition(netAttDef *v1.NetworkAttachmentDefinition,
+	annotations map[string]string) error {
+	ret := _m.Called(netAttDef, annotations)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*v1.NetworkAttachmentDefinition, map[string]string) error); ok {
+		r0 = rf(netAttDef, annotations)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ScopePodsToNode provides a mock function with given fields: nodeName
+func (_m *Client) ScopePodsToNode(nodeName string) {
+	_m.Called(nodeName)
+}
+
+// SetNodeExtendedResource provides a mock function with given fields: name, resource, quantity
+func (_m *Client) SetNodeExtendedResource(name string, resource corev1.ResourceName, quantity int64) error {
+	ret := _m.Called(name, resource, quantity)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, corev1.ResourceName, int64) error); ok {
+		r0 = rf(name, resource, quantity)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SetAnnotationsOnPod provides a mock function with given fields: pod, annotations
 func (_m *Client) SetAnnotationsOnPod(pod *corev1.Pod, annotations map[string]string) error {
 	ret := _m.Called(pod, annotations)
@@ -103,3 +508,72 @@ func (_m *Client) SetAnnotationsOnPod(pod *corev1.Pod, annotations map[string]st
 
 	return r0
 }
+
+// UpdateConfigMap provides a mock function with given fields: configMap
+func (_m *Client) UpdateConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	ret := _m.Called(configMap)
+
+	var r0 *corev1.ConfigMap
+	if rf, ok := ret.Get(0).(func(*corev1.ConfigMap) *corev1.ConfigMap); ok {
+		r0 = rf(configMap)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*corev1.ConfigMap)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*corev1.ConfigMap) error); ok {
+		r1 = rf(configMap)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateGUIDReservation provides a mock function with given fields: reservation
+func (_m *Client) UpdateGUIDReservation(reservation *v1alpha1.IBGuidReservation) (*v1alpha1.IBGuidReservation, error) {
+	ret := _m.Called(reservation)
+
+	var r0 *v1alpha1.IBGuidReservation
+	if rf, ok := ret.Get(0).(func(*v1alpha1.IBGuidReservation) *v1alpha1.IBGuidReservation); ok {
+		r0 = rf(reservation)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v1alpha1.IBGuidReservation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*v1alpha1.IBGuidReservation) error); ok {
+		r1 = rf(reservation)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateGUIDReservationStatus provides a mock function with given fields: reservation
+func (_m *Client) UpdateGUIDReservationStatus(reservation *v1alpha1.IBGuidReservation) (*v1alpha1.IBGuidReservation, error) {
+	ret := _m.Called(reservation)
+
+	var r0 *v1alpha1.IBGuidReservation
+	if rf, ok := ret.Get(0).(func(*v1alpha1.IBGuidReservation) *v1alpha1.IBGuidReservation); ok {
+		r0 = rf(reservation)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*v1alpha1.IBGuidReservation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*v1alpha1.IBGuidReservation) error); ok {
+		r1 = rf(reservation)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,50 @@
+package k8sclient
+
+import (
+	"context"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+)
+
+// throttleCountingRateLimiter is a client side rate limiter of the kubernetes API requests counting the requests
+// which are throttled, i.e. which wait for the rate limiter
+type throttleCountingRateLimiter struct {
+	flowcontrol.RateLimiter
+}
+
+// Accept blocks until the request can be sent, counting it if it's throttled
+func (r *throttleCountingRateLimiter) Accept() {
+	if r.RateLimiter.TryAccept() {
+		return
+	}
+	metrics.K8sClientThrottledRequests.Inc()
+	r.RateLimiter.Accept()
+}
+
+// Wait blocks until the request can be sent or the context is done, counting the request if it's throttled
+func (r *throttleCountingRateLimiter) Wait(ctx context.Context) error {
+	if r.RateLimiter.TryAccept() {
+		return nil
+	}
+	metrics.K8sClientThrottledRequests.Inc()
+	return r.RateLimiter.Wait(ctx)
+}
+
+// ConfigureRateLimiter sets the client side rate limit of the requests of the clients created from the config to
+// qps queries per second with bursts of burst queries, the clients created from the config share the limit. Zero
+// values use the client-go defaults.
+func ConfigureRateLimiter(conf *rest.Config, qps float32, burst int) {
+	if qps == 0 {
+		qps = rest.DefaultQPS
+	}
+	if burst == 0 {
+		burst = rest.DefaultBurst
+	}
+	conf.QPS = qps
+	conf.Burst = burst
+	conf.RateLimiter = &throttleCountingRateLimiter{
+		RateLimiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst)}
+}
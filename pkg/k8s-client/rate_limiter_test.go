@@ -0,0 +1,37 @@
+package k8sclient
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/rest"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
+)
+
+var _ = Describe("Rate Limiter", func() {
+	It("Configure the rate limit of the clients", func() {
+		conf := &rest.Config{}
+		ConfigureRateLimiter(conf, 50, 100)
+		Expect(conf.QPS).To(Equal(float32(50)))
+		Expect(conf.Burst).To(Equal(100))
+		Expect(conf.RateLimiter.QPS()).To(Equal(float32(50)))
+
+		ConfigureRateLimiter(conf, 0, 0)
+		Expect(conf.QPS).To(Equal(rest.DefaultQPS))
+		Expect(conf.Burst).To(Equal(rest.DefaultBurst))
+	})
+	It("Count the throttled requests", func() {
+		conf := &rest.Config{}
+		ConfigureRateLimiter(conf, 10, 2)
+		throttled := testutil.ToFloat64(metrics.K8sClientThrottledRequests)
+
+		// the burst is sent right away, the next request waits for the rate limiter
+		for i := 0; i < 3; i++ {
+			Expect(conf.RateLimiter.Wait(context.Background())).To(Succeed())
+		}
+		Expect(testutil.ToFloat64(metrics.K8sClientThrottledRequests)).To(Equal(throttled + 1))
+	})
+})
@@ -0,0 +1,235 @@
+// Package metrics defines the prometheus metrics exposed by ib-kubernetes daemon
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	namespace = "ib_kubernetes"
+	// readHeaderTimeout limits the time to read metrics requests headers
+	readHeaderTimeout = 10 * time.Second
+)
+
+var (
+	// Registry holds all ib-kubernetes metrics
+	Registry = prometheus.NewRegistry()
+
+	// InitPoolDuration is the time it took to initialize the GUID pool from the running pods on startup
+	InitPoolDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "init_pool_duration_seconds",
+		Help:      "Time in seconds it took to initialize the GUID pool with the GUIDs of running pods",
+	})
+	// InitPoolPods is the number of pods processed while initializing the GUID pool
+	InitPoolPods = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "init_pool_pods",
+		Help:      "Number of pods processed while initializing the GUID pool",
+	})
+	// GenerateGUIDDuration is the time it took the GUID pool to find a free guid
+	GenerateGUIDDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "guid_pool_generate_duration_seconds",
+		Help:      "Time in seconds it took to find a free GUID in the GUID pool",
+		// 1us to ~0.26s
+		Buckets: prometheus.ExponentialBuckets(1e-6, 4, 10),
+	})
+	// GUIDPoolFreeSegments is the number of runs of consecutive free guids in the GUID pool range
+	GUIDPoolFreeSegments = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "guid_pool_free_segments",
+		Help:      "Number of runs of consecutive free GUIDs in the GUID pool range",
+	})
+	// GUIDPoolLongestFreeRun is the number of guids in the longest run of consecutive free guids in the GUID pool
+	GUIDPoolLongestFreeRun = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "guid_pool_longest_free_run",
+		Help:      "Number of GUIDs in the longest run of consecutive free GUIDs in the GUID pool range",
+	})
+	// SMActiveEndpoint is 1 for the subnet manager endpoint currently used by the plugin and 0 for the others
+	SMActiveEndpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sm_active_endpoint",
+		Help:      "Subnet manager endpoint currently used by the plugin, 1 if active and 0 if standby",
+	}, []string{"plugin", "endpoint"})
+	// SMAvailable is 1 once the subnet manager was validated and 0 while the daemon runs in degraded start
+	SMAvailable = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sm_available",
+		Help:      "Whether the subnet manager is validated, 0 while subnet manager updates are deferred",
+	})
+	// GUIDConflicts is the number of pod networks that requested a guid allocated for another pod network
+	GUIDConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "guid_conflicts_total",
+		Help:      "Number of pod networks that requested a GUID already allocated for another pod network",
+	})
+	// GUIDPoolUnownedSMGUIDs is the number of guids of the pool range in use by the subnet manager but not
+	// allocated by the daemon on the last sync, by state "foreign" or "adopted"
+	GUIDPoolUnownedSMGUIDs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "guid_pool_unowned_sm_guids",
+		Help:      "GUIDs of the pool range in use by the subnet manager but not allocated by ib-kubernetes",
+	}, []string{"state"})
+	// FabricDuplicateGUIDs is the number of duplicated guids found by the last fabric audit, by kind "pods" for
+	// guids configured for several running pods and "pkeys" for guids members of several pkeys
+	FabricDuplicateGUIDs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "fabric_duplicate_guids",
+		Help:      "Duplicated GUIDs found by the last fabric audit, configured for several pods or members of several pkeys",
+	}, []string{"kind"})
+	// PKeyMembers is the number of guids the daemon added to each pkey, by pkey
+	PKeyMembers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pkey_members",
+		Help:      "GUIDs of the pod networks added to the pkey",
+	}, []string{"pkey"})
+	// PKeyMemberLimitExceeded is the number of pod networks not configured as their pkey reached its member limit
+	PKeyMemberLimitExceeded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pkey_member_limit_exceeded_total",
+		Help:      "Number of pod networks not added to a pkey which reached the maximum number of members",
+	})
+	// AdoptedPKeyMembers is the number of pkey members added manually adopted for their pod network on startup
+	AdoptedPKeyMembers = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "adopted_pkey_members_total",
+		Help:      "Number of pkey members added before ib-kubernetes managed them adopted for their pod network",
+	})
+	// StalePKeyMembersRemoved is the number of pkey members of the pool range removed on startup as no running pod
+	// or reservation owns them
+	StalePKeyMembersRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stale_pkey_members_removed_total",
+		Help:      "Number of pkey members of the guid pool range not owned by a pod or reservation removed on startup",
+	})
+	// PartitionPolicyViolations is the number of pod networks refused from a pkey not allowed by partition policies
+	PartitionPolicyViolations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "partition_policy_violations_total",
+		Help:      "Number of pod networks not added to a pkey which isn't allowed by the partition policies",
+	})
+	// PendingPods is the number of pods pending in the add and delete maps by network and kind "add" or "delete",
+	// as seen by the last add periodic update
+	PendingPods = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_pods",
+		Help:      "Pods waiting to be added to or deleted from a network by the periodic updates",
+	}, []string{"network", "kind"})
+	// PendingPodsOldestAge is the time the oldest pending pod of a network waits, by network and kind
+	PendingPodsOldestAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_pods_oldest_age_seconds",
+		Help:      "Seconds the oldest pod pending addition to or deletion from a network waits",
+	}, []string{"network", "kind"})
+	// WarmPoolGUIDs is the number of guids pre-allocated for the expected replicas of the workloads
+	WarmPoolGUIDs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "warm_pool_guids",
+		Help:      "GUIDs pre-allocated for the pods expected by the ReplicaSets and StatefulSets",
+	})
+	// PodsDeletedBeforeAnnotation is the number of configured pods deleted before their network annotation was
+	// written, their guids are released and removed from their pkeys
+	PodsDeletedBeforeAnnotation = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pods_deleted_before_annotation_total",
+		Help:      "Number of configured pods deleted before their network annotation was written",
+	})
+	// PodAnnotationConflicts is the number of pod annotation writes failed because the pod was modified, or deleted
+	// and recreated with the same name, since it was read
+	PodAnnotationConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pod_annotation_conflicts_total",
+		Help:      "Number of pod annotation writes failed because the pod was modified or recreated since it was read",
+	})
+	// K8sClientThrottledRequests is the number of kubernetes API requests delayed by the client side rate limiter
+	K8sClientThrottledRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "k8s_client_throttled_requests_total",
+		Help:      "Number of kubernetes API requests delayed by the client side rate limit",
+	})
+	// LeaderElectionTransitions is the number of leader changes of the leader election lease observed by the replica
+	LeaderElectionTransitions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "leader_election_transitions_total",
+		Help:      "Number of leader changes of the leader election lease observed by the replica",
+	})
+	// LeaderElectionLeader is 1 for the identity of the current holder of the leader election lease
+	LeaderElectionLeader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader_election_leader",
+		Help:      "Current holder of the leader election lease, 1 for the identity of the leader",
+	}, []string{"identity"})
+	// LeaderElectionLeaseAcquired is the unix time the replica acquired the leader election lease, 0 if it isn't
+	// the leader
+	LeaderElectionLeaseAcquired = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader_election_lease_acquired_timestamp_seconds",
+		Help:      "Unix time the replica acquired the leader election lease, 0 if it isn't the leader",
+	})
+	// LeaderElectionRenewFailures is the number of failed renewals of the leader election lease held by the replica
+	LeaderElectionRenewFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "leader_election_renew_failures_total",
+		Help:      "Number of failed renewals of the leader election lease held by the replica",
+	})
+)
+
+// The go runtime and process collectors are registered by controller-runtime on its registry, which is served
+// with Registry, registering them twice fails the scrapes
+func init() {
+	Registry.MustRegister(
+		InitPoolDuration,
+		InitPoolPods,
+		GenerateGUIDDuration,
+		GUIDPoolFreeSegments,
+		GUIDPoolLongestFreeRun,
+		SMActiveEndpoint,
+		SMAvailable,
+		GUIDConflicts,
+		GUIDPoolUnownedSMGUIDs,
+		PKeyMembers,
+		PKeyMemberLimitExceeded,
+		AdoptedPKeyMembers,
+		StalePKeyMembersRemoved,
+		PartitionPolicyViolations,
+		FabricDuplicateGUIDs,
+		PodsDeletedBeforeAnnotation,
+		PodAnnotationConflicts,
+		PendingPods,
+		PendingPodsOldestAge,
+		WarmPoolGUIDs,
+		K8sClientThrottledRequests,
+		LeaderElectionTransitions,
+		LeaderElectionLeader,
+		LeaderElectionLeaseAcquired,
+		LeaderElectionRenewFailures,
+	)
+}
+
+// Serve exposes the metrics on "/metrics" of given address, it blocks until the server fails
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
+
+	log.Info().Msgf("serving metrics on %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler returns the handler of the ib-kubernetes metrics together with the controller-runtime registry, which
+// holds the workqueue and reconcile metrics of the daemon controllers and the go runtime and process metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.Gatherers{Registry, ctrlmetrics.Registry}, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,109 @@
+package pkey
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+)
+
+// Valid range of pkeys which can be allocated to networks, 0x0000 is invalid and 0x7FFF is the default pkey
+const (
+	minPKey = ibUtils.MinPKey + 1
+	maxPKey = ibUtils.DefaultPKey - 1
+)
+
+type Pool interface {
+	// AllocatePKey allocates the given pkey for the network.
+	// It returns error if the pkey is allocated for another network.
+	AllocatePKey(pKey int, networkID string) error
+
+	// GeneratePKey allocates the next free pkey in the range for the network.
+	// It returns the pkey already allocated for the network if any.
+	GeneratePKey(networkID string) (int, error)
+
+	// ReleasePKey releases the pkey allocated for the network, so it can be allocated for another network.
+	// It returns the released pkey and false if no pkey is allocated for the network.
+	ReleasePKey(networkID string) (int, bool)
+
+	// InRange returns true if the pkey is in the range of the pool
+	InRange(pKey int) bool
+}
+
+var ErrPKeyPoolExhausted = errors.New("PKey pool is exhausted")
+
+type pKeyPool struct {
+	rangeStart  int            // first pkey in range
+	rangeEnd    int            // last pkey in range
+	pKeyPoolMap map[int]string // allocated pkey mapped to its network ID
+}
+
+func NewPool(conf *config.PKeyPoolConfig) (Pool, error) {
+	log.Info().Msgf("creating pkey pool, pKeyRangeStart %s, pKeyRangeEnd %s", conf.RangeStart, conf.RangeEnd)
+	rangeStart, err := ibUtils.ParsePKey(conf.RangeStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pKeyRangeStart %v", err)
+	}
+	rangeEnd, err := ibUtils.ParsePKey(conf.RangeEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pKeyRangeEnd %v", err)
+	}
+	if rangeStart < minPKey || rangeEnd > maxPKey || rangeStart > rangeEnd {
+		return nil, fmt.Errorf("invalid pkey range. rangeStart: 0x%04X rangeEnd: 0x%04X", rangeStart, rangeEnd)
+	}
+
+	return &pKeyPool{
+		rangeStart:  rangeStart,
+		rangeEnd:    rangeEnd,
+		pKeyPoolMap: map[int]string{},
+	}, nil
+}
+
+// AllocatePKey allocates the given pkey for the network
+func (p *pKeyPool) AllocatePKey(pKey int, networkID string) error {
+	if !p.InRange(pKey) {
+		return fmt.Errorf("pkey 0x%04X is out of range 0x%04X-0x%04X", pKey, p.rangeStart, p.rangeEnd)
+	}
+	if allocatedNetworkID, exist := p.pKeyPoolMap[pKey]; exist && allocatedNetworkID != networkID {
+		return fmt.Errorf("pkey 0x%04X is already allocated for network %s", pKey, allocatedNetworkID)
+	}
+
+	p.pKeyPoolMap[pKey] = networkID
+	return nil
+}
+
+// GeneratePKey allocates the next free pkey in the range for the network
+func (p *pKeyPool) GeneratePKey(networkID string) (int, error) {
+	for pKey, allocatedNetworkID := range p.pKeyPoolMap {
+		if allocatedNetworkID == networkID {
+			return pKey, nil
+		}
+	}
+
+	for pKey := p.rangeStart; pKey <= p.rangeEnd; pKey++ {
+		if _, exist := p.pKeyPoolMap[pKey]; !exist {
+			p.pKeyPoolMap[pKey] = networkID
+			return pKey, nil
+		}
+	}
+	return 0, ErrPKeyPoolExhausted
+}
+
+// ReleasePKey releases the pkey allocated for the network
+func (p *pKeyPool) ReleasePKey(networkID string) (int, bool) {
+	for pKey, allocatedNetworkID := range p.pKeyPoolMap {
+		if allocatedNetworkID == networkID {
+			delete(p.pKeyPoolMap, pKey)
+			return pKey, true
+		}
+	}
+	return 0, false
+}
+
+// InRange returns true if the pkey is in the range of the pool
+func (p *pKeyPool) InRange(pKey int) bool {
+	return pKey >= p.rangeStart && pKey <= p.rangeEnd
+}
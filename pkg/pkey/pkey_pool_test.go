@@ -0,0 +1,91 @@
+package pkey
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/config"
+)
+
+var _ = Describe("PKey Pool", func() {
+	Context("NewPool", func() {
+		It("Create pkey pool with valid range", func() {
+			pool, err := NewPool(&config.PKeyPoolConfig{RangeStart: "0x0100", RangeEnd: "0x01FF"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pool.InRange(0x100)).To(BeTrue())
+			Expect(pool.InRange(0x1FF)).To(BeTrue())
+			Expect(pool.InRange(0x200)).To(BeFalse())
+		})
+		It("Create pkey pool with invalid pkey", func() {
+			_, err := NewPool(&config.PKeyPoolConfig{RangeStart: "10z", RangeEnd: "0x01FF"})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Create pkey pool with start greater than end", func() {
+			_, err := NewPool(&config.PKeyPoolConfig{RangeStart: "0x0200", RangeEnd: "0x0100"})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Create pkey pool including the default pkey", func() {
+			_, err := NewPool(&config.PKeyPoolConfig{RangeStart: "0x0100", RangeEnd: "0x7FFF"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("GeneratePKey", func() {
+		var pool Pool
+		BeforeEach(func() {
+			var err error
+			pool, err = NewPool(&config.PKeyPoolConfig{RangeStart: "0x0100", RangeEnd: "0x0101"})
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Generate pkeys until pool is exhausted", func() {
+			pKey, err := pool.GeneratePKey("default_net1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pKey).To(Equal(0x100))
+			pKey, err = pool.GeneratePKey("default_net2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pKey).To(Equal(0x101))
+			_, err = pool.GeneratePKey("default_net3")
+			Expect(err).To(Equal(ErrPKeyPoolExhausted))
+		})
+		It("Generate pkey returns the pkey already allocated for the network", func() {
+			Expect(pool.AllocatePKey(0x101, "default_net1")).To(Succeed())
+			pKey, err := pool.GeneratePKey("default_net1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pKey).To(Equal(0x101))
+		})
+		It("Generate pkey skips allocated pkeys", func() {
+			Expect(pool.AllocatePKey(0x100, "default_net1")).To(Succeed())
+			pKey, err := pool.GeneratePKey("default_net2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pKey).To(Equal(0x101))
+		})
+	})
+	Context("ReleasePKey", func() {
+		It("Release pkey of network to be allocated for another network", func() {
+			pool, err := NewPool(&config.PKeyPoolConfig{RangeStart: "0x0100", RangeEnd: "0x0100"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pool.AllocatePKey(0x100, "default_net1")).To(Succeed())
+			_, err = pool.GeneratePKey("default_net2")
+			Expect(err).To(Equal(ErrPKeyPoolExhausted))
+
+			pKey, released := pool.ReleasePKey("default_net1")
+			Expect(released).To(BeTrue())
+			Expect(pKey).To(Equal(0x100))
+			_, released = pool.ReleasePKey("default_net1")
+			Expect(released).To(BeFalse())
+
+			pKey, err = pool.GeneratePKey("default_net2")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pKey).To(Equal(0x100))
+		})
+	})
+	Context("AllocatePKey", func() {
+		It("Allocate pkey of another network", func() {
+			pool, err := NewPool(&config.PKeyPoolConfig{RangeStart: "0x0100", RangeEnd: "0x01FF"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pool.AllocatePKey(0x100, "default_net1")).To(Succeed())
+			Expect(pool.AllocatePKey(0x100, "default_net1")).To(Succeed())
+			Expect(pool.AllocatePKey(0x100, "default_net2")).ToNot(Succeed())
+			Expect(pool.AllocatePKey(0x200, "default_net2")).ToNot(Succeed())
+		})
+	})
+})
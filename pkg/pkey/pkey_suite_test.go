@@ -0,0 +1,13 @@
+package pkey
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPKey(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "PKey Suite")
+}
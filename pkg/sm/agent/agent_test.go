@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+)
+
+var _ = Describe("Subnet Manager Agent", func() {
+	var (
+		smClient *smMocks.SubnetManagerClient
+		server   *grpc.Server
+		address  string
+	)
+
+	guids := []net.HardwareAddr{{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}}
+
+	startServer := func(token string) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		address = listener.Addr().String()
+		server = NewServer(smClient, token)
+		go func() {
+			defer GinkgoRecover()
+			Expect(server.Serve(listener)).To(Succeed())
+		}()
+	}
+
+	newClient := func(token string) *Client {
+		client, err := NewClient(address, insecure.NewCredentials(), token)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	BeforeEach(func() {
+		smClient = &smMocks.SubnetManagerClient{}
+		smClient.On("Name").Return("ufm").Maybe()
+		smClient.On("Spec").Return("2.0").Maybe()
+	})
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	It("Proxy the calls to the subnet manager client", func() {
+		startServer("")
+		client := newClient("")
+		smClient.On("Validate", mock.Anything).Return(nil)
+		smClient.On("AddGuidsToPKey", mock.MatchedBy(func(ctx context.Context) bool {
+			return plugins.GUIDOwnersFromContext(ctx)[guids[0].String()].Name == "pod"
+		}), 0x10, guids).Return(nil)
+		smClient.On("AddGuidsToLimitedPKey", mock.Anything, 0x10, guids).Return(nil)
+		smClient.On("RemoveGuidsFromPKey", mock.Anything, 0x10, guids).Return(nil)
+		smClient.On("ListGuidsInUse", mock.Anything).Return([]string{"02:00:00:00:00:00:00:01"}, nil)
+		smClient.On("GetPKeyMembers", mock.Anything, 0x10).Return(guids, nil)
+
+		info, err := client.Info(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info).To(Equal(&InfoResponse{Plugin: "ufm", Spec: "2.0"}))
+		Expect(client.Validate(context.Background())).To(Succeed())
+		ctx := plugins.WithGUIDOwners(context.Background(), map[string]plugins.GUIDOwner{
+			guids[0].String(): {Kind: "Pod", Namespace: "default", Name: "pod"}})
+		Expect(client.AddGuidsToPKey(ctx, 0x10, guids)).To(Succeed())
+		Expect(client.AddGuidsToLimitedPKey(context.Background(), 0x10, guids)).To(Succeed())
+		Expect(client.RemoveGuidsFromPKey(context.Background(), 0x10, guids)).To(Succeed())
+		inUse, err := client.ListGuidsInUse(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inUse).To(Equal([]string{"02:00:00:00:00:00:00:01"}))
+		members, err := client.GetPKeyMembers(context.Background(), 0x10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(members).To(Equal(guids))
+		smClient.AssertExpectations(GinkgoT())
+	})
+	It("Return the errors of the subnet manager client", func() {
+		startServer("")
+		client := newClient("")
+		smClient.On("AddGuidsToPKey", mock.Anything, 0x10, guids).Return(errors.New("ufm unavailable"))
+		smClient.On("GetPKeyMembers", mock.Anything, 0x10).Return(nil, plugins.ErrNotSupported)
+
+		err := client.AddGuidsToPKey(context.Background(), 0x10, guids)
+		Expect(err).To(MatchError("ufm unavailable"))
+		_, err = client.GetPKeyMembers(context.Background(), 0x10)
+		Expect(errors.Is(err, plugins.ErrNotSupported)).To(BeTrue())
+	})
+	It("Reject the calls without the token", func() {
+		startServer("secret")
+		smClient.On("Validate", mock.Anything).Return(nil)
+
+		Expect(newClient("").Validate(context.Background())).To(MatchError(ContainSubstring("token")))
+		Expect(newClient("other").Validate(context.Background())).To(MatchError(ContainSubstring("token")))
+		Expect(newClient("secret").Validate(context.Background())).To(Succeed())
+	})
+})
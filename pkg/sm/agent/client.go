@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+// Client calls the subnet manager client served by an agent
+type Client struct {
+	conn  *grpc.ClientConn
+	token string
+}
+
+// NewClient returns a client of the agent at the address, the connection is established lazily on the first
+// call. The calls present the token if it's not empty.
+func NewClient(address string, creds credentials.TransportCredentials, token string) (*Client, error) {
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, token: token}, nil
+}
+
+// Close closes the connection to the agent
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	if c.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, authorizationHeader, bearerPrefix+c.token)
+	}
+	return fromStatus(c.conn.Invoke(ctx, fullMethod(method), req, resp))
+}
+
+// Info returns the name and spec version of the subnet manager plugin served by the agent
+func (c *Client) Info(ctx context.Context) (*InfoResponse, error) {
+	resp := &InfoResponse{}
+	if err := c.invoke(ctx, methodInfo, &Empty{}, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Validate checks the agent and the subnet manager it serves are reachable
+func (c *Client) Validate(ctx context.Context) error {
+	return c.invoke(ctx, methodValidate, &Empty{}, &Empty{})
+}
+
+func (c *Client) AddGuidsToPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	return c.invoke(ctx, methodAddGuidsToPKey, &PKeyRequest{PKey: pKey, GUIDs: formatGUIDs(guids),
+		Owners: plugins.GUIDOwnersFromContext(ctx)}, &Empty{})
+}
+
+func (c *Client) AddGuidsToLimitedPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	return c.invoke(ctx, methodAddGuidsToLimitedPKey, &PKeyRequest{PKey: pKey, GUIDs: formatGUIDs(guids),
+		Owners: plugins.GUIDOwnersFromContext(ctx)}, &Empty{})
+}
+
+func (c *Client) RemoveGuidsFromPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	return c.invoke(ctx, methodRemoveGuidsFromPKey, &PKeyRequest{PKey: pKey, GUIDs: formatGUIDs(guids)},
+		&Empty{})
+}
+
+func (c *Client) ListGuidsInUse(ctx context.Context) ([]string, error) {
+	resp := &GUIDsResponse{}
+	if err := c.invoke(ctx, methodListGuidsInUse, &Empty{}, resp); err != nil {
+		return nil, err
+	}
+	return resp.GUIDs, nil
+}
+
+func (c *Client) GetPKeyMembers(ctx context.Context, pKey int) ([]net.HardwareAddr, error) {
+	resp := &GUIDsResponse{}
+	if err := c.invoke(ctx, methodGetPKeyMembers, &PKeyRequest{PKey: pKey}, resp); err != nil {
+		return nil, err
+	}
+	return parseGUIDs(resp.GUIDs)
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+const (
+	// authorizationHeader is the metadata holding the token of the calls, "Bearer <token>"
+	authorizationHeader = "authorization"
+	bearerPrefix        = "Bearer "
+)
+
+// Config of the agent
+type Config struct {
+	// Address the agent listens on, e.g. ":9090"
+	ListenAddress string `env:"SM_AGENT_LISTEN_ADDRESS" envDefault:":9090"`
+	// Subnet manager plugin served by the agent, one of the plugins compiled into the agent
+	Plugin string `env:"SM_AGENT_PLUGIN" envDefault:"ufm"`
+	// Certificate and key files the agent serves TLS with, the agent serves plaintext if not set
+	CertFile string `env:"SM_AGENT_CERT_FILE"`
+	KeyFile  string `env:"SM_AGENT_KEY_FILE"`
+	// Token the remote plugins must present, calls aren't authenticated if not set
+	Token string `env:"SM_AGENT_TOKEN"`
+}
+
+// ReadConfig reads the agent configuration from the environment variables
+func (c *Config) ReadConfig() error {
+	if err := env.Parse(c); err != nil {
+		return err
+	}
+	if c.ListenAddress == "" {
+		return fmt.Errorf("listen address must not be empty")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("both certificate file and key file must be set to serve TLS")
+	}
+	return nil
+}
+
+// NewServer returns the gRPC server serving the subnet manager client, the calls must present the token if it's
+// not empty
+func NewServer(smClient plugins.SubnetManagerClient, token string, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ForceServerCodec(jsonCodec{}),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler) (interface{}, error) {
+			if err := authorize(ctx, token); err != nil {
+				log.Warn().Msgf("rejected call %s: %v", info.FullMethod, err)
+				return nil, err
+			}
+			log.Debug().Msgf("serving call %s", info.FullMethod)
+			return handler(ctx, req)
+		}))
+	server := grpc.NewServer(opts...)
+	server.RegisterService(&serviceDesc, smClient)
+	return server
+}
+
+// authorize checks the call presents the token
+func authorize(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(authorizationHeader) {
+		if subtle.ConstantTimeCompare([]byte(value), []byte(bearerPrefix+token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing token")
+}
+
+// Run loads the subnet manager plugin and serves it until the context is done
+func Run(ctx context.Context, conf *Config) error {
+	initialize, exist := sm.BuiltinPlugin(conf.Plugin)
+	if !exist {
+		return fmt.Errorf("subnet manager plugin %s is not compiled into the agent, available plugins %v",
+			conf.Plugin, sm.BuiltinPlugins())
+	}
+	smClient, err := initialize()
+	if err != nil {
+		return fmt.Errorf("failed to initialize subnet manager plugin %s: %v", conf.Plugin, err)
+	}
+	if smClient, err = sm.NewSpecGatedClient(smClient); err != nil {
+		return err
+	}
+
+	var opts []grpc.ServerOption
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load agent certificate: %v", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})))
+	}
+
+	listener, err := net.Listen("tcp", conf.ListenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", conf.ListenAddress, err)
+	}
+	server := NewServer(smClient, conf.Token, opts...)
+	go func() {
+		<-ctx.Done()
+		log.Info().Msg("stopping subnet manager agent")
+		server.GracefulStop()
+	}()
+
+	log.Info().Msgf("serving subnet manager plugin %s on %s", smClient.Name(), listener.Addr())
+	return server.Serve(listener)
+}
@@ -0,0 +1,252 @@
+// Package agent serves a subnet manager client over gRPC. Daemons running where the subnet manager isn't
+// reachable, e.g. air-gapped fabrics where only specific hosts can reach UFM, use the subnet manager through an
+// agent running on such a host with the remote subnet manager plugin.
+//
+// The service is defined by hand, its messages are encoded as JSON, so it doesn't require generated protobuf code.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+const (
+	serviceName = "ibkubernetes.sm.v1.SubnetManager"
+
+	methodInfo                  = "Info"
+	methodValidate              = "Validate"
+	methodAddGuidsToPKey        = "AddGuidsToPKey"
+	methodAddGuidsToLimitedPKey = "AddGuidsToLimitedPKey"
+	methodRemoveGuidsFromPKey   = "RemoveGuidsFromPKey"
+	methodListGuidsInUse        = "ListGuidsInUse"
+	methodGetPKeyMembers        = "GetPKeyMembers"
+)
+
+// Empty is the message of calls without arguments or results
+type Empty struct{}
+
+// InfoResponse identifies the subnet manager plugin served by the agent
+type InfoResponse struct {
+	Plugin string `json:"plugin"`
+	Spec   string `json:"spec"`
+}
+
+// PKeyRequest is the message of the calls on the guids of a pkey
+type PKeyRequest struct {
+	PKey  int      `json:"pkey"`
+	GUIDs []string `json:"guids,omitempty"`
+	// Owners of the added guids keyed by guid, passed to the subnet manager client in the call context
+	Owners map[string]plugins.GUIDOwner `json:"owners,omitempty"`
+}
+
+// GUIDsResponse is the message of the calls returning guids
+type GUIDsResponse struct {
+	GUIDs []string `json:"guids"`
+}
+
+// jsonCodec encodes the messages of the service as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// serviceDesc describes the subnet manager service, the server is the served subnet manager client
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*plugins.SubnetManagerClient)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: methodInfo, Handler: infoHandler},
+		{MethodName: methodValidate, Handler: validateHandler},
+		{MethodName: methodAddGuidsToPKey, Handler: pKeyHandler(methodAddGuidsToPKey, addGuidsToPKey)},
+		{MethodName: methodAddGuidsToLimitedPKey, Handler: pKeyHandler(methodAddGuidsToLimitedPKey,
+			addGuidsToLimitedPKey)},
+		{MethodName: methodRemoveGuidsFromPKey, Handler: pKeyHandler(methodRemoveGuidsFromPKey,
+			removeGuidsFromPKey)},
+		{MethodName: methodListGuidsInUse, Handler: listGuidsInUseHandler},
+		{MethodName: methodGetPKeyMembers, Handler: pKeyHandler(methodGetPKeyMembers, getPKeyMembers)},
+	},
+}
+
+// fullMethod returns the full name of the method of the service
+func fullMethod(method string) string {
+	return "/" + serviceName + "/" + method
+}
+
+// unary runs the call through the interceptor of the server if any
+func unary(ctx context.Context, method string, req interface{}, interceptor grpc.UnaryServerInterceptor,
+	call func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if interceptor == nil {
+		return call(ctx)
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: fullMethod(method)}
+	return interceptor(ctx, req, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return call(ctx)
+	})
+}
+
+func infoHandler(srv interface{}, ctx context.Context, dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &Empty{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	smClient := srv.(plugins.SubnetManagerClient)
+	return unary(ctx, methodInfo, req, interceptor, func(_ context.Context) (interface{}, error) {
+		return &InfoResponse{Plugin: smClient.Name(), Spec: smClient.Spec()}, nil
+	})
+}
+
+func validateHandler(srv interface{}, ctx context.Context, dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &Empty{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	smClient := srv.(plugins.SubnetManagerClient)
+	return unary(ctx, methodValidate, req, interceptor, func(ctx context.Context) (interface{}, error) {
+		return &Empty{}, toStatus(smClient.Validate(ctx))
+	})
+}
+
+func listGuidsInUseHandler(srv interface{}, ctx context.Context, dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &Empty{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	smClient := srv.(plugins.SubnetManagerClient)
+	return unary(ctx, methodListGuidsInUse, req, interceptor, func(ctx context.Context) (interface{}, error) {
+		guids, err := smClient.ListGuidsInUse(ctx)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		return &GUIDsResponse{GUIDs: guids}, nil
+	})
+}
+
+// pKeyCall calls the subnet manager client for the guids of the pkey of the request
+type pKeyCall func(ctx context.Context, smClient plugins.SubnetManagerClient, pKey int,
+	guids []net.HardwareAddr) (interface{}, error)
+
+// pKeyHandler returns the handler of a call on the guids of a pkey
+func pKeyHandler(method string, call pKeyCall) func(interface{}, context.Context, func(interface{}) error,
+	grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+		interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := &PKeyRequest{}
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		smClient := srv.(plugins.SubnetManagerClient)
+		return unary(ctx, method, req, interceptor, func(ctx context.Context) (interface{}, error) {
+			guids, err := parseGUIDs(req.GUIDs)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			resp, err := call(plugins.WithGUIDOwners(ctx, req.Owners), smClient, req.PKey, guids)
+			if err != nil {
+				return nil, toStatus(err)
+			}
+			return resp, nil
+		})
+	}
+}
+
+func addGuidsToPKey(ctx context.Context, smClient plugins.SubnetManagerClient, pKey int,
+	guids []net.HardwareAddr) (interface{}, error) {
+	return &Empty{}, smClient.AddGuidsToPKey(ctx, pKey, guids)
+}
+
+func addGuidsToLimitedPKey(ctx context.Context, smClient plugins.SubnetManagerClient, pKey int,
+	guids []net.HardwareAddr) (interface{}, error) {
+	return &Empty{}, smClient.AddGuidsToLimitedPKey(ctx, pKey, guids)
+}
+
+func removeGuidsFromPKey(ctx context.Context, smClient plugins.SubnetManagerClient, pKey int,
+	guids []net.HardwareAddr) (interface{}, error) {
+	return &Empty{}, smClient.RemoveGuidsFromPKey(ctx, pKey, guids)
+}
+
+func getPKeyMembers(ctx context.Context, smClient plugins.SubnetManagerClient, pKey int,
+	_ []net.HardwareAddr) (interface{}, error) {
+	members, err := smClient.GetPKeyMembers(ctx, pKey)
+	if err != nil {
+		return nil, err
+	}
+	return &GUIDsResponse{GUIDs: formatGUIDs(members)}, nil
+}
+
+// toStatus returns the gRPC status error of the subnet manager client error, plugins.ErrNotSupported is mapped
+// to codes.Unimplemented so the remote plugin reports it as is
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, plugins.ErrNotSupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Unknown, err.Error())
+	}
+}
+
+// fromStatus returns the subnet manager client error of the gRPC status error
+func fromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.Unimplemented:
+		return plugins.ErrNotSupported
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	default:
+		return errors.New(st.Message())
+	}
+}
+
+func parseGUIDs(guids []string) ([]net.HardwareAddr, error) {
+	parsed := make([]net.HardwareAddr, 0, len(guids))
+	for _, guid := range guids {
+		guidAddr, err := net.ParseMAC(guid)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, guidAddr)
+	}
+	return parsed, nil
+}
+
+func formatGUIDs(guids []net.HardwareAddr) []string {
+	formatted := make([]string, 0, len(guids))
+	for _, guid := range guids {
+		formatted = append(formatted, guid.String())
+	}
+	return formatted
+}
@@ -0,0 +1,43 @@
+package sm
+
+import (
+	"sort"
+	"sync"
+)
+
+var (
+	builtinPluginsMutex sync.RWMutex
+	// builtinPlugins maps plugin name to the initialize function of the plugins compiled into the daemon binary
+	builtinPlugins = make(map[string]PluginInitialize)
+)
+
+// RegisterBuiltinPlugin registers a plugin compiled into the daemon binary, used instead of loading the plugin
+// shared object of the same name. It's called from init functions, registering a plugin twice panics.
+func RegisterBuiltinPlugin(name string, initialize PluginInitialize) {
+	builtinPluginsMutex.Lock()
+	defer builtinPluginsMutex.Unlock()
+	if _, exist := builtinPlugins[name]; exist {
+		panic("built-in subnet manager plugin " + name + " is already registered")
+	}
+	builtinPlugins[name] = initialize
+}
+
+// BuiltinPlugin returns the initialize function of the built-in plugin, false if no such plugin is compiled in
+func BuiltinPlugin(name string) (PluginInitialize, bool) {
+	builtinPluginsMutex.RLock()
+	defer builtinPluginsMutex.RUnlock()
+	initialize, exist := builtinPlugins[name]
+	return initialize, exist
+}
+
+// BuiltinPlugins returns the sorted names of the plugins compiled into the daemon binary
+func BuiltinPlugins() []string {
+	builtinPluginsMutex.RLock()
+	defer builtinPluginsMutex.RUnlock()
+	names := make([]string, 0, len(builtinPlugins))
+	for name := range builtinPlugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,28 @@
+package sm
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+)
+
+var _ = Describe("Built-in Subnet Manager Plugins", func() {
+	It("Register built-in plugins", func() {
+		client := &smMocks.SubnetManagerClient{}
+		RegisterBuiltinPlugin("builtin-test", func() (plugins.SubnetManagerClient, error) { return client, nil })
+		Expect(BuiltinPlugins()).To(ContainElement("builtin-test"))
+
+		initialize, exist := BuiltinPlugin("builtin-test")
+		Expect(exist).To(BeTrue())
+		Expect(initialize()).To(BeIdenticalTo(client))
+
+		_, exist = BuiltinPlugin("not-registered")
+		Expect(exist).To(BeFalse())
+	})
+	It("Refuse to register a built-in plugin twice", func() {
+		RegisterBuiltinPlugin("builtin-twice", nil)
+		Expect(func() { RegisterBuiltinPlugin("builtin-twice", nil) }).To(Panic())
+	})
+})
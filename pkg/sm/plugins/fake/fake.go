@@ -0,0 +1,268 @@
+// Package fake provides an in-memory subnet manager client tracking the guids of the pkeys, with failure
+// injection and call recording, to be used in unit tests instead of a real subnet manager.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+const (
+	pluginName  = "fake"
+	specVersion = "1.1"
+)
+
+// Methods of the subnet manager client, used to inject failures and to filter the recorded calls
+const (
+	MethodValidate              = "Validate"
+	MethodAddGuidsToPKey        = "AddGuidsToPKey"
+	MethodAddGuidsToLimitedPKey = "AddGuidsToLimitedPKey"
+	MethodRemoveGuidsFromPKey   = "RemoveGuidsFromPKey"
+	MethodListGuidsInUse        = "ListGuidsInUse"
+	MethodGetPKeyMembers        = "GetPKeyMembers"
+)
+
+// Call is a recorded call of the subnet manager client
+type Call struct {
+	Method string
+	PKey   int
+	GUIDs  []net.HardwareAddr
+	// Err is the error returned by the call
+	Err error
+}
+
+// injectedError is an error returned by the calls of a method, times times or always if times is 0
+type injectedError struct {
+	err   error
+	times int
+}
+
+// SubnetManagerClient is an in-memory subnet manager client, safe for concurrent use
+type SubnetManagerClient struct {
+	mutex sync.Mutex
+	// members maps the pkey to its member guids, with true for limited members
+	members map[int]map[string]bool
+	errors  map[string]*injectedError
+	calls   []Call
+}
+
+var _ plugins.SubnetManagerClient = &SubnetManagerClient{}
+
+// NewSubnetManagerClient returns an in-memory subnet manager client without pkeys
+func NewSubnetManagerClient() *SubnetManagerClient {
+	return &SubnetManagerClient{members: map[int]map[string]bool{}, errors: map[string]*injectedError{}}
+}
+
+// SetMembers sets the full members of the pkey, e.g. members added to the subnet manager manually. It panics on
+// invalid guids.
+func (c *SubnetManagerClient) SetMembers(pKey int, guids ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.members, pKey)
+	for _, guid := range guids {
+		guidAddr, err := net.ParseMAC(guid)
+		if err != nil {
+			panic(fmt.Sprintf("invalid guid %s: %v", guid, err))
+		}
+		c.addMember(pKey, guidAddr, false)
+	}
+}
+
+// InjectError makes the next times calls of the method fail with err, all the calls if times is 0. A nil err
+// stops failing the calls of the method.
+func (c *SubnetManagerClient) InjectError(method string, err error, times int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err == nil {
+		delete(c.errors, method)
+		return
+	}
+	c.errors[method] = &injectedError{err: err, times: times}
+}
+
+// Members returns the member guids of the pkey in their lower case string form, sorted
+func (c *SubnetManagerClient) Members(pKey int) []string {
+	return c.filterMembers(pKey, func(bool) bool { return true })
+}
+
+// LimitedMembers returns the limited member guids of the pkey in their lower case string form, sorted
+func (c *SubnetManagerClient) LimitedMembers(pKey int) []string {
+	return c.filterMembers(pKey, func(limited bool) bool { return limited })
+}
+
+// PKeys returns the pkeys having members, sorted
+func (c *SubnetManagerClient) PKeys() []int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	pKeys := make([]int, 0, len(c.members))
+	for pKey := range c.members {
+		pKeys = append(pKeys, pKey)
+	}
+	sort.Ints(pKeys)
+	return pKeys
+}
+
+// Calls returns the recorded calls of the given methods in call order, all the calls if no method is given
+func (c *SubnetManagerClient) Calls(methods ...string) []Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var calls []Call
+	for _, call := range c.calls {
+		if len(methods) == 0 || contains(methods, call.Method) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset removes the pkeys, injected errors and recorded calls
+func (c *SubnetManagerClient) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.members = map[int]map[string]bool{}
+	c.errors = map[string]*injectedError{}
+	c.calls = nil
+}
+
+func (c *SubnetManagerClient) Name() string {
+	return pluginName
+}
+
+func (c *SubnetManagerClient) Spec() string {
+	return specVersion
+}
+
+func (c *SubnetManagerClient) Validate(_ context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.record(MethodValidate, 0, nil)
+}
+
+func (c *SubnetManagerClient) AddGuidsToPKey(_ context.Context, pKey int, guids []net.HardwareAddr) error {
+	return c.addGUIDs(MethodAddGuidsToPKey, pKey, guids, false)
+}
+
+func (c *SubnetManagerClient) AddGuidsToLimitedPKey(_ context.Context, pKey int, guids []net.HardwareAddr) error {
+	return c.addGUIDs(MethodAddGuidsToLimitedPKey, pKey, guids, true)
+}
+
+func (c *SubnetManagerClient) RemoveGuidsFromPKey(_ context.Context, pKey int, guids []net.HardwareAddr) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.record(MethodRemoveGuidsFromPKey, pKey, guids); err != nil {
+		return err
+	}
+	for _, guid := range guids {
+		delete(c.members[pKey], guid.String())
+	}
+	if len(c.members[pKey]) == 0 {
+		delete(c.members, pKey)
+	}
+	return nil
+}
+
+func (c *SubnetManagerClient) ListGuidsInUse(_ context.Context) ([]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.record(MethodListGuidsInUse, 0, nil); err != nil {
+		return nil, err
+	}
+	inUse := map[string]bool{}
+	for _, members := range c.members {
+		for guid := range members {
+			inUse[guid] = true
+		}
+	}
+	guids := make([]string, 0, len(inUse))
+	for guid := range inUse {
+		guids = append(guids, guid)
+	}
+	sort.Strings(guids)
+	return guids, nil
+}
+
+func (c *SubnetManagerClient) GetPKeyMembers(_ context.Context, pKey int) ([]net.HardwareAddr, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.record(MethodGetPKeyMembers, pKey, nil); err != nil {
+		return nil, err
+	}
+	guids := make([]net.HardwareAddr, 0, len(c.members[pKey]))
+	for _, guid := range sortedKeys(c.members[pKey]) {
+		// the member guids are parsed when added
+		guidAddr, _ := net.ParseMAC(guid)
+		guids = append(guids, guidAddr)
+	}
+	return guids, nil
+}
+
+// addGUIDs adds the guids to the pkey as full or limited members
+func (c *SubnetManagerClient) addGUIDs(method string, pKey int, guids []net.HardwareAddr, limited bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.record(method, pKey, guids); err != nil {
+		return err
+	}
+	for _, guid := range guids {
+		c.addMember(pKey, guid, limited)
+	}
+	return nil
+}
+
+func (c *SubnetManagerClient) addMember(pKey int, guid net.HardwareAddr, limited bool) {
+	if c.members[pKey] == nil {
+		c.members[pKey] = map[string]bool{}
+	}
+	c.members[pKey][guid.String()] = limited
+}
+
+// record records the call and returns the error injected for the method, if any. The mutex must be held.
+func (c *SubnetManagerClient) record(method string, pKey int, guids []net.HardwareAddr) error {
+	var err error
+	if injected, ok := c.errors[method]; ok {
+		err = injected.err
+		if injected.times > 0 {
+			if injected.times--; injected.times == 0 {
+				delete(c.errors, method)
+			}
+		}
+	}
+	c.calls = append(c.calls, Call{Method: method, PKey: pKey,
+		GUIDs: append([]net.HardwareAddr(nil), guids...), Err: err})
+	return err
+}
+
+func (c *SubnetManagerClient) filterMembers(pKey int, filter func(limited bool) bool) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	guids := []string{}
+	for _, guid := range sortedKeys(c.members[pKey]) {
+		if filter(c.members[pKey][guid]) {
+			guids = append(guids, guid)
+		}
+	}
+	return guids
+}
+
+func sortedKeys(members map[string]bool) []string {
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
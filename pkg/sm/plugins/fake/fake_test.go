@@ -0,0 +1,84 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+var _ = Describe("fake plugin", func() {
+	var (
+		client *SubnetManagerClient
+		guids  []net.HardwareAddr
+	)
+
+	BeforeEach(func() {
+		client = NewSubnetManagerClient()
+		guids = []net.HardwareAddr{{0x02, 0, 0, 0, 0, 0, 0, 0x01}, {0x02, 0, 0, 0, 0, 0, 0, 0x02}}
+	})
+
+	It("Track the members of the pkeys", func() {
+		ctx := context.Background()
+		Expect(client.Name()).To(Equal("fake"))
+		Expect(client.Spec()).To(Equal("1.1"))
+		Expect(client.AddGuidsToPKey(ctx, 0x5, guids)).To(Succeed())
+		Expect(client.AddGuidsToLimitedPKey(ctx, 0x7fff, guids[1:])).To(Succeed())
+
+		Expect(client.Members(0x5)).To(Equal([]string{"02:00:00:00:00:00:00:01", "02:00:00:00:00:00:00:02"}))
+		Expect(client.LimitedMembers(0x5)).To(BeEmpty())
+		Expect(client.LimitedMembers(0x7fff)).To(Equal([]string{"02:00:00:00:00:00:00:02"}))
+		Expect(client.PKeys()).To(Equal([]int{0x5, 0x7fff}))
+		inUse, err := client.ListGuidsInUse(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inUse).To(Equal([]string{"02:00:00:00:00:00:00:01", "02:00:00:00:00:00:00:02"}))
+
+		Expect(client.RemoveGuidsFromPKey(ctx, 0x5, guids[:1])).To(Succeed())
+		members, err := client.GetPKeyMembers(ctx, 0x5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(members).To(Equal(guids[1:]))
+		Expect(client.RemoveGuidsFromPKey(ctx, 0x5, guids[1:])).To(Succeed())
+		Expect(client.PKeys()).To(Equal([]int{0x7fff}))
+	})
+	It("Set the members of a pkey", func() {
+		client.SetMembers(0x5, "02:00:00:00:00:00:00:0A")
+		Expect(client.Members(0x5)).To(Equal([]string{"02:00:00:00:00:00:00:0a"}))
+		Expect(func() { client.SetMembers(0x5, "invalid") }).To(Panic())
+	})
+	It("Fail the calls with injected errors", func() {
+		ctx := context.Background()
+		client.InjectError(MethodAddGuidsToPKey, errors.New("add failed"), 1)
+		client.InjectError(MethodGetPKeyMembers, plugins.ErrNotSupported, 0)
+
+		Expect(client.AddGuidsToPKey(ctx, 0x5, guids)).To(MatchError("add failed"))
+		Expect(client.Members(0x5)).To(BeEmpty())
+		Expect(client.AddGuidsToPKey(ctx, 0x5, guids)).To(Succeed())
+		for i := 0; i < 2; i++ {
+			_, err := client.GetPKeyMembers(ctx, 0x5)
+			Expect(err).To(Equal(plugins.ErrNotSupported))
+		}
+
+		client.InjectError(MethodGetPKeyMembers, nil, 0)
+		_, err := client.GetPKeyMembers(ctx, 0x5)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	It("Record the calls", func() {
+		ctx := context.Background()
+		Expect(client.Validate(ctx)).To(Succeed())
+		Expect(client.AddGuidsToPKey(ctx, 0x5, guids)).To(Succeed())
+		Expect(client.RemoveGuidsFromPKey(ctx, 0x5, guids)).To(Succeed())
+
+		Expect(client.Calls()).To(HaveLen(3))
+		Expect(client.Calls(MethodAddGuidsToPKey, MethodRemoveGuidsFromPKey)).To(Equal([]Call{
+			{Method: MethodAddGuidsToPKey, PKey: 0x5, GUIDs: guids},
+			{Method: MethodRemoveGuidsFromPKey, PKey: 0x5, GUIDs: guids}}))
+
+		client.Reset()
+		Expect(client.Calls()).To(BeEmpty())
+		Expect(client.PKeys()).To(BeEmpty())
+	})
+})
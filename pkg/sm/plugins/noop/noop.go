@@ -1,28 +1,82 @@
-package main
+// Package noop implements a subnet manager client which doesn't configure any subnet manager, with failure
+// injection for resilience testing of the daemon.
+package noop
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
 	"net"
+	"time"
 
+	"github.com/caarlos0/env/v11"
 	"github.com/rs/zerolog/log"
 
 	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
 )
 
 const (
-	pluginName  = "noop"
-	specVersion = "1.0"
+	pluginName = "noop"
+	// SpecVersion is the version of the subnet manager client interface the plugin implements
+	SpecVersion = "2.0"
 )
 
-var InvalidPlugin bool
+// NoopConfig holds failure injection settings used for resilience testing of the daemon
+type NoopConfig struct {
+	// Percentage of AddGuidsToPKey calls to fail, 0 - 100
+	AddFailurePercent int `env:"NOOP_ADD_FAILURE_PERCENT" envDefault:"0"`
+	// Latency added to every subnet manager call
+	Latency time.Duration `env:"NOOP_LATENCY" envDefault:"0s"`
+	// Stale guids ListGuidsInUse reports as in use, e.g. guids of already removed pods
+	StaleGUIDs []string `env:"NOOP_STALE_GUIDS" envSeparator:","`
+}
 
 type plugin struct {
 	PluginName  string
 	SpecVersion string
+	conf        NoopConfig
+	// randPercent returns a number in [0, 100) used to decide whether to inject a failure
+	randPercent func() int
 }
 
-//nolint:unparam
 func newNoopPlugin() (*plugin, error) {
-	return &plugin{PluginName: pluginName, SpecVersion: specVersion}, nil
+	noopConf := NoopConfig{}
+	if err := env.Parse(&noopConf); err != nil {
+		return nil, err
+	}
+
+	if noopConf.AddFailurePercent < 0 || noopConf.AddFailurePercent > 100 {
+		return nil, fmt.Errorf("invalid add failure percent %d, out of range 0 - 100", noopConf.AddFailurePercent)
+	}
+
+	for _, guid := range noopConf.StaleGUIDs {
+		if _, err := net.ParseMAC(guid); err != nil {
+			return nil, fmt.Errorf("invalid stale guid %s: %v", guid, err)
+		}
+	}
+
+	return &plugin{
+		PluginName:  pluginName,
+		SpecVersion: SpecVersion,
+		conf:        noopConf,
+		randPercent: func() int { return rand.Intn(100) }, //nolint:gosec
+	}, nil
+}
+
+// injectLatency sleeps for the configured latency, it returns the context error if the call is canceled meanwhile
+func (p *plugin) injectLatency(ctx context.Context) error {
+	if p.conf.Latency <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(p.conf.Latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (p *plugin) Name() string {
@@ -33,24 +87,55 @@ func (p *plugin) Spec() string {
 	return p.SpecVersion
 }
 
-func (p *plugin) Validate() error {
+func (p *plugin) Validate(_ context.Context) error {
 	log.Info().Msg("noop Plugin Validate()")
 	return nil
 }
 
-func (p *plugin) AddGuidsToPKey(pkey int, guids []net.HardwareAddr) error {
+func (p *plugin) AddGuidsToPKey(ctx context.Context, pkey int, guids []net.HardwareAddr) error {
 	log.Info().Msg("noop Plugin AddPkey()")
+	if err := p.injectLatency(ctx); err != nil {
+		return err
+	}
+	if p.conf.AddFailurePercent > 0 && p.randPercent() < p.conf.AddFailurePercent {
+		return fmt.Errorf("noop plugin injected failure adding guids %v to pkey 0x%04X", guids, pkey)
+	}
 	return nil
 }
 
-func (p *plugin) RemoveGuidsFromPKey(pkey int, guids []net.HardwareAddr) error {
-	log.Info().Msg("noop Plugin RemovePKey()")
+func (p *plugin) AddGuidsToLimitedPKey(ctx context.Context, pkey int, guids []net.HardwareAddr) error {
+	log.Info().Msg("noop Plugin AddLimitedPkey()")
+	if err := p.injectLatency(ctx); err != nil {
+		return err
+	}
+	if p.conf.AddFailurePercent > 0 && p.randPercent() < p.conf.AddFailurePercent {
+		return fmt.Errorf("noop plugin injected failure adding guids %v to limited pkey 0x%04X", guids, pkey)
+	}
 	return nil
 }
 
-func (p *plugin) ListGuidsInUse() ([]string, error) {
+func (p *plugin) RemoveGuidsFromPKey(ctx context.Context, _ int, _ []net.HardwareAddr) error {
+	log.Info().Msg("noop Plugin RemovePKey()")
+	return p.injectLatency(ctx)
+}
+
+func (p *plugin) ListGuidsInUse(ctx context.Context) ([]string, error) {
 	log.Info().Msg("noop Plugin ListGuidsInUse()")
-	return nil, nil
+	if err := p.injectLatency(ctx); err != nil {
+		return nil, err
+	}
+	if len(p.conf.StaleGUIDs) == 0 {
+		return nil, nil
+	}
+	return append([]string(nil), p.conf.StaleGUIDs...), nil
+}
+
+func (p *plugin) GetPKeyMembers(ctx context.Context, _ int) ([]net.HardwareAddr, error) {
+	log.Info().Msg("noop Plugin GetPKeyMembers()")
+	if err := p.injectLatency(ctx); err != nil {
+		return nil, err
+	}
+	return nil, plugins.ErrNotSupported
 }
 
 // Initialize applies configs to plugin and return a subnet manager client
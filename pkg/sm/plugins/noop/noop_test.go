@@ -1,28 +1,100 @@
-package main
+package noop
 
 import (
+	"context"
+	"net"
+	"os"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
 )
 
 var _ = Describe("noop plugin", func() {
+	AfterEach(func() {
+		os.Clearenv()
+	})
 	Context("Initialize", func() {
 		It("Initialize noop plugin", func() {
 			plugin, err := Initialize()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(plugin).ToNot(BeNil())
 			Expect(plugin.Name()).To(Equal("noop"))
-			Expect(plugin.Spec()).To(Equal("1.0"))
-			Expect(InvalidPlugin).ToNot(BeNil())
+			Expect(plugin.Spec()).To(Equal("2.0"))
+
+			err = plugin.Validate(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+
+			err = plugin.AddGuidsToPKey(context.Background(), 0, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = plugin.RemoveGuidsFromPKey(context.Background(), 0, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			guids, err := plugin.ListGuidsInUse(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guids).To(BeEmpty())
 
-			err = plugin.Validate()
+			_, err = plugin.GetPKeyMembers(context.Background(), 0)
+			Expect(err).To(MatchError(plugins.ErrNotSupported))
+		})
+		It("Initialize noop plugin with failure injection", func() {
+			Expect(os.Setenv("NOOP_ADD_FAILURE_PERCENT", "50")).ToNot(HaveOccurred())
+			Expect(os.Setenv("NOOP_LATENCY", "10ms")).ToNot(HaveOccurred())
+			Expect(os.Setenv("NOOP_STALE_GUIDS", "02:00:00:00:00:00:00:01,02:00:00:00:00:00:00:02")).
+				ToNot(HaveOccurred())
+
+			plugin, err := newNoopPlugin()
 			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.conf.AddFailurePercent).To(Equal(50))
+			Expect(plugin.conf.Latency).To(Equal(10 * time.Millisecond))
+			Expect(plugin.conf.StaleGUIDs).To(HaveLen(2))
+		})
+		It("Initialize noop plugin with invalid failure percent", func() {
+			Expect(os.Setenv("NOOP_ADD_FAILURE_PERCENT", "101")).ToNot(HaveOccurred())
+			_, err := Initialize()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Initialize noop plugin with invalid stale guid", func() {
+			Expect(os.Setenv("NOOP_STALE_GUIDS", "invalid")).ToNot(HaveOccurred())
+			_, err := Initialize()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("Failure injection", func() {
+		var guids []net.HardwareAddr
 
-			err = plugin.AddGuidsToPKey(0, nil)
+		BeforeEach(func() {
+			guid, err := net.ParseMAC("02:00:00:00:00:00:00:01")
 			Expect(err).ToNot(HaveOccurred())
+			guids = []net.HardwareAddr{guid}
+		})
+		It("Fail add guids calls below the failure percent", func() {
+			plugin := &plugin{conf: NoopConfig{AddFailurePercent: 30}}
+
+			plugin.randPercent = func() int { return 29 }
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0x5, guids)).ToNot(Succeed())
 
-			err = plugin.RemoveGuidsFromPKey(0, nil)
+			plugin.randPercent = func() int { return 30 }
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0x5, guids)).To(Succeed())
+		})
+		It("Always fail add guids calls with 100 failure percent", func() {
+			plugin := &plugin{conf: NoopConfig{AddFailurePercent: 100}, randPercent: func() int { return 99 }}
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0x5, guids)).ToNot(Succeed())
+		})
+		It("Add latency to subnet manager calls", func() {
+			plugin := &plugin{conf: NoopConfig{Latency: 20 * time.Millisecond}}
+			start := time.Now()
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically(">=", 20*time.Millisecond))
+		})
+		It("Return stale guids in use", func() {
+			plugin := &plugin{conf: NoopConfig{StaleGUIDs: []string{"02:00:00:00:00:00:00:01"}}}
+			inUse, err := plugin.ListGuidsInUse(context.Background())
 			Expect(err).ToNot(HaveOccurred())
+			Expect(inUse).To(Equal([]string{"02:00:00:00:00:00:00:01"}))
 		})
 	})
 })
@@ -0,0 +1,34 @@
+package plugins
+
+import (
+	"context"
+	"time"
+)
+
+// GUIDOwner identifies the kubernetes object a guid is allocated to
+type GUIDOwner struct {
+	// Kind of the owner, e.g. "Pod" or "IBGuidReservation"
+	Kind      string
+	Namespace string
+	Name      string
+	// Created is the time the guid was allocated to the owner
+	Created time.Time
+}
+
+type guidOwnersKey struct{}
+
+// WithGUIDOwners returns a context carrying the owners of the guids of a subnet manager call, keyed by the guid
+// string. Plugins may record the owners in the subnet manager, e.g. in description fields, the owners are
+// optional and calls must succeed without them.
+func WithGUIDOwners(ctx context.Context, owners map[string]GUIDOwner) context.Context {
+	if len(owners) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, guidOwnersKey{}, owners)
+}
+
+// GUIDOwnersFromContext returns the owners of the guids carried by the context, nil if there are none
+func GUIDOwnersFromContext(ctx context.Context) map[string]GUIDOwner {
+	owners, _ := ctx.Value(guidOwnersKey{}).(map[string]GUIDOwner)
+	return owners
+}
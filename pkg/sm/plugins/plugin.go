@@ -1,25 +1,44 @@
 package plugins
 
-import "net"
+import (
+	"context"
+	"errors"
+	"net"
+)
 
+// ErrNotSupported is returned by plugins for operations their subnet manager can't perform
+var ErrNotSupported = errors.New("operation is not supported by the subnet manager plugin")
+
+// SubnetManagerClient is implemented by the subnet manager plugins. The calls to the subnet manager take a
+// context, which is canceled when the call times out or the daemon shuts down, plugins must abort their
+// in-flight requests then.
 type SubnetManagerClient interface {
 	// Name returns the name of the plugin
 	Name() string
 
-	// SpecVersion returns the version of the spec of the plugin
+	// SpecVersion returns the version of the spec of the plugin, "<major>.<minor>" of the interface methods
+	// the plugin implements
 	Spec() string
 
 	// Validate Check the client can reach the subnet manager and return error in case if it is not reachable.
-	Validate() error
+	Validate(ctx context.Context) error
 
 	// AddGuidsToPKey add pkey for the given guid.
 	// It return error if failed.
-	AddGuidsToPKey(pkey int, guids []net.HardwareAddr) error
+	AddGuidsToPKey(ctx context.Context, pkey int, guids []net.HardwareAddr) error
+
+	// AddGuidsToLimitedPKey add the given guids as limited members of the pkey.
+	// It return error if failed.
+	AddGuidsToLimitedPKey(ctx context.Context, pkey int, guids []net.HardwareAddr) error
 
 	// RemoveGuidsFromPKey remove guids for given pkey.
 	// It return error if failed.
-	RemoveGuidsFromPKey(pkey int, guids []net.HardwareAddr) error
+	RemoveGuidsFromPKey(ctx context.Context, pkey int, guids []net.HardwareAddr) error
 
 	// ListGuidsInUse returns a list of all GUIDS associated with PKeys
-	ListGuidsInUse() ([]string, error)
+	ListGuidsInUse(ctx context.Context) ([]string, error)
+
+	// GetPKeyMembers returns the guids which are members of the given pkey.
+	// It returns ErrNotSupported if the subnet manager can't report the members. Added in spec version 1.1.
+	GetPKeyMembers(ctx context.Context, pkey int) ([]net.HardwareAddr, error)
 }
@@ -0,0 +1,142 @@
+// Package remote implements a subnet manager client calling the subnet manager through a subnet manager agent,
+// for fabrics where only specific hosts can reach the subnet manager.
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/agent"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/sdk"
+)
+
+const (
+	pluginName = "remote"
+	// SpecVersion is the version of the subnet manager client interface the plugin implements
+	SpecVersion = "2.0"
+)
+
+// RemoteConfig holds the address and credentials of the subnet manager agent
+type RemoteConfig struct {
+	// Address of the agent, e.g. "sm-agent.kube-system.svc:9090"
+	Address string `env:"REMOTE_AGENT_ADDRESS"`
+	// Certificate of the agent or of its certificate authority, the agent is called over TLS if set
+	Certificate string `env:"REMOTE_AGENT_CERTIFICATE"`
+	// Token presented to the agent, optional
+	Token string `env:"REMOTE_AGENT_TOKEN"`
+}
+
+// Validate checks the required fields are set
+func (c *RemoteConfig) Validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("missing required field for remote plugin \"REMOTE_AGENT_ADDRESS\"")
+	}
+	return nil
+}
+
+type remotePlugin struct {
+	PluginName  string
+	SpecVersion string
+	conf        RemoteConfig
+	client      *agent.Client
+	log         zerolog.Logger
+}
+
+func newRemotePlugin() (*remotePlugin, error) {
+	remoteConf := RemoteConfig{}
+	if err := sdk.ParseConfig(&remoteConf); err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	if remoteConf.Certificate != "" {
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM([]byte(remoteConf.Certificate)) {
+			return nil, fmt.Errorf("failed to parse agent certificate")
+		}
+		creds = credentials.NewTLS(&tls.Config{RootCAs: certPool, MinVersion: tls.VersionTLS12})
+	}
+	client, err := agent.NewClient(remoteConf.Address, creds, remoteConf.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agent client err: %v", err)
+	}
+
+	return &remotePlugin{
+		PluginName:  pluginName,
+		SpecVersion: SpecVersion,
+		conf:        remoteConf,
+		client:      client,
+		log:         sdk.Logger(pluginName),
+	}, nil
+}
+
+func (p *remotePlugin) Name() string {
+	return p.PluginName
+}
+
+func (p *remotePlugin) Spec() string {
+	return p.SpecVersion
+}
+
+func (p *remotePlugin) Validate(ctx context.Context) error {
+	info, err := p.client.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to subnet manager agent %s: %v", p.conf.Address, err)
+	}
+	if err = p.client.Validate(ctx); err != nil {
+		return fmt.Errorf("subnet manager agent %s failed to validate plugin %s: %v", p.conf.Address,
+			info.Plugin, err)
+	}
+	p.log.Info().Msgf("subnet manager agent %s serves plugin %s spec %s", p.conf.Address, info.Plugin, info.Spec)
+	return nil
+}
+
+func (p *remotePlugin) AddGuidsToPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	p.log.Debug().Msgf("adding guids %v to pKey 0x%04X", guids, pKey)
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+	return p.client.AddGuidsToPKey(ctx, pKey, guids)
+}
+
+func (p *remotePlugin) AddGuidsToLimitedPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	p.log.Debug().Msgf("adding guids %v as limited members to pKey 0x%04X", guids, pKey)
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+	return p.client.AddGuidsToLimitedPKey(ctx, pKey, guids)
+}
+
+func (p *remotePlugin) RemoveGuidsFromPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	p.log.Debug().Msgf("removing guids %v from pKey 0x%04X", guids, pKey)
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+	return p.client.RemoveGuidsFromPKey(ctx, pKey, guids)
+}
+
+func (p *remotePlugin) ListGuidsInUse(ctx context.Context) ([]string, error) {
+	return p.client.ListGuidsInUse(ctx)
+}
+
+func (p *remotePlugin) GetPKeyMembers(ctx context.Context, pKey int) ([]net.HardwareAddr, error) {
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return nil, err
+	}
+	return p.client.GetPKeyMembers(ctx, pKey)
+}
+
+// Initialize applies configs to plugin and return a subnet manager client
+func Initialize() (plugins.SubnetManagerClient, error) {
+	log.Info().Msg("Initializing remote plugin")
+	return newRemotePlugin()
+}
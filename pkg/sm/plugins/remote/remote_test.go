@@ -0,0 +1,154 @@
+package remote
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/agent"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/sdk"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/sdk/sdktest"
+)
+
+// subnetManager is an in-memory subnet manager served by the agent
+type subnetManager struct {
+	mutex sync.Mutex
+	pKeys map[int]map[string]bool // pkey -> guids
+}
+
+func (s *subnetManager) Name() string { return "memory" }
+func (s *subnetManager) Spec() string { return "2.0" }
+
+func (s *subnetManager) Validate(_ context.Context) error { return nil }
+
+func (s *subnetManager) AddGuidsToPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.pKeys[pKey] == nil {
+		s.pKeys[pKey] = make(map[string]bool)
+	}
+	for _, guid := range guids {
+		s.pKeys[pKey][guid.String()] = true
+	}
+	return nil
+}
+
+func (s *subnetManager) AddGuidsToLimitedPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	return s.AddGuidsToPKey(ctx, pKey, guids)
+}
+
+func (s *subnetManager) RemoveGuidsFromPKey(_ context.Context, pKey int, guids []net.HardwareAddr) error {
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, guid := range guids {
+		delete(s.pKeys[pKey], guid.String())
+	}
+	return nil
+}
+
+func (s *subnetManager) ListGuidsInUse(_ context.Context) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var guids []string
+	for _, members := range s.pKeys {
+		for guid := range members {
+			guids = append(guids, guid)
+		}
+	}
+	return guids, nil
+}
+
+func (s *subnetManager) GetPKeyMembers(_ context.Context, pKey int) ([]net.HardwareAddr, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var members []net.HardwareAddr
+	for guid := range s.pKeys[pKey] {
+		guidAddr, _ := net.ParseMAC(guid)
+		members = append(members, guidAddr)
+	}
+	return members, nil
+}
+
+// startAgent serves the in-memory subnet manager, it returns the address of the agent
+func startAgent(token string) (*grpc.Server, string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	server := agent.NewServer(&subnetManager{pKeys: make(map[int]map[string]bool)}, token)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return server, listener.Addr().String(), nil
+}
+
+var _ = Describe("remote plugin", func() {
+	AfterEach(func() {
+		os.Clearenv()
+	})
+	It("Fail to initialize without the agent address", func() {
+		_, err := Initialize()
+		Expect(err).To(MatchError(ContainSubstring("REMOTE_AGENT_ADDRESS")))
+	})
+	It("Fail to initialize with invalid agent certificate", func() {
+		Expect(os.Setenv("REMOTE_AGENT_ADDRESS", "127.0.0.1:9090")).To(Succeed())
+		Expect(os.Setenv("REMOTE_AGENT_CERTIFICATE", "invalid")).To(Succeed())
+		_, err := Initialize()
+		Expect(err).To(MatchError(ContainSubstring("failed to parse agent certificate")))
+	})
+	It("Validate the agent with the token", func() {
+		server, address, err := startAgent("secret")
+		Expect(err).ToNot(HaveOccurred())
+		defer server.Stop()
+
+		Expect(os.Setenv("REMOTE_AGENT_ADDRESS", address)).To(Succeed())
+		plugin, err := Initialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plugin.Validate(context.Background())).To(MatchError(ContainSubstring("token")))
+
+		Expect(os.Setenv("REMOTE_AGENT_TOKEN", "secret")).To(Succeed())
+		plugin, err = Initialize()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plugin.Name()).To(Equal("remote"))
+		Expect(plugin.Validate(context.Background())).To(Succeed())
+	})
+	It("Reject invalid pkeys without calling the agent", func() {
+		Expect(os.Setenv("REMOTE_AGENT_ADDRESS", "127.0.0.1:1")).To(Succeed())
+		plugin, err := Initialize()
+		Expect(err).ToNot(HaveOccurred())
+		err = plugin.AddGuidsToPKey(context.Background(), 0x8000, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err).ToNot(MatchError(plugins.ErrNotSupported))
+	})
+})
+
+func TestConformance(t *testing.T) {
+	server, address, err := startAgent("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	t.Setenv("REMOTE_AGENT_ADDRESS", address)
+	client, err := Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdktest.RunConformance(t, client, sdktest.Options{PKey: 0x7F00})
+}
@@ -0,0 +1,376 @@
+// Package rest implements a subnet manager client of a generic REST API subnet manager, configured with templates
+// of its requests.
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	httpDriver "github.com/Mellanox/ib-kubernetes/pkg/drivers/http"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/sdk"
+)
+
+const (
+	pluginName = "rest"
+	// SpecVersion is the version of the subnet manager client interface the plugin implements
+	SpecVersion = "2.0"
+
+	membershipFull    = "full"
+	membershipLimited = "limited"
+
+	defaultGUIDsBody = `{"pkey": "{{.PKey}}", "guids": {{json .GUIDs}}, "membership": "{{.Membership}}"}`
+)
+
+// RESTConfig maps the subnet manager client operations to the REST API of a fabric manager.
+// Paths and bodies are go templates, see requestData for the fields available to them.
+type RESTConfig struct {
+	// Base URL of the fabric manager REST API, e.g. "https://fabric-manager:8443/api"
+	URL         string `env:"REST_URL"`
+	Username    string `env:"REST_USERNAME"`    // Username of the fabric manager, optional
+	Password    string `env:"REST_PASSWORD"`    // Password of the fabric manager, optional
+	Certificate string `env:"REST_CERTIFICATE"` // Certificate of the fabric manager
+	// Path requested with GET to check the fabric manager is reachable
+	ValidatePath string `env:"REST_VALIDATE_PATH" envDefault:"/"`
+	// Path and body of the POST request adding guids to a pkey, with full or limited membership
+	AddGUIDsPath string `env:"REST_ADD_GUIDS_PATH"`
+	AddGUIDsBody string `env:"REST_ADD_GUIDS_BODY"`
+	// Path and body of the POST request removing guids from a pkey
+	RemoveGUIDsPath string `env:"REST_REMOVE_GUIDS_PATH"`
+	RemoveGUIDsBody string `env:"REST_REMOVE_GUIDS_BODY"`
+	// Path requested with GET to list the guids of all pkeys
+	ListGUIDsPath string `env:"REST_LIST_GUIDS_PATH"`
+	// Path requested with GET to list the guids of a pkey, optional
+	PKeyMembersPath string `env:"REST_PKEY_MEMBERS_PATH"`
+	// Name of the JSON field holding guids in list responses, a guid string or a list of guid strings
+	GUIDsField string `env:"REST_GUIDS_FIELD" envDefault:"guids"`
+	// Status code of successful add and remove requests
+	StatusCode int `env:"REST_STATUS_CODE" envDefault:"200"`
+}
+
+// Validate checks the required fields are set
+func (c *RESTConfig) Validate() error {
+	if c.URL == "" || c.AddGUIDsPath == "" || c.RemoveGUIDsPath == "" || c.ListGUIDsPath == "" {
+		return fmt.Errorf("missing one or more required fields for rest plugin [\"REST_URL\", " +
+			"\"REST_ADD_GUIDS_PATH\", \"REST_REMOVE_GUIDS_PATH\", \"REST_LIST_GUIDS_PATH\"]")
+	}
+	if c.GUIDsField == "" {
+		return fmt.Errorf("guids field must not be empty")
+	}
+	return nil
+}
+
+// requestData are the fields of the paths and bodies templates
+type requestData struct {
+	// PKey formatted as hex, e.g. "0x000A"
+	PKey string
+	// PKeyValue is the numeric value of the pkey
+	PKeyValue int
+	// GUIDs formatted with colons, e.g. "02:00:00:00:00:00:00:01"
+	GUIDs []string
+	// Membership of the guids, "full" or "limited", empty for removals
+	Membership string
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes the value as JSON, e.g. {{json .GUIDs}}
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	// plain strips the delimiters of guids, e.g. {{json (plain .GUIDs)}} for "0200000000000001"
+	"plain": func(guids []string) []string {
+		plainGUIDs := make([]string, 0, len(guids))
+		for _, guid := range guids {
+			plainGUIDs = append(plainGUIDs, strings.ReplaceAll(guid, ":", ""))
+		}
+		return plainGUIDs
+	},
+}
+
+type restPlugin struct {
+	PluginName  string
+	SpecVersion string
+	conf        RESTConfig
+	client      httpDriver.Client
+	log         zerolog.Logger
+
+	validatePath    *template.Template
+	addGUIDsPath    *template.Template
+	addGUIDsBody    *template.Template
+	removeGUIDsPath *template.Template
+	removeGUIDsBody *template.Template
+	listGUIDsPath   *template.Template
+	// pKeyMembersPath is nil if the fabric manager can't report the members of a pkey
+	pKeyMembersPath *template.Template
+}
+
+func newRESTPlugin() (*restPlugin, error) {
+	restConf := RESTConfig{}
+	if err := sdk.ParseConfig(&restConf); err != nil {
+		return nil, err
+	}
+	restConf.URL = strings.TrimSuffix(restConf.URL, "/")
+	if restConf.AddGUIDsBody == "" {
+		restConf.AddGUIDsBody = defaultGUIDsBody
+	}
+	if restConf.RemoveGUIDsBody == "" {
+		restConf.RemoveGUIDsBody = defaultGUIDsBody
+	}
+
+	p := &restPlugin{
+		PluginName:  pluginName,
+		SpecVersion: SpecVersion,
+		conf:        restConf,
+		log:         sdk.Logger(pluginName),
+	}
+	for _, tmpl := range []struct {
+		name   string
+		text   string
+		target **template.Template
+	}{
+		{name: "REST_VALIDATE_PATH", text: restConf.ValidatePath, target: &p.validatePath},
+		{name: "REST_ADD_GUIDS_PATH", text: restConf.AddGUIDsPath, target: &p.addGUIDsPath},
+		{name: "REST_ADD_GUIDS_BODY", text: restConf.AddGUIDsBody, target: &p.addGUIDsBody},
+		{name: "REST_REMOVE_GUIDS_PATH", text: restConf.RemoveGUIDsPath, target: &p.removeGUIDsPath},
+		{name: "REST_REMOVE_GUIDS_BODY", text: restConf.RemoveGUIDsBody, target: &p.removeGUIDsBody},
+		{name: "REST_LIST_GUIDS_PATH", text: restConf.ListGUIDsPath, target: &p.listGUIDsPath},
+		{name: "REST_PKEY_MEMBERS_PATH", text: restConf.PKeyMembersPath, target: &p.pKeyMembersPath},
+	} {
+		if tmpl.text == "" {
+			continue
+		}
+		parsed, err := template.New(tmpl.name).Funcs(templateFuncs).Option("missingkey=error").Parse(tmpl.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %v", tmpl.name, err)
+		}
+		*tmpl.target = parsed
+	}
+
+	isSecure := strings.HasPrefix(strings.ToLower(restConf.URL), "https://")
+	auth := &httpDriver.BasicAuth{Username: restConf.Username, Password: restConf.Password}
+	client, err := httpDriver.NewClient(isSecure, auth, restConf.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client err: %v", err)
+	}
+	p.client = client
+	return p, nil
+}
+
+func (p *restPlugin) Name() string {
+	return p.PluginName
+}
+
+func (p *restPlugin) Spec() string {
+	return p.SpecVersion
+}
+
+func (p *restPlugin) Validate(ctx context.Context) error {
+	url, err := p.render(p.validatePath, requestData{})
+	if err != nil {
+		return err
+	}
+	if _, err = p.client.Get(ctx, p.conf.URL+url, http.StatusOK); err != nil {
+		return fmt.Errorf("failed to connect to fabric manager: %v", err)
+	}
+	return nil
+}
+
+func (p *restPlugin) AddGuidsToPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	p.log.Debug().Msgf("adding guids %v to pKey 0x%04X", guids, pKey)
+	return p.addGuidsToPKey(ctx, pKey, guids, membershipFull)
+}
+
+func (p *restPlugin) AddGuidsToLimitedPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	p.log.Debug().Msgf("adding guids %v as limited members to pKey 0x%04X", guids, pKey)
+	return p.addGuidsToPKey(ctx, pKey, guids, membershipLimited)
+}
+
+func (p *restPlugin) addGuidsToPKey(ctx context.Context, pKey int, guids []net.HardwareAddr, membership string) error {
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+
+	data := newRequestData(pKey, guids, membership)
+	if err := p.post(ctx, p.addGUIDsPath, p.addGUIDsBody, data); err != nil {
+		return fmt.Errorf("failed to add guids %v to PKey 0x%04X with error: %v", guids, pKey, err)
+	}
+	return nil
+}
+
+func (p *restPlugin) RemoveGuidsFromPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	p.log.Debug().Msgf("removing guids %v pkey 0x%04X", guids, pKey)
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+
+	data := newRequestData(pKey, guids, "")
+	if err := p.post(ctx, p.removeGUIDsPath, p.removeGUIDsBody, data); err != nil {
+		return fmt.Errorf("failed to delete guids %v from PKey 0x%04X, with error: %v", guids, pKey, err)
+	}
+	return nil
+}
+
+// ListGuidsInUse returns all guids currently in use by pKeys
+func (p *restPlugin) ListGuidsInUse(ctx context.Context) ([]string, error) {
+	guids, err := p.getGUIDs(ctx, p.listGUIDsPath, requestData{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of guids: %v", err)
+	}
+
+	guidsInUse := make([]string, 0, len(guids))
+	for _, guid := range guids {
+		guidsInUse = append(guidsInUse, sdk.FormatGUID(guid))
+	}
+	return guidsInUse, nil
+}
+
+// GetPKeyMembers returns the guids which are members of the given pKey
+func (p *restPlugin) GetPKeyMembers(ctx context.Context, pKey int) ([]net.HardwareAddr, error) {
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return nil, err
+	}
+	if p.pKeyMembersPath == nil {
+		return nil, plugins.ErrNotSupported
+	}
+
+	guids, err := p.getGUIDs(ctx, p.pKeyMembersPath, newRequestData(pKey, nil, ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of PKey 0x%04X: %v", pKey, err)
+	}
+	return guids, nil
+}
+
+func newRequestData(pKey int, guids []net.HardwareAddr, membership string) requestData {
+	data := requestData{PKey: ibUtils.FormatPKey(pKey), PKeyValue: pKey, GUIDs: make([]string, 0, len(guids)),
+		Membership: membership}
+	for _, guid := range guids {
+		data.GUIDs = append(data.GUIDs, guid.String())
+	}
+	return data
+}
+
+// render executes the template with the request data
+func (p *restPlugin) render(tmpl *template.Template, data requestData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %v", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+func (p *restPlugin) post(ctx context.Context, pathTmpl, bodyTmpl *template.Template, data requestData) error {
+	path, err := p.render(pathTmpl, data)
+	if err != nil {
+		return err
+	}
+	body, err := p.render(bodyTmpl, data)
+	if err != nil {
+		return err
+	}
+	if !json.Valid([]byte(body)) {
+		return fmt.Errorf("%s template rendered invalid json: %s", bodyTmpl.Name(), body)
+	}
+
+	_, err = p.client.Post(ctx, p.conf.URL+path, p.conf.StatusCode, []byte(body))
+	return err
+}
+
+// getGUIDs requests the path and returns the guids of the response
+func (p *restPlugin) getGUIDs(ctx context.Context, pathTmpl *template.Template, data requestData) (
+	[]net.HardwareAddr, error) {
+	path, err := p.render(pathTmpl, data)
+	if err != nil {
+		return nil, err
+	}
+	response, err := p.client.Get(ctx, p.conf.URL+path, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err = json.Unmarshal(response, &value); err != nil {
+		return nil, fmt.Errorf("failed to parse response %q: %v", string(response), err)
+	}
+	return collectGUIDs(value, p.conf.GUIDsField, nil)
+}
+
+// collectGUIDs walks the JSON value and returns the guids of all the fields with the given name, each guid once
+func collectGUIDs(value interface{}, field string, seen map[string]bool) ([]net.HardwareAddr, error) {
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+
+	var guids []net.HardwareAddr
+	addGUID := func(guid string) error {
+		guidAddr, err := sdk.ParseGUID(guid)
+		if err != nil {
+			return err
+		}
+		if !seen[guidAddr.String()] {
+			seen[guidAddr.String()] = true
+			guids = append(guids, guidAddr)
+		}
+		return nil
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, fieldValue := range typed {
+			if key != field {
+				nested, err := collectGUIDs(fieldValue, field, seen)
+				if err != nil {
+					return nil, err
+				}
+				guids = append(guids, nested...)
+				continue
+			}
+
+			switch guidsValue := fieldValue.(type) {
+			case string:
+				if err := addGUID(guidsValue); err != nil {
+					return nil, err
+				}
+			case []interface{}:
+				for _, item := range guidsValue {
+					guid, ok := item.(string)
+					if !ok {
+						return nil, fmt.Errorf("invalid guid %v of field %s, expected a string", item, field)
+					}
+					if err := addGUID(guid); err != nil {
+						return nil, err
+					}
+				}
+			case nil:
+			default:
+				return nil, fmt.Errorf("invalid value %v of field %s, expected a guid or a list of guids",
+					fieldValue, field)
+			}
+		}
+	case []interface{}:
+		for _, item := range typed {
+			nested, err := collectGUIDs(item, field, seen)
+			if err != nil {
+				return nil, err
+			}
+			guids = append(guids, nested...)
+		}
+	}
+	return guids, nil
+}
+
+// Initialize applies configs to plugin and return a subnet manager client
+func Initialize() (plugins.SubnetManagerClient, error) {
+	log.Info().Msg("Initializing rest plugin")
+	return newRESTPlugin()
+}
@@ -0,0 +1,268 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/sdk/sdktest"
+)
+
+// fabricManager is an in-memory fabric manager serving the REST API of the default templates
+type fabricManager struct {
+	mutex  sync.Mutex
+	pKeys  map[string]map[string]string // pkey -> guid -> membership
+	bodies []string
+}
+
+type fabricManagerRequest struct {
+	PKey       string   `json:"pkey"`
+	GUIDs      []string `json:"guids"`
+	Membership string   `json:"membership"`
+}
+
+func newFabricManagerServer() (*fabricManager, *httptest.Server) {
+	fm := &fabricManager{pKeys: make(map[string]map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/health", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/api/partitions/", func(w http.ResponseWriter, r *http.Request) {
+		fm.mutex.Lock()
+		defer fm.mutex.Unlock()
+
+		pKey := strings.TrimPrefix(r.URL.Path, "/api/partitions/")
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"pkey": pKey, "guids": fm.guids(pKey)})
+			return
+		}
+
+		var request fabricManagerRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := json.Marshal(request)
+		fm.bodies = append(fm.bodies, string(data))
+		if strings.HasSuffix(pKey, "/remove") {
+			for _, guid := range request.GUIDs {
+				delete(fm.pKeys[request.PKey], guid)
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if fm.pKeys[request.PKey] == nil {
+			fm.pKeys[request.PKey] = make(map[string]string)
+		}
+		for _, guid := range request.GUIDs {
+			fm.pKeys[request.PKey][guid] = request.Membership
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/api/partitions", func(w http.ResponseWriter, _ *http.Request) {
+		fm.mutex.Lock()
+		defer fm.mutex.Unlock()
+
+		var partitions []interface{}
+		for pKey := range fm.pKeys {
+			partitions = append(partitions, map[string]interface{}{"pkey": pKey, "guids": fm.guids(pKey)})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"partitions": partitions})
+	})
+	return fm, httptest.NewServer(mux)
+}
+
+// guids returns the guids of the pkey without delimiters, as reported by some fabric managers
+func (fm *fabricManager) guids(pKey string) []string {
+	guids := []string{}
+	for guid := range fm.pKeys[pKey] {
+		guids = append(guids, strings.ReplaceAll(guid, ":", ""))
+	}
+	sort.Strings(guids)
+	return guids
+}
+
+func setFabricManagerEnv(url string) {
+	Expect(os.Setenv("REST_URL", url+"/api")).To(Succeed())
+	Expect(os.Setenv("REST_VALIDATE_PATH", "/health")).To(Succeed())
+	Expect(os.Setenv("REST_ADD_GUIDS_PATH", "/partitions/{{.PKey}}")).To(Succeed())
+	Expect(os.Setenv("REST_REMOVE_GUIDS_PATH", "/partitions/{{.PKey}}/remove")).To(Succeed())
+	Expect(os.Setenv("REST_LIST_GUIDS_PATH", "/partitions")).To(Succeed())
+	Expect(os.Setenv("REST_PKEY_MEMBERS_PATH", "/partitions/{{.PKey}}")).To(Succeed())
+}
+
+var _ = Describe("rest plugin", func() {
+	var (
+		fm     *fabricManager
+		server *httptest.Server
+		guid1  net.HardwareAddr
+		guid2  net.HardwareAddr
+	)
+
+	BeforeEach(func() {
+		fm, server = newFabricManagerServer()
+		setFabricManagerEnv(server.URL)
+		guid1, _ = net.ParseMAC("02:00:00:00:00:00:00:01")
+		guid2, _ = net.ParseMAC("02:00:00:00:00:00:00:02")
+	})
+	AfterEach(func() {
+		server.Close()
+		os.Clearenv()
+	})
+
+	Context("Initialize", func() {
+		It("Initialize rest plugin", func() {
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.Name()).To(Equal("rest"))
+			Expect(plugin.Spec()).To(Equal("2.0"))
+			Expect(plugin.Validate(context.Background())).To(Succeed())
+		})
+		It("Initialize rest plugin with missing required paths", func() {
+			Expect(os.Unsetenv("REST_LIST_GUIDS_PATH")).To(Succeed())
+			_, err := Initialize()
+			Expect(err).To(HaveOccurred())
+		})
+		It("Initialize rest plugin with invalid template", func() {
+			Expect(os.Setenv("REST_ADD_GUIDS_BODY", `{"pkey": "{{.PKey"}`)).To(Succeed())
+			_, err := Initialize()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("REST_ADD_GUIDS_BODY"))
+		})
+		It("Validate unreachable fabric manager", func() {
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+			server.Close()
+			Expect(plugin.Validate(context.Background())).ToNot(Succeed())
+		})
+	})
+	Context("PKeys", func() {
+		It("Add guids as full and limited members", func() {
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0xA, []net.HardwareAddr{guid1})).To(Succeed())
+			Expect(plugin.AddGuidsToLimitedPKey(context.Background(), 0xA, []net.HardwareAddr{guid2})).To(Succeed())
+			Expect(fm.pKeys["0x000A"]).To(Equal(map[string]string{guid1.String(): "full",
+				guid2.String(): "limited"}))
+		})
+		It("Add guids with a custom body template", func() {
+			Expect(os.Setenv("REST_ADD_GUIDS_BODY",
+				`{"pkey": "{{.PKeyValue}}", "guids": {{json (plain .GUIDs)}}, "membership": "{{.Membership}}"}`)).
+				To(Succeed())
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0xA, []net.HardwareAddr{guid1})).To(Succeed())
+			Expect(fm.bodies).To(Equal([]string{`{"pkey":"10","guids":["0200000000000001"],"membership":"full"}`}))
+		})
+		It("Reject body template rendering invalid json", func() {
+			Expect(os.Setenv("REST_ADD_GUIDS_BODY", `{"guids": {{.GUIDs}}}`)).To(Succeed())
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			err = plugin.AddGuidsToPKey(context.Background(), 0xA, []net.HardwareAddr{guid1})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid json"))
+			Expect(fm.bodies).To(BeEmpty())
+		})
+		It("Reject invalid pkey", func() {
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0x8000, []net.HardwareAddr{guid1})).ToNot(Succeed())
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), -1, []net.HardwareAddr{guid1})).ToNot(Succeed())
+		})
+		It("Fail on unexpected status code", func() {
+			Expect(os.Setenv("REST_STATUS_CODE", "204")).To(Succeed())
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			err = plugin.AddGuidsToPKey(context.Background(), 0xA, []net.HardwareAddr{guid1})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("status code 200"))
+		})
+		It("List guids in use and pkey members", func() {
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0xA, []net.HardwareAddr{guid1})).To(Succeed())
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0xB, []net.HardwareAddr{guid1, guid2})).To(Succeed())
+
+			guids, err := plugin.ListGuidsInUse(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guids).To(ConsistOf(guid1.String(), guid2.String()))
+
+			members, err := plugin.GetPKeyMembers(context.Background(), 0xB)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(members).To(Equal([]net.HardwareAddr{guid1, guid2}))
+
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0xB, []net.HardwareAddr{guid1})).To(Succeed())
+			members, err = plugin.GetPKeyMembers(context.Background(), 0xB)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(members).To(Equal([]net.HardwareAddr{guid2}))
+		})
+		It("Get pkey members without members path", func() {
+			Expect(os.Unsetenv("REST_PKEY_MEMBERS_PATH")).To(Succeed())
+			plugin, err := Initialize()
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = plugin.GetPKeyMembers(context.Background(), 0xA)
+			Expect(err).To(MatchError(plugins.ErrNotSupported))
+		})
+	})
+	Context("collectGUIDs", func() {
+		It("Collect guids of nested fields", func() {
+			var value interface{}
+			Expect(json.Unmarshal([]byte(`{"items": [{"guids": "0x0200000000000001"}, `+
+				`{"nested": {"guids": ["02:00:00:00:00:00:00:02", "0200000000000001"]}}, {"guids": null}]}`),
+				&value)).To(Succeed())
+			guids, err := collectGUIDs(value, "guids", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guids).To(ConsistOf(guid1, guid2))
+		})
+		It("Fail on invalid guids", func() {
+			var value interface{}
+			Expect(json.Unmarshal([]byte(`{"guids": ["not-a-guid"]}`), &value)).To(Succeed())
+			_, err := collectGUIDs(value, "guids", nil)
+			Expect(err).To(HaveOccurred())
+
+			Expect(json.Unmarshal([]byte(`{"guids": 5}`), &value)).To(Succeed())
+			_, err = collectGUIDs(value, "guids", nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+func TestConformance(t *testing.T) {
+	_, server := newFabricManagerServer()
+	defer server.Close()
+
+	for key, value := range map[string]string{
+		"REST_URL":               server.URL + "/api",
+		"REST_VALIDATE_PATH":     "/health",
+		"REST_ADD_GUIDS_PATH":    "/partitions/{{.PKey}}",
+		"REST_REMOVE_GUIDS_PATH": "/partitions/{{.PKey}}/remove",
+		"REST_LIST_GUIDS_PATH":   "/partitions",
+		"REST_PKEY_MEMBERS_PATH": "/partitions/{{.PKey}}",
+	} {
+		t.Setenv(key, value)
+	}
+
+	client, err := Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdktest.RunConformance(t, client, sdktest.Options{PKey: 0x7F00})
+}
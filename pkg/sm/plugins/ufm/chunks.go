@@ -0,0 +1,75 @@
+package ufm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// GUIDChunksError is returned when the requests of some chunks of the guids of a pkey failed, the guids of the other
+// chunks were applied
+type GUIDChunksError struct {
+	// Operation is "add" or "remove"
+	Operation string
+	PKey      int
+	// Failed are the guids of the failed chunks
+	Failed []net.HardwareAddr
+	// Total is the number of guids of the request
+	Total int
+	// Errs are the errors of the failed chunks
+	Errs []error
+}
+
+func (e *GUIDChunksError) Error() string {
+	return fmt.Sprintf("failed to %s %d of %d guids of PKey 0x%04X: %v", e.Operation, len(e.Failed), e.Total,
+		e.PKey, errors.Join(e.Errs...))
+}
+
+func (e *GUIDChunksError) Unwrap() []error {
+	return e.Errs
+}
+
+// chunkGUIDs splits the guids into chunks of at most size guids, a single chunk if size is 0
+func chunkGUIDs(guids []net.HardwareAddr, size int) [][]net.HardwareAddr {
+	if size <= 0 || len(guids) <= size {
+		return [][]net.HardwareAddr{guids}
+	}
+
+	chunks := make([][]net.HardwareAddr, 0, (len(guids)+size-1)/size)
+	for start := 0; start < len(guids); start += size {
+		end := min(start+size, len(guids))
+		chunks = append(chunks, guids[start:end])
+	}
+	return chunks
+}
+
+// requestGUIDChunks sends a request for every chunk of the guids, the remaining chunks are still sent when a chunk
+// fails. The error of a single chunk request is returned as is, failures of several chunks are aggregated into a
+// GUIDChunksError. Chunks aren't sent once the context is done.
+func requestGUIDChunks(ctx context.Context, operation string, pKey int, guids []net.HardwareAddr, size int,
+	request func(chunk []net.HardwareAddr) error) error {
+	chunks := chunkGUIDs(guids, size)
+	if len(chunks) == 1 {
+		return request(chunks[0])
+	}
+
+	chunksErr := &GUIDChunksError{Operation: operation, PKey: pKey, Total: len(guids)}
+	for index, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			for _, skipped := range chunks[index:] {
+				chunksErr.Failed = append(chunksErr.Failed, skipped...)
+			}
+			chunksErr.Errs = append(chunksErr.Errs, err)
+			break
+		}
+		if err := request(chunk); err != nil {
+			chunksErr.Failed = append(chunksErr.Failed, chunk...)
+			chunksErr.Errs = append(chunksErr.Errs, err)
+		}
+	}
+	if len(chunksErr.Errs) == 0 {
+		return nil
+	}
+	return chunksErr
+}
@@ -0,0 +1,102 @@
+package ufm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	httpDriver "github.com/Mellanox/ib-kubernetes/pkg/drivers/http"
+)
+
+// ufmCredentials are the credentials used to authenticate against UFM and verify its certificate
+type ufmCredentials struct {
+	Username    string
+	Password    string
+	Certificate string
+}
+
+// hasCredentialFiles returns true if any of the credentials is read from a file
+func (c *UFMConfig) hasCredentialFiles() bool {
+	return c.UsernameFile != "" || c.PasswordFile != "" || c.CertificateFile != ""
+}
+
+// loadCredentials returns the configured credentials, credentials configured by file take precedence
+// over the ones configured by environment variable
+func (c *UFMConfig) loadCredentials() (*ufmCredentials, error) {
+	creds := &ufmCredentials{Username: c.Username, Password: c.Password, Certificate: c.Certificate}
+	for _, credFile := range []struct {
+		path  string
+		value *string
+		trim  bool
+	}{
+		{path: c.UsernameFile, value: &creds.Username, trim: true},
+		{path: c.PasswordFile, value: &creds.Password, trim: true},
+		{path: c.CertificateFile, value: &creds.Certificate},
+	} {
+		if credFile.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(credFile.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ufm credentials file %s: %v", credFile.path, err)
+		}
+		*credFile.value = string(data)
+		if credFile.trim {
+			*credFile.value = strings.TrimSpace(*credFile.value)
+		}
+	}
+	return creds, nil
+}
+
+// newHTTPClient creates an http client authenticating with the given credentials
+func (c *UFMConfig) newHTTPClient(creds *ufmCredentials) (httpDriver.Client, error) {
+	isSecure := strings.EqualFold(c.HTTPSchema, httpsProto)
+	auth := &httpDriver.BasicAuth{Username: creds.Username, Password: creds.Password}
+	var opts []httpDriver.ClientOption
+	if c.SocketPath != "" {
+		opts = append(opts, httpDriver.WithUnixSocket(c.SocketPath))
+	}
+	client, err := httpDriver.NewClient(isSecure, auth, creds.Certificate, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client err: %v", err)
+	}
+	return client, nil
+}
+
+// reloadCredentials re-reads the credentials files and recreates the http client when they changed,
+// so credentials rotated in the mounted Secret are used without restarting the daemon
+func (u *ufmPlugin) reloadCredentials() {
+	if !u.conf.hasCredentialFiles() {
+		return
+	}
+
+	creds, err := u.conf.loadCredentials()
+	if err != nil {
+		log.Warn().Msgf("failed to reload ufm credentials, keeping the current ones: %v", err)
+		return
+	}
+
+	u.clientMutex.Lock()
+	defer u.clientMutex.Unlock()
+	if u.credentials != nil && *creds == *u.credentials {
+		return
+	}
+
+	client, err := u.conf.newHTTPClient(creds)
+	if err != nil {
+		log.Warn().Msgf("failed to reload ufm credentials, keeping the current ones: %v", err)
+		return
+	}
+	log.Info().Msg("ufm credentials files changed, reloaded credentials")
+	u.client = client
+	u.credentials = creds
+}
+
+// getClient returns the http client of the current credentials
+func (u *ufmPlugin) getClient() httpDriver.Client {
+	u.clientMutex.Lock()
+	defer u.clientMutex.Unlock()
+	return u.client
+}
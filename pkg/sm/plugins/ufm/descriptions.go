@@ -0,0 +1,66 @@
+package ufm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+// descriptionPrefix starts the descriptions written by ib-kubernetes, so fabric admins can tell them apart
+const descriptionPrefix = "ib-kubernetes"
+
+// partitionDescription returns the description of a pkey created by this cluster,
+// e.g. "ib-kubernetes cluster=cluster-a"
+func (u *ufmPlugin) partitionDescription() string {
+	if u.conf.ClusterID == "" {
+		return descriptionPrefix
+	}
+	return fmt.Sprintf("%s cluster=%s", descriptionPrefix, u.conf.ClusterID)
+}
+
+// guidDescription returns the description of a guid owned by a kubernetes object,
+// e.g. "ib-kubernetes cluster=cluster-a pod=default/web-0 created=2024-01-02T15:04:05Z"
+func (u *ufmPlugin) guidDescription(owner plugins.GUIDOwner) string {
+	fields := []string{u.partitionDescription()}
+	kind := strings.ToLower(owner.Kind)
+	if kind == "" {
+		kind = "owner"
+	}
+	if owner.Namespace != "" {
+		fields = append(fields, fmt.Sprintf("%s=%s/%s", kind, owner.Namespace, owner.Name))
+	} else {
+		fields = append(fields, fmt.Sprintf("%s=%s", kind, owner.Name))
+	}
+	if !owner.Created.IsZero() {
+		fields = append(fields, "created="+owner.Created.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(fields, " ")
+}
+
+// describePKeyConfig sets the description of the pkey created by the request and of the guids of the chunk which
+// owners are carried by the context. Descriptions are set only when enabled and supported by the UFM version.
+func (u *ufmPlugin) describePKeyConfig(ctx context.Context, pKeyConfig *PKeyConfig, chunk []net.HardwareAddr) {
+	if !u.conf.GUIDDescriptions || !u.getAPI().descriptions {
+		return
+	}
+	if pKeyConfig.PartitionName != "" {
+		pKeyConfig.Description = u.partitionDescription()
+	}
+
+	owners := plugins.GUIDOwnersFromContext(ctx)
+	for _, guid := range chunk {
+		owner, ok := owners[guid.String()]
+		if !ok {
+			continue
+		}
+		if pKeyConfig.GUIDsDescription == nil {
+			pKeyConfig.GUIDsDescription = make(map[string]string, len(chunk))
+		}
+		pKeyConfig.GUIDsDescription[ibUtils.GUIDToString(guid)] = u.guidDescription(owner)
+	}
+}
@@ -0,0 +1,96 @@
+package ufm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+)
+
+// Membership types of guids in a pkey
+const (
+	membershipFull    = "full"
+	membershipLimited = "limited"
+)
+
+// PKeyConfig is the request body adding guids to a pkey.
+// Index0 and IPOverIB are supported by UFM 6.x and newer only, and are omitted when nil.
+// PartitionName names a pkey created by the request, and is omitted when empty.
+// Description and GUIDsDescription are supported by UFM 6.x and newer only, and are omitted when empty,
+// GUIDsDescription maps the guids formatted without delimiters to their description.
+type PKeyConfig struct {
+	PKey             string            `json:"pkey"`
+	PartitionName    string            `json:"partition_name,omitempty"`
+	Description      string            `json:"description,omitempty"`
+	Index0           *bool             `json:"index0,omitempty"`
+	IPOverIB         *bool             `json:"ip_over_ib,omitempty"`
+	Membership       string            `json:"membership,omitempty"`
+	GUIDs            []string          `json:"guids"`
+	GUIDsDescription map[string]string `json:"guids_description,omitempty"`
+}
+
+// PKeyGUIDs is the request body removing guids from a pkey
+type PKeyGUIDs struct {
+	PKey  string   `json:"pkey"`
+	GUIDs []string `json:"guids"`
+}
+
+// GUIDEntry is a guid member of a pkey as returned by UFM, the guid is formatted without delimiters,
+// e.g. "020000000000003e"
+type GUIDEntry struct {
+	GUID       string `json:"guid"`
+	Membership string `json:"membership,omitempty"`
+	Index0     bool   `json:"index0,omitempty"`
+}
+
+// PKeyData is a pkey with its guids as returned by UFM when requested with guids data
+type PKeyData struct {
+	Partition string      `json:"partition,omitempty"`
+	GUIDs     []GUIDEntry `json:"guids"`
+}
+
+// VersionResponse is the response of the UFM version endpoint, e.g. {"ufm_release_version": "6.10.0-3"}
+type VersionResponse struct {
+	Version string `json:"ufm_release_version"`
+}
+
+// formatPKey returns the pkey in the format expected by UFM, e.g. "0x00FF"
+func formatPKey(pKey int) string {
+	return ibUtils.FormatPKey(pKey)
+}
+
+// formatGUIDs returns the guids in the format expected by UFM, without delimiters
+func formatGUIDs(guids []net.HardwareAddr) []string {
+	guidsString := make([]string, 0, len(guids))
+	for _, guid := range guids {
+		guidsString = append(guidsString, ibUtils.GUIDToString(guid))
+	}
+	return guidsString
+}
+
+// newPKeyConfig returns the request adding guids to the pkey with the given membership, index0 and ip over ib
+// attributes are set only if extendedAttrs is true
+func newPKeyConfig(pKey int, guids []net.HardwareAddr, membership string, index0, extendedAttrs bool) *PKeyConfig {
+	config := &PKeyConfig{PKey: formatPKey(pKey), Membership: membership, GUIDs: formatGUIDs(guids)}
+	if extendedAttrs {
+		ipOverIB := true
+		config.Index0 = &index0
+		config.IPOverIB = &ipOverIB
+	}
+	return config
+}
+
+// newPKeyGUIDs returns the request removing guids from the pkey
+func newPKeyGUIDs(pKey int, guids []net.HardwareAddr) *PKeyGUIDs {
+	return &PKeyGUIDs{PKey: formatPKey(pKey), GUIDs: formatGUIDs(guids)}
+}
+
+// marshalRequest returns the JSON body of the request model
+func marshalRequest(request interface{}) ([]byte, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ufm request %+v: %v", request, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,65 @@
+package ufm
+
+import (
+	"encoding/json"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ufm REST Models", func() {
+	var guids []net.HardwareAddr
+
+	BeforeEach(func() {
+		guid1, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+		Expect(err).ToNot(HaveOccurred())
+		guid2, err := net.ParseMAC("02:00:00:00:00:00:00:0a")
+		Expect(err).ToNot(HaveOccurred())
+		guids = []net.HardwareAddr{guid1, guid2}
+	})
+
+	Context("Requests", func() {
+		It("Marshal add guids request with extended attributes", func() {
+			data, err := marshalRequest(newPKeyConfig(0x5, guids, membershipFull, true, true))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(`{"pkey": "0x0005", "index0": true, "ip_over_ib": true, ` +
+				`"membership": "full", "guids": ["1122334455667788", "020000000000000a"]}`))
+		})
+		It("Marshal add guids request with index0 disabled", func() {
+			data, err := marshalRequest(newPKeyConfig(0x7FFF, guids[:1], membershipLimited, false, true))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(`{"pkey": "0x7FFF", "index0": false, "ip_over_ib": true, ` +
+				`"membership": "limited", "guids": ["1122334455667788"]}`))
+		})
+		It("Marshal add guids request without extended attributes", func() {
+			data, err := marshalRequest(newPKeyConfig(0x1234, guids[:1], membershipFull, true, false))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(`{"pkey": "0x1234", "membership": "full", "guids": ["1122334455667788"]}`))
+		})
+		It("Marshal remove guids request", func() {
+			data, err := marshalRequest(newPKeyGUIDs(0x1234, guids))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(`{"pkey": "0x1234", "guids": ["1122334455667788", "020000000000000a"]}`))
+		})
+		It("Marshal request without guids", func() {
+			data, err := marshalRequest(newPKeyGUIDs(0x1234, nil))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(`{"pkey": "0x1234", "guids": []}`))
+		})
+	})
+	Context("Responses", func() {
+		It("Unmarshal pkey with guids data", func() {
+			var pKeyData PKeyData
+			Expect(json.Unmarshal([]byte(`{"partition": "api_pkey_0x5", "guids": [`+
+				`{"guid": "020000000000003e", "membership": "full", "index0": true}]}`), &pKeyData)).To(Succeed())
+			Expect(pKeyData).To(Equal(PKeyData{Partition: "api_pkey_0x5",
+				GUIDs: []GUIDEntry{{GUID: "020000000000003e", Membership: membershipFull, Index0: true}}}))
+		})
+		It("Unmarshal version", func() {
+			var version VersionResponse
+			Expect(json.Unmarshal([]byte(`{"ufm_release_version": "6.10.0-3"}`), &version)).To(Succeed())
+			Expect(version.Version).To(Equal("6.10.0-3"))
+		})
+	})
+})
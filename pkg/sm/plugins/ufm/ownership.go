@@ -0,0 +1,114 @@
+package ufm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	httpDriver "github.com/Mellanox/ib-kubernetes/pkg/drivers/http"
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+)
+
+// clusterPartitionPrefix prefixes the names of partitions created by ib-kubernetes clusters with a cluster id
+const clusterPartitionPrefix = "k8s-"
+
+// partitionName returns the name marking the pkey as owned by this cluster, e.g. "k8s-cluster-a-0x0005"
+func (u *ufmPlugin) partitionName(pKey int) string {
+	return fmt.Sprintf("%s%s-%s", clusterPartitionPrefix, u.conf.ClusterID, formatPKey(pKey))
+}
+
+// pKeyOwnership checks the pkey can be mutated by this cluster when a cluster id is configured. Pkeys marked
+// by another cluster are never mutated. If exclusive is set, existing pkeys must also carry this cluster's
+// marker. The default partition is shared by all clusters and never marked. It returns the partition name to
+// create the pkey with if it doesn't exist yet, empty otherwise.
+func (u *ufmPlugin) pKeyOwnership(ctx context.Context, pKey int, exclusive bool) (string, error) {
+	if u.conf.ClusterID == "" || ibUtils.IsDefaultPKey(pKey) {
+		return "", nil
+	}
+
+	response, err := u.get(ctx, fmt.Sprintf(u.getAPI().getPKeyPath, pKey))
+	if err != nil {
+		if httpDriver.IsStatusCode(err, http.StatusNotFound) {
+			return u.partitionName(pKey), nil
+		}
+		return "", fmt.Errorf("failed to check owner of PKey 0x%04X: %v", pKey, err)
+	}
+
+	var pKeyData PKeyData
+	if err = json.Unmarshal(response, &pKeyData); err != nil {
+		return "", fmt.Errorf("failed to check owner of PKey 0x%04X: %v", pKey, err)
+	}
+
+	switch {
+	case pKeyData.Partition == u.partitionName(pKey):
+		return "", nil
+	case strings.HasPrefix(pKeyData.Partition, clusterPartitionPrefix):
+		return "", fmt.Errorf("PKey 0x%04X is owned by another cluster, partition %q", pKey, pKeyData.Partition)
+	case exclusive:
+		return "", fmt.Errorf("PKey 0x%04X is not owned by cluster %s, partition %q", pKey, u.conf.ClusterID,
+			pKeyData.Partition)
+	}
+	return "", nil
+}
+
+// pKeyLock returns the lock of the pkey, held while guids are added to it and while it's checked for members and
+// deleted, so guids added by this daemon aren't deleted with the pkey
+func (u *ufmPlugin) pKeyLock(pKey int) *sync.Mutex {
+	u.pKeyLocksMutex.Lock()
+	defer u.pKeyLocksMutex.Unlock()
+
+	if u.pKeyLocks == nil {
+		u.pKeyLocks = make(map[int]*sync.Mutex)
+	}
+	lock, ok := u.pKeyLocks[pKey]
+	if !ok {
+		lock = &sync.Mutex{}
+		u.pKeyLocks[pKey] = lock
+	}
+	return lock
+}
+
+// deleteEmptyPKey deletes the pkey once its last guid was removed, if it is owned by this cluster, so the empty
+// partitions don't accumulate in long-lived fabrics. Shared pkeys, pkeys of other clusters and the default partition
+// are never deleted. Failures are logged only, as the guids were removed, the pkey is deleted on a later removal.
+// The pkey lock is held from the members check to the deletion, so concurrent additions of this daemon wait and
+// recreate the pkey. The pkeys must have a single writer, as the guids added by another daemon between the check
+// and the deletion are deleted with the pkey.
+func (u *ufmPlugin) deleteEmptyPKey(ctx context.Context, pKey int) {
+	if u.conf.ClusterID == "" || ibUtils.IsDefaultPKey(pKey) {
+		return
+	}
+
+	lock := u.pKeyLock(pKey)
+	lock.Lock()
+	defer lock.Unlock()
+
+	api := u.getAPI()
+	response, err := u.get(ctx, fmt.Sprintf(api.getPKeyPath, pKey))
+	if err != nil {
+		if !httpDriver.IsStatusCode(err, http.StatusNotFound) {
+			log.Warn().Msgf("failed to check if PKey 0x%04X is empty: %v", pKey, err)
+		}
+		return
+	}
+
+	var pKeyData PKeyData
+	if err = json.Unmarshal(response, &pKeyData); err != nil {
+		log.Warn().Msgf("failed to check if PKey 0x%04X is empty: %v", pKey, err)
+		return
+	}
+	if pKeyData.Partition != u.partitionName(pKey) || len(pKeyData.GUIDs) != 0 {
+		return
+	}
+
+	if _, err = u.delete(ctx, fmt.Sprintf(api.deletePKeyPath, pKey)); err != nil {
+		log.Warn().Msgf("failed to delete empty PKey 0x%04X: %v", pKey, u.wrapRequestError(err))
+		return
+	}
+	log.Info().Msgf("deleted empty PKey 0x%04X of cluster %s", pKey, u.conf.ClusterID)
+}
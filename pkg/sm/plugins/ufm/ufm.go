@@ -1,17 +1,23 @@
-package main
+// Package ufm implements the subnet manager client of NVIDIA UFM.
+package ufm
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/rs/zerolog/log"
 
 	httpDriver "github.com/Mellanox/ib-kubernetes/pkg/drivers/http"
 	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/metrics"
 	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
 )
 
@@ -20,21 +26,103 @@ type ufmPlugin struct {
 	SpecVersion string
 	conf        UFMConfig
 	client      httpDriver.Client
+	// credentials the client was created with when read from files, nil otherwise
+	credentials *ufmCredentials
+	clientMutex sync.Mutex
+	version     *ufmVersion // UFM version detected on Validate, nil if unknown
+	api         *ufmAPI     // REST paths and payloads matching the detected UFM version
+	// apiMutex guards version and api, detected again on Validate while requests are sent
+	apiMutex sync.RWMutex
+	// activeEndpoint is the index of the UFM address requests are sent to first
+	activeEndpoint int
+	endpointMutex  sync.Mutex
+	// pKeyLocks serialize the additions of guids to a pkey with its deletion once empty
+	pKeyLocks      map[int]*sync.Mutex
+	pKeyLocksMutex sync.Mutex
 }
 
 const (
-	pluginName  = "ufm"
-	specVersion = "1.0"
+	pluginName = "ufm"
+	// SpecVersion is the version of the subnet manager client interface the plugin implements
+	SpecVersion = "2.0"
 	httpsProto  = "https"
 )
 
+// ufmVersion is the major.minor release of the UFM server
+type ufmVersion struct {
+	Major int
+	Minor int
+}
+
+// ufmAPI describes the REST paths and payload shape used for a range of UFM releases
+type ufmAPI struct {
+	// minVersion is the first UFM release supporting this API
+	minVersion     ufmVersion
+	addPKeyPath    string
+	removePKeyPath string
+	listPKeysPath  string
+	// getPKeyPath is formatted with the pkey to get a single pkey with its guids
+	getPKeyPath string
+	// deletePKeyPath is formatted with the pkey to delete it
+	deletePKeyPath string
+	// extendedPKeyAttrs adds the "index0" and "ip_over_ib" fields to the add guids payload
+	extendedPKeyAttrs bool
+	// descriptions adds the "description" of the partition and the "guids_description" fields to the add guids
+	// payload
+	descriptions bool
+}
+
+const ufmVersionPath = "/ufmRest/app/ufm_version"
+
+var (
+	// currentUFMAPI is used for UFM 6.x and newer, or when the version could not be detected
+	currentUFMAPI = &ufmAPI{
+		minVersion:        ufmVersion{Major: 6},
+		addPKeyPath:       "/ufmRest/resources/pkeys",
+		removePKeyPath:    "/ufmRest/actions/remove_guids_from_pkey",
+		listPKeysPath:     "/ufmRest/resources/pkeys/?guids_data=true",
+		getPKeyPath:       "/ufmRest/resources/pkeys/0x%04X?guids_data=true",
+		deletePKeyPath:    "/ufmRest/resources/pkeys/0x%04X",
+		extendedPKeyAttrs: true,
+		descriptions:      true,
+	}
+	// legacyUFMAPI is used for UFM releases older than 6.0
+	legacyUFMAPI = &ufmAPI{
+		minVersion:        ufmVersion{Major: 0},
+		addPKeyPath:       "/ufmRest/resources/pkeys",
+		removePKeyPath:    "/ufmRest/actions/remove_guids_from_pkey",
+		listPKeysPath:     "/ufmRest/resources/pkeys?guids_data=true",
+		getPKeyPath:       "/ufmRest/resources/pkeys/0x%04X?guids_data=true",
+		deletePKeyPath:    "/ufmRest/resources/pkeys/0x%04X",
+		extendedPKeyAttrs: false,
+		descriptions:      false,
+	}
+	// ufmAPIs ordered from newest to oldest, the requests and responses of each API are pinned by the fixtures of
+	// testdata/ufm-<major>.<minor>
+	ufmAPIs = []*ufmAPI{currentUFMAPI, legacyUFMAPI}
+)
+
 type UFMConfig struct {
-	Username    string `env:"UFM_USERNAME"`    // Username of ufm
-	Password    string `env:"UFM_PASSWORD"`    // Password of ufm
-	Address     string `env:"UFM_ADDRESS"`     // IP address or hostname of ufm server
-	Port        int    `env:"UFM_PORT"`        // REST API port of ufm
-	HTTPSchema  string `env:"UFM_HTTP_SCHEMA"` // http or https
-	Certificate string `env:"UFM_CERTIFICATE"` // Certificate of ufm
+	Username        string `env:"UFM_USERNAME"`         // Username of ufm
+	Password        string `env:"UFM_PASSWORD"`         // Password of ufm
+	Address         string `env:"UFM_ADDRESS"`          // IP addresses or hostnames of ufm servers, comma separated
+	Port            int    `env:"UFM_PORT"`             // REST API port of ufm
+	HTTPSchema      string `env:"UFM_HTTP_SCHEMA"`      // http or https
+	Certificate     string `env:"UFM_CERTIFICATE"`      // Certificate of ufm
+	UsernameFile    string `env:"UFM_USERNAME_FILE"`    // File containing the username of ufm, e.g a mounted Secret
+	PasswordFile    string `env:"UFM_PASSWORD_FILE"`    // File containing the password of ufm, e.g a mounted Secret
+	CertificateFile string `env:"UFM_CERTIFICATE_FILE"` // File containing the certificate of ufm, e.g a mounted Secret
+	// Unix domain socket of a local tunnel or socket proxy reaching ufm, requests are still sent to the ufm address
+	SocketPath string `env:"UFM_SOCKET_PATH"`
+	// Id of the cluster marking the pkeys it owns, so clusters sharing the fabric don't mutate each other's pkeys
+	ClusterID string `env:"CLUSTER_ID"`
+	// Maximum number of guids added to or removed from a pkey by a single request, 0 sends all the guids at once
+	AddGUIDsChunkSize    int `env:"UFM_ADD_GUIDS_CHUNK_SIZE" envDefault:"1000"`
+	RemoveGUIDsChunkSize int `env:"UFM_REMOVE_GUIDS_CHUNK_SIZE" envDefault:"1000"`
+	// Record the cluster id and the owners of the guids in the description fields of the pkeys and guids
+	GUIDDescriptions bool `env:"UFM_GUID_DESCRIPTIONS" envDefault:"true"`
+	// Delete the pkeys owned by the cluster once their last guid is removed, requires the cluster id
+	DeleteEmptyPKeys bool `env:"UFM_DELETE_EMPTY_PKEYS" envDefault:"false"`
 }
 
 func newUfmPlugin() (*ufmPlugin, error) {
@@ -43,9 +131,21 @@ func newUfmPlugin() (*ufmPlugin, error) {
 		return nil, err
 	}
 
-	if ufmConf.Username == "" || ufmConf.Password == "" || ufmConf.Address == "" {
+	creds, err := ufmConf.loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	if creds.Username == "" || creds.Password == "" || ufmConf.Address == "" {
 		return nil, fmt.Errorf("missing one or more required fileds for ufm [\"username\", \"password\", \"address\"]")
 	}
+	if ufmConf.AddGUIDsChunkSize < 0 || ufmConf.RemoveGUIDsChunkSize < 0 {
+		return nil, fmt.Errorf("invalid guids chunk sizes add %d remove %d, must not be negative",
+			ufmConf.AddGUIDsChunkSize, ufmConf.RemoveGUIDsChunkSize)
+	}
+	if ufmConf.DeleteEmptyPKeys && ufmConf.ClusterID == "" {
+		return nil, fmt.Errorf("deleting empty pkeys requires \"CLUSTER_ID\" to identify the pkeys of the cluster")
+	}
 
 	// set httpSchema and port to ufm default if missing
 	ufmConf.HTTPSchema = strings.ToLower(ufmConf.HTTPSchema)
@@ -60,17 +160,17 @@ func newUfmPlugin() (*ufmPlugin, error) {
 		}
 	}
 
-	isSecure := strings.EqualFold(ufmConf.HTTPSchema, httpsProto)
-	auth := &httpDriver.BasicAuth{Username: ufmConf.Username, Password: ufmConf.Password}
-	client, err := httpDriver.NewClient(isSecure, auth, ufmConf.Certificate)
+	client, err := ufmConf.newHTTPClient(creds)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create http client err: %v", err)
+		return nil, err
 	}
 	return &ufmPlugin{
 		PluginName:  pluginName,
-		SpecVersion: specVersion,
+		SpecVersion: SpecVersion,
 		conf:        ufmConf,
 		client:      client,
+		credentials: creds,
+		api:         currentUFMAPI,
 	}, nil
 }
 
@@ -82,85 +182,202 @@ func (u *ufmPlugin) Spec() string {
 	return u.SpecVersion
 }
 
-func (u *ufmPlugin) Validate() error {
-	_, err := u.client.Get(u.buildURL("/ufmRest/app/ufm_version"), http.StatusOK)
+func (u *ufmPlugin) Validate(ctx context.Context) error {
+	response, err := u.get(ctx, ufmVersionPath)
 	if err != nil {
 		return fmt.Errorf("failed to connect to ufm subnet manager: %v", err)
 	}
 
+	version, err := parseUFMVersionResponse(response)
+	if err != nil {
+		log.Warn().Msgf("failed to detect ufm version, using the latest known API: %v", err)
+		u.setVersion(nil)
+		return nil
+	}
+
+	u.setVersion(version)
+	log.Info().Msgf("detected ufm version %d.%d", version.Major, version.Minor)
 	return nil
 }
 
-func (u *ufmPlugin) AddGuidsToPKey(pKey int, guids []net.HardwareAddr) error {
-	log.Debug().Msgf("adding guids %v to pKey 0x%04X", guids, pKey)
+// setVersion sets the detected UFM version and the API it supports, the latest API if the version is unknown
+func (u *ufmPlugin) setVersion(version *ufmVersion) {
+	api := currentUFMAPI
+	if version != nil {
+		api = selectUFMAPI(version)
+	}
 
-	if !ibUtils.IsPKeyValid(pKey) {
-		return fmt.Errorf("invalid pkey 0x%04X, out of range 0x0001 - 0xFFFE", pKey)
+	u.apiMutex.Lock()
+	defer u.apiMutex.Unlock()
+	u.version = version
+	u.api = api
+}
+
+// parseUFMVersionResponse returns the UFM version from the ufm_version endpoint response.
+// Expected response format is {"ufm_release_version": "6.10.0-3"}
+func parseUFMVersionResponse(response []byte) (*ufmVersion, error) {
+	var versionResponse VersionResponse
+	if err := json.Unmarshal(response, &versionResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse ufm version response %q: %v", string(response), err)
 	}
 
-	guidsString := make([]string, 0, len(guids))
-	for _, guid := range guids {
-		guidAddr := ibUtils.GUIDToString(guid)
-		guidsString = append(guidsString, fmt.Sprintf("%q", guidAddr))
+	return parseUFMVersion(versionResponse.Version)
+}
+
+// parseUFMVersion parses the major and minor parts of UFM release version string, e.g "6.10.0-3"
+func parseUFMVersion(version string) (*ufmVersion, error) {
+	parts := strings.SplitN(strings.TrimSpace(version), ".", 3)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid ufm version %q", version)
 	}
-	data := []byte(fmt.Sprintf(
-		`{"pkey": "0x%04X", "index0": true, "ip_over_ib": true, "membership": "full", "guids": [%v]}`,
-		pKey, strings.Join(guidsString, ",")))
 
-	if _, err := u.client.Post(u.buildURL("/ufmRest/resources/pkeys"), http.StatusOK, data); err != nil {
-		return fmt.Errorf("failed to add guids %v to PKey 0x%04X with error: %v", guids, pKey, err)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ufm major version %q: %v", version, err)
 	}
 
-	return nil
+	minor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ufm minor version %q: %v", version, err)
+	}
+
+	return &ufmVersion{Major: major, Minor: minor}, nil
 }
 
-func (u *ufmPlugin) RemoveGuidsFromPKey(pKey int, guids []net.HardwareAddr) error {
-	log.Debug().Msgf("removing guids %v pkey 0x%04X", guids, pKey)
+// atLeast returns true if the version is equal or newer than the given one
+func (v ufmVersion) atLeast(other ufmVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	return v.Minor >= other.Minor
+}
 
-	if !ibUtils.IsPKeyValid(pKey) {
-		return fmt.Errorf("invalid pkey 0x%04X, out of range 0x0001 - 0xFFFE", pKey)
+// selectUFMAPI returns the newest API supported by the given UFM version
+func selectUFMAPI(version *ufmVersion) *ufmAPI {
+	for _, api := range ufmAPIs {
+		if version.atLeast(api.minVersion) {
+			return api
+		}
 	}
+	return legacyUFMAPI
+}
 
-	guidsString := make([]string, 0, len(guids))
-	for _, guid := range guids {
-		guidAddr := ibUtils.GUIDToString(guid)
-		guidsString = append(guidsString, fmt.Sprintf("%q", guidAddr))
+// getAPI returns the API matching the detected UFM version
+func (u *ufmPlugin) getAPI() *ufmAPI {
+	u.apiMutex.RLock()
+	defer u.apiMutex.RUnlock()
+	if u.api == nil {
+		return currentUFMAPI
 	}
-	data := []byte(fmt.Sprintf(`{"pkey": "0x%04X", "guids": [%v]}`, pKey, strings.Join(guidsString, ",")))
+	return u.api
+}
 
-	if _, err := u.client.Post(u.buildURL("/ufmRest/actions/remove_guids_from_pkey"), http.StatusOK, data); err != nil {
-		return fmt.Errorf("failed to delete guids %v from PKey 0x%04X, with error: %v", guids, pKey, err)
+// wrapRequestError adds the detected UFM version to errors of requests to endpoints the server doesn't know
+func (u *ufmPlugin) wrapRequestError(err error) error {
+	if !httpDriver.IsStatusCode(err, http.StatusNotFound) {
+		return err
 	}
 
-	return nil
+	u.apiMutex.RLock()
+	version := u.version
+	u.apiMutex.RUnlock()
+	if version == nil {
+		return fmt.Errorf("%v, endpoint is not supported by the ufm server of unknown version", err)
+	}
+	return fmt.Errorf("%v, endpoint is not supported by ufm version %d.%d", err, version.Major, version.Minor)
 }
 
-// convertToMacAddr adds semicolons each 2 characters to convert to MAC format
-// UFM returns GUIDS without any delimiters, so expected format is as follows:
-// FF00FF00FF00FF00
-func convertToMacAddr(guid string) string {
-	for i := 2; i < len(guid); i += 3 {
-		guid = guid[:i] + ":" + guid[i:]
-	}
-	return guid
+func (u *ufmPlugin) AddGuidsToPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	log.Debug().Msgf("adding guids %v to pKey 0x%04X", guids, pKey)
+	return u.addGuidsToPKey(ctx, pKey, guids, membershipFull, true, true)
 }
 
-type GUID struct {
-	GUIDValue string `json:"guid"`
+func (u *ufmPlugin) AddGuidsToLimitedPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	log.Debug().Msgf("adding guids %v as limited members to pKey 0x%04X", guids, pKey)
+	return u.addGuidsToPKey(ctx, pKey, guids, membershipLimited, false, false)
 }
 
-type PKey struct {
-	Guids []GUID `json:"guids"`
+// addGuidsToPKey adds the guids to the pkey with the given membership, index0 sets the pkey at index 0
+// of the guids pkey tables and is applied only by ufm versions supporting the extended pkey attributes.
+// exclusive requires the pkey to be owned by this cluster when a cluster id is configured.
+func (u *ufmPlugin) addGuidsToPKey(ctx context.Context, pKey int, guids []net.HardwareAddr, membership string,
+	index0, exclusive bool) error {
+	if err := ibUtils.ValidatePKey(pKey); err != nil {
+		return err
+	}
+
+	if u.conf.DeleteEmptyPKeys {
+		lock := u.pKeyLock(pKey)
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	partitionName, err := u.pKeyOwnership(ctx, pKey, exclusive)
+	if err != nil {
+		return err
+	}
+
+	api := u.getAPI()
+	return requestGUIDChunks(ctx, "add", pKey, guids, u.conf.AddGUIDsChunkSize, func(chunk []net.HardwareAddr) error {
+		pKeyConfig := newPKeyConfig(pKey, chunk, membership, index0, api.extendedPKeyAttrs)
+		pKeyConfig.PartitionName = partitionName
+		u.describePKeyConfig(ctx, pKeyConfig, chunk)
+		data, err := marshalRequest(pKeyConfig)
+		if err != nil {
+			return err
+		}
+
+		if _, err = u.post(ctx, api.addPKeyPath, data); err != nil {
+			return fmt.Errorf("failed to add guids %v to PKey 0x%04X with error: %v", chunk, pKey,
+				u.wrapRequestError(err))
+		}
+		return nil
+	})
+}
+
+func (u *ufmPlugin) RemoveGuidsFromPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	log.Debug().Msgf("removing guids %v pkey 0x%04X", guids, pKey)
+
+	if err := ibUtils.ValidatePKey(pKey); err != nil {
+		return err
+	}
+
+	// guids are also removed from shared pkeys they were added to as limited members
+	if _, err := u.pKeyOwnership(ctx, pKey, false); err != nil {
+		return err
+	}
+
+	removePKeyPath := u.getAPI().removePKeyPath
+	if err := requestGUIDChunks(ctx, "remove", pKey, guids, u.conf.RemoveGUIDsChunkSize,
+		func(chunk []net.HardwareAddr) error {
+			data, err := marshalRequest(newPKeyGUIDs(pKey, chunk))
+			if err != nil {
+				return err
+			}
+
+			if _, err = u.post(ctx, removePKeyPath, data); err != nil {
+				return fmt.Errorf("failed to delete guids %v from PKey 0x%04X, with error: %v", chunk, pKey,
+					u.wrapRequestError(err))
+			}
+			return nil
+		}); err != nil {
+		return err
+	}
+
+	if u.conf.DeleteEmptyPKeys {
+		u.deleteEmptyPKey(ctx, pKey)
+	}
+	return nil
 }
 
 // ListGuidsInUse returns all guids currently in use by pKeys
-func (u *ufmPlugin) ListGuidsInUse() ([]string, error) {
-	response, err := u.client.Get(u.buildURL("/ufmRest/resources/pkeys/?guids_data=true"), http.StatusOK)
+func (u *ufmPlugin) ListGuidsInUse(ctx context.Context) ([]string, error) {
+	response, err := u.get(ctx, u.getAPI().listPKeysPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get the list of guids: %v", err)
+		return nil, fmt.Errorf("failed to get the list of guids: %v", u.wrapRequestError(err))
 	}
 
-	var pKeys map[string]PKey
+	var pKeys map[string]PKeyData
 
 	if err := json.Unmarshal(response, &pKeys); err != nil {
 		return nil, fmt.Errorf("failed to get the list of guids: %v", err)
@@ -170,15 +387,145 @@ func (u *ufmPlugin) ListGuidsInUse() ([]string, error) {
 
 	for pkey := range pKeys {
 		pkeyData := pKeys[pkey]
-		for _, guidData := range pkeyData.Guids {
-			guids = append(guids, convertToMacAddr(guidData.GUIDValue))
+		// UFM returns upper case guids without delimiters, e.g. "FF00FF00FF00FF00", they are reported in their
+		// canonical form, invalid guids are reported as is and skipped by the daemon
+		for _, guidData := range pkeyData.GUIDs {
+			guid, err := ibUtils.NormalizeGUID(guidData.GUID)
+			if err != nil {
+				guid = guidData.GUID
+			}
+			guids = append(guids, guid)
+		}
+	}
+	return guids, nil
+}
+
+// GetPKeyMembers returns the guids which are members of the given pKey
+func (u *ufmPlugin) GetPKeyMembers(ctx context.Context, pKey int) ([]net.HardwareAddr, error) {
+	if err := ibUtils.ValidatePKey(pKey); err != nil {
+		return nil, err
+	}
+
+	response, err := u.get(ctx, fmt.Sprintf(u.getAPI().getPKeyPath, pKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of PKey 0x%04X: %v", pKey, u.wrapRequestError(err))
+	}
+
+	var pKeyData PKeyData
+	if err := json.Unmarshal(response, &pKeyData); err != nil {
+		return nil, fmt.Errorf("failed to get members of PKey 0x%04X: %v", pKey, err)
+	}
+
+	guids := make([]net.HardwareAddr, 0, len(pKeyData.GUIDs))
+	for _, guidData := range pKeyData.GUIDs {
+		normalized, err := ibUtils.NormalizeGUID(guidData.GUID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse guid %s of PKey 0x%04X: %v", guidData.GUID, pKey, err)
 		}
+		guid, err := net.ParseMAC(normalized)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse guid %s of PKey 0x%04X: %v", guidData.GUID, pKey, err)
+		}
+		guids = append(guids, guid)
 	}
 	return guids, nil
 }
 
-func (u *ufmPlugin) buildURL(path string) string {
-	return fmt.Sprintf("%s://%s:%d%s", u.conf.HTTPSchema, u.conf.Address, u.conf.Port, path)
+func (u *ufmPlugin) buildURL(address, path string) string {
+	return fmt.Sprintf("%s://%s:%d%s", u.conf.HTTPSchema, address, u.conf.Port, path)
+}
+
+// isEndpointFailure returns true if the request failed because the UFM endpoint is unreachable or unhealthy,
+// i.e. connection errors and server errors, as opposed to errors of a reachable server rejecting the request
+func isEndpointFailure(err error) bool {
+	var statusErr *httpDriver.StatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	return statusErr.Code >= http.StatusInternalServerError
+}
+
+// addresses returns the configured UFM addresses, primary first
+func (u *ufmPlugin) addresses() []string {
+	var addresses []string
+	for _, address := range strings.Split(u.conf.Address, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	if len(addresses) == 0 {
+		return []string{u.conf.Address}
+	}
+	return addresses
+}
+
+func (u *ufmPlugin) get(ctx context.Context, path string) ([]byte, error) {
+	return u.doWithFailover(ctx, func(address string) ([]byte, error) {
+		return u.getClient().Get(ctx, u.buildURL(address, path), http.StatusOK)
+	})
+}
+
+func (u *ufmPlugin) post(ctx context.Context, path string, data []byte) ([]byte, error) {
+	return u.doWithFailover(ctx, func(address string) ([]byte, error) {
+		return u.getClient().Post(ctx, u.buildURL(address, path), http.StatusOK, data)
+	})
+}
+
+func (u *ufmPlugin) delete(ctx context.Context, path string) ([]byte, error) {
+	return u.doWithFailover(ctx, func(address string) ([]byte, error) {
+		return u.getClient().Delete(ctx, u.buildURL(address, path), http.StatusOK)
+	})
+}
+
+// doWithFailover sends the request to the active UFM endpoint, on endpoint failure the other endpoints are
+// tried in order and the first healthy one becomes the active endpoint. The other endpoints aren't tried once
+// the context is done, as the request was canceled rather than the endpoint failed.
+func (u *ufmPlugin) doWithFailover(ctx context.Context, request func(address string) ([]byte, error)) ([]byte,
+	error) {
+	u.reloadCredentials()
+	addresses := u.addresses()
+
+	u.endpointMutex.Lock()
+	active := u.activeEndpoint % len(addresses)
+	u.endpointMutex.Unlock()
+
+	var err error
+	var response []byte
+	for i := range addresses {
+		index := (active + i) % len(addresses)
+		response, err = request(addresses[index])
+		if ctx.Err() != nil {
+			return response, err
+		}
+		if err == nil || !isEndpointFailure(err) {
+			u.setActiveEndpoint(index, addresses)
+			return response, err
+		}
+
+		if len(addresses) > 1 {
+			log.Warn().Msgf("ufm endpoint %s failed: %v", addresses[index], err)
+		}
+	}
+	return response, err
+}
+
+// setActiveEndpoint sets the endpoint at index as the active one and updates the active endpoint metric
+func (u *ufmPlugin) setActiveEndpoint(index int, addresses []string) {
+	u.endpointMutex.Lock()
+	defer u.endpointMutex.Unlock()
+
+	if index != u.activeEndpoint%len(addresses) {
+		log.Info().Msgf("ufm failover, active endpoint changed to %s", addresses[index])
+	}
+	u.activeEndpoint = index
+
+	for i, address := range addresses {
+		value := 0.0
+		if i == index {
+			value = 1
+		}
+		metrics.SMActiveEndpoint.WithLabelValues(pluginName, address).Set(value)
+	}
 }
 
 // Initialize applies configs to plugin and return a subnet manager client
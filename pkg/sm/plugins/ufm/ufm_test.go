@@ -1,16 +1,26 @@
-package main
+package ufm
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/mock"
 
+	httpDriver "github.com/Mellanox/ib-kubernetes/pkg/drivers/http"
 	"github.com/Mellanox/ib-kubernetes/pkg/drivers/http/mocks"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
 )
 
 var _ = Describe("Ufm Subnet Manager Client plugin", func() {
@@ -28,7 +38,7 @@ var _ = Describe("Ufm Subnet Manager Client plugin", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(plugin).ToNot(BeNil())
 			Expect(plugin.Name()).To(Equal("ufm"))
-			Expect(plugin.Spec()).To(Equal("1.0"))
+			Expect(plugin.Spec()).To(Equal("2.0"))
 		})
 	})
 	Context("newUfmPlugin", func() {
@@ -44,9 +54,55 @@ var _ = Describe("Ufm Subnet Manager Client plugin", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(plugin).ToNot(BeNil())
 			Expect(plugin.Name()).To(Equal("ufm"))
-			Expect(plugin.Spec()).To(Equal("1.0"))
+			Expect(plugin.Spec()).To(Equal("2.0"))
 			Expect(plugin.conf.Port).To(Equal(80))
 		})
+		It("newUfmPlugin with credentials files", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "username"), []byte("admin\n"), 0o600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "password"), []byte("123456\n"), 0o600)).To(Succeed())
+			Expect(os.Setenv("UFM_USERNAME_FILE", filepath.Join(dir, "username"))).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_PASSWORD_FILE", filepath.Join(dir, "password"))).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_ADDRESS", "1.1.1.1")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_HTTP_SCHEMA", "http")).ToNot(HaveOccurred())
+			plugin, err := newUfmPlugin()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.credentials).To(Equal(&ufmCredentials{Username: "admin", Password: "123456"}))
+		})
+		It("newUfmPlugin with missing credentials file", func() {
+			Expect(os.Setenv("UFM_USERNAME", "admin")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_PASSWORD_FILE", "/nonexistent/password")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_ADDRESS", "1.1.1.1")).ToNot(HaveOccurred())
+			plugin, err := newUfmPlugin()
+			Expect(err).To(HaveOccurred())
+			Expect(plugin).To(BeNil())
+		})
+		It("newUfmPlugin reaching ufm through unix socket", func() {
+			dir, err := os.MkdirTemp("", "ufm")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			socketPath := filepath.Join(dir, "ufm.sock")
+			listener, err := net.Listen("unix", socketPath)
+			Expect(err).ToNot(HaveOccurred())
+			requests := make(chan string, 1)
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests <- r.Host + r.URL.Path
+				_, _ = w.Write([]byte(`{"ufm_release_version": "6.10.0-3"}`))
+			})}
+			//nolint:errcheck
+			go server.Serve(listener)
+			defer server.Close()
+
+			Expect(os.Setenv("UFM_USERNAME", "admin")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_PASSWORD", "123456")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_ADDRESS", "ufm.example.com")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_HTTP_SCHEMA", "http")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_SOCKET_PATH", socketPath)).ToNot(HaveOccurred())
+			plugin, err := newUfmPlugin()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.Validate(context.Background())).To(Succeed())
+			Expect(<-requests).To(Equal("ufm.example.com:80/ufmRest/app/ufm_version"))
+		})
 		It("newUfmPlugin with missing address config", func() {
 			Expect(os.Setenv("UFM_USERNAME", "admin")).ToNot(HaveOccurred())
 			Expect(os.Setenv("UFM_PASSWORD", "123456")).ToNot(HaveOccurred())
@@ -56,36 +112,193 @@ var _ = Describe("Ufm Subnet Manager Client plugin", func() {
 			Expect(err.Error()).To(Equal(`missing one or more required fileds for ufm ["username", "password", "address"]`))
 			Expect(plugin).To(BeNil())
 		})
+		It("newUfmPlugin deleting empty pkeys without cluster id", func() {
+			Expect(os.Setenv("UFM_USERNAME", "admin")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_PASSWORD", "123456")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_ADDRESS", "1.1.1.1")).ToNot(HaveOccurred())
+			Expect(os.Setenv("UFM_DELETE_EMPTY_PKEYS", "true")).ToNot(HaveOccurred())
+			plugin, err := newUfmPlugin()
+			Expect(err).To(MatchError(ContainSubstring("CLUSTER_ID")))
+			Expect(plugin).To(BeNil())
+
+			Expect(os.Setenv("CLUSTER_ID", "cluster-a")).ToNot(HaveOccurred())
+			plugin, err = newUfmPlugin()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.conf.DeleteEmptyPKeys).To(BeTrue())
+		})
+	})
+	Context("Credentials reload", func() {
+		It("Recreate client when credentials files change", func() {
+			dir := GinkgoT().TempDir()
+			passwordFile := filepath.Join(dir, "password")
+			Expect(os.WriteFile(passwordFile, []byte("old"), 0o600)).To(Succeed())
+
+			conf := UFMConfig{Username: "admin", PasswordFile: passwordFile, HTTPSchema: "http"}
+			creds, err := conf.loadCredentials()
+			Expect(err).ToNot(HaveOccurred())
+			client := &mocks.Client{}
+			plugin := &ufmPlugin{client: client, conf: conf, credentials: creds}
+
+			plugin.reloadCredentials()
+			Expect(plugin.getClient()).To(BeIdenticalTo(client))
+
+			Expect(os.WriteFile(passwordFile, []byte("new"), 0o600)).To(Succeed())
+			plugin.reloadCredentials()
+			Expect(plugin.getClient()).ToNot(BeIdenticalTo(client))
+			Expect(plugin.credentials.Password).To(Equal("new"))
+		})
+		It("Keep current client when credentials files can't be read", func() {
+			client := &mocks.Client{}
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{PasswordFile: "/nonexistent/password"}}
+			plugin.reloadCredentials()
+			Expect(plugin.getClient()).To(BeIdenticalTo(client))
+		})
 	})
 	Context("Validate", func() {
 		It("Validate connection to ufm", func() {
 			client := &mocks.Client{}
-			client.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+			client.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
 
 			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
-			err := plugin.Validate()
+			err := plugin.Validate(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 		})
 		It("Validate connection to ufm failed to connect", func() {
 			client := &mocks.Client{}
-			client.On("Get", mock.Anything, mock.Anything).Return(nil, errors.New("failed"))
+			client.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("failed"))
 
 			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
-			err := plugin.Validate()
+			err := plugin.Validate(context.Background())
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("failed to connect to ufm subnet manager: failed"))
 		})
+		It("Validate detects ufm version", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(
+				[]byte(`{"ufm_release_version": "6.10.0-3"}`), nil)
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
+			err := plugin.Validate(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.version).To(Equal(&ufmVersion{Major: 6, Minor: 10}))
+			Expect(plugin.api).To(Equal(currentUFMAPI))
+		})
+		It("Validate detects legacy ufm version", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(
+				[]byte(`{"ufm_release_version": "5.9.5"}`), nil)
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
+			err := plugin.Validate(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.version).To(Equal(&ufmVersion{Major: 5, Minor: 9}))
+			Expect(plugin.api).To(Equal(legacyUFMAPI))
+		})
+		It("Validate with unknown ufm version falls back to latest api", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, mock.Anything, mock.Anything).Return([]byte(`{"ufm_release_version": "dev"}`), nil)
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
+			err := plugin.Validate(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.version).To(BeNil())
+			Expect(plugin.api).To(Equal(currentUFMAPI))
+		})
+	})
+	Context("UFM API versions", func() {
+		const ufmURL = "https://ufm:443"
+
+		readFixture := func(release, name string) []byte {
+			data, err := os.ReadFile(filepath.Join("testdata", release, name))
+			Expect(err).ToNot(HaveOccurred())
+			return data
+		}
+		compactJSON := func(data []byte) []byte {
+			var buffer bytes.Buffer
+			Expect(json.Compact(&buffer, data)).To(Succeed())
+			return buffer.Bytes()
+		}
+
+		DescribeTable("Send the requests of the detected ufm version",
+			func(release, listPKeysPath string) {
+				client := &mocks.Client{}
+				client.On("Get", mock.Anything, ufmURL+ufmVersionPath, http.StatusOK).
+					Return(readFixture(release, "ufm_version.json"), nil)
+				client.On("Post", mock.Anything, ufmURL+"/ufmRest/resources/pkeys", http.StatusOK,
+					compactJSON(readFixture(release, "add_guids_request.json"))).Return(nil, nil).Once()
+				client.On("Get", mock.Anything, ufmURL+listPKeysPath, http.StatusOK).
+					Return(readFixture(release, "pkeys_response.json"), nil)
+
+				plugin := &ufmPlugin{client: client, conf: UFMConfig{Address: "ufm", HTTPSchema: "https", Port: 443}}
+				Expect(plugin.Validate(context.Background())).To(Succeed())
+				guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(plugin.AddGuidsToPKey(context.Background(), 0x1234, []net.HardwareAddr{guid})).To(Succeed())
+
+				guids, err := plugin.ListGuidsInUse(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(guids).To(Equal([]string{"11:22:33:44:55:66:77:88"}))
+				client.AssertExpectations(GinkgoT())
+			},
+			Entry("UFM 6.x", "ufm-6.10", "/ufmRest/resources/pkeys/?guids_data=true"),
+			Entry("legacy UFM 5.x", "ufm-5.9", "/ufmRest/resources/pkeys?guids_data=true"),
+		)
+		It("Detect the ufm version while requests are sent", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, ufmURL+ufmVersionPath, http.StatusOK).
+				Return(readFixture("ufm-5.9", "ufm_version.json"), nil)
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{Address: "ufm", HTTPSchema: "https", Port: 443}}
+			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+			Expect(err).ToNot(HaveOccurred())
+			var wg sync.WaitGroup
+			for range 4 {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					Expect(plugin.Validate(context.Background())).To(Succeed())
+				}()
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					Expect(plugin.AddGuidsToPKey(context.Background(), 0x1234, []net.HardwareAddr{guid})).To(Succeed())
+				}()
+			}
+			wg.Wait()
+			Expect(plugin.getAPI()).To(Equal(legacyUFMAPI))
+		})
+	})
+	Context("parseUFMVersion", func() {
+		It("Parse valid versions", func() {
+			version, err := parseUFMVersion("6.10.0-3")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*version).To(Equal(ufmVersion{Major: 6, Minor: 10}))
+
+			version, err = parseUFMVersion("5.9-1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*version).To(Equal(ufmVersion{Major: 5, Minor: 9}))
+		})
+		It("Parse invalid versions", func() {
+			_, err := parseUFMVersion("")
+			Expect(err).To(HaveOccurred())
+			_, err = parseUFMVersion("6")
+			Expect(err).To(HaveOccurred())
+			_, err = parseUFMVersion("a.b.c")
+			Expect(err).To(HaveOccurred())
+		})
 	})
 	Context("AddGuidsToPKey", func() {
 		It("Add guid to valid pkey", func() {
 			client := &mocks.Client{}
-			client.On("Post", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
 
 			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
 			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
 			Expect(err).ToNot(HaveOccurred())
 
-			err = plugin.AddGuidsToPKey(0x1234, []net.HardwareAddr{guid})
+			err = plugin.AddGuidsToPKey(context.Background(), 0x1234, []net.HardwareAddr{guid})
 			Expect(err).ToNot(HaveOccurred())
 		})
 		It("Add guid to invalid pkey", func() {
@@ -93,13 +306,13 @@ var _ = Describe("Ufm Subnet Manager Client plugin", func() {
 			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
 			Expect(err).ToNot(HaveOccurred())
 
-			err = plugin.AddGuidsToPKey(0xFFFF, []net.HardwareAddr{guid})
+			err = plugin.AddGuidsToPKey(context.Background(), 0xFFFF, []net.HardwareAddr{guid})
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(Equal("invalid pkey 0xFFFF, out of range 0x0001 - 0xFFFE"))
+			Expect(err.Error()).To(Equal("invalid pkey 0xFFFF, out of range 0x0000 - 0x7FFF"))
 		})
 		It("Add guid to pkey failed from ufm", func() {
 			client := &mocks.Client{}
-			client.On("Post", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("failed"))
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("failed"))
 
 			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
 			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
@@ -107,22 +320,76 @@ var _ = Describe("Ufm Subnet Manager Client plugin", func() {
 
 			guids := []net.HardwareAddr{guid}
 			pKey := 0x1234
-			err = plugin.AddGuidsToPKey(pKey, guids)
+			err = plugin.AddGuidsToPKey(context.Background(), pKey, guids)
 			Expect(err).To(HaveOccurred())
 			errMessage := fmt.Sprintf("failed to add guids %v to PKey 0x%04X with error: failed", guids, pKey)
 			Expect(err.Error()).To(Equal(errMessage))
 		})
+		It("Add guid to pkey with legacy ufm", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything,
+				[]byte(`{"pkey":"0x1234","membership":"full","guids":["1122334455667788"]}`)).Return(nil, nil)
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}, api: legacyUFMAPI}
+			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = plugin.AddGuidsToPKey(context.Background(), 0x1234, []net.HardwareAddr{guid})
+			Expect(err).ToNot(HaveOccurred())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Add guid to pkey with endpoint not supported by ufm version", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil,
+				&httpDriver.StatusError{Code: 404, ExpectedCode: 200, Body: "not found"})
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}, version: &ufmVersion{Major: 5, Minor: 1}}
+			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = plugin.AddGuidsToPKey(context.Background(), 0x1234, []net.HardwareAddr{guid})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("endpoint is not supported by ufm version 5.1"))
+		})
+	})
+	Context("AddGuidsToLimitedPKey", func() {
+		It("Add guid as limited member of pkey", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, []byte(`{"pkey":"0x7FFF","index0":false,`+
+				`"ip_over_ib":true,"membership":"limited","guids":["1122334455667788"]}`)).Return(nil, nil)
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
+			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = plugin.AddGuidsToLimitedPKey(context.Background(), 0x7FFF, []net.HardwareAddr{guid})
+			Expect(err).ToNot(HaveOccurred())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Add guid as limited member of pkey with legacy ufm", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything,
+				[]byte(`{"pkey":"0x7FFF","membership":"limited","guids":["1122334455667788"]}`)).Return(nil, nil)
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}, api: legacyUFMAPI}
+			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = plugin.AddGuidsToLimitedPKey(context.Background(), 0x7FFF, []net.HardwareAddr{guid})
+			Expect(err).ToNot(HaveOccurred())
+			client.AssertExpectations(GinkgoT())
+		})
 	})
 	Context("RemoveGuidsFromPKey", func() {
 		It("Remove guid from valid pkey", func() {
 			client := &mocks.Client{}
-			client.On("Post", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
 
 			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
 			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
 			Expect(err).ToNot(HaveOccurred())
 
-			err = plugin.RemoveGuidsFromPKey(0x1234, []net.HardwareAddr{guid})
+			err = plugin.RemoveGuidsFromPKey(context.Background(), 0x1234, []net.HardwareAddr{guid})
 			Expect(err).ToNot(HaveOccurred())
 		})
 		It("Remove guid from invalid pkey", func() {
@@ -130,13 +397,13 @@ var _ = Describe("Ufm Subnet Manager Client plugin", func() {
 			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
 			Expect(err).ToNot(HaveOccurred())
 
-			err = plugin.RemoveGuidsFromPKey(0xFFFF, []net.HardwareAddr{guid})
+			err = plugin.RemoveGuidsFromPKey(context.Background(), 0xFFFF, []net.HardwareAddr{guid})
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(Equal("invalid pkey 0xFFFF, out of range 0x0001 - 0xFFFE"))
+			Expect(err.Error()).To(Equal("invalid pkey 0xFFFF, out of range 0x0000 - 0x7FFF"))
 		})
 		It("Remove guid from pkey failed from ufm", func() {
 			client := &mocks.Client{}
-			client.On("Post", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("failed"))
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("failed"))
 
 			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
 			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
@@ -144,7 +411,7 @@ var _ = Describe("Ufm Subnet Manager Client plugin", func() {
 
 			guids := []net.HardwareAddr{guid}
 			pKey := 0x1234
-			err = plugin.RemoveGuidsFromPKey(pKey, guids)
+			err = plugin.RemoveGuidsFromPKey(context.Background(), pKey, guids)
 			Expect(err).To(HaveOccurred())
 			errMessage := fmt.Sprintf("failed to delete guids %v from PKey 0x%04X, with error: failed",
 				guids, pKey)
@@ -181,14 +448,385 @@ var _ = Describe("Ufm Subnet Manager Client plugin", func() {
 			}`
 
 			client := &mocks.Client{}
-			client.On("Get", mock.Anything, mock.Anything).Return([]byte(testResponse), nil)
+			client.On("Get", mock.Anything, mock.Anything, mock.Anything).Return([]byte(testResponse), nil)
 
 			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
-			guids, err := plugin.ListGuidsInUse()
+			guids, err := plugin.ListGuidsInUse(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 
-			expectedGuids := []string{"02:00:00:00:00:00:00:3e", "02:00:0F:F0:00:FF:00:09", "02:00:00:00:00:00:00:00"}
+			expectedGuids := []string{"02:00:00:00:00:00:00:3e", "02:00:0f:f0:00:ff:00:09", "02:00:00:00:00:00:00:00"}
 			Expect(guids).To(ConsistOf(expectedGuids))
 		})
 	})
+	Context("GetPKeyMembers", func() {
+		It("Get members of valid pkey", func() {
+			testResponse := `{
+				"partition": "api_pkey_0x5",
+				"guids": [
+					{
+						"guid": "020000000000003e",
+						"membership": "full"
+					},
+					{
+						"guid": "02000FF000FF0009",
+						"membership": "full"
+					}
+				]
+			}`
+
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, "http://:0/ufmRest/resources/pkeys/0x0005?guids_data=true", http.StatusOK).Return(
+				[]byte(testResponse), nil)
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{HTTPSchema: "http"}}
+			guids, err := plugin.GetPKeyMembers(context.Background(), 0x5)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(guids).To(HaveLen(2))
+			Expect(guids[0].String()).To(Equal("02:00:00:00:00:00:00:3e"))
+			Expect(guids[1].String()).To(Equal("02:00:0f:f0:00:ff:00:09"))
+		})
+		It("Get members of invalid pkey", func() {
+			plugin := &ufmPlugin{conf: UFMConfig{}}
+			_, err := plugin.GetPKeyMembers(context.Background(), 0xFFFF)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("invalid pkey 0xFFFF, out of range 0x0000 - 0x7FFF"))
+		})
+		It("Get members of pkey failed from ufm", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("failed"))
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
+			_, err := plugin.GetPKeyMembers(context.Background(), 0x5)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("failed to get members of PKey 0x0005: failed"))
+		})
+	})
+	Context("PKey ownership", func() {
+		const pKeyURL = "https://ufm:443/ufmRest/resources/pkeys/0x0005?guids_data=true"
+		var guids []net.HardwareAddr
+
+		newPlugin := func(client *mocks.Client) *ufmPlugin {
+			return &ufmPlugin{client: client,
+				conf: UFMConfig{Address: "ufm", HTTPSchema: "https", Port: 443, ClusterID: "cluster-a"}}
+		}
+
+		BeforeEach(func() {
+			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+			Expect(err).ToNot(HaveOccurred())
+			guids = []net.HardwareAddr{guid}
+		})
+
+		It("Create missing pkey with the cluster marker", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return(nil,
+				&httpDriver.StatusError{Code: 404, ExpectedCode: 200, Body: "not found"})
+			client.On("Post", mock.Anything, "https://ufm:443/ufmRest/resources/pkeys", http.StatusOK, mock.MatchedBy(
+				func(data []byte) bool {
+					return strings.Contains(string(data), `"partition_name":"k8s-cluster-a-0x0005"`)
+				})).Return(nil, nil)
+
+			Expect(newPlugin(client).AddGuidsToPKey(context.Background(), 0x5, guids)).To(Succeed())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Add guids to pkey owned by the cluster", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(`{"partition": "k8s-cluster-a-0x0005"}`), nil)
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, mock.MatchedBy(func(data []byte) bool {
+				return !strings.Contains(string(data), "partition_name")
+			})).Return(nil, nil)
+
+			plugin := newPlugin(client)
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0x5, guids)).To(Succeed())
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)).To(Succeed())
+			client.AssertNumberOfCalls(GinkgoT(), "Post", 2)
+		})
+		It("Refuse pkey owned by another cluster", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(`{"partition": "k8s-cluster-b-0x0005"}`), nil)
+
+			plugin := newPlugin(client)
+			err := plugin.AddGuidsToPKey(context.Background(), 0x5, guids)
+			Expect(err).To(MatchError(`PKey 0x0005 is owned by another cluster, partition "k8s-cluster-b-0x0005"`))
+			Expect(plugin.AddGuidsToLimitedPKey(context.Background(), 0x5, guids)).ToNot(Succeed())
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)).ToNot(Succeed())
+			client.AssertNotCalled(GinkgoT(), "Post", mock.Anything, mock.Anything, mock.Anything)
+		})
+		It("Use unmarked shared pkey for limited membership only", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(`{"partition": "management"}`), nil)
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, mock.Anything).Return(nil, nil)
+
+			plugin := newPlugin(client)
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0x5, guids)).To(MatchError(
+				`PKey 0x0005 is not owned by cluster cluster-a, partition "management"`))
+			Expect(plugin.AddGuidsToLimitedPKey(context.Background(), 0x5, guids)).To(Succeed())
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)).To(Succeed())
+			client.AssertNumberOfCalls(GinkgoT(), "Post", 2)
+		})
+		It("Delete the pkey owned by the cluster once its last guid is removed", func() {
+			const deleteURL = "https://ufm:443/ufmRest/resources/pkeys/0x0005"
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(
+				`{"partition": "k8s-cluster-a-0x0005", "guids": [{"guid": "1122334455667788"}]}`), nil).Once()
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(
+				`{"partition": "k8s-cluster-a-0x0005", "guids": []}`), nil).Once()
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, mock.Anything).Return(nil, nil)
+			client.On("Delete", mock.Anything, deleteURL, http.StatusOK).Return(nil, nil).Once()
+
+			plugin := newPlugin(client)
+			plugin.conf.DeleteEmptyPKeys = true
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)).To(Succeed())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Keep pkeys with guids, not owned by the cluster or when deletion is disabled", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, mock.Anything).Return(nil, nil)
+			plugin := newPlugin(client)
+			plugin.conf.DeleteEmptyPKeys = true
+
+			for _, response := range []string{
+				`{"partition": "k8s-cluster-a-0x0005", "guids": [{"guid": "1122334455667799"}]}`,
+				`{"partition": "management", "guids": []}`,
+			} {
+				client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(response), nil).Times(2)
+				Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)).To(Succeed())
+			}
+
+			plugin.conf.DeleteEmptyPKeys = false
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(
+				`{"partition": "k8s-cluster-a-0x0005", "guids": []}`), nil).Once()
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)).To(Succeed())
+
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x7FFF, guids)).To(Succeed())
+			client.AssertNotCalled(GinkgoT(), "Delete", mock.Anything, mock.Anything, mock.Anything)
+		})
+		It("Wait for the empty pkey deletion before adding guids to it", func() {
+			const deleteURL = "https://ufm:443/ufmRest/resources/pkeys/0x0005"
+			deleting := make(chan struct{})
+			deleted := make(chan struct{})
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(
+				`{"partition": "k8s-cluster-a-0x0005", "guids": []}`), nil)
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, mock.Anything).Return(nil, nil)
+			client.On("Delete", mock.Anything, deleteURL, http.StatusOK).Run(func(mock.Arguments) {
+				close(deleting)
+				<-deleted
+			}).Return(nil, nil).Once()
+
+			plugin := newPlugin(client)
+			plugin.conf.DeleteEmptyPKeys = true
+			removed := make(chan error)
+			go func() {
+				removed <- plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)
+			}()
+			Eventually(deleting).Should(BeClosed())
+
+			added := make(chan error)
+			go func() {
+				added <- plugin.AddGuidsToPKey(context.Background(), 0x5, guids)
+			}()
+			Consistently(added, "100ms").ShouldNot(Receive())
+			close(deleted)
+			Eventually(removed).Should(Receive(BeNil()))
+			Eventually(added).Should(Receive(BeNil()))
+			client.AssertNumberOfCalls(GinkgoT(), "Post", 2)
+		})
+		It("Succeed removing guids when the empty pkey deletion fails", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, pKeyURL, http.StatusOK).Return([]byte(
+				`{"partition": "k8s-cluster-a-0x0005", "guids": []}`), nil)
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, mock.Anything).Return(nil, nil)
+			client.On("Delete", mock.Anything, mock.Anything, http.StatusOK).Return(nil,
+				&httpDriver.StatusError{Code: 400, ExpectedCode: 200, Body: "in use"})
+
+			plugin := newPlugin(client)
+			plugin.conf.DeleteEmptyPKeys = true
+			Expect(plugin.RemoveGuidsFromPKey(context.Background(), 0x5, guids)).To(Succeed())
+			client.AssertNumberOfCalls(GinkgoT(), "Delete", 1)
+		})
+		It("Use the default partition without checking its owner", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, mock.MatchedBy(func(data []byte) bool {
+				return !strings.Contains(string(data), "partition_name")
+			})).Return(nil, nil)
+
+			Expect(newPlugin(client).AddGuidsToPKey(context.Background(), 0x7FFF, guids)).To(Succeed())
+			client.AssertNotCalled(GinkgoT(), "Get", mock.Anything, mock.Anything)
+		})
+	})
+	Context("Endpoints failover", func() {
+		const versionResponse = `{"ufm_release_version": "6.10.0-1"}`
+
+		It("Use addresses list of UFM_ADDRESS", func() {
+			plugin := &ufmPlugin{conf: UFMConfig{Address: " primary, standby ,"}}
+			Expect(plugin.addresses()).To(Equal([]string{"primary", "standby"}))
+		})
+		It("Failover to standby endpoint and stick to it", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, "https://primary:443"+ufmVersionPath, http.StatusOK).Return(
+				nil, errors.New("faied request dial tcp: connection refused"))
+			client.On("Get", mock.Anything, "https://standby:443"+ufmVersionPath, http.StatusOK).Return(
+				[]byte(versionResponse), nil)
+			client.On("Post", mock.Anything, "https://standby:443/ufmRest/resources/pkeys", http.StatusOK, mock.Anything).Return(
+				nil, nil)
+
+			plugin := &ufmPlugin{client: client,
+				conf: UFMConfig{Address: "primary,standby", HTTPSchema: "https", Port: 443}}
+			Expect(plugin.Validate(context.Background())).To(Succeed())
+			Expect(plugin.activeEndpoint).To(Equal(1))
+
+			guid, err := net.ParseMAC("11:22:33:44:55:66:77:88")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0x1234, []net.HardwareAddr{guid})).To(Succeed())
+			client.AssertNumberOfCalls(GinkgoT(), "Post", 1)
+		})
+		It("Failover on server errors", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, "https://primary:443"+ufmVersionPath, http.StatusOK).Return(nil,
+				&httpDriver.StatusError{Code: 503, ExpectedCode: 200, Body: "unavailable"})
+			client.On("Get", mock.Anything, "https://standby:443"+ufmVersionPath, http.StatusOK).Return(
+				[]byte(versionResponse), nil)
+
+			plugin := &ufmPlugin{client: client,
+				conf: UFMConfig{Address: "primary,standby", HTTPSchema: "https", Port: 443}}
+			Expect(plugin.Validate(context.Background())).To(Succeed())
+			Expect(plugin.activeEndpoint).To(Equal(1))
+		})
+		It("Don't failover on request errors of a reachable endpoint", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, mock.Anything, http.StatusOK).Return(nil,
+				&httpDriver.StatusError{Code: 400, ExpectedCode: 200, Body: "bad request"})
+
+			plugin := &ufmPlugin{client: client,
+				conf: UFMConfig{Address: "primary,standby", HTTPSchema: "https", Port: 443}}
+			_, err := plugin.ListGuidsInUse(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(plugin.activeEndpoint).To(Equal(0))
+			client.AssertNumberOfCalls(GinkgoT(), "Get", 1)
+		})
+		It("Fail when all endpoints fail", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, mock.Anything, http.StatusOK).Return(nil, errors.New("faied request timeout"))
+
+			plugin := &ufmPlugin{client: client,
+				conf: UFMConfig{Address: "primary,standby", HTTPSchema: "https", Port: 443}}
+			Expect(plugin.Validate(context.Background())).ToNot(Succeed())
+			client.AssertNumberOfCalls(GinkgoT(), "Get", 2)
+		})
+	})
+	Context("GUIDs chunks", func() {
+		var guids []net.HardwareAddr
+
+		BeforeEach(func() {
+			guids = nil
+			for _, guidStr := range []string{"02:00:00:00:00:00:00:01", "02:00:00:00:00:00:00:02",
+				"02:00:00:00:00:00:00:03", "02:00:00:00:00:00:00:04", "02:00:00:00:00:00:00:05"} {
+				guid, err := net.ParseMAC(guidStr)
+				Expect(err).ToNot(HaveOccurred())
+				guids = append(guids, guid)
+			}
+		})
+
+		It("Split guids into chunks", func() {
+			Expect(chunkGUIDs(guids, 2)).To(Equal([][]net.HardwareAddr{guids[:2], guids[2:4], guids[4:]}))
+			Expect(chunkGUIDs(guids, 5)).To(Equal([][]net.HardwareAddr{guids}))
+			Expect(chunkGUIDs(guids, 0)).To(Equal([][]net.HardwareAddr{guids}))
+		})
+		It("Add guids to pkey in chunks", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, []byte(`{"pkey":"0x1234",`+
+				`"membership":"full","guids":["0200000000000001","0200000000000002"]}`)).Return(nil, nil).Once()
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, []byte(`{"pkey":"0x1234",`+
+				`"membership":"full","guids":["0200000000000003","0200000000000004"]}`)).Return(nil, nil).Once()
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, []byte(`{"pkey":"0x1234",`+
+				`"membership":"full","guids":["0200000000000005"]}`)).Return(nil, nil).Once()
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{AddGUIDsChunkSize: 2}, api: legacyUFMAPI}
+			Expect(plugin.AddGuidsToPKey(context.Background(), 0x1234, guids)).To(Succeed())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Aggregate the failed chunks of guids removed from pkey", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, []byte(`{"pkey":"0x1234",`+
+				`"guids":["0200000000000003","0200000000000004"]}`)).Return(nil, errors.New("request too large")).Once()
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Twice()
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{RemoveGUIDsChunkSize: 2}}
+			err := plugin.RemoveGuidsFromPKey(context.Background(), 0x1234, guids)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("failed to remove 2 of 5 guids of PKey 0x1234: "))
+
+			var chunksErr *GUIDChunksError
+			Expect(errors.As(err, &chunksErr)).To(BeTrue())
+			Expect(chunksErr.Failed).To(Equal(guids[2:4]))
+			client.AssertNumberOfCalls(GinkgoT(), "Post", 3)
+		})
+		It("Don't send the remaining chunks once the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).
+				Run(func(mock.Arguments) { cancel() }).Once()
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{AddGUIDsChunkSize: 2}}
+			err := plugin.AddGuidsToPKey(ctx, 0x1234, guids)
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+
+			var chunksErr *GUIDChunksError
+			Expect(errors.As(err, &chunksErr)).To(BeTrue())
+			Expect(chunksErr.Failed).To(Equal(guids[2:]))
+			client.AssertNumberOfCalls(GinkgoT(), "Post", 1)
+		})
+	})
+	Context("GUID descriptions", func() {
+		var (
+			guids   []net.HardwareAddr
+			ctx     context.Context
+			created = time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+		)
+
+		BeforeEach(func() {
+			guid1, err := net.ParseMAC("02:00:00:00:00:00:00:01")
+			Expect(err).ToNot(HaveOccurred())
+			guid2, err := net.ParseMAC("02:00:00:00:00:00:00:02")
+			Expect(err).ToNot(HaveOccurred())
+			guids = []net.HardwareAddr{guid1, guid2}
+			ctx = plugins.WithGUIDOwners(context.Background(), map[string]plugins.GUIDOwner{
+				guid1.String(): {Kind: "Pod", Namespace: "default", Name: "web-0", Created: created}})
+		})
+
+		It("Describe the guids owners and the created pkey", func() {
+			client := &mocks.Client{}
+			client.On("Get", mock.Anything, mock.Anything, http.StatusOK).Return(nil,
+				&httpDriver.StatusError{Code: 404, ExpectedCode: 200, Body: "not found"})
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, []byte(`{"pkey":"0x0005",`+
+				`"partition_name":"k8s-cluster-a-0x0005","description":"ib-kubernetes cluster=cluster-a",`+
+				`"index0":true,"ip_over_ib":true,"membership":"full","guids":["0200000000000001","0200000000000002"],`+
+				`"guids_description":{"0200000000000001":`+
+				`"ib-kubernetes cluster=cluster-a pod=default/web-0 created=2024-01-02T15:04:05Z"}}`)).
+				Return(nil, nil).Once()
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{ClusterID: "cluster-a", GUIDDescriptions: true}}
+			Expect(plugin.AddGuidsToPKey(ctx, 0x5, guids)).To(Succeed())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Don't describe guids when disabled or not supported by the ufm version", func() {
+			client := &mocks.Client{}
+			client.On("Post", mock.Anything, mock.Anything, http.StatusOK, mock.MatchedBy(func(data []byte) bool {
+				return !strings.Contains(string(data), "description")
+			})).Return(nil, nil).Twice()
+
+			plugin := &ufmPlugin{client: client, conf: UFMConfig{}}
+			Expect(plugin.AddGuidsToPKey(ctx, 0x5, guids)).To(Succeed())
+			plugin = &ufmPlugin{client: client, conf: UFMConfig{GUIDDescriptions: true}, api: legacyUFMAPI}
+			Expect(plugin.AddGuidsToPKey(ctx, 0x5, guids)).To(Succeed())
+			client.AssertExpectations(GinkgoT())
+		})
+		It("Describe owners without namespace or creation time", func() {
+			plugin := &ufmPlugin{}
+			Expect(plugin.guidDescription(plugins.GUIDOwner{Kind: "ReplicaSet", Namespace: "default",
+				Name: "app"})).To(Equal("ib-kubernetes replicaset=default/app"))
+			Expect(plugin.guidDescription(plugins.GUIDOwner{Name: "admin"})).To(Equal("ib-kubernetes owner=admin"))
+		})
+	})
 })
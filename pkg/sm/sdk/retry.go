@@ -0,0 +1,62 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+// DefaultBackoff is the backoff of Retry, ~3 seconds over 4 attempts. The daemon retries failed
+// subnet manager calls on its own, so plugins should only retry transient failures briefly.
+var DefaultBackoff = wait.Backoff{Duration: 200 * time.Millisecond, Factor: 2, Jitter: 0.1, Steps: 4}
+
+// permanentError marks errors which shouldn't be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps the error so Retry returns it without retrying, e.g. for requests rejected by the subnet manager
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retry calls request until it succeeds, it returns a permanent error, the backoff steps are exhausted or the
+// context is done. ErrNotSupported errors are never retried. The last error of the request is returned.
+func Retry(ctx context.Context, backoff wait.Backoff, request func(ctx context.Context) error) error {
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		lastErr = request(ctx)
+		if lastErr == nil {
+			return true, nil
+		}
+
+		var permanent *permanentError
+		if errors.As(lastErr, &permanent) {
+			lastErr = permanent.err
+			return false, lastErr
+		}
+		if errors.Is(lastErr, plugins.ErrNotSupported) {
+			return false, lastErr
+		}
+		return false, nil
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+// Package sdk provides helpers for writing subnet manager plugins for ib-kubernetes.
+//
+// A plugin is a go plugin built with "-buildmode=plugin" from a main package exporting an Initialize function
+// of type func() (plugins.SubnetManagerClient, error). The sdk helps plugins parse their configuration from
+// environment variables, log consistently with the daemon, validate arguments and retry subnet manager requests.
+// Package sdktest provides a conformance suite validating plugins match the daemon expectations.
+package sdk
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+)
+
+// ConfigValidator is implemented by plugin configurations validating their values after parsing
+type ConfigValidator interface {
+	Validate() error
+}
+
+// ParseConfig parses the plugin configuration from environment variables using the "env" and "envDefault"
+// struct tags of conf, which must be a pointer to a struct. The configuration is validated if it implements
+// ConfigValidator.
+func ParseConfig(conf interface{}) error {
+	if err := env.Parse(conf); err != nil {
+		return fmt.Errorf("failed to parse plugin config: %v", err)
+	}
+
+	if validator, ok := conf.(ConfigValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("invalid plugin config: %v", err)
+		}
+	}
+	return nil
+}
+
+// Logger returns the daemon logger with the plugin name field set
+func Logger(pluginName string) zerolog.Logger {
+	return log.With().Str("plugin", pluginName).Logger()
+}
+
+// ValidatePKey returns an error if the pkey is out of the valid 15 bits range
+func ValidatePKey(pKey int) error {
+	return ibUtils.ValidatePKey(pKey)
+}
+
+// FormatGUID returns the guid as reported by ListGuidsInUse, in its canonical form, e.g. "02:00:00:00:00:00:00:01"
+func FormatGUID(guid net.HardwareAddr) string {
+	return guid.String()
+}
+
+// ParseGUID parses a guid returned by a subnet manager, with or without delimiters, e.g. "0200000000000001",
+// "02:00:00:00:00:00:00:01" or "0x0200000000000001"
+func ParseGUID(guid string) (net.HardwareAddr, error) {
+	normalized, err := ibUtils.NormalizeGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	return net.ParseMAC(normalized)
+}
+
+// NormalizeGUID returns the canonical form of a guid returned by a subnet manager, e.g. "02:00:00:00:00:00:00:0f"
+// for "020000000000000F". Plugins should report the guids of ListGuidsInUse in this form.
+func NormalizeGUID(guid string) (string, error) {
+	return ibUtils.NormalizeGUID(guid)
+}
@@ -0,0 +1,109 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+type testConfig struct {
+	Address string `env:"SDK_TEST_ADDRESS"`
+	Retries int    `env:"SDK_TEST_RETRIES" envDefault:"3"`
+}
+
+func (c *testConfig) Validate() error {
+	if c.Address == "" {
+		return errors.New("missing address")
+	}
+	return nil
+}
+
+var _ = Describe("Plugin SDK", func() {
+	Context("ParseConfig", func() {
+		AfterEach(func() {
+			os.Clearenv()
+		})
+		It("Parse and validate config", func() {
+			Expect(os.Setenv("SDK_TEST_ADDRESS", "1.1.1.1")).To(Succeed())
+			conf := &testConfig{}
+			Expect(ParseConfig(conf)).To(Succeed())
+			Expect(conf).To(Equal(&testConfig{Address: "1.1.1.1", Retries: 3}))
+		})
+		It("Fail on invalid config", func() {
+			err := ParseConfig(&testConfig{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("invalid plugin config: missing address"))
+		})
+	})
+	Context("ValidatePKey", func() {
+		It("Validate pkeys range", func() {
+			Expect(ValidatePKey(0x1)).To(Succeed())
+			Expect(ValidatePKey(0x7FFF)).To(Succeed())
+			Expect(ValidatePKey(0x8000)).ToNot(Succeed())
+			Expect(ValidatePKey(-1)).ToNot(Succeed())
+		})
+	})
+	Context("ParseGUID", func() {
+		It("Parse guids formats", func() {
+			for _, guid := range []string{"0200000000000001", "02:00:00:00:00:00:00:01", "0x0200000000000001",
+				"02-00-00-00-00-00-00-01"} {
+				guidAddr, err := ParseGUID(guid)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(FormatGUID(guidAddr)).To(Equal("02:00:00:00:00:00:00:01"))
+			}
+		})
+		It("Fail on invalid guids", func() {
+			for _, guid := range []string{"", "02:00:00:00:00:00:01", "zz00000000000001"} {
+				_, err := ParseGUID(guid)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+	Context("Retry", func() {
+		backoff := wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+
+		It("Retry transient failures", func() {
+			calls := 0
+			Expect(Retry(context.Background(), backoff, func(_ context.Context) error {
+				calls++
+				if calls < 3 {
+					return errors.New("unavailable")
+				}
+				return nil
+			})).To(Succeed())
+			Expect(calls).To(Equal(3))
+		})
+		It("Return the last error when the steps are exhausted", func() {
+			calls := 0
+			err := Retry(context.Background(), backoff, func(_ context.Context) error {
+				calls++
+				return fmt.Errorf("unavailable %d", calls)
+			})
+			Expect(err).To(MatchError("unavailable 3"))
+		})
+		It("Don't retry permanent and not supported errors", func() {
+			calls := 0
+			err := Retry(context.Background(), backoff, func(_ context.Context) error {
+				calls++
+				return Permanent(errors.New("rejected"))
+			})
+			Expect(err).To(MatchError("rejected"))
+			Expect(calls).To(Equal(1))
+
+			err = Retry(context.Background(), backoff, func(_ context.Context) error {
+				calls++
+				return plugins.ErrNotSupported
+			})
+			Expect(err).To(MatchError(plugins.ErrNotSupported))
+			Expect(calls).To(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,207 @@
+// Package sdktest provides a conformance suite validating subnet manager plugins match the semantics
+// ib-kubernetes expects from a plugins.SubnetManagerClient.
+//
+// Vendors run the suite from a test of their plugin against a test or lab subnet manager:
+//
+//	func TestConformance(t *testing.T) {
+//		client, err := Initialize()
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		sdktest.RunConformance(t, client, sdktest.Options{PKey: 0x7F00})
+//	}
+package sdktest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/sdk"
+)
+
+// Options of the conformance suite
+type Options struct {
+	// PKey the suite adds and removes guids to, it must not be used by other consumers of the subnet manager.
+	// Defaults to 0x7F00.
+	PKey int
+	// GUIDs added to the pkey, defaults to two guids of the ib-kubernetes default guid pool
+	GUIDs []net.HardwareAddr
+	// SkipLimitedMembership skips AddGuidsToLimitedPKey checks, for subnet managers without limited membership
+	SkipLimitedMembership bool
+}
+
+const defaultPKey = 0x7F00
+
+var defaultGUIDs = []net.HardwareAddr{
+	{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xF0, 0x01},
+	{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xF0, 0x02},
+}
+
+// invalidPKeys are out of the 15 bits pkey range and must be rejected
+var invalidPKeys = []int{-1, 0x8000, 0xFFFF, 0x10000}
+
+// RunConformance runs the conformance suite against the subnet manager client. The guids are removed from
+// the pkey when the suite completes.
+func RunConformance(t *testing.T, client plugins.SubnetManagerClient, opts Options) {
+	t.Helper()
+	if opts.PKey == 0 {
+		opts.PKey = defaultPKey
+	}
+	if len(opts.GUIDs) == 0 {
+		opts.GUIDs = defaultGUIDs
+	}
+	t.Cleanup(func() {
+		if err := client.RemoveGuidsFromPKey(context.Background(), opts.PKey, opts.GUIDs); err != nil {
+			t.Logf("failed to remove conformance guids from pkey 0x%04X: %v", opts.PKey, err)
+		}
+	})
+
+	t.Run("Identity", func(t *testing.T) {
+		if client.Name() == "" {
+			t.Error("Name() must not be empty")
+		}
+		if _, err := sm.CheckSpec(client.Spec()); err != nil {
+			t.Errorf("Spec() must be supported by the daemon: %v", err)
+		}
+	})
+	t.Run("Validate", func(t *testing.T) {
+		if err := client.Validate(context.Background()); err != nil {
+			t.Fatalf("Validate() failed: %v", err)
+		}
+	})
+	t.Run("RejectInvalidPKeys", func(t *testing.T) {
+		testRejectInvalidPKeys(t, client, opts)
+	})
+	t.Run("AddGuidsToPKey", func(t *testing.T) {
+		testAddGuidsToPKey(t, client, opts)
+	})
+	t.Run("AddGuidsToLimitedPKey", func(t *testing.T) {
+		if opts.SkipLimitedMembership {
+			t.Skip("limited membership is skipped")
+		}
+		if err := client.AddGuidsToLimitedPKey(context.Background(), opts.PKey, opts.GUIDs); err != nil {
+			t.Fatalf("AddGuidsToLimitedPKey() failed: %v", err)
+		}
+	})
+	t.Run("RemoveGuidsFromPKey", func(t *testing.T) {
+		testRemoveGuidsFromPKey(t, client, opts)
+	})
+	t.Run("CanceledContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := client.AddGuidsToPKey(ctx, opts.PKey, opts.GUIDs); err == nil {
+			t.Error("AddGuidsToPKey() must fail once its context is canceled")
+		}
+	})
+}
+
+func testRejectInvalidPKeys(t *testing.T, client plugins.SubnetManagerClient, opts Options) {
+	for _, pKey := range invalidPKeys {
+		if err := client.AddGuidsToPKey(context.Background(), pKey, opts.GUIDs); err == nil {
+			t.Errorf("AddGuidsToPKey() accepted invalid pkey 0x%X", pKey)
+		}
+		if err := client.RemoveGuidsFromPKey(context.Background(), pKey, opts.GUIDs); err == nil {
+			t.Errorf("RemoveGuidsFromPKey() accepted invalid pkey 0x%X", pKey)
+		}
+		if _, err := client.GetPKeyMembers(context.Background(), pKey); err == nil {
+			t.Errorf("GetPKeyMembers() accepted invalid pkey 0x%X", pKey)
+		}
+		if !opts.SkipLimitedMembership {
+			if err := client.AddGuidsToLimitedPKey(context.Background(), pKey, opts.GUIDs); err == nil {
+				t.Errorf("AddGuidsToLimitedPKey() accepted invalid pkey 0x%X", pKey)
+			}
+		}
+	}
+}
+
+func testAddGuidsToPKey(t *testing.T, client plugins.SubnetManagerClient, opts Options) {
+	if err := client.AddGuidsToPKey(context.Background(), opts.PKey, opts.GUIDs); err != nil {
+		t.Fatalf("AddGuidsToPKey() failed: %v", err)
+	}
+	// the daemon retries failed calls, adding guids which are already members must succeed
+	if err := client.AddGuidsToPKey(context.Background(), opts.PKey, opts.GUIDs); err != nil {
+		t.Fatalf("AddGuidsToPKey() of guids which are already members failed: %v", err)
+	}
+
+	inUse, err := listGuidsInUse(client)
+	if err != nil {
+		t.Fatalf("ListGuidsInUse() failed: %v", err)
+	}
+	for _, guid := range opts.GUIDs {
+		if !inUse[guid.String()] {
+			t.Errorf("ListGuidsInUse() doesn't report guid %s added to pkey 0x%04X", guid, opts.PKey)
+		}
+	}
+
+	members, err := getPKeyMembers(client, opts.PKey)
+	if errors.Is(err, plugins.ErrNotSupported) {
+		return
+	}
+	if err != nil {
+		t.Fatalf("GetPKeyMembers() failed: %v", err)
+	}
+	for _, guid := range opts.GUIDs {
+		if !members[guid.String()] {
+			t.Errorf("GetPKeyMembers() doesn't report guid %s added to pkey 0x%04X", guid, opts.PKey)
+		}
+	}
+}
+
+func testRemoveGuidsFromPKey(t *testing.T, client plugins.SubnetManagerClient, opts Options) {
+	if err := client.RemoveGuidsFromPKey(context.Background(), opts.PKey, opts.GUIDs); err != nil {
+		t.Fatalf("RemoveGuidsFromPKey() failed: %v", err)
+	}
+	// the daemon retries failed calls, removing guids which are not members must succeed
+	if err := client.RemoveGuidsFromPKey(context.Background(), opts.PKey, opts.GUIDs); err != nil {
+		t.Fatalf("RemoveGuidsFromPKey() of guids which are not members failed: %v", err)
+	}
+
+	members, err := getPKeyMembers(client, opts.PKey)
+	if errors.Is(err, plugins.ErrNotSupported) {
+		return
+	}
+	if err != nil {
+		t.Fatalf("GetPKeyMembers() failed: %v", err)
+	}
+	for _, guid := range opts.GUIDs {
+		if members[guid.String()] {
+			t.Errorf("GetPKeyMembers() reports guid %s removed from pkey 0x%04X", guid, opts.PKey)
+		}
+	}
+}
+
+// listGuidsInUse returns the guids in use as a set of normalized guid strings, guids must be parsable
+func listGuidsInUse(client plugins.SubnetManagerClient) (map[string]bool, error) {
+	guids, err := client.ListGuidsInUse(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[string]bool, len(guids))
+	for _, guid := range guids {
+		guidAddr, err := sdk.ParseGUID(guid)
+		if err != nil {
+			return nil, err
+		}
+		inUse[guidAddr.String()] = true
+	}
+	return inUse, nil
+}
+
+// getPKeyMembers returns the pkey members as a set of normalized guid strings
+func getPKeyMembers(client plugins.SubnetManagerClient, pKey int) (map[string]bool, error) {
+	guids, err := client.GetPKeyMembers(context.Background(), pKey)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]bool, len(guids))
+	for _, guid := range guids {
+		members[guid.String()] = true
+	}
+	return members, nil
+}
@@ -0,0 +1,95 @@
+package sdktest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/sdk"
+)
+
+// memorySubnetManager is an in-memory subnet manager client following the expected semantics
+type memorySubnetManager struct {
+	mutex sync.Mutex
+	pKeys map[int]map[string]bool
+}
+
+func (m *memorySubnetManager) Name() string                     { return "memory" }
+func (m *memorySubnetManager) Spec() string                     { return "2.0" }
+func (m *memorySubnetManager) Validate(_ context.Context) error { return nil }
+
+func (m *memorySubnetManager) AddGuidsToPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.pKeys[pKey] == nil {
+		m.pKeys[pKey] = make(map[string]bool)
+	}
+	for _, guid := range guids {
+		m.pKeys[pKey][sdk.FormatGUID(guid)] = true
+	}
+	return nil
+}
+
+func (m *memorySubnetManager) AddGuidsToLimitedPKey(ctx context.Context, pKey int, guids []net.HardwareAddr) error {
+	return m.AddGuidsToPKey(ctx, pKey, guids)
+}
+
+func (m *memorySubnetManager) RemoveGuidsFromPKey(_ context.Context, pKey int, guids []net.HardwareAddr) error {
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, guid := range guids {
+		delete(m.pKeys[pKey], sdk.FormatGUID(guid))
+	}
+	return nil
+}
+
+func (m *memorySubnetManager) ListGuidsInUse(_ context.Context) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var guids []string
+	for _, members := range m.pKeys {
+		for guid := range members {
+			guids = append(guids, guid)
+		}
+	}
+	return guids, nil
+}
+
+func (m *memorySubnetManager) GetPKeyMembers(_ context.Context, pKey int) ([]net.HardwareAddr, error) {
+	if err := sdk.ValidatePKey(pKey); err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var guids []net.HardwareAddr
+	for guid := range m.pKeys[pKey] {
+		guidAddr, err := sdk.ParseGUID(guid)
+		if err != nil {
+			return nil, err
+		}
+		guids = append(guids, guidAddr)
+	}
+	return guids, nil
+}
+
+var _ plugins.SubnetManagerClient = &memorySubnetManager{}
+
+func TestConformance(t *testing.T) {
+	client := &memorySubnetManager{pKeys: make(map[int]map[string]bool)}
+	RunConformance(t, client, Options{})
+
+	if members := client.pKeys[defaultPKey]; len(members) != 0 {
+		t.Errorf("conformance guids %v were not removed from pkey", members)
+	}
+}
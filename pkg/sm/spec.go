@@ -0,0 +1,110 @@
+package sm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+)
+
+// SpecVersion is the version of the plugins.SubnetManagerClient interface a plugin implements, as reported by
+// its Spec() in the "<major>.<minor>" form. Plugins of the same major version are compatible, minor versions
+// add interface methods.
+type SpecVersion struct {
+	Major int
+	Minor int
+}
+
+var (
+	// MinSpecVersion is the oldest plugin spec version supported by the daemon, spec 2.0 added the context
+	// argument of the interface methods
+	MinSpecVersion = SpecVersion{Major: 2, Minor: 0}
+	// MaxSpecVersion is the newest plugin spec version known to the daemon
+	MaxSpecVersion = SpecVersion{Major: 2, Minor: 0}
+	// PKeyMembersSpecVersion is the spec version from which plugins implement GetPKeyMembers
+	PKeyMembersSpecVersion = SpecVersion{Major: 1, Minor: 1}
+)
+
+func (v SpecVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// AtLeast returns true if the spec version is the same or newer than the other version
+func (v SpecVersion) AtLeast(other SpecVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	return v.Minor >= other.Minor
+}
+
+// ParseSpecVersion parses a plugin spec version, e.g. "1.1", a missing minor version is 0
+func ParseSpecVersion(spec string) (SpecVersion, error) {
+	majorStr, minorStr, hasMinor := strings.Cut(strings.TrimPrefix(strings.TrimSpace(spec), "v"), ".")
+	major, err := strconv.Atoi(majorStr)
+	if err != nil || major < 0 {
+		return SpecVersion{}, fmt.Errorf("invalid plugin spec version %q", spec)
+	}
+
+	minor := 0
+	if hasMinor {
+		if minor, err = strconv.Atoi(minorStr); err != nil || minor < 0 {
+			return SpecVersion{}, fmt.Errorf("invalid plugin spec version %q", spec)
+		}
+	}
+	return SpecVersion{Major: major, Minor: minor}, nil
+}
+
+// CheckSpec returns the spec version of the plugin the daemon uses it with, or an error if the plugin spec
+// isn't supported. A plugin of a newer minor version of a supported major version is used as the newest
+// version known to the daemon, its newer methods aren't used.
+func CheckSpec(spec string) (SpecVersion, error) {
+	version, err := ParseSpecVersion(spec)
+	if err != nil {
+		return SpecVersion{}, err
+	}
+	if !version.AtLeast(MinSpecVersion) || version.Major > MaxSpecVersion.Major {
+		return SpecVersion{}, fmt.Errorf("plugin spec version %s is not supported, supported versions are %s to %s",
+			version, MinSpecVersion, MaxSpecVersion)
+	}
+	if !MaxSpecVersion.AtLeast(version) {
+		log.Warn().Msgf("plugin spec version %s is newer than %s, using it as %s", version, MaxSpecVersion,
+			MaxSpecVersion)
+		return MaxSpecVersion, nil
+	}
+	return version, nil
+}
+
+// specGatedClient reports the methods its plugin spec version doesn't implement as not supported
+type specGatedClient struct {
+	plugins.SubnetManagerClient
+	spec SpecVersion
+}
+
+// NewSpecGatedClient checks the spec version of the plugin client is supported and returns a client gating the
+// interface methods newer than its spec version, which return plugins.ErrNotSupported. Clients implementing
+// all the methods known to the daemon are returned as is.
+func NewSpecGatedClient(client plugins.SubnetManagerClient) (plugins.SubnetManagerClient, error) {
+	spec, err := CheckSpec(client.Spec())
+	if err != nil {
+		return nil, fmt.Errorf("subnet manager plugin %s: %v", client.Name(), err)
+	}
+	if spec.AtLeast(MaxSpecVersion) {
+		return client, nil
+	}
+
+	log.Info().Msgf("subnet manager plugin %s implements spec version %s, newer methods are disabled",
+		client.Name(), spec)
+	return &specGatedClient{SubnetManagerClient: client, spec: spec}, nil
+}
+
+func (c *specGatedClient) GetPKeyMembers(ctx context.Context, pkey int) ([]net.HardwareAddr, error) {
+	if !c.spec.AtLeast(PKeyMembersSpecVersion) {
+		return nil, plugins.ErrNotSupported
+	}
+	return c.SubnetManagerClient.GetPKeyMembers(ctx, pkey)
+}
@@ -0,0 +1,81 @@
+package sm
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/sm/plugins"
+	smMocks "github.com/Mellanox/ib-kubernetes/pkg/sm/plugins/mocks"
+)
+
+var _ = Describe("Subnet Manager Plugin Spec", func() {
+	Context("ParseSpecVersion", func() {
+		It("Parse spec versions", func() {
+			for spec, expected := range map[string]SpecVersion{
+				"1.0": {Major: 1}, "1.1": {Major: 1, Minor: 1}, "v2.3": {Major: 2, Minor: 3}, "1": {Major: 1}} {
+				version, err := ParseSpecVersion(spec)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(version).To(Equal(expected))
+			}
+		})
+		It("Reject invalid spec versions", func() {
+			for _, spec := range []string{"", "one", "1.x", "1.-1", "-1.0"} {
+				_, err := ParseSpecVersion(spec)
+				Expect(err).To(HaveOccurred(), spec)
+			}
+		})
+	})
+	Context("CheckSpec", func() {
+		It("Accept supported spec versions", func() {
+			version, err := CheckSpec("2.0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal(MinSpecVersion))
+		})
+		It("Use newer minor spec version as the newest known version", func() {
+			version, err := CheckSpec("2.7")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(version).To(Equal(MaxSpecVersion))
+		})
+		It("Refuse other major spec versions", func() {
+			_, err := CheckSpec("3.0")
+			Expect(err).To(HaveOccurred())
+			_, err = CheckSpec("1.1")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("NewSpecGatedClient", func() {
+		var client *smMocks.SubnetManagerClient
+
+		BeforeEach(func() {
+			client = &smMocks.SubnetManagerClient{}
+			client.On("Name").Return("mock").Maybe()
+		})
+
+		It("Return client implementing the newest spec as is", func() {
+			client.On("Spec").Return("2.0")
+			gated, err := NewSpecGatedClient(client)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gated).To(BeIdenticalTo(client))
+		})
+		It("Report pkey members as not supported by spec 1.0 client", func() {
+			client.On("RemoveGuidsFromPKey", mock.Anything, 0x5, []net.HardwareAddr(nil)).Return(nil)
+			gated := &specGatedClient{SubnetManagerClient: client, spec: SpecVersion{Major: 1}}
+
+			_, err := gated.GetPKeyMembers(context.Background(), 0x5)
+			Expect(errors.Is(err, plugins.ErrNotSupported)).To(BeTrue())
+			client.AssertNotCalled(GinkgoT(), "GetPKeyMembers", mock.Anything, 0x5)
+			Expect(gated.RemoveGuidsFromPKey(context.Background(), 0x5, nil)).To(Succeed())
+		})
+		It("Refuse client of unsupported spec", func() {
+			client.On("Spec").Return("1.1")
+			_, err := NewSpecGatedClient(client)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("subnet manager plugin mock"))
+		})
+	})
+})
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Tracing", func() {
+	var recorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+
+	Context("Init", func() {
+		It("Tracing is disabled without exporter and endpoint", func() {
+			GinkgoT().Setenv("OTEL_TRACES_EXPORTER", "")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+			Expect(tracesExporter()).To(Equal(exporterNone))
+			shutdown, err := Init(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(shutdown(context.Background())).To(Succeed())
+		})
+		It("Otlp exporter is used when endpoint is set", func() {
+			GinkgoT().Setenv("OTEL_TRACES_EXPORTER", "")
+			GinkgoT().Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+			Expect(tracesExporter()).To(Equal(exporterOTLP))
+		})
+		It("Console exporter", func() {
+			GinkgoT().Setenv("OTEL_TRACES_EXPORTER", exporterConsole)
+			shutdown, err := Init(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(shutdown(context.Background())).To(Succeed())
+		})
+		It("Unsupported exporter", func() {
+			GinkgoT().Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+			_, err := Init(context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("Start and End", func() {
+		It("Child span records error", func() {
+			ctx, parent := Start(context.Background(), "parent")
+			_, child := Start(ctx, "child", attribute.String("network.id", "default_ib"))
+			End(child, errors.New("failed"))
+			End(parent, nil)
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(2))
+			Expect(spans[0].Name()).To(Equal("child"))
+			Expect(spans[0].Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()))
+			Expect(spans[0].Status().Code).To(Equal(codes.Error))
+			Expect(spans[0].Attributes()).To(ContainElement(attribute.String("network.id", "default_ib")))
+			Expect(spans[1].Status().Code).To(Equal(codes.Unset))
+		})
+	})
+	Context("WrapTransport", func() {
+		It("Creates client span and propagates trace context", func() {
+			var traceParent string
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				traceParent = r.Header.Get("traceparent")
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			ctx, parent := Start(context.Background(), "parent")
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/ufmRest/app/ufm_version", nil)
+			Expect(err).ToNot(HaveOccurred())
+			client := &http.Client{Transport: WrapTransport(nil)}
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			parent.End()
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(2))
+			Expect(spans[0].Name()).To(Equal("HTTP GET"))
+			Expect(spans[0].Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()))
+			Expect(spans[0].Status().Code).To(Equal(codes.Error))
+			Expect(spans[0].Attributes()).To(ContainElements(
+				attribute.String("url.path", "/ufmRest/app/ufm_version"),
+				attribute.Int("http.response.status_code", http.StatusServiceUnavailable)))
+			Expect(traceParent).To(ContainSubstring(spans[0].SpanContext().SpanID().String()))
+		})
+	})
+})
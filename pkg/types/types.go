@@ -0,0 +1,79 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// networkIDSeparator separates the network namespace and name in the encoded network ID. Namespaces are DNS
+	// labels which can't contain it, so the first separator always ends the namespace.
+	networkIDSeparator = "_"
+	// namespacedNameSeparator is accepted when parsing network IDs given as <networkNamespace>/<networkName>
+	namespacedNameSeparator = "/"
+)
+
+// NetworkID identifies a network attachment definition by its namespace and name
+type NetworkID struct {
+	Namespace string
+	Name      string
+}
+
+// NewNetworkID returns the ID of the network of the given namespace and name
+func NewNetworkID(namespace, name string) NetworkID {
+	return NetworkID{Namespace: namespace, Name: name}
+}
+
+// NetworkIDOf returns the ID of the network requested by the pod network selection
+func NetworkIDOf(network *v1.NetworkSelectionElement) NetworkID {
+	return NetworkID{Namespace: network.Namespace, Name: network.Name}
+}
+
+// String returns the network ID encoded as <networkNamespace>_<networkName>, the encoding used as key of the
+// networks in the daemon maps, the admin API and the persisted state
+func (n NetworkID) String() string {
+	return n.Namespace + networkIDSeparator + n.Name
+}
+
+// ParseNetworkID parses a network ID encoded as <networkNamespace>_<networkName> or as
+// <networkNamespace>/<networkName>. The network name may contain the separator.
+func ParseNetworkID(networkID string) (NetworkID, error) {
+	separator := networkIDSeparator
+	if strings.Contains(networkID, namespacedNameSeparator) {
+		separator = namespacedNameSeparator
+	}
+	namespace, name, found := strings.Cut(networkID, separator)
+	if !found || namespace == "" || name == "" || strings.Contains(name, namespacedNameSeparator) {
+		return NetworkID{}, fmt.Errorf("invalid networkID %s, should be <networkNamespace>_<networkName>",
+			networkID)
+	}
+	return NetworkID{Namespace: namespace, Name: name}, nil
+}
+
+// PodNetworkID identifies a network of a pod, it is comparable so it is used as map key as is
+type PodNetworkID struct {
+	PodUID types.UID
+	// NetworkID is the network ID as encoded by NetworkID.String
+	NetworkID string
+}
+
+func (p PodNetworkID) String() string {
+	return string(p.PodUID) + namespacedNameSeparator + p.NetworkID
+}
+
+// NetworkInterfaceID identifies a network requested for a pod interface, the interface is empty if not requested
+type NetworkInterfaceID struct {
+	// NetworkID is the network ID as encoded by NetworkID.String
+	NetworkID string
+	Interface string
+}
+
+func (n NetworkInterfaceID) String() string {
+	if n.Interface == "" {
+		return n.NetworkID
+	}
+	return n.NetworkID + namespacedNameSeparator + n.Interface
+}
@@ -0,0 +1,59 @@
+package types
+
+import (
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Types", func() {
+	Context("NetworkID", func() {
+		It("Encode network ID", func() {
+			Expect(NewNetworkID("default", "ib-net").String()).To(Equal("default_ib-net"))
+			network := &v1.NetworkSelectionElement{Namespace: "foo", Name: "ib_net"}
+			Expect(NetworkIDOf(network)).To(Equal(NetworkID{Namespace: "foo", Name: "ib_net"}))
+			Expect(NetworkIDOf(network).String()).To(Equal("foo_ib_net"))
+		})
+		It("Parse network ID", func() {
+			networkID, err := ParseNetworkID("default_ib-net")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(networkID).To(Equal(NetworkID{Namespace: "default", Name: "ib-net"}))
+		})
+		It("Parse network ID with separator in the network name", func() {
+			networkID, err := ParseNetworkID("default_ib_net")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(networkID).To(Equal(NetworkID{Namespace: "default", Name: "ib_net"}))
+
+			parsed, err := ParseNetworkID(networkID.String())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(networkID))
+		})
+		It("Parse namespaced name network ID", func() {
+			networkID, err := ParseNetworkID("default/ib_net")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(networkID).To(Equal(NetworkID{Namespace: "default", Name: "ib_net"}))
+		})
+		It("Parse invalid network ID", func() {
+			for _, invalid := range []string{"", "ib-net", "_ib-net", "default_", "default/", "a/b/c"} {
+				_, err := ParseNetworkID(invalid)
+				Expect(err).To(HaveOccurred(), invalid)
+			}
+		})
+	})
+	Context("PodNetworkID", func() {
+		It("Use pod network ID as map key", func() {
+			seen := map[PodNetworkID]bool{{PodUID: "uid-1", NetworkID: "default_ib-net"}: true}
+			Expect(seen).To(HaveKey(PodNetworkID{PodUID: "uid-1", NetworkID: "default_ib-net"}))
+			Expect(seen).ToNot(HaveKey(PodNetworkID{PodUID: "uid-1d", NetworkID: "efault_ib-net"}))
+			Expect(PodNetworkID{PodUID: "uid-1", NetworkID: "default_ib-net"}.String()).To(
+				Equal("uid-1/default_ib-net"))
+		})
+	})
+	Context("NetworkInterfaceID", func() {
+		It("Encode network interface ID", func() {
+			Expect(NetworkInterfaceID{NetworkID: "default_ib-net"}.String()).To(Equal("default_ib-net"))
+			Expect(NetworkInterfaceID{NetworkID: "default_ib-net", Interface: "net1"}.String()).To(
+				Equal("default_ib-net/net1"))
+		})
+	})
+})
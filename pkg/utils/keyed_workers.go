@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"sync"
+)
+
+// KeyedWorkerPool runs tasks in parallel across keys, while the tasks of a key run one at a time in their
+// submission order, e.g. so the subnet manager calls on a pkey never interleave. At most workers keys are
+// processed concurrently, a key keeps its worker until its pending tasks are done.
+type KeyedWorkerPool struct {
+	mutex sync.Mutex
+	// pending holds the tasks waiting for the running worker of their key, a key is present while its worker runs
+	pending map[string][]func()
+	slots   chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewKeyedWorkerPool creates a pool running the tasks of at most workers keys concurrently
+func NewKeyedWorkerPool(workers int) *KeyedWorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &KeyedWorkerPool{pending: make(map[string][]func()), slots: make(chan struct{}, workers)}
+}
+
+// Submit queues the task of the key, it runs once the previous tasks of the key are done
+func (p *KeyedWorkerPool) Submit(key string, task func()) {
+	p.wg.Add(1)
+	p.mutex.Lock()
+	if queue, running := p.pending[key]; running {
+		p.pending[key] = append(queue, task)
+		p.mutex.Unlock()
+		return
+	}
+	p.pending[key] = nil
+	p.mutex.Unlock()
+
+	go p.run(key, task)
+}
+
+// Do runs the task of the key like Submit and waits until it is done
+func (p *KeyedWorkerPool) Do(key string, task func()) {
+	done := make(chan struct{})
+	p.Submit(key, func() {
+		defer close(done)
+		task()
+	})
+	<-done
+}
+
+// Wait waits until all the submitted tasks are done
+func (p *KeyedWorkerPool) Wait() {
+	p.wg.Wait()
+}
+
+// run runs the task then the pending tasks of the key, until none is left
+func (p *KeyedWorkerPool) run(key string, task func()) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+
+	for {
+		task()
+		p.wg.Done()
+
+		p.mutex.Lock()
+		queue := p.pending[key]
+		if len(queue) == 0 {
+			delete(p.pending, key)
+			p.mutex.Unlock()
+			return
+		}
+		task = queue[0]
+		p.pending[key] = queue[1:]
+		p.mutex.Unlock()
+	}
+}
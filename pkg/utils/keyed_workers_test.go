@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Keyed Worker Pool", func() {
+	It("Run the tasks of a key one at a time in submission order", func() {
+		pool := NewKeyedWorkerPool(4)
+		var mutex sync.Mutex
+		running := make(map[string]int)
+		order := make(map[string][]int)
+		overlapped := false
+		for i := 0; i < 50; i++ {
+			for _, key := range []string{"0x5", "0x6"} {
+				index, key := i, key
+				pool.Submit(key, func() {
+					mutex.Lock()
+					running[key]++
+					overlapped = overlapped || running[key] > 1
+					order[key] = append(order[key], index)
+					mutex.Unlock()
+
+					mutex.Lock()
+					running[key]--
+					mutex.Unlock()
+				})
+			}
+		}
+		pool.Wait()
+
+		Expect(overlapped).To(BeFalse())
+		for _, key := range []string{"0x5", "0x6"} {
+			Expect(order[key]).To(HaveLen(50))
+			for i, index := range order[key] {
+				Expect(index).To(Equal(i), fmt.Sprintf("task %d of key %s ran out of order", index, key))
+			}
+		}
+	})
+	It("Interleave the tasks of different keys", func() {
+		pool := NewKeyedWorkerPool(2)
+		started := make(chan struct{})
+		// the task of the first key waits for the task of the second key, which runs concurrently
+		pool.Submit("0x5", func() { <-started })
+		pool.Submit("0x6", func() { close(started) })
+		done := make(chan struct{})
+		go func() {
+			pool.Wait()
+			close(done)
+		}()
+		Eventually(done).Should(BeClosed())
+	})
+	It("Run the tasks of at most workers keys concurrently", func() {
+		pool := NewKeyedWorkerPool(1)
+		var running, maxRunning int32
+		for _, key := range []string{"0x5", "0x6", "0x7"} {
+			pool.Submit(key, func() {
+				current := atomic.AddInt32(&running, 1)
+				for {
+					observed := atomic.LoadInt32(&maxRunning)
+					if current <= observed || atomic.CompareAndSwapInt32(&maxRunning, observed, current) {
+						break
+					}
+				}
+				atomic.AddInt32(&running, -1)
+			})
+		}
+		pool.Wait()
+		Expect(atomic.LoadInt32(&maxRunning)).To(BeEquivalentTo(1))
+	})
+	It("Wait for the task run with Do after the pending tasks of its key", func() {
+		pool := NewKeyedWorkerPool(2)
+		release := make(chan struct{})
+		var steps []string
+		var mutex sync.Mutex
+		pool.Submit("0x5", func() {
+			<-release
+			mutex.Lock()
+			steps = append(steps, "add")
+			mutex.Unlock()
+		})
+		close(release)
+		pool.Do("0x5", func() {
+			mutex.Lock()
+			steps = append(steps, "remove")
+			mutex.Unlock()
+		})
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(steps).To(Equal([]string{"add", "remove"}))
+	})
+})
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+)
+
+var (
+	networkSelectionFieldsOnce sync.Once
+	// networkSelectionFields are the JSON fields of the network selection elements known to NetworkSelectionElement
+	networkSelectionFields map[string]bool
+)
+
+// knownNetworkSelectionFields returns the JSON fields of NetworkSelectionElement, the fields added by newer versions
+// of the network plumbing working group spec are unknown until the dependency is upgraded
+func knownNetworkSelectionFields() map[string]bool {
+	networkSelectionFieldsOnce.Do(func() {
+		elementType := reflect.TypeOf(v1.NetworkSelectionElement{})
+		networkSelectionFields = make(map[string]bool, elementType.NumField())
+		for index := 0; index < elementType.NumField(); index++ {
+			name, _, _ := strings.Cut(elementType.Field(index).Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				networkSelectionFields[name] = true
+			}
+		}
+	})
+	return networkSelectionFields
+}
+
+// MarshalPodNetworks returns the network annotation of the pod networks, keeping the fields of the elements of the
+// original annotation unknown to NetworkSelectionElement, so the annotation rewritten by the daemon doesn't lose
+// the fields of newer versions of the spec. An element keeps the unknown fields of the original element at the same
+// position requesting the same network. The annotation is the JSON list of the networks if no element has unknown
+// fields, the elements with unknown fields have their fields sorted.
+func MarshalPodNetworks(networks []*v1.NetworkSelectionElement, original string) ([]byte, error) {
+	annotation, err := json.Marshal(networks)
+	if err != nil {
+		return nil, err
+	}
+	unknown := unknownNetworkSelectionFields(original)
+	if len(unknown) == 0 {
+		return annotation, nil
+	}
+
+	elements := make([]json.RawMessage, 0, len(networks))
+	for index, network := range networks {
+		element, err := json.Marshal(network)
+		if err != nil {
+			return nil, err
+		}
+		if index < len(unknown) && unknown[index] != nil && unknown[index].name == network.Name {
+			if element, err = mergeUnknownFields(element, unknown[index].fields); err != nil {
+				return nil, err
+			}
+		}
+		elements = append(elements, element)
+	}
+	return json.Marshal(elements)
+}
+
+// elementUnknownFields are the unknown fields of a network selection element and the network it requests
+type elementUnknownFields struct {
+	name   string
+	fields map[string]json.RawMessage
+}
+
+// unknownNetworkSelectionFields returns the unknown fields of the elements of the network annotation by position,
+// nil for the elements without unknown fields, or none if the annotation isn't a JSON list, e.g. the comma
+// separated network names
+func unknownNetworkSelectionFields(annotation string) []*elementUnknownFields {
+	trimmed := strings.TrimSpace(annotation)
+	if !strings.HasPrefix(trimmed, "[") {
+		return nil
+	}
+	var elements []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &elements); err != nil {
+		return nil
+	}
+
+	known := knownNetworkSelectionFields()
+	var unknown []*elementUnknownFields
+	for index, element := range elements {
+		var fields map[string]json.RawMessage
+		for key, value := range element {
+			if known[key] {
+				continue
+			}
+			if fields == nil {
+				fields = make(map[string]json.RawMessage)
+			}
+			fields[key] = value
+		}
+		if fields == nil {
+			continue
+		}
+		var name string
+		if err := json.Unmarshal(element["name"], &name); err != nil {
+			continue
+		}
+		for len(unknown) <= index {
+			unknown = append(unknown, nil)
+		}
+		unknown[index] = &elementUnknownFields{name: name, fields: fields}
+	}
+	return unknown
+}
+
+// mergeUnknownFields adds the unknown fields to the JSON object of the network selection element
+func mergeUnknownFields(element []byte, unknown map[string]json.RawMessage) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(element, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range unknown {
+		fields[key] = value
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"encoding/json"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pod Network Annotation", func() {
+	// rewrite parses the network annotation, sets the guid of the first network and marshals it back as the
+	// daemon does when configuring the pod
+	rewrite := func(annotation string) string {
+		pod := &PodRef{Namespace: "default", Annotations: map[string]string{v1.NetworkAttachmentAnnot: annotation}}
+		networks, err := ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(SetPodNetworkGUID(networks[0], "02:00:00:00:00:00:00:01", false)).To(Succeed())
+		rewritten, err := MarshalPodNetworks(networks, annotation)
+		Expect(err).ToNot(HaveOccurred())
+		return string(rewritten)
+	}
+
+	It("Marshal the networks without unknown fields as a JSON list", func() {
+		annotation := `[{"name": "ib-net", "interface": "net1"}, {"name": "other-net"}]`
+		pod := &PodRef{Namespace: "default", Annotations: map[string]string{v1.NetworkAttachmentAnnot: annotation}}
+		networks, err := ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		expected, err := json.Marshal(networks)
+		Expect(err).ToNot(HaveOccurred())
+
+		rewritten, err := MarshalPodNetworks(networks, annotation)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rewritten).To(Equal(expected))
+	})
+	It("Keep the unknown fields of the elements", func() {
+		rewritten := rewrite(`[{"name": "ib-net", "future-field": {"mode": "fast"}, "x-note": "keep"}, ` +
+			`{"name": "other-net", "future-list": [1, 2]}]`)
+
+		Expect(rewritten).To(MatchJSON(`[
+			{"name": "ib-net", "namespace": "default", "cni-args": {"guid": "02:00:00:00:00:00:00:01"},
+				"future-field": {"mode": "fast"}, "x-note": "keep"},
+			{"name": "other-net", "namespace": "default", "future-list": [1, 2]}]`))
+	})
+	It("Keep the unknown fields across rewrites", func() {
+		annotation := `[{"name": "ib-net", "future-field": true}]`
+		rewritten := rewrite(annotation)
+
+		Expect(rewrite(rewritten)).To(MatchJSON(rewritten))
+		Expect(rewritten).To(MatchJSON(`[{"name": "ib-net", "namespace": "default", ` +
+			`"cni-args": {"guid": "02:00:00:00:00:00:00:01"}, "future-field": true}]`))
+	})
+	It("Don't move the unknown fields to another network", func() {
+		networks := []*v1.NetworkSelectionElement{{Name: "other-net"}}
+
+		rewritten, err := MarshalPodNetworks(networks, `[{"name": "ib-net", "future-field": true}]`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(rewritten)).To(MatchJSON(`[{"name": "other-net"}]`))
+	})
+	It("Marshal the networks of a comma separated network annotation", func() {
+		Expect(rewrite("ib-net@net1, other-net")).To(MatchJSON(`[
+			{"name": "ib-net", "namespace": "default", "interface": "net1",
+				"cni-args": {"guid": "02:00:00:00:00:00:00:01"}},
+			{"name": "other-net", "namespace": "default"}]`))
+	})
+})
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"sync"
+
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PodNetworksCache caches the parsed network annotation of the pods by pod UID and resource version, so the
+// annotation of a pod is parsed once by the pod reconciler and reused while the pod doesn't change. A nil cache
+// parses the annotation on every call.
+type PodNetworksCache struct {
+	mutex   sync.Mutex
+	entries map[types.UID]*podNetworksEntry
+}
+
+type podNetworksEntry struct {
+	resourceVersion string
+	// annotation is the parsed network annotation, the daemon updates the annotation of the pod object it
+	// configured without updating its resource version
+	annotation string
+	networks   []*v1.NetworkSelectionElement
+	// used is set when the entry is read and reset when the cache is pruned
+	used bool
+}
+
+// NewPodNetworksCache creates an empty pod networks cache
+func NewPodNetworksCache() *PodNetworksCache {
+	return &PodNetworksCache{entries: make(map[types.UID]*podNetworksEntry)}
+}
+
+// ParsePodNetworks returns the networks of the pod network annotation as ParsePodNetworks, the annotation is
+// parsed only if it isn't cached for the pod resource version. The returned networks are copies which the
+// caller may modify.
+func (c *PodNetworksCache) ParsePodNetworks(pod *PodRef) ([]*v1.NetworkSelectionElement, error) {
+	if c == nil {
+		return ParsePodNetworks(pod)
+	}
+
+	annotation := pod.Annotations[v1.NetworkAttachmentAnnot]
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, exist := c.entries[pod.UID]
+	if exist && entry.resourceVersion == pod.ResourceVersion && entry.annotation == annotation {
+		entry.used = true
+		return copyNetworks(entry.networks), nil
+	}
+
+	networks, err := ParsePodNetworks(pod)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[pod.UID] = &podNetworksEntry{resourceVersion: pod.ResourceVersion, annotation: annotation,
+		networks: networks, used: true}
+	return copyNetworks(networks), nil
+}
+
+// Prune drops the pods which networks weren't read since the previous prune
+func (c *PodNetworksCache) Prune() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for uid, entry := range c.entries {
+		if !entry.used {
+			delete(c.entries, uid)
+			continue
+		}
+		entry.used = false
+	}
+}
+
+// Len returns the number of cached pods
+func (c *PodNetworksCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+// copyNetworks returns copies of the networks, the "cni-args" which are set when configuring the pod networks are
+// copied as well, the other requests are shared
+func copyNetworks(networks []*v1.NetworkSelectionElement) []*v1.NetworkSelectionElement {
+	copies := make([]*v1.NetworkSelectionElement, 0, len(networks))
+	for _, network := range networks {
+		networkCopy := *network
+		if network.CNIArgs != nil {
+			cniArgs := make(map[string]interface{}, len(*network.CNIArgs))
+			for key, value := range *network.CNIArgs {
+				cniArgs[key] = value
+			}
+			networkCopy.CNIArgs = &cniArgs
+		}
+		copies = append(copies, &networkCopy)
+	}
+	return copies
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pod Networks Cache", func() {
+	var (
+		cache *PodNetworksCache
+		pod   *PodRef
+	)
+
+	BeforeEach(func() {
+		cache = NewPodNetworksCache()
+		pod = &PodRef{Name: "pod", Namespace: "foo", UID: "uid", ResourceVersion: "1", Annotations: map[string]string{
+			v1.NetworkAttachmentAnnot: `[{"name": "ib-net", "cni-args": {"guid": "02:00:00:00:00:00:00:01"}}]`}}
+	})
+
+	It("Parse the pod networks once per resource version", func() {
+		networks, err := cache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(networks).To(HaveLen(1))
+		Expect(networks[0].Namespace).To(Equal("foo"))
+		parsed := cache.entries[pod.UID].networks
+
+		_, err = cache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cache.entries[pod.UID].networks[0]).To(BeIdenticalTo(parsed[0]))
+
+		pod.ResourceVersion = "2"
+		_, err = cache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cache.entries[pod.UID].networks[0]).ToNot(BeIdenticalTo(parsed[0]))
+		Expect(cache.Len()).To(Equal(1))
+	})
+	It("Parse again the annotation updated without a new resource version", func() {
+		_, err := cache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+
+		pod.Annotations[v1.NetworkAttachmentAnnot] = `[{"name": "ib-net"}, {"name": "other", "namespace": "bar"}]`
+		networks, err := cache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(networks).To(HaveLen(2))
+	})
+	It("Return copies of the cached networks", func() {
+		networks, err := cache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		(*networks[0].CNIArgs)[InfiniBandAnnotation] = ConfiguredInfiniBandPod
+		networks[0].InfinibandGUIDRequest = "02:00:00:00:00:00:00:02"
+
+		networks, err = cache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*networks[0].CNIArgs).ToNot(HaveKey(InfiniBandAnnotation))
+		Expect(networks[0].InfinibandGUIDRequest).To(BeEmpty())
+	})
+	It("Don't cache invalid annotations", func() {
+		pod.Annotations[v1.NetworkAttachmentAnnot] = `[{"name": `
+		_, err := cache.ParsePodNetworks(pod)
+		Expect(err).To(HaveOccurred())
+		Expect(cache.Len()).To(Equal(0))
+	})
+	It("Prune the pods not read since the previous prune", func() {
+		_, err := cache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+
+		cache.Prune()
+		Expect(cache.Len()).To(Equal(1))
+		cache.Prune()
+		Expect(cache.Len()).To(Equal(0))
+	})
+	It("Parse the pod networks without a cache", func() {
+		var noCache *PodNetworksCache
+		networks, err := noCache.ParsePodNetworks(pod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(networks).To(HaveLen(1))
+		noCache.Prune()
+		Expect(noCache.Len()).To(Equal(0))
+	})
+})
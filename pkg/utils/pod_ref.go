@@ -0,0 +1,86 @@
+package utils
+
+import (
+	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// podRefAnnotations are the pod annotations read and written by the daemon
+var podRefAnnotations = []string{v1.NetworkAttachmentAnnot, ConfiguredNetworksAnnotation, InterfacesStatusAnnotation,
+	InfiniBandMetadataAnnotation}
+
+// PodRef is the projection of a pod kept by the pod handler until the periodic updates process it, and used by the
+// daemon to configure the pod networks. It holds the pod identity and node, the fields the daemon orders and
+// authorizes the pods by, and the annotations the daemon reads and writes. The containers, volumes, managed fields
+// and other annotations of large pods aren't kept.
+type PodRef struct {
+	Namespace       string
+	Name            string
+	UID             types.UID
+	ResourceVersion string
+	NodeName        string
+	// ServiceAccountName is the service account the partition policies are checked for
+	ServiceAccountName string
+	// Priority is the priority of the pod resolved from its priority class, nil if not set
+	Priority          *int32
+	CreationTimestamp metav1.Time
+	DeletionTimestamp *metav1.Time
+	// Controller is the controller owner of the pod, nil if the pod has no controller
+	Controller *metav1.OwnerReference
+	// Annotations are the network annotation, the configured networks, the interfaces status and the InfiniBand
+	// metadata annotations of the pod, copied so the daemon doesn't modify the pod of the informer cache
+	Annotations map[string]string
+}
+
+// NewPodRef returns the reference of the pod
+func NewPodRef(pod *kapi.Pod) *PodRef {
+	annotations := make(map[string]string, len(podRefAnnotations))
+	for _, key := range podRefAnnotations {
+		if value, exist := pod.Annotations[key]; exist {
+			annotations[key] = value
+		}
+	}
+
+	var controller *metav1.OwnerReference
+	if owner := metav1.GetControllerOfNoCopy(pod); owner != nil {
+		ownerCopy := *owner
+		controller = &ownerCopy
+	}
+	return &PodRef{
+		Namespace:          pod.Namespace,
+		Name:               pod.Name,
+		UID:                pod.UID,
+		ResourceVersion:    pod.ResourceVersion,
+		NodeName:           pod.Spec.NodeName,
+		ServiceAccountName: pod.Spec.ServiceAccountName,
+		Priority:           pod.Spec.Priority,
+		CreationTimestamp:  pod.CreationTimestamp,
+		DeletionTimestamp:  pod.DeletionTimestamp,
+		Controller:         controller,
+		Annotations:        annotations,
+	}
+}
+
+// Pod returns the pod object of the reference for the kubernetes client calls, it shares the annotations of the
+// reference
+func (r *PodRef) Pod() *kapi.Pod {
+	var owners []metav1.OwnerReference
+	if r.Controller != nil {
+		owners = []metav1.OwnerReference{*r.Controller}
+	}
+	return &kapi.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         r.Namespace,
+			Name:              r.Name,
+			UID:               r.UID,
+			ResourceVersion:   r.ResourceVersion,
+			CreationTimestamp: r.CreationTimestamp,
+			DeletionTimestamp: r.DeletionTimestamp,
+			OwnerReferences:   owners,
+			Annotations:       r.Annotations,
+		},
+		Spec: kapi.PodSpec{NodeName: r.NodeName, ServiceAccountName: r.ServiceAccountName, Priority: r.Priority},
+	}
+}
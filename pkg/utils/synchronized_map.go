@@ -46,3 +46,50 @@ func (m *SynchronizedMap) UnSafeRemove(key string) {
 func (m *SynchronizedMap) UnSafeSet(key string, value interface{}) {
 	m.Items[key] = value
 }
+
+// Update sets the key to the value returned by update for the current value under lock, so the value is read and
+// written atomically. The key is removed if update returns nil.
+func (m *SynchronizedMap) Update(key string, update func(value interface{}, exist bool) interface{}) {
+	m.Lock()
+	defer m.Unlock()
+	value, exist := m.Items[key]
+	if value = update(value, exist); value == nil {
+		m.UnSafeRemove(key)
+		return
+	}
+	m.UnSafeSet(key, value)
+}
+
+// Snapshot returns a copy of the items of the map
+func (m *SynchronizedMap) Snapshot() map[string]interface{} {
+	m.RLock()
+	defer m.RUnlock()
+	items := make(map[string]interface{}, len(m.Items))
+	for key, value := range m.Items {
+		items[key] = value
+	}
+	return items
+}
+
+// Drain returns the items of the map and clears it, so the items are processed without holding the lock while
+// new items are set
+func (m *SynchronizedMap) Drain() map[string]interface{} {
+	m.Lock()
+	defer m.Unlock()
+	items := m.Items
+	m.Items = make(map[string]interface{})
+	return items
+}
+
+// Restore sets drained items which weren't processed back to the map, merge combines a restored value with the
+// value set since the items were drained
+func (m *SynchronizedMap) Restore(items map[string]interface{}, merge func(restored, current interface{}) interface{}) {
+	m.Lock()
+	defer m.Unlock()
+	for key, restored := range items {
+		if current, exist := m.Items[key]; exist {
+			restored = merge(restored, current)
+		}
+		m.UnSafeSet(key, restored)
+	}
+}
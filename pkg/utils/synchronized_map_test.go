@@ -0,0 +1,47 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Synchronized Map", func() {
+	var m *SynchronizedMap
+
+	BeforeEach(func() {
+		m = NewSynchronizedMap()
+		m.Set("net-1", []string{"pod-1"})
+	})
+
+	It("Update value atomically and remove key updated to nil", func() {
+		m.Update("net-1", func(value interface{}, exist bool) interface{} {
+			Expect(exist).To(BeTrue())
+			return append(value.([]string), "pod-2")
+		})
+		value, _ := m.Get("net-1")
+		Expect(value).To(Equal([]string{"pod-1", "pod-2"}))
+
+		m.Update("net-1", func(interface{}, bool) interface{} { return nil })
+		_, exist := m.Get("net-1")
+		Expect(exist).To(BeFalse())
+	})
+	It("Snapshot items without changing the map", func() {
+		items := m.Snapshot()
+		items["net-2"] = []string{"pod-2"}
+		Expect(m.Items).To(HaveLen(1))
+		Expect(items).To(HaveKeyWithValue("net-1", []string{"pod-1"}))
+	})
+	It("Drain items and restore the unprocessed items before the items set meanwhile", func() {
+		items := m.Drain()
+		Expect(items).To(HaveKeyWithValue("net-1", []string{"pod-1"}))
+		Expect(m.Items).To(BeEmpty())
+
+		m.Set("net-1", []string{"pod-2"})
+		m.Set("net-2", []string{"pod-3"})
+		m.Restore(items, func(restored, current interface{}) interface{} {
+			return append(restored.([]string), current.([]string)...)
+		})
+		Expect(m.Items).To(Equal(map[string]interface{}{
+			"net-1": []string{"pod-1", "pod-2"}, "net-2": []string{"pod-3"}}))
+	})
+})
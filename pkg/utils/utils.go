@@ -3,26 +3,140 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 
 	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	netAttUtils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
 	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
 )
 
 type IbSriovCniSpec struct {
-	Type         string          `json:"type"`
-	PKey         string          `json:"pkey"`
-	Capabilities map[string]bool `json:"capabilities,omitempty"`
+	Type         string                 `json:"type"`
+	PKey         string                 `json:"pkey"`
+	Capabilities IbSriovCniCapabilities `json:"capabilities,omitempty"`
+	// GUIDsPerInterface is the number of guids allocated for each pod interface of the network, e.g. the port
+	// guids of multi-port VFs, a single guid if not set
+	GUIDsPerInterface int `json:"guidsPerInterface,omitempty"`
+}
+
+// IbSriovCniCapabilities are the capabilities the ib-sriov CNI advertises in the network spec, the daemon adapts
+// how the pod networks are configured to them. Capabilities not set are nil, other capabilities are ignored.
+type IbSriovCniCapabilities struct {
+	// InfiniBandGUID the guid is delivered as "infiniband-guid" runtime config instead of "cni-args", overrides
+	// the daemon guid injection mode
+	InfiniBandGUID *bool `json:"infinibandGUID,omitempty"`
+	// InfiniBandPKey the pkey resolved by the daemon, e.g. allocated for an "auto" pkey, is delivered in the
+	// "cni-args" of the pod network
+	InfiniBandPKey *bool `json:"infinibandPKey,omitempty"`
+	// RDMAIsolation the RDMA device of the interface is isolated in the pod network namespace, recorded in the
+	// InfiniBand metadata of the interface
+	RDMAIsolation *bool `json:"rdmaIsolation,omitempty"`
+}
+
+// PKeyInCNIArgs returns true if the pkey is delivered in the "cni-args" of the pod network
+func (c *IbSriovCniCapabilities) PKeyInCNIArgs() bool {
+	return c.InfiniBandPKey != nil && *c.InfiniBandPKey
+}
+
+// IsRDMAIsolated returns true if the RDMA device of the interface is isolated in the pod network namespace
+func (c *IbSriovCniCapabilities) IsRDMAIsolated() bool {
+	return c.RDMAIsolation != nil && *c.RDMAIsolation
+}
+
+// InterfaceGUIDs returns the number of guids allocated for each pod interface of the network, at most
+// MaxGUIDsPerInterface
+func (s *IbSriovCniSpec) InterfaceGUIDs() int {
+	return min(max(s.GUIDsPerInterface, 1), MaxGUIDsPerInterface)
 }
 
 const (
 	InfiniBandAnnotation    = "mellanox.infiniband.app"
 	ConfiguredInfiniBandPod = "configured"
 	InfiniBandSriovCni      = "ib-sriov"
+	// ManagedAnnotation pod and network annotation, when set to "false" ib-kubernetes skips GUID assignment and
+	// pkey management for the pod's networks, or for the pods of the network
+	ManagedAnnotation = "ib-kubernetes.nvidia.com/managed"
+	// AutoPKey network pkey value requesting ib-kubernetes to allocate a pkey from the pkey pool
+	AutoPKey = "auto"
+	// DefaultPKeyName network pkey value of the default partition, equivalent to "0x7FFF"
+	DefaultPKeyName = "default"
+	// PKeyAnnotation network attachment definition annotation recording the pkey allocated for the network
+	PKeyAnnotation = "ib-kubernetes.nvidia.com/pkey"
+	// NetworkStatusAnnotation network attachment definition annotation recording the reconcile status of the network
+	NetworkStatusAnnotation = "ib-kubernetes.nvidia.com/status"
+	// ConfiguredNetworksAnnotation pod annotation marking the networks configured with InfiniBand which GUID is
+	// delivered as runtime config only, so their "cni-args" aren't modified
+	ConfiguredNetworksAnnotation = "ib-kubernetes.nvidia.com/configured-networks"
+	// InterfacesStatusAnnotation pod annotation reporting the guid and pkey configured by ib-kubernetes for each
+	// InfiniBand interface of the pod, as a JSON object of InterfaceStatus by interface name
+	InterfacesStatusAnnotation = "ib-kubernetes.nvidia.com/interfaces-status"
+	// InfiniBandMetadataAnnotation pod annotation holding the InfiniBand metadata of the pod interfaces configured
+	// by ib-kubernetes, as a versioned InfiniBandMetadata JSON object
+	InfiniBandMetadataAnnotation = "ib-kubernetes.nvidia.com/infiniband-metadata"
+	// InfiniBandMetadataVersion version of the InfiniBandMetadata written by ib-kubernetes
+	InfiniBandMetadataVersion = "v1"
+	// GUIDResourceName node extended resource advertising the guids the pods of the node can be assigned, each
+	// InfiniBand interface of a pod requests one
+	GUIDResourceName = "ib-kubernetes.nvidia.com/guid"
+	// MembershipFull membership of the guids in their network pkey
+	MembershipFull = "full"
+	// ResourceNameAnnotation network attachment definition annotation naming the device plugin resource the pods
+	// of the network request, e.g. the SR-IOV VFs of the InfiniBand devices
+	ResourceNameAnnotation = "k8s.v1.cni.cncf.io/resourceName"
+	// InterfaceStateConfigured state of an interface which guid was added to its network pkey
+	InterfaceStateConfigured = "configured"
+	// GUIDInjectionCNIArgs delivers the GUIDs in the pods' network "cni-args", unless the network has the
+	// "infinibandGUID" capability
+	GUIDInjectionCNIArgs = "cni-args"
+	// GUIDInjectionRuntimeConfig delivers the GUIDs as runtime config only, unless the network disables the
+	// "infinibandGUID" capability
+	GUIDInjectionRuntimeConfig = "runtime-config"
+	// PKeyCNIArg network "cni-args" field holding the pkey resolved by ib-kubernetes, set for networks with the
+	// "infinibandPKey" capability
+	PKeyCNIArg = "pkey"
+	// InterfaceGUIDsCNIArg network "cni-args" field listing all the guids of an interface of a network requesting
+	// several guids per interface, the first one is the interface guid
+	InterfaceGUIDsCNIArg = "guids"
+	// MaxGUIDsPerInterface is the maximum number of guids a network can request per pod interface
+	MaxGUIDsPerInterface = 8
 )
 
+// InterfaceStatus is the status of a pod InfiniBand interface in the pod interfaces status annotation
+type InterfaceStatus struct {
+	Network string `json:"network"`
+	GUID    string `json:"guid"`
+	PKey    string `json:"pkey,omitempty"`
+	State   string `json:"state"`
+}
+
+// InfiniBandMetadata is the pod InfiniBand metadata annotation, the CNI can rely on it instead of looking up the
+// pod networks. Its version changes only on incompatible changes, new fields are optional.
+type InfiniBandMetadata struct {
+	Version string `json:"version"`
+	// Fabric is the name of the InfiniBand fabric of the cluster, if configured
+	Fabric string `json:"fabric,omitempty"`
+	// Interfaces by interface name
+	Interfaces map[string]InterfaceMetadata `json:"interfaces"`
+}
+
+// InterfaceMetadata is the InfiniBand metadata of a pod interface
+type InterfaceMetadata struct {
+	Network string `json:"network"`
+	GUID    string `json:"guid"`
+	// PKey the guid is a member of, with the membership
+	PKey       string `json:"pkey,omitempty"`
+	Membership string `json:"membership,omitempty"`
+	// LimitedPKey the guid is a limited member of in addition to its network pkey
+	LimitedPKey string `json:"limitedPKey,omitempty"`
+	// RDMAIsolation is set if the network advertises the "rdmaIsolation" capability
+	RDMAIsolation bool `json:"rdmaIsolation,omitempty"`
+}
+
 // PodWantsNetwork check if pod needs cni
 func PodWantsNetwork(pod *kapi.Pod) bool {
 	return !pod.Spec.HostNetwork
@@ -38,18 +152,158 @@ func HasNetworkAttachmentAnnot(pod *kapi.Pod) bool {
 	return len(pod.Annotations[v1.NetworkAttachmentAnnot]) > 0
 }
 
+// PodIsManaged check if pod's networks are managed by ib-kubernetes and not manually by the user
+func PodIsManaged(pod *kapi.Pod) bool {
+	return isManaged(pod.Annotations)
+}
+
+// NetworkIsManaged check if the network is managed by ib-kubernetes, a drained network is annotated as not managed
+func NetworkIsManaged(netAttDef *v1.NetworkAttachmentDefinition) bool {
+	return isManaged(netAttDef.Annotations)
+}
+
+func isManaged(annotations map[string]string) bool {
+	managed, ok := annotations[ManagedAnnotation]
+	return !ok || !strings.EqualFold(strings.TrimSpace(managed), "false")
+}
+
 // PodIsRunning check if pod is in "Running" state
 func PodIsRunning(pod *kapi.Pod) bool {
 	return pod.Status.Phase == kapi.PodRunning
 }
 
-// IsPodNetworkConfiguredWithInfiniBand check if pod is already InfiniBand supported
-func IsPodNetworkConfiguredWithInfiniBand(network *v1.NetworkSelectionElement) bool {
-	if network == nil || network.CNIArgs == nil {
+// NodeIsReady check if node has "Ready" condition set to true
+func NodeIsReady(node *kapi.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == kapi.NodeReady {
+			return condition.Status == kapi.ConditionTrue
+		}
+	}
+	return false
+}
+
+// IsPodNetworkConfiguredWithInfiniBand check if pod network is already InfiniBand supported, marked either in the
+// network "cni-args" or, for GUIDs delivered as runtime config only, in the pod configured networks annotation
+func IsPodNetworkConfiguredWithInfiniBand(pod *PodRef, network *v1.NetworkSelectionElement) bool {
+	if network == nil {
+		return false
+	}
+
+	if network.CNIArgs != nil && (*network.CNIArgs)[InfiniBandAnnotation] == ConfiguredInfiniBandPod {
+		return true
+	}
+
+	if pod == nil || network.InfinibandGUIDRequest == "" {
 		return false
 	}
+	name := ConfiguredNetworkName(network)
+	for _, configured := range strings.Split(pod.Annotations[ConfiguredNetworksAnnotation], ",") {
+		if configured == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfiguredNetworkName returns the name of the network in the pod configured networks annotation,
+// "<namespace>_<name>" with a "/<interface>" suffix if the network requests an interface name
+func ConfiguredNetworkName(network *v1.NetworkSelectionElement) string {
+	return ibTypes.NetworkInterfaceID{NetworkID: ibTypes.NetworkIDOf(network).String(),
+		Interface: network.InterfaceRequest}.String()
+}
+
+// PodNetworkInterfaceName returns the name of the pod interface of the network, the requested interface name or
+// "net<index>" as named by multus by the network position in the pod networks
+func PodNetworkInterfaceName(networks []*v1.NetworkSelectionElement, network *v1.NetworkSelectionElement) string {
+	if network.InterfaceRequest != "" {
+		return network.InterfaceRequest
+	}
+	for i, podNetwork := range networks {
+		if podNetwork == network {
+			return fmt.Sprintf("net%d", i+1)
+		}
+	}
+	return ""
+}
+
+// AssignInterfaceNames names the pod interfaces of the networks listed several times in the pod networks without
+// requested interface name, so each interface of the network is identified by its name rather than its position,
+// which may change if the pod annotation is reordered. They are named "net<index>" as multus names them, names
+// already requested by other networks aren't assigned. It returns true if any interface was named.
+func AssignInterfaceNames(networks []*v1.NetworkSelectionElement) bool {
+	listed := make(map[string]int)
+	requested := make(map[string]bool)
+	for _, network := range networks {
+		listed[ibTypes.NetworkIDOf(network).String()]++
+		if network.InterfaceRequest != "" {
+			requested[network.InterfaceRequest] = true
+		}
+	}
+
+	changed := false
+	for _, network := range networks {
+		if network.InterfaceRequest != "" || listed[ibTypes.NetworkIDOf(network).String()] < 2 {
+			continue
+		}
+		name := PodNetworkInterfaceName(networks, network)
+		if requested[name] {
+			continue
+		}
+		network.InterfaceRequest = name
+		requested[name] = true
+		changed = true
+	}
+	return changed
+}
+
+// ParseInterfacesStatus returns the pod interfaces status annotation by interface name
+func ParseInterfacesStatus(pod *PodRef) (map[string]InterfaceStatus, error) {
+	interfaces := make(map[string]InterfaceStatus)
+	annotation := pod.Annotations[InterfacesStatusAnnotation]
+	if annotation == "" {
+		return interfaces, nil
+	}
+	if err := json.Unmarshal([]byte(annotation), &interfaces); err != nil {
+		return nil, fmt.Errorf("failed to parse interfaces status annotation of pod namespace %s name %s: %v",
+			pod.Namespace, pod.Name, err)
+	}
+	return interfaces, nil
+}
+
+// ParseInfiniBandMetadata returns the pod InfiniBand metadata annotation, empty metadata of the current version if
+// the pod has none. It returns an error if the annotation is invalid or of another version.
+func ParseInfiniBandMetadata(pod *PodRef) (*InfiniBandMetadata, error) {
+	metadata := &InfiniBandMetadata{Version: InfiniBandMetadataVersion, Interfaces: make(map[string]InterfaceMetadata)}
+	annotation := pod.Annotations[InfiniBandMetadataAnnotation]
+	if annotation == "" {
+		return metadata, nil
+	}
+	if err := json.Unmarshal([]byte(annotation), metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse infiniband metadata annotation of pod namespace %s name %s: %v",
+			pod.Namespace, pod.Name, err)
+	}
+	if metadata.Version != InfiniBandMetadataVersion {
+		return nil, fmt.Errorf("unsupported infiniband metadata version %q of pod namespace %s name %s",
+			metadata.Version, pod.Namespace, pod.Name)
+	}
+	if metadata.Interfaces == nil {
+		metadata.Interfaces = make(map[string]InterfaceMetadata)
+	}
+	return metadata, nil
+}
 
-	return (*network.CNIArgs)[InfiniBandAnnotation] == ConfiguredInfiniBandPod
+// AddConfiguredNetwork returns the pod configured networks annotation value with the network added
+func AddConfiguredNetwork(annotation string, network *v1.NetworkSelectionElement) string {
+	name := ConfiguredNetworkName(network)
+	if annotation == "" {
+		return name
+	}
+	for _, configured := range strings.Split(annotation, ",") {
+		if configured == name {
+			return annotation
+		}
+	}
+	return annotation + "," + name
 }
 
 // PodNetworkHasGUID check if network cni-args has guid field
@@ -65,7 +319,7 @@ func GetPodNetworkGUID(network *v1.NetworkSelectionElement) (string, error) {
 	}
 
 	if network.InfinibandGUIDRequest != "" {
-		return network.InfinibandGUIDRequest, nil
+		return normalizeGUID(network.InfinibandGUIDRequest), nil
 	}
 
 	if network.CNIArgs == nil {
@@ -80,7 +334,106 @@ func GetPodNetworkGUID(network *v1.NetworkSelectionElement) (string, error) {
 			"no \"guid\" field in \"cni-arg\" or \"infinibandGUID\" runtime config in network %+v", network)
 	}
 
-	return fmt.Sprintf("%s", guid), nil
+	return normalizeGUID(fmt.Sprintf("%s", guid)), nil
+}
+
+// normalizeGUID returns the canonical form of the guid, invalid guids are returned as is to be rejected by
+// their users
+func normalizeGUID(guid string) string {
+	if normalized, err := ibUtils.NormalizeGUID(guid); err == nil {
+		return normalized
+	}
+	return guid
+}
+
+// NormalizePodNetworkGUIDs rewrites the guids of the network, its runtime config and cni-args guids, in their
+// canonical form, e.g. guids written in upper case by users or older versions. It returns true if any guid was
+// rewritten, so the pod networks annotation is migrated.
+func NormalizePodNetworkGUIDs(network *v1.NetworkSelectionElement) bool {
+	if network == nil {
+		return false
+	}
+
+	changed := false
+	if normalized := normalizeGUID(network.InfinibandGUIDRequest); normalized != network.InfinibandGUIDRequest {
+		network.InfinibandGUIDRequest = normalized
+		changed = true
+	}
+	if network.CNIArgs == nil {
+		return changed
+	}
+
+	cniArgs := *network.CNIArgs
+	if guid, ok := cniArgs["guid"].(string); ok && normalizeGUID(guid) != guid {
+		cniArgs["guid"] = normalizeGUID(guid)
+		changed = true
+	}
+	switch listed := cniArgs[InterfaceGUIDsCNIArg].(type) {
+	case []interface{}:
+		for index, listedGUID := range listed {
+			if guid, isString := listedGUID.(string); isString && normalizeGUID(guid) != guid {
+				listed[index] = normalizeGUID(guid)
+				changed = true
+			}
+		}
+	case []string:
+		for index, guid := range listed {
+			if normalizeGUID(guid) != guid {
+				listed[index] = normalizeGUID(guid)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// GetPodNetworkGUIDs returns the guids of the network interface, the interface guid followed by the additional
+// guids listed in the "guids" cni-arg of networks requesting several guids per interface
+func GetPodNetworkGUIDs(network *v1.NetworkSelectionElement) ([]string, error) {
+	interfaceGUID, err := GetPodNetworkGUID(network)
+	if err != nil {
+		return nil, err
+	}
+
+	guids := []string{interfaceGUID}
+	if network.CNIArgs == nil {
+		return guids, nil
+	}
+	listed, ok := (*network.CNIArgs)[InterfaceGUIDsCNIArg].([]interface{})
+	if !ok {
+		if listedStrings, isStrings := (*network.CNIArgs)[InterfaceGUIDsCNIArg].([]string); isStrings {
+			for _, listedGUID := range listedStrings {
+				listed = append(listed, listedGUID)
+			}
+		}
+	}
+	for _, listedGUID := range listed {
+		guidStr := normalizeGUID(fmt.Sprintf("%s", listedGUID))
+		if guidStr != interfaceGUID {
+			guids = append(guids, guidStr)
+		}
+	}
+	return guids, nil
+}
+
+// SetPodNetworkInterfaceGUIDs sets the "guids" cni-arg listing all the guids of the network interface, the
+// interface guid first. The cni-arg is removed if the interface has a single guid.
+func SetPodNetworkInterfaceGUIDs(network *v1.NetworkSelectionElement, guids []string) error {
+	if network == nil {
+		return fmt.Errorf("invalid network value: nil")
+	}
+
+	if len(guids) <= 1 {
+		if network.CNIArgs != nil {
+			delete(*network.CNIArgs, InterfaceGUIDsCNIArg)
+		}
+		return nil
+	}
+	if network.CNIArgs == nil {
+		network.CNIArgs = &map[string]interface{}{}
+	}
+	(*network.CNIArgs)[InterfaceGUIDsCNIArg] = guids
+	return nil
 }
 
 // SetPodNetworkGUID set network cni-args guid
@@ -102,49 +455,153 @@ func SetPodNetworkGUID(network *v1.NetworkSelectionElement, guid string, setAsRu
 	return nil
 }
 
+// IbSriovCniConfig is the ib-sriov cni spec of a network with its position in the full network config
+type IbSriovCniConfig struct {
+	Spec *IbSriovCniSpec
+	// Config is the full network config, e.g. the conflist or multus config holding the ib-sriov plugin
+	Config map[string]interface{}
+	// Plugin is the ib-sriov plugin config within Config
+	Plugin map[string]interface{}
+	// Path is the JSON pointer of Plugin in Config, e.g. "/plugins/1" or "/delegates/0/plugins/1", empty if the
+	// network config is the ib-sriov plugin itself
+	Path string
+}
+
+// nestedCniConfigFields are the network config fields holding nested cni configs, the "plugins" of conflists
+// and the "delegates" of multus configs
+var nestedCniConfigFields = []string{"plugins", "delegates"}
+
 // GetIbSriovCniFromNetwork check if network uses IB-SR-IOV-CNi
 func GetIbSriovCniFromNetwork(networkSpec map[string]interface{}) (*IbSriovCniSpec, error) {
+	ibConfig, err := FindIbSriovCniInNetwork(networkSpec)
+	if err != nil {
+		return nil, err
+	}
+	return ibConfig.Spec, nil
+}
+
+// FindIbSriovCniInNetwork returns the ib-sriov cni spec of the network, either the network itself or the first
+// ib-sriov plugin nested in its "plugins" or "delegates", at any depth, with the full network config and the
+// position of the plugin in it
+func FindIbSriovCniInNetwork(networkSpec map[string]interface{}) (*IbSriovCniConfig, error) {
 	if networkSpec == nil {
 		return nil, fmt.Errorf("empty network spec")
 	}
 
-	if networkSpec["type"] == InfiniBandSriovCni {
-		var ibSpec IbSriovCniSpec
-		data, err := json.Marshal(networkSpec)
-		if err != nil {
-			return nil, err
+	// the network spec is normalized into json values, so nested configs are maps whatever their go type
+	data, err := json.Marshal(networkSpec)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]interface{}
+	if err = json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	plugin, path, err := findIbSriovCniConfig(config, "")
+	if err != nil {
+		return nil, err
+	}
+	if plugin == nil {
+		if !hasNestedCniConfigs(config) {
+			return nil, fmt.Errorf(
+				"network spec type \"%s\" is not supported and \"plugins\" or \"delegates\" field not found, "+
+					"supported type \"ib-sriov\"",
+				networkSpec["type"])
+		}
+		return nil, fmt.Errorf("cni plugin ib-sriov not found")
+	}
+
+	if data, err = json.Marshal(plugin); err != nil {
+		return nil, err
+	}
+	var ibSpec IbSriovCniSpec
+	if err = json.Unmarshal(data, &ibSpec); err != nil {
+		return nil, err
+	}
+	ibSpec.normalizePKey()
+	return &IbSriovCniConfig{Spec: &ibSpec, Config: config, Plugin: plugin, Path: path}, nil
+}
+
+// findIbSriovCniConfig returns the first ib-sriov plugin config, depth first, of the cni config at the given path
+// and its nested cni configs, nil if there is none
+func findIbSriovCniConfig(config map[string]interface{}, path string) (map[string]interface{}, string, error) {
+	if config["type"] == InfiniBandSriovCni {
+		return config, path, nil
+	}
+
+	for _, field := range nestedCniConfigFields {
+		value, exist := config[field]
+		if !exist {
+			continue
+		}
+		nested, ok := value.([]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("invalid \"%s\" field at \"%s\", expected a list of cni configs", field, path)
 		}
-		if err := json.Unmarshal(data, &ibSpec); err != nil {
-			return nil, err
+		for index, nestedValue := range nested {
+			nestedPath := fmt.Sprintf("%s/%s/%d", path, field, index)
+			nestedConfig, ok := nestedValue.(map[string]interface{})
+			if !ok {
+				return nil, "", fmt.Errorf("invalid cni config at \"%s\", expected an object", nestedPath)
+			}
+			plugin, pluginPath, err := findIbSriovCniConfig(nestedConfig, nestedPath)
+			if err != nil || plugin != nil {
+				return plugin, pluginPath, err
+			}
 		}
-		return &ibSpec, nil
 	}
+	return nil, "", nil
+}
 
-	pluginsValue, ok := networkSpec["plugins"]
-	if !ok {
-		return nil, fmt.Errorf(
-			"network spec type \"%s\" is not supported and \"plugins\" field not found, "+
-				"supported type \"ib-sriov\"",
-			networkSpec["type"])
+func hasNestedCniConfigs(config map[string]interface{}) bool {
+	for _, field := range nestedCniConfigFields {
+		if _, exist := config[field]; exist {
+			return true
+		}
 	}
+	return false
+}
+
+// normalizePKey replaces the "default" pkey of the spec with the default partition pkey, and bare hex or decimal
+// pkeys with their hex form leading by 0x. Invalid pkeys are kept, so they are reported where the pkey is parsed.
+func (s *IbSriovCniSpec) normalizePKey() {
+	if s.PKey == DefaultPKeyName {
+		s.PKey = ibUtils.FormatPKey(ibUtils.DefaultPKey)
+		return
+	}
+	if pKey, err := ibUtils.NormalizePKey(s.PKey); err == nil {
+		s.PKey = pKey
+	}
+}
 
-	pluginsData, err := json.Marshal(pluginsValue)
+// ParsePodNetworks returns the networks of the pod network annotation, networks without a namespace default
+// to the pod's namespace as defined by the NPWG spec
+func ParsePodNetworks(pod *PodRef) ([]*v1.NetworkSelectionElement, error) {
+	networks, err := netAttUtils.ParsePodNetworkAnnotation(&kapi.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: pod.Name, Namespace: pod.Namespace, Annotations: pod.Annotations}})
 	if err != nil {
 		return nil, err
 	}
 
-	var plugins []*IbSriovCniSpec
-	if err := json.Unmarshal(pluginsData, &plugins); err != nil {
-		return nil, err
+	for _, network := range networks {
+		if network.Namespace == "" {
+			network.Namespace = pod.Namespace
+		}
 	}
+	return networks, nil
+}
 
-	for _, plugin := range plugins {
-		if plugin.Type == InfiniBandSriovCni {
-			return plugin, nil
+// GetPodNetworkByID returns the pod network with the given network ID as encoded by ibTypes.NetworkID
+func GetPodNetworkByID(networks []*v1.NetworkSelectionElement, networkID string) (*v1.NetworkSelectionElement,
+	error) {
+	for _, network := range networks {
+		if ibTypes.NetworkIDOf(network).String() == networkID {
+			return network, nil
 		}
 	}
 
-	return nil, fmt.Errorf("cni plugin ib-sriov not found")
+	return nil, fmt.Errorf("network %s not found", networkID)
 }
 
 func GetPodNetwork(networks []*v1.NetworkSelectionElement, networkName string) (*v1.NetworkSelectionElement, error) {
@@ -157,36 +614,46 @@ func GetPodNetwork(networks []*v1.NetworkSelectionElement, networkName string) (
 	return nil, fmt.Errorf("network %s not found", networkName)
 }
 
-// ParsePKey returns parsed PKey from string
-func ParsePKey(pKey string) (int, error) {
-	match := regexp.MustCompile(`0[xX]\d+`)
-	if !match.MatchString(pKey) {
-		return 0, fmt.Errorf("invalid pkey %s, should be leading by 0x ", pKey)
-	}
-
-	i, err := strconv.ParseUint(pKey[2:], 16, 32)
-	if err != nil {
-		return 0, err
-	}
+// PodNetworkKey identifies the pod network interface a GUID is allocated for
+type PodNetworkKey struct {
+	PodUID types.UID
+	// NetworkID is the network ID as encoded by ibTypes.NetworkID
+	NetworkID string
+	// Interface is the pod interface name requested for the network, empty if not requested
+	Interface string
+}
 
-	return int(i), nil
+// GeneratePodNetworkKey returns the key of the given pod network interface
+func GeneratePodNetworkKey(pod *PodRef, network *v1.NetworkSelectionElement) PodNetworkKey {
+	return PodNetworkKey{PodUID: pod.UID, NetworkID: ibTypes.NetworkIDOf(network).String(),
+		Interface: network.InterfaceRequest}
 }
 
-// ParseNetworkID returns the network name and network namespace
-func ParseNetworkID(networkID string) (string, string, error) {
-	const expectedLen = 2
-	idArray := strings.Split(networkID, "_")
-	if len(idArray) != expectedLen {
-		return "", "", fmt.Errorf("invalid networkID %s, should be <networkNamespace>_<networkName>", networkID)
+func (k PodNetworkKey) String() string {
+	podNetworkID := ibTypes.PodNetworkID{PodUID: k.PodUID, NetworkID: k.NetworkID}.String()
+	if k.Interface == "" {
+		return podNetworkID
 	}
-	return idArray[0], idArray[1], nil
+	return podNetworkID + "/" + k.Interface
 }
 
-// GenerateNetworkID returns the network name and network namespace with . separation
-func GenerateNetworkID(network *v1.NetworkSelectionElement) string {
-	return fmt.Sprintf("%s_%s", network.Namespace, network.Name)
+// HasFinalizer check if the finalizer exists in the given finalizers
+func HasFinalizer(finalizers []string, finalizer string) bool {
+	for _, f := range finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
 }
 
-func GeneratePodNetworkID(pod *kapi.Pod, networkID string) string {
-	return string(pod.UID) + "_" + networkID
+// RemoveFinalizer returns the finalizers without the given finalizer
+func RemoveFinalizer(finalizers []string, finalizer string) []string {
+	result := make([]string, 0, len(finalizers))
+	for _, f := range finalizers {
+		if f != finalizer {
+			result = append(result, f)
+		}
+	}
+	return result
 }
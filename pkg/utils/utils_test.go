@@ -1,11 +1,15 @@
 package utils
 
 import (
+	"encoding/json"
+
 	v1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	kapi "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ibTypes "github.com/Mellanox/ib-kubernetes/pkg/types"
 )
 
 var _ = Describe("Utils", func() {
@@ -28,24 +32,185 @@ var _ = Describe("Utils", func() {
 			Expect(HasNetworkAttachmentAnnot(pod)).To(BeTrue())
 		})
 	})
+	Context("PodIsManaged", func() {
+		It("Pod without managed annotation is managed", func() {
+			pod := &kapi.Pod{}
+			Expect(PodIsManaged(pod)).To(BeTrue())
+		})
+		It("Pod with managed annotation set to true is managed", func() {
+			pod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{ManagedAnnotation: "true"}}}
+			Expect(PodIsManaged(pod)).To(BeTrue())
+		})
+		It("Pod with managed annotation set to false is not managed", func() {
+			pod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{ManagedAnnotation: "False"}}}
+			Expect(PodIsManaged(pod)).To(BeFalse())
+		})
+	})
+	Context("NetworkIsManaged", func() {
+		It("Network with managed annotation set to false is not managed", func() {
+			netAttDef := &v1.NetworkAttachmentDefinition{}
+			Expect(NetworkIsManaged(netAttDef)).To(BeTrue())
+			netAttDef.Annotations = map[string]string{ManagedAnnotation: " false "}
+			Expect(NetworkIsManaged(netAttDef)).To(BeFalse())
+		})
+	})
 	Context("PodIsRunning", func() {
 		It("Check pod if pod is is in running phase", func() {
 			pod := &kapi.Pod{Status: kapi.PodStatus{Phase: kapi.PodRunning}}
 			Expect(PodIsRunning(pod)).To(BeTrue())
 		})
 	})
+	Context("PodRef", func() {
+		It("Keep the pod fields read by the daemon only", func() {
+			priority := int32(10)
+			pod := &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-0", Namespace: "default", UID: "uid",
+				ResourceVersion: "5", Annotations: map[string]string{v1.NetworkAttachmentAnnot: `[{"name":"test"}]`,
+					"kubectl.kubernetes.io/last-applied-configuration": "{}"},
+				OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "other"},
+					{Kind: "StatefulSet", Name: "pod", Controller: &[]bool{true}[0]}},
+				ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubelet"}}},
+				Spec: kapi.PodSpec{NodeName: "node1", ServiceAccountName: "sa", Priority: &priority,
+					Containers: []kapi.Container{{Name: "test"}}},
+				Status: kapi.PodStatus{Phase: kapi.PodRunning}}
+
+			podRef := NewPodRef(pod)
+			Expect(podRef.Name).To(Equal("pod-0"))
+			Expect(podRef.Namespace).To(Equal("default"))
+			Expect(podRef.UID).To(BeEquivalentTo("uid"))
+			Expect(podRef.ResourceVersion).To(Equal("5"))
+			Expect(podRef.NodeName).To(Equal("node1"))
+			Expect(podRef.ServiceAccountName).To(Equal("sa"))
+			Expect(*podRef.Priority).To(BeEquivalentTo(10))
+			Expect(podRef.Controller.Kind).To(Equal("StatefulSet"))
+			Expect(podRef.Annotations).To(Equal(map[string]string{v1.NetworkAttachmentAnnot: `[{"name":"test"}]`}))
+
+			// the annotations are copied
+			podRef.Annotations[v1.NetworkAttachmentAnnot] = "[]"
+			Expect(pod.Annotations[v1.NetworkAttachmentAnnot]).To(Equal(`[{"name":"test"}]`))
+
+			refPod := podRef.Pod()
+			Expect(refPod.Name).To(Equal("pod-0"))
+			Expect(refPod.UID).To(BeEquivalentTo("uid"))
+			Expect(metav1.GetControllerOf(refPod).Name).To(Equal("pod"))
+		})
+	})
+	Context("NodeIsReady", func() {
+		It("Node with ready condition", func() {
+			node := &kapi.Node{Status: kapi.NodeStatus{Conditions: []kapi.NodeCondition{
+				{Type: kapi.NodeMemoryPressure, Status: kapi.ConditionFalse},
+				{Type: kapi.NodeReady, Status: kapi.ConditionTrue}}}}
+			Expect(NodeIsReady(node)).To(BeTrue())
+		})
+		It("Node with not ready condition", func() {
+			node := &kapi.Node{Status: kapi.NodeStatus{Conditions: []kapi.NodeCondition{
+				{Type: kapi.NodeReady, Status: kapi.ConditionUnknown}}}}
+			Expect(NodeIsReady(node)).To(BeFalse())
+		})
+		It("Node without ready condition", func() {
+			Expect(NodeIsReady(&kapi.Node{})).To(BeFalse())
+		})
+	})
 	Context("IsPodNetworkConfiguredWithInfiniBand", func() {
 		It("Pod network is InfiniBand configured", func() {
 			network := &v1.NetworkSelectionElement{CNIArgs: &map[string]interface{}{
 				InfiniBandAnnotation: ConfiguredInfiniBandPod}}
-			Expect(IsPodNetworkConfiguredWithInfiniBand(network)).To(BeTrue())
+			Expect(IsPodNetworkConfiguredWithInfiniBand(nil, network)).To(BeTrue())
 		})
 		It("Pod network is not InfiniBand configured", func() {
 			network := &v1.NetworkSelectionElement{CNIArgs: &map[string]interface{}{InfiniBandAnnotation: ""}}
-			Expect(IsPodNetworkConfiguredWithInfiniBand(network)).To(BeFalse())
+			Expect(IsPodNetworkConfiguredWithInfiniBand(&PodRef{}, network)).To(BeFalse())
+		})
+		It("Pod network with runtime config guid is InfiniBand configured", func() {
+			network := &v1.NetworkSelectionElement{Name: "test", Namespace: "default", InterfaceRequest: "net1",
+				InfinibandGUIDRequest: "02:00:00:00:00:00:00:00"}
+			pod := &PodRef{Annotations: map[string]string{
+				ConfiguredNetworksAnnotation: "default_other,default_test/net1"}}
+			Expect(IsPodNetworkConfiguredWithInfiniBand(pod, network)).To(BeTrue())
+
+			network.InterfaceRequest = "net2"
+			Expect(IsPodNetworkConfiguredWithInfiniBand(pod, network)).To(BeFalse())
+		})
+		It("Pod network with runtime config guid without configured networks annotation", func() {
+			network := &v1.NetworkSelectionElement{Name: "test", Namespace: "default",
+				InfinibandGUIDRequest: "02:00:00:00:00:00:00:00"}
+			Expect(IsPodNetworkConfiguredWithInfiniBand(&PodRef{}, network)).To(BeFalse())
+			Expect(IsPodNetworkConfiguredWithInfiniBand(nil, network)).To(BeFalse())
 		})
 		It("Nil network", func() {
-			Expect(IsPodNetworkConfiguredWithInfiniBand(nil)).To(BeFalse())
+			Expect(IsPodNetworkConfiguredWithInfiniBand(&PodRef{}, nil)).To(BeFalse())
+		})
+	})
+	Context("AddConfiguredNetwork", func() {
+		It("Add network to configured networks annotation", func() {
+			network := &v1.NetworkSelectionElement{Name: "test", Namespace: "default"}
+			Expect(AddConfiguredNetwork("", network)).To(Equal("default_test"))
+			Expect(AddConfiguredNetwork("default_other", network)).To(Equal("default_other,default_test"))
+			Expect(AddConfiguredNetwork("default_test,default_other", network)).To(
+				Equal("default_test,default_other"))
+		})
+	})
+	Context("Interfaces status", func() {
+		It("Name the interface of a pod network", func() {
+			first := &v1.NetworkSelectionElement{Name: "first", Namespace: "default"}
+			second := &v1.NetworkSelectionElement{Name: "second", Namespace: "default"}
+			named := &v1.NetworkSelectionElement{Name: "named", Namespace: "default", InterfaceRequest: "ib0"}
+			networks := []*v1.NetworkSelectionElement{first, second, named}
+			Expect(PodNetworkInterfaceName(networks, first)).To(Equal("net1"))
+			Expect(PodNetworkInterfaceName(networks, second)).To(Equal("net2"))
+			Expect(PodNetworkInterfaceName(networks, named)).To(Equal("ib0"))
+		})
+		It("Name the interfaces of the networks listed several times", func() {
+			networks := []*v1.NetworkSelectionElement{{Name: "ib-net", Namespace: "default"},
+				{Name: "other", Namespace: "default"}, {Name: "ib-net", Namespace: "default"},
+				{Name: "ib-net", Namespace: "default", InterfaceRequest: "ib0"},
+				{Name: "dup", Namespace: "default", InterfaceRequest: "net6"}, {Name: "dup", Namespace: "default"}}
+			Expect(AssignInterfaceNames(networks)).To(BeTrue())
+			Expect(networks[0].InterfaceRequest).To(Equal("net1"))
+			Expect(networks[1].InterfaceRequest).To(BeEmpty())
+			Expect(networks[2].InterfaceRequest).To(Equal("net3"))
+			Expect(networks[3].InterfaceRequest).To(Equal("ib0"))
+			// the name multus would give is already requested by another interface
+			Expect(networks[5].InterfaceRequest).To(BeEmpty())
+
+			Expect(AssignInterfaceNames(networks)).To(BeFalse())
+		})
+		It("Parse the interfaces status annotation of a pod", func() {
+			pod := &PodRef{Annotations: map[string]string{
+				InterfacesStatusAnnotation: `{"net1": {"network": "default_test", "guid": "02:00:00:00:00:00:00:01",` +
+					` "pkey": "0x5", "state": "configured"}}`}}
+			interfaces, err := ParseInterfacesStatus(pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(interfaces).To(Equal(map[string]InterfaceStatus{"net1": {Network: "default_test",
+				GUID: "02:00:00:00:00:00:00:01", PKey: "0x5", State: InterfaceStateConfigured}}))
+
+			pod.Annotations[InterfacesStatusAnnotation] = "invalid"
+			_, err = ParseInterfacesStatus(pod)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Parse the infiniband metadata annotation of a pod", func() {
+			pod := &PodRef{Annotations: map[string]string{}}
+			metadata, err := ParseInfiniBandMetadata(pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metadata).To(Equal(&InfiniBandMetadata{Version: InfiniBandMetadataVersion,
+				Interfaces: map[string]InterfaceMetadata{}}))
+
+			pod.Annotations[InfiniBandMetadataAnnotation] = `{"version": "v1", "fabric": "fabric-a", "interfaces": ` +
+				`{"net1": {"network": "default_test", "guid": "02:00:00:00:00:00:00:01", "pkey": "0x5", ` +
+				`"membership": "full"}}}`
+			metadata, err = ParseInfiniBandMetadata(pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metadata.Fabric).To(Equal("fabric-a"))
+			Expect(metadata.Interfaces).To(Equal(map[string]InterfaceMetadata{"net1": {Network: "default_test",
+				GUID: "02:00:00:00:00:00:00:01", PKey: "0x5", Membership: MembershipFull}}))
+
+			pod.Annotations[InfiniBandMetadataAnnotation] = `{"version": "v2", "interfaces": {}}`
+			_, err = ParseInfiniBandMetadata(pod)
+			Expect(err).To(HaveOccurred())
+			pod.Annotations[InfiniBandMetadataAnnotation] = "invalid"
+			_, err = ParseInfiniBandMetadata(pod)
+			Expect(err).To(HaveOccurred())
 		})
 	})
 	Context("GetPodNetworkGUID", func() {
@@ -146,6 +311,70 @@ var _ = Describe("Utils", func() {
 			Expect(err).To(HaveOccurred())
 		})
 	})
+	Context("GUID normalization", func() {
+		It("Get the pod network guids in their canonical form", func() {
+			network := &v1.NetworkSelectionElement{CNIArgs: &map[string]interface{}{
+				"guid":  "02:00:0F:F0:00:00:00:01",
+				"guids": []interface{}{"02:00:0F:F0:00:00:00:01", "02000FF000000002"}}}
+			guids, err := GetPodNetworkGUIDs(network)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guids).To(Equal([]string{"02:00:0f:f0:00:00:00:01", "02:00:0f:f0:00:00:00:02"}))
+
+			network = &v1.NetworkSelectionElement{InfinibandGUIDRequest: "02:00:0F:F0:00:00:00:01"}
+			guid, err := GetPodNetworkGUID(network)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guid).To(Equal("02:00:0f:f0:00:00:00:01"))
+		})
+		It("Migrate the pod network guids to their canonical form", func() {
+			network := &v1.NetworkSelectionElement{InfinibandGUIDRequest: "02:00:0F:F0:00:00:00:01",
+				CNIArgs: &map[string]interface{}{"guid": "02:00:0F:F0:00:00:00:01",
+					"guids": []interface{}{"02:00:0F:F0:00:00:00:01", "invalid"}}}
+			Expect(NormalizePodNetworkGUIDs(network)).To(BeTrue())
+			Expect(network.InfinibandGUIDRequest).To(Equal("02:00:0f:f0:00:00:00:01"))
+			Expect((*network.CNIArgs)["guid"]).To(Equal("02:00:0f:f0:00:00:00:01"))
+			Expect((*network.CNIArgs)["guids"]).To(Equal([]interface{}{"02:00:0f:f0:00:00:00:01", "invalid"}))
+
+			Expect(NormalizePodNetworkGUIDs(network)).To(BeFalse())
+		})
+	})
+	Context("Interface GUIDs", func() {
+		It("Get the interface guid followed by the additional guids", func() {
+			network := &v1.NetworkSelectionElement{CNIArgs: &map[string]interface{}{
+				"guid":  "02:00:00:00:00:00:00:01",
+				"guids": []interface{}{"02:00:00:00:00:00:00:01", "02:00:00:00:00:00:00:02"}}}
+			guids, err := GetPodNetworkGUIDs(network)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guids).To(Equal([]string{"02:00:00:00:00:00:00:01", "02:00:00:00:00:00:00:02"}))
+
+			network = &v1.NetworkSelectionElement{InfinibandGUIDRequest: "02:00:00:00:00:00:00:01"}
+			guids, err = GetPodNetworkGUIDs(network)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guids).To(Equal([]string{"02:00:00:00:00:00:00:01"}))
+
+			_, err = GetPodNetworkGUIDs(&v1.NetworkSelectionElement{})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Set and remove the guids of the interface", func() {
+			network := &v1.NetworkSelectionElement{InfinibandGUIDRequest: "02:00:00:00:00:00:00:01"}
+			Expect(SetPodNetworkInterfaceGUIDs(network, []string{"02:00:00:00:00:00:00:01",
+				"02:00:00:00:00:00:00:02"})).To(Succeed())
+			guids, err := GetPodNetworkGUIDs(network)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(guids).To(Equal([]string{"02:00:00:00:00:00:00:01", "02:00:00:00:00:00:00:02"}))
+
+			Expect(SetPodNetworkInterfaceGUIDs(network, []string{"02:00:00:00:00:00:00:01"})).To(Succeed())
+			Expect(*network.CNIArgs).ToNot(HaveKey(InterfaceGUIDsCNIArg))
+			Expect(SetPodNetworkInterfaceGUIDs(nil, nil)).ToNot(Succeed())
+		})
+		It("Get the number of guids per interface of the network", func() {
+			ibSpec, err := GetIbSriovCniFromNetwork(map[string]interface{}{"type": InfiniBandSriovCni,
+				"guidsPerInterface": 2})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibSpec.InterfaceGUIDs()).To(Equal(2))
+			Expect((&IbSriovCniSpec{}).InterfaceGUIDs()).To(Equal(1))
+			Expect((&IbSriovCniSpec{GUIDsPerInterface: 100}).InterfaceGUIDs()).To(Equal(MaxGUIDsPerInterface))
+		})
+	})
 	Context("GetIbSriovCniFromNetwork", func() {
 		It("Get Ib SR-IOV Spec from \"type\" field", func() {
 			spec := map[string]interface{}{"type": InfiniBandSriovCni}
@@ -160,6 +389,82 @@ var _ = Describe("Utils", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(ibSpec.Type).To(Equal(InfiniBandSriovCni))
 		})
+		It("Get Ib SR-IOV Spec with \"default\" pkey", func() {
+			spec := map[string]interface{}{"type": InfiniBandSriovCni, "pkey": DefaultPKeyName}
+			ibSpec, err := GetIbSriovCniFromNetwork(spec)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibSpec.PKey).To(Equal("0x7FFF"))
+
+			plugins := []*IbSriovCniSpec{{Type: InfiniBandSriovCni, PKey: DefaultPKeyName}}
+			ibSpec, err = GetIbSriovCniFromNetwork(map[string]interface{}{"plugins": plugins})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibSpec.PKey).To(Equal("0x7FFF"))
+		})
+		It("Get Ib SR-IOV Spec with bare hex and decimal pkeys", func() {
+			for pKey, expected := range map[string]string{"7fff": "0x7FFF", "32773": "0x8005", "0x5": "0x5",
+				AutoPKey: AutoPKey, "0x5g": "0x5g"} {
+				ibSpec, err := GetIbSriovCniFromNetwork(map[string]interface{}{"type": InfiniBandSriovCni,
+					"pkey": pKey})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ibSpec.PKey).To(Equal(expected), pKey)
+			}
+		})
+		It("Get Ib SR-IOV Spec capabilities", func() {
+			ibSpec, err := GetIbSriovCniFromNetwork(map[string]interface{}{"type": InfiniBandSriovCni,
+				"capabilities": map[string]interface{}{"infinibandGUID": false, "infinibandPKey": true,
+					"rdmaIsolation": true, "ips": true}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibSpec.Capabilities.InfiniBandGUID).To(HaveValue(BeFalse()))
+			Expect(ibSpec.Capabilities.PKeyInCNIArgs()).To(BeTrue())
+			Expect(ibSpec.Capabilities.IsRDMAIsolated()).To(BeTrue())
+
+			ibSpec, err = GetIbSriovCniFromNetwork(map[string]interface{}{"type": InfiniBandSriovCni})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibSpec.Capabilities.InfiniBandGUID).To(BeNil())
+			Expect(ibSpec.Capabilities.PKeyInCNIArgs()).To(BeFalse())
+			Expect(ibSpec.Capabilities.IsRDMAIsolated()).To(BeFalse())
+		})
+		It("Find Ib SR-IOV Spec in conflist with its position", func() {
+			config := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(`{"cniVersion": "0.3.1", "name": "ib-net", "plugins": [
+				{"type": "tuning"}, {"type": "ib-sriov", "pkey": "0x5"}, {"type": "ib-sriov", "pkey": "0x6"}]}`),
+				&config)).To(Succeed())
+
+			ibConfig, err := FindIbSriovCniInNetwork(config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibConfig.Spec.PKey).To(Equal("0x5"))
+			Expect(ibConfig.Path).To(Equal("/plugins/1"))
+			Expect(ibConfig.Config).To(Equal(config))
+			Expect(ibConfig.Plugin).To(Equal(config["plugins"].([]interface{})[1]))
+
+			ibConfig, err = FindIbSriovCniInNetwork(map[string]interface{}{"type": InfiniBandSriovCni})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibConfig.Path).To(BeEmpty())
+		})
+		It("Find Ib SR-IOV Spec nested in delegates", func() {
+			config := map[string]interface{}{}
+			Expect(json.Unmarshal([]byte(`{"name": "multus", "type": "multus", "delegates": [
+				{"type": "bridge"},
+				{"cniVersion": "0.3.1", "plugins": [{"type": "tuning"}, {"type": "ib-sriov", "pkey": "7fff"}]}]}`),
+				&config)).To(Succeed())
+
+			ibConfig, err := FindIbSriovCniInNetwork(config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibConfig.Spec.PKey).To(Equal("0x7FFF"))
+			Expect(ibConfig.Path).To(Equal("/delegates/1/plugins/1"))
+
+			ibSpec, err := GetIbSriovCniFromNetwork(config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ibSpec).To(Equal(ibConfig.Spec))
+		})
+		It("Find Ib SR-IOV Spec with invalid nested configs", func() {
+			_, err := FindIbSriovCniInNetwork(map[string]interface{}{"delegates": []interface{}{"invalid"}})
+			Expect(err).To(MatchError(ContainSubstring("/delegates/0")))
+
+			_, err = FindIbSriovCniInNetwork(map[string]interface{}{"delegates": []interface{}{
+				map[string]interface{}{"plugins": "invalid"}}})
+			Expect(err).To(MatchError(ContainSubstring("/delegates/0")))
+		})
 		It("Get Ib SR-IOV Spec from invalid network spec", func() {
 			ibSpec, err := GetIbSriovCniFromNetwork(nil)
 			Expect(err).To(HaveOccurred())
@@ -185,4 +490,63 @@ var _ = Describe("Utils", func() {
 			Expect(ibSpec).To(BeNil())
 		})
 	})
+	Context("Finalizers", func() {
+		It("Check and remove finalizer", func() {
+			finalizers := []string{"first", "second"}
+			Expect(HasFinalizer(finalizers, "second")).To(BeTrue())
+			Expect(HasFinalizer(finalizers, "third")).To(BeFalse())
+			Expect(RemoveFinalizer(finalizers, "second")).To(Equal([]string{"first"}))
+			Expect(RemoveFinalizer(finalizers, "third")).To(Equal(finalizers))
+		})
+	})
+	Context("GeneratePodNetworkKey", func() {
+		It("Generate key of pod network with and without interface", func() {
+			pod := &PodRef{UID: "pod-uid"}
+			network := &v1.NetworkSelectionElement{Name: "ib-net", Namespace: "default"}
+
+			key := GeneratePodNetworkKey(pod, network)
+			Expect(key).To(Equal(PodNetworkKey{PodUID: "pod-uid", NetworkID: "default_ib-net"}))
+			Expect(key.String()).To(Equal("pod-uid/default_ib-net"))
+
+			network.InterfaceRequest = "net1"
+			key = GeneratePodNetworkKey(pod, network)
+			Expect(key.Interface).To(Equal("net1"))
+			Expect(key.String()).To(Equal("pod-uid/default_ib-net/net1"))
+		})
+	})
+	Context("ParsePodNetworks", func() {
+		It("Default networks without namespace to the pod namespace", func() {
+			pod := &PodRef{Namespace: "foo", Annotations: map[string]string{
+				v1.NetworkAttachmentAnnot: `[{"name": "ib-net"}, {"name": "ib-net", "namespace": "bar"}]`}}
+
+			networks, err := ParsePodNetworks(pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(networks).To(HaveLen(2))
+			Expect(ibTypes.NetworkIDOf(networks[0]).String()).To(Equal("foo_ib-net"))
+			Expect(ibTypes.NetworkIDOf(networks[1]).String()).To(Equal("bar_ib-net"))
+		})
+		It("Default networks of comma separated annotation to the pod namespace", func() {
+			pod := &PodRef{Namespace: "foo", Annotations: map[string]string{
+				v1.NetworkAttachmentAnnot: "ib-net,bar/ib-net"}}
+
+			networks, err := ParsePodNetworks(pod)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(networks).To(HaveLen(2))
+			Expect(ibTypes.NetworkIDOf(networks[0]).String()).To(Equal("foo_ib-net"))
+			Expect(ibTypes.NetworkIDOf(networks[1]).String()).To(Equal("bar_ib-net"))
+		})
+	})
+	Context("GetPodNetworkByID", func() {
+		It("Get pod network of the network namespace", func() {
+			networks := []*v1.NetworkSelectionElement{
+				{Name: "ib-net", Namespace: "foo"}, {Name: "ib-net", Namespace: "bar"}}
+
+			network, err := GetPodNetworkByID(networks, "bar_ib-net")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(network).To(Equal(networks[1]))
+
+			_, err = GetPodNetworkByID(networks, "default_ib-net")
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
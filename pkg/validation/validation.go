@@ -0,0 +1,251 @@
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	ibUtils "github.com/Mellanox/ib-kubernetes/pkg/ib-utils"
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+// NetworkAttachmentDefinitionValidator validates the ib-sriov network attachment definitions on create and update,
+// so broken networks are rejected instead of failing to be parsed by every periodic update. Networks of other
+// CNIs are admitted.
+type NetworkAttachmentDefinitionValidator struct {
+	// AutoPKey is true if networks may request a pkey allocated from the pkey pool
+	AutoPKey bool
+}
+
+var _ admission.CustomValidator = &NetworkAttachmentDefinitionValidator{}
+
+func (v *NetworkAttachmentDefinitionValidator) ValidateCreate(_ context.Context, obj runtime.Object) (
+	admission.Warnings, error) {
+	return nil, v.validate(obj)
+}
+
+func (v *NetworkAttachmentDefinitionValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (
+	admission.Warnings, error) {
+	return nil, v.validate(newObj)
+}
+
+func (v *NetworkAttachmentDefinitionValidator) ValidateDelete(context.Context, runtime.Object) (
+	admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *NetworkAttachmentDefinitionValidator) validate(obj runtime.Object) error {
+	netAttDef, ok := obj.(*netapi.NetworkAttachmentDefinition)
+	if !ok {
+		return fmt.Errorf("expected a NetworkAttachmentDefinition, found %T", obj)
+	}
+	if err := v.ValidateNetworkConfig(netAttDef.Spec.Config); err != nil {
+		return fmt.Errorf("invalid ib-sriov network %s/%s: %v", netAttDef.Namespace, netAttDef.Name, err)
+	}
+	return nil
+}
+
+// ValidateNetworkConfig returns an error describing all the problems of the ib-sriov spec in the network config,
+// configs without an ib-sriov spec are valid
+func (v *NetworkAttachmentDefinitionValidator) ValidateNetworkConfig(config string) error {
+	if config == "" {
+		return nil
+	}
+
+	networkSpec := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(config), &networkSpec); err != nil {
+		if strings.Contains(config, utils.InfiniBandSriovCni) {
+			return fmt.Errorf("config is not a valid JSON object: %v", err)
+		}
+		return nil
+	}
+
+	spec, err := findIbSriovSpec(networkSpec)
+	if err != nil || spec == nil {
+		return err
+	}
+
+	var problems []string
+	problems = append(problems, v.validatePKey(spec)...)
+	problems = append(problems, validateCapabilities(spec)...)
+	problems = append(problems, validateGUIDsPerInterface(spec)...)
+	if len(problems) != 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// findIbSriovSpec returns the ib-sriov spec of the network, either the network itself, one of its plugins or the
+// spec of one of its delegates, nil if the network doesn't use ib-sriov
+func findIbSriovSpec(networkSpec map[string]interface{}) (map[string]interface{}, error) {
+	if networkSpec["type"] == utils.InfiniBandSriovCni {
+		return networkSpec, nil
+	}
+
+	ibSpec, err := findIbSriovPlugin(networkSpec)
+	if err != nil || ibSpec != nil {
+		return ibSpec, err
+	}
+	return findDelegatedIbSriovSpec(networkSpec)
+}
+
+// findDelegatedIbSriovSpec returns the ib-sriov spec of the first delegate of a multus network using ib-sriov,
+// nil if there is none
+func findDelegatedIbSriovSpec(networkSpec map[string]interface{}) (map[string]interface{}, error) {
+	delegatesValue, exist := networkSpec["delegates"]
+	if !exist {
+		return nil, nil
+	}
+	delegates, ok := delegatesValue.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("\"delegates\" must be a list, found %s", jsonType(delegatesValue))
+	}
+
+	for index, delegateValue := range delegates {
+		delegate, ok := delegateValue.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ibSpec, err := findIbSriovSpec(delegate)
+		if err != nil {
+			return nil, fmt.Errorf("delegate %d: %v", index, err)
+		}
+		if ibSpec != nil {
+			return ibSpec, nil
+		}
+	}
+	return nil, nil
+}
+
+// findIbSriovPlugin returns the ib-sriov plugin of the network plugins, nil if there is none
+func findIbSriovPlugin(networkSpec map[string]interface{}) (map[string]interface{}, error) {
+	pluginsValue, exist := networkSpec["plugins"]
+	if !exist {
+		return nil, nil
+	}
+	plugins, ok := pluginsValue.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("\"plugins\" must be a list, found %s", jsonType(pluginsValue))
+	}
+
+	var ibSpec map[string]interface{}
+	var problems []string
+	for index, pluginValue := range plugins {
+		plugin, ok := pluginValue.(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("plugin %d must be an object, found %s", index,
+				jsonType(pluginValue)))
+			continue
+		}
+		pluginType, ok := plugin["type"].(string)
+		if !ok || pluginType == "" {
+			problems = append(problems, fmt.Sprintf("plugin %d has no \"type\"", index))
+			continue
+		}
+		if pluginType != utils.InfiniBandSriovCni {
+			continue
+		}
+		if ibSpec != nil {
+			problems = append(problems, fmt.Sprintf("plugin %d is a second %s plugin", index,
+				utils.InfiniBandSriovCni))
+			continue
+		}
+		ibSpec = plugin
+	}
+
+	// broken plugins of networks not using ib-sriov are left to their CNI
+	if ibSpec != nil && len(problems) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return ibSpec, nil
+}
+
+// validatePKey checks the pkey is either unset, "auto", "default" or a hex or decimal pkey in the valid range
+func (v *NetworkAttachmentDefinitionValidator) validatePKey(spec map[string]interface{}) []string {
+	pKeyValue, exist := spec["pkey"]
+	if !exist {
+		return nil
+	}
+	pKey, ok := pKeyValue.(string)
+	if !ok {
+		return []string{fmt.Sprintf("\"pkey\" must be a string such as \"0x7fff\", found %s", jsonType(pKeyValue))}
+	}
+
+	switch pKey {
+	case "", utils.DefaultPKeyName:
+		return nil
+	case utils.AutoPKey:
+		if !v.AutoPKey {
+			return []string{fmt.Sprintf("\"pkey\" %q requires the pkey pool to be configured", pKey)}
+		}
+		return nil
+	}
+	if _, err := ibUtils.ParsePKey(pKey); err != nil {
+		return []string{fmt.Sprintf("\"pkey\": %v", err)}
+	}
+	return nil
+}
+
+// validateCapabilities checks the capabilities, e.g. "infinibandGUID", are boolean flags
+func validateCapabilities(spec map[string]interface{}) []string {
+	capabilitiesValue, exist := spec["capabilities"]
+	if !exist {
+		return nil
+	}
+	capabilities, ok := capabilitiesValue.(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("\"capabilities\" must be an object, found %s", jsonType(capabilitiesValue))}
+	}
+
+	var problems []string
+	for name, value := range capabilities {
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("capability %q must be a boolean, found %s", name,
+				jsonType(value)))
+		}
+	}
+	// map iteration order is random, keep the message stable
+	sort.Strings(problems)
+	return problems
+}
+
+// validateGUIDsPerInterface checks the number of guids per interface is an integer between 1 and the maximum
+func validateGUIDsPerInterface(spec map[string]interface{}) []string {
+	countValue, exist := spec["guidsPerInterface"]
+	if !exist {
+		return nil
+	}
+	count, ok := countValue.(float64)
+	if !ok {
+		return []string{fmt.Sprintf("\"guidsPerInterface\" must be a number, found %s", jsonType(countValue))}
+	}
+	if count != float64(int(count)) || count < 1 || count > utils.MaxGUIDsPerInterface {
+		return []string{fmt.Sprintf("\"guidsPerInterface\" must be an integer between 1 and %d, found %v",
+			utils.MaxGUIDsPerInterface, count)}
+	}
+	return nil
+}
+
+// jsonType returns the JSON type name of the decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	default:
+		return "object"
+	}
+}
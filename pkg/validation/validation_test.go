@@ -0,0 +1,138 @@
+package validation
+
+import (
+	"context"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Network Attachment Definition Validation", func() {
+	var validator *NetworkAttachmentDefinitionValidator
+
+	newNetAttDef := func(config string) *netapi.NetworkAttachmentDefinition {
+		return &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "ib-net", Namespace: "default"},
+			Spec:       netapi.NetworkAttachmentDefinitionSpec{Config: config}}
+	}
+
+	BeforeEach(func() {
+		validator = &NetworkAttachmentDefinitionValidator{}
+	})
+
+	Context("ValidateNetworkConfig", func() {
+		It("Admit valid ib-sriov networks", func() {
+			for _, config := range []string{
+				`{"type": "ib-sriov"}`,
+				`{"type": "ib-sriov", "pkey": "0x7fff"}`,
+				`{"type": "ib-sriov", "pkey": "7fff"}`,
+				`{"type": "ib-sriov", "pkey": "32767"}`,
+				`{"type": "ib-sriov", "pkey": "0x8005", "capabilities": {"infinibandGUID": true}}`,
+				`{"type": "ib-sriov", "pkey": "default"}`,
+				`{"plugins": [{"type": "ib-sriov", "pkey": "0x5"}, {"type": "tuning"}]}`,
+				`{"type": "multus", "delegates": [{"plugins": [{"type": "tuning"}, {"type": "ib-sriov"}]}]}`,
+			} {
+				Expect(validator.ValidateNetworkConfig(config)).To(Succeed(), config)
+			}
+		})
+		It("Admit networks of other CNIs", func() {
+			for _, config := range []string{
+				"",
+				`{"type": "macvlan", "pkey": 5}`,
+				`{"plugins": [{"type": "bridge"}, "invalid"]}`,
+				`not json`,
+			} {
+				Expect(validator.ValidateNetworkConfig(config)).To(Succeed(), config)
+			}
+		})
+		It("Reject invalid pkeys", func() {
+			err := validator.ValidateNetworkConfig(`{"type": "ib-sriov", "pkey": "7ffz"}`)
+			Expect(err).To(MatchError(ContainSubstring("invalid pkey 7ffz")))
+
+			err = validator.ValidateNetworkConfig(`{"type": "ib-sriov", "pkey": "0x10000"}`)
+			Expect(err).To(HaveOccurred())
+
+			err = validator.ValidateNetworkConfig(`{"type": "ib-sriov", "pkey": 32767}`)
+			Expect(err).To(MatchError(ContainSubstring(`"pkey" must be a string`)))
+		})
+		It("Reject auto pkey if the pkey pool isn't configured", func() {
+			config := `{"type": "ib-sriov", "pkey": "auto"}`
+			Expect(validator.ValidateNetworkConfig(config)).To(MatchError(ContainSubstring("pkey pool")))
+
+			validator.AutoPKey = true
+			Expect(validator.ValidateNetworkConfig(config)).To(Succeed())
+		})
+		It("Reject invalid capabilities", func() {
+			err := validator.ValidateNetworkConfig(`{"type": "ib-sriov", "capabilities": {"infinibandGUID": "true"}}`)
+			Expect(err).To(MatchError(ContainSubstring(`capability "infinibandGUID" must be a boolean, found string`)))
+
+			err = validator.ValidateNetworkConfig(`{"type": "ib-sriov", "capabilities": ["infinibandGUID"]}`)
+			Expect(err).To(MatchError(ContainSubstring(`"capabilities" must be an object, found list`)))
+		})
+		It("Reject invalid guids per interface", func() {
+			Expect(validator.ValidateNetworkConfig(`{"type": "ib-sriov", "guidsPerInterface": 2}`)).To(Succeed())
+
+			err := validator.ValidateNetworkConfig(`{"type": "ib-sriov", "guidsPerInterface": "2"}`)
+			Expect(err).To(MatchError(ContainSubstring(`"guidsPerInterface" must be a number, found string`)))
+
+			for _, count := range []string{"0", "1.5", "9"} {
+				err = validator.ValidateNetworkConfig(`{"type": "ib-sriov", "guidsPerInterface": ` + count + `}`)
+				Expect(err).To(MatchError(`"guidsPerInterface" must be an integer between 1 and 8, found ` + count))
+			}
+		})
+		It("Reject invalid plugins of ib-sriov networks", func() {
+			err := validator.ValidateNetworkConfig(`{"plugins": [{"type": "ib-sriov"}, {"type": ""}]}`)
+			Expect(err).To(MatchError(ContainSubstring(`plugin 1 has no "type"`)))
+
+			err = validator.ValidateNetworkConfig(`{"plugins": [{"type": "ib-sriov"}, {"type": "ib-sriov"}]}`)
+			Expect(err).To(MatchError(ContainSubstring("plugin 1 is a second ib-sriov plugin")))
+
+			err = validator.ValidateNetworkConfig(`{"plugins": {"type": "ib-sriov"}}`)
+			Expect(err).To(MatchError(ContainSubstring(`"plugins" must be a list, found object`)))
+
+			err = validator.ValidateNetworkConfig(`{"type": "multus", "delegates": [{"type": "bridge"},
+				{"plugins": [{"type": "ib-sriov", "pkey": "7ffz"}]}]}`)
+			Expect(err).To(MatchError(ContainSubstring("invalid pkey 7ffz")))
+
+			err = validator.ValidateNetworkConfig(`{"type": "multus", "delegates": [
+				{"plugins": [{"type": "ib-sriov"}, "invalid"]}]}`)
+			Expect(err).To(MatchError(ContainSubstring("delegate 0: plugin 1 must be an object")))
+		})
+		It("Reject invalid JSON of ib-sriov networks", func() {
+			err := validator.ValidateNetworkConfig(`{"type": "ib-sriov",}`)
+			Expect(err).To(MatchError(ContainSubstring("not a valid JSON object")))
+		})
+		It("Report all the problems of the network", func() {
+			err := validator.ValidateNetworkConfig(
+				`{"type": "ib-sriov", "pkey": "wrong", "capabilities": {"infinibandGUID": 1}}`)
+			Expect(err).To(MatchError(And(ContainSubstring("invalid pkey wrong"),
+				ContainSubstring(`capability "infinibandGUID" must be a boolean`))))
+		})
+	})
+	Context("CustomValidator", func() {
+		It("Validate created and updated networks", func() {
+			valid := newNetAttDef(`{"type": "ib-sriov", "pkey": "0x5"}`)
+			invalid := newNetAttDef(`{"type": "ib-sriov", "pkey": "5z"}`)
+
+			_, err := validator.ValidateCreate(context.Background(), valid)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = validator.ValidateCreate(context.Background(), invalid)
+			Expect(err).To(MatchError(ContainSubstring("invalid ib-sriov network default/ib-net")))
+
+			_, err = validator.ValidateUpdate(context.Background(), valid, invalid)
+			Expect(err).To(HaveOccurred())
+			_, err = validator.ValidateUpdate(context.Background(), invalid, valid)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = validator.ValidateDelete(context.Background(), invalid)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("Reject objects which aren't networks", func() {
+			_, err := validator.ValidateCreate(context.Background(), &kapi.Pod{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,136 @@
+// Package webhook notifies external systems, e.g. IPAM or CMDB, about GUID allocations and pkey membership
+// changes by posting JSON events to configured URLs
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/tracing"
+)
+
+// EventType is the type of GUID lifecycle event
+type EventType string
+
+const (
+	// GUIDAllocated is sent when a GUID is allocated for a pod network or a guid reservation
+	GUIDAllocated EventType = "guid.allocated"
+	// GUIDReleased is sent when a GUID is released back to the pool
+	GUIDReleased EventType = "guid.released"
+	// PKeyMembersAdded is sent when GUIDs are added to a pkey in the subnet manager
+	PKeyMembersAdded EventType = "pkey.members_added"
+	// PKeyMembersRemoved is sent when GUIDs are removed from a pkey in the subnet manager
+	PKeyMembersRemoved EventType = "pkey.members_removed"
+)
+
+const (
+	// queueSize is the number of events buffered for delivery, newer events are dropped when it is full
+	queueSize = 1024
+	// requestTimeout limits the time of a single webhook request
+	requestTimeout = 10 * time.Second
+)
+
+// Event is the JSON payload posted to the webhooks
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	// GUID is set for guid events
+	GUID string `json:"guid,omitempty"`
+	// PodUID, NetworkID and Interface identify the pod network interface of guid events
+	PodUID    string `json:"podUID,omitempty"`
+	NetworkID string `json:"networkID,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	// PKey and GUIDs are set for pkey events
+	PKey  string   `json:"pkey,omitempty"`
+	GUIDs []string `json:"guids,omitempty"`
+}
+
+// Notifier delivers events to the configured webhooks
+type Notifier interface {
+	// Notify queues the event for delivery, it doesn't block
+	Notify(event *Event)
+	// Run delivers queued events until stopCh is closed
+	Run(stopCh <-chan struct{})
+}
+
+type notifier struct {
+	urls       []string
+	events     chan *Event
+	httpClient *http.Client
+}
+
+// NewNotifier returns notifier posting events to the given urls, or nil if no urls are given
+func NewNotifier(urls []string) Notifier {
+	if len(urls) == 0 {
+		return nil
+	}
+
+	return &notifier{
+		urls:       urls,
+		events:     make(chan *Event, queueSize),
+		httpClient: &http.Client{Timeout: requestTimeout, Transport: tracing.WrapTransport(nil)},
+	}
+}
+
+func (n *notifier) Notify(event *Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	select {
+	case n.events <- event:
+	default:
+		log.Warn().Msgf("webhook events queue is full, dropping %s event", event.Type)
+	}
+}
+
+func (n *notifier) Run(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case event := <-n.events:
+			n.deliver(event)
+		}
+	}
+}
+
+// deliver posts the event to all webhooks, delivery is best effort and failures are only logged
+func (n *notifier) deliver(event *Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Msgf("failed to marshal webhook %s event: %v", event.Type, err)
+		return
+	}
+
+	for _, url := range n.urls {
+		if err = n.post(url, data); err != nil {
+			log.Warn().Msgf("failed to send %s event to webhook %s: %v", event.Type, url, err)
+		}
+	}
+}
+
+func (n *notifier) post(url string, data []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
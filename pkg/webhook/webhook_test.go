@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type webhookServer struct {
+	server *httptest.Server
+	mutex  sync.Mutex
+	events []Event
+}
+
+func newWebhookServer(status int) *webhookServer {
+	w := &webhookServer{}
+	w.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		event := Event{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.mutex.Lock()
+		w.events = append(w.events, event)
+		w.mutex.Unlock()
+		rw.WriteHeader(status)
+	}))
+	return w
+}
+
+func (w *webhookServer) Events() []Event {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]Event(nil), w.events...)
+}
+
+var _ = Describe("Webhook Notifier", func() {
+	It("Return nil notifier without urls", func() {
+		Expect(NewNotifier(nil)).To(BeNil())
+	})
+
+	It("Deliver events to all webhooks", func() {
+		first := newWebhookServer(http.StatusOK)
+		defer first.server.Close()
+		// failing webhook doesn't prevent delivery to others
+		failing := newWebhookServer(http.StatusInternalServerError)
+		defer failing.server.Close()
+		second := newWebhookServer(http.StatusNoContent)
+		defer second.server.Close()
+
+		notifier := NewNotifier([]string{first.server.URL, failing.server.URL, second.server.URL})
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go notifier.Run(stopCh)
+
+		notifier.Notify(&Event{Type: GUIDAllocated, GUID: "02:00:00:00:00:00:00:01", PodUID: "pod-uid",
+			NetworkID: "default_ib-net"})
+		notifier.Notify(&Event{Type: PKeyMembersAdded, PKey: "0x5", GUIDs: []string{"02:00:00:00:00:00:00:01"}})
+
+		for _, server := range []*webhookServer{first, failing, second} {
+			Eventually(server.Events).Should(HaveLen(2))
+		}
+
+		events := second.Events()
+		Expect(events[0].Type).To(Equal(GUIDAllocated))
+		Expect(events[0].GUID).To(Equal("02:00:00:00:00:00:00:01"))
+		Expect(events[0].Timestamp.IsZero()).To(BeFalse())
+		Expect(events[1].Type).To(Equal(PKeyMembersAdded))
+		Expect(events[1].GUIDs).To(Equal([]string{"02:00:00:00:00:00:00:01"}))
+	})
+
+	It("Drop events when the queue is full", func() {
+		n := NewNotifier([]string{"http://127.0.0.1:1"}).(*notifier)
+		for i := 0; i < queueSize+10; i++ {
+			n.Notify(&Event{Type: GUIDReleased})
+		}
+		Expect(n.events).To(HaveLen(queueSize))
+	})
+})
@@ -0,0 +1,108 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	netclient "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/client/clientset/versioned/typed/k8s.cni.cncf.io/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/daemon"
+)
+
+var (
+	testEnv    *envtest.Environment
+	fakeUFM    *fakeUFMServer
+	kubeClient kubernetes.Interface
+	netClient  netclient.K8sCniCncfIoV1Interface
+	daemonDone chan struct{}
+)
+
+func TestE2E(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "End-to-End Suite")
+}
+
+var _ = BeforeSuite(func() {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		Skip("KUBEBUILDER_ASSETS is not set, run \"make test-e2e\" to set up envtest binaries")
+	}
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	pluginsDir, err := filepath.Abs(filepath.Join("..", "..", "build", "plugins"))
+	Expect(err).ToNot(HaveOccurred())
+	_, err = os.Stat(filepath.Join(pluginsDir, "ufm.so"))
+	Expect(err).ToNot(HaveOccurred(), "ufm plugin is missing, run \"make plugins\"")
+
+	By("starting envtest control plane")
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("testdata", "crds")},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := testEnv.Start()
+	Expect(err).ToNot(HaveOccurred())
+
+	kubeClient, err = kubernetes.NewForConfig(cfg)
+	Expect(err).ToNot(HaveOccurred())
+	netClient, err = netclient.NewForConfig(cfg)
+	Expect(err).ToNot(HaveOccurred())
+
+	user, err := testEnv.AddUser(envtest.User{Name: "ib-kubernetes", Groups: []string{"system:masters"}}, nil)
+	Expect(err).ToNot(HaveOccurred())
+	kubeConfig, err := user.KubeConfig()
+	Expect(err).ToNot(HaveOccurred())
+	kubeConfigPath := filepath.Join(GinkgoT().TempDir(), "kubeconfig")
+	Expect(os.WriteFile(kubeConfigPath, kubeConfig, 0o600)).To(Succeed())
+
+	By("starting fake UFM server")
+	fakeUFM = newFakeUFMServer()
+	ufmHost, ufmPort := fakeUFM.Address()
+
+	By("starting ib-kubernetes daemon")
+	for key, value := range map[string]string{
+		"KUBECONFIG":             kubeConfigPath,
+		"DAEMON_SM_PLUGIN":       "ufm",
+		"DAEMON_SM_PLUGIN_PATH":  pluginsDir,
+		"DAEMON_PERIODIC_UPDATE": "1",
+		"UFM_USERNAME":           "admin",
+		"UFM_PASSWORD":           "123456",
+		"UFM_ADDRESS":            ufmHost,
+		"UFM_PORT":               ufmPort,
+		"UFM_HTTP_SCHEMA":        "http",
+	} {
+		Expect(os.Setenv(key, value)).To(Succeed())
+	}
+
+	ibDaemon, err := daemon.NewDaemon()
+	Expect(err).ToNot(HaveOccurred())
+
+	daemonDone = make(chan struct{})
+	go func() {
+		defer GinkgoRecover()
+		defer close(daemonDone)
+		ibDaemon.Run()
+	}()
+})
+
+var _ = AfterSuite(func() {
+	if daemonDone != nil {
+		By("stopping ib-kubernetes daemon")
+		// Daemon.Run returns when receiving a termination signal
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGTERM)).To(Succeed())
+		Eventually(daemonDone).Should(BeClosed())
+	}
+
+	if fakeUFM != nil {
+		fakeUFM.Close()
+	}
+
+	if testEnv != nil {
+		Expect(testEnv.Stop()).To(Succeed())
+	}
+})
@@ -0,0 +1,94 @@
+package e2e
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	netapi "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	netAttUtils "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/utils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mellanox/ib-kubernetes/pkg/utils"
+)
+
+const (
+	timeout  = 60 * time.Second
+	interval = 500 * time.Millisecond
+)
+
+var _ = Describe("InfiniBand pod lifecycle", func() {
+	const (
+		namespace   = "default"
+		networkName = "ib-sriov-network"
+		pKey        = "0x0005"
+	)
+
+	BeforeEach(func() {
+		nad := &netapi.NetworkAttachmentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: networkName, Namespace: namespace},
+			Spec: netapi.NetworkAttachmentDefinitionSpec{
+				Config: `{"type": "ib-sriov", "cniVersion": "0.3.1", "name": "sriov-network", "pkey": "0x5"}`,
+			},
+		}
+		_, err := netClient.NetworkAttachmentDefinitions(namespace).Create(
+			context.Background(), nad, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(func() {
+			Expect(netClient.NetworkAttachmentDefinitions(namespace).Delete(
+				context.Background(), networkName, metav1.DeleteOptions{})).To(Succeed())
+		})
+	})
+
+	It("configures the pod GUID in the pkey and removes it when the pod is deleted", func() {
+		By("creating a scheduled pod requesting the InfiniBand network")
+		pod := &kapi.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ib-pod",
+				Namespace: namespace,
+				Annotations: map[string]string{
+					netapi.NetworkAttachmentAnnot: `[{"name": "` + networkName + `", "namespace": "` + namespace + `"}]`,
+				},
+			},
+			Spec: kapi.PodSpec{
+				NodeName:   "node-1",
+				Containers: []kapi.Container{{Name: "test", Image: "busybox"}},
+			},
+		}
+		_, err := kubeClient.CoreV1().Pods(namespace).Create(context.Background(), pod, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		By("waiting for the pod network annotation to be configured")
+		var podGUID string
+		Eventually(func(g Gomega) {
+			updatedPod, err := kubeClient.CoreV1().Pods(namespace).Get(
+				context.Background(), pod.Name, metav1.GetOptions{})
+			g.Expect(err).ToNot(HaveOccurred())
+
+			networks, err := netAttUtils.ParsePodNetworkAnnotation(updatedPod)
+			g.Expect(err).ToNot(HaveOccurred())
+			network, err := utils.GetPodNetwork(networks, networkName)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(utils.IsPodNetworkConfiguredWithInfiniBand(utils.NewPodRef(updatedPod), network)).To(BeTrue())
+
+			podGUID, err = utils.GetPodNetworkGUID(network)
+			g.Expect(err).ToNot(HaveOccurred())
+		}, timeout, interval).Should(Succeed())
+
+		By("verifying the GUID is a member of the network pkey")
+		ufmGUID := strings.ToLower(strings.ReplaceAll(podGUID, ":", ""))
+		Expect(fakeUFM.GUIDsInPKey(pKey)).To(ContainElement(ufmGUID))
+
+		By("deleting the pod")
+		Expect(kubeClient.CoreV1().Pods(namespace).Delete(context.Background(), pod.Name,
+			*metav1.NewDeleteOptions(0))).To(Succeed())
+
+		By("waiting for the GUID to be removed from the pkey")
+		Eventually(func() []string {
+			return fakeUFM.GUIDsInPKey(pKey)
+		}, timeout, interval).ShouldNot(ContainElement(ufmGUID))
+	})
+})
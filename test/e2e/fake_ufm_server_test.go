@@ -0,0 +1,159 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const fakeUFMVersion = "6.10.0-1"
+
+// fakeUFMServer is an in-process UFM REST server keeping pkeys membership in memory
+type fakeUFMServer struct {
+	server *httptest.Server
+	mutex  sync.Mutex
+	pKeys  map[string]map[string]bool // pkey mapped to the set of its member guids
+}
+
+type fakeUFMPKeyRequest struct {
+	PKey  string   `json:"pkey"`
+	GUIDs []string `json:"guids"`
+}
+
+type fakeUFMGUID struct {
+	GUID string `json:"guid"`
+}
+
+type fakeUFMPKey struct {
+	GUIDs []fakeUFMGUID `json:"guids"`
+}
+
+func newFakeUFMPKey(guids map[string]bool) fakeUFMPKey {
+	pKeyData := fakeUFMPKey{GUIDs: []fakeUFMGUID{}}
+	for guid := range guids {
+		pKeyData.GUIDs = append(pKeyData.GUIDs, fakeUFMGUID{GUID: guid})
+	}
+	return pKeyData
+}
+
+func newFakeUFMServer() *fakeUFMServer {
+	f := &fakeUFMServer{pKeys: make(map[string]map[string]bool)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ufmRest/app/ufm_version", f.handleVersion)
+	mux.HandleFunc("/ufmRest/resources/pkeys", f.handlePKeys)
+	mux.HandleFunc("/ufmRest/resources/pkeys/", f.handlePKeys)
+	mux.HandleFunc("/ufmRest/actions/remove_guids_from_pkey", f.handleRemoveGUIDs)
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+// Address returns the host and port of the server
+func (f *fakeUFMServer) Address() (string, string) {
+	hostPort := strings.TrimPrefix(f.server.URL, "http://")
+	idx := strings.LastIndex(hostPort, ":")
+	return hostPort[:idx], hostPort[idx+1:]
+}
+
+func (f *fakeUFMServer) Close() {
+	f.server.Close()
+}
+
+// GUIDsInPKey returns the sorted guids members of given pkey
+func (f *fakeUFMServer) GUIDsInPKey(pKey string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	guids := make([]string, 0, len(f.pKeys[pKey]))
+	for guid := range f.pKeys[pKey] {
+		guids = append(guids, guid)
+	}
+	sort.Strings(guids)
+	return guids
+}
+
+func (f *fakeUFMServer) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, map[string]string{"ufm_release_version": fakeUFMVersion})
+}
+
+func (f *fakeUFMServer) handlePKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if pKey := strings.TrimPrefix(r.URL.Path, "/ufmRest/resources/pkeys/"); pKey != "" && pKey != r.URL.Path {
+			guids, exist := f.pKeys[pKey]
+			if !exist {
+				http.NotFound(w, r)
+				return
+			}
+			writeJSON(w, newFakeUFMPKey(guids))
+			return
+		}
+
+		response := make(map[string]fakeUFMPKey, len(f.pKeys))
+		for pKey, guids := range f.pKeys {
+			response[pKey] = newFakeUFMPKey(guids)
+		}
+		writeJSON(w, response)
+	case http.MethodPost:
+		request, ok := readPKeyRequest(w, r)
+		if !ok {
+			return
+		}
+
+		f.mutex.Lock()
+		if _, exist := f.pKeys[request.PKey]; !exist {
+			f.pKeys[request.PKey] = make(map[string]bool)
+		}
+		for _, guid := range request.GUIDs {
+			f.pKeys[request.PKey][guid] = true
+		}
+		f.mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeUFMServer) handleRemoveGUIDs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	request, ok := readPKeyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	f.mutex.Lock()
+	for _, guid := range request.GUIDs {
+		delete(f.pKeys[request.PKey], guid)
+	}
+	f.mutex.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func readPKeyRequest(w http.ResponseWriter, r *http.Request) (*fakeUFMPKeyRequest, bool) {
+	request := &fakeUFMPKeyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return request, true
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}